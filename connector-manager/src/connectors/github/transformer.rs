@@ -15,6 +15,9 @@ pub fn repo_to_event(repo: &GitHubRepo) -> FluxEvent {
         timestamp: Utc::now().timestamp_millis(),
         key: Some(format!("github/repo/{}", repo.full_name)),
         schema: Some("github.repository".to_string()),
+        priority: None,
+        envelope_version: None,
+        received_at: None,
         payload: serde_json::json!({
             "entity_id": format!("github/repo/{}", repo.full_name),
             "properties": {
@@ -29,6 +32,7 @@ pub fn repo_to_event(repo: &GitHubRepo) -> FluxEvent {
                 "updated_at": repo.updated_at,
             }
         }),
+        raw_payload: None,
     }
 }
 
@@ -43,6 +47,9 @@ pub fn notification_to_event(notification: &GitHubNotification) -> FluxEvent {
         timestamp: Utc::now().timestamp_millis(),
         key: Some(format!("github/notification/{}", notification.id)),
         schema: Some("github.notification".to_string()),
+        priority: None,
+        envelope_version: None,
+        received_at: None,
         payload: serde_json::json!({
             "entity_id": format!("github/notification/{}", notification.id),
             "properties": {
@@ -55,6 +62,7 @@ pub fn notification_to_event(notification: &GitHubNotification) -> FluxEvent {
                 "subject_url": notification.subject.url,
             }
         }),
+        raw_payload: None,
     }
 }
 
@@ -69,6 +77,9 @@ pub fn issue_to_event(owner: &str, repo: &str, issue: &GitHubIssue) -> FluxEvent
         timestamp: Utc::now().timestamp_millis(),
         key: Some(format!("github/issue/{}/{}/{}", owner, repo, issue.number)),
         schema: Some("github.issue".to_string()),
+        priority: None,
+        envelope_version: None,
+        received_at: None,
         payload: serde_json::json!({
             "entity_id": format!("github/issue/{}/{}/{}", owner, repo, issue.number),
             "properties": {
@@ -80,6 +91,7 @@ pub fn issue_to_event(owner: &str, repo: &str, issue: &GitHubIssue) -> FluxEvent
                 "updated_at": issue.updated_at,
             }
         }),
+        raw_payload: None,
     }
 }
 
@@ -2,7 +2,9 @@
 //!
 //! This crate defines the standard interface that all Flux connectors must implement.
 //! Connectors integrate external APIs (GitHub, Gmail, etc.) with Flux by polling
-//! for data and transforming it into Flux events.
+//! for data and transforming it into Flux events. The MQTT bridge
+//! (`runners::mqtt`) instead subscribes to broker topics and publishes each
+//! message as it arrives.
 //!
 //! # Architecture
 //!
@@ -78,6 +80,7 @@ pub mod api;
 pub mod connectors;
 pub mod generic_config;
 pub mod manager;
+pub mod mqtt_config;
 pub mod named_config;
 pub mod registry;
 pub mod runners;
@@ -2,8 +2,10 @@ use anyhow::{Context, Result};
 use connector_manager::api::{create_router, ApiState};
 use connector_manager::generic_config::GenericConfigStore;
 use connector_manager::manager::ConnectorManager;
+use connector_manager::mqtt_config::MqttBridgeConfig;
 use connector_manager::named_config::NamedConfigStore;
 use connector_manager::runners::generic::GenericRunner;
+use connector_manager::runners::mqtt::MqttBridge;
 use connector_manager::runners::named::{NamedRunner, TapCatalogStore};
 use flux::credentials::CredentialStore;
 use std::sync::Arc;
@@ -115,6 +117,20 @@ async fn main() -> Result<()> {
         }
     }
 
+    // Start the MQTT bridge if configured
+    let mqtt_bridge = match std::env::var("MQTT_BRIDGE_CONFIG") {
+        Ok(path) => {
+            let config = MqttBridgeConfig::load(&path)?;
+            info!(
+                broker = %config.broker_url,
+                routes = config.routes.len(),
+                "MQTT bridge configured"
+            );
+            Some(MqttBridge::new(config, flux_api_url.clone())?.start())
+        }
+        Err(_) => None,
+    };
+
     // Initialize tap catalog store (load from disk if cached, else empty)
     let tap_catalog_path = std::env::var("TAP_CATALOG_CACHE")
         .unwrap_or_else(|_| "/tmp/flux-tap-catalog.json".to_string());
@@ -165,6 +181,9 @@ async fn main() -> Result<()> {
 
     // Graceful shutdown
     server_handle.abort();
+    if let Some(handle) = mqtt_bridge {
+        handle.abort();
+    }
     manager.shutdown().await;
     info!("Connector manager stopped");
 
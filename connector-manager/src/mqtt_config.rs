@@ -0,0 +1,304 @@
+//! MQTT bridge config.
+//!
+//! The bridge is configured from a JSON file (`MQTT_BRIDGE_CONFIG`): the
+//! broker, its credentials and a list of routes. Each route is a topic
+//! template such as `sensors/{site}/{device}`; its `{name}` segments match
+//! one topic level each and can be used in the route's stream, key and
+//! source templates (e.g. stream `sensor.{site}`, key `{device}`). The topic
+//! filter subscribed to is the template with every `{name}` replaced by `+`.
+
+use anyhow::{bail, Context, Result};
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+
+/// Default stream for messages the bridge cannot turn into events.
+pub const DEFAULT_DEAD_LETTER_STREAM: &str = "mqtt.deadletter";
+
+/// Config for the MQTT bridge.
+#[derive(Clone, Debug, Serialize, Deserialize)]
+pub struct MqttBridgeConfig {
+    /// Broker URL, e.g. `mqtt://broker:1883` (`tcp://` is accepted too).
+    pub broker_url: String,
+    /// MQTT client id; also the event source unless a route sets one.
+    #[serde(default = "default_client_id")]
+    pub client_id: String,
+    #[serde(default)]
+    pub username: Option<String>,
+    #[serde(default)]
+    pub password: Option<String>,
+    /// Topic templates and where their messages are published.
+    pub routes: Vec<MqttRoute>,
+    /// Stream for malformed payloads and messages Flux rejects.
+    #[serde(default = "default_dead_letter_stream")]
+    pub dead_letter_stream: String,
+    /// Optional Flux namespace token for auth-enabled Flux instances.
+    #[serde(default)]
+    pub flux_namespace_token: Option<String>,
+}
+
+/// One topic template and the stream, key and source it maps to.
+#[derive(Clone, Debug, Serialize, Deserialize)]
+pub struct MqttRoute {
+    /// Topic template, e.g. `sensors/{site}/{device}`; may end in `#`.
+    pub topic: String,
+    /// Stream template, e.g. `sensor.{site}`.
+    pub stream: String,
+    /// Key template, e.g. `{device}` (no key when unset).
+    #[serde(default)]
+    pub key: Option<String>,
+    /// Source template (the client id when unset).
+    #[serde(default)]
+    pub source: Option<String>,
+}
+
+fn default_client_id() -> String {
+    "flux-mqtt-bridge".to_string()
+}
+
+fn default_dead_letter_stream() -> String {
+    DEFAULT_DEAD_LETTER_STREAM.to_string()
+}
+
+impl MqttBridgeConfig {
+    /// Reads and validates the config file at `path`.
+    pub fn load(path: &str) -> Result<Self> {
+        let contents = std::fs::read_to_string(path)
+            .with_context(|| format!("Failed to read MQTT bridge config at {}", path))?;
+        let config: Self = serde_json::from_str(&contents)
+            .with_context(|| format!("Invalid MQTT bridge config at {}", path))?;
+        config.validate()?;
+        Ok(config)
+    }
+
+    /// Checks the broker URL and that every template only uses variables
+    /// its topic defines.
+    pub fn validate(&self) -> Result<()> {
+        self.broker_address()?;
+        if self.routes.is_empty() {
+            bail!("MQTT bridge config has no routes");
+        }
+        for route in &self.routes {
+            let template = TopicTemplate::parse(&route.topic)?;
+            let templates = [
+                Some(&route.stream),
+                route.key.as_ref(),
+                route.source.as_ref(),
+            ];
+            for text in templates.into_iter().flatten() {
+                for name in placeholders(text) {
+                    if !template.variables().any(|v| v == name) {
+                        bail!(
+                            "template '{}' uses {{{}}}, which topic '{}' does not define",
+                            text,
+                            name,
+                            route.topic
+                        );
+                    }
+                }
+            }
+        }
+        Ok(())
+    }
+
+    /// Host and port from `broker_url` (port 1883 when not given).
+    pub fn broker_address(&self) -> Result<(String, u16)> {
+        let rest = ["mqtt://", "tcp://"]
+            .iter()
+            .find_map(|scheme| self.broker_url.strip_prefix(scheme))
+            .with_context(|| {
+                format!(
+                    "unsupported MQTT broker URL '{}' (expected mqtt:// or tcp://)",
+                    self.broker_url
+                )
+            })?;
+        let rest = rest.trim_end_matches('/');
+        match rest.rsplit_once(':') {
+            Some((host, port)) => {
+                let port = port.parse().with_context(|| {
+                    format!("invalid port in MQTT broker URL '{}'", self.broker_url)
+                })?;
+                Ok((host.to_string(), port))
+            }
+            None => Ok((rest.to_string(), 1883)),
+        }
+    }
+}
+
+/// A topic template split into levels.
+#[derive(Clone, Debug, PartialEq)]
+pub struct TopicTemplate {
+    levels: Vec<Level>,
+}
+
+#[derive(Clone, Debug, PartialEq)]
+enum Level {
+    Literal(String),
+    Variable(String),
+    /// Trailing `#`: any remaining levels
+    Rest,
+}
+
+impl TopicTemplate {
+    pub fn parse(template: &str) -> Result<Self> {
+        let parts: Vec<&str> = template.split('/').collect();
+        let mut levels = Vec::with_capacity(parts.len());
+        for (i, part) in parts.iter().enumerate() {
+            let level = if let Some(name) = part.strip_prefix('{').and_then(|p| p.strip_suffix('}'))
+            {
+                if name.is_empty() {
+                    bail!("empty variable in topic template '{}'", template);
+                }
+                Level::Variable(name.to_string())
+            } else if *part == "#" && i == parts.len() - 1 {
+                Level::Rest
+            } else if part.contains(['+', '#', '{', '}']) {
+                bail!("invalid level '{}' in topic template '{}'", part, template);
+            } else {
+                Level::Literal(part.to_string())
+            };
+            levels.push(level);
+        }
+        Ok(Self { levels })
+    }
+
+    /// The MQTT topic filter to subscribe to.
+    pub fn filter(&self) -> String {
+        self.levels
+            .iter()
+            .map(|level| match level {
+                Level::Literal(text) => text.as_str(),
+                Level::Variable(_) => "+",
+                Level::Rest => "#",
+            })
+            .collect::<Vec<_>>()
+            .join("/")
+    }
+
+    /// The variables in `topic`, or `None` if it does not match.
+    pub fn matches(&self, topic: &str) -> Option<HashMap<String, String>> {
+        let parts: Vec<&str> = topic.split('/').collect();
+        let mut vars = HashMap::new();
+        for (i, level) in self.levels.iter().enumerate() {
+            match level {
+                Level::Rest => return Some(vars),
+                Level::Literal(text) => {
+                    if parts.get(i) != Some(&text.as_str()) {
+                        return None;
+                    }
+                }
+                Level::Variable(name) => match parts.get(i) {
+                    Some(part) if !part.is_empty() => {
+                        vars.insert(name.clone(), part.to_string());
+                    }
+                    _ => return None,
+                },
+            }
+        }
+        (parts.len() == self.levels.len()).then_some(vars)
+    }
+
+    fn variables(&self) -> impl Iterator<Item = &str> {
+        self.levels.iter().filter_map(|level| match level {
+            Level::Variable(name) => Some(name.as_str()),
+            _ => None,
+        })
+    }
+}
+
+/// `template` with each `{name}` replaced by its value in `vars`.
+pub fn render(template: &str, vars: &HashMap<String, String>) -> String {
+    let mut out = template.to_string();
+    for (name, value) in vars {
+        out = out.replace(&format!("{{{}}}", name), value);
+    }
+    out
+}
+
+/// Names of the `{name}` placeholders in `text`.
+fn placeholders(text: &str) -> Vec<&str> {
+    text.split('{')
+        .skip(1)
+        .filter_map(|part| part.split_once('}').map(|(name, _)| name))
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn config(routes: Vec<MqttRoute>) -> MqttBridgeConfig {
+        MqttBridgeConfig {
+            broker_url: "mqtt://broker:1883".to_string(),
+            client_id: default_client_id(),
+            username: None,
+            password: None,
+            routes,
+            dead_letter_stream: default_dead_letter_stream(),
+            flux_namespace_token: None,
+        }
+    }
+
+    fn route(topic: &str, stream: &str, key: Option<&str>) -> MqttRoute {
+        MqttRoute {
+            topic: topic.to_string(),
+            stream: stream.to_string(),
+            key: key.map(str::to_string),
+            source: None,
+        }
+    }
+
+    #[test]
+    fn test_template_filter_and_match() {
+        let template = TopicTemplate::parse("sensors/{site}/{device}").unwrap();
+        assert_eq!(template.filter(), "sensors/+/+");
+
+        let vars = template.matches("sensors/plant1/dev7").unwrap();
+        assert_eq!(render("sensor.{site}", &vars), "sensor.plant1");
+        assert_eq!(render("{device}", &vars), "dev7");
+
+        assert!(template.matches("sensors/plant1").is_none());
+        assert!(template.matches("sensors/plant1/dev7/extra").is_none());
+        assert!(template.matches("alarms/plant1/dev7").is_none());
+        assert!(template.matches("sensors//dev7").is_none());
+    }
+
+    #[test]
+    fn test_template_trailing_wildcard() {
+        let template = TopicTemplate::parse("plc/{line}/#").unwrap();
+        assert_eq!(template.filter(), "plc/+/#");
+        let vars = template.matches("plc/l2/motor/temp").unwrap();
+        assert_eq!(vars["line"], "l2");
+        assert!(TopicTemplate::parse("plc/#/temp").is_err());
+        assert!(TopicTemplate::parse("plc/+/temp").is_err());
+    }
+
+    #[test]
+    fn test_validate_rejects_unknown_variables() {
+        let ok = config(vec![route(
+            "sensors/{site}/{device}",
+            "sensor.{site}",
+            Some("{device}"),
+        )]);
+        assert!(ok.validate().is_ok());
+
+        let bad = config(vec![route(
+            "sensors/{site}",
+            "sensor.{site}",
+            Some("{device}"),
+        )]);
+        let err = bad.validate().unwrap_err().to_string();
+        assert!(err.contains("{device}"), "{}", err);
+
+        assert!(config(vec![]).validate().is_err());
+    }
+
+    #[test]
+    fn test_broker_address() {
+        let mut c = config(vec![]);
+        assert_eq!(c.broker_address().unwrap(), ("broker".to_string(), 1883));
+        c.broker_url = "tcp://10.0.0.5:8883".to_string();
+        assert_eq!(c.broker_address().unwrap(), ("10.0.0.5".to_string(), 8883));
+        c.broker_url = "http://broker".to_string();
+        assert!(c.broker_address().is_err());
+    }
+}
@@ -1,3 +1,4 @@
 pub mod builtin;
 pub mod generic;
+pub mod mqtt;
 pub mod named;
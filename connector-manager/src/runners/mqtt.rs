@@ -0,0 +1,578 @@
+//! MQTT bridge runner.
+//!
+//! `MqttBridge` subscribes to the topic filters of its routes (see
+//! `mqtt_config`) and publishes every message as a Flux event through the
+//! Flux API, which answers only once JetStream has acked the event. Messages
+//! are received with QoS 1 and acked to the broker only after that, so a
+//! message whose publish fails stays unacked: the run ends and the broker
+//! redelivers it once the bridge has reconnected (persistent session).
+//!
+//! Payloads that are not JSON, messages that do not make a valid event and
+//! events Flux rejects are published to the dead-letter stream instead, then
+//! acked. Dead letters carry at most `MAX_DEAD_LETTER_PAYLOAD` bytes of the
+//! original payload; one that Flux rejects too is logged and acked, so a
+//! message Flux will never take cannot stall the bridge.
+
+use crate::mqtt_config::{render, MqttBridgeConfig, MqttRoute, TopicTemplate};
+use anyhow::{bail, Context, Result};
+use async_trait::async_trait;
+use base64::{engine::general_purpose::STANDARD as BASE64, Engine};
+use flux::FluxEvent;
+use rumqttc::{AsyncClient, Event, EventLoop, MqttOptions, Packet, Publish, QoS};
+use serde_json::{json, Value};
+use std::collections::HashMap;
+use std::time::Duration;
+use tracing::{error, info, warn};
+
+/// Bytes of the original payload kept in a dead letter, so an oversized
+/// message still fits once dead-lettered.
+pub const MAX_DEAD_LETTER_PAYLOAD: usize = 4096;
+
+/// A message received from the broker.
+#[derive(Clone, Debug)]
+pub struct MqttMessage {
+    pub topic: String,
+    pub payload: Vec<u8>,
+    /// Packet id of the publish, used to ack it
+    pub packet_id: u16,
+}
+
+/// Broker connection the bridge reads from: `RumqttcClient`, or a mock in
+/// tests.
+#[async_trait]
+pub trait MqttClient: Send {
+    /// Subscribes to `filters` with QoS 1.
+    async fn subscribe(&mut self, filters: &[String]) -> Result<()>;
+
+    /// Waits for the next message; `None` once the broker closed the connection.
+    async fn next_message(&mut self) -> Result<Option<MqttMessage>>;
+
+    /// Acks `message` to the broker (PUBACK).
+    async fn ack(&mut self, message: &MqttMessage) -> Result<()>;
+}
+
+/// `MqttClient` over a rumqttc connection with manual acks.
+pub struct RumqttcClient {
+    client: AsyncClient,
+    eventloop: EventLoop,
+    /// Received publishes not acked yet, by packet id
+    pending: HashMap<u16, Publish>,
+}
+
+impl RumqttcClient {
+    /// Connects lazily: the connection is made by the first `next_message`.
+    pub fn new(config: &MqttBridgeConfig) -> Result<Self> {
+        let (host, port) = config.broker_address()?;
+        let mut options = MqttOptions::new(config.client_id.clone(), host, port);
+        options.set_keep_alive(Duration::from_secs(30));
+        // Keep the session so unacked messages are redelivered on reconnect
+        options.set_clean_session(false);
+        options.set_manual_acks(true);
+        if let Some(username) = &config.username {
+            options.set_credentials(
+                username.clone(),
+                config.password.clone().unwrap_or_default(),
+            );
+        }
+        let (client, eventloop) = AsyncClient::new(options, 64);
+        Ok(Self {
+            client,
+            eventloop,
+            pending: HashMap::new(),
+        })
+    }
+}
+
+#[async_trait]
+impl MqttClient for RumqttcClient {
+    async fn subscribe(&mut self, filters: &[String]) -> Result<()> {
+        for filter in filters {
+            self.client
+                .subscribe(filter.clone(), QoS::AtLeastOnce)
+                .await
+                .with_context(|| format!("Failed to subscribe to '{}'", filter))?;
+        }
+        Ok(())
+    }
+
+    async fn next_message(&mut self) -> Result<Option<MqttMessage>> {
+        loop {
+            match self
+                .eventloop
+                .poll()
+                .await
+                .context("MQTT connection failed")?
+            {
+                Event::Incoming(Packet::Publish(publish)) => {
+                    let message = MqttMessage {
+                        topic: publish.topic.clone(),
+                        payload: publish.payload.to_vec(),
+                        packet_id: publish.pkid,
+                    };
+                    self.pending.insert(publish.pkid, publish);
+                    return Ok(Some(message));
+                }
+                Event::Incoming(Packet::Disconnect) => return Ok(None),
+                _ => {}
+            }
+        }
+    }
+
+    async fn ack(&mut self, message: &MqttMessage) -> Result<()> {
+        if let Some(publish) = self.pending.remove(&message.packet_id) {
+            self.client
+                .ack(&publish)
+                .await
+                .context("Failed to ack MQTT message")?;
+        }
+        Ok(())
+    }
+}
+
+/// MQTT bridge — publishes broker messages to Flux per the configured routes.
+pub struct MqttBridge {
+    config: MqttBridgeConfig,
+    routes: Vec<(TopicTemplate, MqttRoute)>,
+    flux_api_url: String,
+    http_client: reqwest::Client,
+}
+
+impl MqttBridge {
+    pub fn new(config: MqttBridgeConfig, flux_api_url: String) -> Result<Self> {
+        config.validate()?;
+        let routes = config
+            .routes
+            .iter()
+            .map(|route| Ok((TopicTemplate::parse(&route.topic)?, route.clone())))
+            .collect::<Result<_>>()?;
+        let http_client = reqwest::Client::builder()
+            .timeout(Duration::from_secs(30))
+            .build()?;
+        Ok(Self {
+            config,
+            routes,
+            flux_api_url,
+            http_client,
+        })
+    }
+
+    /// Topic filters of all routes.
+    pub fn filters(&self) -> Vec<String> {
+        self.routes
+            .iter()
+            .map(|(template, _)| template.filter())
+            .collect()
+    }
+
+    /// Runs the bridge in a background task: connect, `run`, and reconnect
+    /// after a 5-second backoff whenever the run ends.
+    pub fn start(self) -> tokio::task::JoinHandle<()> {
+        tokio::spawn(async move {
+            loop {
+                let result = match RumqttcClient::new(&self.config) {
+                    Ok(client) => self.run(client).await,
+                    Err(e) => Err(e),
+                };
+                match result {
+                    Ok(()) => info!("MQTT broker closed the connection — reconnecting in 5s"),
+                    Err(e) => {
+                        warn!(error = %format!("{:#}", e), "MQTT bridge stopped — reconnecting in 5s")
+                    }
+                }
+                tokio::time::sleep(Duration::from_secs(5)).await;
+            }
+        })
+    }
+
+    /// Subscribes, then publishes messages until the connection closes. Each
+    /// message is acked once its event (or dead letter) is stored; a publish
+    /// that fails ends the run with that message unacked.
+    pub async fn run<C: MqttClient>(&self, mut client: C) -> Result<()> {
+        let filters = self.filters();
+        client.subscribe(&filters).await?;
+        info!(broker = %self.config.broker_url, filters = ?filters, "MQTT bridge subscribed");
+
+        while let Some(message) = client.next_message().await? {
+            self.handle(&message).await.with_context(|| {
+                format!("Failed to publish MQTT message from '{}'", message.topic)
+            })?;
+            client.ack(&message).await?;
+        }
+        Ok(())
+    }
+
+    /// Publishes the event for `message`, or dead-letters it.
+    async fn handle(&self, message: &MqttMessage) -> Result<()> {
+        let event = match self.to_event(message) {
+            Ok(event) => event,
+            Err(reason) => return self.dead_letter(message, &reason).await,
+        };
+        match self.publish(&event).await? {
+            None => Ok(()),
+            Some(reason) => self.dead_letter(message, &reason).await,
+        }
+    }
+
+    /// The event for `message`, or why there is none.
+    fn to_event(&self, message: &MqttMessage) -> Result<FluxEvent, String> {
+        let (route, vars) = self
+            .routes
+            .iter()
+            .find_map(|(template, route)| {
+                template.matches(&message.topic).map(|vars| (route, vars))
+            })
+            .ok_or_else(|| "no route matches the topic".to_string())?;
+        let data: Value = serde_json::from_slice(&message.payload)
+            .map_err(|e| format!("payload is not JSON: {}", e))?;
+        // Scalars and arrays are kept under "value"
+        let properties = if data.is_object() {
+            data
+        } else {
+            json!({ "value": data })
+        };
+
+        let key = route.key.as_ref().map(|key| render(key, &vars));
+        let source = match &route.source {
+            Some(source) => render(source, &vars),
+            None => self.config.client_id.clone(),
+        };
+        let mut builder = FluxEvent::builder(render(&route.stream, &vars))
+            .source(source)
+            .payload(json!({
+                "entity_id": key.clone().unwrap_or_else(|| message.topic.clone()),
+                "topic": message.topic,
+                "properties": properties,
+            }));
+        if let Some(key) = key {
+            builder = builder.key(key);
+        }
+        builder.build().map_err(|e| format!("invalid event: {}", e))
+    }
+
+    /// Publishes `message` to the dead-letter stream with `reason`. If Flux
+    /// rejects the dead letter as well, the message is logged and dropped.
+    async fn dead_letter(&self, message: &MqttMessage, reason: &str) -> Result<()> {
+        warn!(topic = %message.topic, reason = %reason, "Dead-lettering MQTT message");
+        let mut properties = json!({
+            "topic": message.topic,
+            "error": reason,
+            "payload": dead_letter_payload(&message.payload),
+        });
+        if message.payload.len() > MAX_DEAD_LETTER_PAYLOAD {
+            properties["truncated"] = json!(true);
+            properties["payload_bytes"] = json!(message.payload.len());
+        }
+        let event = FluxEvent::builder(self.config.dead_letter_stream.clone())
+            .source(self.config.client_id.clone())
+            .payload(json!({
+                "entity_id": message.topic,
+                "properties": properties,
+            }))
+            .build()
+            .context("Invalid dead-letter event")?;
+        if let Some(rejected) = self.publish(&event).await? {
+            error!(
+                topic = %message.topic,
+                reason = %reason,
+                error = %rejected,
+                "Dead-letter event rejected — dropping MQTT message"
+            );
+        }
+        Ok(())
+    }
+
+    /// Posts `event` to the Flux API. `Ok(None)` once it is stored,
+    /// `Ok(Some(reason))` if Flux rejects the event itself (400, 413, 422),
+    /// and an error for anything a retry may fix.
+    async fn publish(&self, event: &FluxEvent) -> Result<Option<String>> {
+        let mut req = self
+            .http_client
+            .post(format!("{}/api/events", self.flux_api_url))
+            .json(event);
+        if let Some(ref token) = self.config.flux_namespace_token {
+            req = req.header("Authorization", format!("Bearer {}", token));
+        }
+        let response = req
+            .send()
+            .await
+            .context("Failed to send HTTP request to Flux API")?;
+
+        let status = response.status();
+        if status.is_success() {
+            return Ok(None);
+        }
+        let body = response
+            .text()
+            .await
+            .unwrap_or_else(|_| "<failed to read body>".to_string());
+        if matches!(status.as_u16(), 400 | 413 | 422) {
+            return Ok(Some(format!("Flux API returned {}: {}", status, body)));
+        }
+        bail!("Flux API returned error status {}: {}", status, body)
+    }
+}
+
+/// Up to `MAX_DEAD_LETTER_PAYLOAD` bytes of `payload`: as text when it is
+/// UTF-8, otherwise base64.
+fn dead_letter_payload(payload: &[u8]) -> Value {
+    let mut end = payload.len().min(MAX_DEAD_LETTER_PAYLOAD);
+    match std::str::from_utf8(payload) {
+        Ok(text) => {
+            while !text.is_char_boundary(end) {
+                end -= 1;
+            }
+            json!(&text[..end])
+        }
+        Err(_) => json!({ "base64": BASE64.encode(&payload[..end]) }),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use mockito::Matcher;
+    use std::collections::VecDeque;
+    use std::sync::{Arc, Mutex};
+
+    /// Replays `messages`, then reports the connection closed.
+    #[derive(Default)]
+    struct MockMqttClient {
+        messages: VecDeque<MqttMessage>,
+        subscribed: Arc<Mutex<Vec<String>>>,
+        acked: Arc<Mutex<Vec<u16>>>,
+    }
+
+    impl MockMqttClient {
+        fn with_messages(messages: &[(&str, &[u8])]) -> Self {
+            Self {
+                messages: messages
+                    .iter()
+                    .enumerate()
+                    .map(|(i, (topic, payload))| MqttMessage {
+                        topic: topic.to_string(),
+                        payload: payload.to_vec(),
+                        packet_id: i as u16 + 1,
+                    })
+                    .collect(),
+                ..Default::default()
+            }
+        }
+    }
+
+    #[async_trait]
+    impl MqttClient for MockMqttClient {
+        async fn subscribe(&mut self, filters: &[String]) -> Result<()> {
+            self.subscribed.lock().unwrap().extend_from_slice(filters);
+            Ok(())
+        }
+
+        async fn next_message(&mut self) -> Result<Option<MqttMessage>> {
+            Ok(self.messages.pop_front())
+        }
+
+        async fn ack(&mut self, message: &MqttMessage) -> Result<()> {
+            self.acked.lock().unwrap().push(message.packet_id);
+            Ok(())
+        }
+    }
+
+    fn make_bridge(flux_api_url: String) -> MqttBridge {
+        let config = MqttBridgeConfig {
+            broker_url: "mqtt://broker:1883".to_string(),
+            client_id: "plant1-gateway".to_string(),
+            username: Some("bridge".to_string()),
+            password: Some("secret".to_string()),
+            routes: vec![MqttRoute {
+                topic: "sensors/{site}/{device}".to_string(),
+                stream: "sensor.{site}".to_string(),
+                key: Some("{device}".to_string()),
+                source: None,
+            }],
+            dead_letter_stream: "mqtt.deadletter".to_string(),
+            flux_namespace_token: None,
+        };
+        MqttBridge::new(config, flux_api_url).unwrap()
+    }
+
+    #[tokio::test]
+    async fn test_publishes_then_acks() {
+        let mut server = mockito::Server::new_async().await;
+        let mock = server
+            .mock("POST", "/api/events")
+            .match_body(Matcher::PartialJson(json!({
+                "stream": "sensor.plant1",
+                "key": "dev7",
+                "source": "plant1-gateway",
+                "payload": {
+                    "entity_id": "dev7",
+                    "topic": "sensors/plant1/dev7",
+                    "properties": {"t": 22.5}
+                }
+            })))
+            .with_status(200)
+            .expect(1)
+            .create_async()
+            .await;
+
+        let bridge = make_bridge(server.url());
+        let client = MockMqttClient::with_messages(&[("sensors/plant1/dev7", br#"{"t": 22.5}"#)]);
+        let (subscribed, acked) = (Arc::clone(&client.subscribed), Arc::clone(&client.acked));
+
+        bridge.run(client).await.unwrap();
+
+        assert_eq!(*subscribed.lock().unwrap(), vec!["sensors/+/+".to_string()]);
+        assert_eq!(*acked.lock().unwrap(), vec![1]);
+        mock.assert_async().await;
+    }
+
+    #[tokio::test]
+    async fn test_failed_publish_is_not_acked() {
+        let mut server = mockito::Server::new_async().await;
+        let mock = server
+            .mock("POST", "/api/events")
+            .with_status(503)
+            .expect(1)
+            .create_async()
+            .await;
+
+        let bridge = make_bridge(server.url());
+        let client = MockMqttClient::with_messages(&[
+            ("sensors/plant1/dev7", br#"{"t": 22.5}"#),
+            ("sensors/plant1/dev8", br#"{"t": 23.0}"#),
+        ]);
+        let acked = Arc::clone(&client.acked);
+
+        // The run stops at the first message, leaving it for redelivery
+        assert!(bridge.run(client).await.is_err());
+        assert!(acked.lock().unwrap().is_empty());
+        mock.assert_async().await;
+    }
+
+    #[tokio::test]
+    async fn test_malformed_payload_dead_lettered() {
+        let mut server = mockito::Server::new_async().await;
+        let dead_letter = server
+            .mock("POST", "/api/events")
+            .match_body(Matcher::PartialJson(json!({
+                "stream": "mqtt.deadletter",
+                "source": "plant1-gateway",
+                "payload": {
+                    "entity_id": "sensors/plant1/dev7",
+                    "properties": {
+                        "topic": "sensors/plant1/dev7",
+                        "payload": "t=22.5"
+                    }
+                }
+            })))
+            .with_status(200)
+            .expect(1)
+            .create_async()
+            .await;
+        let published = server
+            .mock("POST", "/api/events")
+            .match_body(Matcher::PartialJson(json!({"stream": "sensor.plant1"})))
+            .with_status(200)
+            .expect(1)
+            .create_async()
+            .await;
+
+        let bridge = make_bridge(server.url());
+        let client = MockMqttClient::with_messages(&[
+            ("sensors/plant1/dev7", b"t=22.5"),
+            ("sensors/plant1/dev8", b"23.0"),
+        ]);
+        let acked = Arc::clone(&client.acked);
+
+        bridge.run(client).await.unwrap();
+
+        // Both acked: one dead-lettered, one published (scalar under "value")
+        assert_eq!(*acked.lock().unwrap(), vec![1, 2]);
+        dead_letter.assert_async().await;
+        published.assert_async().await;
+    }
+
+    #[tokio::test]
+    async fn test_invalid_events_dead_lettered() {
+        let mut server = mockito::Server::new_async().await;
+        let rejected = server
+            .mock("POST", "/api/events")
+            .match_body(Matcher::PartialJson(json!({"stream": "sensor.plant2"})))
+            .with_status(400)
+            .with_body(r#"{"error":"source not allowed"}"#)
+            .expect(1)
+            .create_async()
+            .await;
+        let dead_letter = server
+            .mock("POST", "/api/events")
+            .match_body(Matcher::PartialJson(json!({"stream": "mqtt.deadletter"})))
+            .with_status(200)
+            .expect(2)
+            .create_async()
+            .await;
+
+        let bridge = make_bridge(server.url());
+        let client = MockMqttClient::with_messages(&[
+            // Rejected by Flux
+            ("sensors/plant2/dev1", br#"{"t": 1}"#),
+            // Not a valid stream name, never sent
+            ("sensors/Plant 3/dev1", br#"{"t": 1}"#),
+        ]);
+        let acked = Arc::clone(&client.acked);
+
+        bridge.run(client).await.unwrap();
+
+        assert_eq!(*acked.lock().unwrap(), vec![1, 2]);
+        rejected.assert_async().await;
+        dead_letter.assert_async().await;
+    }
+
+    #[tokio::test]
+    async fn test_oversized_message_dead_lettered_truncated() {
+        let mut server = mockito::Server::new_async().await;
+        let rejected = server
+            .mock("POST", "/api/events")
+            .match_body(Matcher::PartialJson(json!({"stream": "sensor.plant1"})))
+            .with_status(413)
+            .expect(1)
+            .create_async()
+            .await;
+        // The dead letter is rejected too; the message must still be acked
+        let dead_letter = server
+            .mock("POST", "/api/events")
+            .match_body(Matcher::PartialJson(json!({
+                "stream": "mqtt.deadletter",
+                "payload": {"properties": {"truncated": true, "payload_bytes": 100_012}}
+            })))
+            .with_status(413)
+            .expect(1)
+            .create_async()
+            .await;
+
+        let bridge = make_bridge(server.url());
+        let big = format!(r#"{{"blob": "{}"}}"#, "x".repeat(100_000));
+        let client = MockMqttClient::with_messages(&[("sensors/plant1/dev7", big.as_bytes())]);
+        let acked = Arc::clone(&client.acked);
+
+        bridge.run(client).await.unwrap();
+
+        assert_eq!(*acked.lock().unwrap(), vec![1]);
+        rejected.assert_async().await;
+        dead_letter.assert_async().await;
+    }
+
+    #[test]
+    fn test_dead_letter_payload_is_bounded() {
+        assert_eq!(dead_letter_payload(b"t=22.5"), json!("t=22.5"));
+
+        let text = "é".repeat(MAX_DEAD_LETTER_PAYLOAD);
+        let kept = dead_letter_payload(text.as_bytes());
+        let kept = kept.as_str().unwrap();
+        assert!(kept.len() <= MAX_DEAD_LETTER_PAYLOAD);
+        assert!(text.starts_with(kept));
+
+        let binary = vec![0xff; MAX_DEAD_LETTER_PAYLOAD * 2];
+        let kept = dead_letter_payload(&binary);
+        let decoded = BASE64.decode(kept["base64"].as_str().unwrap()).unwrap();
+        assert_eq!(decoded.len(), MAX_DEAD_LETTER_PAYLOAD);
+    }
+}
@@ -0,0 +1,204 @@
+use crate::event::FluxEvent;
+use crate::nats::EventPublisher;
+use anyhow::Result;
+use chrono::{DateTime, Utc};
+use serde_json::{json, Value};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use tokio::sync::Notify;
+use tracing::{debug, info, warn};
+
+#[cfg(test)]
+mod tests;
+
+/// Builds one aggregate event from the events buffered during a window.
+///
+/// Returning None publishes nothing for the window.
+pub type Reducer =
+    Arc<dyn Fn(&[FluxEvent], DateTime<Utc>, DateTime<Utc>) -> Option<FluxEvent> + Send + Sync>;
+
+struct Window {
+    start: DateTime<Utc>,
+    events: Vec<FluxEvent>,
+}
+
+/// Buffers events and publishes a single aggregate per window instead of the
+/// raw events.
+///
+/// A window is flushed every `window` (see `run`) or, with `with_max_events`,
+/// as soon as it holds that many events.
+pub struct AggregatingPublisher {
+    inner: EventPublisher,
+    window: Duration,
+    max_events: Option<usize>,
+    reducer: Reducer,
+    buffer: Mutex<Window>,
+    shutdown: Notify,
+}
+
+impl AggregatingPublisher {
+    pub fn new(inner: EventPublisher, window: Duration, reducer: Reducer) -> Self {
+        Self {
+            inner,
+            window,
+            max_events: None,
+            reducer,
+            buffer: Mutex::new(Window {
+                start: Utc::now(),
+                events: Vec::new(),
+            }),
+            shutdown: Notify::new(),
+        }
+    }
+
+    /// Also flush as soon as a window holds `max_events` events.
+    pub fn with_max_events(mut self, max_events: usize) -> Self {
+        self.max_events = Some(max_events.max(1));
+        self
+    }
+
+    /// Buffer an event for the current window.
+    pub async fn publish(&self, event: FluxEvent) -> Result<()> {
+        let full = {
+            let mut buffer = self.buffer.lock().unwrap();
+            buffer.events.push(event);
+            self.max_events
+                .map_or(false, |max| buffer.events.len() >= max)
+        };
+        if full {
+            self.flush().await?;
+        }
+        Ok(())
+    }
+
+    /// Close the current window and publish its aggregate (if any).
+    pub async fn flush(&self) -> Result<()> {
+        let now = Utc::now();
+        let window = {
+            let mut buffer = self.buffer.lock().unwrap();
+            std::mem::replace(
+                &mut *buffer,
+                Window {
+                    start: now,
+                    events: Vec::new(),
+                },
+            )
+        };
+        if window.events.is_empty() {
+            return Ok(());
+        }
+
+        let Some(aggregate) = (self.reducer)(&window.events, window.start, now) else {
+            return Ok(());
+        };
+        debug!(
+            stream = %aggregate.stream,
+            events = window.events.len(),
+            "Publishing aggregate event"
+        );
+        self.inner.publish(&aggregate).await
+    }
+
+    /// Flush every `window` until `stop` is called (flushes once more on stop).
+    pub async fn run(self: Arc<Self>) {
+        info!(
+            window_secs = self.window.as_secs_f64(),
+            "Starting aggregating publisher"
+        );
+        let mut interval = tokio::time::interval(self.window);
+        interval.tick().await; // first tick is immediate
+
+        loop {
+            tokio::select! {
+                _ = interval.tick() => {}
+                _ = self.shutdown.notified() => break,
+            }
+            if let Err(e) = self.flush().await {
+                warn!(error = %e, "Failed to publish aggregate event");
+            }
+        }
+
+        if let Err(e) = self.flush().await {
+            warn!(error = %e, "Failed to publish final aggregate event");
+        }
+        info!("Aggregating publisher stopped");
+    }
+
+    /// Stop the flush loop.
+    pub fn stop(&self) {
+        self.shutdown.notify_one();
+    }
+}
+
+/// Reducer publishing `{"count": N, ...}` to `target_stream` with `schema`.
+///
+/// `sum` and `avg` are null; use `sum_reducer` for numeric aggregates.
+pub fn count_reducer(target_stream: impl Into<String>, schema: impl Into<String>) -> Reducer {
+    let target_stream = target_stream.into();
+    let schema = schema.into();
+    Arc::new(move |events, start, end| {
+        let mut aggregate = aggregate_event(&target_stream, events, start, end, None)?;
+        aggregate.schema = Some(schema.clone());
+        Some(aggregate)
+    })
+}
+
+/// Reducer publishing count, sum and avg of a numeric payload field to `target_stream`.
+///
+/// The field is read from the payload root, falling back to `payload.properties`.
+/// Events without a numeric value are counted but do not contribute to sum/avg.
+pub fn sum_reducer(payload_field: impl Into<String>, target_stream: impl Into<String>) -> Reducer {
+    let payload_field = payload_field.into();
+    let target_stream = target_stream.into();
+    Arc::new(move |events, start, end| {
+        aggregate_event(&target_stream, events, start, end, Some(&payload_field))
+    })
+}
+
+fn aggregate_event(
+    target_stream: &str,
+    events: &[FluxEvent],
+    start: DateTime<Utc>,
+    end: DateTime<Utc>,
+    field: Option<&str>,
+) -> Option<FluxEvent> {
+    let first = events.first()?;
+
+    let (sum, avg) = match field {
+        Some(field) => {
+            let values: Vec<f64> = events
+                .iter()
+                .filter_map(|e| field_value(&e.payload, field))
+                .collect();
+            let sum: f64 = values.iter().sum();
+            let avg = if values.is_empty() {
+                Value::Null
+            } else {
+                json!(sum / values.len() as f64)
+            };
+            (json!(sum), avg)
+        }
+        None => (Value::Null, Value::Null),
+    };
+
+    FluxEvent::builder(target_stream)
+        .source(first.source.clone())
+        .timestamp(end)
+        .payload(json!({
+            "count": events.len(),
+            "sum": sum,
+            "avg": avg,
+            "window_start": start.timestamp_millis(),
+            "window_end": end.timestamp_millis(),
+        }))
+        .build()
+        .map_err(|e| warn!(error = %e, stream = %target_stream, "Invalid aggregate event"))
+        .ok()
+}
+
+fn field_value(payload: &Value, field: &str) -> Option<f64> {
+    payload
+        .get(field)
+        .or_else(|| payload.get("properties").and_then(|p| p.get(field)))
+        .and_then(Value::as_f64)
+}
@@ -0,0 +1,71 @@
+use super::*;
+use chrono::TimeZone;
+
+fn reading(value: Value) -> FluxEvent {
+    FluxEvent::builder("sensors.raw")
+        .source("plant-a")
+        .timestamp_millis(1707668400000)
+        .payload(json!({"entity_id": "sensor-01", "properties": {"temperature": value}}))
+        .must_build()
+}
+
+fn window() -> (DateTime<Utc>, DateTime<Utc>) {
+    (
+        Utc.timestamp_millis_opt(1707668400000).unwrap(),
+        Utc.timestamp_millis_opt(1707668460000).unwrap(),
+    )
+}
+
+#[test]
+fn test_count_reducer() {
+    let (start, end) = window();
+    let events = vec![reading(json!(1)), reading(json!(2))];
+
+    let aggregate = count_reducer("sensors.count", "count.v1")(&events, start, end).unwrap();
+    assert_eq!(aggregate.stream, "sensors.count");
+    assert_eq!(aggregate.schema.as_deref(), Some("count.v1"));
+    assert_eq!(aggregate.source, "plant-a");
+    assert_eq!(aggregate.timestamp, 1707668460000);
+    assert_eq!(aggregate.payload["count"], 2);
+    assert!(aggregate.payload["sum"].is_null());
+    assert_eq!(aggregate.payload["window_start"], 1707668400000i64);
+    assert_eq!(aggregate.payload["window_end"], 1707668460000i64);
+    assert!(aggregate.event_id.is_some());
+}
+
+#[test]
+fn test_sum_reducer() {
+    let (start, end) = window();
+    let events = vec![
+        reading(json!(20.0)),
+        reading(json!(22.0)),
+        reading(json!("n/a")), // counted, not summed
+    ];
+
+    let aggregate = sum_reducer("temperature", "sensors.avg")(&events, start, end).unwrap();
+    assert_eq!(aggregate.payload["count"], 3);
+    assert_eq!(aggregate.payload["sum"], 42.0);
+    assert_eq!(aggregate.payload["avg"], 21.0);
+}
+
+#[test]
+fn test_sum_reducer_reads_top_level_field() {
+    let (start, end) = window();
+    let mut event = reading(json!(0));
+    event.payload = json!({"kwh": 1.5});
+
+    let aggregate = sum_reducer("kwh", "energy.total")(&[event], start, end).unwrap();
+    assert_eq!(aggregate.payload["sum"], 1.5);
+}
+
+#[test]
+fn test_empty_window_produces_nothing() {
+    let (start, end) = window();
+    assert!(count_reducer("sensors.count", "count.v1")(&[], start, end).is_none());
+}
+
+#[test]
+fn test_invalid_target_stream_produces_nothing() {
+    let (start, end) = window();
+    assert!(count_reducer("Bad Stream", "count.v1")(&[reading(json!(1))], start, end).is_none());
+}
@@ -1,12 +1,12 @@
-use crate::config::SharedRuntimeConfig;
+use crate::config::{ConfigReloader, SharedRuntimeConfig};
 use axum::{
     extract::State,
     http::{HeaderMap, StatusCode},
     response::{IntoResponse, Json, Response},
-    routing::get,
+    routing::{get, post},
     Router,
 };
-use serde::{Deserialize, Serialize};
+use serde::Serialize;
 use std::sync::Arc;
 
 /// State for the admin API.
@@ -15,16 +15,12 @@ pub struct AdminAppState {
     pub runtime_config: SharedRuntimeConfig,
     /// Required bearer token for PUT /api/admin/config. None = PUT disabled.
     pub admin_token: Option<String>,
+    /// Re-reads limits from the config file. None = POST /api/admin/reload disabled.
+    pub reloader: Option<Arc<ConfigReloader>>,
 }
 
 /// Partial update body — only fields present in the request are changed.
-#[derive(Deserialize)]
-pub struct RuntimeConfigUpdate {
-    pub rate_limit_enabled: Option<bool>,
-    pub rate_limit_per_namespace_per_minute: Option<u64>,
-    pub body_size_limit_single_bytes: Option<usize>,
-    pub body_size_limit_batch_bytes: Option<usize>,
-}
+pub use crate::config::RuntimeConfigUpdate;
 
 #[derive(Serialize)]
 struct ErrorResponse {
@@ -37,6 +33,7 @@ pub fn create_admin_router(state: AdminAppState) -> Router {
             "/api/admin/config",
             get(get_config).put(put_config),
         )
+        .route("/api/admin/reload", post(reload_config))
         .with_state(Arc::new(state))
 }
 
@@ -75,25 +72,52 @@ async fn put_config(
         .write()
         .expect("RuntimeConfig lock poisoned");
 
-    if let Some(v) = update.rate_limit_enabled {
-        cfg.rate_limit_enabled = v;
-    }
-    if let Some(v) = update.rate_limit_per_namespace_per_minute {
-        cfg.rate_limit_per_namespace_per_minute = v;
-    }
-    if let Some(v) = update.body_size_limit_single_bytes {
-        cfg.body_size_limit_single_bytes = v;
-    }
-    if let Some(v) = update.body_size_limit_batch_bytes {
-        cfg.body_size_limit_batch_bytes = v;
-    }
+    cfg.apply(&update);
 
     Json(cfg.clone()).into_response()
 }
 
+/// POST /api/admin/reload — re-read limits and source/naming policies from the
+/// config file (same as SIGHUP).
+///
+/// An invalid file is rejected with 422 and the current config is kept.
+async fn reload_config(
+    State(state): State<Arc<AdminAppState>>,
+    headers: HeaderMap,
+) -> Response {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return (
+            StatusCode::UNAUTHORIZED,
+            Json(ErrorResponse {
+                error: "Unauthorized".to_string(),
+            }),
+        )
+            .into_response();
+    }
+
+    let Some(reloader) = &state.reloader else {
+        return (
+            StatusCode::SERVICE_UNAVAILABLE,
+            Json(ErrorResponse {
+                error: "Config reload not available".to_string(),
+            }),
+        )
+            .into_response();
+    };
+
+    match reloader.reload() {
+        Ok(cfg) => Json(cfg).into_response(),
+        Err(error) => (
+            StatusCode::UNPROCESSABLE_ENTITY,
+            Json(ErrorResponse { error }),
+        )
+            .into_response(),
+    }
+}
+
 /// Returns true if the bearer token in `Authorization` matches the expected admin token.
 /// Returns true (no restriction) when `expected` is None.
-fn validate_admin_token(headers: &HeaderMap, expected: &Option<String>) -> bool {
+pub(crate) fn validate_admin_token(headers: &HeaderMap, expected: &Option<String>) -> bool {
     let Some(expected_token) = expected else {
         // No admin token configured → PUT is unrestricted (dev mode)
         return true;
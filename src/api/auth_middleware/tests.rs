@@ -12,10 +12,17 @@ fn create_test_event(entity_id: &str) -> FluxEvent {
         timestamp: 1234567890,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({
             "entity_id": entity_id,
             "properties": {}
         }),
+        raw_payload: None,
     }
 }
 
@@ -0,0 +1,415 @@
+// Long-poll fetch and ack over plain HTTP, for clients that can't hold a
+// NATS or WebSocket connection open.
+
+use crate::api::admin::validate_admin_token;
+use crate::api::consumers::belongs_to_stream;
+use crate::event::{is_valid_stream_name, FluxEvent};
+use crate::nats::{decode_event, stream_subject};
+use crate::webhook::sign;
+use async_nats::jetstream::{self, consumer::pull, AckKind};
+use axum::{
+    extract::{Path, Query, State},
+    http::{HeaderMap, StatusCode},
+    response::{IntoResponse, Json, Response},
+    routing::{get, post},
+    Router,
+};
+use base64::{engine::general_purpose::URL_SAFE_NO_PAD as BASE64, Engine};
+use futures::StreamExt;
+use serde::{Deserialize, Serialize};
+use std::sync::Arc;
+use std::time::Duration;
+use tracing::{debug, warn};
+
+/// Default and largest number of events per fetch
+pub const DEFAULT_FETCH_BATCH: usize = 10;
+pub const MAX_FETCH_BATCH: usize = 256;
+
+/// Default and longest time a fetch waits for the first event
+pub const DEFAULT_FETCH_WAIT: Duration = Duration::from_secs(5);
+pub const MAX_FETCH_WAIT: Duration = Duration::from_secs(30);
+
+/// Prefix of the subject a JetStream message is acked on
+const ACK_SUBJECT_PREFIX: &str = "$JS.ACK.";
+
+/// Shared state for the fetch API
+#[derive(Clone)]
+pub struct FetchAppState {
+    pub jetstream: jetstream::Context,
+    /// Core connection acks are published on
+    pub client: async_nats::Client,
+    /// JetStream stream holding all Flux events (e.g. FLUX_EVENTS)
+    pub stream_name: String,
+    /// Bearer token required to fetch and ack. None = unrestricted (dev mode).
+    pub admin_token: Option<String>,
+    /// Key ack tokens are signed with; instances sharing consumers need the
+    /// same one
+    pub token_secret: String,
+}
+
+/// Query parameters for fetch
+#[derive(Debug, Deserialize)]
+pub struct FetchParams {
+    /// Most events to return (default 10, at most 256)
+    pub batch: Option<usize>,
+    /// How long to wait for the first event: "20s", "500ms" or seconds
+    /// (default 5s, at most 30s)
+    pub wait: Option<String>,
+}
+
+/// An event handed out by fetch, acked by returning its token
+#[derive(Debug, Serialize)]
+pub struct FetchedEvent {
+    /// Sequence in the JetStream stream
+    pub sequence: u64,
+    /// Delivery attempt, 1 on first delivery
+    pub delivered: i64,
+    pub event: FluxEvent,
+    pub ack_token: String,
+}
+
+#[derive(Debug, Serialize)]
+pub struct FetchResponse {
+    pub events: Vec<FetchedEvent>,
+}
+
+/// Body for POST .../ack
+#[derive(Debug, Deserialize)]
+pub struct AckRequest {
+    pub ack_tokens: Vec<String>,
+}
+
+#[derive(Debug, Serialize)]
+pub struct AckResponse {
+    pub acked: usize,
+}
+
+/// What an ack token stands for: one delivery of one message to a consumer
+#[derive(Debug, Clone, PartialEq)]
+pub struct AckToken {
+    pub stream: String,
+    pub consumer: String,
+    pub sequence: u64,
+    /// Subject the delivery is acked on
+    reply: String,
+}
+
+impl AckToken {
+    /// `<base64url ack subject>.<hex HMAC-SHA256>`, signed with `secret`.
+    /// The ack subject names the stream, consumer and sequences.
+    pub fn encode(&self, secret: &str) -> String {
+        format!(
+            "{}.{}",
+            BASE64.encode(&self.reply),
+            signature(secret, &self.reply)
+        )
+    }
+
+    /// Decode a token from `encode`, or None if it was not signed with
+    /// `secret` or altered since.
+    pub fn decode(token: &str, secret: &str) -> Option<Self> {
+        let (reply, mac) = token.split_once('.')?;
+        let reply = String::from_utf8(BASE64.decode(reply).ok()?).ok()?;
+        if !constant_time_eq(mac.as_bytes(), signature(secret, &reply).as_bytes()) {
+            return None;
+        }
+        Self::from_reply(&reply)
+    }
+
+    /// Parse a JetStream ack subject:
+    /// `$JS.ACK.<stream>.<consumer>.<delivered>.<stream seq>.<consumer seq>.<ts>.<pending>`,
+    /// or the newer form with domain and account hash before the stream.
+    fn from_reply(reply: &str) -> Option<Self> {
+        let tokens: Vec<&str> = reply.strip_prefix(ACK_SUBJECT_PREFIX)?.split('.').collect();
+        let tokens = match tokens.len() {
+            7 => &tokens[..],
+            n if n >= 9 => &tokens[2..],
+            _ => return None,
+        };
+        Some(Self {
+            stream: tokens[0].to_string(),
+            consumer: tokens[1].to_string(),
+            sequence: tokens[3].parse().ok()?,
+            reply: reply.to_string(),
+        })
+    }
+}
+
+fn signature(secret: &str, reply: &str) -> String {
+    let signature = sign(secret, reply.as_bytes());
+    signature.trim_start_matches("sha256=").to_string()
+}
+
+fn constant_time_eq(a: &[u8], b: &[u8]) -> bool {
+    a.len() == b.len() && a.iter().zip(b).fold(0, |diff, (x, y)| diff | (x ^ y)) == 0
+}
+
+/// Create fetch API router
+pub fn create_fetch_router(state: FetchAppState) -> Router {
+    Router::new()
+        .route(
+            "/api/streams/:stream/consumers/:name/fetch",
+            get(fetch_events),
+        )
+        .route("/api/streams/:stream/consumers/:name/ack", post(ack_events))
+        .with_state(Arc::new(state))
+}
+
+/// GET /api/streams/:stream/consumers/:name/fetch?batch=50&wait=20s
+///
+/// Long poll: returns as soon as events are available, up to `batch`, or an
+/// empty list once `wait` passes. Events not acked within the consumer's
+/// ack wait are delivered again.
+async fn fetch_events(
+    State(state): State<Arc<FetchAppState>>,
+    headers: HeaderMap,
+    Path((stream, name)): Path<(String, String)>,
+    Query(params): Query<FetchParams>,
+) -> Result<Json<FetchResponse>, FetchApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(FetchApiError::Unauthorized);
+    }
+    let batch = params.batch.unwrap_or(DEFAULT_FETCH_BATCH);
+    if batch == 0 || batch > MAX_FETCH_BATCH {
+        return Err(FetchApiError::BadRequest(format!(
+            "batch must be between 1 and {}",
+            MAX_FETCH_BATCH
+        )));
+    }
+    let wait = match params.wait.as_deref() {
+        Some(wait) => parse_wait(wait).ok_or_else(|| {
+            FetchApiError::BadRequest(format!(
+                "invalid wait '{}': use e.g. \"20s\" or \"500ms\", at most {}s",
+                wait,
+                MAX_FETCH_WAIT.as_secs()
+            ))
+        })?,
+        None => DEFAULT_FETCH_WAIT,
+    };
+    let consumer = get_consumer(&state, &stream, &name).await?;
+
+    // Wait for the first event, then take whatever else is ready
+    let mut messages = Vec::with_capacity(batch);
+    let mut first = consumer
+        .batch()
+        .max_messages(1)
+        .expires(wait)
+        .messages()
+        .await
+        .map_err(|e| FetchApiError::Nats(e.to_string()))?;
+    if let Some(message) = first.next().await {
+        messages.push(message.map_err(|e| FetchApiError::Nats(e.to_string()))?);
+    }
+    if !messages.is_empty() && batch > 1 {
+        let mut rest = consumer
+            .fetch()
+            .max_messages(batch - 1)
+            .messages()
+            .await
+            .map_err(|e| FetchApiError::Nats(e.to_string()))?;
+        while let Some(message) = rest.next().await {
+            messages.push(message.map_err(|e| FetchApiError::Nats(e.to_string()))?);
+        }
+    }
+
+    let mut events = Vec::with_capacity(messages.len());
+    for message in messages {
+        let info = message
+            .info()
+            .map_err(|e| FetchApiError::Nats(e.to_string()))?;
+        let (sequence, delivered) = (info.stream_sequence, info.delivered);
+        let event = match decode_event(message.headers.as_ref(), &message.payload) {
+            Ok(event) => event,
+            Err(e) => {
+                // Redelivering would fail the same way
+                warn!(error = %e, sequence, consumer = %name, "Terminating undecodable event");
+                let _ = message.ack_with(AckKind::Term).await;
+                continue;
+            }
+        };
+        let token = message
+            .reply
+            .as_ref()
+            .and_then(|reply| AckToken::from_reply(reply.as_str()))
+            .ok_or_else(|| FetchApiError::Nats("message has no ack subject".to_string()))?;
+        events.push(FetchedEvent {
+            sequence,
+            delivered,
+            event,
+            ack_token: token.encode(&state.token_secret),
+        });
+    }
+
+    debug!(stream = %stream, consumer = %name, events = events.len(), "Fetched events");
+    Ok(Json(FetchResponse { events }))
+}
+
+/// POST /api/streams/:stream/consumers/:name/ack - Ack fetched events
+///
+/// Every token must be valid for this consumer, or none are acked.
+async fn ack_events(
+    State(state): State<Arc<FetchAppState>>,
+    headers: HeaderMap,
+    Path((stream, name)): Path<(String, String)>,
+    Json(request): Json<AckRequest>,
+) -> Result<Json<AckResponse>, FetchApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(FetchApiError::Unauthorized);
+    }
+    validate_stream(&stream)?;
+
+    let mut tokens = Vec::with_capacity(request.ack_tokens.len());
+    for (index, token) in request.ack_tokens.iter().enumerate() {
+        let token = AckToken::decode(token, &state.token_secret)
+            .filter(|token| token.stream == state.stream_name && token.consumer == name)
+            .ok_or_else(|| {
+                FetchApiError::BadRequest(format!(
+                    "ack_tokens[{}] is not a valid token for consumer '{}'",
+                    index, name
+                ))
+            })?;
+        tokens.push(token);
+    }
+
+    for token in &tokens {
+        state
+            .client
+            .publish(token.reply.clone(), "+ACK".into())
+            .await
+            .map_err(|e| FetchApiError::Nats(e.to_string()))?;
+    }
+    state
+        .client
+        .flush()
+        .await
+        .map_err(|e| FetchApiError::Nats(e.to_string()))?;
+
+    debug!(stream = %stream, consumer = %name, acked = tokens.len(), "Acked events");
+    Ok(Json(AckResponse {
+        acked: tokens.len(),
+    }))
+}
+
+/// Look up a pull consumer and check it belongs to the requested Flux stream.
+async fn get_consumer(
+    state: &FetchAppState,
+    stream: &str,
+    name: &str,
+) -> Result<jetstream::consumer::PullConsumer, FetchApiError> {
+    validate_stream(stream)?;
+    let js_stream = state
+        .jetstream
+        .get_stream(&state.stream_name)
+        .await
+        .map_err(|e| FetchApiError::Nats(e.to_string()))?;
+    let mut consumer = js_stream
+        .get_consumer::<pull::Config>(name)
+        .await
+        .map_err(|_| FetchApiError::NotFound(name.to_string()))?;
+    let info = consumer
+        .info()
+        .await
+        .map_err(|e| FetchApiError::Nats(e.to_string()))?;
+    if !belongs_to_stream(&info.config, &stream_subject(stream)) {
+        return Err(FetchApiError::NotFound(name.to_string()));
+    }
+    Ok(consumer)
+}
+
+fn validate_stream(stream: &str) -> Result<(), FetchApiError> {
+    if !is_valid_stream_name(stream) {
+        return Err(FetchApiError::BadRequest(format!(
+            "invalid stream name '{}'",
+            stream
+        )));
+    }
+    Ok(())
+}
+
+/// "20s", "500ms" or plain seconds, at most `MAX_FETCH_WAIT`.
+fn parse_wait(wait: &str) -> Option<Duration> {
+    let duration = if let Some(ms) = wait.strip_suffix("ms") {
+        Duration::from_millis(ms.parse().ok()?)
+    } else {
+        Duration::from_secs(wait.strip_suffix('s').unwrap_or(wait).parse().ok()?)
+    };
+    (duration <= MAX_FETCH_WAIT).then_some(duration)
+}
+
+/// Fetch API errors
+#[derive(Debug)]
+pub enum FetchApiError {
+    Unauthorized,
+    BadRequest(String),
+    NotFound(String),
+    Nats(String),
+}
+
+impl IntoResponse for FetchApiError {
+    fn into_response(self) -> Response {
+        let (status, error_message) = match self {
+            FetchApiError::Unauthorized => (StatusCode::UNAUTHORIZED, "Unauthorized".to_string()),
+            FetchApiError::BadRequest(msg) => (StatusCode::BAD_REQUEST, msg),
+            FetchApiError::NotFound(name) => (
+                StatusCode::NOT_FOUND,
+                format!("Consumer '{}' not found", name),
+            ),
+            FetchApiError::Nats(msg) => (StatusCode::INTERNAL_SERVER_ERROR, msg),
+        };
+
+        let body = Json(serde_json::json!({
+            "error": error_message,
+        }));
+
+        (status, body).into_response()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const REPLY: &str = "$JS.ACK.FLUX_EVENTS.plc-reader.1.42.7.1739280000000000000.3";
+
+    #[test]
+    fn test_ack_token_round_trip() {
+        let token = AckToken::from_reply(REPLY).unwrap();
+        assert_eq!(token.stream, "FLUX_EVENTS");
+        assert_eq!(token.consumer, "plc-reader");
+        assert_eq!(token.sequence, 42);
+
+        let encoded = token.encode("secret");
+        assert_eq!(AckToken::decode(&encoded, "secret"), Some(token));
+        assert_eq!(AckToken::decode(&encoded, "other-secret"), None);
+    }
+
+    #[test]
+    fn test_tampered_token_rejected() {
+        let encoded = AckToken::from_reply(REPLY).unwrap().encode("secret");
+        let (_, mac) = encoded.split_once('.').unwrap();
+        let forged = REPLY.replace(".42.", ".43.");
+        let forged = format!("{}.{}", BASE64.encode(forged), mac);
+        assert_eq!(AckToken::decode(&forged, "secret"), None);
+        assert_eq!(AckToken::decode("not-a-token", "secret"), None);
+    }
+
+    #[test]
+    fn test_ack_subject_with_domain() {
+        let reply = "$JS.ACK.hub.ACCHASH.FLUX_EVENTS.plc-reader.2.42.7.1739280000000000000.0.rand";
+        let token = AckToken::from_reply(reply).unwrap();
+        assert_eq!(token.stream, "FLUX_EVENTS");
+        assert_eq!(token.consumer, "plc-reader");
+        assert_eq!(token.sequence, 42);
+        assert_eq!(AckToken::from_reply("$JS.ACK.too.short"), None);
+        assert_eq!(AckToken::from_reply("orders.created"), None);
+    }
+
+    #[test]
+    fn test_parse_wait() {
+        assert_eq!(parse_wait("20s"), Some(Duration::from_secs(20)));
+        assert_eq!(parse_wait("500ms"), Some(Duration::from_millis(500)));
+        assert_eq!(parse_wait("3"), Some(Duration::from_secs(3)));
+        assert_eq!(parse_wait("31s"), None);
+        assert_eq!(parse_wait("soon"), None);
+    }
+}
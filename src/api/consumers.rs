@@ -0,0 +1,554 @@
+use crate::api::admin::validate_admin_token;
+use crate::event::is_valid_stream_name;
+use crate::nats::{stream_filter_subjects, stream_subject};
+use async_nats::jetstream::{
+    self,
+    consumer::{self, pull, AckPolicy, DeliverPolicy},
+};
+use axum::{
+    extract::{Path, Query, State},
+    http::{HeaderMap, StatusCode},
+    response::{IntoResponse, Json, Response},
+    routing::get,
+    Router,
+};
+use futures::StreamExt;
+use serde::{Deserialize, Serialize};
+use std::sync::Arc;
+use std::time::Duration;
+use tracing::{info, warn};
+
+/// Shared state for consumer management API
+#[derive(Clone)]
+pub struct ConsumerAppState {
+    pub jetstream: jetstream::Context,
+    /// JetStream stream holding all Flux events (e.g. FLUX_EVENTS)
+    pub stream_name: String,
+    /// Bearer token required for POST/DELETE. None = unrestricted (dev mode).
+    pub admin_token: Option<String>,
+}
+
+/// Body for POST /api/streams/:stream/consumers
+#[derive(Debug, Deserialize)]
+pub struct CreateConsumerRequest {
+    /// Durable consumer name
+    pub name: String,
+    /// "explicit" (default), "all" or "none"
+    pub ack_policy: Option<String>,
+    /// Optional sub-stream filter appended to the stream subject (e.g. "zone1")
+    pub filter: Option<String>,
+    /// Max delivery attempts (default: unlimited)
+    pub max_deliver: Option<i64>,
+    /// "all" (default), "new", "last" or "by_start_sequence"
+    pub deliver_policy: Option<String>,
+    /// Required when deliver_policy = "by_start_sequence"
+    pub start_sequence: Option<u64>,
+    /// Redelivery delays in milliseconds, one per attempt (the last repeats).
+    /// Requires max_deliver greater than the number of delays.
+    pub backoff_ms: Option<Vec<u64>>,
+    /// Unacknowledged messages the consumer may have out across all its
+    /// members (default: server default)
+    pub max_ack_pending: Option<i64>,
+    /// Have the server delete the consumer after this many seconds without
+    /// pulls (default: kept until deleted)
+    pub inactive_threshold_seconds: Option<u64>,
+}
+
+/// Query parameters for DELETE
+#[derive(Debug, Deserialize)]
+pub struct DeleteConsumerParams {
+    #[serde(default)]
+    pub force: bool,
+}
+
+/// Consumer details returned by the API
+#[derive(Debug, Serialize)]
+pub struct ConsumerResponse {
+    pub name: String,
+    pub stream: String,
+    /// First of `filter_subjects`
+    pub filter_subject: String,
+    /// Every subject the consumer filters on
+    pub filter_subjects: Vec<String>,
+    pub ack_policy: String,
+    pub deliver_policy: String,
+    pub max_deliver: i64,
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub backoff_ms: Vec<u64>,
+    pub max_ack_pending: i64,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub inactive_threshold_seconds: Option<u64>,
+    /// Pull requests waiting, i.e. roughly the replicas sharing this durable
+    pub members: u64,
+    /// Messages not yet delivered to this consumer
+    pub num_pending: u64,
+    /// Delivered but not yet acknowledged
+    pub num_ack_pending: u64,
+    pub num_redelivered: u64,
+}
+
+#[derive(Serialize)]
+struct ListConsumersResponse {
+    consumers: Vec<ConsumerResponse>,
+}
+
+/// Create consumer management router
+pub fn create_consumer_router(state: ConsumerAppState) -> Router {
+    Router::new()
+        .route(
+            "/api/streams/:stream/consumers",
+            get(list_consumers).post(create_consumer),
+        )
+        .route(
+            "/api/streams/:stream/consumers/:name",
+            get(get_consumer).delete(delete_consumer),
+        )
+        .with_state(Arc::new(state))
+}
+
+/// GET /api/streams/:stream/consumers - List consumers filtered to a Flux stream
+async fn list_consumers(
+    State(state): State<Arc<ConsumerAppState>>,
+    Path(stream): Path<String>,
+) -> Result<Json<ListConsumersResponse>, ConsumerApiError> {
+    validate_stream(&stream)?;
+    let subject = stream_subject(&stream);
+    let js_stream = get_js_stream(&state).await?;
+
+    let mut consumers = Vec::new();
+    let mut infos = js_stream.consumers();
+    while let Some(info) = infos.next().await {
+        let info = info.map_err(|e| ConsumerApiError::Nats(e.to_string()))?;
+        if belongs_to_stream(&info.config, &subject) {
+            consumers.push(to_response(&stream, &info));
+        }
+    }
+
+    Ok(Json(ListConsumersResponse { consumers }))
+}
+
+/// POST /api/streams/:stream/consumers - Create a durable pull consumer
+async fn create_consumer(
+    State(state): State<Arc<ConsumerAppState>>,
+    headers: HeaderMap,
+    Path(stream): Path<String>,
+    Json(request): Json<CreateConsumerRequest>,
+) -> Result<(StatusCode, Json<ConsumerResponse>), ConsumerApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(ConsumerApiError::Unauthorized);
+    }
+    validate_stream(&stream)?;
+
+    let config = build_consumer_config(&stream, &request)?;
+    let js_stream = get_js_stream(&state).await?;
+
+    let mut consumer = js_stream
+        .create_consumer(config)
+        .await
+        .map_err(|e| ConsumerApiError::Nats(e.to_string()))?;
+    let info = consumer
+        .info()
+        .await
+        .map_err(|e| ConsumerApiError::Nats(e.to_string()))?;
+
+    info!(stream = %stream, consumer = %request.name, "Created consumer");
+
+    Ok((StatusCode::CREATED, Json(to_response(&stream, info))))
+}
+
+/// GET /api/streams/:stream/consumers/:name - Consumer info
+async fn get_consumer(
+    State(state): State<Arc<ConsumerAppState>>,
+    Path((stream, name)): Path<(String, String)>,
+) -> Result<Json<ConsumerResponse>, ConsumerApiError> {
+    validate_stream(&stream)?;
+    let info = fetch_consumer_info(&state, &stream, &name).await?;
+    Ok(Json(to_response(&stream, &info)))
+}
+
+/// DELETE /api/streams/:stream/consumers/:name[?force=true]
+///
+/// Refuses to delete a consumer with pending or unacknowledged messages unless
+/// `force=true` is given.
+async fn delete_consumer(
+    State(state): State<Arc<ConsumerAppState>>,
+    headers: HeaderMap,
+    Path((stream, name)): Path<(String, String)>,
+    Query(params): Query<DeleteConsumerParams>,
+) -> Result<StatusCode, ConsumerApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(ConsumerApiError::Unauthorized);
+    }
+    validate_stream(&stream)?;
+
+    let info = fetch_consumer_info(&state, &stream, &name).await?;
+    let outstanding = info.num_pending + info.num_ack_pending as u64;
+    if outstanding > 0 && !params.force {
+        return Err(ConsumerApiError::HasPending {
+            name,
+            pending: outstanding,
+        });
+    }
+
+    let js_stream = get_js_stream(&state).await?;
+    js_stream
+        .delete_consumer(&name)
+        .await
+        .map_err(|e| ConsumerApiError::Nats(e.to_string()))?;
+
+    info!(stream = %stream, consumer = %name, force = params.force, "Deleted consumer");
+    Ok(StatusCode::NO_CONTENT)
+}
+
+async fn get_js_stream(state: &ConsumerAppState) -> Result<jetstream::stream::Stream, ConsumerApiError> {
+    state
+        .jetstream
+        .get_stream(&state.stream_name)
+        .await
+        .map_err(|e| {
+            warn!(error = %e, stream = %state.stream_name, "Failed to get JetStream stream");
+            ConsumerApiError::Nats(e.to_string())
+        })
+}
+
+/// Look up a consumer and check it belongs to the requested Flux stream.
+async fn fetch_consumer_info(
+    state: &ConsumerAppState,
+    stream: &str,
+    name: &str,
+) -> Result<consumer::Info, ConsumerApiError> {
+    let js_stream = get_js_stream(state).await?;
+    let mut consumer = js_stream
+        .get_consumer::<pull::Config>(name)
+        .await
+        .map_err(|_| ConsumerApiError::NotFound(name.to_string()))?;
+    let info = consumer
+        .info()
+        .await
+        .map_err(|e| ConsumerApiError::Nats(e.to_string()))?
+        .clone();
+
+    if !belongs_to_stream(&info.config, &stream_subject(stream)) {
+        return Err(ConsumerApiError::NotFound(name.to_string()));
+    }
+    Ok(info)
+}
+
+fn validate_stream(stream: &str) -> Result<(), ConsumerApiError> {
+    if !is_valid_stream_name(stream) {
+        return Err(ConsumerApiError::BadRequest(format!(
+            "invalid stream name '{}'",
+            stream
+        )));
+    }
+    Ok(())
+}
+
+/// Subjects a consumer filters on: its `filter_subject`, or its
+/// `filter_subjects` when it has several.
+fn filters(config: &consumer::Config) -> Vec<&str> {
+    if config.filter_subject.is_empty() {
+        config.filter_subjects.iter().map(String::as_str).collect()
+    } else {
+        vec![config.filter_subject.as_str()]
+    }
+}
+
+/// True if the consumer filters on the stream subject and/or sub-subjects of
+/// it (e.g. `flux.events.sensors` plus `flux.events.sensors.>`), and nothing
+/// outside it.
+pub(crate) fn belongs_to_stream(config: &consumer::Config, stream_subject: &str) -> bool {
+    let filters = filters(config);
+    !filters.is_empty()
+        && filters.iter().all(|filter| {
+            *filter == stream_subject
+                || filter
+                    .strip_prefix(stream_subject)
+                    .map_or(false, |rest| rest.starts_with('.'))
+        })
+}
+
+/// Translate an API request into a JetStream pull consumer config.
+fn build_consumer_config(
+    stream: &str,
+    request: &CreateConsumerRequest,
+) -> Result<pull::Config, ConsumerApiError> {
+    if request.name.is_empty()
+        || !request
+            .name
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+    {
+        return Err(ConsumerApiError::BadRequest(format!(
+            "invalid consumer name '{}': use letters, digits, '-' or '_'",
+            request.name
+        )));
+    }
+
+    // Unfiltered consumers also need the sub-subjects: high/critical events
+    // are published on `<stream>.p.high`
+    let (filter_subject, filter_subjects) = match &request.filter {
+        Some(suffix) if !suffix.is_empty() => {
+            (format!("{}.{}", stream_subject(stream), suffix), Vec::new())
+        }
+        _ => (String::new(), stream_filter_subjects(stream)),
+    };
+
+    let ack_policy = match request.ack_policy.as_deref() {
+        None | Some("explicit") => AckPolicy::Explicit,
+        Some("all") => AckPolicy::All,
+        Some("none") => AckPolicy::None,
+        Some(other) => {
+            return Err(ConsumerApiError::BadRequest(format!(
+                "invalid ack_policy '{}'",
+                other
+            )))
+        }
+    };
+
+    let deliver_policy = match request.deliver_policy.as_deref() {
+        None | Some("all") => DeliverPolicy::All,
+        Some("new") => DeliverPolicy::New,
+        Some("last") => DeliverPolicy::Last,
+        Some("by_start_sequence") => DeliverPolicy::ByStartSequence {
+            start_sequence: request.start_sequence.ok_or_else(|| {
+                ConsumerApiError::BadRequest(
+                    "start_sequence is required for deliver_policy 'by_start_sequence'".to_string(),
+                )
+            })?,
+        },
+        Some(other) => {
+            return Err(ConsumerApiError::BadRequest(format!(
+                "invalid deliver_policy '{}'",
+                other
+            )))
+        }
+    };
+
+    let backoff: Vec<Duration> = request
+        .backoff_ms
+        .iter()
+        .flatten()
+        .map(|ms| Duration::from_millis(*ms))
+        .collect();
+    let max_deliver = request.max_deliver.unwrap_or(-1);
+    // JetStream rejects a backoff schedule longer than the delivery budget
+    if !backoff.is_empty() && max_deliver <= backoff.len() as i64 {
+        return Err(ConsumerApiError::BadRequest(format!(
+            "backoff_ms has {} delays: max_deliver must be set and greater than that",
+            backoff.len()
+        )));
+    }
+
+    Ok(pull::Config {
+        durable_name: Some(request.name.clone()),
+        filter_subject,
+        filter_subjects,
+        ack_policy,
+        deliver_policy,
+        max_deliver,
+        backoff,
+        max_ack_pending: request.max_ack_pending.unwrap_or_default(),
+        inactive_threshold: request
+            .inactive_threshold_seconds
+            .map(Duration::from_secs)
+            .unwrap_or_default(),
+        ..Default::default()
+    })
+}
+
+fn to_response(stream: &str, info: &consumer::Info) -> ConsumerResponse {
+    let filter_subjects: Vec<String> = filters(&info.config)
+        .into_iter()
+        .map(str::to_string)
+        .collect();
+    ConsumerResponse {
+        name: info.name.clone(),
+        stream: stream.to_string(),
+        filter_subject: filter_subjects.first().cloned().unwrap_or_default(),
+        filter_subjects,
+        ack_policy: format!("{:?}", info.config.ack_policy).to_lowercase(),
+        deliver_policy: deliver_policy_name(&info.config.deliver_policy),
+        max_deliver: info.config.max_deliver,
+        backoff_ms: info
+            .config
+            .backoff
+            .iter()
+            .map(|delay| delay.as_millis() as u64)
+            .collect(),
+        max_ack_pending: info.config.max_ack_pending,
+        inactive_threshold_seconds: Some(info.config.inactive_threshold.as_secs())
+            .filter(|secs| *secs > 0),
+        members: info.num_waiting as u64,
+        num_pending: info.num_pending,
+        num_ack_pending: info.num_ack_pending as u64,
+        num_redelivered: info.num_redelivered as u64,
+    }
+}
+
+fn deliver_policy_name(policy: &DeliverPolicy) -> String {
+    match policy {
+        DeliverPolicy::All => "all",
+        DeliverPolicy::New => "new",
+        DeliverPolicy::Last => "last",
+        DeliverPolicy::LastPerSubject => "last_per_subject",
+        DeliverPolicy::ByStartSequence { .. } => "by_start_sequence",
+        DeliverPolicy::ByStartTime { .. } => "by_start_time",
+    }
+    .to_string()
+}
+
+/// Consumer API errors
+#[derive(Debug)]
+pub enum ConsumerApiError {
+    Unauthorized,
+    BadRequest(String),
+    NotFound(String),
+    HasPending { name: String, pending: u64 },
+    Nats(String),
+}
+
+impl IntoResponse for ConsumerApiError {
+    fn into_response(self) -> Response {
+        let (status, error_message) = match self {
+            ConsumerApiError::Unauthorized => (StatusCode::UNAUTHORIZED, "Unauthorized".to_string()),
+            ConsumerApiError::BadRequest(msg) => (StatusCode::BAD_REQUEST, msg),
+            ConsumerApiError::NotFound(name) => (
+                StatusCode::NOT_FOUND,
+                format!("Consumer '{}' not found", name),
+            ),
+            ConsumerApiError::HasPending { name, pending } => (
+                StatusCode::CONFLICT,
+                format!(
+                    "Consumer '{}' has {} pending messages; use ?force=true to delete anyway",
+                    name, pending
+                ),
+            ),
+            ConsumerApiError::Nats(msg) => (StatusCode::INTERNAL_SERVER_ERROR, msg),
+        };
+
+        let body = Json(serde_json::json!({
+            "error": error_message,
+        }));
+
+        (status, body).into_response()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn request(name: &str) -> CreateConsumerRequest {
+        CreateConsumerRequest {
+            name: name.to_string(),
+            ack_policy: None,
+            filter: None,
+            max_deliver: None,
+            deliver_policy: None,
+            start_sequence: None,
+            backoff_ms: None,
+            max_ack_pending: None,
+            inactive_threshold_seconds: None,
+        }
+    }
+
+    #[test]
+    fn test_default_consumer_config() {
+        let config = build_consumer_config("sensors", &request("dashboard")).unwrap();
+        assert_eq!(config.durable_name.as_deref(), Some("dashboard"));
+        assert!(config.filter_subject.is_empty());
+        assert_eq!(
+            config.filter_subjects,
+            vec!["flux.events.sensors", "flux.events.sensors.>"]
+        );
+        assert_eq!(config.ack_policy, AckPolicy::Explicit);
+        assert_eq!(config.deliver_policy, DeliverPolicy::All);
+        assert_eq!(config.max_deliver, -1);
+        assert_eq!(config.inactive_threshold, Duration::ZERO);
+    }
+
+    #[test]
+    fn test_consumer_config_with_options() {
+        let mut req = request("zone1-reader");
+        req.filter = Some("zone1".to_string());
+        req.ack_policy = Some("all".to_string());
+        req.max_deliver = Some(5);
+        req.deliver_policy = Some("by_start_sequence".to_string());
+        req.start_sequence = Some(42);
+        req.inactive_threshold_seconds = Some(300);
+
+        let config = build_consumer_config("sensors", &req).unwrap();
+        assert_eq!(config.filter_subject, "flux.events.sensors.zone1");
+        assert!(config.filter_subjects.is_empty());
+        assert_eq!(config.ack_policy, AckPolicy::All);
+        assert_eq!(config.max_deliver, 5);
+        assert_eq!(
+            config.deliver_policy,
+            DeliverPolicy::ByStartSequence { start_sequence: 42 }
+        );
+        assert_eq!(config.inactive_threshold, Duration::from_secs(300));
+    }
+
+    #[test]
+    fn test_consumer_config_rejects_bad_input() {
+        assert!(build_consumer_config("sensors", &request("bad name")).is_err());
+        assert!(build_consumer_config("sensors", &request("")).is_err());
+
+        let mut req = request("ok");
+        req.ack_policy = Some("sometimes".to_string());
+        assert!(build_consumer_config("sensors", &req).is_err());
+
+        let mut req = request("ok");
+        req.deliver_policy = Some("by_start_sequence".to_string());
+        assert!(build_consumer_config("sensors", &req).is_err());
+    }
+
+    #[test]
+    fn test_consumer_config_backoff() {
+        let mut req = request("retrying");
+        req.backoff_ms = Some(vec![1000, 5000]);
+        assert!(build_consumer_config("sensors", &req).is_err());
+
+        req.max_deliver = Some(2);
+        assert!(build_consumer_config("sensors", &req).is_err());
+
+        req.max_deliver = Some(5);
+        let config = build_consumer_config("sensors", &req).unwrap();
+        assert_eq!(
+            config.backoff,
+            vec![Duration::from_secs(1), Duration::from_secs(5)]
+        );
+    }
+
+    fn single(filter: &str) -> consumer::Config {
+        consumer::Config {
+            filter_subject: filter.to_string(),
+            ..Default::default()
+        }
+    }
+
+    fn multi(filters: &[&str]) -> consumer::Config {
+        consumer::Config {
+            filter_subjects: filters.iter().map(|f| f.to_string()).collect(),
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_belongs_to_stream() {
+        let subject = "flux.events.sensors";
+        assert!(belongs_to_stream(&single("flux.events.sensors"), subject));
+        assert!(belongs_to_stream(&single("flux.events.sensors.zone1"), subject));
+        assert!(!belongs_to_stream(&single("flux.events.sensorsx"), subject));
+        assert!(!belongs_to_stream(&single("flux.events.>"), subject));
+        assert!(!belongs_to_stream(&single(""), subject));
+
+        let config = build_consumer_config("sensors", &request("dashboard")).unwrap();
+        assert!(belongs_to_stream(&multi(&config.filter_subjects), subject));
+        assert!(!belongs_to_stream(
+            &multi(&["flux.events.sensors", "flux.events.other"]),
+            subject
+        ));
+    }
+}
@@ -0,0 +1,187 @@
+use crate::api::admin::validate_admin_token;
+use crate::nats::{StreamUsage, StreamUsageMonitor};
+use crate::rate_limit::{BucketSnapshot, RateLimiter};
+use crate::state::StateEngine;
+use axum::{
+    extract::State,
+    http::{HeaderMap, StatusCode},
+    response::{IntoResponse, Json, Response},
+    routing::get,
+    Router,
+};
+use serde::Serialize;
+use std::sync::Arc;
+use std::time::Instant;
+
+/// Most entries of any one collection included in a snapshot
+pub const MAX_DEBUG_ENTRIES: usize = 100;
+
+/// True if FLUX_DEBUG_ENDPOINTS=true; the /debug routes are only mounted then.
+pub fn debug_endpoints_enabled() -> bool {
+    std::env::var("FLUX_DEBUG_ENDPOINTS")
+        .map(|v| v.eq_ignore_ascii_case("true"))
+        .unwrap_or(false)
+}
+
+/// Shared state for the debug endpoints
+#[derive(Clone)]
+pub struct DebugAppState {
+    pub state_engine: Arc<StateEngine>,
+    pub rate_limiter: Arc<RateLimiter>,
+    pub stream_usage: Arc<StreamUsageMonitor>,
+    /// Bearer token required for every debug request. None = unrestricted (dev mode).
+    pub admin_token: Option<String>,
+    pub started_at: Instant,
+}
+
+/// Internal state snapshot returned by GET /debug/flux
+#[derive(Debug, Serialize)]
+pub struct FluxDebugSnapshot {
+    pub state_engine: StateEngineDebug,
+    pub rate_limiter: Truncated<BucketSnapshot>,
+    /// Last polled usage of each JetStream stream
+    pub stream_cache: Truncated<StreamUsage>,
+}
+
+#[derive(Debug, Serialize)]
+pub struct StateEngineDebug {
+    pub entities: usize,
+    pub last_processed_sequence: u64,
+    pub live: bool,
+}
+
+/// Up to `MAX_DEBUG_ENTRIES` items of a collection of `total`.
+#[derive(Debug, Serialize)]
+pub struct Truncated<T> {
+    pub total: usize,
+    pub items: Vec<T>,
+}
+
+/// Process and runtime stats returned by GET /debug/runtime
+#[derive(Debug, Serialize)]
+pub struct RuntimeDebug {
+    pub uptime_seconds: u64,
+    pub tokio_workers: usize,
+    pub tokio_alive_tasks: usize,
+    pub tokio_global_queue_depth: usize,
+    /// Resident and virtual memory in bytes (Linux only)
+    pub rss_bytes: Option<u64>,
+    pub virtual_bytes: Option<u64>,
+}
+
+/// Create debug router; empty (every route 404s) unless `enabled`
+pub fn create_debug_router(state: DebugAppState, enabled: bool) -> Router {
+    if !enabled {
+        return Router::new();
+    }
+    Router::new()
+        .route("/debug/flux", get(flux_snapshot))
+        .route("/debug/runtime", get(runtime_stats))
+        .with_state(Arc::new(state))
+}
+
+/// GET /debug/flux - Bounded snapshot of internal state
+async fn flux_snapshot(
+    State(state): State<Arc<DebugAppState>>,
+    headers: HeaderMap,
+) -> Result<Json<FluxDebugSnapshot>, DebugApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(DebugApiError::Unauthorized);
+    }
+
+    let engine = &state.state_engine;
+    let mut streams = state.stream_usage.list();
+    let total_streams = streams.len();
+    streams.truncate(MAX_DEBUG_ENTRIES);
+
+    Ok(Json(FluxDebugSnapshot {
+        state_engine: StateEngineDebug {
+            entities: engine.entity_count(),
+            last_processed_sequence: engine.get_last_processed_sequence(),
+            live: engine.is_live(),
+        },
+        rate_limiter: Truncated {
+            total: state.rate_limiter.len(),
+            items: state.rate_limiter.snapshot(MAX_DEBUG_ENTRIES),
+        },
+        stream_cache: Truncated {
+            total: total_streams,
+            items: streams,
+        },
+    }))
+}
+
+/// GET /debug/runtime - Tokio runtime and process memory stats
+async fn runtime_stats(
+    State(state): State<Arc<DebugAppState>>,
+    headers: HeaderMap,
+) -> Result<Json<RuntimeDebug>, DebugApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(DebugApiError::Unauthorized);
+    }
+
+    let metrics = tokio::runtime::Handle::current().metrics();
+    let (rss_bytes, virtual_bytes) = process_memory();
+    Ok(Json(RuntimeDebug {
+        uptime_seconds: state.started_at.elapsed().as_secs(),
+        tokio_workers: metrics.num_workers(),
+        tokio_alive_tasks: metrics.num_alive_tasks(),
+        tokio_global_queue_depth: metrics.global_queue_depth(),
+        rss_bytes,
+        virtual_bytes,
+    }))
+}
+
+/// (resident, virtual) bytes from /proc/self/statm
+fn process_memory() -> (Option<u64>, Option<u64>) {
+    let Ok(statm) = std::fs::read_to_string("/proc/self/statm") else {
+        return (None, None);
+    };
+    parse_statm(&statm, 4096)
+}
+
+fn parse_statm(statm: &str, page_size: u64) -> (Option<u64>, Option<u64>) {
+    let mut pages = statm
+        .split_whitespace()
+        .map(|field| field.parse::<u64>().ok());
+    let virtual_pages = pages.next().flatten();
+    let resident_pages = pages.next().flatten();
+    (
+        resident_pages.map(|p| p * page_size),
+        virtual_pages.map(|p| p * page_size),
+    )
+}
+
+/// Debug API errors
+#[derive(Debug)]
+pub enum DebugApiError {
+    Unauthorized,
+}
+
+impl IntoResponse for DebugApiError {
+    fn into_response(self) -> Response {
+        let (status, error_message) = match self {
+            DebugApiError::Unauthorized => (StatusCode::UNAUTHORIZED, "Unauthorized".to_string()),
+        };
+
+        let body = Json(serde_json::json!({
+            "error": error_message,
+        }));
+
+        (status, body).into_response()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_parse_statm() {
+        assert_eq!(
+            parse_statm("2048 512 100 10 0 300 0\n", 4096),
+            (Some(512 * 4096), Some(2048 * 4096))
+        );
+        assert_eq!(parse_statm("", 4096), (None, None));
+    }
+}
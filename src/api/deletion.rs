@@ -194,6 +194,12 @@ async fn publish_tombstone(
         timestamp: Utc::now().timestamp_millis(),
         key: Some(entity_id.to_string()),
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: serde_json::json!({
             "entity_id": entity_id,
             "properties": {
@@ -201,6 +207,7 @@ async fn publish_tombstone(
                 "__deleted_at__": Utc::now().timestamp_millis()
             }
         }),
+        raw_payload: None,
     };
 
     // Validate and generate event ID
@@ -0,0 +1,157 @@
+use async_nats::jetstream;
+use chrono::{DateTime, Utc};
+use futures::StreamExt;
+use serde::Serialize;
+use std::time::Duration;
+
+/// Longest a detailed health check may take before reporting "degraded"
+pub const HEALTH_CHECK_TIMEOUT: Duration = Duration::from_secs(2);
+
+/// Consumer lag (undelivered messages) above which health is "degraded"
+pub const DEFAULT_LAG_THRESHOLD: u64 = 10_000;
+
+/// Response of GET /healthz once connected to NATS.
+#[derive(Debug, Clone, Serialize)]
+pub struct DetailedHealth {
+    /// "ok", "degraded" when a consumer lags or the check timed out, or
+    /// "unavailable" while the NATS connection is down
+    pub status: &'static str,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub reason: Option<String>,
+    pub streams: Vec<StreamHealth>,
+}
+
+/// Per-stream section of `DetailedHealth`.
+#[derive(Debug, Clone, Serialize)]
+pub struct StreamHealth {
+    pub name: String,
+    pub messages: u64,
+    pub consumer_count: usize,
+    /// Stored time of the oldest / newest message (None when empty)
+    pub oldest_message: Option<DateTime<Utc>>,
+    pub newest_message: Option<DateTime<Utc>>,
+    pub consumers: Vec<ConsumerHealth>,
+}
+
+/// Per-consumer section of `StreamHealth`.
+#[derive(Debug, Clone, Serialize)]
+pub struct ConsumerHealth {
+    pub name: String,
+    /// Messages not yet delivered to this consumer
+    pub lag: u64,
+    /// Delivered but not yet acknowledged
+    pub ack_pending: u64,
+    /// Pull requests waiting, i.e. roughly the replicas sharing this durable
+    pub members: u64,
+}
+
+impl DetailedHealth {
+    /// Liveness only (no NATS connection yet)
+    pub fn ok() -> Self {
+        Self {
+            status: "ok",
+            reason: None,
+            streams: Vec::new(),
+        }
+    }
+
+    /// NATS connection lost (no stats to report)
+    pub fn unavailable() -> Self {
+        Self {
+            status: "unavailable",
+            reason: Some("NATS connection lost".to_string()),
+            streams: Vec::new(),
+        }
+    }
+
+    fn degraded(reason: String, streams: Vec<StreamHealth>) -> Self {
+        Self {
+            status: "degraded",
+            reason: Some(reason),
+            streams,
+        }
+    }
+}
+
+/// Collect stream and consumer stats, capped at `HEALTH_CHECK_TIMEOUT`.
+///
+/// Status is "degraded" if any consumer's lag exceeds `lag_threshold`, or if
+/// JetStream could not be queried in time.
+pub async fn detailed_health(jetstream: &jetstream::Context, lag_threshold: u64) -> DetailedHealth {
+    let streams = match tokio::time::timeout(HEALTH_CHECK_TIMEOUT, collect_streams(jetstream)).await
+    {
+        Ok(Ok(streams)) => streams,
+        Ok(Err(e)) => return DetailedHealth::degraded(e, Vec::new()),
+        Err(_) => {
+            return DetailedHealth::degraded("health check timed out".to_string(), Vec::new())
+        }
+    };
+
+    let lagging: Vec<String> = streams
+        .iter()
+        .flat_map(|stream| {
+            stream
+                .consumers
+                .iter()
+                .filter(|consumer| consumer.lag > lag_threshold)
+                .map(move |consumer| format!("{}/{}", stream.name, consumer.name))
+        })
+        .collect();
+    if lagging.is_empty() {
+        DetailedHealth {
+            status: "ok",
+            reason: None,
+            streams,
+        }
+    } else {
+        DetailedHealth::degraded(
+            format!(
+                "consumer lag above {}: {}",
+                lag_threshold,
+                lagging.join(", ")
+            ),
+            streams,
+        )
+    }
+}
+
+async fn collect_streams(jetstream: &jetstream::Context) -> Result<Vec<StreamHealth>, String> {
+    let mut streams = Vec::new();
+    let mut infos = jetstream.streams();
+    while let Some(info) = infos.next().await {
+        let info = info.map_err(|e| e.to_string())?;
+        let stream = jetstream
+            .get_stream(&info.config.name)
+            .await
+            .map_err(|e| e.to_string())?;
+
+        let mut consumers = Vec::new();
+        let mut consumer_infos = stream.consumers();
+        while let Some(consumer) = consumer_infos.next().await {
+            let consumer = consumer.map_err(|e| e.to_string())?;
+            consumers.push(ConsumerHealth {
+                name: consumer.name,
+                lag: consumer.num_pending,
+                ack_pending: consumer.num_ack_pending as u64,
+                members: consumer.num_waiting as u64,
+            });
+        }
+        consumers.sort_by(|a, b| a.name.cmp(&b.name));
+
+        let empty = info.state.messages == 0;
+        streams.push(StreamHealth {
+            name: info.config.name,
+            messages: info.state.messages,
+            consumer_count: consumers.len(),
+            oldest_message: (!empty).then(|| to_chrono(info.state.first_timestamp)),
+            newest_message: (!empty).then(|| to_chrono(info.state.last_timestamp)),
+            consumers,
+        });
+    }
+    streams.sort_by(|a, b| a.name.cmp(&b.name));
+    Ok(streams)
+}
+
+fn to_chrono(timestamp: time::OffsetDateTime) -> DateTime<Utc> {
+    DateTime::from_timestamp_nanos(timestamp.unix_timestamp_nanos() as i64)
+}
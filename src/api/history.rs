@@ -1,7 +1,8 @@
 use crate::event::FluxEvent;
+use crate::nats::{decode_event, EventIndex, FindEventError};
 use async_nats::jetstream;
 use axum::{
-    extract::{Query, State},
+    extract::{Path, Query, State},
     http::StatusCode,
     response::{IntoResponse, Json, Response},
     routing::get,
@@ -16,6 +17,8 @@ use tracing::warn;
 /// Shared state for history API
 pub struct HistoryAppState {
     pub jetstream: jetstream::Context,
+    /// eventId index for GET /api/events/:id (None = lookups disabled)
+    pub event_index: Option<Arc<EventIndex>>,
 }
 
 /// Query parameters for event history
@@ -38,6 +41,7 @@ struct ErrorResponse {
 pub fn create_history_router(state: Arc<HistoryAppState>) -> Router {
     Router::new()
         .route("/api/events", get(get_events))
+        .route("/api/events/:id", get(get_event_by_id))
         .with_state(state)
 }
 
@@ -160,7 +164,7 @@ async fn get_events(
         .await
         {
             Ok(Some(Ok(msg))) => {
-                if let Ok(event) = serde_json::from_slice::<FluxEvent>(&msg.payload) {
+                if let Ok(event) = decode_event(msg.headers.as_ref(), &msg.payload) {
                     if event
                         .payload
                         .get("entity_id")
@@ -185,6 +189,45 @@ async fn get_events(
     Json(collected).into_response()
 }
 
+/// GET /api/events/:id
+///
+/// Returns a single stored event by eventId via the eventId index.
+async fn get_event_by_id(
+    State(state): State<Arc<HistoryAppState>>,
+    Path(event_id): Path<String>,
+) -> Response {
+    let Some(index) = &state.event_index else {
+        return (
+            StatusCode::NOT_IMPLEMENTED,
+            Json(ErrorResponse {
+                error: "event index is not enabled".to_string(),
+            }),
+        )
+            .into_response();
+    };
+
+    match index.find_event(&event_id).await {
+        Ok(stored) => Json(stored).into_response(),
+        Err(e @ (FindEventError::NotIndexed(_) | FindEventError::NotFound(_))) => (
+            StatusCode::NOT_FOUND,
+            Json(ErrorResponse {
+                error: e.to_string(),
+            }),
+        )
+            .into_response(),
+        Err(e) => {
+            warn!(error = %e, event_id = %event_id, "Event lookup failed");
+            (
+                StatusCode::INTERNAL_SERVER_ERROR,
+                Json(ErrorResponse {
+                    error: "failed to read event".to_string(),
+                }),
+            )
+                .into_response()
+        }
+    }
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
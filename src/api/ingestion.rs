@@ -1,22 +1,35 @@
 use crate::api::auth_middleware::{authorize_event, AuthError};
 use crate::config::SharedRuntimeConfig;
 use crate::entity::parse_entity_id;
-use crate::event::FluxEvent;
+use crate::event::{FluxEvent, Priority, ValidationError, ValidationErrorCode};
 use crate::namespace::NamespaceRegistry;
-use crate::nats::EventPublisher;
+use crate::nats::{
+    AdmissionRejectedError, EventPublisher, PayloadTooLargeError, StreamArchivedError,
+    StreamFullError, SubjectNotCapturedError,
+};
 use crate::rate_limit::RateLimiter;
+use crate::source::SourceRejectedError;
 use axum::{
     body::Bytes,
     extract::State,
-    http::{HeaderMap, StatusCode},
+    http::{header, HeaderMap, HeaderValue, StatusCode},
     response::{IntoResponse, Json, Response},
     routing::post,
     Router,
 };
 use serde::{Deserialize, Serialize};
+use serde_json::value::RawValue;
 use std::sync::Arc;
 use tracing::{error, info};
 
+/// `Warning` sent when a producer's source was normalized (lenient source
+/// format mode); strict mode would reject it
+const SOURCE_NORMALIZED_WARNING: &str =
+    "299 flux \"source was normalized; send lowercase letters, digits, dots and hyphens\"";
+
+/// Publishes waiting for a slot when a request was shed (503)
+const QUEUE_DEPTH_HEADER: &str = "x-flux-queue-depth";
+
 /// Shared application state
 #[derive(Clone)]
 pub struct AppState {
@@ -42,10 +55,11 @@ struct ErrorResponse {
     error: String,
 }
 
-/// Batch request
+/// Batch request; events are parsed one by one with `FluxEvent::from_json_slice`
 #[derive(Deserialize)]
-struct BatchRequest {
-    events: Vec<FluxEvent>,
+struct BatchRequest<'a> {
+    #[serde(borrow)]
+    events: Vec<&'a RawValue>,
 }
 
 /// Batch response
@@ -62,6 +76,9 @@ struct BatchResult {
     event_id: Option<String>,
     stream: Option<String>,
     error: Option<String>,
+    /// Validation error code (see ValidationErrorCode)
+    #[serde(skip_serializing_if = "Option::is_none")]
+    code: Option<ValidationErrorCode>,
 }
 
 /// Create API router with ingestion endpoints
@@ -77,21 +94,22 @@ async fn publish_event(
     State(state): State<Arc<AppState>>,
     headers: HeaderMap,
     body: Bytes,
-) -> Result<Json<EventResponse>, AppError> {
+) -> Result<Response, AppError> {
     // Check body size against runtime-configurable limit
     let limit = state.runtime_config.read().unwrap().body_size_limit_single_bytes;
     if body.len() > limit {
-        return Err(AppError::PayloadTooLarge);
+        return Err(AppError::PayloadTooLarge("payload too large".to_string()));
     }
 
     // Deserialize from checked bytes
-    let mut event: FluxEvent = serde_json::from_slice(&body)
-        .map_err(|e| AppError::ValidationError(e.to_string()))?;
+    let mut event =
+        FluxEvent::from_json_slice(&body).map_err(|e| AppError::ValidationError(e.to_string()))?;
+
+    // Normalize the source first, so authorization and rate limits see it
+    let source_normalized = state.event_publisher.normalize_source(&mut event);
 
     // Validate and prepare event (generates UUIDv7 if needed)
-    event
-        .validate_and_prepare()
-        .map_err(|e| AppError::ValidationError(e.to_string()))?;
+    event.validate_and_prepare().map_err(AppError::InvalidEvent)?;
 
     // Authorize event (if auth enabled)
     authorize_event(
@@ -102,16 +120,8 @@ async fn publish_event(
     )?;
 
     // Rate limit check (auth-gated: only active when auth is enabled)
-    if state.auth_enabled {
-        let namespace = extract_namespace_from_event(&event);
-        let limit = state
-            .runtime_config
-            .read()
-            .unwrap()
-            .rate_limit_per_namespace_per_minute;
-        if !state.rate_limiter.check_and_consume(&namespace, limit) {
-            return Err(AppError::RateLimited);
-        }
+    if state.auth_enabled && !check_rate_limit(&state, &event) {
+        return Err(AppError::RateLimited);
     }
 
     info!(
@@ -127,14 +137,40 @@ async fn publish_event(
         .publish(&event)
         .await
         .map_err(|e| {
+            if let Some(rejected) = e.downcast_ref::<AdmissionRejectedError>() {
+                return AppError::Overloaded(rejected.clone());
+            }
+            if e.downcast_ref::<StreamFullError>().is_some() {
+                return AppError::StreamFull(e.to_string());
+            }
+            if e.downcast_ref::<SourceRejectedError>().is_some() {
+                return AppError::Forbidden(e.to_string());
+            }
+            if let Some(validation) = e.downcast_ref::<ValidationError>() {
+                return AppError::InvalidEvent(validation.clone());
+            }
+            if e.downcast_ref::<SubjectNotCapturedError>().is_some() {
+                return AppError::ValidationError(e.to_string());
+            }
+            if e.downcast_ref::<PayloadTooLargeError>().is_some() {
+                return AppError::PayloadTooLarge(e.to_string());
+            }
+            if e.downcast_ref::<StreamArchivedError>().is_some() {
+                return AppError::StreamArchived(e.to_string());
+            }
             error!(error = %e, "Failed to publish event to NATS");
             AppError::PublishError(e.to_string())
         })?;
 
-    Ok(Json(EventResponse {
+    let mut response = Json(EventResponse {
         event_id: event.event_id.clone().unwrap(),
         stream: event.stream.clone(),
-    }))
+    })
+    .into_response();
+    if source_normalized {
+        mark_source_normalized(&mut response);
+    }
+    Ok(response)
 }
 
 /// POST /api/events/batch - Publish multiple events
@@ -142,30 +178,40 @@ async fn publish_batch(
     State(state): State<Arc<AppState>>,
     headers: HeaderMap,
     body: Bytes,
-) -> Result<Json<BatchResponse>, AppError> {
+) -> Result<Response, AppError> {
     // Check body size against runtime-configurable limit
     let limit = state.runtime_config.read().unwrap().body_size_limit_batch_bytes;
     if body.len() > limit {
-        return Err(AppError::PayloadTooLarge);
+        return Err(AppError::PayloadTooLarge("payload too large".to_string()));
     }
 
     // Deserialize from checked bytes
-    let mut request: BatchRequest = serde_json::from_slice(&body)
+    let request: BatchRequest = serde_json::from_slice(&body)
+        .map_err(|e| AppError::ValidationError(e.to_string()))?;
+    let mut events = request
+        .events
+        .iter()
+        .map(|raw| FluxEvent::from_json_slice(raw.get().as_bytes()))
+        .collect::<Result<Vec<_>, _>>()
         .map_err(|e| AppError::ValidationError(e.to_string()))?;
 
-    if request.events.is_empty() {
+    if events.is_empty() {
         return Err(AppError::ValidationError(
             "Batch request must contain at least one event".to_string(),
         ));
     }
 
-    info!(count = request.events.len(), "Ingesting event batch");
+    info!(count = events.len(), "Ingesting event batch");
 
     let mut results = Vec::new();
     let mut successful = 0;
     let mut failed = 0;
+    let mut source_normalized = false;
+    let mut overloaded = None;
+
+    for event in &mut events {
+        source_normalized |= state.event_publisher.normalize_source(event);
 
-    for event in &mut request.events {
         // Validate and prepare
         if let Err(e) = event.validate_and_prepare() {
             failed += 1;
@@ -173,6 +219,7 @@ async fn publish_batch(
                 event_id: None,
                 stream: Some(event.stream.clone()),
                 error: Some(format!("validation failed: {}", e)),
+                code: Some(e.code()),
             });
             continue;
         }
@@ -189,27 +236,21 @@ async fn publish_batch(
                 event_id: event.event_id.clone(),
                 stream: Some(event.stream.clone()),
                 error: Some(format!("authorization failed: {}", e)),
+                code: None,
             });
             continue;
         }
 
         // Rate limit check (auth-gated)
-        if state.auth_enabled {
-            let namespace = extract_namespace_from_event(event);
-            let limit = state
-                .runtime_config
-                .read()
-                .unwrap()
-                .rate_limit_per_namespace_per_minute;
-            if !state.rate_limiter.check_and_consume(&namespace, limit) {
-                failed += 1;
-                results.push(BatchResult {
-                    event_id: event.event_id.clone(),
-                    stream: Some(event.stream.clone()),
-                    error: Some("rate limit exceeded".to_string()),
-                });
-                continue;
-            }
+        if state.auth_enabled && !check_rate_limit(&state, event) {
+            failed += 1;
+            results.push(BatchResult {
+                event_id: event.event_id.clone(),
+                stream: Some(event.stream.clone()),
+                error: Some("rate limit exceeded".to_string()),
+                code: None,
+            });
+            continue;
         }
 
         // Publish to NATS
@@ -220,35 +261,71 @@ async fn publish_batch(
                     event_id: event.event_id.clone(),
                     stream: Some(event.stream.clone()),
                     error: None,
+                    code: None,
                 });
             }
             Err(e) => {
-                error!(error = %e, event_id = %event.event_id.as_ref().unwrap(), "Failed to publish event");
+                if let Some(rejected) = e.downcast_ref::<AdmissionRejectedError>() {
+                    overloaded = Some(rejected.clone());
+                } else {
+                    error!(error = %e, event_id = %event.event_id.as_ref().unwrap(), "Failed to publish event");
+                }
                 failed += 1;
                 results.push(BatchResult {
                     event_id: event.event_id.clone(),
                     stream: Some(event.stream.clone()),
                     error: Some(format!("publish failed: {}", e)),
+                    code: e.downcast_ref::<ValidationError>().map(|v| v.code()),
                 });
             }
         }
     }
 
-    Ok(Json(BatchResponse {
+    let mut response = Json(BatchResponse {
         successful,
         failed,
         results,
-    }))
+    })
+    .into_response();
+    if source_normalized {
+        mark_source_normalized(&mut response);
+    }
+    if let Some(rejected) = overloaded {
+        mark_overloaded(&mut response, &rejected);
+    }
+    Ok(response)
+}
+
+/// Tell a producer its source was normalized: `Deprecation: true` and a
+/// `Warning`, as the source would be rejected in strict mode.
+fn mark_source_normalized(response: &mut Response) {
+    let headers = response.headers_mut();
+    headers.insert("deprecation", HeaderValue::from_static("true"));
+    headers.insert(
+        header::WARNING,
+        HeaderValue::from_static(SOURCE_NORMALIZED_WARNING),
+    );
+}
+
+/// `Retry-After` and the queue depth for a publish shed under load.
+fn mark_overloaded(response: &mut Response, rejected: &AdmissionRejectedError) {
+    let headers = response.headers_mut();
+    headers.insert(header::RETRY_AFTER, rejected.retry_after.as_secs().into());
+    headers.insert(QUEUE_DEPTH_HEADER, rejected.queue_depth.into());
 }
 
 /// Application error types
 enum AppError {
     ValidationError(String),
+    InvalidEvent(ValidationError),
     PublishError(String),
     Unauthorized(String),
     Forbidden(String),
-    PayloadTooLarge,
+    PayloadTooLarge(String),
+    StreamArchived(String),
     RateLimited,
+    StreamFull(String),
+    Overloaded(AdmissionRejectedError),
 }
 
 impl IntoResponse for AppError {
@@ -265,16 +342,36 @@ impl IntoResponse for AppError {
                 );
                 resp
             }
+            AppError::Overloaded(rejected) => {
+                let body = Json(ErrorResponse {
+                    error: rejected.to_string(),
+                });
+                let mut resp = (StatusCode::SERVICE_UNAVAILABLE, body).into_response();
+                mark_overloaded(&mut resp, &rejected);
+                resp
+            }
+            AppError::InvalidEvent(e) => {
+                let status = StatusCode::from_u16(e.code().http_status())
+                    .unwrap_or(StatusCode::BAD_REQUEST);
+                let body = Json(serde_json::json!({
+                    "error": e.to_string(),
+                    "code": e.code(),
+                    "field": e.field(),
+                }));
+                (status, body).into_response()
+            }
             other => {
                 let (status, error_message) = match other {
                     AppError::ValidationError(msg) => (StatusCode::BAD_REQUEST, msg),
                     AppError::PublishError(msg) => (StatusCode::INTERNAL_SERVER_ERROR, msg),
+                    AppError::StreamFull(msg) => (StatusCode::SERVICE_UNAVAILABLE, msg),
                     AppError::Unauthorized(msg) => (StatusCode::UNAUTHORIZED, msg),
                     AppError::Forbidden(msg) => (StatusCode::FORBIDDEN, msg),
-                    AppError::PayloadTooLarge => {
-                        (StatusCode::PAYLOAD_TOO_LARGE, "payload too large".to_string())
+                    AppError::PayloadTooLarge(msg) => (StatusCode::PAYLOAD_TOO_LARGE, msg),
+                    AppError::StreamArchived(msg) => (StatusCode::GONE, msg),
+                    AppError::RateLimited | AppError::InvalidEvent(_) | AppError::Overloaded(_) => {
+                        unreachable!()
                     }
-                    AppError::RateLimited => unreachable!(),
                 };
                 let body = Json(ErrorResponse {
                     error: error_message,
@@ -296,6 +393,29 @@ impl From<AuthError> for AppError {
     }
 }
 
+/// Consume one rate-limit token for `event`.
+///
+/// Critical events draw from their own per-namespace budget instead of the
+/// regular one, so alarms are not dropped when bulk telemetry hits the limit.
+fn check_rate_limit(state: &AppState, event: &FluxEvent) -> bool {
+    let namespace = extract_namespace_from_event(event);
+    let (limit, critical_limit) = {
+        let cfg = state.runtime_config.read().unwrap();
+        (
+            cfg.rate_limit_per_namespace_per_minute,
+            cfg.rate_limit_critical_per_namespace_per_minute,
+        )
+    };
+
+    if event.priority() == Priority::Critical {
+        state
+            .rate_limiter
+            .check_and_consume_critical(&namespace, critical_limit)
+    } else {
+        state.rate_limiter.check_and_consume(&namespace, limit)
+    }
+}
+
 /// Extract namespace from event payload's entity_id, falling back to stream name.
 ///
 /// Used for rate-limit bucket keying. If entity_id is missing or has no namespace
@@ -4,19 +4,39 @@ mod ingestion;
 pub mod admin;
 pub mod auth_middleware;
 pub mod connectors;
+pub mod consumer_fetch;
+pub mod consumers;
+pub mod debug;
 pub mod deletion;
+pub mod health;
 pub mod history;
 pub mod namespace;
 pub mod oauth;
 pub mod query;
+pub mod readiness;
+pub mod reconcile;
+pub mod rules;
+pub mod sources;
+pub mod stream_usage;
+pub mod streams;
 pub mod websocket;
 
 pub use admin::{create_admin_router, AdminAppState};
 pub use connectors::{create_connector_router, ConnectorAppState};
+pub use consumer_fetch::{create_fetch_router, FetchAppState};
+pub use consumers::{create_consumer_router, ConsumerAppState};
+pub use debug::{create_debug_router, debug_endpoints_enabled, DebugAppState};
 pub use deletion::{create_deletion_router, DeletionAppState};
+pub use health::{ConsumerHealth, DetailedHealth, StreamHealth};
 pub use history::{create_history_router, HistoryAppState};
 pub use ingestion::{create_router, AppState};
 pub use namespace::create_namespace_router;
 pub use oauth::{create_oauth_router, run_state_cleanup, OAuthAppState, StateManager};
 pub use query::{create_query_router, QueryAppState};
+pub use readiness::{NotReadyError, Readiness, HEALTH_STREAM};
+pub use reconcile::{create_reconcile_router, ReconcileAppState};
+pub use rules::{create_rule_router, RuleAppState};
+pub use sources::{create_source_router, SourceAppState};
+pub use stream_usage::{create_stream_usage_router, StreamUsageAppState};
+pub use streams::{create_stream_list_router, StreamListAppState};
 pub use websocket::{create_ws_router, ws_handler, WsAppState};
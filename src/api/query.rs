@@ -1,4 +1,7 @@
-use crate::state::StateEngine;
+use crate::state::{
+    AdmissionSnapshot, HistogramSnapshot, PublishSnapshot, StateEngine, StorageSnapshot,
+    MAX_RATE_WINDOW,
+};
 use axum::{
     extract::{Path, Query, State},
     http::StatusCode,
@@ -7,7 +10,9 @@ use axum::{
     Router,
 };
 use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
 use std::sync::Arc;
+use std::time::Duration;
 
 /// Shared state for query API (uses same WsAppState from websocket module)
 pub struct QueryAppState {
@@ -43,9 +48,80 @@ pub fn create_query_router(state: Arc<QueryAppState>) -> Router {
     Router::new()
         .route("/api/state/entities", get(list_entities))
         .route("/api/state/entities/:id", get(get_entity))
+        .route("/api/metrics/lag", get(get_lag_metrics))
+        .route("/api/metrics/storage", get(get_storage_metrics))
+        .route("/api/metrics/publishes", get(get_publish_metrics))
+        .route("/api/metrics/admission", get(get_admission_metrics))
         .with_state(state)
 }
 
+/// Lag histograms by stream
+#[derive(Serialize)]
+pub struct LagMetricsResponse {
+    pub flux_event_ingest_lag_seconds: HashMap<String, HistogramSnapshot>,
+    pub flux_event_consume_lag_seconds: HashMap<String, HistogramSnapshot>,
+    pub flux_publish_latency_seconds: HashMap<String, HistogramSnapshot>,
+    /// By consumer, then stream
+    pub flux_consumer_delivery_latency_seconds: HashMap<String, HashMap<String, HistogramSnapshot>>,
+}
+
+/// GET /api/metrics/lag - Event age at publish, at state engine processing and
+/// at delivery to consumers; publish-to-ack latency
+async fn get_lag_metrics(State(state): State<Arc<QueryAppState>>) -> Json<LagMetricsResponse> {
+    let lag = state.state_engine.metrics.lag();
+    Json(LagMetricsResponse {
+        flux_event_ingest_lag_seconds: lag.ingest_snapshot(),
+        flux_event_consume_lag_seconds: lag.consume_snapshot(),
+        flux_publish_latency_seconds: lag.publish_snapshot(),
+        flux_consumer_delivery_latency_seconds: lag.delivery_snapshot(),
+    })
+}
+
+/// GET /api/metrics/storage - Raw vs stored bytes of published events
+async fn get_storage_metrics(State(state): State<Arc<QueryAppState>>) -> Json<StorageSnapshot> {
+    Json(state.state_engine.metrics.storage().snapshot())
+}
+
+/// Query parameters for publish metrics
+#[derive(Deserialize)]
+pub struct PublishMetricsParams {
+    /// Rate window (default 60, at most 300)
+    pub window_seconds: Option<u64>,
+}
+
+/// Publish counts and rates by stream
+#[derive(Serialize)]
+pub struct PublishMetricsResponse {
+    pub window_seconds: u64,
+    pub flux_stream_publishes: HashMap<String, PublishSnapshot>,
+}
+
+/// GET /api/metrics/publishes - Successful publishes per stream since start,
+/// and publishes per second over the last `window_seconds`
+async fn get_publish_metrics(
+    State(state): State<Arc<QueryAppState>>,
+    Query(params): Query<PublishMetricsParams>,
+) -> Json<PublishMetricsResponse> {
+    let metrics = &state.state_engine.metrics;
+    let window_seconds = params
+        .window_seconds
+        .unwrap_or(60)
+        .clamp(1, MAX_RATE_WINDOW.as_secs());
+    let window = Duration::from_secs(window_seconds);
+    Json(PublishMetricsResponse {
+        window_seconds,
+        flux_stream_publishes: metrics
+            .publishes()
+            .snapshot(window, metrics.clock().now_millis()),
+    })
+}
+
+/// GET /api/metrics/admission - Publishes in flight and queued, and
+/// rejections since start
+async fn get_admission_metrics(State(state): State<Arc<QueryAppState>>) -> Json<AdmissionSnapshot> {
+    Json(state.state_engine.metrics.admission().snapshot())
+}
+
 /// GET /api/state/entities - List all entities
 ///
 /// Query parameters:
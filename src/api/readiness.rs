@@ -0,0 +1,192 @@
+use super::health::{detailed_health, DetailedHealth, DEFAULT_LAG_THRESHOLD};
+use crate::nats::{ConnectionMonitor, NatsClient, StreamInitStatus};
+use async_nats::jetstream;
+use axum::{
+    body::Body,
+    extract::{Request, State},
+    http::{header, HeaderValue, StatusCode},
+    response::{IntoResponse, Json, Response},
+    routing::get,
+    Router,
+};
+use serde::Serialize;
+use std::fmt;
+use std::sync::{Arc, OnceLock};
+use tower::ServiceExt;
+
+/// Stream for Flux's own lifecycle events (opt-in startup event)
+pub const HEALTH_STREAM: &str = "flux.system.health";
+
+/// Returned (as 503) for requests that arrive before Flux is connected to NATS.
+#[derive(Debug, Clone, PartialEq)]
+pub struct NotReadyError {
+    pub reason: String,
+}
+
+impl fmt::Display for NotReadyError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "service not ready: {}", self.reason)
+    }
+}
+
+impl std::error::Error for NotReadyError {}
+
+impl IntoResponse for NotReadyError {
+    fn into_response(self) -> Response {
+        let mut resp = (
+            StatusCode::SERVICE_UNAVAILABLE,
+            Json(serde_json::json!({ "error": self.to_string() })),
+        )
+            .into_response();
+        resp.headers_mut()
+            .insert(header::RETRY_AFTER, HeaderValue::from_static("5"));
+        resp
+    }
+}
+
+struct Ready {
+    app: Router,
+    monitor: Arc<ConnectionMonitor>,
+    jetstream: jetstream::Context,
+    /// Streams `connect` failed to initialize
+    failed_streams: Vec<String>,
+}
+
+/// Serves `/healthz` and `/readyz` from process start, and the full API once
+/// `set_ready` is called.
+///
+/// Lets the HTTP listener come up before NATS does (lazy connect): until then
+/// every other route answers 503 with a `NotReadyError`.
+#[derive(Clone)]
+pub struct Readiness {
+    ready: Arc<OnceLock<Ready>>,
+    lag_threshold: u64,
+}
+
+impl Default for Readiness {
+    fn default() -> Self {
+        Self {
+            ready: Arc::new(OnceLock::new()),
+            lag_threshold: DEFAULT_LAG_THRESHOLD,
+        }
+    }
+}
+
+#[derive(Serialize)]
+struct ReadinessResponse {
+    status: &'static str,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    reason: Option<String>,
+}
+
+impl Readiness {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Report /healthz as "degraded" when a consumer lags by more than
+    /// `threshold` messages (default 10,000).
+    pub fn with_lag_threshold(mut self, threshold: u64) -> Self {
+        self.lag_threshold = threshold;
+        self
+    }
+
+    /// Start serving `app`. Readiness then follows the NATS connection state
+    /// (and stays false if a stream failed to initialize), and /healthz
+    /// reports stream and consumer stats. Later calls are ignored.
+    pub fn set_ready(&self, app: Router, nats: &NatsClient) {
+        let failed_streams = nats
+            .stream_init_report()
+            .iter()
+            .filter(|result| result.status == StreamInitStatus::Failed)
+            .map(|result| result.stream.clone())
+            .collect();
+        let _ = self.ready.set(Ready {
+            app,
+            monitor: nats.connection_monitor(),
+            jetstream: nats.jetstream().clone(),
+            failed_streams,
+        });
+    }
+
+    /// Ok when ready, otherwise why not.
+    pub fn check(&self) -> Result<(), NotReadyError> {
+        let Some(ready) = self.ready.get() else {
+            return Err(NotReadyError {
+                reason: "connecting to NATS".to_string(),
+            });
+        };
+        if !ready.failed_streams.is_empty() {
+            return Err(NotReadyError {
+                reason: format!(
+                    "streams failed to initialize: {}",
+                    ready.failed_streams.join(", ")
+                ),
+            });
+        }
+        if !ready.monitor.is_connected() {
+            return Err(NotReadyError {
+                reason: "NATS connection lost".to_string(),
+            });
+        }
+        Ok(())
+    }
+
+    /// Router for the whole service: health endpoints plus the API.
+    pub fn router(&self) -> Router {
+        Router::new()
+            .route("/healthz", get(healthz))
+            .route("/readyz", get(readyz))
+            .fallback(forward)
+            .with_state(self.clone())
+    }
+}
+
+/// GET /healthz - The process is up (liveness), with stream and consumer
+/// stats once connected to NATS. 503 once connected if the connection is lost.
+async fn healthz(State(readiness): State<Readiness>) -> Response {
+    match readiness.ready.get() {
+        Some(ready) if !ready.monitor.is_connected() => (
+            StatusCode::SERVICE_UNAVAILABLE,
+            Json(DetailedHealth::unavailable()),
+        )
+            .into_response(),
+        Some(ready) => {
+            Json(detailed_health(&ready.jetstream, readiness.lag_threshold).await).into_response()
+        }
+        None => Json(DetailedHealth::ok()).into_response(),
+    }
+}
+
+/// GET /readyz - Connected to NATS and serving the API
+async fn readyz(State(readiness): State<Readiness>) -> Response {
+    match readiness.check() {
+        Ok(()) => Json(ReadinessResponse {
+            status: "ready",
+            reason: None,
+        })
+        .into_response(),
+        Err(e) => (
+            StatusCode::SERVICE_UNAVAILABLE,
+            Json(ReadinessResponse {
+                status: "not_ready",
+                reason: Some(e.reason),
+            }),
+        )
+            .into_response(),
+    }
+}
+
+/// Any other route: the API once ready, 503 before.
+async fn forward(State(readiness): State<Readiness>, request: Request<Body>) -> Response {
+    match readiness.ready.get() {
+        Some(ready) => match ready.app.clone().oneshot(request).await {
+            Ok(response) => response,
+            Err(never) => match never {},
+        },
+        None => NotReadyError {
+            reason: "connecting to NATS".to_string(),
+        }
+        .into_response(),
+    }
+}
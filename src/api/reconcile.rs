@@ -0,0 +1,162 @@
+use crate::api::admin::validate_admin_token;
+use crate::nats::{
+    ImportMode, ImportReport, ReconcileReport, Reconciler, StreamDefinitions,
+    UnsupportedDefinitionsError,
+};
+use axum::{
+    extract::{Query, State},
+    http::{HeaderMap, StatusCode},
+    response::{IntoResponse, Json, Response},
+    routing::get,
+    Router,
+};
+use serde::Deserialize;
+use std::sync::Arc;
+use tracing::{error, info};
+
+/// Shared state for the stream reconciliation API
+#[derive(Clone)]
+pub struct ReconcileAppState {
+    pub reconciler: Arc<Reconciler>,
+    /// Allow POST to change the cluster (`nats.reconcile_apply`)
+    pub apply_enabled: bool,
+    /// Bearer token required for POST. None = unrestricted (dev mode).
+    pub admin_token: Option<String>,
+}
+
+/// Create stream reconciliation router
+pub fn create_reconcile_router(state: ReconcileAppState) -> Router {
+    Router::new()
+        .route("/api/admin/reconcile", get(get_report).post(apply_report))
+        .route(
+            "/api/admin/definitions",
+            get(get_definitions).post(import_definitions),
+        )
+        .with_state(Arc::new(state))
+}
+
+/// GET /api/admin/reconcile - Compare declared streams with the cluster
+async fn get_report(
+    State(state): State<Arc<ReconcileAppState>>,
+) -> Result<Json<ReconcileReport>, ReconcileApiError> {
+    let report = state.reconciler.report().await.map_err(|e| {
+        error!(error = %e, "Failed to reconcile streams");
+        ReconcileApiError::Failed(e.to_string())
+    })?;
+    Ok(Json(report))
+}
+
+/// POST /api/admin/reconcile - Create missing streams and apply safe drift
+async fn apply_report(
+    State(state): State<Arc<ReconcileAppState>>,
+    headers: HeaderMap,
+) -> Result<Json<ReconcileReport>, ReconcileApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(ReconcileApiError::Unauthorized);
+    }
+    if !state.apply_enabled {
+        return Err(ReconcileApiError::ApplyDisabled);
+    }
+
+    let report = state.reconciler.apply().await.map_err(|e| {
+        error!(error = %e, "Failed to reconcile streams");
+        ReconcileApiError::Failed(e.to_string())
+    })?;
+    info!(
+        missing = report.missing.len(),
+        drifted = report.drifted.len(),
+        applied = report.applied.len(),
+        "Reconciled streams"
+    );
+    Ok(Json(report))
+}
+
+/// Query parameters for GET /api/admin/definitions
+#[derive(Debug, Deserialize)]
+pub struct ExportQuery {
+    /// Include each stream's durable consumers
+    #[serde(default)]
+    pub consumers: bool,
+}
+
+/// Query parameters for POST /api/admin/definitions
+#[derive(Debug, Deserialize)]
+pub struct ImportQuery {
+    #[serde(default)]
+    pub mode: ImportMode,
+}
+
+/// GET /api/admin/definitions - Snapshot the cluster's stream definitions
+async fn get_definitions(
+    State(state): State<Arc<ReconcileAppState>>,
+    Query(query): Query<ExportQuery>,
+) -> Result<Json<StreamDefinitions>, ReconcileApiError> {
+    let definitions = state
+        .reconciler
+        .export_definitions(query.consumers)
+        .await
+        .map_err(|e| {
+            error!(error = %e, "Failed to export stream definitions");
+            ReconcileApiError::Failed(e.to_string())
+        })?;
+    Ok(Json(definitions))
+}
+
+/// POST /api/admin/definitions - Recreate a snapshot on this cluster
+async fn import_definitions(
+    State(state): State<Arc<ReconcileAppState>>,
+    headers: HeaderMap,
+    Query(query): Query<ImportQuery>,
+    Json(definitions): Json<StreamDefinitions>,
+) -> Result<Json<ImportReport>, ReconcileApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(ReconcileApiError::Unauthorized);
+    }
+    if query.mode != ImportMode::DryRun && !state.apply_enabled {
+        return Err(ReconcileApiError::ApplyDisabled);
+    }
+
+    let report = state
+        .reconciler
+        .import_definitions(&definitions, query.mode)
+        .await
+        .map_err(|e| {
+            if e.downcast_ref::<UnsupportedDefinitionsError>().is_some() {
+                return ReconcileApiError::InvalidDefinitions(e.to_string());
+            }
+            error!(error = %e, "Failed to import stream definitions");
+            ReconcileApiError::Failed(e.to_string())
+        })?;
+    Ok(Json(report))
+}
+
+/// Reconciliation API errors
+#[derive(Debug)]
+pub enum ReconcileApiError {
+    Unauthorized,
+    ApplyDisabled,
+    InvalidDefinitions(String),
+    Failed(String),
+}
+
+impl IntoResponse for ReconcileApiError {
+    fn into_response(self) -> Response {
+        let (status, error_message) = match self {
+            ReconcileApiError::Unauthorized => {
+                (StatusCode::UNAUTHORIZED, "Unauthorized".to_string())
+            }
+            ReconcileApiError::ApplyDisabled => (
+                StatusCode::FORBIDDEN,
+                "Applying is disabled; set nats.reconcile_apply = true".to_string(),
+            ),
+            ReconcileApiError::InvalidDefinitions(msg) => (StatusCode::BAD_REQUEST, msg),
+            ReconcileApiError::Failed(msg) => (StatusCode::INTERNAL_SERVER_ERROR, msg),
+        };
+
+        let body = Json(serde_json::json!({
+            "error": error_message,
+        }));
+
+        (status, body).into_response()
+    }
+}
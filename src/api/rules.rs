@@ -0,0 +1,127 @@
+use crate::api::admin::validate_admin_token;
+use crate::rules::{NewRule, Rule, RuleEngine, RuleError};
+use axum::{
+    extract::{Path, State},
+    http::{HeaderMap, StatusCode},
+    response::{IntoResponse, Json, Response},
+    routing::get,
+    Router,
+};
+use serde::Serialize;
+use std::sync::Arc;
+use tracing::info;
+
+/// Shared state for the derivation rule API
+#[derive(Clone)]
+pub struct RuleAppState {
+    pub engine: Arc<RuleEngine>,
+    /// Bearer token required for PUT/DELETE. None = unrestricted (dev mode).
+    pub admin_token: Option<String>,
+}
+
+#[derive(Serialize)]
+struct ListRulesResponse {
+    rules: Vec<Rule>,
+}
+
+/// Create derivation rule router
+pub fn create_rule_router(state: RuleAppState) -> Router {
+    Router::new()
+        .route("/api/rules", get(list_rules))
+        .route(
+            "/api/rules/:name",
+            get(get_rule).put(put_rule).delete(delete_rule),
+        )
+        .with_state(Arc::new(state))
+}
+
+/// GET /api/rules - List rules
+async fn list_rules(State(state): State<Arc<RuleAppState>>) -> Json<ListRulesResponse> {
+    Json(ListRulesResponse {
+        rules: state.engine.list().await,
+    })
+}
+
+/// GET /api/rules/:name - Look up a rule
+async fn get_rule(
+    State(state): State<Arc<RuleAppState>>,
+    Path(name): Path<String>,
+) -> Result<Json<Rule>, RuleApiError> {
+    state
+        .engine
+        .get(&name)
+        .await
+        .map(Json)
+        .ok_or(RuleApiError::Rules(RuleError::NotFound(name)))
+}
+
+/// PUT /api/rules/:name - Create or replace a rule
+async fn put_rule(
+    State(state): State<Arc<RuleAppState>>,
+    headers: HeaderMap,
+    Path(name): Path<String>,
+    Json(request): Json<NewRule>,
+) -> Result<Json<Rule>, RuleApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(RuleApiError::Unauthorized);
+    }
+
+    let rule = state.engine.put(request.named(name)).await?;
+    info!(
+        rule = %rule.name,
+        source_stream = %rule.source_stream,
+        destination_stream = %rule.destination_stream,
+        "Stored rule"
+    );
+    Ok(Json(rule))
+}
+
+/// DELETE /api/rules/:name - Stop and remove a rule
+async fn delete_rule(
+    State(state): State<Arc<RuleAppState>>,
+    headers: HeaderMap,
+    Path(name): Path<String>,
+) -> Result<StatusCode, RuleApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(RuleApiError::Unauthorized);
+    }
+
+    state.engine.delete(&name).await?;
+    info!(rule = %name, "Deleted rule");
+    Ok(StatusCode::NO_CONTENT)
+}
+
+/// Rule API errors
+#[derive(Debug)]
+pub enum RuleApiError {
+    Unauthorized,
+    Rules(RuleError),
+}
+
+impl From<RuleError> for RuleApiError {
+    fn from(e: RuleError) -> Self {
+        RuleApiError::Rules(e)
+    }
+}
+
+impl IntoResponse for RuleApiError {
+    fn into_response(self) -> Response {
+        let (status, error_message) = match self {
+            RuleApiError::Unauthorized => (StatusCode::UNAUTHORIZED, "Unauthorized".to_string()),
+            RuleApiError::Rules(e) => {
+                let status = match e {
+                    RuleError::InvalidRule(_) => StatusCode::BAD_REQUEST,
+                    RuleError::NotFound(_) => StatusCode::NOT_FOUND,
+                    RuleError::StoreFailed(_) => StatusCode::INTERNAL_SERVER_ERROR,
+                };
+                (status, e.to_string())
+            }
+        };
+
+        let body = Json(serde_json::json!({
+            "error": error_message,
+        }));
+
+        (status, body).into_response()
+    }
+}
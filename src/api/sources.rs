@@ -0,0 +1,121 @@
+use crate::api::admin::validate_admin_token;
+use crate::source::{NewSource, SourceError, SourceRecord, SourceRegistry};
+use axum::{
+    extract::{Path, State},
+    http::{HeaderMap, StatusCode},
+    response::{IntoResponse, Json, Response},
+    routing::get,
+    Router,
+};
+use serde::Serialize;
+use std::sync::Arc;
+use tracing::info;
+
+/// Shared state for source registry API
+#[derive(Clone)]
+pub struct SourceAppState {
+    pub registry: Arc<SourceRegistry>,
+    /// Bearer token required for POST/DELETE. None = unrestricted (dev mode).
+    pub admin_token: Option<String>,
+}
+
+#[derive(Serialize)]
+struct ListSourcesResponse {
+    sources: Vec<SourceRecord>,
+}
+
+/// Create source registry router
+pub fn create_source_router(state: SourceAppState) -> Router {
+    Router::new()
+        .route("/api/sources", get(list_sources).post(register_source))
+        .route(
+            "/api/sources/:source",
+            get(get_source).delete(deactivate_source),
+        )
+        .with_state(Arc::new(state))
+}
+
+/// GET /api/sources - List registered sources
+async fn list_sources(State(state): State<Arc<SourceAppState>>) -> Json<ListSourcesResponse> {
+    Json(ListSourcesResponse {
+        sources: state.registry.list(),
+    })
+}
+
+/// POST /api/sources - Register a source
+async fn register_source(
+    State(state): State<Arc<SourceAppState>>,
+    headers: HeaderMap,
+    Json(request): Json<NewSource>,
+) -> Result<(StatusCode, Json<SourceRecord>), SourceApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(SourceApiError::Unauthorized);
+    }
+
+    let record = state.registry.register(request).await?;
+    info!(source = %record.source, owner = %record.owner, "Registered source");
+    Ok((StatusCode::CREATED, Json(record)))
+}
+
+/// GET /api/sources/:source - Look up a source
+async fn get_source(
+    State(state): State<Arc<SourceAppState>>,
+    Path(source): Path<String>,
+) -> Result<Json<SourceRecord>, SourceApiError> {
+    state
+        .registry
+        .get(&source)
+        .map(Json)
+        .ok_or(SourceApiError::Registry(SourceError::NotFound(source)))
+}
+
+/// DELETE /api/sources/:source - Deactivate a source (record is kept)
+async fn deactivate_source(
+    State(state): State<Arc<SourceAppState>>,
+    headers: HeaderMap,
+    Path(source): Path<String>,
+) -> Result<Json<SourceRecord>, SourceApiError> {
+    if !validate_admin_token(&headers, &state.admin_token) {
+        return Err(SourceApiError::Unauthorized);
+    }
+
+    let record = state.registry.deactivate(&source).await?;
+    info!(source = %record.source, "Deactivated source");
+    Ok(Json(record))
+}
+
+/// Source API errors
+#[derive(Debug)]
+pub enum SourceApiError {
+    Unauthorized,
+    Registry(SourceError),
+}
+
+impl From<SourceError> for SourceApiError {
+    fn from(e: SourceError) -> Self {
+        SourceApiError::Registry(e)
+    }
+}
+
+impl IntoResponse for SourceApiError {
+    fn into_response(self) -> Response {
+        let (status, error_message) = match self {
+            SourceApiError::Unauthorized => (StatusCode::UNAUTHORIZED, "Unauthorized".to_string()),
+            SourceApiError::Registry(e) => {
+                let status = match e {
+                    SourceError::InvalidSource(_) => StatusCode::BAD_REQUEST,
+                    SourceError::AlreadyExists(_) => StatusCode::CONFLICT,
+                    SourceError::NotFound(_) => StatusCode::NOT_FOUND,
+                    SourceError::StoreFailed(_) => StatusCode::INTERNAL_SERVER_ERROR,
+                };
+                (status, e.to_string())
+            }
+        };
+
+        let body = Json(serde_json::json!({
+            "error": error_message,
+        }));
+
+        (status, body).into_response()
+    }
+}
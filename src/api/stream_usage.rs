@@ -0,0 +1,60 @@
+use crate::nats::{StreamUsage, StreamUsageMonitor};
+use axum::{
+    extract::{Path, State},
+    http::StatusCode,
+    response::{IntoResponse, Json, Response},
+    routing::get,
+    Router,
+};
+use serde::Serialize;
+use std::sync::Arc;
+
+/// Shared state for JetStream stream usage API
+#[derive(Clone)]
+pub struct StreamUsageAppState {
+    pub monitor: Arc<StreamUsageMonitor>,
+}
+
+#[derive(Serialize)]
+struct ListStreamUsageResponse {
+    streams: Vec<StreamUsage>,
+}
+
+#[derive(Serialize)]
+struct ErrorResponse {
+    error: String,
+}
+
+/// Create stream usage router
+pub fn create_stream_usage_router(state: StreamUsageAppState) -> Router {
+    Router::new()
+        .route("/api/metrics/streams", get(list_stream_usage))
+        .route("/api/metrics/streams/:name", get(get_stream_usage))
+        .with_state(Arc::new(state))
+}
+
+/// GET /api/metrics/streams - Usage of all JetStream streams (last poll)
+async fn list_stream_usage(
+    State(state): State<Arc<StreamUsageAppState>>,
+) -> Json<ListStreamUsageResponse> {
+    Json(ListStreamUsageResponse {
+        streams: state.monitor.list(),
+    })
+}
+
+/// GET /api/metrics/streams/:name - Current usage of one JetStream stream
+async fn get_stream_usage(
+    State(state): State<Arc<StreamUsageAppState>>,
+    Path(name): Path<String>,
+) -> Response {
+    match state.monitor.fetch(&name).await {
+        Ok(usage) => Json(usage).into_response(),
+        Err(_) => (
+            StatusCode::NOT_FOUND,
+            Json(ErrorResponse {
+                error: format!("stream '{}' not found", name),
+            }),
+        )
+            .into_response(),
+    }
+}
@@ -0,0 +1,228 @@
+use crate::nats::{
+    archived_at, list_streams_page, parse_label_selector, stream_page_etag,
+    InvalidContinuationError, StreamInfoCache, StreamListOptions, StreamPage,
+};
+use async_nats::jetstream;
+use axum::{
+    extract::{Path, Query, State},
+    http::{header, HeaderMap, HeaderValue, StatusCode},
+    response::{IntoResponse, Json, Response},
+    routing::get,
+    Router,
+};
+use serde::{Deserialize, Serialize};
+use std::collections::HashMap;
+use std::sync::Arc;
+use std::time::Duration;
+
+/// Shared state for the JetStream stream listing API
+#[derive(Clone)]
+pub struct StreamListAppState {
+    pub jetstream: jetstream::Context,
+    /// Serve repeated requests from here for `cache_ttl` (None = no caching)
+    pub cache: Option<StreamInfoCache>,
+    pub cache_ttl: Duration,
+}
+
+/// Query parameters for GET /api/streams
+#[derive(Debug, Deserialize)]
+pub struct ListStreamsParams {
+    /// Stream name prefix
+    pub prefix: Option<String>,
+    /// Metadata label selector, e.g. `env=prod,tier=edge`
+    pub labels: Option<String>,
+    /// Page size (default 50, max 500)
+    pub limit: Option<usize>,
+    /// Token from the previous page
+    pub continuation: Option<String>,
+}
+
+/// Stream summary returned by the API
+#[derive(Debug, Serialize)]
+pub struct StreamSummary {
+    pub name: String,
+    pub subjects: Vec<String>,
+    pub messages: u64,
+    pub bytes: u64,
+    pub last_sequence: u64,
+    /// Window in which JetStream drops repeated `Nats-Msg-Id`s
+    pub duplicate_window_seconds: u64,
+    pub labels: HashMap<String, String>,
+    /// When the stream was archived (RFC 3339); absent for live streams
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub archived_at: Option<String>,
+}
+
+impl StreamSummary {
+    fn from_info(info: &jetstream::stream::Info) -> Self {
+        Self {
+            name: info.config.name.clone(),
+            subjects: info.config.subjects.clone(),
+            messages: info.state.messages,
+            bytes: info.state.bytes,
+            last_sequence: info.state.last_sequence,
+            duplicate_window_seconds: info.config.duplicate_window.as_secs(),
+            labels: info.config.metadata.clone(),
+            archived_at: archived_at(&info.config).map(str::to_string),
+        }
+    }
+}
+
+#[derive(Serialize)]
+struct ListStreamsResponse {
+    streams: Vec<StreamSummary>,
+    /// Pass as `continuation` for the next page; null on the last page
+    continuation: Option<String>,
+}
+
+/// Create stream listing router
+pub fn create_stream_list_router(state: StreamListAppState) -> Router {
+    Router::new()
+        .route("/api/streams", get(list_streams))
+        .route("/api/streams/:stream", get(get_stream))
+        .with_state(Arc::new(state))
+}
+
+/// GET /api/streams?prefix=&labels=&limit=&continuation= - JetStream streams
+/// sorted by name, one page at a time
+async fn list_streams(
+    State(state): State<Arc<StreamListAppState>>,
+    headers: HeaderMap,
+    Query(params): Query<ListStreamsParams>,
+) -> Result<Response, StreamListApiError> {
+    let labels = match params.labels.as_deref() {
+        Some(selector) => parse_label_selector(selector).ok_or_else(|| {
+            StreamListApiError::BadRequest(format!(
+                "invalid label selector '{}' (expected key=value[,key=value])",
+                selector
+            ))
+        })?,
+        None => Vec::new(),
+    };
+    let options = StreamListOptions {
+        prefix: params.prefix,
+        labels,
+        page_size: params.limit.unwrap_or(0),
+        continuation: params.continuation,
+    };
+
+    let key = format!(
+        "list:{:?}:{:?}:{}:{:?}",
+        options.prefix, options.labels, options.page_size, options.continuation
+    );
+    let page = cached(&state, key, || async {
+        list_streams_page(&state.jetstream, &options)
+            .await
+            .map_err(|e| match e.downcast_ref::<InvalidContinuationError>() {
+                Some(invalid) => StreamListApiError::BadRequest(invalid.to_string()),
+                None => StreamListApiError::Nats(e.to_string()),
+            })
+    })
+    .await?;
+
+    Ok(with_etag(&headers, &page, || {
+        Json(ListStreamsResponse {
+            streams: page.streams.iter().map(StreamSummary::from_info).collect(),
+            continuation: page.continuation.clone(),
+        })
+        .into_response()
+    }))
+}
+
+/// GET /api/streams/:stream - One JetStream stream by name
+async fn get_stream(
+    State(state): State<Arc<StreamListAppState>>,
+    headers: HeaderMap,
+    Path(name): Path<String>,
+) -> Result<Response, StreamListApiError> {
+    let page = cached(&state, format!("stream:{}", name), || async {
+        let mut stream = state
+            .jetstream
+            .get_stream(&name)
+            .await
+            .map_err(|_| StreamListApiError::NotFound(name.clone()))?;
+        let info = stream
+            .info()
+            .await
+            .map_err(|e| StreamListApiError::Nats(e.to_string()))?
+            .clone();
+        Ok(StreamPage {
+            streams: vec![info],
+            continuation: None,
+        })
+    })
+    .await?;
+
+    Ok(with_etag(&headers, &page, || {
+        Json(StreamSummary::from_info(&page.streams[0])).into_response()
+    }))
+}
+
+/// The page cached under `key`, or `fetch` it (and cache it if caching is on).
+async fn cached<F, Fut>(
+    state: &StreamListAppState,
+    key: String,
+    fetch: F,
+) -> Result<Arc<StreamPage>, StreamListApiError>
+where
+    F: FnOnce() -> Fut,
+    Fut: std::future::Future<Output = Result<StreamPage, StreamListApiError>>,
+{
+    let Some(cache) = &state.cache else {
+        return Ok(Arc::new(fetch().await?));
+    };
+    if let Some(page) = cache.get(&key, state.cache_ttl) {
+        return Ok(page);
+    }
+    Ok(cache.insert(key, fetch().await?))
+}
+
+/// 304 if the client's `If-None-Match` matches the page's ETag, otherwise
+/// the response from `body`; both carry the ETag.
+fn with_etag(headers: &HeaderMap, page: &StreamPage, body: impl FnOnce() -> Response) -> Response {
+    let etag = stream_page_etag(page);
+    let not_modified = headers
+        .get(header::IF_NONE_MATCH)
+        .and_then(|value| value.to_str().ok())
+        .map_or(false, |value| {
+            value
+                .split(',')
+                .any(|candidate| candidate.trim() == "*" || candidate.trim() == etag)
+        });
+    let mut response = if not_modified {
+        StatusCode::NOT_MODIFIED.into_response()
+    } else {
+        body()
+    };
+    if let Ok(value) = HeaderValue::from_str(&etag) {
+        response.headers_mut().insert(header::ETAG, value);
+    }
+    response
+}
+
+/// Stream listing API errors
+#[derive(Debug)]
+pub enum StreamListApiError {
+    BadRequest(String),
+    NotFound(String),
+    Nats(String),
+}
+
+impl IntoResponse for StreamListApiError {
+    fn into_response(self) -> Response {
+        let (status, error_message) = match self {
+            StreamListApiError::BadRequest(msg) => (StatusCode::BAD_REQUEST, msg),
+            StreamListApiError::NotFound(name) => (
+                StatusCode::NOT_FOUND,
+                format!("stream '{}' not found", name),
+            ),
+            StreamListApiError::Nats(msg) => (StatusCode::INTERNAL_SERVER_ERROR, msg),
+        };
+
+        let body = Json(serde_json::json!({
+            "error": error_message,
+        }));
+
+        (status, body).into_response()
+    }
+}
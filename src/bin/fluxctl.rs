@@ -0,0 +1,24 @@
+//! `fluxctl`: command-line client for the Flux HTTP API (see `flux::ctl`).
+
+use flux::ctl::{self, CtlArgs, USAGE};
+use std::process::ExitCode;
+
+#[tokio::main]
+async fn main() -> ExitCode {
+    let args: Vec<String> = std::env::args().skip(1).collect();
+    if args.iter().any(|arg| arg == "--help" || arg == "-h") {
+        println!("{}", USAGE);
+        return ExitCode::SUCCESS;
+    }
+    let result = match CtlArgs::parse(&args, |name| std::env::var(name).ok()) {
+        Ok(args) => ctl::run(&args, &mut std::io::stdin(), &mut std::io::stdout()).await,
+        Err(e) => Err(e),
+    };
+    match result {
+        Ok(()) => ExitCode::SUCCESS,
+        Err(e) => {
+            eprintln!("fluxctl: {:#}", e);
+            ExitCode::FAILURE
+        }
+    }
+}
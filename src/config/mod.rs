@@ -1,11 +1,16 @@
+pub mod reload;
 pub mod runtime;
-pub use runtime::{new_runtime_config, RuntimeConfig, SharedRuntimeConfig};
+pub use reload::ConfigReloader;
+pub use runtime::{new_runtime_config, RuntimeConfig, RuntimeConfigUpdate, SharedRuntimeConfig};
 
+use crate::event::{SourceFormatMode, StreamNamingPolicy, ValidationOptions};
+use crate::nats::AdmissionConfig;
 use serde::Deserialize;
 
 // Re-export existing config types
 pub use crate::nats::NatsConfig;
 pub use crate::snapshot::config::SnapshotConfig;
+pub use crate::webhook::WebhookSettings;
 
 /// Complete Flux configuration
 #[derive(Debug, Clone, Deserialize)]
@@ -20,6 +25,11 @@ pub struct FluxConfig {
     pub metrics: MetricsConfig,
     #[serde(default)]
     pub api: ApiConfig,
+    /// Initial runtime limits (overridden by FLUX_* env vars, re-read on reload)
+    #[serde(default)]
+    pub limits: RuntimeConfigUpdate,
+    #[serde(default)]
+    pub webhooks: WebhookSettings,
 }
 
 /// Recovery configuration
@@ -75,16 +85,105 @@ pub struct ApiConfig {
     /// Maximum entities allowed in batch delete operation
     #[serde(default = "default_max_batch_delete")]
     pub max_batch_delete: usize,
+    /// Reject events whose source is not active in the source registry
+    #[serde(default)]
+    pub require_registered_source: bool,
+    /// Accepted event sources, exact or glob (`*`, `?`); empty accepts any
+    #[serde(default)]
+    pub allowed_sources: Vec<String>,
+    /// Longest accepted event source in bytes (None = unlimited)
+    #[serde(default)]
+    pub max_source_length: Option<usize>,
+    /// Source format enforcement: "off" (default), "lenient" (normalize,
+    /// then require the format) or "strict"
+    #[serde(default)]
+    pub source_format: SourceFormatMode,
+    /// Reject events timestamped further than this from now, either way
+    /// (None = no check)
+    #[serde(default)]
+    pub max_timestamp_skew_seconds: Option<u64>,
+    /// Stream prefixes external producers may not publish to
+    #[serde(default = "default_reserved_stream_prefixes")]
+    pub reserved_stream_prefixes: Vec<String>,
+    /// Glob every published stream must match (None = any valid name)
+    #[serde(default)]
+    pub stream_name_pattern: Option<String>,
+    /// Exact number of segments every published stream must have
+    #[serde(default)]
+    pub stream_name_segments: Option<usize>,
+    /// How long GET /api/streams responses are served from cache (0 = off)
+    #[serde(default = "default_stream_cache_ttl")]
+    pub stream_cache_ttl_ms: u64,
+    /// GET /healthz reports "degraded" when a consumer lags by more messages
+    #[serde(default = "default_health_lag_threshold")]
+    pub health_lag_threshold: u64,
+    /// Stamped in the `x-flux-instance` header of every published event
+    /// (None = `HOSTNAME`, or "flux")
+    #[serde(default)]
+    pub instance_id: Option<String>,
+    /// Also write the receive time into each event's `receivedAt` field
+    #[serde(default)]
+    pub embed_received_at: bool,
+    /// Limit concurrent publishes from the HTTP API and NATS service, shedding
+    /// load with 503 once the queue is full (None = unlimited)
+    #[serde(default)]
+    pub admission: Option<AdmissionConfig>,
 }
 
 fn default_max_batch_delete() -> usize {
     10000
 }
 
+fn default_reserved_stream_prefixes() -> Vec<String> {
+    vec![crate::event::RESERVED_STREAM_PREFIX.to_string()]
+}
+
+fn default_stream_cache_ttl() -> u64 {
+    2000
+}
+
+fn default_health_lag_threshold() -> u64 {
+    crate::api::health::DEFAULT_LAG_THRESHOLD
+}
+
+impl ApiConfig {
+    /// Source and stream naming policies for published events.
+    pub fn validation_options(&self) -> ValidationOptions {
+        let max_skew = self
+            .max_timestamp_skew_seconds
+            .map(std::time::Duration::from_secs);
+        ValidationOptions {
+            allowed_sources: self.allowed_sources.clone(),
+            max_source_length: self.max_source_length,
+            source_format: self.source_format,
+            max_timestamp_skew_backward: max_skew,
+            max_timestamp_skew_forward: max_skew,
+            stream_naming: StreamNamingPolicy {
+                reserved_prefixes: self.reserved_stream_prefixes.clone(),
+                pattern: self.stream_name_pattern.clone(),
+                segments: self.stream_name_segments,
+            },
+        }
+    }
+}
+
 impl Default for ApiConfig {
     fn default() -> Self {
         Self {
             max_batch_delete: default_max_batch_delete(),
+            require_registered_source: false,
+            allowed_sources: Vec::new(),
+            max_source_length: None,
+            source_format: SourceFormatMode::Off,
+            max_timestamp_skew_seconds: None,
+            reserved_stream_prefixes: default_reserved_stream_prefixes(),
+            stream_name_pattern: None,
+            stream_name_segments: None,
+            stream_cache_ttl_ms: default_stream_cache_ttl(),
+            health_lag_threshold: default_health_lag_threshold(),
+            instance_id: None,
+            embed_received_at: false,
+            admission: None,
         }
     }
 }
@@ -97,6 +196,8 @@ impl Default for FluxConfig {
             recovery: RecoveryConfig::default(),
             metrics: MetricsConfig::default(),
             api: ApiConfig::default(),
+            limits: RuntimeConfigUpdate::default(),
+            webhooks: WebhookSettings::default(),
         }
     }
 }
@@ -0,0 +1,168 @@
+use super::{load_config, RuntimeConfig, SharedRuntimeConfig};
+use crate::event::SharedValidationOptions;
+use std::sync::Arc;
+use tracing::{error, info};
+
+/// Re-reads the config file and swaps in new runtime limits and, with
+/// `with_validation`, the source and stream naming policies (`[api]`
+/// `allowed_sources`, `max_source_length`, `source_format`,
+/// `max_timestamp_skew_seconds`, `reserved_stream_prefixes`,
+/// `stream_name_pattern`, `stream_name_segments`).
+///
+/// The NATS connection and stream definitions are left untouched. Namespace
+/// tokens are not part of the config file: they are registered at runtime
+/// through /api/namespaces and take effect without a reload. The admin token
+/// comes from `FLUX_ADMIN_TOKEN` and needs a restart. Note that a reload
+/// replaces any changes made via PUT /api/admin/config.
+pub struct ConfigReloader {
+    path: String,
+    runtime_config: SharedRuntimeConfig,
+    validation: Option<SharedValidationOptions>,
+}
+
+impl ConfigReloader {
+    pub fn new(path: impl Into<String>, runtime_config: SharedRuntimeConfig) -> Self {
+        Self {
+            path: path.into(),
+            runtime_config,
+            validation: None,
+        }
+    }
+
+    /// Also reload the source and naming policies into `validation` (the
+    /// options given to `EventPublisher::with_shared_validation`).
+    pub fn with_validation(mut self, validation: SharedValidationOptions) -> Self {
+        self.validation = Some(validation);
+        self
+    }
+
+    /// Load and validate the config file, then swap it in.
+    ///
+    /// On any error the current config is kept and the error returned.
+    pub fn reload(&self) -> Result<RuntimeConfig, String> {
+        let file = load_config(&self.path)
+            .map_err(|e| format!("failed to load config '{}': {}", self.path, e))?;
+        let next = RuntimeConfig::from_file_and_env(&file.limits);
+        next.validate()
+            .map_err(|e| format!("invalid config '{}': {}", self.path, e))?;
+        let next_validation = file.api.validation_options();
+
+        // Swap both while holding both write locks: requests see either the
+        // old or the new limits and policies. Requests already past a check
+        // finish under the config they read.
+        let mut runtime_config = self
+            .runtime_config
+            .write()
+            .expect("RuntimeConfig lock poisoned");
+        if let Some(validation) = &self.validation {
+            *validation.write().expect("ValidationOptions lock poisoned") = next_validation;
+        }
+        *runtime_config = next.clone();
+        drop(runtime_config);
+
+        info!(path = %self.path, "Runtime config reloaded");
+        Ok(next)
+    }
+
+    /// Reload on every SIGHUP until the process exits.
+    #[cfg(unix)]
+    pub async fn run_sighup_listener(self: Arc<Self>) {
+        use tokio::signal::unix::{signal, SignalKind};
+
+        let mut hangup = match signal(SignalKind::hangup()) {
+            Ok(s) => s,
+            Err(e) => {
+                error!(error = %e, "Failed to install SIGHUP handler");
+                return;
+            }
+        };
+
+        while hangup.recv().await.is_some() {
+            info!("SIGHUP received, reloading config");
+            if let Err(e) = self.reload() {
+                error!(error = %e, "Config reload rejected, keeping current config");
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::RwLock;
+
+    fn write_config(dir: &std::path::Path, contents: &str) -> String {
+        let path = dir.join("config.toml");
+        std::fs::write(&path, contents).unwrap();
+        path.to_string_lossy().to_string()
+    }
+
+    #[test]
+    fn test_reload_swaps_limits() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = write_config(
+            dir.path(),
+            "[limits]\nrate_limit_per_namespace_per_minute = 42\n",
+        );
+        let shared = Arc::new(RwLock::new(RuntimeConfig::default()));
+        let reloader = ConfigReloader::new(path, Arc::clone(&shared));
+
+        let applied = reloader.reload().unwrap();
+        assert_eq!(applied.rate_limit_per_namespace_per_minute, 42);
+        assert_eq!(
+            shared.read().unwrap().rate_limit_per_namespace_per_minute,
+            42
+        );
+    }
+
+    #[test]
+    fn test_reload_swaps_policies_with_limits() {
+        let dir = tempfile::tempdir().unwrap();
+        let path = write_config(
+            dir.path(),
+            "[limits]\nrate_limit_per_namespace_per_minute = 42\n\n\
+             [api]\nallowed_sources = [\"plant-*\"]\nstream_name_segments = 2\n",
+        );
+        let shared = Arc::new(RwLock::new(RuntimeConfig::default()));
+        let validation = SharedValidationOptions::default();
+        let reloader =
+            ConfigReloader::new(path, Arc::clone(&shared)).with_validation(Arc::clone(&validation));
+
+        reloader.reload().unwrap();
+        let options = validation.read().unwrap();
+        assert_eq!(options.allowed_sources, vec!["plant-*".to_string()]);
+        assert_eq!(options.stream_naming.segments, Some(2));
+        assert_eq!(
+            shared.read().unwrap().rate_limit_per_namespace_per_minute,
+            42
+        );
+    }
+
+    #[test]
+    fn test_invalid_config_keeps_current() {
+        let dir = tempfile::tempdir().unwrap();
+        let shared = Arc::new(RwLock::new(RuntimeConfig::default()));
+
+        let validation = SharedValidationOptions::default();
+
+        let path = write_config(
+            dir.path(),
+            "[limits]\nrate_limit_per_namespace_per_minute = 0\n\n\
+             [api]\nallowed_sources = [\"plant-*\"]\n",
+        );
+        let reloader =
+            ConfigReloader::new(path, Arc::clone(&shared)).with_validation(Arc::clone(&validation));
+        assert!(reloader.reload().is_err());
+        // Policies are not applied from a file with invalid limits
+        assert!(validation.read().unwrap().allowed_sources.is_empty());
+
+        let path = write_config(dir.path(), "[limits\nnot toml");
+        let reloader = ConfigReloader::new(path, Arc::clone(&shared));
+        assert!(reloader.reload().is_err());
+
+        assert_eq!(
+            shared.read().unwrap().rate_limit_per_namespace_per_minute,
+            RuntimeConfig::default().rate_limit_per_namespace_per_minute
+        );
+    }
+}
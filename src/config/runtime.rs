@@ -7,25 +7,97 @@ use std::sync::{Arc, RwLock};
 pub struct RuntimeConfig {
     pub rate_limit_enabled: bool,
     pub rate_limit_per_namespace_per_minute: u64,
+    /// Separate per-namespace budget for critical-priority events
+    #[serde(default = "default_rate_limit_critical")]
+    pub rate_limit_critical_per_namespace_per_minute: u64,
     pub body_size_limit_single_bytes: usize,
     pub body_size_limit_batch_bytes: usize,
 }
 
+fn default_rate_limit_critical() -> u64 {
+    1_000
+}
+
 impl Default for RuntimeConfig {
     fn default() -> Self {
         Self {
             rate_limit_enabled: true,
             rate_limit_per_namespace_per_minute: 10_000,
+            rate_limit_critical_per_namespace_per_minute: default_rate_limit_critical(),
             body_size_limit_single_bytes: 1_048_576,   // 1 MB
             body_size_limit_batch_bytes: 10_485_760,   // 10 MB
         }
     }
 }
 
+/// Partial update — only fields that are set are changed.
+///
+/// Used for PUT /api/admin/config bodies and the `[limits]` section of config.toml.
+#[derive(Debug, Clone, Default, Deserialize)]
+pub struct RuntimeConfigUpdate {
+    pub rate_limit_enabled: Option<bool>,
+    pub rate_limit_per_namespace_per_minute: Option<u64>,
+    pub rate_limit_critical_per_namespace_per_minute: Option<u64>,
+    pub body_size_limit_single_bytes: Option<usize>,
+    pub body_size_limit_batch_bytes: Option<usize>,
+}
+
 impl RuntimeConfig {
     /// Build from env vars, falling back to defaults.
     pub fn from_env() -> Self {
+        Self::default().with_env_overrides()
+    }
+
+    /// Build from defaults, then the config file `[limits]` section, then env vars.
+    pub fn from_file_and_env(limits: &RuntimeConfigUpdate) -> Self {
         let mut cfg = Self::default();
+        cfg.apply(limits);
+        cfg.with_env_overrides()
+    }
+
+    /// Apply the fields set in `update`.
+    pub fn apply(&mut self, update: &RuntimeConfigUpdate) {
+        if let Some(v) = update.rate_limit_enabled {
+            self.rate_limit_enabled = v;
+        }
+        if let Some(v) = update.rate_limit_per_namespace_per_minute {
+            self.rate_limit_per_namespace_per_minute = v;
+        }
+        if let Some(v) = update.rate_limit_critical_per_namespace_per_minute {
+            self.rate_limit_critical_per_namespace_per_minute = v;
+        }
+        if let Some(v) = update.body_size_limit_single_bytes {
+            self.body_size_limit_single_bytes = v;
+        }
+        if let Some(v) = update.body_size_limit_batch_bytes {
+            self.body_size_limit_batch_bytes = v;
+        }
+    }
+
+    /// Reject limits that would block all traffic or contradict each other.
+    pub fn validate(&self) -> Result<(), String> {
+        if self.rate_limit_per_namespace_per_minute == 0 {
+            return Err("rate_limit_per_namespace_per_minute must be greater than 0".to_string());
+        }
+        if self.rate_limit_critical_per_namespace_per_minute == 0 {
+            return Err(
+                "rate_limit_critical_per_namespace_per_minute must be greater than 0".to_string(),
+            );
+        }
+        if self.body_size_limit_single_bytes == 0 || self.body_size_limit_batch_bytes == 0 {
+            return Err("body size limits must be greater than 0".to_string());
+        }
+        if self.body_size_limit_single_bytes > self.body_size_limit_batch_bytes {
+            return Err(
+                "body_size_limit_single_bytes must not exceed body_size_limit_batch_bytes"
+                    .to_string(),
+            );
+        }
+        Ok(())
+    }
+
+    fn with_env_overrides(self) -> Self {
+        let mut cfg = self;
 
         if let Ok(v) = std::env::var("FLUX_RATE_LIMIT_ENABLED") {
             if let Ok(b) = v.parse::<bool>() {
@@ -37,6 +109,11 @@ impl RuntimeConfig {
                 cfg.rate_limit_per_namespace_per_minute = n;
             }
         }
+        if let Ok(v) = std::env::var("FLUX_RATE_LIMIT_CRITICAL_PER_NAMESPACE_PER_MINUTE") {
+            if let Ok(n) = v.parse::<u64>() {
+                cfg.rate_limit_critical_per_namespace_per_minute = n;
+            }
+        }
         if let Ok(v) = std::env::var("FLUX_BODY_SIZE_LIMIT_SINGLE_BYTES") {
             if let Ok(n) = v.parse::<usize>() {
                 cfg.body_size_limit_single_bytes = n;
@@ -57,3 +134,35 @@ pub type SharedRuntimeConfig = Arc<RwLock<RuntimeConfig>>;
 pub fn new_runtime_config() -> SharedRuntimeConfig {
     Arc::new(RwLock::new(RuntimeConfig::from_env()))
 }
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_apply_only_changes_set_fields() {
+        let mut cfg = RuntimeConfig::default();
+        cfg.apply(&RuntimeConfigUpdate {
+            rate_limit_per_namespace_per_minute: Some(50),
+            ..Default::default()
+        });
+        assert_eq!(cfg.rate_limit_per_namespace_per_minute, 50);
+        assert_eq!(
+            cfg.body_size_limit_single_bytes,
+            RuntimeConfig::default().body_size_limit_single_bytes
+        );
+    }
+
+    #[test]
+    fn test_validate() {
+        assert!(RuntimeConfig::default().validate().is_ok());
+
+        let mut cfg = RuntimeConfig::default();
+        cfg.rate_limit_per_namespace_per_minute = 0;
+        assert!(cfg.validate().is_err());
+
+        let mut cfg = RuntimeConfig::default();
+        cfg.body_size_limit_single_bytes = cfg.body_size_limit_batch_bytes + 1;
+        assert!(cfg.validate().is_err());
+    }
+}
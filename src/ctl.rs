@@ -0,0 +1,555 @@
+//! `fluxctl`: operator commands against a running Flux server's HTTP API,
+//! printed as tables (or the raw JSON with `--output json`).
+//!
+//! ```text
+//! fluxctl --server http://localhost:3000 streams list
+//! fluxctl publish --stream sensors --source cli --file reading.json
+//! ```
+
+use crate::event::FluxEvent;
+use anyhow::{anyhow, bail, Context, Result};
+use serde_json::Value;
+use std::fmt;
+use std::io::{Read, Write};
+
+/// Server used when neither `--server` nor `FLUX_SERVER` is set
+pub const DEFAULT_SERVER: &str = "http://localhost:3000";
+
+/// How responses are printed.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum OutputFormat {
+    Table,
+    Json,
+}
+
+/// A `fluxctl` subcommand.
+#[derive(Debug, Clone, PartialEq)]
+pub enum Command {
+    /// `streams list [--prefix P]`
+    StreamsList { prefix: Option<String> },
+    /// `streams info NAME`
+    StreamsInfo { name: String },
+    /// `publish --stream S --source SRC [--key K] [--file PATH]`; the payload
+    /// is read from PATH, or stdin without `--file`
+    Publish {
+        stream: String,
+        source: String,
+        key: Option<String>,
+        file: Option<String>,
+    },
+    /// `events get EVENT_ID`
+    EventsGet { event_id: String },
+    /// `consumers list STREAM`
+    ConsumersList { stream: String },
+    /// `consumers lag STREAM`
+    ConsumersLag { stream: String },
+    /// `definitions export [--consumers true]`; prints the document as JSON
+    DefinitionsExport { consumers: bool },
+    /// `definitions import [--mode M] [--file PATH]`; the document is read
+    /// from PATH, or stdin without `--file`
+    DefinitionsImport { mode: String, file: Option<String> },
+}
+
+/// Parsed `fluxctl` command line.
+#[derive(Debug, Clone, PartialEq)]
+pub struct CtlArgs {
+    /// Base URL of the Flux HTTP API
+    pub server: String,
+    /// Sent as a bearer token
+    pub api_key: Option<String>,
+    pub output: OutputFormat,
+    pub command: Command,
+}
+
+/// Usage text printed for `fluxctl --help` and bad command lines
+pub const USAGE: &str = "\
+usage: fluxctl [--server URL] [--api-key KEY] [--output table|json] <command>
+
+commands:
+  streams list [--prefix P]
+  streams info NAME
+  publish --stream S --source SRC [--key K] [--file PATH]   (payload from stdin without --file)
+  events get EVENT_ID
+  consumers list STREAM
+  consumers lag STREAM
+  definitions export [--consumers true]   (prints the document)
+  definitions import [--mode dry_run|create_only|reconcile] [--file PATH]
+
+--server and --api-key default to FLUX_SERVER and FLUX_API_KEY.";
+
+impl CtlArgs {
+    /// Parse the arguments after the program name. `env` looks up
+    /// `FLUX_SERVER` and `FLUX_API_KEY` for flags not given.
+    pub fn parse<I, S>(args: I, env: impl Fn(&str) -> Option<String>) -> Result<Self>
+    where
+        I: IntoIterator<Item = S>,
+        S: AsRef<str>,
+    {
+        let mut server = env("FLUX_SERVER");
+        let mut api_key = env("FLUX_API_KEY");
+        let mut output = OutputFormat::Table;
+        let (mut prefix, mut stream, mut source, mut key, mut file) =
+            (None, None, None, None, None);
+        let (mut consumers, mut mode) = (false, None);
+        let mut words = Vec::new();
+
+        let mut args = args.into_iter();
+        while let Some(arg) = args.next() {
+            let arg = arg.as_ref().to_string();
+            if !arg.starts_with("--") {
+                words.push(arg);
+                continue;
+            }
+            let value = args
+                .next()
+                .map(|value| value.as_ref().to_string())
+                .ok_or_else(|| anyhow!("missing value for {}", arg))?;
+            match arg.as_str() {
+                "--server" => server = Some(value),
+                "--api-key" => api_key = Some(value),
+                "--output" => {
+                    output = match value.as_str() {
+                        "table" => OutputFormat::Table,
+                        "json" => OutputFormat::Json,
+                        _ => bail!("--output must be table or json, got '{}'", value),
+                    }
+                }
+                "--prefix" => prefix = Some(value),
+                "--stream" => stream = Some(value),
+                "--source" => source = Some(value),
+                "--key" => key = Some(value),
+                "--file" => file = Some(value),
+                "--consumers" => {
+                    consumers = value
+                        .parse()
+                        .map_err(|_| anyhow!("--consumers must be true or false"))?
+                }
+                "--mode" => mode = Some(value),
+                _ => bail!("unknown flag '{}'", arg),
+            }
+        }
+
+        let words: Vec<&str> = words.iter().map(String::as_str).collect();
+        let command = match words.as_slice() {
+            ["streams", "list"] => Command::StreamsList { prefix },
+            ["streams", "info", name] => Command::StreamsInfo {
+                name: name.to_string(),
+            },
+            ["publish"] => Command::Publish {
+                stream: stream.ok_or_else(|| anyhow!("publish requires --stream"))?,
+                source: source.ok_or_else(|| anyhow!("publish requires --source"))?,
+                key,
+                file,
+            },
+            ["events", "get", event_id] => Command::EventsGet {
+                event_id: event_id.to_string(),
+            },
+            ["consumers", "list", stream] => Command::ConsumersList {
+                stream: stream.to_string(),
+            },
+            ["consumers", "lag", stream] => Command::ConsumersLag {
+                stream: stream.to_string(),
+            },
+            ["definitions", "export"] => Command::DefinitionsExport { consumers },
+            ["definitions", "import"] => {
+                let mode = mode.unwrap_or_else(|| "dry_run".to_string());
+                if !["dry_run", "create_only", "reconcile"].contains(&mode.as_str()) {
+                    bail!(
+                        "--mode must be dry_run, create_only or reconcile, got '{}'",
+                        mode
+                    );
+                }
+                Command::DefinitionsImport { mode, file }
+            }
+            [] => bail!("missing command\n\n{}", USAGE),
+            _ => bail!("unknown command '{}'\n\n{}", words.join(" "), USAGE),
+        };
+
+        Ok(Self {
+            server: server
+                .unwrap_or_else(|| DEFAULT_SERVER.to_string())
+                .trim_end_matches('/')
+                .to_string(),
+            api_key,
+            output,
+            command,
+        })
+    }
+}
+
+/// Non-2xx response from the API, with the validation details Flux adds to
+/// rejected events.
+#[derive(Debug, Clone, PartialEq)]
+pub struct ApiError {
+    pub status: u16,
+    pub message: String,
+    /// `ValidationErrorCode` string, e.g. `invalid_format`
+    pub code: Option<String>,
+    /// Offending event field, e.g. `stream`
+    pub field: Option<String>,
+}
+
+impl ApiError {
+    fn from_body(status: u16, body: &str) -> Self {
+        let json: Value = serde_json::from_str(body).unwrap_or(Value::Null);
+        let text = |name: &str| json.get(name).and_then(Value::as_str).map(str::to_string);
+        Self {
+            status,
+            message: text("error").unwrap_or_else(|| body.trim().to_string()),
+            code: text("code"),
+            field: text("field"),
+        }
+    }
+}
+
+impl fmt::Display for ApiError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "HTTP {}: {}", self.status, self.message)?;
+        match (&self.field, &self.code) {
+            (Some(field), Some(code)) => write!(f, " (field '{}', code {})", field, code),
+            (None, Some(code)) => write!(f, " (code {})", code),
+            _ => Ok(()),
+        }
+    }
+}
+
+impl std::error::Error for ApiError {}
+
+/// Run `args.command`, reading a publish payload from `stdin` when no file
+/// is given and printing the result to `out`.
+pub async fn run(args: &CtlArgs, stdin: &mut dyn Read, out: &mut dyn Write) -> Result<()> {
+    let api = Api {
+        client: reqwest::Client::new(),
+        args,
+    };
+    let response = match &args.command {
+        Command::StreamsList { prefix } => {
+            let query: Vec<(&str, &str)> = prefix
+                .iter()
+                .map(|prefix| ("prefix", prefix.as_str()))
+                .collect();
+            api.send(api.get("/api/streams").query(&query)).await?
+        }
+        Command::StreamsInfo { name } => {
+            api.send(api.get(&format!("/api/streams/{}", name))).await?
+        }
+        Command::Publish {
+            stream,
+            source,
+            key,
+            file,
+        } => {
+            let payload = read_input(file.as_deref(), stdin)?;
+            // Validation is left to the server so its error details are shown
+            let event = FluxEvent {
+                event_id: None,
+                stream: stream.clone(),
+                source: source.clone(),
+                timestamp: chrono::Utc::now().timestamp_millis(),
+                key: key.clone(),
+                schema: None,
+                priority: None,
+                envelope_version: None,
+                received_at: None,
+                ttl_ms: None,
+                correlation_id: None,
+                parent_event_id: None,
+                payload: serde_json::from_str(&payload).context("payload is not valid JSON")?,
+                raw_payload: None,
+            };
+            api.send(api.client.post(api.url("/api/events")).json(&event))
+                .await?
+        }
+        Command::EventsGet { event_id } => {
+            api.send(api.get(&format!("/api/events/{}", event_id)))
+                .await?
+        }
+        Command::ConsumersList { stream } | Command::ConsumersLag { stream } => {
+            api.send(api.get(&format!("/api/streams/{}/consumers", stream)))
+                .await?
+        }
+        Command::DefinitionsExport { consumers } => {
+            let query = [("consumers", consumers.to_string())];
+            api.send(api.get("/api/admin/definitions").query(&query))
+                .await?
+        }
+        Command::DefinitionsImport { mode, file } => {
+            let document: Value = serde_json::from_str(&read_input(file.as_deref(), stdin)?)
+                .context("definitions are not valid JSON")?;
+            let request = api
+                .client
+                .post(api.url("/api/admin/definitions"))
+                .query(&[("mode", mode)])
+                .json(&document);
+            api.send(request).await?
+        }
+    };
+
+    match args.output {
+        OutputFormat::Json => writeln!(out, "{}", serde_json::to_string_pretty(&response)?)?,
+        OutputFormat::Table => render_table(&args.command, &response, out)?,
+    }
+    Ok(())
+}
+
+/// Contents of `file`, or all of `stdin` without one.
+fn read_input(file: Option<&str>, stdin: &mut dyn Read) -> Result<String> {
+    match file {
+        Some(path) => {
+            std::fs::read_to_string(path).with_context(|| format!("failed to read '{}'", path))
+        }
+        None => {
+            let mut input = String::new();
+            stdin
+                .read_to_string(&mut input)
+                .context("failed to read stdin")?;
+            Ok(input)
+        }
+    }
+}
+
+struct Api<'a> {
+    client: reqwest::Client,
+    args: &'a CtlArgs,
+}
+
+impl Api<'_> {
+    fn url(&self, path: &str) -> String {
+        format!("{}{}", self.args.server, path)
+    }
+
+    fn get(&self, path: &str) -> reqwest::RequestBuilder {
+        self.client.get(self.url(path))
+    }
+
+    /// Send `request` with the API key, failing with `ApiError` on non-2xx.
+    async fn send(&self, request: reqwest::RequestBuilder) -> Result<Value> {
+        let request = match &self.args.api_key {
+            Some(key) => request.bearer_auth(key),
+            None => request,
+        };
+        let response = request
+            .send()
+            .await
+            .with_context(|| format!("failed to reach {}", self.args.server))?;
+        let status = response.status();
+        let body = response.text().await.context("failed to read response")?;
+        if !status.is_success() {
+            return Err(ApiError::from_body(status.as_u16(), &body).into());
+        }
+        serde_json::from_str(&body).context("response is not JSON")
+    }
+}
+
+fn render_table(command: &Command, response: &Value, out: &mut dyn Write) -> Result<()> {
+    let field = |value: &Value, name: &str| match value.get(name) {
+        Some(Value::String(text)) => text.clone(),
+        Some(Value::Null) | None => String::new(),
+        Some(other) => other.to_string(),
+    };
+    let items = |name: &str| {
+        response
+            .get(name)
+            .and_then(Value::as_array)
+            .cloned()
+            .unwrap_or_default()
+    };
+    let rows = |items: &[Value], columns: &[&str]| -> Vec<Vec<String>> {
+        items
+            .iter()
+            .map(|item| columns.iter().map(|column| field(item, column)).collect())
+            .collect()
+    };
+
+    match command {
+        Command::StreamsList { .. } => {
+            let columns = ["name", "messages", "bytes", "last_sequence"];
+            write_table(out, &columns, &rows(&items("streams"), &columns))?;
+            if let Some(token) = response.get("continuation").and_then(Value::as_str) {
+                writeln!(out, "more streams: continuation {}", token)?;
+            }
+        }
+        Command::StreamsInfo { .. } => {
+            let subjects = response
+                .get("subjects")
+                .and_then(Value::as_array)
+                .map(|subjects| {
+                    subjects
+                        .iter()
+                        .filter_map(Value::as_str)
+                        .collect::<Vec<_>>()
+                        .join(", ")
+                })
+                .unwrap_or_default();
+            let rows = vec![
+                vec!["name".to_string(), field(response, "name")],
+                vec!["subjects".to_string(), subjects],
+                vec!["messages".to_string(), field(response, "messages")],
+                vec!["bytes".to_string(), field(response, "bytes")],
+                vec![
+                    "last_sequence".to_string(),
+                    field(response, "last_sequence"),
+                ],
+            ];
+            write_table(out, &["field", "value"], &rows)?;
+        }
+        Command::Publish { .. } => writeln!(
+            out,
+            "published {} to {}",
+            field(response, "eventId"),
+            field(response, "stream")
+        )?,
+        Command::EventsGet { .. } => {
+            let event = response.get("event").cloned().unwrap_or_default();
+            let mut rows: Vec<Vec<String>> = ["eventId", "stream", "source", "timestamp", "key"]
+                .iter()
+                .map(|name| vec![name.to_string(), field(&event, name)])
+                .collect();
+            for name in ["subject", "sequence", "stored_at"] {
+                rows.push(vec![name.to_string(), field(response, name)]);
+            }
+            write_table(out, &["field", "value"], &rows)?;
+            let payload = event.get("payload").cloned().unwrap_or_default();
+            writeln!(out, "{}", serde_json::to_string_pretty(&payload)?)?;
+        }
+        Command::ConsumersList { .. } => {
+            let columns = [
+                "name",
+                "filter_subject",
+                "ack_policy",
+                "deliver_policy",
+                "members",
+            ];
+            write_table(out, &columns, &rows(&items("consumers"), &columns))?;
+        }
+        Command::ConsumersLag { .. } => {
+            let columns = ["name", "num_pending", "num_ack_pending", "num_redelivered"];
+            write_table(out, &columns, &rows(&items("consumers"), &columns))?;
+        }
+        Command::DefinitionsExport { .. } => {
+            writeln!(out, "{}", serde_json::to_string_pretty(response)?)?
+        }
+        Command::DefinitionsImport { .. } => {
+            let columns = ["stream", "status", "error"];
+            write_table(out, &columns, &rows(&items("results"), &columns))?;
+        }
+    }
+    Ok(())
+}
+
+/// Left-aligned columns separated by two spaces, headers upper-cased.
+fn write_table(out: &mut dyn Write, headers: &[&str], rows: &[Vec<String>]) -> Result<()> {
+    let headers: Vec<String> = headers.iter().map(|header| header.to_uppercase()).collect();
+    let widths: Vec<usize> = (0..headers.len())
+        .map(|i| {
+            rows.iter()
+                .map(|row| row[i].len())
+                .chain([headers[i].len()])
+                .max()
+                .unwrap_or_default()
+        })
+        .collect();
+    for row in std::iter::once(&headers).chain(rows) {
+        let cells: Vec<String> = row
+            .iter()
+            .zip(&widths)
+            .map(|(cell, width)| format!("{:<width$}", cell, width = width))
+            .collect();
+        writeln!(out, "{}", cells.join("  ").trim_end())?;
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn parse(args: &[&str]) -> Result<CtlArgs> {
+        CtlArgs::parse(args, |_| None)
+    }
+
+    #[test]
+    fn test_parse_flags_and_commands() {
+        let args = parse(&["--output", "json", "consumers", "lag", "sensors"]).unwrap();
+        assert_eq!(args.server, DEFAULT_SERVER);
+        assert_eq!(args.output, OutputFormat::Json);
+        assert_eq!(
+            args.command,
+            Command::ConsumersLag {
+                stream: "sensors".to_string()
+            }
+        );
+
+        let args = parse(&["publish", "--stream", "sensors", "--source", "cli"]).unwrap();
+        assert_eq!(
+            args.command,
+            Command::Publish {
+                stream: "sensors".to_string(),
+                source: "cli".to_string(),
+                key: None,
+                file: None,
+            }
+        );
+
+        let args = parse(&["definitions", "import", "--file", "defs.json"]).unwrap();
+        assert_eq!(
+            args.command,
+            Command::DefinitionsImport {
+                mode: "dry_run".to_string(),
+                file: Some("defs.json".to_string()),
+            }
+        );
+        let args = parse(&["definitions", "export", "--consumers", "true"]).unwrap();
+        assert_eq!(args.command, Command::DefinitionsExport { consumers: true });
+
+        assert!(parse(&["publish", "--stream", "sensors"]).is_err());
+        assert!(parse(&["definitions", "import", "--mode", "replace"]).is_err());
+        assert!(parse(&["streams", "drop"]).is_err());
+        assert!(parse(&["--output", "yaml", "streams", "list"]).is_err());
+        assert!(parse(&["streams", "list", "--prefix"]).is_err());
+    }
+
+    #[test]
+    fn test_server_and_key_from_env() {
+        let env = |name: &str| match name {
+            "FLUX_SERVER" => Some("http://flux:3000/".to_string()),
+            "FLUX_API_KEY" => Some("k1".to_string()),
+            _ => None,
+        };
+        let args = CtlArgs::parse(["streams", "list"], env).unwrap();
+        assert_eq!(args.server, "http://flux:3000");
+        assert_eq!(args.api_key.as_deref(), Some("k1"));
+
+        let args = CtlArgs::parse(["--api-key", "k2", "streams", "list"], env).unwrap();
+        assert_eq!(args.api_key.as_deref(), Some("k2"));
+    }
+
+    #[test]
+    fn test_api_error_shows_validation_details() {
+        let body =
+            r#"{"error":"invalid stream format 'Bad'","code":"invalid_format","field":"stream"}"#;
+        let err = ApiError::from_body(400, body);
+        assert_eq!(
+            err.to_string(),
+            "HTTP 400: invalid stream format 'Bad' (field 'stream', code invalid_format)"
+        );
+        assert_eq!(
+            ApiError::from_body(502, "bad gateway\n").to_string(),
+            "HTTP 502: bad gateway"
+        );
+    }
+
+    #[test]
+    fn test_table_columns_aligned() {
+        let mut out = Vec::new();
+        let rows = vec![
+            vec!["FLUX_EVENTS".to_string(), "12".to_string()],
+            vec!["A".to_string(), "3".to_string()],
+        ];
+        write_table(&mut out, &["name", "messages"], &rows).unwrap();
+        assert_eq!(
+            String::from_utf8(out).unwrap(),
+            "NAME         MESSAGES\nFLUX_EVENTS  12\nA            3\n"
+        );
+    }
+}
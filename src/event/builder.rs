@@ -0,0 +1,145 @@
+use super::{FluxEvent, Priority, ValidationError};
+use crate::clock::{self, SharedClock};
+use chrono::{DateTime, Utc};
+use serde_json::Value;
+use std::sync::RwLock;
+use std::time::Duration;
+
+/// Clock used by builders without their own (`EventBuilder::clock`)
+static DEFAULT_CLOCK: RwLock<Option<SharedClock>> = RwLock::new(None);
+
+/// Replace the clock that stamps events built without a timestamp (the
+/// system clock by default). Process-wide; prefer `EventBuilder::clock` in
+/// tests that run in parallel.
+pub fn set_default_clock(clock: SharedClock) {
+    *DEFAULT_CLOCK.write().unwrap() = Some(clock);
+}
+
+/// The clock that stamps events built without a timestamp.
+pub fn default_clock() -> SharedClock {
+    DEFAULT_CLOCK
+        .read()
+        .unwrap()
+        .clone()
+        .unwrap_or_else(clock::system)
+}
+
+/// Fluent constructor for `FluxEvent`.
+///
+/// ```ignore
+/// let event = FluxEvent::builder("sensors.readings")
+///     .source("plant-a")
+///     .key("sensor-01")
+///     .payload(json!({"temperature": 22.5}))
+///     .build()?;
+/// ```
+///
+/// Setters take the builder by value and return it, so a partial builder can
+/// be cloned and shared (it is `Send + Sync`) to stamp out similar events.
+/// The timestamp defaults to the current time when not set, read from the
+/// builder's clock or else `default_clock()`.
+#[derive(Clone, Debug)]
+pub struct EventBuilder {
+    event: FluxEvent,
+    timestamp_set: bool,
+    clock: Option<SharedClock>,
+}
+
+impl EventBuilder {
+    /// Start building an event for `stream`.
+    pub fn new(stream: impl Into<String>) -> Self {
+        Self {
+            event: FluxEvent {
+                event_id: None,
+                stream: stream.into(),
+                source: String::new(),
+                timestamp: 0,
+                key: None,
+                schema: None,
+                priority: None,
+                envelope_version: None,
+                received_at: None,
+                ttl_ms: None,
+                correlation_id: None,
+                parent_event_id: None,
+                payload: Value::Object(Default::default()),
+                raw_payload: None,
+            },
+            timestamp_set: false,
+            clock: None,
+        }
+    }
+
+    pub fn event_id(mut self, event_id: impl Into<String>) -> Self {
+        self.event.event_id = Some(event_id.into());
+        self
+    }
+
+    pub fn source(mut self, source: impl Into<String>) -> Self {
+        self.event.source = source.into();
+        self
+    }
+
+    /// Producer time in Unix epoch milliseconds
+    pub fn timestamp_millis(mut self, timestamp: i64) -> Self {
+        self.event.timestamp = timestamp;
+        self.timestamp_set = true;
+        self
+    }
+
+    pub fn timestamp(self, timestamp: DateTime<Utc>) -> Self {
+        self.timestamp_millis(timestamp.timestamp_millis())
+    }
+
+    /// Clock for the default timestamp
+    pub fn clock(mut self, clock: SharedClock) -> Self {
+        self.clock = Some(clock);
+        self
+    }
+
+    pub fn key(mut self, key: impl Into<String>) -> Self {
+        self.event.key = Some(key.into());
+        self
+    }
+
+    pub fn schema(mut self, schema: impl Into<String>) -> Self {
+        self.event.schema = Some(schema.into());
+        self
+    }
+
+    pub fn priority(mut self, priority: Priority) -> Self {
+        self.event.priority = Some(priority);
+        self
+    }
+
+    /// Expire the event this long after its timestamp (see
+    /// `FluxEvent::is_expired`)
+    pub fn ttl(mut self, ttl: Duration) -> Self {
+        self.event.ttl_ms = Some(ttl.as_millis() as u64);
+        self
+    }
+
+    pub fn payload(mut self, payload: Value) -> Self {
+        self.event.payload = payload;
+        self
+    }
+
+    /// Validate and prepare the event (see `FluxEvent::validate_and_prepare`).
+    pub fn build(self) -> Result<FluxEvent, ValidationError> {
+        let mut event = self.event;
+        if !self.timestamp_set {
+            let clock = self.clock.unwrap_or_else(default_clock);
+            event.timestamp = clock.now_millis();
+        }
+        event.validate_and_prepare()?;
+        Ok(event)
+    }
+
+    /// Like `build`, but panics on invalid input. Intended for tests.
+    pub fn must_build(self) -> FluxEvent {
+        match self.build() {
+            Ok(event) => event,
+            Err(e) => panic!("invalid event: {}", e),
+        }
+    }
+}
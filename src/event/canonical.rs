@@ -0,0 +1,172 @@
+use super::FluxEvent;
+use serde_json::Value;
+use sha2::{Digest, Sha256};
+
+/// Canonical JSON bytes of an event (envelope and payload), for hashing and
+/// signing: the same event always yields the same bytes, however its payload
+/// keys were ordered when it was built or parsed.
+///
+/// Follows RFC 8785 (JCS): object keys sorted by UTF-16 code units, no
+/// insignificant whitespace, minimal string escaping, and numbers in their
+/// shortest form (`1.0` becomes `1`, `1e21` becomes `1e+21`). Absent
+/// optional fields are omitted, as in the regular JSON form.
+pub fn canonicalize_event(event: &FluxEvent) -> Result<Vec<u8>, serde_json::Error> {
+    Ok(canonical_json(&serde_json::to_value(event)?).into_bytes())
+}
+
+/// Canonical (RFC 8785 style) JSON text of `value`.
+pub fn canonical_json(value: &Value) -> String {
+    let mut out = String::new();
+    write_value(&mut out, value);
+    out
+}
+
+impl FluxEvent {
+    /// Hex SHA-256 of `canonicalize_event`, equal for semantically equal
+    /// events (including their eventId).
+    pub fn content_hash(&self) -> Result<String, serde_json::Error> {
+        Ok(Sha256::digest(canonicalize_event(self)?)
+            .iter()
+            .map(|b| format!("{:02x}", b))
+            .collect())
+    }
+
+    /// Rewrite the payload in canonical form (see `canonical_json`), so
+    /// payloads that differ only in number formatting such as `1.0` and `1`
+    /// compare equal. A null payload is left as is. The producer's bytes
+    /// (`raw_payload`) are dropped, so encoders write the canonical form.
+    pub fn normalize_payload(&mut self) -> Result<(), serde_json::Error> {
+        if !self.payload.is_null() {
+            self.payload = serde_json::from_str(&canonical_json(&self.payload))?;
+            self.raw_payload = None;
+        }
+        Ok(())
+    }
+
+    /// The payload as indented JSON, for logs and test failure messages.
+    pub fn pretty_payload(&self) -> Result<String, serde_json::Error> {
+        serde_json::to_string_pretty(&self.payload)
+    }
+
+    /// True if both payloads have the same canonical form.
+    pub fn payload_equals(&self, other: &FluxEvent) -> bool {
+        canonical_json(&self.payload) == canonical_json(&other.payload)
+    }
+}
+
+fn write_value(out: &mut String, value: &Value) {
+    match value {
+        Value::Null | Value::Bool(_) | Value::String(_) => out.push_str(&value.to_string()),
+        Value::Number(number) => match number.as_f64() {
+            Some(float) if number.is_f64() => write_float(out, float),
+            _ => out.push_str(&number.to_string()),
+        },
+        Value::Array(items) => {
+            out.push('[');
+            for (i, item) in items.iter().enumerate() {
+                if i > 0 {
+                    out.push(',');
+                }
+                write_value(out, item);
+            }
+            out.push(']');
+        }
+        Value::Object(map) => {
+            let mut entries: Vec<(&String, &Value)> = map.iter().collect();
+            entries.sort_by(|(a, _), (b, _)| a.encode_utf16().cmp(b.encode_utf16()));
+            out.push('{');
+            for (i, (key, item)) in entries.into_iter().enumerate() {
+                if i > 0 {
+                    out.push(',');
+                }
+                out.push_str(&Value::String(key.clone()).to_string());
+                out.push(':');
+                write_value(out, item);
+            }
+            out.push('}');
+        }
+    }
+}
+
+/// ECMAScript number formatting: integers without a fraction, exponents
+/// outside [1e-6, 1e21) with an explicit sign.
+fn write_float(out: &mut String, float: f64) {
+    let magnitude = float.abs();
+    if float == 0.0 {
+        out.push('0');
+    } else if (1e-6..1e21).contains(&magnitude) {
+        // Display is the shortest round-trip form without an exponent
+        out.push_str(&float.to_string());
+    } else {
+        let formatted = format!("{:e}", float);
+        match formatted.split_once('e') {
+            Some((mantissa, exponent)) if !exponent.starts_with('-') => {
+                out.push_str(&format!("{}e+{}", mantissa, exponent))
+            }
+            _ => out.push_str(&formatted),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    #[test]
+    fn test_keys_sorted_without_whitespace() {
+        let value = json!({"b": [1, {"z": true, "a": null}], "a": "x\ny", "é": 1, "Z": 2});
+        assert_eq!(
+            canonical_json(&value),
+            r#"{"Z":2,"a":"x\ny","b":[1,{"a":null,"z":true}],"é":1}"#
+        );
+    }
+
+    #[test]
+    fn test_number_formatting() {
+        let cases = [
+            (json!(1.0), "1"),
+            (json!(-0.0), "0"),
+            (json!(1.5), "1.5"),
+            (json!(0.000001), "0.000001"),
+            (json!(0.0000001), "1e-7"),
+            (json!(1e21), "1e+21"),
+            (json!(123456789012345680000.0), "123456789012345680000"),
+            (json!(-42), "-42"),
+            (json!(u64::MAX), "18446744073709551615"),
+        ];
+        for (value, expected) in cases {
+            assert_eq!(canonical_json(&value), expected, "{:?}", value);
+        }
+    }
+
+    #[test]
+    fn test_utf16_key_order() {
+        // U+1F600 (a surrogate pair) sorts after U+FB01 in UTF-8 but
+        // before it in UTF-16
+        let value = json!({"\u{FB01}": 1, "\u{1F600}": 2});
+        assert_eq!(canonical_json(&value), "{\"\u{1F600}\":2,\"\u{FB01}\":1}");
+    }
+
+    #[test]
+    fn test_payload_normalization() {
+        let event = |payload| {
+            FluxEvent::builder("sensors")
+                .source("canonical-test")
+                .payload(payload)
+                .must_build()
+        };
+        let mut a = event(json!({"temp": 21.0, "tags": ["a", "b"]}));
+        let b = event(json!({"tags": ["a", "b"], "temp": 21}));
+        assert_ne!(a.payload, b.payload);
+        assert!(a.payload_equals(&b));
+        assert!(!a.payload_equals(&event(json!({"temp": 21.5, "tags": ["a", "b"]}))));
+
+        a.normalize_payload().unwrap();
+        assert_eq!(a.payload, b.payload);
+        assert_eq!(
+            a.pretty_payload().unwrap(),
+            "{\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ],\n  \"temp\": 21\n}"
+        );
+    }
+}
@@ -0,0 +1,28 @@
+use serde::Deserialize;
+
+/// The envelope fields of a JSON event, read without building its payload.
+///
+/// Monitoring code that only needs to know where an event came from and when
+/// can skip the cost of a full `FluxEvent`: the payload (like any other field
+/// not listed here) is scanned for well-formedness but nothing is allocated
+/// for it.
+#[derive(Debug, Clone, PartialEq, Deserialize)]
+pub struct EventMetadata {
+    #[serde(rename = "eventId", default)]
+    pub event_id: Option<String>,
+    pub stream: String,
+    pub source: String,
+    pub timestamp: i64,
+    #[serde(default)]
+    pub schema: Option<String>,
+    #[serde(default)]
+    pub key: Option<String>,
+}
+
+impl EventMetadata {
+    /// Read the metadata of a JSON-encoded event. Gzipped or protobuf
+    /// messages must go through `nats::decode_event` instead.
+    pub fn from_json(data: &[u8]) -> Result<Self, serde_json::Error> {
+        serde_json::from_slice(data)
+    }
+}
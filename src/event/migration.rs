@@ -0,0 +1,284 @@
+use super::FluxEvent;
+use anyhow::{Context, Result};
+use serde_json::Value;
+use std::collections::{HashMap, VecDeque};
+use std::fmt;
+use std::future::Future;
+use std::sync::Arc;
+
+/// Rewrites a payload from one schema to the next.
+pub type MigrationFn = Arc<dyn Fn(Value) -> Result<Value> + Send + Sync>;
+
+/// Returned when no chain of registered migrations leads from an event's
+/// schema to the target (or the event has no schema).
+#[derive(Debug, Clone, PartialEq)]
+pub struct NoMigrationPathError {
+    pub from: Option<String>,
+    pub to: String,
+}
+
+impl fmt::Display for NoMigrationPathError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match &self.from {
+            Some(from) => write!(f, "no migration from schema '{}' to '{}'", from, self.to),
+            None => write!(f, "event has no schema to migrate to '{}'", self.to),
+        }
+    }
+}
+
+impl std::error::Error for NoMigrationPathError {}
+
+/// Payload migrations between schema versions (e.g. `alarm.raise.v1` to
+/// `alarm.raise.v2`), so consumers can handle events from producers that
+/// have not upgraded yet.
+///
+/// `migrate` follows the shortest chain of registered migrations, so
+/// registering v1->v2 and v2->v3 is enough to read v1 events as v3.
+#[derive(Clone, Default)]
+pub struct SchemaMigrator {
+    /// from schema -> (to schema, migration), in registration order
+    migrations: HashMap<String, Vec<(String, MigrationFn)>>,
+}
+
+impl SchemaMigrator {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Register the migration of payloads from `from` to `to`, replacing any
+    /// earlier one between the same schemas.
+    pub fn register<F>(&mut self, from: impl Into<String>, to: impl Into<String>, migrate: F)
+    where
+        F: Fn(Value) -> Result<Value> + Send + Sync + 'static,
+    {
+        let to = to.into();
+        let edges = self.migrations.entry(from.into()).or_default();
+        edges.retain(|(existing, _)| existing != &to);
+        edges.push((to, Arc::new(migrate)));
+    }
+
+    /// Schemas visited going from `from` to `to`, both included; `None` if
+    /// no chain of migrations connects them.
+    pub fn path(&self, from: &str, to: &str) -> Option<Vec<String>> {
+        // Breadth first, so the fewest hops win
+        let mut previous: HashMap<&str, &str> = HashMap::new();
+        let mut queue = VecDeque::from([from]);
+        while let Some(schema) = queue.pop_front() {
+            if schema == to {
+                let mut path = vec![to.to_string()];
+                let mut current = to;
+                while let Some(&prev) = previous.get(current) {
+                    path.push(prev.to_string());
+                    current = prev;
+                }
+                path.reverse();
+                return Some(path);
+            }
+            for (next, _) in self.migrations.get(schema).into_iter().flatten() {
+                if next != from && !previous.contains_key(next.as_str()) {
+                    previous.insert(next, schema);
+                    queue.push_back(next);
+                }
+            }
+        }
+        None
+    }
+
+    /// `event` with its payload migrated to `target` and `schema` set to it.
+    /// Events already at `target` are returned as they are.
+    ///
+    /// Fails with `NoMigrationPathError`, or the error of the migration that
+    /// failed (naming its schemas).
+    pub fn migrate(&self, mut event: FluxEvent, target: &str) -> Result<FluxEvent> {
+        let no_path = |from: Option<String>| NoMigrationPathError {
+            from,
+            to: target.to_string(),
+        };
+        let from = event.schema.clone().ok_or_else(|| no_path(None))?;
+        let path = self
+            .path(&from, target)
+            .ok_or_else(|| no_path(Some(from.clone())))?;
+
+        for hop in path.windows(2) {
+            let (from, to) = (&hop[0], &hop[1]);
+            let migrate = self.migrations[from]
+                .iter()
+                .find(|(next, _)| next == to)
+                .map(|(_, migrate)| migrate)
+                .expect("path follows registered migrations");
+            let payload = std::mem::take(&mut event.payload);
+            event.payload = migrate(payload).with_context(|| {
+                format!("Failed to migrate payload from '{}' to '{}'", from, to)
+            })?;
+            event.schema = Some(to.clone());
+        }
+        Ok(event)
+    }
+}
+
+/// Wraps an event handler so it only sees payloads in one schema, migrating
+/// older events first (see `SchemaMigrator`). Events that cannot be
+/// migrated fail without reaching the handler.
+pub struct MigratingHandler<F> {
+    inner: F,
+    migrator: Arc<SchemaMigrator>,
+    target: String,
+}
+
+impl<F, Fut> MigratingHandler<F>
+where
+    F: Fn(FluxEvent) -> Fut,
+    Fut: Future<Output = Result<()>>,
+{
+    pub fn new(target: impl Into<String>, migrator: Arc<SchemaMigrator>, inner: F) -> Self {
+        Self {
+            inner,
+            migrator,
+            target: target.into(),
+        }
+    }
+
+    /// Migrate `event` to the target schema and run the wrapped handler.
+    pub async fn handle(&self, event: FluxEvent) -> Result<()> {
+        let event = self.migrator.migrate(event, &self.target)?;
+        (self.inner)(event).await
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+    use std::sync::Mutex;
+
+    fn alarm(schema: &str, payload: Value) -> FluxEvent {
+        FluxEvent::builder("alarms")
+            .source("plant-a")
+            .schema(schema)
+            .payload(payload)
+            .must_build()
+    }
+
+    /// v1 `level` became `severity` in v2; v3 nests it under `alarm`.
+    fn migrator() -> SchemaMigrator {
+        let mut migrator = SchemaMigrator::new();
+        migrator.register("alarm.raise.v1", "alarm.raise.v2", |mut payload| {
+            let level = payload
+                .as_object_mut()
+                .and_then(|fields| fields.remove("level"))
+                .ok_or_else(|| anyhow::anyhow!("missing level"))?;
+            payload["severity"] = level;
+            Ok(payload)
+        });
+        migrator.register("alarm.raise.v2", "alarm.raise.v3", |payload| {
+            Ok(json!({ "alarm": payload }))
+        });
+        migrator
+    }
+
+    #[test]
+    fn test_single_hop() {
+        let event = alarm("alarm.raise.v1", json!({"tag": "P-101", "level": "high"}));
+        let event_id = event.event_id.clone();
+
+        let migrated = migrator().migrate(event, "alarm.raise.v2").unwrap();
+        assert_eq!(migrated.schema.as_deref(), Some("alarm.raise.v2"));
+        assert_eq!(
+            migrated.payload,
+            json!({"tag": "P-101", "severity": "high"})
+        );
+        assert_eq!(migrated.event_id, event_id);
+    }
+
+    #[test]
+    fn test_two_hops() {
+        let migrator = migrator();
+        assert_eq!(
+            migrator.path("alarm.raise.v1", "alarm.raise.v3").unwrap(),
+            ["alarm.raise.v1", "alarm.raise.v2", "alarm.raise.v3"]
+        );
+
+        let event = alarm("alarm.raise.v1", json!({"tag": "P-101", "level": "high"}));
+        let migrated = migrator.migrate(event, "alarm.raise.v3").unwrap();
+        assert_eq!(migrated.schema.as_deref(), Some("alarm.raise.v3"));
+        assert_eq!(
+            migrated.payload,
+            json!({"alarm": {"tag": "P-101", "severity": "high"}})
+        );
+    }
+
+    #[test]
+    fn test_shortest_path_wins() {
+        let mut migrator = migrator();
+        migrator.register("alarm.raise.v1", "alarm.raise.v3", |payload| {
+            Ok(json!({ "direct": payload }))
+        });
+        let event = alarm("alarm.raise.v1", json!({"level": "low"}));
+        let migrated = migrator.migrate(event, "alarm.raise.v3").unwrap();
+        assert_eq!(migrated.payload, json!({"direct": {"level": "low"}}));
+    }
+
+    #[test]
+    fn test_unmigratable_events() {
+        let migrator = migrator();
+        // Already there
+        let event = alarm("alarm.raise.v2", json!({"severity": "low"}));
+        let same = migrator.migrate(event.clone(), "alarm.raise.v2").unwrap();
+        assert_eq!(same.payload, event.payload);
+
+        // Migrations only go forward
+        let err = migrator.migrate(event, "alarm.raise.v1").unwrap_err();
+        assert_eq!(
+            err.downcast_ref::<NoMigrationPathError>().unwrap(),
+            &NoMigrationPathError {
+                from: Some("alarm.raise.v2".to_string()),
+                to: "alarm.raise.v1".to_string(),
+            }
+        );
+
+        let mut unversioned = alarm("alarm.raise.v1", json!({}));
+        unversioned.schema = None;
+        let err = migrator.migrate(unversioned, "alarm.raise.v2").unwrap_err();
+        assert!(err.downcast_ref::<NoMigrationPathError>().is_some());
+
+        let broken = alarm("alarm.raise.v1", json!({"tag": "P-101"}));
+        let err = migrator.migrate(broken, "alarm.raise.v3").unwrap_err();
+        assert_eq!(
+            format!("{:#}", err),
+            "Failed to migrate payload from 'alarm.raise.v1' to 'alarm.raise.v2': missing level"
+        );
+    }
+
+    #[tokio::test]
+    async fn test_migrating_handler() {
+        let seen = Arc::new(Mutex::new(Vec::new()));
+        let handler = {
+            let seen = Arc::clone(&seen);
+            MigratingHandler::new("alarm.raise.v2", Arc::new(migrator()), move |event| {
+                let seen = Arc::clone(&seen);
+                async move {
+                    seen.lock().unwrap().push(event.payload);
+                    Ok(())
+                }
+            })
+        };
+
+        handler
+            .handle(alarm("alarm.raise.v1", json!({"level": "high"})))
+            .await
+            .unwrap();
+        handler
+            .handle(alarm("alarm.raise.v2", json!({"severity": "low"})))
+            .await
+            .unwrap();
+        assert!(handler
+            .handle(alarm("alarm.raise.v3", json!({})))
+            .await
+            .is_err());
+
+        assert_eq!(
+            *seen.lock().unwrap(),
+            [json!({"severity": "high"}), json!({"severity": "low"})]
+        );
+    }
+}
@@ -1,16 +1,55 @@
 use serde::{Deserialize, Serialize};
+use serde_json::value::RawValue;
 use serde_json::Value;
+use std::borrow::Cow;
+use std::fmt;
+use uuid::Uuid;
 
+mod builder;
+mod canonical;
+mod metadata;
+mod migration;
 mod validation;
 #[cfg(test)]
 mod tests;
 
-pub use validation::{validate_and_prepare, ValidationError};
+pub use builder::{default_clock, set_default_clock, EventBuilder};
+
+/// Envelope version of events that use only the original fields.
+pub const ENVELOPE_V1: u32 = 1;
+
+/// Newest envelope version this build understands.
+///
+/// Version history:
+/// - 1: eventId, stream, source, timestamp, key, schema, payload
+/// - 2: adds `priority`
+/// - 3: adds `correlationId`, `parentEventId`, `ttlMs`, `receivedAt`
+///
+/// Migrating: producers never set the version themselves; validation stamps
+/// the lowest version covering the fields in use, so events without newer
+/// fields stay v1 on the wire. Consumers that only understand older envelopes should
+/// bound what they accept (`ExactlyOnce::with_max_envelope_version`) and be
+/// upgraded before producers start setting newer fields. Events without
+/// `envelopeVersion` are v1.
+pub const CURRENT_ENVELOPE_VERSION: u32 = 3;
+pub use canonical::{canonical_json, canonicalize_event};
+pub use metadata::EventMetadata;
+pub use migration::{MigratingHandler, MigrationFn, NoMigrationPathError, SchemaMigrator};
+pub use validation::{
+    check_envelope_version, glob_match, is_valid_key, is_valid_source, is_valid_stream_name,
+    normalize_source, sanitize_key, validate_and_prepare, validate_with_options,
+    SharedValidationOptions, SourceFormatMode, StreamNamingPolicy, ValidationError,
+    ValidationErrorCode, ValidationOptions, MAX_KEY_LENGTH, MAX_SOURCE_LENGTH, MAX_STREAM_DEPTH,
+    MAX_STREAM_NAME_LENGTH, RESERVED_STREAM_PREFIX,
+};
 
 /// FluxEvent represents an immutable event in the Flux system.
 ///
 /// Events have a fixed envelope structure with domain-agnostic payload.
 /// All events are time-ordered via UUIDv7 identifiers.
+///
+/// `clone()` is a deep copy (the payload is an owned `Value`), so pipeline
+/// code can modify a clone without affecting the original.
 #[derive(Clone, Debug, Serialize, Deserialize)]
 pub struct FluxEvent {
     /// UUIDv7 identifier (time-ordered, globally unique)
@@ -38,12 +77,202 @@ pub struct FluxEvent {
     #[serde(skip_serializing_if = "Option::is_none")]
     pub schema: Option<String>,
 
+    /// Optional delivery priority (defaults to normal)
+    /// High and critical events are routed to a dedicated sub-subject
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub priority: Option<Priority>,
+
+    /// Envelope version (absent = 1); set by validation from the fields in use
+    #[serde(
+        rename = "envelopeVersion",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub envelope_version: Option<u32>,
+
+    /// When a Flux instance accepted the event (Unix epoch milliseconds),
+    /// set by publishers with `with_embed_received_at`; producer values are
+    /// overwritten there
+    #[serde(rename = "receivedAt", default, skip_serializing_if = "Option::is_none")]
+    pub received_at: Option<i64>,
+
+    /// How long the event stays relevant after `timestamp`, in milliseconds.
+    /// Consumers skip it once expired (see `is_expired`); streams still keep
+    /// it for their own retention.
+    #[serde(rename = "ttlMs", default, skip_serializing_if = "Option::is_none")]
+    pub ttl_ms: Option<u64>,
+
+    /// Shared by every event in a workflow chain: the eventId of the chain's
+    /// first event unless the producer supplies its own (see `next`)
+    #[serde(
+        rename = "correlationId",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub correlation_id: Option<String>,
+
+    /// eventId of the event this one follows in a chain (a UUID)
+    #[serde(
+        rename = "parentEventId",
+        default,
+        skip_serializing_if = "Option::is_none"
+    )]
+    pub parent_event_id: Option<String>,
+
     /// Domain-specific event data (opaque to Flux)
     /// Must be a valid JSON object
     pub payload: Value,
+
+    /// The payload exactly as the producer sent it (key order, whitespace,
+    /// number formatting), kept by `from_json_slice` and the protobuf
+    /// decoder so the protobuf envelope stores the original bytes. Ignored
+    /// once `payload` no longer matches it (see `payload_json`).
+    #[serde(skip)]
+    pub raw_payload: Option<Box<RawValue>>,
+}
+
+/// Borrows the payload of an event's JSON without parsing it.
+#[derive(Deserialize)]
+struct RawPayload<'a> {
+    #[serde(borrow)]
+    payload: &'a RawValue,
+}
+
+/// Event priority.
+///
+/// Unknown values are rejected when the event is deserialized.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, PartialOrd, Ord, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Priority {
+    Low,
+    #[default]
+    Normal,
+    High,
+    Critical,
+}
+
+impl Priority {
+    /// True for priorities routed to the `.p.high` sub-subject
+    pub fn is_elevated(&self) -> bool {
+        matches!(self, Priority::High | Priority::Critical)
+    }
+
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            Priority::Low => "low",
+            Priority::Normal => "normal",
+            Priority::High => "high",
+            Priority::Critical => "critical",
+        }
+    }
 }
 
 impl FluxEvent {
+    /// Envelope version of this event (1 when not stamped).
+    pub fn envelope_version(&self) -> u32 {
+        self.envelope_version.unwrap_or(ENVELOPE_V1)
+    }
+
+    /// True if the event has a TTL and more than that has passed between its
+    /// `timestamp` and `now_ms`. A TTL of 0 never expires.
+    pub fn is_expired(&self, now_ms: i64) -> bool {
+        match self.ttl_ms {
+            Some(ttl_ms) if ttl_ms > 0 => now_ms.saturating_sub(self.timestamp) > ttl_ms as i64,
+            _ => false,
+        }
+    }
+
+    /// Lowest envelope version that carries every field set on this event.
+    pub fn required_envelope_version(&self) -> u32 {
+        if self.correlation_id.is_some()
+            || self.parent_event_id.is_some()
+            || self.ttl_ms.is_some()
+            || self.received_at.is_some()
+        {
+            3
+        } else if self.priority.is_some() {
+            2
+        } else {
+            ENVELOPE_V1
+        }
+    }
+
+    /// Parse an event from JSON, keeping the payload's original bytes in
+    /// `raw_payload`.
+    pub fn from_json_slice(json: &[u8]) -> serde_json::Result<FluxEvent> {
+        let mut event: FluxEvent = serde_json::from_slice(json)?;
+        let raw: RawPayload = serde_json::from_slice(json)?;
+        event.raw_payload = Some(raw.payload.to_owned());
+        Ok(event)
+    }
+
+    /// The payload as JSON bytes: `raw_payload` while it still parses to
+    /// `payload`, otherwise `payload` serialized afresh.
+    pub fn payload_json(&self) -> serde_json::Result<Cow<'_, [u8]>> {
+        if let Some(raw) = &self.raw_payload {
+            if serde_json::from_str::<Value>(raw.get()).is_ok_and(|v| v == self.payload) {
+                return Ok(Cow::Borrowed(raw.get().as_bytes()));
+            }
+        }
+        serde_json::to_vec(&self.payload).map(Cow::Owned)
+    }
+
+    /// Start a fluent builder for an event on `stream`.
+    pub fn builder(stream: impl Into<String>) -> EventBuilder {
+        EventBuilder::new(stream)
+    }
+
+    /// Copy of this event on another stream, e.g. to re-route it.
+    ///
+    /// Every other field, including `event_id`, is kept. Clear `event_id` on the
+    /// copy if it should be stored as a distinct event.
+    pub fn clone_with_stream(&self, stream: impl Into<String>) -> FluxEvent {
+        FluxEvent {
+            stream: stream.into(),
+            ..self.clone()
+        }
+    }
+
+    /// The event that follows this one in a workflow chain (e.g.
+    /// `request_received` -> `processing_started` -> `completed`), with a
+    /// new eventId, the current time, this event as its parent and the
+    /// chain's correlation id (this event's eventId if it has none).
+    ///
+    /// Call it on a prepared event; without an eventId the new event has no
+    /// parent.
+    pub fn next(
+        &self,
+        stream: impl Into<String>,
+        source: impl Into<String>,
+        schema: impl Into<String>,
+        payload: Value,
+    ) -> FluxEvent {
+        FluxEvent {
+            event_id: Some(Uuid::now_v7().to_string()),
+            stream: stream.into(),
+            source: source.into(),
+            timestamp: default_clock().now_millis(),
+            key: None,
+            schema: Some(schema.into()),
+            priority: None,
+            envelope_version: None,
+            received_at: None,
+            ttl_ms: None,
+            correlation_id: self
+                .correlation_id
+                .clone()
+                .or_else(|| self.event_id.clone()),
+            parent_event_id: self.event_id.clone(),
+            payload,
+            raw_payload: None,
+        }
+    }
+
+    /// Effective priority (normal when unset)
+    pub fn priority(&self) -> Priority {
+        self.priority.unwrap_or_default()
+    }
+
     /// Validates and prepares an event for ingestion.
     ///
     /// This method:
@@ -57,4 +286,47 @@ impl FluxEvent {
     pub fn validate_and_prepare(&mut self) -> Result<(), ValidationError> {
         validation::validate_and_prepare(self)
     }
+
+    /// `validate_and_prepare`, then the deployment checks in `options`
+    /// (source allow-list, source length).
+    pub fn validate_with_options(
+        &mut self,
+        options: &ValidationOptions,
+    ) -> Result<(), ValidationError> {
+        validation::validate_with_options(self, options)
+    }
+}
+
+/// Compact one-line form for logs, e.g.
+/// `Event[id=0190a1b2, stream=alarms.events, source=plant-a, ts=2024-01-15T10:30:00Z, schema=alarm.raise.v1]`.
+///
+/// The payload is never included, so events can be logged without leaking
+/// their data. Use `{:?}` for every field.
+impl fmt::Display for FluxEvent {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let id: String = match &self.event_id {
+            Some(id) => id.chars().take(8).collect(),
+            None => "none".to_string(),
+        };
+        write!(
+            f,
+            "Event[id={}, stream={}, source={}, ts=",
+            id, self.stream, self.source
+        )?;
+        match chrono::DateTime::from_timestamp_millis(self.timestamp) {
+            Some(ts) => write!(
+                f,
+                "{}",
+                ts.to_rfc3339_opts(chrono::SecondsFormat::AutoSi, true)
+            )?,
+            None => write!(f, "{}", self.timestamp)?,
+        }
+        if let Some(key) = &self.key {
+            write!(f, ", key={}", key)?;
+        }
+        if let Some(schema) = &self.schema {
+            write!(f, ", schema={}", schema)?;
+        }
+        write!(f, "]")
+    }
 }
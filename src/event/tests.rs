@@ -1,4 +1,5 @@
 use super::*;
+use crate::clock::FakeClock;
 use serde_json::json;
 
 #[test]
@@ -10,7 +11,14 @@ fn test_valid_event_passes_validation() {
         timestamp: 1707668400000, // 2024-02-11 13:00:00 UTC
         key: Some("zone1".to_string()),
         schema: Some("temp-v1".to_string()),
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5, "unit": "celsius"}),
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
@@ -28,12 +36,22 @@ fn test_missing_stream_fails() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
     assert!(result.is_err());
-    assert_eq!(result.unwrap_err(), ValidationError::MissingStream);
+    let err = result.unwrap_err();
+    assert_eq!(err, ValidationError::MissingStream);
+    assert_eq!(err.code(), ValidationErrorCode::Missing);
+    assert_eq!(err.field(), "stream");
 }
 
 #[test]
@@ -45,12 +63,22 @@ fn test_missing_source_fails() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
     assert!(result.is_err());
-    assert_eq!(result.unwrap_err(), ValidationError::MissingSource);
+    let err = result.unwrap_err();
+    assert_eq!(err, ValidationError::MissingSource);
+    assert_eq!(err.code(), ValidationErrorCode::Missing);
+    assert_eq!(err.field(), "source");
 }
 
 #[test]
@@ -62,15 +90,25 @@ fn test_invalid_stream_format_fails() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
     assert!(result.is_err());
-    match result.unwrap_err() {
+    let err = result.unwrap_err();
+    match err {
         ValidationError::InvalidStreamFormat(_) => {}
         _ => panic!("Expected InvalidStreamFormat error"),
     }
+    assert_eq!(err.code(), ValidationErrorCode::InvalidFormat);
+    assert_eq!(err.field(), "stream");
 }
 
 #[test]
@@ -82,12 +120,22 @@ fn test_invalid_timestamp_fails() {
         timestamp: -1, // Negative timestamp
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
     assert!(result.is_err());
-    assert_eq!(result.unwrap_err(), ValidationError::InvalidTimestamp(-1));
+    let err = result.unwrap_err();
+    assert_eq!(err, ValidationError::InvalidTimestamp(-1));
+    assert_eq!(err.code(), ValidationErrorCode::OutOfRange);
+    assert_eq!(err.field(), "timestamp");
 }
 
 #[test]
@@ -99,7 +147,14 @@ fn test_zero_timestamp_fails() {
         timestamp: 0,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
@@ -116,12 +171,21 @@ fn test_payload_not_object_fails() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!("not an object"), // String instead of object
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
     assert!(result.is_err());
-    assert_eq!(result.unwrap_err(), ValidationError::PayloadNotObject);
+    let err = result.unwrap_err();
+    assert_eq!(err, ValidationError::PayloadNotObject);
+    assert_eq!(err.code(), ValidationErrorCode::InvalidFormat);
 }
 
 #[test]
@@ -133,12 +197,21 @@ fn test_payload_array_fails() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!([1, 2, 3]), // Array instead of object
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
     assert!(result.is_err());
-    assert_eq!(result.unwrap_err(), ValidationError::PayloadNotObject);
+    let err = result.unwrap_err();
+    assert_eq!(err, ValidationError::PayloadNotObject);
+    assert_eq!(err.code(), ValidationErrorCode::InvalidFormat);
 }
 
 #[test]
@@ -150,12 +223,21 @@ fn test_null_payload_fails() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!(null),
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
     assert!(result.is_err());
-    assert_eq!(result.unwrap_err(), ValidationError::MissingPayload);
+    let err = result.unwrap_err();
+    assert_eq!(err, ValidationError::MissingPayload);
+    assert_eq!(err.code(), ValidationErrorCode::Missing);
 }
 
 #[test]
@@ -167,7 +249,14 @@ fn test_uuidv7_generation() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     let mut event2 = FluxEvent {
@@ -177,7 +266,14 @@ fn test_uuidv7_generation() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 24.0}),
+        raw_payload: None,
     };
 
     event1.validate_and_prepare().unwrap();
@@ -205,7 +301,14 @@ fn test_existing_event_id_preserved() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     event.validate_and_prepare().unwrap();
@@ -223,7 +326,14 @@ fn test_optional_fields() {
         timestamp: 1707668400000,
         key: None, // Optional
         schema: None, // Optional
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     let result = event.validate_and_prepare();
@@ -239,7 +349,14 @@ fn test_serde_serialization() {
         timestamp: 1707668400000,
         key: Some("zone1".to_string()),
         schema: Some("temp-v1".to_string()),
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5, "unit": "celsius"}),
+        raw_payload: None,
     };
 
     let json_str = serde_json::to_string(&event).unwrap();
@@ -260,7 +377,14 @@ fn test_serde_skip_none_fields() {
         timestamp: 1707668400000,
         key: None,
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({"value": 23.5}),
+        raw_payload: None,
     };
 
     let json_str = serde_json::to_string(&event).unwrap();
@@ -268,3 +392,782 @@ fn test_serde_skip_none_fields() {
     assert!(!json_str.contains("\"key\""));
     assert!(!json_str.contains("\"schema\""));
 }
+
+#[test]
+fn test_priority_defaults_to_normal() {
+    let event: FluxEvent = serde_json::from_value(json!({
+        "stream": "alarms",
+        "source": "plc-01",
+        "timestamp": 1707668400000i64,
+        "payload": {"value": 1}
+    }))
+    .unwrap();
+    assert_eq!(event.priority, None);
+    assert_eq!(event.priority(), Priority::Normal);
+}
+
+#[test]
+fn test_priority_parses_and_round_trips() {
+    let event: FluxEvent = serde_json::from_value(json!({
+        "stream": "alarms",
+        "source": "plc-01",
+        "timestamp": 1707668400000i64,
+        "priority": "critical",
+        "payload": {"value": 1}
+    }))
+    .unwrap();
+    assert_eq!(event.priority(), Priority::Critical);
+    assert!(event.priority().is_elevated());
+
+    let json_str = serde_json::to_string(&event).unwrap();
+    assert!(json_str.contains("\"priority\":\"critical\""));
+}
+
+#[test]
+fn test_invalid_priority_rejected() {
+    let result: Result<FluxEvent, _> = serde_json::from_value(json!({
+        "stream": "alarms",
+        "source": "plc-01",
+        "timestamp": 1707668400000i64,
+        "priority": "urgent",
+        "payload": {"value": 1}
+    }));
+    assert!(result.is_err());
+}
+
+#[test]
+fn test_priority_elevation() {
+    assert!(!Priority::Low.is_elevated());
+    assert!(!Priority::Normal.is_elevated());
+    assert!(Priority::High.is_elevated());
+    assert!(Priority::Critical.is_elevated());
+}
+
+#[test]
+fn test_validation_code_http_status() {
+    assert_eq!(ValidationErrorCode::Missing.http_status(), 400);
+    assert_eq!(ValidationErrorCode::InvalidFormat.http_status(), 400);
+    assert_eq!(ValidationErrorCode::OutOfRange.http_status(), 400);
+    assert_eq!(ValidationErrorCode::TooLong.http_status(), 400);
+    assert_eq!(ValidationErrorCode::PayloadTooLarge.http_status(), 413);
+    assert_eq!(ValidationErrorCode::InvalidFormat.as_str(), "invalid_format");
+}
+
+#[test]
+fn test_builder_builds_valid_event() {
+    let event = FluxEvent::builder("sensor.readings")
+        .source("plant-a")
+        .timestamp_millis(1707668400000)
+        .key("sensor-01")
+        .schema("sensor.v1")
+        .priority(Priority::High)
+        .payload(json!({"temperature": 22.5}))
+        .build()
+        .unwrap();
+
+    assert_eq!(event.stream, "sensor.readings");
+    assert_eq!(event.source, "plant-a");
+    assert_eq!(event.timestamp, 1707668400000);
+    assert_eq!(event.key.as_deref(), Some("sensor-01"));
+    assert_eq!(event.schema.as_deref(), Some("sensor.v1"));
+    assert_eq!(event.priority(), Priority::High);
+    assert!(event.event_id.is_some());
+}
+
+#[test]
+fn test_builder_defaults_timestamp_to_now() {
+    let clock = FakeClock::at_millis(1707668400000);
+    let builder = FluxEvent::builder("sensors")
+        .source("plant-a")
+        .clock(clock.clone())
+        .payload(json!({}));
+    assert_eq!(builder.clone().must_build().timestamp, 1707668400000);
+
+    clock.advance(chrono::Duration::milliseconds(250));
+    assert_eq!(builder.must_build().timestamp, 1707668400250);
+}
+
+#[test]
+fn test_builder_explicit_timestamp_ignores_clock() {
+    let event = FluxEvent::builder("sensors")
+        .source("plant-a")
+        .clock(FakeClock::at_millis(1707668400000))
+        .timestamp_millis(1707000000000)
+        .payload(json!({}))
+        .must_build();
+    assert_eq!(event.timestamp, 1707000000000);
+}
+
+#[test]
+fn test_builder_runs_validation() {
+    let err = FluxEvent::builder("Sensors")
+        .source("plant-a")
+        .build()
+        .unwrap_err();
+    assert_eq!(err.field(), "stream");
+
+    let err = FluxEvent::builder("sensors").build().unwrap_err();
+    assert_eq!(err.code(), ValidationErrorCode::Missing);
+}
+
+#[test]
+fn test_builder_can_be_shared() {
+    let base = FluxEvent::builder("sensors").source("plant-a");
+    let a = base.clone().key("a").must_build();
+    let b = base.key("b").must_build();
+    assert_eq!(a.key.as_deref(), Some("a"));
+    assert_eq!(b.key.as_deref(), Some("b"));
+    assert_ne!(a.event_id, b.event_id);
+}
+
+#[test]
+#[should_panic(expected = "invalid event")]
+fn test_must_build_panics_on_invalid() {
+    FluxEvent::builder("sensors").must_build();
+}
+
+#[test]
+fn test_clone_is_independent() {
+    let original = FluxEvent::builder("sensors")
+        .source("plant-a")
+        .payload(json!({"entity_id": "sensor-01", "properties": {"t": 1}}))
+        .must_build();
+
+    let mut copy = original.clone();
+    copy.payload["properties"]["t"] = json!(2);
+    copy.key = Some("zone1".to_string());
+    assert_eq!(original.payload["properties"]["t"], 1);
+    assert_eq!(original.key, None);
+
+    let mut original = original;
+    original.payload["entity_id"] = json!("sensor-02");
+    assert_eq!(copy.payload["entity_id"], "sensor-01");
+}
+
+#[test]
+fn test_clone_with_stream() {
+    let original = FluxEvent::builder("sensors.raw")
+        .source("plant-a")
+        .key("zone1")
+        .payload(json!({"entity_id": "sensor-01"}))
+        .must_build();
+
+    let mut rerouted = original.clone_with_stream("sensors.clean");
+    assert_eq!(rerouted.stream, "sensors.clean");
+    assert_eq!(rerouted.event_id, original.event_id);
+    assert_eq!(rerouted.key, original.key);
+    assert_eq!(rerouted.payload, original.payload);
+
+    rerouted.payload["entity_id"] = json!("sensor-02");
+    assert_eq!(original.stream, "sensors.raw");
+    assert_eq!(original.payload["entity_id"], "sensor-01");
+}
+
+#[test]
+fn test_stream_length_and_depth_limits() {
+    let build = |stream: &str| {
+        FluxEvent::builder(stream)
+            .source("test")
+            .payload(json!({}))
+            .build()
+    };
+
+    assert!(build(&"a".repeat(MAX_STREAM_NAME_LENGTH)).is_ok());
+    let err = build(&"a".repeat(MAX_STREAM_NAME_LENGTH + 1)).unwrap_err();
+    assert_eq!(err, ValidationError::StreamTooLong(65));
+    assert_eq!(err.code(), ValidationErrorCode::TooLong);
+    assert_eq!(err.field(), "stream");
+
+    assert!(build("a.b.c.d.e").is_ok());
+    let err = build("a.b.c.d.e.f").unwrap_err();
+    assert_eq!(err, ValidationError::StreamTooDeep(6));
+    assert_eq!(err.code(), ValidationErrorCode::OutOfRange);
+    assert_eq!(err.field(), "stream");
+}
+
+#[test]
+fn test_validate_with_source_options() {
+    let options = ValidationOptions {
+        allowed_sources: vec!["plant-*.scada".to_string(), "billing".to_string()],
+        max_source_length: Some(20),
+        ..Default::default()
+    };
+    let event = |source: &str| FluxEvent {
+        event_id: None,
+        stream: "sensors".to_string(),
+        source: source.to_string(),
+        timestamp: 1707668400000,
+        key: None,
+        schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
+        payload: json!({}),
+        raw_payload: None,
+    };
+
+    assert!(event("plant-a.scada").validate_with_options(&options).is_ok());
+    assert!(event("billing").validate_with_options(&options).is_ok());
+
+    let err = event("billing-v2").validate_with_options(&options).unwrap_err();
+    assert_eq!(err, ValidationError::SourceNotAllowed("billing-v2".to_string()));
+    assert_eq!(err.code(), ValidationErrorCode::NotAllowed);
+    assert_eq!(err.code().http_status(), 403);
+    assert_eq!(err.field(), "source");
+
+    let err = event("plant-north-line-2.scada")
+        .validate_with_options(&options)
+        .unwrap_err();
+    assert_eq!(err, ValidationError::SourceTooLong(24));
+    assert_eq!(err.code(), ValidationErrorCode::TooLong);
+
+    // Envelope rules still apply first
+    let err = event("").validate_with_options(&options).unwrap_err();
+    assert_eq!(err, ValidationError::MissingSource);
+
+    // Default options accept any source
+    assert!(event("anything")
+        .validate_with_options(&ValidationOptions::default())
+        .is_ok());
+}
+
+fn source_event(source: &str) -> FluxEvent {
+    FluxEvent {
+        event_id: None,
+        stream: "sensors".to_string(),
+        source: source.to_string(),
+        timestamp: 1707668400000,
+        key: None,
+        schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
+        payload: json!({}),
+        raw_payload: None,
+    }
+}
+
+#[test]
+fn test_source_normalization() {
+    assert_eq!(normalize_source("  IGNITION-GW1 "), "ignition-gw1");
+    assert_eq!(normalize_source("ignition.gateway.prod"), "ignition.gateway.prod");
+    // Only trimmed and lowercased: still not a valid source
+    assert_eq!(normalize_source("Ignition Gateway #1"), "ignition gateway #1");
+    assert!(!is_valid_source("ignition gateway #1"));
+
+    let lenient = ValidationOptions {
+        source_format: SourceFormatMode::Lenient,
+        ..Default::default()
+    };
+    let mut event = source_event(" IGNITION-GW1");
+    assert_eq!(lenient.normalized_source(&event).as_deref(), Some("ignition-gw1"));
+    event.validate_with_options(&lenient).unwrap();
+    assert_eq!(event.source, "ignition-gw1");
+    assert!(!lenient.normalize_source(&mut event));
+
+    let err = source_event("Ignition Gateway #1")
+        .validate_with_options(&lenient)
+        .unwrap_err();
+    assert_eq!(
+        err,
+        ValidationError::InvalidSourceFormat("ignition gateway #1".to_string())
+    );
+
+    // Other modes leave sources alone
+    let mut event = source_event("IGNITION-GW1");
+    assert!(!ValidationOptions::default().normalize_source(&mut event));
+    assert!(event.validate_with_options(&ValidationOptions::default()).is_ok());
+}
+
+#[test]
+fn test_strict_source_format() {
+    let strict = ValidationOptions {
+        source_format: SourceFormatMode::Strict,
+        ..Default::default()
+    };
+    assert!(source_event("ignition.gateway-1")
+        .validate_with_options(&strict)
+        .is_ok());
+
+    for source in ["IGNITION-GW1", " ignition-gw1", "ignition_gw1", "gw/1"] {
+        let err = source_event(source)
+            .validate_with_options(&strict)
+            .unwrap_err();
+        assert_eq!(err, ValidationError::InvalidSourceFormat(source.to_string()));
+        assert_eq!(err.code(), ValidationErrorCode::InvalidFormat);
+        assert_eq!(err.field(), "source");
+    }
+}
+
+#[test]
+fn test_source_length_boundary() {
+    let strict = ValidationOptions {
+        source_format: SourceFormatMode::Strict,
+        ..Default::default()
+    };
+    let longest = "a".repeat(MAX_SOURCE_LENGTH);
+    assert!(is_valid_source(&longest));
+    assert!(source_event(&longest).validate_with_options(&strict).is_ok());
+
+    let too_long = "a".repeat(MAX_SOURCE_LENGTH + 1);
+    assert!(!is_valid_source(&too_long));
+    let err = source_event(&too_long)
+        .validate_with_options(&strict)
+        .unwrap_err();
+    assert_eq!(err, ValidationError::SourceTooLong(129));
+    assert_eq!(err.code(), ValidationErrorCode::TooLong);
+
+    // Free-text sources have no length limit of their own
+    assert!(source_event(&too_long)
+        .validate_with_options(&ValidationOptions::default())
+        .is_ok());
+}
+
+#[test]
+fn test_timestamp_skew_limits() {
+    const DAY_MS: i64 = 24 * 3600 * 1000;
+    const YEAR_MS: i64 = 365 * DAY_MS;
+    let now = 1707668400000;
+    let options = ValidationOptions {
+        max_timestamp_skew_backward: Some(std::time::Duration::from_secs(24 * 3600)),
+        max_timestamp_skew_forward: Some(std::time::Duration::from_secs(60)),
+        ..Default::default()
+    };
+    let event = |timestamp: i64| FluxEvent {
+        event_id: None,
+        stream: "sensors".to_string(),
+        source: "plant-a".to_string(),
+        timestamp,
+        key: None,
+        schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
+        payload: json!({}),
+        raw_payload: None,
+    };
+
+    assert!(options.check_at(&event(now), now).is_ok());
+    assert!(options.check_at(&event(now - DAY_MS), now).is_ok());
+    assert!(options.check_at(&event(now + 60_000), now).is_ok());
+
+    let err = options.check_at(&event(now - YEAR_MS), now).unwrap_err();
+    assert_eq!(err, ValidationError::TimestampSkewed(-YEAR_MS));
+    assert_eq!(err.code(), ValidationErrorCode::OutOfRange);
+    assert_eq!(err.field(), "timestamp");
+
+    let err = options.check_at(&event(now + YEAR_MS), now).unwrap_err();
+    assert_eq!(err, ValidationError::TimestampSkewed(YEAR_MS));
+
+    // No skew check by default
+    assert!(ValidationOptions::default()
+        .check_at(&event(now - YEAR_MS), now)
+        .is_ok());
+}
+
+fn on_stream(stream: &str) -> FluxEvent {
+    FluxEvent::builder(stream)
+        .source("plant-a")
+        .payload(json!({}))
+        .must_build()
+}
+
+#[test]
+fn test_reserved_stream_prefixes() {
+    let options = ValidationOptions {
+        stream_naming: StreamNamingPolicy::reserved(),
+        ..Default::default()
+    };
+
+    for stream in ["flux.system", "flux.system.audit", "flux.system.alerts"] {
+        let err = options.check(&on_stream(stream)).unwrap_err();
+        assert_eq!(err, ValidationError::StreamReserved(stream.to_string()));
+        assert_eq!(err.code(), ValidationErrorCode::Reserved);
+        assert_eq!(err.code().http_status(), 403);
+        assert_eq!(err.field(), "stream");
+    }
+    // Whole segments only
+    assert!(options.check(&on_stream("flux.systems")).is_ok());
+    assert!(options.check(&on_stream("sensors.flux.system")).is_ok());
+
+    // Flux's own publishers bypass reserved prefixes
+    let internal = options.internal();
+    assert!(internal.check(&on_stream("flux.system.audit")).is_ok());
+    assert_eq!(options.stream_naming.reserved_prefixes.len(), 1);
+}
+
+#[test]
+fn test_stream_naming_policy() {
+    let policy = StreamNamingPolicy {
+        pattern: Some("site-*".to_string()),
+        segments: Some(3),
+        ..StreamNamingPolicy::reserved()
+    };
+
+    assert!(policy.check("site-north.line2.temp").is_ok());
+    for stream in ["site-north.temp", "site-north.line2.temp.max", "plant.line2.temp"] {
+        let err = policy.check(stream).unwrap_err();
+        assert_eq!(err, ValidationError::StreamNamingPolicy(stream.to_string()));
+        assert_eq!(err.code(), ValidationErrorCode::NamingPolicy);
+        assert_eq!(err.code().http_status(), 400);
+    }
+    // Reserved prefixes are checked first
+    assert_eq!(
+        policy.check("flux.system.audit"),
+        Err(ValidationError::StreamReserved("flux.system.audit".to_string()))
+    );
+
+    // Default policy allows any valid name
+    assert!(StreamNamingPolicy::default().check("flux.system.audit").is_ok());
+}
+
+#[test]
+fn test_display_is_compact() {
+    let event = FluxEvent {
+        event_id: Some("0190a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5b".to_string()),
+        stream: "alarms.events".to_string(),
+        source: "plant-a".to_string(),
+        timestamp: 1705314600000, // 2024-01-15 10:30:00 UTC
+        key: None,
+        schema: Some("alarm.raise.v1".to_string()),
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
+        payload: json!({}),
+        raw_payload: None,
+    };
+    assert_eq!(
+        event.to_string(),
+        "Event[id=0190a1b2, stream=alarms.events, source=plant-a, ts=2024-01-15T10:30:00Z, schema=alarm.raise.v1]"
+    );
+
+    let mut event = event;
+    event.event_id = None;
+    event.schema = None;
+    event.timestamp += 250;
+    assert_eq!(
+        event.to_string(),
+        "Event[id=none, stream=alarms.events, source=plant-a, ts=2024-01-15T10:30:00.250Z]"
+    );
+}
+
+#[test]
+fn test_display_omits_payload() {
+    let event = FluxEvent::builder("customers")
+        .source("crm")
+        .key("c-42")
+        .payload(json!({
+            "entity_id": "c-42",
+            "properties": {"email": "jane@example.com", "ssn": "078-05-1120"}
+        }))
+        .build()
+        .unwrap();
+
+    let shown = event.to_string();
+    assert!(shown.contains("key=c-42"));
+    assert!(!shown.contains("jane@example.com"));
+    assert!(!shown.contains("078-05-1120"));
+    assert!(!shown.contains("properties"));
+    // Debug keeps every field
+    assert!(format!("{:?}", event).contains("jane@example.com"));
+}
+
+#[test]
+fn test_envelope_version_stamped_from_fields() {
+    let v1 = FluxEvent::builder("sensors")
+        .source("test")
+        .payload(json!({}))
+        .build()
+        .unwrap();
+    assert_eq!(v1.envelope_version, None);
+    assert_eq!(v1.envelope_version(), 1);
+    // v1 events serialize exactly as before
+    assert!(serde_json::to_value(&v1)
+        .unwrap()
+        .get("envelopeVersion")
+        .is_none());
+
+    let v2 = FluxEvent::builder("sensors")
+        .source("test")
+        .priority(Priority::Low)
+        .payload(json!({}))
+        .build()
+        .unwrap();
+    assert_eq!(v2.envelope_version, Some(2));
+    assert_eq!(serde_json::to_value(&v2).unwrap()["envelopeVersion"], 2);
+
+    // Workflow chain fields need v3
+    let mut v1 = v1;
+    v1.validate_and_prepare().unwrap();
+    let mut next = v1.next("sensors", "test", "sensor.reading@1", json!({}));
+    next.validate_and_prepare().unwrap();
+    assert_eq!(next.envelope_version, Some(3));
+    assert!(check_envelope_version(&next, ENVELOPE_V1, 2).is_err());
+
+    let mut correlated = FluxEvent::builder("sensors")
+        .source("test")
+        .priority(Priority::High)
+        .payload(json!({}))
+        .build()
+        .unwrap();
+    correlated.correlation_id = Some("order-42".to_string());
+    correlated.validate_and_prepare().unwrap();
+    assert_eq!(correlated.envelope_version, Some(3));
+
+    // So do TTLs and receivedAt: a v1 consumer would not drop expired events
+    let expiring = FluxEvent::builder("sensors")
+        .source("test")
+        .ttl(std::time::Duration::from_secs(60))
+        .payload(json!({}))
+        .build()
+        .unwrap();
+    assert_eq!(expiring.envelope_version, Some(3));
+
+    let mut received: FluxEvent = serde_json::from_value(json!({
+        "stream": "sensors",
+        "source": "test",
+        "timestamp": 1707668400000i64,
+        "receivedAt": 1707668400123i64,
+        "payload": {}
+    }))
+    .unwrap();
+    received.validate_and_prepare().unwrap();
+    assert_eq!(received.envelope_version, Some(3));
+}
+
+#[test]
+fn test_envelope_version_range() {
+    let mut event: FluxEvent = serde_json::from_value(json!({
+        "stream": "sensors",
+        "source": "test",
+        "timestamp": 1707668400000i64,
+        "envelopeVersion": 99,
+        "payload": {}
+    }))
+    .unwrap();
+    let err = event.validate_and_prepare().unwrap_err();
+    assert_eq!(err, ValidationError::UnsupportedEnvelopeVersion(99));
+    assert_eq!(err.field(), "envelopeVersion");
+    assert_eq!(err.code(), ValidationErrorCode::OutOfRange);
+
+    event.envelope_version = Some(1);
+    event.validate_and_prepare().unwrap();
+    assert!(check_envelope_version(&event, 1, 1).is_ok());
+    assert!(check_envelope_version(&event, 2, CURRENT_ENVELOPE_VERSION).is_err());
+}
+
+#[test]
+fn test_payload_too_large_error() {
+    let err = ValidationError::PayloadTooLarge(2048);
+    assert_eq!(err.field(), "payload");
+    assert_eq!(err.code(), ValidationErrorCode::PayloadTooLarge);
+    assert_eq!(err.code().as_str(), "payload_too_large");
+    assert_eq!(err.code().http_status(), 413);
+
+    // Over-long names are not fixed by sending a smaller body
+    assert_eq!(ValidationError::KeyTooLong(300).code().http_status(), 400);
+    assert_eq!(ValidationError::StreamTooLong(65).code().http_status(), 400);
+}
+
+#[test]
+fn test_canonical_form_ignores_key_order() {
+    let parse = |json: &str| serde_json::from_str::<FluxEvent>(json).unwrap();
+    let a = parse(
+        r#"{"eventId":"0190a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5b","stream":"sensors","source":"plant-a",
+            "timestamp":1707668400000,"payload":{"entity_id":"s1","properties":{"temp":21.0,"unit":"c"}}}"#,
+    );
+    let b = parse(
+        r#"{"payload":{"properties":{"unit":"c","temp":21},"entity_id":"s1"},"timestamp":1707668400000,
+            "source":"plant-a","stream":"sensors","eventId":"0190a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5b"}"#,
+    );
+
+    let canonical = canonicalize_event(&a).unwrap();
+    assert_eq!(canonical, canonicalize_event(&b).unwrap());
+    assert_eq!(
+        String::from_utf8(canonical).unwrap(),
+        r#"{"eventId":"0190a1b2-c3d4-7e5f-8a9b-0c1d2e3f4a5b","payload":{"entity_id":"s1","properties":{"temp":21,"unit":"c"}},"source":"plant-a","stream":"sensors","timestamp":1707668400000}"#
+    );
+    assert_eq!(a.content_hash().unwrap(), b.content_hash().unwrap());
+    assert_eq!(a.content_hash().unwrap().len(), 64);
+
+    let mut c = a.clone();
+    c.payload["properties"]["temp"] = json!(21.5);
+    assert_ne!(c.content_hash().unwrap(), a.content_hash().unwrap());
+}
+
+#[test]
+fn test_metadata_without_payload() {
+    let event = FluxEvent::builder("sensors.temp")
+        .source("plant-a")
+        .key("s1")
+        .schema("reading.v1")
+        .payload(json!({"entity_id": "s1", "properties": {"samples": vec![0.5; 1000]}}))
+        .must_build();
+    let data = serde_json::to_vec(&event).unwrap();
+
+    let metadata = EventMetadata::from_json(&data).unwrap();
+    assert_eq!(metadata.event_id, event.event_id);
+    assert_eq!(metadata.stream, "sensors.temp");
+    assert_eq!(metadata.source, "plant-a");
+    assert_eq!(metadata.timestamp, event.timestamp);
+    assert_eq!(metadata.key.as_deref(), Some("s1"));
+    assert_eq!(metadata.schema.as_deref(), Some("reading.v1"));
+
+    let minimal = br#"{"stream":"a","source":"b","timestamp":1,"payload":{}}"#;
+    let metadata = EventMetadata::from_json(minimal).unwrap();
+    assert_eq!(metadata.event_id, None);
+    assert_eq!(metadata.key, None);
+
+    // Still rejects malformed JSON, payload included
+    let truncated = br#"{"stream":"a","source":"b","timestamp":1,"payload":{"#;
+    assert!(EventMetadata::from_json(truncated).is_err());
+    assert!(EventMetadata::from_json(br#"{"source":"b","timestamp":1}"#).is_err());
+}
+
+#[test]
+fn test_key_validated_and_case_preserved() {
+    let with_key = |key: &str| {
+        FluxEvent::builder("sensors.temp")
+            .source("plant-a")
+            .key(key)
+            .payload(json!({}))
+            .build()
+    };
+
+    let event = with_key(&"K".repeat(MAX_KEY_LENGTH)).unwrap();
+    assert_eq!(event.key.as_deref().map(str::len), Some(MAX_KEY_LENGTH));
+
+    let err = with_key(&"k".repeat(MAX_KEY_LENGTH + 1)).unwrap_err();
+    assert_eq!(err, ValidationError::KeyTooLong(MAX_KEY_LENGTH + 1));
+    assert_eq!(err.code(), ValidationErrorCode::TooLong);
+    assert_eq!(err.field(), "key");
+
+    for key in ["zone 1", "zone.>", "*", "a..b"] {
+        let err = with_key(key).unwrap_err();
+        assert_eq!(err, ValidationError::InvalidKey(key.to_string()));
+        assert_eq!(err.code(), ValidationErrorCode::InvalidFormat);
+    }
+
+    // An empty key means no key
+    assert_eq!(with_key("").unwrap().key, None);
+
+    // The envelope keeps the key's case through a round trip; only the
+    // subject form is normalized
+    let event = with_key("Plant.Zone1").unwrap();
+    let decoded: FluxEvent = serde_json::from_slice(&serde_json::to_vec(&event).unwrap()).unwrap();
+    assert_eq!(decoded.key.as_deref(), Some("Plant.Zone1"));
+    assert_eq!(
+        sanitize_key(decoded.key.as_deref().unwrap()),
+        "plant_2ezone1"
+    );
+    assert_eq!(sanitize_key("Plant.Zone1"), sanitize_key("plant.zone1"));
+}
+
+#[test]
+fn test_ttl_expiry() {
+    let event = FluxEvent::builder("alarms")
+        .source("plc-01")
+        .timestamp_millis(1707668400000)
+        .ttl(std::time::Duration::from_secs(30))
+        .payload(json!({}))
+        .must_build();
+    assert_eq!(event.ttl_ms, Some(30_000));
+    assert!(!event.is_expired(1707668400000 + 30_000));
+    assert!(event.is_expired(1707668400000 + 30_001));
+
+    // Absent and zero TTLs never expire
+    let mut event = event;
+    event.ttl_ms = Some(0);
+    assert!(!event.is_expired(i64::MAX));
+    event.ttl_ms = None;
+    assert!(!event.is_expired(i64::MAX));
+
+    let parsed: FluxEvent = serde_json::from_value(json!({
+        "stream": "alarms",
+        "source": "plc-01",
+        "timestamp": 1707668400000i64,
+        "ttlMs": 5000,
+        "payload": {}
+    }))
+    .unwrap();
+    assert_eq!(parsed.ttl_ms, Some(5000));
+}
+
+#[test]
+fn test_event_chain() {
+    let received = FluxEvent::builder("orders.requests")
+        .source("api-gateway")
+        .payload(json!({"order": 42}))
+        .must_build();
+    let started = received.next(
+        "orders.processing",
+        "order-worker",
+        "processing_started.v1",
+        json!({"order": 42}),
+    );
+    let completed = started.next(
+        "orders.completed",
+        "order-worker",
+        "completed.v1",
+        json!({"order": 42, "ok": true}),
+    );
+
+    // The chain is correlated by its first event
+    let root = received.event_id.clone();
+    assert_eq!(received.correlation_id, None);
+    assert_eq!(started.correlation_id, root);
+    assert_eq!(completed.correlation_id, root);
+    assert_eq!(started.parent_event_id, received.event_id);
+    assert_eq!(completed.parent_event_id, started.event_id);
+    assert_ne!(completed.event_id, started.event_id);
+    assert_eq!(completed.schema.as_deref(), Some("completed.v1"));
+
+    // A producer-supplied correlation id is carried instead
+    let mut tagged = received.clone();
+    tagged.correlation_id = Some("checkout-7".to_string());
+    let next = tagged.next("orders.processing", "order-worker", "v1", json!({}));
+    assert_eq!(next.correlation_id.as_deref(), Some("checkout-7"));
+
+    // Lineage survives the JSON envelope and validation
+    let mut decoded: FluxEvent =
+        serde_json::from_slice(&serde_json::to_vec(&completed).unwrap()).unwrap();
+    decoded.validate_and_prepare().unwrap();
+    assert_eq!(decoded.parent_event_id, started.event_id);
+    assert_eq!(decoded.correlation_id, root);
+}
+
+#[test]
+fn test_parent_event_id_validated() {
+    let with_parent = |parent: &str| {
+        let mut event = FluxEvent::builder("orders.completed")
+            .source("order-worker")
+            .payload(json!({}))
+            .must_build();
+        event.parent_event_id = Some(parent.to_string());
+        event.validate_and_prepare().map(|_| event)
+    };
+
+    assert!(with_parent("0190a1b2-0000-7000-8000-000000000001").is_ok());
+    // An empty parent means no parent
+    assert_eq!(with_parent("").unwrap().parent_event_id, None);
+
+    let err = with_parent("order-41").unwrap_err();
+    assert_eq!(
+        err,
+        ValidationError::InvalidParentEventId("order-41".to_string())
+    );
+    assert_eq!(err.code(), ValidationErrorCode::InvalidFormat);
+    assert_eq!(err.field(), "parentEventId");
+}
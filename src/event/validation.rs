@@ -1,7 +1,26 @@
-use super::FluxEvent;
+use super::{default_clock, FluxEvent, CURRENT_ENVELOPE_VERSION, ENVELOPE_V1};
+use serde::{Deserialize, Serialize};
 use std::fmt;
+use std::sync::{Arc, RwLock};
+use std::time::Duration;
 use uuid::Uuid;
 
+/// Longest accepted stream name, in bytes
+pub const MAX_STREAM_NAME_LENGTH: usize = 64;
+
+/// Most dot-separated segments in a stream name (`a.b.c.d.e`)
+pub const MAX_STREAM_DEPTH: usize = 5;
+
+/// Longest accepted event key, in bytes
+pub const MAX_KEY_LENGTH: usize = 256;
+
+/// Longest source accepted by the source format (`is_valid_source`), in bytes
+pub const MAX_SOURCE_LENGTH: usize = 128;
+
+/// Prefix of Flux's own streams (alerts, health, audit, dead letters), which
+/// external producers may not publish to by default
+pub const RESERVED_STREAM_PREFIX: &str = "flux.system";
+
 /// Validation errors for FluxEvent
 #[derive(Debug, Clone, PartialEq)]
 pub enum ValidationError {
@@ -9,8 +28,39 @@ pub enum ValidationError {
     MissingSource,
     MissingPayload,
     InvalidStreamFormat(String),
+    /// Stream name longer than `MAX_STREAM_NAME_LENGTH` (carries the length)
+    StreamTooLong(usize),
+    /// Stream name with more than `MAX_STREAM_DEPTH` segments (carries the depth)
+    StreamTooDeep(usize),
     InvalidTimestamp(i64),
     PayloadNotObject,
+    /// Source longer than `ValidationOptions::max_source_length` (carries the length)
+    SourceTooLong(usize),
+    /// Source matches no `ValidationOptions::allowed_sources` pattern
+    SourceNotAllowed(String),
+    /// Source outside the source format (`is_valid_source`), when enforced
+    /// (carries the source)
+    InvalidSourceFormat(String),
+    /// Envelope version outside the accepted range (carries the version)
+    UnsupportedEnvelopeVersion(u32),
+    /// Encoded event larger than the stream's max message size (carries the size)
+    PayloadTooLarge(usize),
+    /// Timestamp further from now than the allowed skew (carries the offset
+    /// in milliseconds; negative = in the past)
+    TimestampSkewed(i64),
+    /// Stream under a reserved prefix (carries the stream)
+    StreamReserved(String),
+    /// Stream outside the configured naming policy (carries the stream)
+    StreamNamingPolicy(String),
+    /// Key longer than `MAX_KEY_LENGTH` (carries the length)
+    KeyTooLong(usize),
+    /// Key with characters outside `is_valid_key` (carries the key)
+    InvalidKey(String),
+    /// TTL of zero, or not shorter than the stream's retention (carries the
+    /// TTL in milliseconds)
+    TtlOutOfRange(u64),
+    /// Parent event id that is not a UUID (carries the id)
+    InvalidParentEventId(String),
 }
 
 impl fmt::Display for ValidationError {
@@ -22,25 +72,400 @@ impl fmt::Display for ValidationError {
             ValidationError::InvalidStreamFormat(s) => {
                 write!(f, "invalid stream format '{}': must be lowercase with optional dots", s)
             }
+            ValidationError::StreamTooLong(len) => write!(
+                f,
+                "stream name is {} bytes, limit is {}",
+                len, MAX_STREAM_NAME_LENGTH
+            ),
+            ValidationError::StreamTooDeep(depth) => write!(
+                f,
+                "stream name has {} segments, limit is {}",
+                depth, MAX_STREAM_DEPTH
+            ),
             ValidationError::InvalidTimestamp(ts) => {
                 write!(f, "timestamp must be positive, got {}", ts)
             }
             ValidationError::PayloadNotObject => {
                 write!(f, "payload must be a JSON object")
             }
+            ValidationError::SourceTooLong(len) => {
+                write!(f, "source is {} bytes, longer than allowed", len)
+            }
+            ValidationError::SourceNotAllowed(source) => {
+                write!(f, "source '{}' is not in the allow-list", source)
+            }
+            ValidationError::InvalidSourceFormat(source) => write!(
+                f,
+                "invalid source '{}': must be lowercase letters, digits, dots and hyphens",
+                source
+            ),
+            ValidationError::UnsupportedEnvelopeVersion(version) => {
+                write!(f, "envelope version {} is not supported", version)
+            }
+            ValidationError::PayloadTooLarge(size) => write!(
+                f,
+                "event is {} bytes, larger than the stream's max message size",
+                size
+            ),
+            ValidationError::TimestampSkewed(offset_ms) if *offset_ms < 0 => write!(
+                f,
+                "timestamp is {}ms in the past, beyond the allowed skew",
+                -offset_ms
+            ),
+            ValidationError::TimestampSkewed(offset_ms) => write!(
+                f,
+                "timestamp is {}ms in the future, beyond the allowed skew",
+                offset_ms
+            ),
+            ValidationError::StreamReserved(stream) => {
+                write!(f, "stream '{}' is reserved for internal use", stream)
+            }
+            ValidationError::StreamNamingPolicy(stream) => {
+                write!(f, "stream '{}' does not follow the naming policy", stream)
+            }
+            ValidationError::KeyTooLong(len) => {
+                write!(f, "key is {} bytes, limit is {}", len, MAX_KEY_LENGTH)
+            }
+            ValidationError::InvalidKey(key) => write!(
+                f,
+                "invalid key '{}': must be letters, digits and -/_=. without empty segments",
+                key
+            ),
+            ValidationError::TtlOutOfRange(ttl_ms) => write!(
+                f,
+                "ttl of {}ms must be positive and shorter than the stream's retention",
+                ttl_ms
+            ),
+            ValidationError::InvalidParentEventId(id) => {
+                write!(f, "invalid parentEventId '{}': must be a UUID", id)
+            }
         }
     }
 }
 
 impl std::error::Error for ValidationError {}
 
+/// Machine-readable category of a validation failure.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum ValidationErrorCode {
+    /// Required field absent or empty
+    Missing,
+    /// Field present but malformed
+    InvalidFormat,
+    /// Stream, source or key exceeds its length limit
+    TooLong,
+    /// Payload or encoded event exceeds its size limit
+    PayloadTooLarge,
+    /// Numeric field outside its allowed range
+    OutOfRange,
+    /// Value rejected by policy (e.g. source allow-list)
+    NotAllowed,
+    /// Stream under a reserved prefix
+    Reserved,
+    /// Stream name outside the deployment's naming policy
+    NamingPolicy,
+}
+
+impl ValidationErrorCode {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            ValidationErrorCode::Missing => "missing",
+            ValidationErrorCode::InvalidFormat => "invalid_format",
+            ValidationErrorCode::TooLong => "too_long",
+            ValidationErrorCode::PayloadTooLarge => "payload_too_large",
+            ValidationErrorCode::OutOfRange => "out_of_range",
+            ValidationErrorCode::NotAllowed => "not_allowed",
+            ValidationErrorCode::Reserved => "reserved",
+            ValidationErrorCode::NamingPolicy => "naming_policy",
+        }
+    }
+
+    /// HTTP status code for this kind of failure. Only an oversized payload
+    /// is 413: a client can retry that with less data, not a long name.
+    pub fn http_status(&self) -> u16 {
+        match self {
+            ValidationErrorCode::PayloadTooLarge => 413,
+            ValidationErrorCode::NotAllowed | ValidationErrorCode::Reserved => 403,
+            _ => 400,
+        }
+    }
+}
+
+impl ValidationError {
+    /// Machine-readable error code
+    pub fn code(&self) -> ValidationErrorCode {
+        match self {
+            ValidationError::MissingStream
+            | ValidationError::MissingSource
+            | ValidationError::MissingPayload => ValidationErrorCode::Missing,
+            ValidationError::InvalidStreamFormat(_)
+            | ValidationError::PayloadNotObject
+            | ValidationError::InvalidKey(_)
+            | ValidationError::InvalidSourceFormat(_)
+            | ValidationError::InvalidParentEventId(_) => ValidationErrorCode::InvalidFormat,
+            ValidationError::StreamTooLong(_)
+            | ValidationError::SourceTooLong(_)
+            | ValidationError::KeyTooLong(_) => ValidationErrorCode::TooLong,
+            ValidationError::PayloadTooLarge(_) => ValidationErrorCode::PayloadTooLarge,
+            ValidationError::SourceNotAllowed(_) => ValidationErrorCode::NotAllowed,
+            ValidationError::StreamReserved(_) => ValidationErrorCode::Reserved,
+            ValidationError::StreamNamingPolicy(_) => ValidationErrorCode::NamingPolicy,
+            ValidationError::UnsupportedEnvelopeVersion(_) => ValidationErrorCode::OutOfRange,
+            ValidationError::InvalidTimestamp(_)
+            | ValidationError::TimestampSkewed(_)
+            | ValidationError::StreamTooDeep(_)
+            | ValidationError::TtlOutOfRange(_) => ValidationErrorCode::OutOfRange,
+        }
+    }
+
+    /// Name of the offending event field
+    pub fn field(&self) -> &'static str {
+        match self {
+            ValidationError::MissingStream
+            | ValidationError::InvalidStreamFormat(_)
+            | ValidationError::StreamTooLong(_)
+            | ValidationError::StreamTooDeep(_)
+            | ValidationError::StreamReserved(_)
+            | ValidationError::StreamNamingPolicy(_) => "stream",
+            ValidationError::MissingSource
+            | ValidationError::SourceTooLong(_)
+            | ValidationError::SourceNotAllowed(_)
+            | ValidationError::InvalidSourceFormat(_) => "source",
+            ValidationError::MissingPayload
+            | ValidationError::PayloadNotObject
+            | ValidationError::PayloadTooLarge(_) => "payload",
+            ValidationError::InvalidTimestamp(_) | ValidationError::TimestampSkewed(_) => {
+                "timestamp"
+            }
+            ValidationError::UnsupportedEnvelopeVersion(_) => "envelopeVersion",
+            ValidationError::KeyTooLong(_) | ValidationError::InvalidKey(_) => "key",
+            ValidationError::TtlOutOfRange(_) => "ttlMs",
+            ValidationError::InvalidParentEventId(_) => "parentEventId",
+        }
+    }
+}
+
+/// Which stream names producers may use, on top of the envelope format
+/// rules. The default policy allows every valid name.
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct StreamNamingPolicy {
+    /// Streams equal to or under one of these (whole segments, so
+    /// `flux.system` reserves `flux.system.audit` but not `flux.systems`)
+    pub reserved_prefixes: Vec<String>,
+    /// Glob stream names must match (`*` any run, `?` one character)
+    pub pattern: Option<String>,
+    /// Exact number of dot-separated segments required
+    pub segments: Option<usize>,
+}
+
+impl StreamNamingPolicy {
+    /// Policy reserving `RESERVED_STREAM_PREFIX` only.
+    pub fn reserved() -> Self {
+        Self {
+            reserved_prefixes: vec![RESERVED_STREAM_PREFIX.to_string()],
+            ..Default::default()
+        }
+    }
+
+    /// True if `stream` is under a reserved prefix.
+    pub fn is_reserved(&self, stream: &str) -> bool {
+        self.reserved_prefixes.iter().any(|prefix| {
+            stream
+                .strip_prefix(prefix.as_str())
+                .map_or(false, |rest| rest.is_empty() || rest.starts_with('.'))
+        })
+    }
+
+    /// Fail with `StreamReserved` or `StreamNamingPolicy` if `stream` breaks
+    /// the policy.
+    pub fn check(&self, stream: &str) -> Result<(), ValidationError> {
+        if self.is_reserved(stream) {
+            return Err(ValidationError::StreamReserved(stream.to_string()));
+        }
+        let segments_ok = self.segments.map_or(true, |n| stream_depth(stream) == n);
+        let pattern_ok = self
+            .pattern
+            .as_deref()
+            .map_or(true, |pattern| glob_match(pattern, stream));
+        if !segments_ok || !pattern_ok {
+            return Err(ValidationError::StreamNamingPolicy(stream.to_string()));
+        }
+        Ok(())
+    }
+}
+
+/// Whether sources must follow the source format (`is_valid_source`), so
+/// one device does not show up as `IGNITION-GW1` and `ignition-gw1`.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum SourceFormatMode {
+    /// Sources are free text
+    #[default]
+    Off,
+    /// Normalize sources first (`normalize_source`), then require the format
+    Lenient,
+    /// Require the format as sent
+    Strict,
+}
+
+/// Deployment-specific checks applied on top of the envelope rules.
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct ValidationOptions {
+    /// Accepted sources: exact names or globs (`*` any run, `?` one character),
+    /// e.g. `plant-*.scada`. Empty allows every source.
+    pub allowed_sources: Vec<String>,
+    /// Longest accepted source, in bytes (None = unlimited)
+    pub max_source_length: Option<usize>,
+    /// Reject timestamps further than this before now (None = no check)
+    pub max_timestamp_skew_backward: Option<Duration>,
+    /// Reject timestamps further than this after now (None = no check)
+    pub max_timestamp_skew_forward: Option<Duration>,
+    pub stream_naming: StreamNamingPolicy,
+    pub source_format: SourceFormatMode,
+}
+
+/// Validation options shared by every copy of a publisher, so a config
+/// reload applies to all of them.
+pub type SharedValidationOptions = Arc<RwLock<ValidationOptions>>;
+
+impl ValidationOptions {
+    /// These options for Flux's own publishers (audit, alerts, scheduler):
+    /// reserved stream prefixes are allowed, every other check still applies.
+    pub fn internal(&self) -> Self {
+        let mut options = self.clone();
+        options.stream_naming.reserved_prefixes.clear();
+        options
+    }
+
+    /// The source `event` should be published with: normalized in lenient
+    /// mode. None if it is already normalized, or in other modes.
+    pub fn normalized_source(&self, event: &FluxEvent) -> Option<String> {
+        if self.source_format != SourceFormatMode::Lenient {
+            return None;
+        }
+        let normalized = normalize_source(&event.source);
+        (normalized != event.source).then_some(normalized)
+    }
+
+    /// Normalize `event`'s source in lenient mode, returning true if it
+    /// changed (the producer should be told to send the normalized form).
+    pub fn normalize_source(&self, event: &mut FluxEvent) -> bool {
+        match self.normalized_source(event) {
+            Some(source) => {
+                event.source = source;
+                true
+            }
+            None => false,
+        }
+    }
+
+    /// Check the event against these options only (no envelope validation).
+    /// Timestamps are compared with `default_clock()`.
+    pub fn check(&self, event: &FluxEvent) -> Result<(), ValidationError> {
+        self.check_at(event, default_clock().now_millis())
+    }
+
+    /// `check` with "now" given in Unix milliseconds.
+    pub fn check_at(&self, event: &FluxEvent, now_ms: i64) -> Result<(), ValidationError> {
+        self.stream_naming.check(&event.stream)?;
+        let offset_ms = event.timestamp - now_ms;
+        let beyond = |skew: Option<Duration>| {
+            skew.map_or(false, |skew| offset_ms.unsigned_abs() as u128 > skew.as_millis())
+        };
+        if (offset_ms < 0 && beyond(self.max_timestamp_skew_backward))
+            || (offset_ms > 0 && beyond(self.max_timestamp_skew_forward))
+        {
+            return Err(ValidationError::TimestampSkewed(offset_ms));
+        }
+        if let Some(max) = self.max_source_length {
+            if event.source.len() > max {
+                return Err(ValidationError::SourceTooLong(event.source.len()));
+            }
+        }
+        if self.source_format != SourceFormatMode::Off {
+            if event.source.len() > MAX_SOURCE_LENGTH {
+                return Err(ValidationError::SourceTooLong(event.source.len()));
+            }
+            if !is_valid_source(&event.source) {
+                return Err(ValidationError::InvalidSourceFormat(event.source.clone()));
+            }
+        }
+        if !self.allowed_sources.is_empty()
+            && !self
+                .allowed_sources
+                .iter()
+                .any(|pattern| glob_match(pattern, &event.source))
+        {
+            return Err(ValidationError::SourceNotAllowed(event.source.clone()));
+        }
+        Ok(())
+    }
+}
+
+/// Fail unless the event's envelope version is within `min..=max`.
+pub fn check_envelope_version(event: &FluxEvent, min: u32, max: u32) -> Result<(), ValidationError> {
+    let version = event.envelope_version();
+    if version < min || version > max {
+        return Err(ValidationError::UnsupportedEnvelopeVersion(version));
+    }
+    Ok(())
+}
+
+/// `validate_and_prepare`, then the checks in `options`. In lenient source
+/// format mode the source is normalized first.
+pub fn validate_with_options(
+    event: &mut FluxEvent,
+    options: &ValidationOptions,
+) -> Result<(), ValidationError> {
+    options.normalize_source(event);
+    validate_and_prepare(event)?;
+    options.check(event)
+}
+
+/// Glob match where `*` matches any run of characters (including none and
+/// dots) and `?` exactly one character. Everything else matches literally.
+pub fn glob_match(pattern: &str, text: &str) -> bool {
+    let pattern: Vec<char> = pattern.chars().collect();
+    let text: Vec<char> = text.chars().collect();
+    let (mut p, mut t) = (0, 0);
+    // Position after the last '*' and the text position it was tried at
+    let mut backtrack: Option<(usize, usize)> = None;
+
+    while t < text.len() {
+        match pattern.get(p) {
+            Some('*') => {
+                p += 1;
+                backtrack = Some((p, t));
+            }
+            Some(&c) if c == '?' || c == text[t] => {
+                p += 1;
+                t += 1;
+            }
+            _ => match backtrack {
+                // Let the last '*' absorb one more character
+                Some((star_p, star_t)) => {
+                    p = star_p;
+                    t = star_t + 1;
+                    backtrack = Some((star_p, star_t + 1));
+                }
+                None => return false,
+            },
+        }
+    }
+    pattern[p..].iter().all(|&c| c == '*')
+}
+
 /// Validates and prepares a FluxEvent for ingestion.
 ///
 /// Validation rules:
 /// - Required fields: stream, source, timestamp, payload
-/// - Stream format: lowercase letters, numbers, dots (e.g., "sensors.temp")
+/// - Stream format: lowercase letters, numbers, dots (e.g., "sensors.temp"),
+///   at most 64 bytes and 5 segments
 /// - Timestamp: must be positive (Unix epoch milliseconds)
 /// - Payload: must be a JSON object (not array, string, etc.)
+/// - Key (optional): at most 256 bytes of `[-/_=.a-zA-Z0-9]` (see
+///   `is_valid_key`); an empty key is dropped
 /// - EventId: auto-generated UUIDv7 if missing or empty
 pub fn validate_and_prepare(event: &mut FluxEvent) -> Result<(), ValidationError> {
     // Validate required fields
@@ -54,7 +479,14 @@ pub fn validate_and_prepare(event: &mut FluxEvent) -> Result<(), ValidationError
         return Err(ValidationError::MissingPayload);
     }
 
-    // Validate stream format (lowercase, numbers, dots)
+    // Validate stream length and depth, then format (lowercase, numbers, dots)
+    if event.stream.len() > MAX_STREAM_NAME_LENGTH {
+        return Err(ValidationError::StreamTooLong(event.stream.len()));
+    }
+    let depth = stream_depth(&event.stream);
+    if depth > MAX_STREAM_DEPTH {
+        return Err(ValidationError::StreamTooDeep(depth));
+    }
     if !is_valid_stream_name(&event.stream) {
         return Err(ValidationError::InvalidStreamFormat(event.stream.clone()));
     }
@@ -69,6 +501,37 @@ pub fn validate_and_prepare(event: &mut FluxEvent) -> Result<(), ValidationError
         return Err(ValidationError::PayloadNotObject);
     }
 
+    // Validate key length and characters, treating "" as no key
+    if event.key.as_deref() == Some("") {
+        event.key = None;
+    }
+    if let Some(key) = &event.key {
+        if key.len() > MAX_KEY_LENGTH {
+            return Err(ValidationError::KeyTooLong(key.len()));
+        }
+        if !is_valid_key(key) {
+            return Err(ValidationError::InvalidKey(key.clone()));
+        }
+    }
+
+    // Validate the parent is a UUID, treating "" as no parent
+    if event.parent_event_id.as_deref() == Some("") {
+        event.parent_event_id = None;
+    }
+    if let Some(parent) = &event.parent_event_id {
+        if Uuid::parse_str(parent).is_err() {
+            return Err(ValidationError::InvalidParentEventId(parent.clone()));
+        }
+    }
+
+    // Reject versions newer than this build, then stamp the version the
+    // fields in use need (v1 events stay unstamped)
+    check_envelope_version(event, ENVELOPE_V1, CURRENT_ENVELOPE_VERSION)?;
+    let required = event.required_envelope_version();
+    if required > event.envelope_version() {
+        event.envelope_version = Some(required);
+    }
+
     // Generate UUIDv7 if missing or empty
     if event.event_id.is_none() || event.event_id.as_ref().map_or(false, |id| id.is_empty()) {
         event.event_id = Some(Uuid::now_v7().to_string());
@@ -85,8 +548,13 @@ pub fn validate_and_prepare(event: &mut FluxEvent) -> Result<(), ValidationError
 /// - Dots (.) for hierarchy
 /// - No leading/trailing dots
 /// - No consecutive dots
-fn is_valid_stream_name(stream: &str) -> bool {
-    if stream.is_empty() {
+/// - At most `MAX_STREAM_NAME_LENGTH` (64) bytes and `MAX_STREAM_DEPTH` (5)
+///   segments, so NATS subjects and consumer filters stay manageable
+pub fn is_valid_stream_name(stream: &str) -> bool {
+    if stream.is_empty()
+        || stream.len() > MAX_STREAM_NAME_LENGTH
+        || stream_depth(stream) > MAX_STREAM_DEPTH
+    {
         return false;
     }
 
@@ -104,6 +572,63 @@ fn is_valid_stream_name(stream: &str) -> bool {
     stream.chars().all(|c| c.is_ascii_lowercase() || c.is_ascii_digit() || c == '.')
 }
 
+/// Validates an event key.
+///
+/// Keys are what NATS KV accepts, so they can be stored and projected as-is:
+/// ASCII letters, digits and `-/_=.`, at most `MAX_KEY_LENGTH` bytes, with no
+/// leading, trailing or consecutive dots. Spaces and the NATS wildcards `*`
+/// and `>` are therefore never valid. Case is significant: `Zone1` and
+/// `zone1` are different keys in the envelope (see `sanitize_key`).
+pub fn is_valid_key(key: &str) -> bool {
+    !key.is_empty()
+        && key.len() <= MAX_KEY_LENGTH
+        && key.split('.').all(|segment| !segment.is_empty())
+        && key
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '/' | '_' | '=' | '.'))
+}
+
+/// Validates a source against the source format: lowercase ASCII letters,
+/// digits, dots and hyphens, at most `MAX_SOURCE_LENGTH` bytes (e.g.
+/// `ignition.gateway-1`). Only enforced with a `SourceFormatMode` other than
+/// `Off`.
+pub fn is_valid_source(source: &str) -> bool {
+    !source.is_empty()
+        && source.len() <= MAX_SOURCE_LENGTH
+        && source
+            .chars()
+            .all(|c| c.is_ascii_lowercase() || c.is_ascii_digit() || matches!(c, '.' | '-'))
+}
+
+/// `source` trimmed and lowercased, so `" IGNITION-GW1"` and `ignition-gw1`
+/// name the same producer. Other characters are kept, so the result may
+/// still fail `is_valid_source`.
+pub fn normalize_source(source: &str) -> String {
+    source.trim().to_lowercase()
+}
+
+/// A valid key as a single NATS subject token for subject mappings that
+/// route by key (see `EventPublisher::with_subject_mapping`): lowercased,
+/// with `.` escaped as `_2e` and `_` as `_5f`. `Zone1` and `zone1` land on
+/// the same subject, but `a.b` and `a_b` don't; the event keeps the key
+/// exactly as published.
+pub fn sanitize_key(key: &str) -> String {
+    let mut token = String::with_capacity(key.len());
+    for c in key.chars() {
+        match c {
+            '.' => token.push_str("_2e"),
+            '_' => token.push_str("_5f"),
+            c => token.push(c.to_ascii_lowercase()),
+        }
+    }
+    token
+}
+
+/// Number of dot-separated segments
+fn stream_depth(stream: &str) -> usize {
+    stream.split('.').count()
+}
+
 #[cfg(test)]
 mod validation_tests {
     use super::*;
@@ -115,6 +640,48 @@ mod validation_tests {
         assert!(is_valid_stream_name("sensors.zone1.temp"));
         assert!(is_valid_stream_name("data123"));
         assert!(is_valid_stream_name("a.b.c.d"));
+        assert!(is_valid_stream_name("a.b.c.d.e"));
+        assert!(is_valid_stream_name(&"a".repeat(MAX_STREAM_NAME_LENGTH)));
+    }
+
+    #[test]
+    fn test_glob_match() {
+        assert!(glob_match("plant-a.scada", "plant-a.scada"));
+        assert!(!glob_match("plant-a.scada", "plant-b.scada"));
+        assert!(glob_match("plant-*.scada", "plant-a.scada"));
+        assert!(glob_match("plant-*.scada", "plant-north.line2.scada"));
+        assert!(!glob_match("plant-*.scada", "plant-a.scada.old"));
+        assert!(glob_match("sensor-0?", "sensor-01"));
+        assert!(!glob_match("sensor-0?", "sensor-1"));
+        assert!(glob_match("*", ""));
+        assert!(glob_match("**a*", "bab"));
+        assert!(!glob_match("", "a"));
+        assert!(glob_match("a*b*c", "aXXbYYbc"));
+    }
+
+    #[test]
+    fn test_key_validation() {
+        assert!(is_valid_key("zone1"));
+        assert!(is_valid_key("SENSORS_TYPO"));
+        assert!(is_valid_key("acme/sensor-01"));
+        assert!(is_valid_key("plant.line2=a"));
+        assert!(is_valid_key(&"k".repeat(MAX_KEY_LENGTH)));
+        assert!(!is_valid_key(&"k".repeat(MAX_KEY_LENGTH + 1)));
+        for key in ["", "zone 1", "zone.*", "zone.>", ">", ".zone", "zone.", "a..b", "zöne"] {
+            assert!(!is_valid_key(key), "{:?}", key);
+        }
+    }
+
+    #[test]
+    fn test_sanitize_key() {
+        assert_eq!(sanitize_key("Zone1"), "zone1");
+        assert_eq!(sanitize_key("Plant.Line2/A"), "plant_2eline2/a");
+        assert_eq!(sanitize_key("SENSORS_TYPO"), "sensors_5ftypo");
+        assert_eq!(sanitize_key("Zone1"), sanitize_key("zone1"));
+        // Keys differing only in `.` vs `_` stay apart
+        assert_ne!(sanitize_key("a.b"), sanitize_key("a_b"));
+        assert_ne!(sanitize_key("a._b"), sanitize_key("a_.b"));
+        assert_ne!(sanitize_key("a_2e"), sanitize_key("a."));
     }
 
     #[test]
@@ -128,5 +695,7 @@ mod validation_tests {
         assert!(!is_valid_stream_name("sensors-temp"));
         assert!(!is_valid_stream_name("sensors_temp"));
         assert!(!is_valid_stream_name("sensors/temp"));
+        assert!(!is_valid_stream_name("a.b.c.d.e.f"));
+        assert!(!is_valid_stream_name(&"a".repeat(MAX_STREAM_NAME_LENGTH + 1)));
     }
 }
@@ -1,6 +1,9 @@
 // Configuration
 pub mod config;
 
+// Injectable time source
+pub mod clock;
+
 // Event model and validation
 pub mod event;
 
@@ -36,3 +39,24 @@ pub mod credentials;
 
 // Rate limiting (ADR-006)
 pub mod rate_limit;
+
+// Source identity registry
+pub mod source;
+
+// Windowed event aggregation
+pub mod aggregate;
+
+// Scheduled and delayed event publishing
+pub mod scheduler;
+
+// Webhook egress
+pub mod webhook;
+
+// Stream-to-stream derivation rules
+pub mod rules;
+
+// Synthetic publish load (`flux loadgen`)
+pub mod loadgen;
+
+// HTTP API client behind the `fluxctl` binary
+pub mod ctl;
@@ -0,0 +1,305 @@
+//! `flux loadgen`: publish synthetic events at a fixed rate and report
+//! publish latency, for baseline throughput numbers.
+//!
+//! ```text
+//! flux loadgen --stream loadgen --rate 1000 --size 256 --keys 100 --duration 30
+//! ```
+
+use crate::event::{FluxEvent, ValidationError};
+use crate::nats::EventPublisher;
+use crate::state::{HistogramSnapshot, LagMetrics};
+use anyhow::{anyhow, bail, Context, Result};
+use serde_json::json;
+use std::fmt;
+use std::future::Future;
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+use tokio::task::JoinSet;
+
+/// Source stamped on every generated event
+pub const LOADGEN_SOURCE: &str = "flux-loadgen";
+
+/// How often the generator tops up to the target rate
+const TICK: Duration = Duration::from_millis(10);
+
+/// Load-generation settings, from `flux loadgen` flags.
+#[derive(Debug, Clone, PartialEq)]
+pub struct LoadgenConfig {
+    /// Target Flux stream
+    pub stream: String,
+    /// Events per second
+    pub rate: u64,
+    /// Approximate payload size in bytes
+    pub payload_bytes: usize,
+    /// Distinct entity keys to cycle through
+    pub keys: usize,
+    /// Stop after this long (None = until Ctrl-C)
+    pub duration: Option<Duration>,
+    /// Most publishes awaiting an ack at once; the rate drops when reached
+    pub max_in_flight: usize,
+}
+
+impl Default for LoadgenConfig {
+    fn default() -> Self {
+        Self {
+            stream: "loadgen".to_string(),
+            rate: 100,
+            payload_bytes: 256,
+            keys: 100,
+            duration: Some(Duration::from_secs(10)),
+            max_in_flight: 256,
+        }
+    }
+}
+
+impl LoadgenConfig {
+    /// Parse flags following `loadgen`: `--stream`, `--rate`, `--size`,
+    /// `--keys`, `--duration` (seconds, 0 = until Ctrl-C), `--max-in-flight`.
+    pub fn from_args<I, S>(args: I) -> Result<Self>
+    where
+        I: IntoIterator<Item = S>,
+        S: AsRef<str>,
+    {
+        let mut config = Self::default();
+        let mut args = args.into_iter();
+        while let Some(flag) = args.next() {
+            let flag = flag.as_ref().to_string();
+            let value = args
+                .next()
+                .ok_or_else(|| anyhow!("missing value for {}", flag))?;
+            let value = value.as_ref();
+            let number = || {
+                value
+                    .parse::<u64>()
+                    .with_context(|| format!("invalid value for {}: '{}'", flag, value))
+            };
+            match flag.as_str() {
+                "--stream" => config.stream = value.to_string(),
+                "--rate" => config.rate = number()?,
+                "--size" => config.payload_bytes = number()? as usize,
+                "--keys" => config.keys = number()? as usize,
+                "--duration" => {
+                    config.duration = match number()? {
+                        0 => None,
+                        secs => Some(Duration::from_secs(secs)),
+                    }
+                }
+                "--max-in-flight" => config.max_in_flight = number()? as usize,
+                _ => bail!("unknown loadgen flag '{}'", flag),
+            }
+        }
+        if config.rate == 0 || config.keys == 0 || config.max_in_flight == 0 {
+            bail!("--rate, --keys and --max-in-flight must be positive");
+        }
+        config.event(0).context("invalid --stream")?;
+        Ok(config)
+    }
+
+    /// The `seq`th synthetic event: entity `loadgen-{seq % keys}` with a
+    /// padding property sized to roughly `payload_bytes`.
+    pub fn event(&self, seq: u64) -> Result<FluxEvent, ValidationError> {
+        let entity_id = format!("loadgen-{}", seq % self.keys as u64);
+        FluxEvent::builder(self.stream.clone())
+            .source(LOADGEN_SOURCE)
+            .key(entity_id.clone())
+            .payload(json!({
+                "entity_id": entity_id,
+                "properties": {
+                    "seq": seq,
+                    "padding": "x".repeat(self.payload_bytes),
+                },
+            }))
+            .build()
+    }
+}
+
+/// Outcome of a load-generation run.
+#[derive(Debug, Clone)]
+pub struct LoadgenReport {
+    pub published: u64,
+    pub failed: u64,
+    pub elapsed: Duration,
+    /// Publish-to-ack latency of successful publishes
+    pub latency: Option<HistogramSnapshot>,
+}
+
+impl LoadgenReport {
+    pub fn events_per_second(&self) -> f64 {
+        self.published as f64 / self.elapsed.as_secs_f64().max(f64::EPSILON)
+    }
+}
+
+impl fmt::Display for LoadgenReport {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        writeln!(
+            f,
+            "published {} events ({} failed) in {:.1}s: {:.0} events/sec",
+            self.published,
+            self.failed,
+            self.elapsed.as_secs_f64(),
+            self.events_per_second()
+        )?;
+        let Some(latency) = self.latency.as_ref().filter(|h| h.count > 0) else {
+            return Ok(());
+        };
+        writeln!(
+            f,
+            "publish latency: mean {:.2}ms, p50 <= {}, p95 <= {}, p99 <= {}",
+            latency.sum / latency.count as f64 * 1000.0,
+            bound(percentile(latency, 0.50)),
+            bound(percentile(latency, 0.95)),
+            bound(percentile(latency, 0.99))
+        )?;
+        let mut previous = 0;
+        for &(le, cumulative) in &latency.buckets {
+            if cumulative > previous {
+                writeln!(f, "  <= {:>8} {:>10}", bound(le), cumulative - previous)?;
+            }
+            previous = cumulative;
+        }
+        Ok(())
+    }
+}
+
+/// Upper bound of the bucket holding the `q` quantile
+fn percentile(histogram: &HistogramSnapshot, q: f64) -> f64 {
+    let rank = (histogram.count as f64 * q).ceil() as u64;
+    histogram
+        .buckets
+        .iter()
+        .find(|(_, cumulative)| *cumulative >= rank)
+        .map_or(f64::INFINITY, |(le, _)| *le)
+}
+
+fn bound(seconds: f64) -> String {
+    if seconds.is_infinite() {
+        "+Inf".to_string()
+    } else {
+        format!("{}ms", (seconds * 1e6).round() / 1e3)
+    }
+}
+
+/// Publish `config.rate` events per second until `config.duration` elapses
+/// or `shutdown` resolves, then wait for outstanding acks and report.
+///
+/// Latency comes from the publisher's lag metrics, which are replaced with a
+/// fresh set for the run.
+pub async fn run(
+    publisher: EventPublisher,
+    config: &LoadgenConfig,
+    shutdown: impl Future<Output = ()>,
+) -> Result<LoadgenReport> {
+    let metrics = LagMetrics::new();
+    let publisher = Arc::new(publisher.with_lag_metrics(metrics.clone()));
+    let mut ticks = tokio::time::interval(TICK);
+    let deadline = async {
+        match config.duration {
+            Some(duration) => tokio::time::sleep(duration).await,
+            None => std::future::pending().await,
+        }
+    };
+    tokio::pin!(deadline, shutdown);
+
+    let start = Instant::now();
+    let mut in_flight = JoinSet::new();
+    let (mut published, mut failed) = (0, 0);
+    let mut tally = |result: Result<Result<()>, tokio::task::JoinError>| match result {
+        Ok(Ok(())) => published += 1,
+        _ => failed += 1,
+    };
+    let mut seq = 0;
+    loop {
+        tokio::select! {
+            _ = &mut deadline => break,
+            _ = &mut shutdown => break,
+            _ = ticks.tick() => {}
+        }
+        // Catch up to the target count, so rates above one event per tick work
+        let target = (start.elapsed().as_secs_f64() * config.rate as f64) as u64;
+        while seq < target {
+            while in_flight.len() >= config.max_in_flight {
+                if let Some(result) = in_flight.join_next().await {
+                    tally(result);
+                }
+            }
+            let publisher = Arc::clone(&publisher);
+            let event = config.event(seq)?;
+            in_flight.spawn(async move { publisher.publish(&event).await });
+            seq += 1;
+        }
+    }
+    while let Some(result) = in_flight.join_next().await {
+        tally(result);
+    }
+
+    Ok(LoadgenReport {
+        published,
+        failed,
+        elapsed: start.elapsed(),
+        latency: metrics.publish_snapshot().remove(&config.stream),
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_from_args() {
+        let config = LoadgenConfig::from_args([
+            "--stream",
+            "bench",
+            "--rate",
+            "5000",
+            "--size",
+            "1024",
+            "--keys",
+            "10",
+            "--duration",
+            "0",
+        ])
+        .unwrap();
+        assert_eq!(config.stream, "bench");
+        assert_eq!(config.rate, 5000);
+        assert_eq!(config.payload_bytes, 1024);
+        assert_eq!(config.keys, 10);
+        assert_eq!(config.duration, None);
+
+        assert!(LoadgenConfig::from_args(["--rate"]).is_err());
+        assert!(LoadgenConfig::from_args(["--rate", "fast"]).is_err());
+        assert!(LoadgenConfig::from_args(["--rate", "0"]).is_err());
+        assert!(LoadgenConfig::from_args(["--verbose", "1"]).is_err());
+        assert!(LoadgenConfig::from_args(["--stream", "Not A Stream"]).is_err());
+    }
+
+    #[test]
+    fn test_events_cycle_through_keys() {
+        let config = LoadgenConfig {
+            keys: 3,
+            payload_bytes: 512,
+            ..Default::default()
+        };
+        assert_eq!(config.event(1).unwrap().key.as_deref(), Some("loadgen-1"));
+        assert_eq!(config.event(4).unwrap().key.as_deref(), Some("loadgen-1"));
+        assert_eq!(config.event(4).unwrap().payload["properties"]["seq"], 4);
+
+        let size = serde_json::to_vec(&config.event(0).unwrap().payload)
+            .unwrap()
+            .len();
+        assert!((512..600).contains(&size), "payload is {} bytes", size);
+    }
+
+    #[test]
+    fn test_percentile_uses_bucket_bounds() {
+        let histogram = HistogramSnapshot {
+            buckets: vec![(0.005, 90), (0.01, 99), (0.025, 100), (f64::INFINITY, 100)],
+            count: 100,
+            sum: 0.5,
+            negative: 0,
+        };
+        assert_eq!(percentile(&histogram, 0.50), 0.005);
+        assert_eq!(percentile(&histogram, 0.95), 0.01);
+        assert_eq!(percentile(&histogram, 0.99), 0.01);
+        assert_eq!(percentile(&histogram, 1.0), 0.025);
+    }
+}
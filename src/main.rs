@@ -2,19 +2,33 @@ use anyhow::Result;
 use axum::Router;
 use tower_http::cors::{Any, CorsLayer};
 use flux::api::{
-    create_admin_router, create_connector_router, create_deletion_router, create_history_router,
-    create_namespace_router, create_oauth_router, create_query_router, create_router,
-    create_ws_router, run_state_cleanup, AdminAppState, AppState, ConnectorAppState,
-    DeletionAppState, HistoryAppState, OAuthAppState, QueryAppState, StateManager, WsAppState,
+    create_admin_router, create_connector_router, create_consumer_router, create_debug_router,
+    create_deletion_router, create_fetch_router, create_history_router, create_namespace_router, create_oauth_router,
+    create_query_router, create_reconcile_router, create_router, create_rule_router,
+    create_source_router, create_stream_list_router, create_stream_usage_router,
+    create_ws_router, debug_endpoints_enabled, run_state_cleanup, AdminAppState, AppState,
+    ConnectorAppState, ConsumerAppState, DebugAppState, DeletionAppState, FetchAppState,
+    HistoryAppState,
+    OAuthAppState, QueryAppState, Readiness, ReconcileAppState, RuleAppState, SourceAppState,
+    StateManager, StreamListAppState, StreamUsageAppState, WsAppState, HEALTH_STREAM,
 };
 use flux::rate_limit::RateLimiter;
+use flux::source::SourceRegistry;
 use flux::config;
-use flux::config::new_runtime_config;
+use flux::config::{ConfigReloader, RuntimeConfig};
 use flux::credentials::CredentialStore;
+use flux::loadgen;
+use flux::event::FluxEvent;
 use flux::namespace::{NamespaceRegistry, NamespaceStore};
-use flux::nats::{EventPublisher, NatsClient};
+use flux::nats::{
+    enable_firehose, start_service, AccountMonitor, AckMode, EventEncoding, EventIndex,
+    EventPublisher, IngestApi, NatsClient, PublishAdmission, Reconciler, StreamJanitor,
+    StreamUsageMonitor, TtlPurger,
+};
+use flux::rules::RuleEngine;
 use flux::snapshot::{manager::SnapshotManager, recovery};
-use flux::state::StateEngine;
+use flux::state::{ReconnectRecovery, StateEngine};
+use flux::webhook::WebhookDispatcher;
 use std::path::PathBuf;
 use std::sync::Arc;
 use tracing::info;
@@ -30,6 +44,7 @@ async fn main() -> Result<()> {
         .init();
 
     info!("Flux starting...");
+    let started_at = std::time::Instant::now();
 
     // Load configuration
     let config_path = std::env::var("FLUX_CONFIG").unwrap_or_else(|_| "config.toml".to_string());
@@ -38,18 +53,289 @@ async fn main() -> Result<()> {
         config::FluxConfig::default()
     });
 
-    // Initialize NATS client
-    let nats_config = flux_config.nats.clone();
-    let nats_client = NatsClient::connect(nats_config).await?;
+    // `flux loadgen [flags]` publishes synthetic events instead of serving
+    let args: Vec<String> = std::env::args().skip(1).collect();
+    if args.first().map(String::as_str) == Some("loadgen") {
+        return run_loadgen(&flux_config, &args[1..]).await;
+    }
+
+    // CORS — allow browsers (flux-universe.com explorer) to fetch from Flux
+    let cors = CorsLayer::new()
+        .allow_origin(Any)
+        .allow_methods([
+            axum::http::Method::GET,
+            axum::http::Method::POST,
+            axum::http::Method::DELETE,
+            axum::http::Method::OPTIONS,
+        ])
+        .allow_headers([
+            axum::http::header::AUTHORIZATION,
+            axum::http::header::CONTENT_TYPE,
+        ]);
+
+    // Start the HTTP listener first: /healthz and /readyz answer while NATS
+    // connects and state replays; other routes return 503 until ready
+    let port = std::env::var("PORT")
+        .unwrap_or_else(|_| "3000".to_string())
+        .parse::<u16>()?;
+    let readiness = Readiness::new().with_lag_threshold(flux_config.api.health_lag_threshold);
+    let addr = format!("0.0.0.0:{}", port);
+    info!("Starting HTTP server on {}", addr);
+    let listener = tokio::net::TcpListener::bind(&addr).await?;
+    let app_router = readiness.router().layer(cors);
+    let server = tokio::spawn(async move { axum::serve(listener, app_router).await });
+
+    // Initialize NATS client (lazy mode keeps retrying instead of exiting)
+    let lazy_connect = std::env::var("FLUX_LAZY_CONNECT")
+        .map(|v| v == "true")
+        .unwrap_or(false);
+    let nats_config = flux_config.nats.clone().with_env_overrides();
+    let declared_streams = vec![nats_config.stream_config()];
+    let nats_client = if lazy_connect {
+        info!("Lazy NATS connect enabled");
+        NatsClient::connect_with_retry(nats_config).await
+    } else {
+        NatsClient::connect(nats_config).await?
+    };
     info!("NATS client connected");
+    for result in nats_client.stream_init_report() {
+        info!(
+            stream = %result.stream,
+            status = ?result.status,
+            error = result.error.as_deref().unwrap_or(""),
+            "Stream initialization"
+        );
+    }
+    if let Some(dir) = &flux_config.nats.streams_dir {
+        match nats_client.initialize_from_directory(dir).await {
+            Ok(results) => {
+                for result in results {
+                    info!(
+                        stream = %result.stream,
+                        status = ?result.status,
+                        error = result.error.as_deref().unwrap_or(""),
+                        "Stream initialization"
+                    );
+                }
+            }
+            Err(e) => tracing::warn!(error = %format!("{:#}", e), "Failed to read stream configs"),
+        }
+    }
+
+    // Streams created before direct gets were enabled by default
+    if flux_config.nats.allow_direct {
+        if let Err(e) = nats_client.enable_direct_get().await {
+            tracing::warn!(error = %e, "Failed to enable direct get on event stream");
+        }
+    }
+
+    // Compare the declared streams with the cluster; changes only with
+    // nats.reconcile_apply
+    let mut reconciler = Reconciler::new(nats_client.jetstream().clone(), declared_streams);
+    if let Some(firehose) = &flux_config.nats.firehose {
+        reconciler = reconciler.with_managed(firehose.stream_name.clone());
+    }
+    let reconciler = Arc::new(reconciler);
+    let reconcile = if flux_config.nats.reconcile_apply {
+        reconciler.apply().await
+    } else {
+        reconciler.report().await
+    };
+    match reconcile {
+        Ok(report) => {
+            for name in &report.missing {
+                tracing::warn!(stream = %name, "Declared stream missing from the cluster");
+            }
+            for diff in &report.drifted {
+                let fields: Vec<_> = diff.changes.iter().map(|change| change.field).collect();
+                tracing::warn!(stream = %diff.stream, fields = ?fields, "Declared stream drifted");
+            }
+            for name in &report.unmanaged {
+                info!(stream = %name, "Stream not declared in the configuration");
+            }
+        }
+        Err(e) => tracing::warn!(error = %e, "Failed to reconcile streams"),
+    }
 
-    // Create event publisher
-    let event_publisher = EventPublisher::new(nats_client.jetstream().clone());
+    // Start JetStream account monitor (background task)
+    let account_monitor = Arc::new(AccountMonitor::new(
+        nats_client.jetstream().clone(),
+        std::time::Duration::from_secs(flux_config.nats.account_poll_interval_seconds),
+    ));
+    account_monitor.on_memory_usage(80.0, |pct| {
+        tracing::warn!(usage_pct = pct, "JetStream account memory usage above 80%");
+    });
+    account_monitor.on_storage_usage(80.0, |pct| {
+        tracing::warn!(usage_pct = pct, "JetStream account storage usage above 80%");
+    });
+    tokio::spawn(Arc::clone(&account_monitor).run());
+    info!("JetStream account monitor started");
+
+    // Open source identity registry (JetStream KV)
+    let source_registry = Arc::new(SourceRegistry::open(nats_client.jetstream()).await?);
+    tokio::spawn(Arc::clone(&source_registry).watch());
 
     // Create state engine
     let state_engine = Arc::new(StateEngine::new());
     info!("State engine initialized");
 
+    // Create event publisher. Every event is stamped with this instance's id
+    // and the API it arrived through (see `for_api` below)
+    let instance_id = flux_config
+        .api
+        .instance_id
+        .clone()
+        .or_else(|| std::env::var("HOSTNAME").ok())
+        .unwrap_or_else(|| "flux".to_string());
+    // Source and naming policies, swapped by config reloads
+    let validation_options = Arc::new(std::sync::RwLock::new(flux_config.api.validation_options()));
+    let mut event_publisher = EventPublisher::new(nats_client.jetstream().clone())
+        .with_source_registry(
+            Arc::clone(&source_registry),
+            flux_config.api.require_registered_source,
+        )
+        .with_stream_subjects(flux_config.nats.stream_subjects.clone())
+        .with_shared_validation(Arc::clone(&validation_options))
+        .with_lag_metrics(state_engine.metrics.lag().clone())
+        .with_storage_metrics(state_engine.metrics.storage().clone())
+        .with_publish_metrics(state_engine.metrics.publishes().clone())
+        .with_instance_id(instance_id)
+        .with_embed_received_at(flux_config.api.embed_received_at)
+        .with_max_payload(nats_client.client().server_info().max_payload)
+        .with_core_client(nats_client.client().clone());
+    let event_index = if flux_config.nats.event_index_enabled {
+        // Entries expire with the event stream's retention
+        let max_age = flux_config.nats.stream_config().max_age;
+        let index = Arc::new(
+            EventIndex::open(
+                nats_client.jetstream(),
+                flux_config.nats.stream_name.clone(),
+                max_age,
+            )
+            .await?,
+        );
+        event_publisher = event_publisher.with_event_index(Arc::clone(&index));
+        info!("Event index enabled");
+        Some(index)
+    } else {
+        None
+    };
+    if let Some(ttl_purge) = flux_config.nats.ttl_purge.clone() {
+        let purger = Arc::new(
+            TtlPurger::open(
+                nats_client.jetstream(),
+                flux_config.nats.stream_name.clone(),
+                flux_config.nats.stream_config().max_age,
+                ttl_purge,
+            )
+            .await?,
+        );
+        event_publisher = event_publisher.with_ttl_purger(Arc::clone(&purger));
+        tokio::spawn(purger.run());
+    }
+    if flux_config.nats.encoding != EventEncoding::Json {
+        event_publisher = event_publisher.with_encoding(flux_config.nats.encoding);
+        info!(encoding = ?flux_config.nats.encoding, "Event envelope encoding set");
+    }
+    if flux_config.nats.ack_mode != AckMode::Explicit {
+        event_publisher = event_publisher.with_ack_mode(flux_config.nats.ack_mode);
+        info!(ack_mode = ?flux_config.nats.ack_mode, "Publish ack mode set");
+    }
+    if flux_config.nats.deduplicate {
+        event_publisher = event_publisher.with_deduplication(true);
+        info!(
+            duplicate_window_seconds = flux_config.nats.duplicate_window_seconds,
+            "Publish deduplication enabled"
+        );
+    }
+    if let Some(horizon) = flux_config.nats.retry_horizon_beyond_window() {
+        tracing::warn!(
+            retry_horizon = ?horizon,
+            duplicate_window = ?flux_config.nats.duplicate_window(),
+            "Producers retry for longer than the stream's duplicate window; \
+             late retries will be stored twice. Raise nats.duplicate_window_seconds."
+        );
+    }
+    if let Some(threshold) = flux_config.nats.compress_above_bytes {
+        event_publisher = event_publisher.with_compression(threshold);
+        info!(threshold, "Event compression enabled");
+    }
+    if let Some(max_msg_size) = flux_config.nats.max_msg_size.filter(|max| *max > 0) {
+        event_publisher = event_publisher.with_max_msg_size(max_msg_size as usize);
+        info!(max_msg_size, "Stream max message size enabled");
+    }
+    for (stream_prefix, jetstream) in nats_client.targets() {
+        event_publisher = event_publisher.with_target(stream_prefix.clone(), jetstream.clone());
+    }
+    for sampling in &flux_config.nats.sampling {
+        let sampler = sampling.sampler().map_err(anyhow::Error::msg)?;
+        event_publisher = event_publisher.with_sampling(sampling.stream.clone(), sampler);
+        info!(stream = %sampling.stream, "Event sampling enabled");
+    }
+    if let Some(max_depth) = flux_config.nats.max_stream_depth {
+        event_publisher =
+            event_publisher.with_max_stream_depth(flux_config.nats.stream_name.clone(), max_depth);
+        info!(max_depth, "Stream depth limit enabled");
+    }
+    if let Some(admission) = &flux_config.api.admission {
+        event_publisher = event_publisher.with_admission(
+            PublishAdmission::new(admission).with_metrics(state_engine.metrics.admission().clone()),
+        );
+        info!(
+            max_in_flight = admission.max_in_flight,
+            max_queued = admission.max_queued,
+            "Publish admission control enabled"
+        );
+    }
+
+    // Opt-in "service started" event, on its own stream so production
+    // streams stay clean
+    let startup_event = std::env::var("FLUX_STARTUP_EVENT")
+        .map(|v| v == "true")
+        .unwrap_or(false);
+    if startup_event {
+        let event = FluxEvent::builder(HEALTH_STREAM)
+            .source("flux")
+            .payload(serde_json::json!({
+                "entity_id": "flux/instance",
+                "properties": {
+                    "status": "started",
+                    "version": env!("CARGO_PKG_VERSION"),
+                }
+            }))
+            .build()?;
+        if let Err(e) = event_publisher.internal().publish(&event).await {
+            tracing::warn!(error = %e, "Failed to publish startup event");
+        }
+    }
+
+    // Start per-stream usage monitor. Alerts to flux.system.alerts bypass the
+    // source registry and depth limit, so they go out even when the stream is full.
+    let stream_usage_monitor = Arc::new(
+        StreamUsageMonitor::new(
+            nats_client.jetstream().clone(),
+            std::time::Duration::from_secs(flux_config.nats.account_poll_interval_seconds),
+            flux_config.nats.stream_usage_alert_pct,
+        )
+        .with_alerts(EventPublisher::new(nats_client.jetstream().clone())),
+    );
+    tokio::spawn(Arc::clone(&stream_usage_monitor).run());
+
+    // Register NATS micro service (discoverable via $SRV.INFO)
+    let _nats_service = if flux_config.nats.service_enabled {
+        Some(
+            start_service(
+                nats_client.client(),
+                nats_client.jetstream().clone(),
+                event_publisher.for_api(IngestApi::Nats),
+                flux_config.nats.stream_name.clone(),
+            )
+            .await?,
+        )
+    } else {
+        None
+    };
+
     // Recovery: Try to load latest snapshot
     let snapshot_dir = PathBuf::from(&flux_config.snapshot.directory);
     let start_sequence = match recovery::load_latest_snapshot(&snapshot_dir)? {
@@ -80,6 +366,89 @@ async fn main() -> Result<()> {
     });
     info!("State engine subscriber started");
 
+    // Catch the state engine up after NATS reconnects (background task)
+    let reconnect_recovery = Arc::new(
+        ReconnectRecovery::new(
+            nats_client.jetstream().clone(),
+            flux_config.nats.stream_name.clone(),
+            Arc::clone(&state_engine),
+            flux_config.nats.reconnect_max_gap,
+        )
+        .with_alerts(EventPublisher::new(nats_client.jetstream().clone())),
+    );
+    tokio::spawn(reconnect_recovery.run(nats_client.subscribe_reconnects()));
+
+    // Exit (so the supervisor restarts us) once reconnects are exhausted
+    let mut reconnects_exhausted = nats_client.subscribe_reconnects_exhausted();
+    tokio::spawn(async move {
+        if reconnects_exhausted.wait_for(|exhausted| *exhausted).await.is_ok() {
+            tracing::error!("NATS connection lost for good (nats.max_reconnects reached), exiting");
+            std::process::exit(1);
+        }
+    });
+
+    // Keep the firehose sourcing every stream (background task)
+    if let Some(firehose) = flux_config.nats.firehose.clone() {
+        info!(stream = %firehose.stream_name, "Firehose enabled");
+        let jetstream_clone = nats_client.jetstream().clone();
+        tokio::spawn(async move {
+            let mut interval = tokio::time::interval(std::time::Duration::from_secs(
+                firehose.sync_interval_seconds.max(1),
+            ));
+            loop {
+                interval.tick().await;
+                if let Err(e) = enable_firehose(&jetstream_clone, &firehose).await {
+                    tracing::warn!(error = %e, "Firehose sync failed");
+                }
+            }
+        });
+    }
+
+    // Clean up idle, empty auto-created streams (background task). Audit
+    // events bypass the source registry and depth limit, like usage alerts.
+    if let Some(mut janitor) = flux_config.nats.janitor.clone() {
+        janitor
+            .protected_streams
+            .push(flux_config.nats.stream_name.clone());
+        let janitor = StreamJanitor::new(nats_client.jetstream().clone(), janitor)
+            .with_audit(EventPublisher::new(nats_client.jetstream().clone()));
+        tokio::spawn(Arc::new(janitor).run());
+    }
+
+    // Start webhook dispatchers (background tasks)
+    let webhook_in_flight = Arc::new(tokio::sync::Semaphore::new(
+        flux_config.webhooks.max_in_flight.max(1),
+    ));
+    for target in &flux_config.webhooks.targets {
+        let dispatcher = Arc::new(
+            WebhookDispatcher::new(target.clone(), Arc::clone(&webhook_in_flight))?
+                .with_dead_letter(EventPublisher::new(nats_client.jetstream().clone()))
+                .with_lag_metrics(state_engine.metrics.lag().clone()),
+        );
+        let jetstream_clone = nats_client.jetstream().clone();
+        let stream_name = flux_config.nats.stream_name.clone();
+        tokio::spawn(async move {
+            let name = dispatcher.name().to_string();
+            if let Err(e) = dispatcher.run(jetstream_clone, stream_name).await {
+                tracing::error!(error = %e, webhook = %name, "Webhook dispatcher failed");
+            }
+        });
+        info!(webhook = %target.name, stream = %target.stream, "Webhook dispatcher started");
+    }
+
+    // Start derivation rules stored in KV, and follow changes made by other
+    // instances. Derived events bypass the source registry and depth limit,
+    // like usage alerts.
+    let rule_engine = Arc::new(
+        RuleEngine::open(
+            nats_client.jetstream().clone(),
+            flux_config.nats.stream_name.clone(),
+            EventPublisher::new(nats_client.jetstream().clone()),
+        )
+        .await?,
+    );
+    tokio::spawn(Arc::clone(&rule_engine).watch());
+
     // Start metrics broadcaster (background task)
     let engine_clone = Arc::clone(&state_engine);
     let metrics_config = flux_config.metrics.clone();
@@ -102,15 +471,26 @@ async fn main() -> Result<()> {
     });
     info!("Snapshot manager started");
 
-    // Initialize HTTP server
-    let port = std::env::var("PORT")
-        .unwrap_or_else(|_| "3000".to_string())
-        .parse::<u16>()?;
-
-    // Initialize runtime config (loaded from env vars, defaults otherwise)
-    let runtime_config = new_runtime_config();
+    // Initialize runtime config (defaults, then [limits] from config file, then env vars)
+    let initial_config = RuntimeConfig::from_file_and_env(&flux_config.limits);
+    let initial_config = match initial_config.validate() {
+        Ok(()) => initial_config,
+        Err(e) => {
+            tracing::warn!(error = %e, "Invalid [limits] in config file, using env/defaults");
+            RuntimeConfig::from_env()
+        }
+    };
+    let runtime_config = Arc::new(std::sync::RwLock::new(initial_config));
     info!("Runtime config initialized");
 
+    // Reload limits and source/naming policies on SIGHUP (and POST /api/admin/reload)
+    let config_reloader = Arc::new(
+        ConfigReloader::new(config_path.clone(), Arc::clone(&runtime_config))
+            .with_validation(Arc::clone(&validation_options)),
+    );
+    #[cfg(unix)]
+    tokio::spawn(Arc::clone(&config_reloader).run_sighup_listener());
+
     // Admin token (for PUT /api/admin/config)
     let admin_token = std::env::var("FLUX_ADMIN_TOKEN").ok();
     if admin_token.is_none() {
@@ -169,9 +549,25 @@ async fn main() -> Result<()> {
     let rate_limiter = Arc::new(RateLimiter::new());
     info!("Rate limiter initialized");
 
+    // Debug endpoints (FLUX_DEBUG_ENDPOINTS=true only; admin token protected)
+    let debug_enabled = debug_endpoints_enabled();
+    if debug_enabled {
+        tracing::warn!("Debug endpoints enabled under /debug");
+    }
+    let debug_router = create_debug_router(
+        DebugAppState {
+            state_engine: Arc::clone(&state_engine),
+            rate_limiter: Arc::clone(&rate_limiter),
+            stream_usage: Arc::clone(&stream_usage_monitor),
+            admin_token: admin_token.clone(),
+            started_at,
+        },
+        debug_enabled,
+    );
+
     // Create ingestion API router
     let ingestion_state = AppState {
-        event_publisher: event_publisher.clone(),
+        event_publisher: event_publisher.for_api(IngestApi::Http),
         namespace_registry: Arc::clone(&namespace_registry),
         auth_enabled,
         admin_token: admin_token.clone(),
@@ -185,7 +581,7 @@ async fn main() -> Result<()> {
 
     // Create deletion API router
     let deletion_state = DeletionAppState {
-        event_publisher: event_publisher.clone(),
+        event_publisher: event_publisher.for_api(IngestApi::Http),
         namespace_registry: Arc::clone(&namespace_registry),
         state_engine: Arc::clone(&state_engine),
         auth_enabled,
@@ -206,9 +602,65 @@ async fn main() -> Result<()> {
     // Create History API router
     let history_state = Arc::new(HistoryAppState {
         jetstream: nats_client.jetstream().clone(),
+        event_index,
     });
     let history_router = create_history_router(history_state);
 
+    // Create Consumer management API router
+    let consumer_state = ConsumerAppState {
+        jetstream: nats_client.jetstream().clone(),
+        stream_name: flux_config.nats.stream_name.clone(),
+        admin_token: admin_token.clone(),
+    };
+    let consumer_router = create_consumer_router(consumer_state);
+
+    // Create long-poll fetch API router. Without a shared secret, ack tokens
+    // only work on the instance that issued them, until it restarts.
+    let token_secret = std::env::var("FLUX_ACK_TOKEN_SECRET").unwrap_or_else(|_| {
+        tracing::warn!("FLUX_ACK_TOKEN_SECRET not set - ack tokens use a per-process secret");
+        (0..32).map(|_| format!("{:02x}", rand::random::<u8>())).collect()
+    });
+    let fetch_router = create_fetch_router(FetchAppState {
+        jetstream: nats_client.jetstream().clone(),
+        client: nats_client.client().clone(),
+        stream_name: flux_config.nats.stream_name.clone(),
+        admin_token: admin_token.clone(),
+        token_secret,
+    });
+
+    // Create Source registry API router
+    let source_state = SourceAppState {
+        registry: source_registry,
+        admin_token: admin_token.clone(),
+    };
+    let source_router = create_source_router(source_state);
+
+    // Create derivation rule API router
+    let rule_router = create_rule_router(RuleAppState {
+        engine: rule_engine,
+        admin_token: admin_token.clone(),
+    });
+
+    // Create stream reconciliation API router
+    let reconcile_router = create_reconcile_router(ReconcileAppState {
+        reconciler,
+        apply_enabled: flux_config.nats.reconcile_apply,
+        admin_token: admin_token.clone(),
+    });
+
+    // Create stream usage API router
+    let stream_usage_router = create_stream_usage_router(StreamUsageAppState {
+        monitor: stream_usage_monitor,
+    });
+
+    // Create stream listing API router
+    let stream_list_router = create_stream_list_router(StreamListAppState {
+        jetstream: nats_client.jetstream().clone(),
+        cache: (flux_config.api.stream_cache_ttl_ms > 0)
+            .then(|| nats_client.stream_cache().clone()),
+        cache_ttl: std::time::Duration::from_millis(flux_config.api.stream_cache_ttl_ms),
+    });
+
     // Create Connector API router
     let connector_state = ConnectorAppState {
         credential_store: credential_store.clone(),
@@ -253,23 +705,10 @@ async fn main() -> Result<()> {
     let admin_state = AdminAppState {
         runtime_config,
         admin_token,
+        reloader: Some(config_reloader),
     };
     let admin_router = create_admin_router(admin_state);
 
-    // CORS — allow browsers (flux-universe.com explorer) to fetch from Flux
-    let cors = CorsLayer::new()
-        .allow_origin(Any)
-        .allow_methods([
-            axum::http::Method::GET,
-            axum::http::Method::POST,
-            axum::http::Method::DELETE,
-            axum::http::Method::OPTIONS,
-        ])
-        .allow_headers([
-            axum::http::header::AUTHORIZATION,
-            axum::http::header::CONTENT_TYPE,
-        ]);
-
     // Combine routers
     let app = ingestion_router
         .merge(namespace_router)
@@ -277,16 +716,46 @@ async fn main() -> Result<()> {
         .merge(ws_router)
         .merge(query_router)
         .merge(history_router)
+        .merge(consumer_router)
+        .merge(fetch_router)
+        .merge(source_router)
+        .merge(rule_router)
+        .merge(reconcile_router)
+        .merge(stream_usage_router)
+        .merge(stream_list_router)
         .merge(connector_router)
         .merge(oauth_router)
         .merge(admin_router)
-        .layer(cors);
+        .merge(debug_router);
 
-    let addr = format!("0.0.0.0:{}", port);
-    info!("Starting HTTP server on {}", addr);
+    readiness.set_ready(app, &nats_client);
+    info!("Flux ready");
 
-    let listener = tokio::net::TcpListener::bind(&addr).await?;
-    axum::serve(listener, app).await?;
+    server.await??;
 
     Ok(())
 }
+
+/// Publish synthetic events per `flux loadgen` flags, then print throughput
+/// and a publish latency histogram. Ctrl-C stops early (in-flight publishes
+/// still finish).
+async fn run_loadgen(flux_config: &config::FluxConfig, args: &[String]) -> Result<()> {
+    let loadgen_config = loadgen::LoadgenConfig::from_args(args)?;
+    let nats_client = NatsClient::connect(flux_config.nats.clone().with_env_overrides()).await?;
+    let publisher = EventPublisher::new(nats_client.jetstream().clone())
+        .with_stream_subjects(flux_config.nats.stream_subjects.clone());
+    info!(
+        stream = %loadgen_config.stream,
+        rate = loadgen_config.rate,
+        payload_bytes = loadgen_config.payload_bytes,
+        keys = loadgen_config.keys,
+        "Starting load generation"
+    );
+
+    let shutdown = async {
+        let _ = tokio::signal::ctrl_c().await;
+    };
+    let report = loadgen::run(publisher, &loadgen_config, shutdown).await?;
+    print!("{}", report);
+    Ok(())
+}
@@ -0,0 +1,253 @@
+use async_nats::jetstream::{self, account::Account};
+use chrono::{DateTime, Utc};
+use serde::Serialize;
+use std::sync::{Arc, Mutex, RwLock};
+use std::time::Duration;
+use tokio::sync::Notify;
+use tracing::{info, warn};
+
+/// Cached JetStream account usage.
+#[derive(Debug, Clone, Serialize)]
+pub struct AccountUsage {
+    pub memory_bytes: u64,
+    pub storage_bytes: u64,
+    pub streams: u64,
+    pub consumers: u64,
+    /// Account memory limit (-1 = unlimited)
+    pub max_memory: i64,
+    /// Account storage limit (-1 = unlimited)
+    pub max_storage: i64,
+    pub updated_at: DateTime<Utc>,
+}
+
+impl AccountUsage {
+    fn from_account(account: &Account) -> Self {
+        Self {
+            memory_bytes: account.memory as u64,
+            storage_bytes: account.storage as u64,
+            streams: account.streams as u64,
+            consumers: account.consumers as u64,
+            max_memory: account.limits.max_memory,
+            max_storage: account.limits.max_storage,
+            updated_at: Utc::now(),
+        }
+    }
+
+    /// Memory usage as a percentage of the account limit (None if unlimited)
+    pub fn memory_pct(&self) -> Option<f64> {
+        usage_pct(self.memory_bytes, self.max_memory)
+    }
+
+    /// Storage usage as a percentage of the account limit (None if unlimited)
+    pub fn storage_pct(&self) -> Option<f64> {
+        usage_pct(self.storage_bytes, self.max_storage)
+    }
+}
+
+fn usage_pct(used: u64, limit: i64) -> Option<f64> {
+    if limit <= 0 {
+        return None;
+    }
+    Some(used as f64 / limit as f64 * 100.0)
+}
+
+type ThresholdFn = Box<dyn Fn(f64) + Send + Sync>;
+
+/// Callback fired once each time usage crosses `threshold` (re-armed when usage drops below).
+struct ThresholdCallback {
+    threshold: f64,
+    callback: ThresholdFn,
+    triggered: bool,
+}
+
+impl ThresholdCallback {
+    fn evaluate(&mut self, pct: Option<f64>) {
+        let Some(pct) = pct else { return };
+        if pct >= self.threshold {
+            if !self.triggered {
+                self.triggered = true;
+                (self.callback)(pct);
+            }
+        } else {
+            self.triggered = false;
+        }
+    }
+}
+
+/// Polls JetStream account info in the background and caches the result.
+///
+/// Startup only proves JetStream is reachable; the monitor keeps usage numbers
+/// fresh for health checks and capacity alerts without a NATS round-trip per read.
+pub struct AccountMonitor {
+    jetstream: jetstream::Context,
+    poll_interval: Duration,
+    cached: RwLock<Option<AccountUsage>>,
+    last_error: RwLock<Option<String>>,
+    memory_callbacks: Mutex<Vec<ThresholdCallback>>,
+    storage_callbacks: Mutex<Vec<ThresholdCallback>>,
+    shutdown: Notify,
+}
+
+impl AccountMonitor {
+    pub fn new(jetstream: jetstream::Context, poll_interval: Duration) -> Self {
+        Self {
+            jetstream,
+            poll_interval,
+            cached: RwLock::new(None),
+            last_error: RwLock::new(None),
+            memory_callbacks: Mutex::new(Vec::new()),
+            storage_callbacks: Mutex::new(Vec::new()),
+            shutdown: Notify::new(),
+        }
+    }
+
+    /// Register a callback fired when memory usage reaches `threshold` percent.
+    pub fn on_memory_usage<F>(&self, threshold: f64, callback: F)
+    where
+        F: Fn(f64) + Send + Sync + 'static,
+    {
+        self.memory_callbacks.lock().unwrap().push(ThresholdCallback {
+            threshold,
+            callback: Box::new(callback),
+            triggered: false,
+        });
+    }
+
+    /// Register a callback fired when storage usage reaches `threshold` percent.
+    pub fn on_storage_usage<F>(&self, threshold: f64, callback: F)
+    where
+        F: Fn(f64) + Send + Sync + 'static,
+    {
+        self.storage_callbacks.lock().unwrap().push(ThresholdCallback {
+            threshold,
+            callback: Box::new(callback),
+            triggered: false,
+        });
+    }
+
+    /// Last successfully polled account usage.
+    ///
+    /// Returns the last poll error if no successful poll has happened yet.
+    pub fn get_account_info(&self) -> Result<AccountUsage, String> {
+        if let Some(usage) = self.cached.read().unwrap().clone() {
+            return Ok(usage);
+        }
+        Err(self
+            .last_error
+            .read()
+            .unwrap()
+            .clone()
+            .unwrap_or_else(|| "account info not yet available".to_string()))
+    }
+
+    /// Poll once and update the cache.
+    pub async fn refresh(&self) {
+        match self.jetstream.query_account().await {
+            Ok(account) => self.record(AccountUsage::from_account(&account)),
+            Err(e) => {
+                warn!(error = %e, "Failed to query JetStream account info");
+                *self.last_error.write().unwrap() = Some(e.to_string());
+            }
+        }
+    }
+
+    fn record(&self, usage: AccountUsage) {
+        for cb in self.memory_callbacks.lock().unwrap().iter_mut() {
+            cb.evaluate(usage.memory_pct());
+        }
+        for cb in self.storage_callbacks.lock().unwrap().iter_mut() {
+            cb.evaluate(usage.storage_pct());
+        }
+        *self.cached.write().unwrap() = Some(usage);
+        *self.last_error.write().unwrap() = None;
+    }
+
+    /// Run the polling loop until `stop` is called.
+    pub async fn run(self: Arc<Self>) {
+        info!(
+            interval_secs = self.poll_interval.as_secs(),
+            "Starting JetStream account monitor"
+        );
+        let mut interval = tokio::time::interval(self.poll_interval);
+
+        loop {
+            tokio::select! {
+                _ = interval.tick() => self.refresh().await,
+                _ = self.shutdown.notified() => break,
+            }
+        }
+
+        info!("JetStream account monitor stopped");
+    }
+
+    /// Stop the polling loop.
+    pub fn stop(&self) {
+        self.shutdown.notify_one();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+
+    fn usage(memory: u64, max_memory: i64) -> AccountUsage {
+        AccountUsage {
+            memory_bytes: memory,
+            storage_bytes: 0,
+            streams: 1,
+            consumers: 1,
+            max_memory,
+            max_storage: -1,
+            updated_at: Utc::now(),
+        }
+    }
+
+    #[test]
+    fn test_usage_pct() {
+        assert_eq!(usage(50, 200).memory_pct(), Some(25.0));
+        assert_eq!(usage(50, -1).memory_pct(), None);
+        assert_eq!(usage(50, 0).memory_pct(), None);
+    }
+
+    #[test]
+    fn test_threshold_fires_once_per_crossing() {
+        let count = Arc::new(AtomicUsize::new(0));
+        let counter = Arc::clone(&count);
+        let mut cb = ThresholdCallback {
+            threshold: 80.0,
+            callback: Box::new(move |_| {
+                counter.fetch_add(1, Ordering::SeqCst);
+            }),
+            triggered: false,
+        };
+
+        cb.evaluate(Some(50.0));
+        assert_eq!(count.load(Ordering::SeqCst), 0);
+
+        cb.evaluate(Some(85.0));
+        cb.evaluate(Some(90.0));
+        assert_eq!(count.load(Ordering::SeqCst), 1);
+
+        // Drop below re-arms the callback
+        cb.evaluate(Some(70.0));
+        cb.evaluate(Some(81.0));
+        assert_eq!(count.load(Ordering::SeqCst), 2);
+    }
+
+    #[test]
+    fn test_unlimited_never_fires() {
+        let count = Arc::new(AtomicUsize::new(0));
+        let counter = Arc::clone(&count);
+        let mut cb = ThresholdCallback {
+            threshold: 0.0,
+            callback: Box::new(move |_| {
+                counter.fetch_add(1, Ordering::SeqCst);
+            }),
+            triggered: false,
+        };
+
+        cb.evaluate(usage(100, -1).memory_pct());
+        assert_eq!(count.load(Ordering::SeqCst), 0);
+    }
+}
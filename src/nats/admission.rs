@@ -0,0 +1,223 @@
+use crate::state::AdmissionMetrics;
+use serde::Deserialize;
+use std::fmt;
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::Arc;
+use std::time::Duration;
+use tokio::sync::{OwnedSemaphorePermit, Semaphore};
+
+/// Limits on publishes from the ingest APIs (`[api.admission]`).
+#[derive(Debug, Clone, Deserialize)]
+pub struct AdmissionConfig {
+    /// Publishes in flight at once, across the HTTP API and the NATS service
+    #[serde(default = "default_max_in_flight")]
+    pub max_in_flight: usize,
+    /// Publishes waiting for a slot; further ones are rejected
+    #[serde(default = "default_max_queued")]
+    pub max_queued: usize,
+    /// Retry-After sent with rejections
+    #[serde(default = "default_retry_after_seconds")]
+    pub retry_after_seconds: u64,
+}
+
+fn default_max_in_flight() -> usize {
+    256
+}
+
+fn default_max_queued() -> usize {
+    1024
+}
+
+fn default_retry_after_seconds() -> u64 {
+    1
+}
+
+impl Default for AdmissionConfig {
+    fn default() -> Self {
+        Self {
+            max_in_flight: default_max_in_flight(),
+            max_queued: default_max_queued(),
+            retry_after_seconds: default_retry_after_seconds(),
+        }
+    }
+}
+
+/// Returned when a publish finds every slot taken and the queue full.
+#[derive(Debug, Clone, PartialEq)]
+pub struct AdmissionRejectedError {
+    /// Publishes waiting when this one was turned away
+    pub queue_depth: usize,
+    pub retry_after: Duration,
+}
+
+impl fmt::Display for AdmissionRejectedError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "publish queue is full ({} waiting), retry in {}s",
+            self.queue_depth,
+            self.retry_after.as_secs()
+        )
+    }
+}
+
+impl std::error::Error for AdmissionRejectedError {}
+
+/// Bounds concurrent publishes, so load spikes are shed with
+/// `AdmissionRejectedError` instead of piling up tasks and memory.
+///
+/// Up to `max_in_flight` publishes run at once; up to `max_queued` more wait
+/// for a slot in arrival order. Clones share the slots and the queue.
+#[derive(Clone)]
+pub struct PublishAdmission {
+    slots: Arc<Semaphore>,
+    queued: Arc<AtomicUsize>,
+    max_queued: usize,
+    retry_after: Duration,
+    metrics: AdmissionMetrics,
+}
+
+/// A publish slot, released on drop.
+pub struct AdmissionPermit {
+    _slot: OwnedSemaphorePermit,
+    metrics: AdmissionMetrics,
+}
+
+impl Drop for AdmissionPermit {
+    fn drop(&mut self) {
+        self.metrics.released();
+    }
+}
+
+/// Counts a publish as queued until it is admitted or gives up waiting.
+struct QueuedPublish<'a> {
+    admission: &'a PublishAdmission,
+}
+
+impl Drop for QueuedPublish<'_> {
+    fn drop(&mut self) {
+        self.admission.queued.fetch_sub(1, Ordering::SeqCst);
+        self.admission.metrics.dequeued();
+    }
+}
+
+impl PublishAdmission {
+    pub fn new(config: &AdmissionConfig) -> Self {
+        Self {
+            slots: Arc::new(Semaphore::new(config.max_in_flight.max(1))),
+            queued: Arc::new(AtomicUsize::new(0)),
+            max_queued: config.max_queued,
+            retry_after: Duration::from_secs(config.retry_after_seconds),
+            metrics: AdmissionMetrics::new(),
+        }
+    }
+
+    /// Report in-flight and queued publishes to `metrics`.
+    pub fn with_metrics(mut self, metrics: AdmissionMetrics) -> Self {
+        self.metrics = metrics;
+        self
+    }
+
+    /// Take a slot, waiting in the queue if none is free, or fail at once
+    /// if the queue is full.
+    pub async fn acquire(&self) -> Result<AdmissionPermit, AdmissionRejectedError> {
+        if let Ok(slot) = Arc::clone(&self.slots).try_acquire_owned() {
+            return Ok(self.admit(slot));
+        }
+
+        let queue_depth = self.queued.fetch_add(1, Ordering::SeqCst);
+        if queue_depth >= self.max_queued {
+            self.queued.fetch_sub(1, Ordering::SeqCst);
+            self.metrics.rejected();
+            return Err(AdmissionRejectedError {
+                queue_depth,
+                retry_after: self.retry_after,
+            });
+        }
+        self.metrics.enqueued();
+        let queued = QueuedPublish { admission: self };
+        let slot = Arc::clone(&self.slots)
+            .acquire_owned()
+            .await
+            .expect("admission semaphore is never closed");
+        drop(queued);
+        Ok(self.admit(slot))
+    }
+
+    fn admit(&self, slot: OwnedSemaphorePermit) -> AdmissionPermit {
+        self.metrics.admitted();
+        AdmissionPermit {
+            _slot: slot,
+            metrics: self.metrics.clone(),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn admission(max_in_flight: usize, max_queued: usize) -> PublishAdmission {
+        PublishAdmission::new(&AdmissionConfig {
+            max_in_flight,
+            max_queued,
+            retry_after_seconds: 2,
+        })
+    }
+
+    #[tokio::test]
+    async fn test_queue_bound() {
+        let metrics = AdmissionMetrics::new();
+        let admission = admission(1, 1).with_metrics(metrics.clone());
+
+        let first = admission.acquire().await.unwrap();
+        let waiting = tokio::spawn({
+            let admission = admission.clone();
+            async move { admission.acquire().await.map(|_| ()) }
+        });
+        while metrics.snapshot().queued == 0 {
+            tokio::task::yield_now().await;
+        }
+
+        let err = admission.acquire().await.err().unwrap();
+        assert_eq!(
+            err,
+            AdmissionRejectedError {
+                queue_depth: 1,
+                retry_after: Duration::from_secs(2),
+            }
+        );
+        let snapshot = metrics.snapshot();
+        assert_eq!((snapshot.in_flight, snapshot.queued), (1, 1));
+        assert_eq!(snapshot.rejected, 1);
+
+        // The queued publish runs once the slot is free
+        drop(first);
+        waiting.await.unwrap().unwrap();
+        let snapshot = metrics.snapshot();
+        assert_eq!((snapshot.in_flight, snapshot.queued), (0, 0));
+        assert!(admission.acquire().await.is_ok());
+    }
+
+    #[tokio::test]
+    async fn test_cancelled_wait_leaves_queue() {
+        let metrics = AdmissionMetrics::new();
+        let admission = admission(1, 1).with_metrics(metrics.clone());
+        let _slot = admission.acquire().await.unwrap();
+
+        let wait = admission.acquire();
+        assert!(tokio::time::timeout(Duration::from_millis(20), wait)
+            .await
+            .is_err());
+        assert_eq!(metrics.snapshot().queued, 0);
+        // Its place in the queue is free again
+        let waiting = tokio::spawn({
+            let admission = admission.clone();
+            async move { admission.acquire().await.map(|_| ()) }
+        });
+        while metrics.snapshot().queued == 0 {
+            tokio::task::yield_now().await;
+        }
+        waiting.abort();
+    }
+}
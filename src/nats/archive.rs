@@ -0,0 +1,222 @@
+use super::subject::subject_matches;
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, stream};
+use chrono::{DateTime, Utc};
+use futures::TryStreamExt;
+use std::fmt;
+use std::time::Duration;
+
+/// Stream metadata key marking an archived stream; the value is when it was
+/// archived (RFC 3339).
+pub const ARCHIVED_LABEL: &str = "flux.archived";
+
+/// Subjects the stream had before archiving (JSON array), restored by
+/// `NatsClient::unarchive_stream`
+const ARCHIVED_SUBJECTS_LABEL: &str = "flux.archived_subjects";
+
+/// Max age (seconds) before a grace period replaced it
+const ARCHIVED_MAX_AGE_LABEL: &str = "flux.archived_max_age";
+
+/// An archived stream keeps one subject under this prefix, so JetStream does
+/// not fall back to capturing the stream name.
+pub const ARCHIVED_SUBJECT_PREFIX: &str = "flux.archived.";
+
+/// Returned for publishes to a subject an archived stream used to capture.
+#[derive(Debug, Clone, PartialEq)]
+pub struct StreamArchivedError {
+    pub stream: String,
+    pub subject: String,
+    /// When the stream was archived (RFC 3339)
+    pub archived_at: String,
+}
+
+impl fmt::Display for StreamArchivedError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "stream '{}' was archived at {} and no longer accepts events on '{}'",
+            self.stream, self.archived_at, self.subject
+        )
+    }
+}
+
+impl std::error::Error for StreamArchivedError {}
+
+/// Returned by `NatsClient::delete_stream` for a stream that is not archived;
+/// archive it first or use `force_delete_stream`.
+#[derive(Debug, Clone, PartialEq)]
+pub struct StreamNotArchivedError {
+    pub stream: String,
+}
+
+impl fmt::Display for StreamNotArchivedError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "stream '{}' is not archived; archive it before deleting or force the delete",
+            self.stream
+        )
+    }
+}
+
+impl std::error::Error for StreamNotArchivedError {}
+
+/// When the stream was archived, if it is.
+pub fn archived_at(config: &stream::Config) -> Option<&str> {
+    config.metadata.get(ARCHIVED_LABEL).map(String::as_str)
+}
+
+/// `config` archived at `now`: its subjects swapped for a parking subject and
+/// remembered in metadata. With `grace`, max age shrinks to it (never grows),
+/// so the messages expire once the grace period is over.
+pub(crate) fn archive_config(
+    config: &stream::Config,
+    now: DateTime<Utc>,
+    grace: Option<Duration>,
+) -> stream::Config {
+    let mut archived = config.clone();
+    let metadata = &mut archived.metadata;
+    metadata.insert(ARCHIVED_LABEL.to_string(), now.to_rfc3339());
+    metadata.insert(
+        ARCHIVED_SUBJECTS_LABEL.to_string(),
+        serde_json::to_string(&config.subjects).unwrap_or_default(),
+    );
+    if let Some(grace) = grace {
+        if config.max_age.is_zero() || grace < config.max_age {
+            metadata.insert(
+                ARCHIVED_MAX_AGE_LABEL.to_string(),
+                config.max_age.as_secs().to_string(),
+            );
+            archived.max_age = grace;
+        }
+    }
+    archived.subjects = vec![format!("{}{}", ARCHIVED_SUBJECT_PREFIX, config.name)];
+    archived
+}
+
+/// `config` restored from `archive_config`. Fails once a grace period set at
+/// archive time has run out at `now` (its messages are gone).
+pub(crate) fn unarchive_config(
+    config: &stream::Config,
+    now: DateTime<Utc>,
+) -> Result<stream::Config> {
+    let mut restored = config.clone();
+    let subjects = restored
+        .metadata
+        .remove(ARCHIVED_SUBJECTS_LABEL)
+        .context("Archived stream has no recorded subjects")?;
+    restored.subjects =
+        serde_json::from_str(&subjects).context("Invalid archived subjects metadata")?;
+    let archived_at = restored
+        .metadata
+        .remove(ARCHIVED_LABEL)
+        .context("Stream is not archived")?;
+    if let Some(max_age) = restored.metadata.remove(ARCHIVED_MAX_AGE_LABEL) {
+        let archived_at: DateTime<Utc> = archived_at
+            .parse()
+            .context("Invalid archived timestamp metadata")?;
+        let elapsed = (now - archived_at).to_std().unwrap_or_default();
+        if elapsed >= config.max_age {
+            anyhow::bail!(
+                "grace period of stream '{}' has ended; it can only be deleted",
+                config.name
+            );
+        }
+        restored.max_age = Duration::from_secs(
+            max_age
+                .parse()
+                .context("Invalid archived max age metadata")?,
+        );
+    }
+    Ok(restored)
+}
+
+/// The archived stream that used to capture `subject`, if any. Only looked up
+/// after a publish found no stream, so listing every stream is acceptable.
+pub(crate) async fn archived_stream_for(
+    jetstream: &jetstream::Context,
+    subject: &str,
+) -> Result<Option<StreamArchivedError>> {
+    let streams: Vec<stream::Info> = jetstream
+        .streams()
+        .try_collect()
+        .await
+        .context("Failed to list streams")?;
+    Ok(streams.into_iter().find_map(|info| {
+        let archived_at = archived_at(&info.config)?;
+        let subjects: Vec<String> = info
+            .config
+            .metadata
+            .get(ARCHIVED_SUBJECTS_LABEL)
+            .and_then(|subjects| serde_json::from_str(subjects).ok())?;
+        subjects
+            .iter()
+            .any(|pattern| subject_matches(pattern, subject))
+            .then(|| StreamArchivedError {
+                stream: info.config.name.clone(),
+                subject: subject.to_string(),
+                archived_at: archived_at.to_string(),
+            })
+    }))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn config() -> stream::Config {
+        stream::Config {
+            name: "ORDERS".to_string(),
+            subjects: vec!["orders.>".to_string(), "returns.*".to_string()],
+            max_age: Duration::from_secs(7 * 86400),
+            ..Default::default()
+        }
+    }
+
+    fn assert_restored(restored: &stream::Config) {
+        assert_eq!(restored.subjects, config().subjects);
+        assert_eq!(restored.max_age, config().max_age);
+        assert!(restored.metadata.is_empty());
+    }
+
+    fn at(rfc3339: &str) -> DateTime<Utc> {
+        rfc3339.parse().unwrap()
+    }
+
+    #[test]
+    fn test_archive_round_trip() {
+        let now = at("2026-02-11T13:00:00Z");
+        let archived = archive_config(&config(), now, None);
+
+        assert_eq!(archived.subjects, vec!["flux.archived.ORDERS"]);
+        assert_eq!(archived_at(&archived), Some("2026-02-11T13:00:00+00:00"));
+        assert_eq!(archived.max_age, config().max_age);
+        assert_eq!(archived_at(&config()), None);
+
+        let restored = unarchive_config(&archived, now + chrono::Duration::days(30)).unwrap();
+        assert_restored(&restored);
+    }
+
+    #[test]
+    fn test_grace_period_shrinks_max_age() {
+        let now = at("2026-02-11T13:00:00Z");
+        let grace = Duration::from_secs(86400);
+        let archived = archive_config(&config(), now, Some(grace));
+        assert_eq!(archived.max_age, grace);
+
+        let restored = unarchive_config(&archived, now + chrono::Duration::hours(23)).unwrap();
+        assert_restored(&restored);
+        assert!(unarchive_config(&archived, now + chrono::Duration::hours(24)).is_err());
+
+        // A grace period longer than the retention leaves it alone
+        let archived = archive_config(&config(), now, Some(grace * 30));
+        assert_eq!(archived.max_age, config().max_age);
+        let later = now + chrono::Duration::days(20);
+        assert_restored(&unarchive_config(&archived, later).unwrap());
+    }
+
+    #[test]
+    fn test_unarchive_requires_archived_stream() {
+        assert!(unarchive_config(&config(), Utc::now()).is_err());
+    }
+}
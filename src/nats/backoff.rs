@@ -0,0 +1,101 @@
+use anyhow::{anyhow, Result};
+use async_nats::jetstream::{self, AckKind};
+use std::fmt;
+use std::time::Duration;
+
+/// Handler error asking for redelivery after `delay` (e.g. a dependency's
+/// Retry-After), overriding the consumer's backoff schedule.
+#[derive(Debug, Clone, PartialEq)]
+pub struct RetryAfter {
+    pub delay: Duration,
+    pub reason: String,
+}
+
+impl RetryAfter {
+    pub fn new(delay: Duration, reason: impl Into<String>) -> Self {
+        Self {
+            delay,
+            reason: reason.into(),
+        }
+    }
+}
+
+impl fmt::Display for RetryAfter {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{} (retry in {:?})", self.reason, self.delay)
+    }
+}
+
+impl std::error::Error for RetryAfter {}
+
+/// Delay before redelivering a message that has been delivered `delivered`
+/// times: the matching schedule entry, the last entry once the schedule runs
+/// out, or None (immediate) for an empty schedule.
+pub fn backoff_delay(schedule: &[Duration], delivered: i64) -> Option<Duration> {
+    let attempt = usize::try_from(delivered.max(1) - 1).unwrap_or(0);
+    schedule.get(attempt).or_else(|| schedule.last()).copied()
+}
+
+/// Delay for a failed handler: the error's `RetryAfter` if any, else the
+/// schedule entry for this delivery.
+pub fn redelivery_delay(
+    error: &anyhow::Error,
+    schedule: &[Duration],
+    delivered: i64,
+) -> Option<Duration> {
+    error
+        .downcast_ref::<RetryAfter>()
+        .map(|retry| retry.delay)
+        .or_else(|| backoff_delay(schedule, delivered))
+}
+
+/// Negatively acknowledge `message`, asking JetStream to redeliver it no
+/// sooner than `delay`.
+pub async fn nak_with_delay(message: &jetstream::Message, delay: Duration) -> Result<()> {
+    message
+        .ack_with(AckKind::Nak(Some(delay)))
+        .await
+        .map_err(|e| anyhow!("Failed to nak message: {}", e))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn schedule() -> Vec<Duration> {
+        vec![
+            Duration::from_secs(1),
+            Duration::from_secs(5),
+            Duration::from_secs(30),
+        ]
+    }
+
+    #[test]
+    fn test_backoff_follows_schedule_then_repeats_last() {
+        let schedule = schedule();
+        assert_eq!(backoff_delay(&schedule, 1), Some(Duration::from_secs(1)));
+        assert_eq!(backoff_delay(&schedule, 2), Some(Duration::from_secs(5)));
+        assert_eq!(backoff_delay(&schedule, 3), Some(Duration::from_secs(30)));
+        assert_eq!(backoff_delay(&schedule, 9), Some(Duration::from_secs(30)));
+        assert_eq!(backoff_delay(&schedule, 0), Some(Duration::from_secs(1)));
+        assert_eq!(backoff_delay(&[], 1), None);
+    }
+
+    #[test]
+    fn test_retry_after_overrides_schedule() {
+        let error = anyhow::Error::new(RetryAfter::new(
+            Duration::from_millis(250),
+            "billing API unavailable",
+        ));
+        assert_eq!(
+            redelivery_delay(&error, &schedule(), 1),
+            Some(Duration::from_millis(250))
+        );
+
+        let error = anyhow!("plain failure");
+        assert_eq!(
+            redelivery_delay(&error, &schedule(), 2),
+            Some(Duration::from_secs(5))
+        );
+    }
+}
@@ -1,7 +1,27 @@
+use super::archive::{archive_config, archived_at, unarchive_config, StreamNotArchivedError};
+use super::codec::{decode_event, EventEncoding};
+use super::connection_monitor::ConnectionMonitor;
+use super::firehose::FirehoseConfig;
+use super::publisher::AckMode;
+use super::sampling::SamplingConfig;
+use super::stream_cache::StreamInfoCache;
+use super::stream_diff::{diff_stream_config, StreamConfigDiff, UnsafeUpdateError};
+use super::stream_janitor::StreamJanitorConfig;
+use super::stream_migration::{migrate_stream, StreamMigration};
+use super::stream_reader::StreamReader;
+use super::subject::{stream_in_prefix, subjects_overlap};
+use super::ttl_purge::TtlPurgeConfig;
+use crate::event::FluxEvent;
 use anyhow::{Context, Result};
-use async_nats::jetstream::{self, stream};
-use serde::Deserialize;
-use tracing::info;
+use async_nats::jetstream::context::GetStreamErrorKind;
+use async_nats::jetstream::{self, stream, ErrorCode};
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap};
+use std::fmt;
+use std::path::Path;
+use std::sync::{Arc, Mutex};
+use tokio::sync::{broadcast, watch};
+use tracing::{info, warn};
 
 /// NATS configuration
 #[derive(Clone, Debug, Deserialize)]
@@ -12,10 +32,413 @@ pub struct NatsConfig {
     pub stream_subjects: Vec<String>,
     #[serde(default = "default_max_age_days")]
     pub max_age_days: i64,
+    /// Exact max age from FLUX_STREAM_<NAME>_MAX_AGE; takes precedence over
+    /// `max_age_days` (see `with_env_overrides`)
+    #[serde(skip)]
+    pub max_age: Option<std::time::Duration>,
     #[serde(default = "default_max_bytes")]
     pub max_bytes: i64,
+    /// How long JetStream remembers `Nats-Msg-Id`s to drop repeated publishes
+    /// (1s up to the max age). Match it to how long producers retry.
+    #[serde(default = "default_duplicate_window_seconds")]
+    pub duplicate_window_seconds: u64,
+    /// Send eventIds as `Nats-Msg-Id`, so an event published again within
+    /// the duplicate window is stored once (see `EventPublisher::with_deduplication`)
+    #[serde(default)]
+    pub deduplicate: bool,
+    /// How long producers keep retrying a failed publish. Startup warns if
+    /// this outlasts the duplicate window, as later retries are stored again.
+    #[serde(default)]
+    pub producer_retry_horizon_seconds: Option<u64>,
+    /// Apply config drift to an existing stream on startup (safe changes only)
+    #[serde(default)]
+    pub force_stream_update: bool,
+    /// Let the reconciler create missing streams and apply safe drift, at
+    /// startup and on POST /api/admin/reconcile (report only by default)
+    #[serde(default)]
+    pub reconcile_apply: bool,
+    /// How often to poll JetStream account usage (seconds)
+    #[serde(default = "default_account_poll_interval")]
+    pub account_poll_interval_seconds: u64,
+    /// Alert when a JetStream stream reaches this percentage of max_bytes / max_msgs
+    #[serde(default = "default_stream_usage_alert_pct")]
+    pub stream_usage_alert_pct: f64,
+    /// Refuse new events once the stream holds this many messages (None = no limit)
+    #[serde(default)]
+    pub max_stream_depth: Option<u64>,
+    /// JetStream message limit for the stream (None = unlimited)
+    #[serde(default)]
+    pub max_msgs: Option<i64>,
+    /// JetStream message limit per subject (None = unlimited). With events
+    /// published to per-key subjects this keeps the last N events per key
+    /// (see `NatsConfig::last_n_per_key`).
+    #[serde(default)]
+    pub max_msgs_per_subject: Option<i64>,
+    /// Largest message the stream stores, in bytes (None = unlimited)
+    #[serde(default)]
+    pub max_msg_size: Option<i32>,
+    /// What JetStream does at a limit: drop the oldest messages ("old", the
+    /// default) or reject new ones ("new")
+    #[serde(default)]
+    pub discard: DiscardPolicy,
+    /// With `discard = "new"`, reject only messages for subjects at
+    /// `max_msgs_per_subject` instead of applying the limit stream-wide
+    #[serde(default)]
+    pub discard_new_per_subject: bool,
+    /// Register Flux as a NATS micro service (publish / stream.create / stream.info)
+    #[serde(default)]
+    pub service_enabled: bool,
+    /// Largest sequence gap replayed directly after a reconnect; larger gaps alert
+    #[serde(default = "default_reconnect_max_gap")]
+    pub reconnect_max_gap: u64,
+    /// Give up after this many failed reconnect attempts (None = retry forever)
+    #[serde(default)]
+    pub max_reconnects: Option<usize>,
+    /// Fixed wait between reconnect attempts in milliseconds (None = the
+    /// client's exponential backoff)
+    #[serde(default)]
+    pub reconnect_wait_ms: Option<u64>,
+    /// Connection name shown in NATS monitoring (None =
+    /// `flux-service-<hostname>-<pid>`, see `default_connection_name`)
+    #[serde(default)]
+    pub client_name: Option<String>,
+    /// Tags appended to the connection name, e.g. env and region
+    #[serde(default)]
+    pub client_tags: BTreeMap<String, String>,
+    /// Event envelope encoding: "json" (default) or "protobuf"
+    #[serde(default)]
+    pub encoding: EventEncoding,
+    /// Gzip events whose envelope exceeds this many bytes (None = never compress)
+    #[serde(default)]
+    pub compress_above_bytes: Option<usize>,
+    /// How publishes wait for JetStream: "explicit" (default), "async" or
+    /// "none" (at most once, for telemetry that can tolerate loss)
+    #[serde(default)]
+    pub ack_mode: AckMode,
+    /// Per-stream sampling for high-frequency streams
+    #[serde(default)]
+    pub sampling: Vec<SamplingConfig>,
+    /// Maintain an eventId index (KV bucket FLUX_EVENT_INDEX) for GET /api/events/:id
+    #[serde(default)]
+    pub event_index_enabled: bool,
+    /// Copy stored events to core NATS subjects (`[nats.republish]`; off by default)
+    #[serde(default)]
+    pub republish: Option<RepublishConfig>,
+    /// Source every stream into one firehose stream (`[nats.firehose]`; off by default)
+    #[serde(default)]
+    pub firehose: Option<FirehoseConfig>,
+    /// Delete idle, empty auto-created streams (`[nats.janitor]`; off by default)
+    #[serde(default)]
+    pub janitor: Option<StreamJanitorConfig>,
+    /// Purge events once their TTL passes (`[nats.ttl_purge]`; off by default)
+    #[serde(default)]
+    pub ttl_purge: Option<TtlPurgeConfig>,
+    /// Let any replica answer message gets (direct get API)
+    #[serde(default = "default_allow_direct")]
+    pub allow_direct: bool,
+    /// Let mirrors of this stream answer direct gets (mirror streams only)
+    #[serde(default)]
+    pub mirror_direct: bool,
+    /// Refuse to delete the stream (append-only / regulatory streams)
+    #[serde(default)]
+    pub deny_delete: bool,
+    /// Refuse purges; messages only leave the stream through its limits
+    #[serde(default)]
+    pub deny_purge: bool,
+    /// JetStream domain to address (e.g. a leaf node's "edge-plant-a")
+    #[serde(default)]
+    pub domain: Option<String>,
+    /// Custom JetStream API prefix instead of `$JS.API` (ignored with a domain)
+    #[serde(default)]
+    pub api_prefix: Option<String>,
+    /// Streams handled by other JetStream domains (`[[nats.targets]]`)
+    #[serde(default)]
+    pub targets: Vec<JetStreamTarget>,
+    /// Directory of extra stream configs to create at startup, one JetStream
+    /// stream config per `*.json` / `*.yaml` file (e.g. a mounted ConfigMap)
+    #[serde(default)]
+    pub streams_dir: Option<String>,
 }
 
+/// What JetStream does when a stream reaches one of its limits.
+#[derive(Clone, Copy, Debug, Default, Deserialize, PartialEq, Eq)]
+#[serde(rename_all = "lowercase")]
+pub enum DiscardPolicy {
+    /// Drop the oldest messages to make room
+    #[default]
+    Old,
+    /// Keep stored messages and reject the publish
+    New,
+}
+
+impl From<DiscardPolicy> for stream::DiscardPolicy {
+    fn from(policy: DiscardPolicy) -> Self {
+        match policy {
+            DiscardPolicy::Old => stream::DiscardPolicy::Old,
+            DiscardPolicy::New => stream::DiscardPolicy::New,
+        }
+    }
+}
+
+/// Route Flux streams under `stream_prefix` to another JetStream domain or API
+/// prefix, e.g. a leaf node at an edge site.
+#[derive(Clone, Debug, Deserialize)]
+pub struct JetStreamTarget {
+    /// Flux stream prefix: `plant.a` covers `plant.a` and `plant.a.*`
+    pub stream_prefix: String,
+    #[serde(default)]
+    pub domain: Option<String>,
+    #[serde(default)]
+    pub api_prefix: Option<String>,
+}
+
+/// JetStream context addressed by `domain`, else `api_prefix`, else the default API.
+pub fn jetstream_context(
+    client: &async_nats::Client,
+    domain: Option<&str>,
+    api_prefix: Option<&str>,
+) -> jetstream::Context {
+    match (domain, api_prefix) {
+        (Some(domain), _) => jetstream::with_domain(client.clone(), domain),
+        (None, Some(prefix)) => jetstream::with_prefix(client.clone(), prefix),
+        (None, None) => jetstream::new(client.clone()),
+    }
+}
+
+/// Value routed for `stream`: the entry with the longest matching prefix.
+pub(crate) fn route<'a, T>(routes: &'a [(String, T)], stream: &str) -> Option<&'a T> {
+    routes
+        .iter()
+        .filter(|(prefix, _)| stream_in_prefix(stream, prefix))
+        .max_by_key(|(prefix, _)| prefix.len())
+        .map(|(_, value)| value)
+}
+
+/// Stream RePublish settings: JetStream re-sends every stored message matching
+/// `source` on a core NATS subject, for subscribers that don't need a consumer.
+#[derive(Clone, Debug, Deserialize)]
+pub struct RepublishConfig {
+    /// Subjects to republish; narrow it to a stream prefix such as
+    /// `flux.events.sensors.>` to republish only those streams
+    #[serde(default = "default_republish_source")]
+    pub source: String,
+    /// Destination subject template, e.g. `live.>` (the `>` receives the tokens
+    /// matched by the source's `>`). Must not overlap the stream's own subjects.
+    pub destination: String,
+    /// Republish headers only (size in `Nats-Msg-Size`), not the event body
+    #[serde(default)]
+    pub headers_only: bool,
+}
+
+fn default_republish_source() -> String {
+    "flux.events.>".to_string()
+}
+
+impl RepublishConfig {
+    /// Fail if the destination would be captured by the stream again (a loop).
+    pub fn validate(&self, stream_subjects: &[String]) -> Result<(), RepublishLoopError> {
+        match stream_subjects
+            .iter()
+            .find(|subject| subjects_overlap(&self.destination, subject))
+        {
+            Some(subject) => Err(RepublishLoopError {
+                destination: self.destination.clone(),
+                stream_subject: subject.clone(),
+            }),
+            None => Ok(()),
+        }
+    }
+}
+
+/// Returned when a republish destination overlaps the stream's own subjects.
+#[derive(Debug, Clone, PartialEq)]
+pub struct RepublishLoopError {
+    pub destination: String,
+    pub stream_subject: String,
+}
+
+impl fmt::Display for RepublishLoopError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "republish destination '{}' overlaps stream subject '{}' and would loop",
+            self.destination, self.stream_subject
+        )
+    }
+}
+
+impl std::error::Error for RepublishLoopError {}
+
+/// Returned by stream management calls for a stream that does not exist.
+#[derive(Debug, Clone, PartialEq)]
+pub struct StreamNotFoundError {
+    pub stream: String,
+}
+
+impl fmt::Display for StreamNotFoundError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "stream '{}' not found", self.stream)
+    }
+}
+
+impl std::error::Error for StreamNotFoundError {}
+
+/// Returned for a duplicate window shorter than a second or longer than the
+/// stream's max age.
+#[derive(Debug, Clone, PartialEq)]
+pub struct DuplicateWindowError {
+    pub stream: String,
+    pub window: std::time::Duration,
+    pub max_age: std::time::Duration,
+}
+
+impl fmt::Display for DuplicateWindowError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "duplicate window {:?} of stream '{}' must be between 1s and its max age ({:?})",
+            self.window, self.stream, self.max_age
+        )
+    }
+}
+
+impl std::error::Error for DuplicateWindowError {}
+
+/// What initializing one stream did.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum StreamInitStatus {
+    Created,
+    /// Existed already; any drift was only logged
+    AlreadyExisted,
+    /// Existed with drift, which was applied (`force_stream_update`)
+    Reconciled,
+    Failed,
+}
+
+/// Outcome of initializing one stream (see `NatsClient::initialize_streams`).
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct StreamInitResult {
+    pub stream: String,
+    pub status: StreamInitStatus,
+    /// Why it failed (status `Failed` only)
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+}
+
+impl StreamInitResult {
+    pub(crate) fn from_result(stream: &str, result: &Result<StreamInitStatus>) -> Self {
+        match result {
+            Ok(status) => Self {
+                stream: stream.to_string(),
+                status: *status,
+                error: None,
+            },
+            Err(e) => Self {
+                stream: stream.to_string(),
+                status: StreamInitStatus::Failed,
+                error: Some(format!("{:#}", e)),
+            },
+        }
+    }
+}
+
+/// Returned when JetStream refuses to create a stream (invalid name,
+/// overlapping subjects, account limits).
+#[derive(Debug)]
+pub struct StreamCreateError {
+    pub stream: String,
+    pub source: anyhow::Error,
+}
+
+impl fmt::Display for StreamCreateError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "failed to create stream '{}': {:#}", self.stream, self.source)
+    }
+}
+
+impl std::error::Error for StreamCreateError {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        Some(self.source.as_ref())
+    }
+}
+
+/// Returned by `create_streams_batch` when a stream in the batch could not be
+/// created. The streams the batch had created before it are rolled back.
+#[derive(Debug)]
+pub struct BatchStreamError {
+    /// Config of the stream that failed
+    pub failed: stream::Config,
+    pub source: anyhow::Error,
+    /// Streams created by the batch before the failure, in order
+    pub created: Vec<String>,
+}
+
+impl fmt::Display for BatchStreamError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "failed to create stream '{}' (rolled back {} created stream(s)): {:#}",
+            self.failed.name,
+            self.created.len(),
+            self.source
+        )
+    }
+}
+
+impl std::error::Error for BatchStreamError {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        Some(self.source.as_ref())
+    }
+}
+
+/// Returned when no message is stored at the requested sequence (including
+/// the first/last message of an empty stream).
+#[derive(Debug, Clone, PartialEq)]
+pub struct MessageNotFoundError {
+    pub stream: String,
+    pub sequence: u64,
+}
+
+impl fmt::Display for MessageNotFoundError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "no message at sequence {} in stream '{}'",
+            self.sequence, self.stream
+        )
+    }
+}
+
+impl std::error::Error for MessageNotFoundError {}
+
+/// Returned by `delete_stream` / `purge_stream` when the stream's flags forbid it.
+#[derive(Debug, Clone, PartialEq)]
+pub struct StreamProtectedError {
+    pub stream: String,
+    /// "delete" or "purge"
+    pub operation: &'static str,
+    /// Flag that forbids it: "deny_delete", "deny_purge" or "sealed"
+    pub flag: &'static str,
+}
+
+impl fmt::Display for StreamProtectedError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "stream '{}' is protected ({} is set) and cannot be {}d",
+            self.stream, self.flag, self.operation
+        )?;
+        if self.operation == "purge" {
+            write!(f, "; messages leave it only through max_age / max_bytes")
+        } else {
+            write!(f, "; removing it needs a NATS operator")
+        }
+    }
+}
+
+impl std::error::Error for StreamProtectedError {}
+
 fn default_stream_subjects() -> Vec<String> {
     vec!["flux.events.>".to_string()]
 }
@@ -28,6 +451,76 @@ fn default_max_bytes() -> i64 {
     10 * 1024 * 1024 * 1024 // 10GB
 }
 
+fn default_duplicate_window_seconds() -> u64 {
+    120
+}
+
+fn default_account_poll_interval() -> u64 {
+    30
+}
+
+fn default_stream_usage_alert_pct() -> f64 {
+    80.0
+}
+
+fn default_reconnect_max_gap() -> u64 {
+    10_000
+}
+
+fn default_allow_direct() -> bool {
+    true
+}
+
+/// Parse the stream configs in `dir` (see `NatsClient::initialize_from_directory`).
+fn read_stream_configs(dir: &Path) -> Result<Vec<stream::Config>> {
+    let mut paths: Vec<_> = std::fs::read_dir(dir)
+        .with_context(|| format!("failed to read stream config directory '{}'", dir.display()))?
+        .filter_map(|entry| entry.ok().map(|e| e.path()))
+        .filter(|path| {
+            let ext = path.extension().and_then(|e| e.to_str());
+            path.is_file() && matches!(ext, Some("json" | "yaml" | "yml"))
+        })
+        .collect();
+    paths.sort();
+
+    let mut configs = Vec::with_capacity(paths.len());
+    for path in paths {
+        match parse_stream_config(&path) {
+            Ok(config) => configs.push(config),
+            Err(e) => {
+                warn!(file = %path.display(), error = %format!("{:#}", e), "Skipping stream config")
+            }
+        }
+    }
+    Ok(configs)
+}
+
+fn parse_stream_config(path: &Path) -> Result<stream::Config> {
+    let contents = std::fs::read_to_string(path)?;
+    let config: stream::Config = if path.extension().is_some_and(|e| e == "json") {
+        serde_json::from_str(&contents)?
+    } else {
+        serde_yaml::from_str(&contents)?
+    };
+    if config.name.is_empty() {
+        anyhow::bail!("stream config has no name");
+    }
+    Ok(config)
+}
+
+/// `flux-service-<hostname>-<pid>`, so replicas can be told apart in NATS
+/// monitoring. The hostname comes from HOSTNAME (set in containers), else
+/// /etc/hostname.
+pub fn default_connection_name() -> String {
+    let hostname = std::env::var("HOSTNAME")
+        .ok()
+        .or_else(|| std::fs::read_to_string("/etc/hostname").ok())
+        .map(|hostname| hostname.trim().to_string())
+        .filter(|hostname| !hostname.is_empty())
+        .unwrap_or_else(|| "unknown".to_string());
+    format!("flux-service-{}-{}", hostname, std::process::id())
+}
+
 impl Default for NatsConfig {
     fn default() -> Self {
         Self {
@@ -35,7 +528,266 @@ impl Default for NatsConfig {
             stream_name: "FLUX_EVENTS".to_string(),
             stream_subjects: vec!["flux.events.>".to_string()],
             max_age_days: 7,
+            max_age: None,
             max_bytes: 10 * 1024 * 1024 * 1024, // 10GB
+            duplicate_window_seconds: default_duplicate_window_seconds(),
+            deduplicate: false,
+            producer_retry_horizon_seconds: None,
+            force_stream_update: false,
+            reconcile_apply: false,
+            account_poll_interval_seconds: default_account_poll_interval(),
+            stream_usage_alert_pct: default_stream_usage_alert_pct(),
+            max_stream_depth: None,
+            max_msgs: None,
+            max_msgs_per_subject: None,
+            max_msg_size: None,
+            discard: DiscardPolicy::Old,
+            discard_new_per_subject: false,
+            service_enabled: false,
+            reconnect_max_gap: default_reconnect_max_gap(),
+            max_reconnects: None,
+            reconnect_wait_ms: None,
+            client_name: None,
+            client_tags: BTreeMap::new(),
+            encoding: EventEncoding::Json,
+            compress_above_bytes: None,
+            ack_mode: AckMode::Explicit,
+            sampling: Vec::new(),
+            event_index_enabled: false,
+            republish: None,
+            firehose: None,
+            janitor: None,
+            ttl_purge: None,
+            allow_direct: default_allow_direct(),
+            mirror_direct: false,
+            deny_delete: false,
+            deny_purge: false,
+            domain: None,
+            api_prefix: None,
+            targets: Vec::new(),
+            streams_dir: None,
+        }
+    }
+}
+
+impl NatsConfig {
+    /// Default config for a stream that rejects new messages at its limits,
+    /// e.g. a buffer in front of a slow consumer. Set `max_msgs` (or rely on
+    /// `max_bytes`) for the limit to apply.
+    pub fn discard_new(stream_name: impl Into<String>) -> Self {
+        Self {
+            stream_name: stream_name.into(),
+            discard: DiscardPolicy::New,
+            ..Default::default()
+        }
+    }
+
+    /// Default config for a stream that keeps the last `n` events per key,
+    /// e.g. the latest readings of each sensor: at `n` messages on a subject
+    /// JetStream drops that subject's oldest message (limits retention,
+    /// DiscardOld).
+    ///
+    /// The limit applies per NATS subject, so it only means "per key" when
+    /// events are published to per-key subjects such as
+    /// `flux.events.sensor.readings.sensor-01`: capture them in
+    /// `stream_subjects` (`wildcard_subjects`) and route with
+    /// `EventPublisher::with_subject_mapping`. Events sharing one subject
+    /// share the limit.
+    pub fn last_n_per_key(stream_name: impl Into<String>, n: i64) -> Self {
+        Self {
+            stream_name: stream_name.into(),
+            max_msgs_per_subject: Some(n),
+            discard: DiscardPolicy::Old,
+            ..Default::default()
+        }
+    }
+
+    /// Default config for a stream written with `OrderedPublisher`: the last
+    /// event per subject is kept (`max_msgs_per_subject = 1`), retried
+    /// events are dropped for 30 seconds (`deduplicate`), and at the stream-wide
+    /// limits publishes are rejected rather than older events dropped
+    /// (DiscardNew).
+    ///
+    /// JetStream itself stores messages in arrival order only; per-key order
+    /// across concurrent publishers comes from `OrderedPublisher`, which
+    /// holds each publish until the previous one for its key is acked.
+    pub fn ordered(stream_name: impl Into<String>) -> Self {
+        Self {
+            stream_name: stream_name.into(),
+            max_msgs_per_subject: Some(1),
+            duplicate_window_seconds: 30,
+            deduplicate: true,
+            discard: DiscardPolicy::New,
+            ..Default::default()
+        }
+    }
+
+    /// Give up reconnecting after `attempts` failures, waiting `wait` between
+    /// attempts. See `NatsClient::subscribe_reconnects_exhausted`.
+    pub fn with_max_reconnects(mut self, attempts: usize, wait: std::time::Duration) -> Self {
+        self.max_reconnects = Some(attempts);
+        self.reconnect_wait_ms = Some(wait.as_millis() as u64);
+        self
+    }
+
+    /// Limit stored messages to `bytes` each.
+    pub fn with_max_msg_size(mut self, bytes: i32) -> Self {
+        self.max_msg_size = Some(bytes);
+        self
+    }
+
+    /// Name the connection `name` in NATS monitoring instead of
+    /// `flux-service-<hostname>-<pid>`.
+    pub fn with_connection_name(mut self, name: impl Into<String>) -> Self {
+        self.client_name = Some(name.into());
+        self
+    }
+
+    /// Append `tags` to the connection name as ` [key=value,...]` (in key
+    /// order), e.g. `flux-service-pod-01 [env=prod,region=us-east]`.
+    pub fn with_connection_tags(mut self, tags: BTreeMap<String, String>) -> Self {
+        self.client_tags = tags;
+        self
+    }
+
+    /// Name sent to the server on connect: `client_name` or the default,
+    /// followed by the tags.
+    pub fn connection_name(&self) -> String {
+        let name = self
+            .client_name
+            .clone()
+            .unwrap_or_else(default_connection_name);
+        if self.client_tags.is_empty() {
+            return name;
+        }
+        let tags: Vec<String> = self
+            .client_tags
+            .iter()
+            .map(|(key, value)| format!("{}={}", key, value))
+            .collect();
+        format!("{} [{}]", name, tags.join(","))
+    }
+
+    /// Apply per-stream environment overrides:
+    ///
+    /// - `FLUX_STREAM_<NAME>_MAX_AGE`: a duration such as `72h`, `1h30m` or `14d`
+    /// - `FLUX_STREAM_<NAME>_MAX_BYTES`: bytes, optionally with a `KB`/`MB`/`GB`/`TB`
+    ///   suffix (powers of 1024)
+    ///
+    /// `<NAME>` is the stream name upper-cased with other characters than
+    /// letters and digits replaced by `_` (`FLUX_EVENTS` for the event stream).
+    ///
+    /// Also the connection settings `NATS_MAX_RECONNECTS`: reconnect attempts
+    /// before giving up (`-1` = forever), and `NATS_CLIENT_NAME`: the
+    /// connection name (like `NATS_URL`, without the `FLUX_` prefix).
+    /// Unparseable values are logged and ignored.
+    pub fn with_env_overrides(self) -> Self {
+        let mut cfg = self;
+        if let Ok(name) = std::env::var("NATS_CLIENT_NAME") {
+            if !name.trim().is_empty() {
+                cfg.client_name = Some(name.trim().to_string());
+            }
+        }
+        if let Ok(v) = std::env::var("NATS_MAX_RECONNECTS") {
+            match v.trim().parse::<i64>() {
+                Ok(-1) => cfg.max_reconnects = None,
+                Ok(n) if n >= 0 => {
+                    info!(max_reconnects = n, "NATS max reconnects overridden");
+                    cfg.max_reconnects = Some(n as usize);
+                }
+                _ => warn!(value = %v, "Ignoring invalid NATS_MAX_RECONNECTS"),
+            }
+        }
+
+        let prefix = format!("FLUX_STREAM_{}", env_stream_name(&cfg.stream_name));
+
+        let var = format!("{}_MAX_AGE", prefix);
+        if let Ok(v) = std::env::var(&var) {
+            match parse_duration(&v) {
+                Some(max_age) => {
+                    info!(var = %var, max_age = ?max_age, "Stream max age overridden");
+                    cfg.max_age = Some(max_age);
+                }
+                None => warn!(var = %var, value = %v, "Ignoring invalid stream max age"),
+            }
+        }
+        let var = format!("{}_MAX_BYTES", prefix);
+        if let Ok(v) = std::env::var(&var) {
+            match parse_bytes(&v) {
+                Some(max_bytes) => {
+                    info!(var = %var, max_bytes, "Stream max bytes overridden");
+                    cfg.max_bytes = max_bytes;
+                }
+                None => warn!(var = %var, value = %v, "Ignoring invalid stream max bytes"),
+            }
+        }
+
+        cfg
+    }
+
+    /// Window in which JetStream drops publishes repeating a `Nats-Msg-Id`.
+    pub fn duplicate_window(&self) -> std::time::Duration {
+        std::time::Duration::from_secs(self.duplicate_window_seconds)
+    }
+
+    /// Check the duplicate window is at least a second and no longer than
+    /// the max age (JetStream rejects longer ones; 0 max age is unlimited).
+    pub fn validate_duplicate_window(&self) -> Result<(), DuplicateWindowError> {
+        let config = self.stream_config();
+        let window = config.duplicate_window;
+        let too_long = !config.max_age.is_zero() && window > config.max_age;
+        if window < std::time::Duration::from_secs(1) || too_long {
+            return Err(DuplicateWindowError {
+                stream: config.name,
+                window,
+                max_age: config.max_age,
+            });
+        }
+        Ok(())
+    }
+
+    /// `producer_retry_horizon_seconds`, if producers keep retrying after
+    /// the duplicate window has forgotten the first attempt.
+    pub fn retry_horizon_beyond_window(&self) -> Option<std::time::Duration> {
+        self.producer_retry_horizon_seconds
+            .map(std::time::Duration::from_secs)
+            .filter(|horizon| *horizon > self.duplicate_window())
+    }
+
+    /// Desired JetStream stream configuration
+    ///
+    /// File storage, limits retention, and by default DiscardOld: at
+    /// `max_age` / `max_bytes` / `max_msgs` the oldest events are dropped, so
+    /// publishers never block but a slow consumer can lose events it has not
+    /// read yet. With `discard = "new"` nothing stored is ever dropped early;
+    /// publishes fail instead once a limit is reached, pushing back on
+    /// producers. Events still age out at `max_age` either way.
+    pub fn stream_config(&self) -> stream::Config {
+        stream::Config {
+            name: self.stream_name.clone(),
+            subjects: self.stream_subjects.clone(),
+            max_age: self.max_age.unwrap_or_else(|| {
+                std::time::Duration::from_secs((self.max_age_days * 86400) as u64)
+            }),
+            max_bytes: self.max_bytes,
+            duplicate_window: self.duplicate_window(),
+            max_messages: self.max_msgs.unwrap_or(-1),
+            max_messages_per_subject: self.max_msgs_per_subject.unwrap_or(-1),
+            max_message_size: self.max_msg_size.unwrap_or(-1),
+            discard: self.discard.into(),
+            discard_new_per_subject: self.discard_new_per_subject,
+            storage: stream::StorageType::File,
+            retention: stream::RetentionPolicy::Limits,
+            republish: self.republish.as_ref().map(|r| stream::Republish {
+                source: r.source.clone(),
+                destination: r.destination.clone(),
+                headers_only: r.headers_only,
+            }),
+            allow_direct: self.allow_direct,
+            mirror_direct: self.mirror_direct,
+            deny_delete: self.deny_delete,
+            deny_purge: self.deny_purge,
+            ..Default::default()
         }
     }
 }
@@ -44,24 +796,131 @@ impl Default for NatsConfig {
 pub struct NatsClient {
     client: async_nats::Client,
     jetstream: jetstream::Context,
+    targets: Vec<(String, jetstream::Context)>,
     config: NatsConfig,
+    reconnect_tx: broadcast::Sender<()>,
+    monitor: Arc<ConnectionMonitor>,
+    exhausted_rx: watch::Receiver<bool>,
+    init_report: Vec<StreamInitResult>,
+    stream_cache: StreamInfoCache,
+    /// One lock per stream name, held while initializing it, so concurrent
+    /// callers wait for the first to create a stream instead of racing it
+    init_locks: InitLocks,
+}
+
+type InitLocks = Mutex<HashMap<String, Arc<tokio::sync::Mutex<()>>>>;
+
+/// A held per-stream init lock. Dropping it removes the stream's entry from
+/// `init_locks` unless another caller is waiting on it, so the map only holds
+/// names being initialized right now.
+struct InitLock<'a> {
+    locks: &'a InitLocks,
+    name: String,
+    lock: Arc<tokio::sync::Mutex<()>>,
+    guard: Option<tokio::sync::OwnedMutexGuard<()>>,
+}
+
+impl<'a> InitLock<'a> {
+    async fn acquire(locks: &'a InitLocks, name: &str) -> InitLock<'a> {
+        let lock = Arc::clone(locks.lock().unwrap().entry(name.to_string()).or_default());
+        // Registered before waiting, so a cancelled waiter still cleans up
+        let mut held = InitLock {
+            locks,
+            name: name.to_string(),
+            lock,
+            guard: None,
+        };
+        held.guard = Some(Arc::clone(&held.lock).lock_owned().await);
+        held
+    }
+}
+
+impl Drop for InitLock<'_> {
+    fn drop(&mut self) {
+        self.guard.take();
+        // Callers only clone the lock with the map locked, so nobody can
+        // start waiting between the count and the removal. The map and this
+        // lock hold one reference each.
+        let mut locks = self.locks.lock().unwrap();
+        if Arc::strong_count(&self.lock) == 2 {
+            locks.remove(&self.name);
+        }
+    }
 }
 
 impl NatsClient {
     /// Connect to NATS and initialize JetStream
     pub async fn connect(config: NatsConfig) -> Result<Self> {
-        info!("Connecting to NATS at {}", config.url);
+        let name = config.connection_name();
+        info!(name = %name, "Connecting to NATS at {}", config.url);
 
-        let client = async_nats::connect(&config.url)
+        let (reconnect_tx, _) = broadcast::channel(16);
+        let events_tx = reconnect_tx.clone();
+        let monitor = Arc::new(ConnectionMonitor::new(config.url.clone()));
+        monitor.on_reconnect(move |_| {
+            let _ = events_tx.send(());
+        });
+        let events_monitor = Arc::clone(&monitor);
+        let (exhausted_tx, exhausted_rx) = watch::channel(false);
+        let mut options = async_nats::ConnectOptions::new()
+            .name(name)
+            .max_reconnects(config.max_reconnects);
+        if let Some(wait_ms) = config.reconnect_wait_ms {
+            options = options
+                .reconnect_delay_callback(move |_| std::time::Duration::from_millis(wait_ms));
+        }
+        let client = options
+            .event_callback(move |event| {
+                events_monitor.handle(&event);
+                if let async_nats::Event::ClientError(async_nats::ClientError::MaxReconnects) =
+                    event
+                {
+                    exhausted_tx.send_replace(true);
+                }
+                async {}
+            })
+            .connect(&config.url)
             .await
             .context("Failed to connect to NATS")?;
+        monitor.set_connected();
 
-        let jetstream = jetstream::new(client.clone());
+        let jetstream = jetstream_context(
+            &client,
+            config.domain.as_deref(),
+            config.api_prefix.as_deref(),
+        );
+        let targets = config
+            .targets
+            .iter()
+            .map(|target| {
+                info!(
+                    stream_prefix = %target.stream_prefix,
+                    domain = target.domain.as_deref().unwrap_or(""),
+                    api_prefix = target.api_prefix.as_deref().unwrap_or(""),
+                    "JetStream target configured"
+                );
+                (
+                    target.stream_prefix.clone(),
+                    jetstream_context(
+                        &client,
+                        target.domain.as_deref(),
+                        target.api_prefix.as_deref(),
+                    ),
+                )
+            })
+            .collect();
 
         let mut nats_client = Self {
             client,
             jetstream,
+            targets,
             config,
+            reconnect_tx,
+            monitor,
+            exhausted_rx,
+            init_report: Vec::new(),
+            stream_cache: StreamInfoCache::new(),
+            init_locks: Mutex::new(HashMap::new()),
         };
 
         nats_client.ensure_stream().await?;
@@ -69,48 +928,779 @@ impl NatsClient {
         Ok(nats_client)
     }
 
+    /// Connect, retrying with backoff (1s doubling to 30s) until NATS is
+    /// reachable and the stream is ensured. Used for lazy startup.
+    pub async fn connect_with_retry(config: NatsConfig) -> Self {
+        let mut delay = std::time::Duration::from_secs(1);
+        loop {
+            match Self::connect(config.clone()).await {
+                Ok(client) => return client,
+                Err(e) => {
+                    warn!(
+                        error = %e,
+                        retry_in_ms = delay.as_millis() as u64,
+                        "NATS unavailable, retrying"
+                    );
+                    tokio::time::sleep(delay).await;
+                    delay = (delay * 2).min(std::time::Duration::from_secs(30));
+                }
+            }
+        }
+    }
+
     /// Ensure JetStream stream exists with proper configuration
+    ///
+    /// An existing stream is diffed against the configured one. Drift is only
+    /// logged unless `force_stream_update` is set, in which case safe changes are
+    /// applied and unsafe ones (storage, retention) fail startup.
     async fn ensure_stream(&mut self) -> Result<()> {
-        info!("Ensuring JetStream stream '{}' exists", self.config.stream_name);
+        if let Some(republish) = &self.config.republish {
+            republish.validate(&self.config.stream_subjects)?;
+        }
+        self.config.validate_duplicate_window()?;
+
+        let config = self.config.stream_config();
+        let result = self.initialize_stream(&config).await;
+        self.init_report = vec![StreamInitResult::from_result(&config.name, &result)];
+        result.map(|_| ())
+    }
+
+    /// Create each configured stream, or reconcile it if it exists (drift is
+    /// applied only with `force_stream_update`). Best effort: a failure is
+    /// logged and recorded, and the remaining streams are still initialized.
+    pub async fn initialize_streams(&self, configs: &[stream::Config]) -> Vec<StreamInitResult> {
+        let mut results = Vec::with_capacity(configs.len());
+        for config in configs {
+            let result = self.initialize_stream(config).await;
+            if let Err(e) = &result {
+                warn!(stream = %config.name, error = %e, "Failed to initialize stream");
+            }
+            results.push(StreamInitResult::from_result(&config.name, &result));
+        }
+        results
+    }
+
+    /// Initialize the streams defined in `dir`: every `*.json`, `*.yaml` and
+    /// `*.yml` file holds one JetStream stream config. Files that cannot be
+    /// read or parsed, or have no stream name, are logged and skipped; the
+    /// rest go through `initialize_streams` in file name order. Fails only if
+    /// `dir` itself cannot be read.
+    pub async fn initialize_from_directory(
+        &self,
+        dir: impl AsRef<Path>,
+    ) -> Result<Vec<StreamInitResult>> {
+        let configs = read_stream_configs(dir.as_ref())?;
+        Ok(self.initialize_streams(&configs).await)
+    }
+
+    /// Initialize `configs` in order, all or nothing: if one fails, every
+    /// stream this batch created is deleted again and a `BatchStreamError` is
+    /// returned. Streams that already existed are left as they are (including
+    /// any drift applied with `force_stream_update`). Rollback is best effort;
+    /// a stream that cannot be deleted is logged and the original error kept.
+    pub async fn create_streams_batch(&self, configs: &[stream::Config]) -> Result<()> {
+        let mut created = Vec::new();
+        for config in configs {
+            match self.initialize_stream(config).await {
+                Ok(StreamInitStatus::Created) => created.push(config.name.clone()),
+                Ok(_) => {}
+                Err(source) => {
+                    warn!(
+                        stream = %config.name,
+                        error = %source,
+                        created = created.len(),
+                        "Stream batch failed, rolling back"
+                    );
+                    for name in created.iter().rev() {
+                        if let Err(e) = self.jetstream.delete_stream(name).await {
+                            warn!(stream = %name, error = %e, "Failed to roll back stream");
+                        }
+                    }
+                    self.stream_cache.invalidate();
+                    return Err(BatchStreamError {
+                        failed: config.clone(),
+                        source,
+                        created,
+                    }
+                    .into());
+                }
+            }
+        }
+        Ok(())
+    }
+
+    /// Create or reconcile one stream. Safe to call concurrently: callers for
+    /// the same name run one at a time, so only the first reports `Created`.
+    async fn initialize_stream(&self, config: &stream::Config) -> Result<StreamInitStatus> {
+        let _lock = InitLock::acquire(&self.init_locks, &config.name).await;
+        info!("Ensuring JetStream stream '{}' exists", config.name);
 
         // Check if stream exists
-        match self.jetstream.get_stream(&self.config.stream_name).await {
-            Ok(_existing_stream) => {
-                info!("Stream '{}' already exists", self.config.stream_name);
-                return Ok(());
+        match self.jetstream.get_stream(&config.name).await {
+            Ok(existing_stream) => {
+                info!("Stream '{}' already exists", config.name);
+                let diff = diff_stream_config(&existing_stream.cached_info().config, config);
+                let applied = !diff.is_empty() && self.config.force_stream_update;
+                self.reconcile_stream(diff).await?;
+                return Ok(if applied {
+                    StreamInitStatus::Reconciled
+                } else {
+                    StreamInitStatus::AlreadyExisted
+                });
             }
             Err(_) => {
-                info!("Stream '{}' does not exist, creating...", self.config.stream_name);
+                info!("Stream '{}' does not exist, creating...", config.name);
             }
         }
 
         // Create stream
-        let stream_config = stream::Config {
-            name: self.config.stream_name.clone(),
-            subjects: self.config.stream_subjects.clone(),
-            max_age: std::time::Duration::from_secs((self.config.max_age_days * 86400) as u64),
-            max_bytes: self.config.max_bytes,
-            storage: stream::StorageType::File,
-            retention: stream::RetentionPolicy::Limits,
-            ..Default::default()
-        };
+        self.jetstream
+            .create_stream(config.clone())
+            .await
+            .map_err(|e| StreamCreateError {
+                stream: config.name.clone(),
+                source: e.into(),
+            })?;
+        self.stream_cache.invalidate();
+
+        info!("Created JetStream stream '{}'", config.name);
+        Ok(StreamInitStatus::Created)
+    }
+
+    /// Log or apply drift between the live stream and the configured one.
+    async fn reconcile_stream(&self, diff: StreamConfigDiff) -> Result<()> {
+        if diff.is_empty() {
+            return Ok(());
+        }
+
+        for change in &diff.changes {
+            warn!(
+                stream = %diff.stream,
+                field = change.field,
+                current = %change.current,
+                desired = %change.desired,
+                safe = change.safe,
+                "Stream config drift detected"
+            );
+        }
+
+        if !self.config.force_stream_update {
+            warn!(
+                stream = %diff.stream,
+                "Stream config differs from configuration; set nats.force_stream_update = true to apply"
+            );
+            return Ok(());
+        }
+
+        self.apply_stream_diff(&diff).await
+    }
+
+    /// Compare the live stream config with the configured one.
+    pub async fn diff_stream_config(&self) -> Result<StreamConfigDiff> {
+        let stream = self.stream(&self.config.stream_name).await?;
+
+        Ok(diff_stream_config(
+            &stream.cached_info().config,
+            &self.config.stream_config(),
+        ))
+    }
+
+    /// Apply a diff with UpdateStream.
+    ///
+    /// Returns `UnsafeUpdateError` (without changing anything) if the diff contains
+    /// fields JetStream cannot update in place.
+    pub async fn apply_stream_diff(&self, diff: &StreamConfigDiff) -> Result<()> {
+        if diff.is_empty() {
+            return Ok(());
+        }
+
+        if diff.has_unsafe_changes() {
+            return Err(UnsafeUpdateError {
+                stream: diff.stream.clone(),
+                fields: diff.unsafe_fields(),
+            }
+            .into());
+        }
+
+        self.jetstream
+            .update_stream(&diff.desired)
+            .await
+            .context("Failed to update JetStream stream")?;
+        self.stream_cache.invalidate();
 
+        info!(
+            stream = %diff.stream,
+            changes = diff.changes.len(),
+            "Applied stream config update"
+        );
+        Ok(())
+    }
+
+    /// Change a stream from `current` (its live config) to `desired` without
+    /// losing messages, including changes `apply_stream_diff` refuses.
+    ///
+    /// Changes UpdateStream applies without dropping messages (longer max
+    /// age, new subjects, ...) are applied in place. Unsafe changes (storage,
+    /// retention policy, deny flags; see `diff_stream_config`) and lowered
+    /// retention limits, which UpdateStream would apply by silently dropping
+    /// messages, are migrated by copy:
+    ///
+    /// 1. A mirror `<name>_DEPRECATED` (`DEPRECATED_STREAM_SUFFIX`) copies
+    ///    the stream with the same sequences while it still takes publishes.
+    /// 2. The stream's subjects are released, so publishes to them fail, and
+    ///    the mirror catches up with the last message.
+    /// 3. The stream is deleted, noting its consumers, and recreated with
+    ///    `desired`, sourcing from the mirror without subjects of its own.
+    /// 4. Once every message is replayed, it gets its subjects back.
+    /// 5. Durable consumers are recreated with their config, starting after
+    ///    the last message they acked. Ephemeral consumers are not kept.
+    ///
+    /// Publishes fail from step 2 to 4, for as long as the replay takes;
+    /// consumers are gone from step 3 to 5. The mirror is never deleted: it
+    /// keeps every old message (marked with `DEPRECATED_LABEL`) until its
+    /// own limits expire them, and must be deleted before migrating the same
+    /// stream by copy again. If a step fails, the messages are in the mirror.
+    pub async fn migrate_stream(
+        &self,
+        current: &stream::Config,
+        desired: &stream::Config,
+    ) -> Result<StreamMigration> {
+        let migration = migrate_stream(&self.jetstream, current, desired).await;
+        self.stream_cache.invalidate();
+        migration
+    }
+
+    /// Turn on direct gets for an existing stream created before
+    /// `allow_direct` was set. Returns false if it was already on.
+    ///
+    /// Only `allow_direct` is changed; other drift is left to
+    /// `force_stream_update`.
+    pub async fn enable_direct_get(&self) -> Result<bool> {
+        let mut stream = self.stream(&self.config.stream_name).await?;
+        let mut config = stream.info().await?.config.clone();
+        if config.allow_direct {
+            return Ok(false);
+        }
+
+        config.allow_direct = true;
         self.jetstream
-            .create_stream(stream_config)
+            .update_stream(&config)
             .await
-            .context("Failed to create JetStream stream")?;
+            .context("Failed to update JetStream stream")?;
+        self.stream_cache.invalidate();
+        info!(stream = %self.config.stream_name, "Enabled direct get");
+        Ok(true)
+    }
+
+    /// Archive a stream: its subjects are released so no new events land
+    /// (publishes fail with `StreamArchivedError`), while stored messages
+    /// stay readable. With `grace`, retention shrinks to it and
+    /// `unarchive_stream` only works within it.
+    ///
+    /// Returns false if it was already archived.
+    pub async fn archive_stream(
+        &self,
+        name: &str,
+        grace: Option<std::time::Duration>,
+    ) -> Result<bool> {
+        let config = self.stream(name).await?.cached_info().config.clone();
+        if archived_at(&config).is_some() {
+            return Ok(false);
+        }
+        self.jetstream
+            .update_stream(&archive_config(&config, chrono::Utc::now(), grace))
+            .await
+            .context("Failed to archive JetStream stream")?;
+        self.stream_cache.invalidate();
+        warn!(stream = %name, grace = ?grace, "Archived stream");
+        Ok(true)
+    }
+
+    /// Give an archived stream its subjects (and retention) back. Fails once
+    /// the grace period set by `archive_stream` is over.
+    ///
+    /// Returns false if it was not archived.
+    pub async fn unarchive_stream(&self, name: &str) -> Result<bool> {
+        let config = self.stream(name).await?.cached_info().config.clone();
+        if archived_at(&config).is_none() {
+            return Ok(false);
+        }
+        self.jetstream
+            .update_stream(&unarchive_config(&config, chrono::Utc::now())?)
+            .await
+            .context("Failed to unarchive JetStream stream")?;
+        self.stream_cache.invalidate();
+        info!(stream = %name, "Unarchived stream");
+        Ok(true)
+    }
+
+    /// Delete an archived stream and all its messages.
+    ///
+    /// Fails with `StreamNotFoundError` for unknown streams,
+    /// `StreamProtectedError` for streams with `deny_delete` and
+    /// `StreamNotArchivedError` for streams not archived first.
+    pub async fn delete_stream(&self, name: &str) -> Result<()> {
+        self.delete(name, false).await
+    }
+
+    /// Delete a stream whether or not it is archived.
+    pub async fn force_delete_stream(&self, name: &str) -> Result<()> {
+        self.delete(name, true).await
+    }
 
-        info!("Created JetStream stream '{}'", self.config.stream_name);
+    async fn delete(&self, name: &str, force: bool) -> Result<()> {
+        let config = self.stream(name).await?.cached_info().config.clone();
+        if config.deny_delete {
+            return Err(protected(name, "delete", &config).into());
+        }
+        if !force && archived_at(&config).is_none() {
+            return Err(StreamNotArchivedError {
+                stream: name.to_string(),
+            }
+            .into());
+        }
+        self.jetstream
+            .delete_stream(name)
+            .await
+            .context("Failed to delete JetStream stream")?;
+        self.stream_cache.invalidate();
+        info!(stream = %name, forced = force, "Deleted stream");
         Ok(())
     }
 
+    /// Remove every message from a stream, keeping its configuration.
+    /// Returns the number of messages removed.
+    ///
+    /// Fails with `StreamNotFoundError` for unknown streams and
+    /// `StreamProtectedError` for streams with `deny_purge` or sealed streams
+    /// (as do the other purge variants).
+    pub async fn purge_stream(&self, name: &str) -> Result<u64> {
+        self.purge(name, None, None).await
+    }
+
+    /// Remove only the messages stored on `subject` (wildcards allowed), e.g.
+    /// one Flux stream's `flux.events.sensors`.
+    pub async fn purge_stream_by_subject(&self, name: &str, subject: &str) -> Result<u64> {
+        self.purge(name, Some(subject), None).await
+    }
+
+    /// Remove every message with a sequence below `sequence`.
+    pub async fn purge_stream_before_sequence(&self, name: &str, sequence: u64) -> Result<u64> {
+        self.purge(name, None, Some(sequence)).await
+    }
+
+    async fn purge(&self, name: &str, subject: Option<&str>, before: Option<u64>) -> Result<u64> {
+        let stream = self.stream(name).await?;
+        let config = &stream.cached_info().config;
+        if config.deny_purge || config.sealed {
+            return Err(protected(name, "purge", config).into());
+        }
+
+        let request = match subject {
+            Some(subject) => stream.purge().filter(subject),
+            None => stream.purge(),
+        };
+        // `sequence` changes the request type, so await each arm separately
+        let response = match before {
+            Some(sequence) => request.sequence(sequence).await,
+            None => request.await,
+        }
+        .context("Failed to purge JetStream stream")?;
+        self.stream_cache.invalidate();
+        info!(
+            stream = %name,
+            subject = subject.unwrap_or(">"),
+            before_sequence = before,
+            purged = response.purged,
+            "Purged stream"
+        );
+        Ok(response.purged)
+    }
+
+    /// Seal a stream: no more publishes, deletes or purges. Irreversible.
+    ///
+    /// Returns false if it was already sealed.
+    pub async fn seal_stream(&self, name: &str) -> Result<bool> {
+        let mut config = self.stream(name).await?.cached_info().config.clone();
+        if config.sealed {
+            return Ok(false);
+        }
+        config.sealed = true;
+        self.jetstream
+            .update_stream(&config)
+            .await
+            .context("Failed to seal JetStream stream")?;
+        self.stream_cache.invalidate();
+        warn!(stream = %name, "Sealed stream");
+        Ok(true)
+    }
+
+    /// First and last stored sequence of a stream, e.g. to compute a replay
+    /// range. Both are 0 for a stream that never stored a message; after a
+    /// purge the first sequence is one past the last.
+    ///
+    /// Fails with `StreamNotFoundError` for unknown streams (as do the counts).
+    pub async fn stream_bounds(&self, name: &str) -> Result<(u64, u64)> {
+        let state = self.stream(name).await?.cached_info().state.clone();
+        Ok((state.first_sequence, state.last_sequence))
+    }
+
+    /// Number of messages currently stored in a stream.
+    pub async fn stream_message_count(&self, name: &str) -> Result<u64> {
+        Ok(self.stream(name).await?.cached_info().state.messages)
+    }
+
+    /// Bytes currently stored in a stream.
+    pub async fn stream_byte_count(&self, name: &str) -> Result<u64> {
+        Ok(self.stream(name).await?.cached_info().state.bytes)
+    }
+
+    /// Event stored at `sequence`, read without creating a consumer (direct
+    /// get when the stream allows it), e.g. to inspect a checkpoint.
+    ///
+    /// Fails with `StreamNotFoundError` for unknown streams and
+    /// `MessageNotFoundError` for sequences outside the stored range (as do
+    /// the first/last variants on an empty stream).
+    pub async fn get_event(&self, name: &str, sequence: u64) -> Result<FluxEvent> {
+        let stream = self.stream(name).await?;
+        read_event(stream, name, sequence).await
+    }
+
+    /// Oldest stored event, e.g. a replay starting point.
+    pub async fn get_first_event(&self, name: &str) -> Result<FluxEvent> {
+        let stream = self.stream(name).await?;
+        let sequence = stream.cached_info().state.first_sequence;
+        read_event(stream, name, sequence).await
+    }
+
+    /// Newest stored event, e.g. for last-known-value reads.
+    pub async fn get_last_event(&self, name: &str) -> Result<FluxEvent> {
+        let stream = self.stream(name).await?;
+        let sequence = stream.cached_info().state.last_sequence;
+        read_event(stream, name, sequence).await
+    }
+
+    /// Fetch a stream (with fresh info), mapping "no such stream" to
+    /// `StreamNotFoundError`.
+    async fn stream(&self, name: &str) -> Result<stream::Stream> {
+        match self.jetstream.get_stream(name).await {
+            Ok(stream) => Ok(stream),
+            Err(e) => match e.kind() {
+                GetStreamErrorKind::JetStream(error)
+                    if error.error_code() == ErrorCode::STREAM_NOT_FOUND =>
+                {
+                    Err(StreamNotFoundError {
+                        stream: name.to_string(),
+                    }
+                    .into())
+                }
+                _ => Err(anyhow::Error::new(e).context("Failed to get JetStream stream")),
+            },
+        }
+    }
+
     /// Get JetStream context for publishing
     pub fn jetstream(&self) -> &jetstream::Context {
         &self.jetstream
     }
 
+    /// JetStream context for a Flux stream: its `[[nats.targets]]` entry, or
+    /// the default context.
+    pub fn jetstream_for_stream(&self, stream: &str) -> &jetstream::Context {
+        route(&self.targets, stream).unwrap_or(&self.jetstream)
+    }
+
+    /// Configured targets as (stream prefix, context) pairs.
+    pub fn targets(&self) -> &[(String, jetstream::Context)] {
+        &self.targets
+    }
+
     /// Get underlying NATS client
     pub fn client(&self) -> &async_nats::Client {
         &self.client
     }
+
+    /// Notified each time the connection is re-established after a disconnect
+    /// (not on the initial connect).
+    pub fn subscribe_reconnects(&self) -> broadcast::Receiver<()> {
+        self.reconnect_tx.subscribe()
+    }
+
+    /// Connection state and disconnect/reconnect/close callbacks.
+    pub fn connection_monitor(&self) -> Arc<ConnectionMonitor> {
+        Arc::clone(&self.monitor)
+    }
+
+    /// What `connect` did with the configured stream. Connecting fails if it
+    /// could not be initialized, so its status is never `Failed` here.
+    pub fn stream_init_report(&self) -> &[StreamInitResult] {
+        &self.init_report
+    }
+
+    /// Stream listing cache invalidated by this client's stream changes; hand
+    /// it to the stream listing API.
+    pub fn stream_cache(&self) -> &StreamInfoCache {
+        &self.stream_cache
+    }
+
+    /// Flips to true once `max_reconnects` attempts have failed and the
+    /// client stopped reconnecting. Never flips with unlimited reconnects.
+    pub fn subscribe_reconnects_exhausted(&self) -> watch::Receiver<bool> {
+        self.exhausted_rx.clone()
+    }
+}
+
+/// Read and decode the message at `sequence`, if within the stream's stored range.
+async fn read_event(stream: stream::Stream, name: &str, sequence: u64) -> Result<FluxEvent> {
+    let state = &stream.cached_info().state;
+    if state.messages == 0 || sequence < state.first_sequence || sequence > state.last_sequence {
+        return Err(MessageNotFoundError {
+            stream: name.to_string(),
+            sequence,
+        }
+        .into());
+    }
+    let message = StreamReader::new(stream).get(sequence).await?;
+    decode_event(Some(&message.headers), &message.payload)
+}
+
+fn protected(name: &str, operation: &'static str, config: &stream::Config) -> StreamProtectedError {
+    let flag = if config.sealed {
+        "sealed"
+    } else if operation == "delete" {
+        "deny_delete"
+    } else {
+        "deny_purge"
+    };
+    StreamProtectedError {
+        stream: name.to_string(),
+        operation,
+        flag,
+    }
+}
+
+/// Stream name as it appears in FLUX_STREAM_<NAME>_* variables.
+fn env_stream_name(stream_name: &str) -> String {
+    stream_name
+        .chars()
+        .map(|c| {
+            if c.is_ascii_alphanumeric() {
+                c.to_ascii_uppercase()
+            } else {
+                '_'
+            }
+        })
+        .collect()
+}
+
+/// Parse a duration such as `500ms`, `90s`, `1h30m` or `7d`.
+fn parse_duration(value: &str) -> Option<std::time::Duration> {
+    let mut rest = value.trim();
+    if rest.is_empty() {
+        return None;
+    }
+    let mut total = std::time::Duration::ZERO;
+    while !rest.is_empty() {
+        let digits = rest.find(|c: char| !c.is_ascii_digit())?;
+        let amount: u64 = rest[..digits].parse().ok()?;
+        rest = &rest[digits..];
+        let unit_len = rest.find(|c: char| c.is_ascii_digit()).unwrap_or(rest.len());
+        let millis = match &rest[..unit_len] {
+            "ms" => 1,
+            "s" => 1_000,
+            "m" => 60_000,
+            "h" => 3_600_000,
+            "d" => 86_400_000,
+            _ => return None,
+        };
+        rest = &rest[unit_len..];
+        total += std::time::Duration::from_millis(amount.checked_mul(millis)?);
+    }
+    Some(total)
+}
+
+/// Parse a byte count with an optional `KB`/`MB`/`GB`/`TB` suffix.
+fn parse_bytes(value: &str) -> Option<i64> {
+    let value = value.trim().to_ascii_uppercase();
+    let (number, multiplier) = [
+        ("TB", 1i64 << 40),
+        ("GB", 1 << 30),
+        ("MB", 1 << 20),
+        ("KB", 1 << 10),
+        ("B", 1),
+    ]
+    .iter()
+    .find_map(|(suffix, multiplier)| {
+        value
+            .strip_suffix(suffix)
+            .map(|number| (number.trim(), *multiplier))
+    })
+    .unwrap_or((value.as_str(), 1));
+    number
+        .parse::<i64>()
+        .ok()
+        .filter(|n| *n > 0)?
+        .checked_mul(multiplier)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[tokio::test]
+    async fn test_init_locks_released_after_initialization() {
+        let locks = InitLocks::default();
+        let first = InitLock::acquire(&locks, "EVENTS").await;
+        let second = InitLock::acquire(&locks, "EVENTS");
+        tokio::pin!(second);
+        assert!(futures::poll!(&mut second).is_pending());
+
+        // The waiter keeps the entry; the last holder removes it
+        drop(first);
+        assert_eq!(locks.lock().unwrap().len(), 1);
+        drop(second.await);
+        assert!(locks.lock().unwrap().is_empty());
+
+        // A waiter that gives up doesn't leave its entry behind either
+        let held = InitLock::acquire(&locks, "EVENTS").await;
+        let abandoned = tokio::time::timeout(
+            std::time::Duration::from_millis(10),
+            InitLock::acquire(&locks, "EVENTS"),
+        );
+        assert!(abandoned.await.is_err());
+        assert_eq!(locks.lock().unwrap().len(), 1);
+        drop(held);
+        assert!(locks.lock().unwrap().is_empty());
+    }
+
+    #[test]
+    fn test_parse_duration() {
+        use std::time::Duration;
+        assert_eq!(parse_duration("72h"), Some(Duration::from_secs(72 * 3600)));
+        assert_eq!(parse_duration("1h30m"), Some(Duration::from_secs(5400)));
+        assert_eq!(parse_duration("14d"), Some(Duration::from_secs(14 * 86400)));
+        assert_eq!(parse_duration("500ms"), Some(Duration::from_millis(500)));
+        assert_eq!(parse_duration(""), None);
+        assert_eq!(parse_duration("72"), None);
+        assert_eq!(parse_duration("3w"), None);
+    }
+
+    #[test]
+    fn test_parse_bytes() {
+        assert_eq!(parse_bytes("10GB"), Some(10 * 1024 * 1024 * 1024));
+        assert_eq!(parse_bytes("512MB"), Some(512 * 1024 * 1024));
+        assert_eq!(parse_bytes("512 mb"), Some(512 * 1024 * 1024));
+        assert_eq!(parse_bytes("1048576"), Some(1048576));
+        assert_eq!(parse_bytes("0"), None);
+        assert_eq!(parse_bytes("lots"), None);
+    }
+
+    #[test]
+    fn test_duplicate_window_bounds() {
+        let config = NatsConfig::default();
+        assert_eq!(
+            config.stream_config().duplicate_window,
+            std::time::Duration::from_secs(120)
+        );
+        assert!(config.validate_duplicate_window().is_ok());
+
+        for window in [0, 86400 + 1] {
+            let config = NatsConfig {
+                max_age_days: 1,
+                duplicate_window_seconds: window,
+                ..Default::default()
+            };
+            let err = config.validate_duplicate_window().unwrap_err();
+            assert_eq!(err.window, std::time::Duration::from_secs(window));
+            assert_eq!(err.max_age, std::time::Duration::from_secs(86400));
+        }
+    }
+
+    #[test]
+    fn test_ordered_stream_config() {
+        let stream = NatsConfig::ordered("ORDERS").stream_config();
+        assert_eq!(stream.name, "ORDERS");
+        assert_eq!(stream.max_messages_per_subject, 1);
+        assert_eq!(stream.duplicate_window, std::time::Duration::from_secs(30));
+        assert_eq!(stream.discard, stream::DiscardPolicy::New);
+        assert!(!stream.discard_new_per_subject);
+    }
+
+    #[test]
+    fn test_retry_horizon_beyond_window() {
+        let mut config = NatsConfig {
+            duplicate_window_seconds: 60,
+            ..Default::default()
+        };
+        assert_eq!(config.retry_horizon_beyond_window(), None);
+        config.producer_retry_horizon_seconds = Some(60);
+        assert_eq!(config.retry_horizon_beyond_window(), None);
+        config.producer_retry_horizon_seconds = Some(3600);
+        assert_eq!(
+            config.retry_horizon_beyond_window(),
+            Some(std::time::Duration::from_secs(3600))
+        );
+    }
+
+    #[test]
+    fn test_env_overrides() {
+        std::env::set_var("FLUX_STREAM_ENV_TEST_STREAM_MAX_AGE", "36h");
+        std::env::set_var("FLUX_STREAM_ENV_TEST_STREAM_MAX_BYTES", "2GB");
+        let config = NatsConfig {
+            stream_name: "env-test.stream".to_string(),
+            ..Default::default()
+        }
+        .with_env_overrides();
+
+        let stream = config.stream_config();
+        assert_eq!(stream.max_age, std::time::Duration::from_secs(36 * 3600));
+        assert_eq!(stream.max_bytes, 2 * 1024 * 1024 * 1024);
+    }
+
+    #[test]
+    fn test_invalid_env_overrides_are_ignored() {
+        std::env::set_var("FLUX_STREAM_ENV_INVALID_MAX_AGE", "forever");
+        std::env::set_var("FLUX_STREAM_ENV_INVALID_MAX_BYTES", "-5GB");
+        let config = NatsConfig {
+            stream_name: "ENV_INVALID".to_string(),
+            ..Default::default()
+        }
+        .with_env_overrides();
+
+        let stream = config.stream_config();
+        assert_eq!(stream.max_age, std::time::Duration::from_secs(7 * 86400));
+        assert_eq!(stream.max_bytes, default_max_bytes());
+    }
+
+    #[test]
+    fn test_connection_name() {
+        let default = default_connection_name();
+        assert!(default.starts_with("flux-service-"));
+        assert!(default.ends_with(&format!("-{}", std::process::id())));
+
+        let config = NatsConfig::default().with_connection_name("flux-service-pod-01");
+        assert_eq!(config.connection_name(), "flux-service-pod-01");
+
+        let config = config.with_connection_tags(BTreeMap::from([
+            ("region".to_string(), "us-east".to_string()),
+            ("env".to_string(), "prod".to_string()),
+        ]));
+        assert_eq!(
+            config.connection_name(),
+            "flux-service-pod-01 [env=prod,region=us-east]"
+        );
+    }
+
+    #[test]
+    fn test_route_picks_longest_prefix() {
+        let routes = vec![
+            ("plant".to_string(), "edge"),
+            ("plant.a".to_string(), "edge-plant-a"),
+        ];
+        assert_eq!(route(&routes, "plant.a"), Some(&"edge-plant-a"));
+        assert_eq!(route(&routes, "plant.a.temp"), Some(&"edge-plant-a"));
+        assert_eq!(route(&routes, "plant.b.temp"), Some(&"edge"));
+        assert_eq!(route(&routes, "plantation"), None);
+        assert_eq!(route(&routes, "sensors"), None);
+    }
 }
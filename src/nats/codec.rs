@@ -0,0 +1,357 @@
+use super::proto;
+use super::publisher::PRIORITY_HEADER;
+use super::ttl_purge::TTL_HEADER;
+use crate::event::FluxEvent;
+use anyhow::{Context, Result};
+use async_nats::{HeaderMap, Message};
+use flate2::read::GzDecoder;
+use flate2::write::GzEncoder;
+use flate2::Compression;
+use serde::Deserialize;
+use std::fmt;
+use std::io::{Read, Write};
+
+/// NATS header set on compressed events
+pub const CONTENT_ENCODING_HEADER: &str = "Content-Encoding";
+
+/// The only content encoding Flux writes
+pub const GZIP_ENCODING: &str = "gzip";
+
+/// NATS header set on non-JSON events
+pub const CONTENT_TYPE_HEADER: &str = "Content-Type";
+
+/// Content type of protobuf-encoded events (`flux.v1.Event`)
+pub const PROTOBUF_CONTENT_TYPE: &str = "application/x-protobuf";
+
+/// Returned when an event cannot be converted to or from its wire form
+/// (JSON or protobuf, optionally gzipped).
+#[derive(Debug)]
+pub struct SerializationError {
+    pub source: anyhow::Error,
+}
+
+impl fmt::Display for SerializationError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "{:#}", self.source)
+    }
+}
+
+impl std::error::Error for SerializationError {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        Some(self.source.as_ref())
+    }
+}
+
+/// Envelope encoding used by the publisher.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum EventEncoding {
+    #[default]
+    Json,
+    /// `flux.v1.Event` (proto/flux_event.proto), payload carried as JSON bytes
+    Protobuf,
+}
+
+/// Wire form of an event, ready to publish.
+#[derive(Debug)]
+pub struct EncodedEvent {
+    pub payload: Vec<u8>,
+    /// Size of the uncompressed envelope
+    pub raw_len: usize,
+    /// True if `payload` is gzip and needs `Content-Encoding: gzip`
+    pub compressed: bool,
+    pub encoding: EventEncoding,
+}
+
+impl EncodedEvent {
+    /// NATS headers describing this encoding
+    pub fn headers(&self) -> HeaderMap {
+        let mut headers = HeaderMap::new();
+        if self.encoding == EventEncoding::Protobuf {
+            headers.insert(CONTENT_TYPE_HEADER, PROTOBUF_CONTENT_TYPE);
+        }
+        if self.compressed {
+            headers.insert(CONTENT_ENCODING_HEADER, GZIP_ENCODING);
+        }
+        headers
+    }
+
+    /// `headers` plus the `Flux-Priority` (and `x-flux-ttl-ms`, when set) of
+    /// `event`, as published.
+    pub fn headers_for(&self, event: &FluxEvent) -> HeaderMap {
+        let mut headers = self.headers();
+        headers.insert(PRIORITY_HEADER, event.priority().as_str());
+        if let Some(ttl_ms) = event.ttl_ms {
+            headers.insert(TTL_HEADER, ttl_ms.to_string().as_str());
+        }
+        headers
+    }
+}
+
+/// Serialize an event, gzipping the whole envelope when it is larger than
+/// `compress_above` bytes.
+///
+/// Compression is skipped when it would not make the message smaller.
+/// Failures are `SerializationError`.
+pub fn encode_event(
+    event: &FluxEvent,
+    encoding: EventEncoding,
+    compress_above: Option<usize>,
+) -> Result<EncodedEvent> {
+    encode(event, encoding, compress_above).map_err(|source| SerializationError { source }.into())
+}
+
+fn encode(
+    event: &FluxEvent,
+    encoding: EventEncoding,
+    compress_above: Option<usize>,
+) -> Result<EncodedEvent> {
+    let raw = match encoding {
+        EventEncoding::Json => {
+            serde_json::to_vec(event).context("Failed to serialize event to JSON")?
+        }
+        EventEncoding::Protobuf => proto::encode(event)?,
+    };
+    let raw_len = raw.len();
+
+    if let Some(threshold) = compress_above {
+        if raw_len > threshold {
+            let mut encoder = GzEncoder::new(Vec::new(), Compression::default());
+            encoder
+                .write_all(&raw)
+                .context("Failed to compress event")?;
+            let gzipped = encoder.finish().context("Failed to compress event")?;
+            if gzipped.len() < raw_len {
+                return Ok(EncodedEvent {
+                    payload: gzipped,
+                    raw_len,
+                    compressed: true,
+                    encoding,
+                });
+            }
+        }
+    }
+
+    Ok(EncodedEvent {
+        payload: raw,
+        raw_len,
+        compressed: false,
+        encoding,
+    })
+}
+
+/// Decode an event from a NATS message.
+///
+/// `Content-Encoding: gzip` is undone first, then `Content-Type` picks the
+/// decoder. Messages without headers are plain JSON, so streams holding a mix
+/// of encodings decode uniformly. Failures are `SerializationError`.
+pub fn decode_event(headers: Option<&HeaderMap>, payload: &[u8]) -> Result<FluxEvent> {
+    decode(headers, payload).map_err(|source| SerializationError { source }.into())
+}
+
+fn decode(headers: Option<&HeaderMap>, payload: &[u8]) -> Result<FluxEvent> {
+    let header = |name| {
+        headers
+            .and_then(|h| h.get(name))
+            .map(|v| v.as_str().to_string())
+    };
+
+    let decompressed;
+    let body = match header(CONTENT_ENCODING_HEADER).as_deref() {
+        None => payload,
+        Some(GZIP_ENCODING) => {
+            let mut raw = Vec::new();
+            GzDecoder::new(payload)
+                .read_to_end(&mut raw)
+                .context("Failed to decompress event")?;
+            decompressed = raw;
+            &decompressed
+        }
+        Some(other) => anyhow::bail!("unsupported content encoding '{}'", other),
+    };
+
+    match header(CONTENT_TYPE_HEADER).as_deref() {
+        None | Some("application/json") => {
+            FluxEvent::from_json_slice(body).context("Failed to parse event JSON")
+        }
+        Some(PROTOBUF_CONTENT_TYPE) => proto::decode(body),
+        Some(other) => anyhow::bail!("unsupported content type '{}'", other),
+    }
+}
+
+/// Decode and validate the event carried by a NATS message (core or
+/// JetStream, which derefs to one).
+///
+/// Like `decode_event`, but rejects events that would not pass the publish
+/// path's validation, e.g. raw messages written by other producers. Header
+/// values such as `Nats-Msg-Id` stay on the message; `ReceivedEvent` keeps
+/// them alongside the event for JetStream consumers.
+pub fn event_from_message(message: &Message) -> Result<FluxEvent> {
+    let mut event = decode_event(message.headers.as_ref(), &message.payload)?;
+    event.validate_and_prepare()?;
+    Ok(event)
+}
+
+/// Inverse of `event_from_message`: encode `event` into a message for
+/// `subject` with the headers the publisher sets (encoding and priority).
+pub fn event_to_message(
+    event: &FluxEvent,
+    subject: &str,
+    encoding: EventEncoding,
+    compress_above: Option<usize>,
+) -> Result<Message> {
+    let encoded = encode_event(event, encoding, compress_above)?;
+    let headers = encoded.headers_for(event);
+    Ok(Message {
+        subject: subject.into(),
+        reply: None,
+        length: encoded.payload.len(),
+        payload: encoded.payload.into(),
+        headers: Some(headers),
+        status: None,
+        description: None,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::event::{Priority, ValidationError};
+    use serde_json::json;
+
+    fn event(payload: serde_json::Value) -> FluxEvent {
+        FluxEvent {
+            event_id: Some("0190d8a0-0000-7000-8000-000000000000".to_string()),
+            stream: "scada".to_string(),
+            source: "plc-01".to_string(),
+            timestamp: 1707668400000,
+            key: None,
+            schema: None,
+            priority: None,
+            envelope_version: None,
+            received_at: None,
+            ttl_ms: None,
+            correlation_id: None,
+            parent_event_id: None,
+            payload,
+            raw_payload: None,
+        }
+    }
+
+    fn gzip_headers() -> HeaderMap {
+        let mut headers = HeaderMap::new();
+        headers.insert(CONTENT_ENCODING_HEADER, GZIP_ENCODING);
+        headers
+    }
+
+    #[test]
+    fn test_small_events_stay_uncompressed() {
+        let encoded =
+            encode_event(&event(json!({"v": 1})), EventEncoding::Json, Some(1024)).unwrap();
+        assert!(!encoded.compressed);
+        assert_eq!(encoded.payload.len(), encoded.raw_len);
+
+        let decoded = decode_event(None, &encoded.payload).unwrap();
+        assert_eq!(decoded.payload, json!({"v": 1}));
+    }
+
+    #[test]
+    fn test_large_events_round_trip_compressed() {
+        let tags: Vec<_> = (0..200)
+            .map(|i| json!({"tag": format!("line1.pump{}.pressure", i), "quality": "good"}))
+            .collect();
+        let original = event(json!({ "tags": tags }));
+
+        let encoded = encode_event(&original, EventEncoding::Json, Some(1024)).unwrap();
+        assert!(encoded.compressed);
+        assert!(encoded.payload.len() < encoded.raw_len / 4);
+
+        let decoded = decode_event(Some(&gzip_headers()), &encoded.payload).unwrap();
+        assert_eq!(decoded.payload, original.payload);
+        assert_eq!(decoded.event_id, original.event_id);
+    }
+
+    #[test]
+    fn test_no_threshold_never_compresses() {
+        let tags: Vec<_> = (0..200).map(|i| json!({ "i": i })).collect();
+        let encoded =
+            encode_event(&event(json!({ "tags": tags })), EventEncoding::Json, None).unwrap();
+        assert!(!encoded.compressed);
+    }
+
+    #[test]
+    fn test_unknown_encoding_rejected() {
+        let mut headers = HeaderMap::new();
+        headers.insert(CONTENT_ENCODING_HEADER, "br");
+        assert!(decode_event(Some(&headers), b"{}").is_err());
+    }
+
+    #[test]
+    fn test_decode_failures_are_serialization_errors() {
+        let err = decode_event(None, b"{\"stream\":").unwrap_err();
+        let serialization = err.downcast_ref::<SerializationError>().unwrap();
+        assert!(serialization.to_string().starts_with("Failed to parse event JSON: "));
+        assert!(std::error::Error::source(serialization).is_some());
+    }
+
+    #[test]
+    fn test_protobuf_round_trip() {
+        let original = event(json!({"entity_id": "plc-01", "properties": {"t": 1}}));
+        let encoded = encode_event(&original, EventEncoding::Protobuf, None).unwrap();
+        let headers = encoded.headers();
+        assert_eq!(
+            headers.get(CONTENT_TYPE_HEADER).unwrap().as_str(),
+            PROTOBUF_CONTENT_TYPE
+        );
+
+        let decoded = decode_event(Some(&headers), &encoded.payload).unwrap();
+        assert_eq!(decoded.payload, original.payload);
+        assert_eq!(decoded.event_id, original.event_id);
+    }
+
+    #[test]
+    fn test_compressed_protobuf_round_trip() {
+        let tags: Vec<_> = (0..200)
+            .map(|i| json!({"tag": format!("line1.pump{}.pressure", i)}))
+            .collect();
+        let original = event(json!({ "tags": tags }));
+
+        let encoded = encode_event(&original, EventEncoding::Protobuf, Some(1024)).unwrap();
+        assert!(encoded.compressed);
+        let decoded = decode_event(Some(&encoded.headers()), &encoded.payload).unwrap();
+        assert_eq!(decoded.payload, original.payload);
+    }
+
+    #[test]
+    fn test_message_round_trip() {
+        let mut original = event(json!({"entity_id": "plc-01"}));
+        original.key = Some("line-2".to_string());
+        original.priority = Some(Priority::High);
+
+        let message = event_to_message(
+            &original,
+            "flux.events.scada",
+            EventEncoding::Protobuf,
+            None,
+        )
+        .unwrap();
+        assert_eq!(message.subject.as_str(), "flux.events.scada");
+        let headers = message.headers.as_ref().unwrap();
+        assert_eq!(headers.get(PRIORITY_HEADER).unwrap().as_str(), "high");
+
+        let decoded = event_from_message(&message).unwrap();
+        assert_eq!(decoded.event_id, original.event_id);
+        assert_eq!(decoded.key, original.key);
+        assert_eq!(decoded.payload, original.payload);
+    }
+
+    #[test]
+    fn test_message_with_invalid_event_rejected() {
+        let mut invalid = event(json!({"entity_id": "plc-01"}));
+        invalid.stream = "Bad Stream".to_string();
+        let message = event_to_message(&invalid, "raw", EventEncoding::Json, None).unwrap();
+
+        let err = event_from_message(&message).unwrap_err();
+        assert!(err.downcast_ref::<ValidationError>().is_some(), "{}", err);
+    }
+}
@@ -0,0 +1,177 @@
+use async_nats::{ClientError, Event};
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Arc, Mutex};
+use tracing::{error, info, warn};
+
+type Callback = Arc<dyn Fn() + Send + Sync>;
+type UrlCallback = Arc<dyn Fn(&str) + Send + Sync>;
+
+/// Connection state of a `NatsClient`, with callbacks for application code
+/// that reacts to it (pause processing, flip readiness, alert).
+///
+/// Fed by the client's event callback; get it with
+/// `NatsClient::connection_monitor`. Callbacks run on the client's event
+/// task, so they should return quickly.
+pub struct ConnectionMonitor {
+    url: String,
+    connected: AtomicBool,
+    disconnected: AtomicBool,
+    closed: AtomicBool,
+    on_disconnect: Mutex<Vec<Callback>>,
+    on_reconnect: Mutex<Vec<UrlCallback>>,
+    on_close: Mutex<Vec<Callback>>,
+}
+
+impl ConnectionMonitor {
+    /// Monitor for a connection to `url` (passed to reconnect callbacks).
+    pub fn new(url: impl Into<String>) -> Self {
+        Self {
+            url: url.into(),
+            connected: AtomicBool::new(false),
+            disconnected: AtomicBool::new(false),
+            closed: AtomicBool::new(false),
+            on_disconnect: Mutex::new(Vec::new()),
+            on_reconnect: Mutex::new(Vec::new()),
+            on_close: Mutex::new(Vec::new()),
+        }
+    }
+
+    /// Mark the initial connection as established.
+    pub(crate) fn set_connected(&self) {
+        self.connected.store(true, Ordering::SeqCst);
+    }
+
+    /// Called when an established connection is lost.
+    pub fn on_disconnect<F>(&self, callback: F)
+    where
+        F: Fn() + Send + Sync + 'static,
+    {
+        self.on_disconnect.lock().unwrap().push(Arc::new(callback));
+    }
+
+    /// Called with the server URL when the connection is re-established
+    /// after a disconnect (not on the initial connect).
+    pub fn on_reconnect<F>(&self, callback: F)
+    where
+        F: Fn(&str) + Send + Sync + 'static,
+    {
+        self.on_reconnect.lock().unwrap().push(Arc::new(callback));
+    }
+
+    /// Called once when the client stops for good: closed, or out of
+    /// reconnect attempts (`max_reconnects`).
+    pub fn on_close<F>(&self, callback: F)
+    where
+        F: Fn() + Send + Sync + 'static,
+    {
+        self.on_close.lock().unwrap().push(Arc::new(callback));
+    }
+
+    /// True while the client is connected to a server. Follows the same
+    /// events as the callbacks, so it is already false when `on_disconnect`
+    /// runs and true again when `on_reconnect` does.
+    pub fn is_connected(&self) -> bool {
+        self.connected.load(Ordering::SeqCst)
+            && !self.disconnected.load(Ordering::SeqCst)
+            && !self.closed.load(Ordering::SeqCst)
+    }
+
+    /// Log `event` and run the callbacks it triggers.
+    pub(crate) fn handle(&self, event: &Event) {
+        match event {
+            Event::Disconnected if !self.disconnected.swap(true, Ordering::SeqCst) => {
+                warn!("NATS connection lost");
+                run(&self.on_disconnect, |callback| callback());
+            }
+            // Also fired on the initial connect; only a reconnect after a disconnect
+            Event::Connected if self.disconnected.swap(false, Ordering::SeqCst) => {
+                info!("NATS connection re-established");
+                run(&self.on_reconnect, |callback| callback(&self.url));
+            }
+            Event::Closed => self.close(),
+            Event::ClientError(ClientError::MaxReconnects) => {
+                error!("NATS reconnect attempts exhausted, giving up");
+                self.close();
+            }
+            _ => {}
+        }
+    }
+
+    fn close(&self) {
+        if !self.closed.swap(true, Ordering::SeqCst) {
+            run(&self.on_close, |callback| callback());
+        }
+    }
+}
+
+/// Call each registered callback, outside the lock so callbacks may register
+/// more.
+fn run<C: ?Sized>(callbacks: &Mutex<Vec<Arc<C>>>, call: impl Fn(&C)) {
+    let callbacks = callbacks.lock().unwrap().clone();
+    for callback in &callbacks {
+        call(callback);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::atomic::AtomicUsize;
+
+    fn counter() -> Arc<AtomicUsize> {
+        Arc::new(AtomicUsize::new(0))
+    }
+
+    #[test]
+    fn test_reconnect_only_after_disconnect() {
+        let monitor = ConnectionMonitor::new("nats://localhost:4222");
+        let (disconnects, reconnects) = (counter(), counter());
+        let urls = Arc::new(Mutex::new(Vec::new()));
+        {
+            let disconnects = Arc::clone(&disconnects);
+            monitor.on_disconnect(move || {
+                disconnects.fetch_add(1, Ordering::SeqCst);
+            });
+            let (reconnects, urls) = (Arc::clone(&reconnects), Arc::clone(&urls));
+            monitor.on_reconnect(move |url| {
+                reconnects.fetch_add(1, Ordering::SeqCst);
+                urls.lock().unwrap().push(url.to_string());
+            });
+        }
+
+        // Initial connect
+        monitor.handle(&Event::Connected);
+        monitor.set_connected();
+        assert_eq!(reconnects.load(Ordering::SeqCst), 0);
+        assert!(monitor.is_connected());
+
+        monitor.handle(&Event::Disconnected);
+        assert!(!monitor.is_connected());
+        // Repeated while the client retries
+        monitor.handle(&Event::Disconnected);
+        assert_eq!(disconnects.load(Ordering::SeqCst), 1);
+
+        monitor.handle(&Event::Connected);
+        assert_eq!(reconnects.load(Ordering::SeqCst), 1);
+        assert!(monitor.is_connected());
+        assert_eq!(*urls.lock().unwrap(), vec!["nats://localhost:4222"]);
+    }
+
+    #[test]
+    fn test_close_fires_once() {
+        let monitor = ConnectionMonitor::new("nats://localhost:4222");
+        monitor.set_connected();
+        let closes = counter();
+        {
+            let closes = Arc::clone(&closes);
+            monitor.on_close(move || {
+                closes.fetch_add(1, Ordering::SeqCst);
+            });
+        }
+
+        monitor.handle(&Event::ClientError(ClientError::MaxReconnects));
+        monitor.handle(&Event::Closed);
+        assert_eq!(closes.load(Ordering::SeqCst), 1);
+        assert!(!monitor.is_connected());
+    }
+}
@@ -0,0 +1,150 @@
+use super::subject::stream_filter_subjects;
+use anyhow::{Context, Result};
+use async_nats::jetstream::{
+    self,
+    consumer::{pull, AckPolicy, PullConsumer},
+};
+use std::time::Duration;
+
+/// Unacknowledged messages each member may hold when none is configured
+pub const DEFAULT_MAX_ACK_PENDING_PER_MEMBER: i64 = 100;
+
+/// Durable name shared by every replica of `service` consuming the Flux
+/// stream `stream`, e.g. `billing` + `sensors` -> `billing-sensors`.
+///
+/// Characters a durable name cannot hold are replaced with `_`, so replicas
+/// configured from the same names always land on the same durable.
+pub fn group_durable_name(service: &str, stream: &str) -> String {
+    format!("{}-{}", service, stream)
+        .chars()
+        .map(|c| {
+            if c.is_ascii_alphanumeric() || c == '-' || c == '_' {
+                c
+            } else {
+                '_'
+            }
+        })
+        .collect()
+}
+
+/// Replicas of one service sharing a durable pull consumer, so each event of
+/// a Flux stream is handled by exactly one of them.
+///
+/// Every replica calls `join` with the same names. Members pull from the
+/// shared durable independently; JetStream hands each message to one pending
+/// pull request, so load spreads across whoever is asking. There is no
+/// explicit rebalancing: a replica that stops pulling simply stops receiving,
+/// and messages it held unacknowledged are redelivered to the others after
+/// `ack_wait`. The consumer's `num_waiting` (reported as `members` by the
+/// consumer and health APIs) approximates the number of live members.
+#[derive(Debug, Clone)]
+pub struct ConsumerGroup {
+    service: String,
+    stream: String,
+    members: i64,
+    max_ack_pending_per_member: i64,
+    inactive_threshold: Option<Duration>,
+}
+
+impl ConsumerGroup {
+    pub fn new(service: impl Into<String>, stream: impl Into<String>) -> Self {
+        Self {
+            service: service.into(),
+            stream: stream.into(),
+            members: 1,
+            max_ack_pending_per_member: DEFAULT_MAX_ACK_PENDING_PER_MEMBER,
+            inactive_threshold: None,
+        }
+    }
+
+    /// Expected number of replicas; with the per-member limit this sizes the
+    /// durable's `max_ack_pending`.
+    pub fn with_members(mut self, members: i64) -> Self {
+        self.members = members.max(1);
+        self
+    }
+
+    /// Unacknowledged messages each member may hold (default 100).
+    pub fn with_max_ack_pending_per_member(mut self, max: i64) -> Self {
+        self.max_ack_pending_per_member = max.max(1);
+        self
+    }
+
+    /// Let the server delete the durable once no member has pulled for
+    /// `after`, so a retired service does not leave it behind. A member
+    /// joining later recreates it, starting again from the beginning of the
+    /// stream. Needs NATS 2.10+; older servers ignore it for durables.
+    pub fn with_auto_cleanup(mut self, after: Duration) -> Self {
+        self.inactive_threshold = Some(after);
+        self
+    }
+
+    pub fn durable_name(&self) -> String {
+        group_durable_name(&self.service, &self.stream)
+    }
+
+    /// Durable config every member must agree on.
+    pub fn consumer_config(&self) -> pull::Config {
+        pull::Config {
+            durable_name: Some(self.durable_name()),
+            filter_subjects: stream_filter_subjects(&self.stream),
+            ack_policy: AckPolicy::Explicit,
+            max_ack_pending: self.members * self.max_ack_pending_per_member,
+            inactive_threshold: self.inactive_threshold.unwrap_or_default(),
+            ..Default::default()
+        }
+    }
+
+    /// Bind to the shared durable on the JetStream stream `stream_name`,
+    /// creating it on first use.
+    pub async fn join(
+        &self,
+        jetstream: &jetstream::Context,
+        stream_name: &str,
+    ) -> Result<PullConsumer> {
+        jetstream
+            .get_stream(stream_name)
+            .await
+            .context("Failed to get JetStream stream")?
+            .get_or_create_consumer(&self.durable_name(), self.consumer_config())
+            .await
+            .context("Failed to join consumer group")
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_group_durable_name() {
+        assert_eq!(group_durable_name("billing", "sensors"), "billing-sensors");
+        assert_eq!(
+            group_durable_name("billing.v2", "sensors/zone 1"),
+            "billing_v2-sensors_zone_1"
+        );
+    }
+
+    #[test]
+    fn test_max_ack_pending_scales_with_members() {
+        let group = ConsumerGroup::new("billing", "sensors")
+            .with_members(3)
+            .with_max_ack_pending_per_member(50);
+        let config = group.consumer_config();
+        assert_eq!(config.durable_name.as_deref(), Some("billing-sensors"));
+        assert_eq!(
+            config.filter_subjects,
+            vec!["flux.events.sensors", "flux.events.sensors.>"]
+        );
+        assert_eq!(config.max_ack_pending, 150);
+        assert_eq!(config.inactive_threshold, Duration::ZERO);
+    }
+
+    #[test]
+    fn test_auto_cleanup_sets_inactive_threshold() {
+        let config = ConsumerGroup::new("billing", "sensors")
+            .with_auto_cleanup(Duration::from_secs(3600))
+            .consumer_config();
+        assert_eq!(config.inactive_threshold, Duration::from_secs(3600));
+    }
+}
@@ -0,0 +1,215 @@
+use super::exactly_once::Handled;
+use crate::clock::{self, SharedClock};
+use crate::event::FluxEvent;
+use anyhow::Result;
+use std::collections::HashMap;
+use std::future::Future;
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+
+/// Where `DeduplicatingHandler` remembers processed eventIds.
+pub trait DedupStore: Send + Sync {
+    /// True if `event_id` was marked and its window has not yet passed.
+    fn is_duplicate(&self, event_id: &str) -> Result<bool>;
+
+    /// Remember `event_id` as processed for `window`.
+    fn mark(&self, event_id: &str, window: Duration) -> Result<()>;
+}
+
+/// In-process `DedupStore`. Expired ids are dropped on the next `mark`.
+///
+/// Ids are lost on restart and not shared between replicas; use
+/// `ExactlyOnce` for JetStream consumers that need either.
+#[derive(Debug)]
+pub struct MemoryDedupStore {
+    /// eventId -> expiry (Unix milliseconds)
+    seen: Mutex<HashMap<String, i64>>,
+    clock: SharedClock,
+}
+
+impl MemoryDedupStore {
+    pub fn new() -> Self {
+        Self::with_clock(clock::system())
+    }
+
+    /// Expire ids by `clock` instead of the system clock.
+    pub fn with_clock(clock: SharedClock) -> Self {
+        Self {
+            seen: Mutex::new(HashMap::new()),
+            clock,
+        }
+    }
+
+    /// Ids currently remembered, expired or not.
+    pub fn len(&self) -> usize {
+        self.seen.lock().unwrap().len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+}
+
+impl Default for MemoryDedupStore {
+    fn default() -> Self {
+        Self::new()
+    }
+}
+
+impl DedupStore for MemoryDedupStore {
+    fn is_duplicate(&self, event_id: &str) -> Result<bool> {
+        let now = self.clock.now_millis();
+        let seen = self.seen.lock().unwrap();
+        Ok(seen.get(event_id).map_or(false, |expires| *expires > now))
+    }
+
+    fn mark(&self, event_id: &str, window: Duration) -> Result<()> {
+        let now = self.clock.now_millis();
+        let mut seen = self.seen.lock().unwrap();
+        seen.retain(|_, expires| *expires > now);
+        seen.insert(event_id.to_string(), now + window.as_millis() as i64);
+        Ok(())
+    }
+}
+
+/// Wraps a handler that is not idempotent so each eventId runs it at most
+/// once per `window`, whatever the transport redelivers.
+///
+/// An id is marked only after `inner` succeeds, so a failed event is retried
+/// on redelivery. `Handled::Duplicate` means `inner` was skipped and the
+/// caller should ack the message. Events without an eventId cannot be
+/// deduplicated and always run `inner`.
+pub struct DeduplicatingHandler<F> {
+    inner: F,
+    store: Arc<dyn DedupStore>,
+    window: Duration,
+}
+
+impl<F, Fut> DeduplicatingHandler<F>
+where
+    F: Fn(FluxEvent) -> Fut,
+    Fut: Future<Output = Result<()>>,
+{
+    pub fn new(inner: F, store: Arc<dyn DedupStore>, window: Duration) -> Self {
+        Self {
+            inner,
+            store,
+            window,
+        }
+    }
+
+    /// Run the wrapped handler for `event` unless its id was already processed.
+    pub async fn handle(&self, event: FluxEvent) -> Result<Handled> {
+        let Some(event_id) = event.event_id.clone() else {
+            (self.inner)(event).await?;
+            return Ok(Handled::Processed);
+        };
+        if self.store.is_duplicate(&event_id)? {
+            return Ok(Handled::Duplicate);
+        }
+        (self.inner)(event).await?;
+        self.store.mark(&event_id, self.window)?;
+        Ok(Handled::Processed)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::clock::FakeClock;
+    use anyhow::anyhow;
+    use serde_json::json;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+
+    const WINDOW: Duration = Duration::from_secs(60);
+
+    fn event(id: &str) -> FluxEvent {
+        let mut event = FluxEvent::builder("orders")
+            .source("checkout")
+            .payload(json!({}))
+            .must_build();
+        event.event_id = Some(id.to_string());
+        event
+    }
+
+    /// Handler counting its calls, failing while `fail` is set.
+    fn counting(
+        calls: &Arc<AtomicUsize>,
+        fail: bool,
+    ) -> impl Fn(FluxEvent) -> std::future::Ready<Result<()>> {
+        let calls = Arc::clone(calls);
+        move |_| {
+            calls.fetch_add(1, Ordering::SeqCst);
+            std::future::ready(if fail {
+                Err(anyhow!("sink down"))
+            } else {
+                Ok(())
+            })
+        }
+    }
+
+    #[tokio::test]
+    async fn test_new_events_processed_and_duplicates_skipped() {
+        let calls = Arc::new(AtomicUsize::new(0));
+        let store = Arc::new(MemoryDedupStore::new());
+        let handler = DeduplicatingHandler::new(counting(&calls, false), store, WINDOW);
+
+        assert_eq!(
+            handler.handle(event("a")).await.unwrap(),
+            Handled::Processed
+        );
+        assert_eq!(
+            handler.handle(event("b")).await.unwrap(),
+            Handled::Processed
+        );
+        assert_eq!(
+            handler.handle(event("a")).await.unwrap(),
+            Handled::Duplicate
+        );
+        assert_eq!(calls.load(Ordering::SeqCst), 2);
+    }
+
+    #[tokio::test]
+    async fn test_marks_only_on_success() {
+        let calls = Arc::new(AtomicUsize::new(0));
+        let store = Arc::new(MemoryDedupStore::new());
+
+        let failing = DeduplicatingHandler::new(counting(&calls, true), store.clone(), WINDOW);
+        assert!(failing.handle(event("a")).await.is_err());
+        assert!(!store.is_duplicate("a").unwrap());
+
+        // The retry runs the handler again and marks it
+        let handler = DeduplicatingHandler::new(counting(&calls, false), store.clone(), WINDOW);
+        assert_eq!(
+            handler.handle(event("a")).await.unwrap(),
+            Handled::Processed
+        );
+        assert!(store.is_duplicate("a").unwrap());
+        assert_eq!(calls.load(Ordering::SeqCst), 2);
+    }
+
+    #[tokio::test]
+    async fn test_ids_expire_after_window() {
+        let clock = FakeClock::at_millis(1_707_668_400_000);
+        let store = Arc::new(MemoryDedupStore::with_clock(clock.clone()));
+        let calls = Arc::new(AtomicUsize::new(0));
+        let handler = DeduplicatingHandler::new(counting(&calls, false), store.clone(), WINDOW);
+
+        handler.handle(event("a")).await.unwrap();
+        clock.advance(chrono::Duration::seconds(59));
+        assert_eq!(
+            handler.handle(event("a")).await.unwrap(),
+            Handled::Duplicate
+        );
+        clock.advance(chrono::Duration::seconds(1));
+        assert_eq!(
+            handler.handle(event("a")).await.unwrap(),
+            Handled::Processed
+        );
+
+        // Marking prunes expired ids
+        clock.advance(chrono::Duration::seconds(120));
+        handler.handle(event("b")).await.unwrap();
+        assert_eq!(store.len(), 1);
+    }
+}
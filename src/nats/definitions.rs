@@ -0,0 +1,327 @@
+use super::firehose::INTERNAL_STREAM_PREFIXES;
+use super::stream_diff::{diff_stream_config, safe_update_config, FieldChange};
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, consumer, stream};
+use chrono::{SecondsFormat, Utc};
+use futures::TryStreamExt;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+use tracing::{info, warn};
+
+/// Schema version written by `export_definitions`. Documents from a newer
+/// version are refused; unknown fields in older ones are ignored.
+pub const DEFINITIONS_VERSION: u32 = 1;
+
+/// Metadata keys the server maintains itself (e.g. `_nats.ver`), left out of
+/// exports
+const SERVER_METADATA_PREFIX: &str = "_nats.";
+
+/// A snapshot of stream definitions, for recreating them on another cluster.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct StreamDefinitions {
+    pub version: u32,
+    /// When the snapshot was taken (RFC 3339)
+    pub exported_at: String,
+    pub streams: Vec<StreamDefinition>,
+}
+
+/// One stream's config (metadata, retention, mirror and sources included),
+/// and its durable consumers when exported with them.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct StreamDefinition {
+    pub config: stream::Config,
+    #[serde(default, skip_serializing_if = "Vec::is_empty")]
+    pub consumers: Vec<consumer::Config>,
+}
+
+/// Returned for a definitions document from a newer schema version.
+#[derive(Debug, Clone, PartialEq)]
+pub struct UnsupportedDefinitionsError {
+    pub version: u32,
+}
+
+impl fmt::Display for UnsupportedDefinitionsError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "definitions version {} is not supported (newest is {})",
+            self.version, DEFINITIONS_VERSION
+        )
+    }
+}
+
+impl std::error::Error for UnsupportedDefinitionsError {}
+
+/// How `import_definitions` treats streams that already exist.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "snake_case")]
+pub enum ImportMode {
+    /// Create missing streams and consumers; leave existing ones alone
+    CreateOnly,
+    /// Also apply the safe part of any drift, like `Reconciler::apply`
+    Reconcile,
+    /// Report what `Reconcile` would do without changing anything
+    #[default]
+    DryRun,
+}
+
+/// What importing one stream did (or would do, for a dry run).
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum DefinitionStatus {
+    Created,
+    /// Existed with drift; the safe changes were applied
+    Updated,
+    /// Existed as defined
+    Unchanged,
+    /// Existed with drift that was left alone (create-only, or only unsafe
+    /// fields differ)
+    Drifted,
+    WouldCreate,
+    WouldUpdate,
+    Failed,
+}
+
+/// Outcome of importing one stream.
+#[derive(Debug, Clone, Serialize)]
+pub struct DefinitionResult {
+    pub stream: String,
+    pub status: DefinitionStatus,
+    /// Fields that differ from the definition (before any update)
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub changes: Vec<FieldChange>,
+    /// Durable consumers created (or that would be)
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub consumers_created: Vec<String>,
+    #[serde(skip_serializing_if = "Option::is_none")]
+    pub error: Option<String>,
+}
+
+/// Per-stream results of `import_definitions`.
+#[derive(Debug, Clone, Serialize)]
+pub struct ImportReport {
+    pub mode: ImportMode,
+    pub results: Vec<DefinitionResult>,
+}
+
+impl ImportReport {
+    /// True if no stream failed.
+    pub fn succeeded(&self) -> bool {
+        self.results
+            .iter()
+            .all(|result| result.status != DefinitionStatus::Failed)
+    }
+}
+
+/// Snapshot every stream except those behind KV buckets and object stores,
+/// sorted by name, with their durable consumers if `include_consumers`.
+pub async fn export_definitions(
+    jetstream: &jetstream::Context,
+    include_consumers: bool,
+) -> Result<StreamDefinitions> {
+    let mut names: Vec<String> = jetstream
+        .stream_names()
+        .try_collect()
+        .await
+        .context("Failed to list stream names")?;
+    names.retain(|name| {
+        !INTERNAL_STREAM_PREFIXES
+            .iter()
+            .any(|prefix| name.starts_with(prefix))
+    });
+    names.sort();
+
+    let mut streams = Vec::new();
+    for name in names {
+        let mut stream = jetstream
+            .get_stream(&name)
+            .await
+            .with_context(|| format!("Failed to get stream '{}'", name))?;
+        let mut config = stream.info().await?.config.clone();
+        config
+            .metadata
+            .retain(|key, _| !key.starts_with(SERVER_METADATA_PREFIX));
+
+        let mut consumers = Vec::new();
+        if include_consumers {
+            let infos: Vec<consumer::Info> = stream
+                .consumers()
+                .try_collect()
+                .await
+                .with_context(|| format!("Failed to list consumers of '{}'", name))?;
+            consumers = infos
+                .into_iter()
+                .map(|info| info.config)
+                .filter(|config| config.durable_name.is_some())
+                .collect();
+            for consumer in &mut consumers {
+                consumer
+                    .metadata
+                    .retain(|key, _| !key.starts_with(SERVER_METADATA_PREFIX));
+            }
+            consumers.sort_by(|a, b| a.durable_name.cmp(&b.durable_name));
+        }
+        streams.push(StreamDefinition { config, consumers });
+    }
+
+    Ok(StreamDefinitions {
+        version: DEFINITIONS_VERSION,
+        exported_at: Utc::now().to_rfc3339_opts(SecondsFormat::Millis, true),
+        streams,
+    })
+}
+
+/// Recreate the streams in `definitions` on this cluster according to
+/// `mode`. Streams without a mirror or sources go first, so those they
+/// read from exist. A stream that fails is recorded and the others are
+/// still imported; only an unsupported document fails the whole import
+/// (`UnsupportedDefinitionsError`).
+pub async fn import_definitions(
+    jetstream: &jetstream::Context,
+    definitions: &StreamDefinitions,
+    mode: ImportMode,
+) -> Result<ImportReport> {
+    if definitions.version > DEFINITIONS_VERSION {
+        return Err(UnsupportedDefinitionsError {
+            version: definitions.version,
+        }
+        .into());
+    }
+
+    let mut ordered: Vec<&StreamDefinition> = definitions.streams.iter().collect();
+    ordered.sort_by_key(|definition| {
+        definition.config.mirror.is_some() || definition.config.sources.is_some()
+    });
+
+    let mut results = Vec::new();
+    for definition in ordered {
+        let name = definition.config.name.clone();
+        let mut result = DefinitionResult {
+            stream: name.clone(),
+            status: DefinitionStatus::Failed,
+            changes: Vec::new(),
+            consumers_created: Vec::new(),
+            error: None,
+        };
+        if let Err(e) = import_definition(jetstream, definition, mode, &mut result).await {
+            warn!(stream = %name, error = %e, "Failed to import stream definition");
+            result.status = DefinitionStatus::Failed;
+            result.error = Some(format!("{:#}", e));
+        }
+        results.push(result);
+    }
+
+    if mode != ImportMode::DryRun {
+        info!(mode = ?mode, streams = results.len(), "Imported stream definitions");
+    }
+    Ok(ImportReport { mode, results })
+}
+
+async fn import_definition(
+    jetstream: &jetstream::Context,
+    definition: &StreamDefinition,
+    mode: ImportMode,
+    result: &mut DefinitionResult,
+) -> Result<()> {
+    let desired = &definition.config;
+    let stream = match jetstream.get_stream(&desired.name).await {
+        Ok(mut stream) => {
+            let current = stream.info().await?.config.clone();
+            let diff = diff_stream_config(&current, desired);
+            let safe = diff.changes.iter().any(|change| change.safe);
+            result.status = match mode {
+                _ if diff.is_empty() => DefinitionStatus::Unchanged,
+                ImportMode::Reconcile if safe => {
+                    jetstream
+                        .update_stream(&safe_update_config(&current, desired))
+                        .await
+                        .context("Failed to update JetStream stream")?;
+                    DefinitionStatus::Updated
+                }
+                ImportMode::DryRun if safe => DefinitionStatus::WouldUpdate,
+                _ => DefinitionStatus::Drifted,
+            };
+            result.changes = diff.changes;
+            Some(stream)
+        }
+        Err(_) if mode == ImportMode::DryRun => {
+            result.status = DefinitionStatus::WouldCreate;
+            None
+        }
+        Err(_) => {
+            let stream = jetstream
+                .create_stream(desired.clone())
+                .await
+                .context("Failed to create JetStream stream")?;
+            result.status = DefinitionStatus::Created;
+            Some(stream)
+        }
+    };
+
+    for config in &definition.consumers {
+        let Some(durable) = config.durable_name.clone() else {
+            continue;
+        };
+        let exists = match &stream {
+            Some(stream) => stream.consumer_info(&durable).await.is_ok(),
+            None => false,
+        };
+        if exists {
+            continue;
+        }
+        if let Some(stream) = &stream {
+            if mode != ImportMode::DryRun {
+                stream
+                    .create_consumer(config.clone())
+                    .await
+                    .with_context(|| format!("Failed to create consumer '{}'", durable))?;
+            }
+        }
+        result.consumers_created.push(durable);
+    }
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::time::Duration;
+
+    #[test]
+    fn test_document_round_trip() {
+        let mut config = stream::Config {
+            name: "ORDERS".to_string(),
+            subjects: vec!["orders.>".to_string()],
+            max_age: Duration::from_secs(86400),
+            ..Default::default()
+        };
+        config
+            .metadata
+            .insert("team".to_string(), "payments".to_string());
+        let definitions = StreamDefinitions {
+            version: DEFINITIONS_VERSION,
+            exported_at: "2026-02-11T13:00:00.000Z".to_string(),
+            streams: vec![StreamDefinition {
+                config,
+                consumers: Vec::new(),
+            }],
+        };
+
+        let json = serde_json::to_value(&definitions).unwrap();
+        assert_eq!(json["version"], 1);
+        assert!(json["streams"][0].get("consumers").is_none());
+        let parsed: StreamDefinitions = serde_json::from_value(json).unwrap();
+        let config = &parsed.streams[0].config;
+        assert_eq!(config.name, "ORDERS");
+        assert_eq!(config.max_age, Duration::from_secs(86400));
+        assert_eq!(config.metadata["team"], "payments");
+    }
+
+    #[test]
+    fn test_import_mode_names() {
+        let mode: ImportMode = serde_json::from_str("\"create_only\"").unwrap();
+        assert_eq!(mode, ImportMode::CreateOnly);
+        assert_eq!(ImportMode::default(), ImportMode::DryRun);
+        assert!(serde_json::from_str::<ImportMode>("\"replace\"").is_err());
+    }
+}
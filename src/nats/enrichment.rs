@@ -0,0 +1,57 @@
+//! Server-assigned NATS headers stamped on every published event, so
+//! consumers can tell which Flux instance accepted an event, through which
+//! API, and when (independent of the producer's clock).
+
+use async_nats::HeaderMap;
+use std::fmt;
+
+/// When Flux accepted the event (Unix epoch milliseconds)
+pub const RECEIVED_AT_HEADER: &str = "x-flux-received-at";
+
+/// Instance id of the Flux process that accepted the event
+pub const INSTANCE_HEADER: &str = "x-flux-instance";
+
+/// API the event arrived through (`IngestApi::as_str`)
+pub const INGEST_API_HEADER: &str = "x-flux-api";
+
+/// How an event reached the publisher.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum IngestApi {
+    /// HTTP API (POST /api/events and friends)
+    Http,
+    /// NATS micro service (`publish` endpoint)
+    Nats,
+    /// Published by Flux itself: alerts, audit, health, dead letters
+    #[default]
+    Internal,
+}
+
+impl IngestApi {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            IngestApi::Http => "http",
+            IngestApi::Nats => "nats",
+            IngestApi::Internal => "internal",
+        }
+    }
+}
+
+impl fmt::Display for IngestApi {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// Add the enrichment headers to `headers`.
+pub(crate) fn stamp(
+    headers: &mut HeaderMap,
+    received_at: i64,
+    instance: Option<&str>,
+    api: IngestApi,
+) {
+    headers.insert(RECEIVED_AT_HEADER, received_at.to_string().as_str());
+    if let Some(instance) = instance {
+        headers.insert(INSTANCE_HEADER, instance);
+    }
+    headers.insert(INGEST_API_HEADER, api.as_str());
+}
@@ -0,0 +1,195 @@
+use super::codec::decode_event;
+use super::stream_reader::StreamReader;
+use crate::event::FluxEvent;
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, kv};
+use chrono::{DateTime, Utc};
+use serde::{Deserialize, Serialize};
+use std::fmt;
+use std::time::Duration;
+use tokio::sync::OnceCell;
+
+/// JetStream KV bucket mapping eventId to its stored location
+pub const EVENT_INDEX_BUCKET: &str = "FLUX_EVENT_INDEX";
+
+/// Where an event is stored in the JetStream stream.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct EventIndexEntry {
+    /// Flux stream name
+    pub stream: String,
+    /// NATS subject the event was published on
+    pub subject: String,
+    /// JetStream stream sequence
+    pub sequence: u64,
+}
+
+/// An event read back from JetStream by id.
+#[derive(Debug, Clone, Serialize)]
+pub struct StoredEvent {
+    pub event: FluxEvent,
+    pub subject: String,
+    pub sequence: u64,
+    pub stored_at: DateTime<Utc>,
+}
+
+/// Errors returned by `EventIndex::find_event`.
+#[derive(Debug)]
+pub enum FindEventError {
+    /// No index entry: unknown id, published before indexing was enabled,
+    /// index write failed, or the entry expired
+    NotIndexed(String),
+    /// Indexed, but the message is no longer in the stream (aged out or purged)
+    NotFound(String),
+    Failed(anyhow::Error),
+}
+
+impl fmt::Display for FindEventError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            FindEventError::NotIndexed(id) => write!(f, "event '{}' is not indexed", id),
+            FindEventError::NotFound(id) => write!(f, "event '{}' is no longer stored", id),
+            FindEventError::Failed(e) => write!(f, "event lookup failed: {}", e),
+        }
+    }
+}
+
+impl std::error::Error for FindEventError {}
+
+/// Optional eventId → stream sequence index, kept in a JetStream KV bucket.
+///
+/// Entries expire with the bucket's max age, which should match the event
+/// stream's retention so the index never points far past what is stored.
+pub struct EventIndex {
+    jetstream: jetstream::Context,
+    kv: kv::Store,
+    stream_name: String,
+    reader: OnceCell<StreamReader>,
+}
+
+impl EventIndex {
+    /// Open (or create) the index bucket for events stored in `stream_name`.
+    pub async fn open(
+        jetstream: &jetstream::Context,
+        stream_name: impl Into<String>,
+        max_age: Duration,
+    ) -> Result<Self> {
+        Self::open_bucket(jetstream, EVENT_INDEX_BUCKET, stream_name, max_age).await
+    }
+
+    /// Open (or create) an index in a named bucket.
+    pub async fn open_bucket(
+        jetstream: &jetstream::Context,
+        bucket: &str,
+        stream_name: impl Into<String>,
+        max_age: Duration,
+    ) -> Result<Self> {
+        let kv = match jetstream.get_key_value(bucket).await {
+            Ok(kv) => kv,
+            Err(_) => jetstream
+                .create_key_value(kv::Config {
+                    bucket: bucket.to_string(),
+                    description: "Flux eventId index".to_string(),
+                    history: 1,
+                    max_age,
+                    ..Default::default()
+                })
+                .await
+                .context("Failed to create event index bucket")?,
+        };
+
+        Ok(Self {
+            jetstream: jetstream.clone(),
+            kv,
+            stream_name: stream_name.into(),
+            reader: OnceCell::new(),
+        })
+    }
+
+    /// Record where `event_id` was stored.
+    pub async fn record(&self, event_id: &str, entry: &EventIndexEntry) -> Result<()> {
+        let value = serde_json::to_vec(entry)?;
+        self.kv
+            .put(event_id, value.into())
+            .await
+            .context("Failed to write event index entry")?;
+        Ok(())
+    }
+
+    /// Index entry for `event_id`, if any.
+    pub async fn lookup(&self, event_id: &str) -> Result<Option<EventIndexEntry>> {
+        let Some(value) = self
+            .kv
+            .get(event_id)
+            .await
+            .context("Failed to read event index")?
+        else {
+            return Ok(None);
+        };
+        Ok(Some(serde_json::from_slice(&value)?))
+    }
+
+    /// Read an event back from the stream by id.
+    pub async fn find_event(&self, event_id: &str) -> Result<StoredEvent, FindEventError> {
+        // Ids that are not valid KV keys can never have been indexed
+        if !is_valid_key(event_id) {
+            return Err(FindEventError::NotIndexed(event_id.to_string()));
+        }
+        let entry = self
+            .lookup(event_id)
+            .await
+            .map_err(FindEventError::Failed)?
+            .ok_or_else(|| FindEventError::NotIndexed(event_id.to_string()))?;
+
+        let reader = self
+            .reader
+            .get_or_try_init(|| StreamReader::open(&self.jetstream, &self.stream_name))
+            .await
+            .map_err(FindEventError::Failed)?;
+        let message = reader
+            .get(entry.sequence)
+            .await
+            .map_err(|_| FindEventError::NotFound(event_id.to_string()))?;
+
+        let event = decode_event(Some(&message.headers), &message.payload)
+            .map_err(FindEventError::Failed)?;
+        if event.event_id.as_deref() != Some(event_id) {
+            // Sequence reused after a purge/recreate: the indexed event is gone
+            return Err(FindEventError::NotFound(event_id.to_string()));
+        }
+
+        Ok(StoredEvent {
+            event,
+            subject: message.subject.to_string(),
+            sequence: message.sequence,
+            stored_at: DateTime::from_timestamp(
+                message.time.unix_timestamp(),
+                message.time.nanosecond(),
+            )
+            .unwrap_or_default(),
+        })
+    }
+}
+
+/// KV keys: [-/_=.a-zA-Z0-9], not starting or ending with '.'
+fn is_valid_key(key: &str) -> bool {
+    !key.is_empty()
+        && !key.starts_with('.')
+        && !key.ends_with('.')
+        && key
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || matches!(c, '-' | '/' | '_' | '=' | '.'))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_is_valid_key() {
+        assert!(is_valid_key("018f3c2a-7b1e-7cc0-9d1e-2f4b6a8c0d12"));
+        assert!(!is_valid_key(""));
+        assert!(!is_valid_key("has space"));
+        assert!(!is_valid_key(".leading"));
+        assert!(!is_valid_key("wild*card"));
+    }
+}
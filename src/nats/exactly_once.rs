@@ -0,0 +1,357 @@
+use super::backoff::redelivery_delay;
+use super::received::ReceivedEvent;
+use crate::clock::{self, SharedClock};
+use crate::event::{check_envelope_version, FluxEvent, CURRENT_ENVELOPE_VERSION, ENVELOPE_V1};
+use crate::state::LagMetrics;
+use anyhow::{anyhow, Context, Result};
+use async_nats::jetstream::{self, kv, AckKind};
+use std::collections::{HashSet, VecDeque};
+use std::future::Future;
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use tracing::warn;
+
+/// Processed ids remembered locally before falling back to the KV bucket
+const DEFAULT_CACHE_SIZE: usize = 10_000;
+
+/// Called with the delivery latency of an event slower than the alert threshold.
+pub type LatencyAlert = Arc<dyn Fn(Duration, &FluxEvent) + Send + Sync>;
+
+/// Called with each event skipped because its TTL had passed.
+pub type ExpiredEventHandler = Arc<dyn Fn(&FluxEvent) + Send + Sync>;
+
+/// What `ExactlyOnce::handle` did with a message.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Handled {
+    /// Handler ran and succeeded; the id is marked and the message acked
+    Processed,
+    /// Id already marked; handler skipped, message acked
+    Duplicate,
+    /// Event older than its TTL; handler skipped, message acked
+    Expired,
+}
+
+/// Bounded set of recently processed ids (oldest evicted first).
+struct RecentIds {
+    ids: HashSet<String>,
+    order: VecDeque<String>,
+    capacity: usize,
+}
+
+impl RecentIds {
+    fn new(capacity: usize) -> Self {
+        Self {
+            ids: HashSet::new(),
+            order: VecDeque::new(),
+            capacity,
+        }
+    }
+
+    fn contains(&self, id: &str) -> bool {
+        self.ids.contains(id)
+    }
+
+    fn insert(&mut self, id: &str) {
+        if self.capacity == 0 || !self.ids.insert(id.to_string()) {
+            return;
+        }
+        self.order.push_back(id.to_string());
+        if self.order.len() > self.capacity {
+            if let Some(oldest) = self.order.pop_front() {
+                self.ids.remove(&oldest);
+            }
+        }
+    }
+}
+
+/// Consumer-side deduplication by eventId.
+///
+/// Processed ids are recorded in a JetStream KV bucket whose max age is the
+/// dedup horizon, and cached in memory so redeliveries and repeats seen by
+/// this process skip the KV read.
+///
+/// An id is marked only after the handler succeeds, and before the ack. A
+/// crash between handler success and the mark re-runs the handler on
+/// redelivery, so handlers should still tolerate a rare repeat. With
+/// `with_double_ack`, the ack is confirmed by the server (AckSync) before
+/// `handle` returns, so a returned `Processed` means the message will not be
+/// redelivered.
+pub struct ExactlyOnce {
+    kv: kv::Store,
+    recent: Mutex<RecentIds>,
+    double_ack: bool,
+    min_envelope_version: u32,
+    max_envelope_version: u32,
+    backoff: Vec<Duration>,
+    clock: SharedClock,
+    /// Histograms and the consumer name to record delivery latency under
+    delivery_metrics: Option<(LagMetrics, String)>,
+    latency_alert: Option<(Duration, LatencyAlert)>,
+    expired_handler: Option<ExpiredEventHandler>,
+}
+
+impl ExactlyOnce {
+    /// Open (or create) `bucket`, keeping ids for `horizon`.
+    ///
+    /// Without a horizon, ids are kept for the duplicate window of
+    /// `stream_name` (JetStream defaults to two minutes).
+    pub async fn open(
+        jetstream: &jetstream::Context,
+        bucket: &str,
+        stream_name: &str,
+        horizon: Option<Duration>,
+    ) -> Result<Self> {
+        let horizon = match horizon {
+            Some(horizon) => horizon,
+            None => {
+                let mut stream = jetstream
+                    .get_stream(stream_name)
+                    .await
+                    .context("Failed to get JetStream stream")?;
+                stream.info().await?.config.duplicate_window
+            }
+        };
+
+        let kv = match jetstream.get_key_value(bucket).await {
+            Ok(kv) => kv,
+            Err(_) => jetstream
+                .create_key_value(kv::Config {
+                    bucket: bucket.to_string(),
+                    description: "Flux processed eventIds".to_string(),
+                    history: 1,
+                    max_age: horizon,
+                    ..Default::default()
+                })
+                .await
+                .context("Failed to create processed-id bucket")?,
+        };
+
+        Ok(Self {
+            kv,
+            recent: Mutex::new(RecentIds::new(DEFAULT_CACHE_SIZE)),
+            double_ack: false,
+            min_envelope_version: ENVELOPE_V1,
+            max_envelope_version: CURRENT_ENVELOPE_VERSION,
+            backoff: Vec::new(),
+            clock: clock::system(),
+            delivery_metrics: None,
+            latency_alert: None,
+            expired_handler: None,
+        })
+    }
+
+    /// Confirm acks with the server (double ack) before returning.
+    pub fn with_double_ack(mut self) -> Self {
+        self.double_ack = true;
+        self
+    }
+
+    /// Terminate events with an envelope version below `version`.
+    pub fn with_min_envelope_version(mut self, version: u32) -> Self {
+        self.min_envelope_version = version;
+        self
+    }
+
+    /// Terminate events with an envelope version above `version`, e.g. 1 for
+    /// a handler written before `priority` existed. Defaults to the newest
+    /// version this build understands.
+    pub fn with_max_envelope_version(mut self, version: u32) -> Self {
+        self.max_envelope_version = version;
+        self
+    }
+
+    /// Space out redeliveries after handler errors: the nth failed delivery
+    /// is nak'ed with the nth delay (the last one repeating). Use the same
+    /// schedule as the consumer's `backoff`, which covers ack timeouts.
+    pub fn with_backoff(mut self, schedule: Vec<Duration>) -> Self {
+        self.backoff = schedule;
+        self
+    }
+
+    /// Record each delivery's latency (now minus event timestamp) in
+    /// `flux_consumer_delivery_latency_seconds` under `consumer`.
+    pub fn with_delivery_metrics(
+        mut self,
+        metrics: LagMetrics,
+        consumer: impl Into<String>,
+    ) -> Self {
+        self.delivery_metrics = Some((metrics, consumer.into()));
+        self
+    }
+
+    /// Call `alert` for every delivered event older than `threshold`, before
+    /// the handler runs (e.g. to page on slow alarms).
+    pub fn with_latency_alert<F>(mut self, threshold: Duration, alert: F) -> Self
+    where
+        F: Fn(Duration, &FluxEvent) + Send + Sync + 'static,
+    {
+        self.latency_alert = Some((threshold, Arc::new(alert)));
+        self
+    }
+
+    /// Call `handler` with events skipped as expired (older than their TTL),
+    /// e.g. to count or dead-letter them, instead of only logging them.
+    pub fn with_expired_event_handler<F>(mut self, handler: F) -> Self
+    where
+        F: Fn(&FluxEvent) + Send + Sync + 'static,
+    {
+        self.expired_handler = Some(Arc::new(handler));
+        self
+    }
+
+    /// Measure delivery latency and TTLs with `clock` instead of the system
+    /// clock.
+    pub fn with_clock(mut self, clock: SharedClock) -> Self {
+        self.clock = clock;
+        self
+    }
+
+    /// Remember up to `size` processed ids in memory (default 10,000).
+    pub fn with_cache_size(mut self, size: usize) -> Self {
+        self.recent = Mutex::new(RecentIds::new(size));
+        self
+    }
+
+    /// True if `event_id` was marked within the horizon.
+    pub async fn is_processed(&self, event_id: &str) -> Result<bool> {
+        if self.recent.lock().unwrap().contains(event_id) {
+            return Ok(true);
+        }
+        let found = self
+            .kv
+            .get(event_id)
+            .await
+            .context("Failed to read processed-id bucket")?
+            .is_some();
+        if found {
+            self.recent.lock().unwrap().insert(event_id);
+        }
+        Ok(found)
+    }
+
+    /// Mark `event_id` as processed.
+    pub async fn mark_processed(&self, event_id: &str) -> Result<()> {
+        let marked_at = chrono::Utc::now().timestamp_millis().to_string();
+        self.kv
+            .put(event_id, marked_at.into_bytes().into())
+            .await
+            .context("Failed to mark event processed")?;
+        self.recent.lock().unwrap().insert(event_id);
+        Ok(())
+    }
+
+    /// Run `handler` for a message unless its event was already processed.
+    ///
+    /// On handler error the message is nak'ed for redelivery and the error
+    /// returned; redelivery waits for a `RetryAfter` error's delay, else the
+    /// backoff schedule (immediate without one). Messages that cannot be
+    /// decoded, carry no eventId, or have an envelope version outside the
+    /// accepted range are terminated (never redelivered) and an error returned.
+    /// Events past their TTL are acked without running the handler.
+    ///
+    /// The handler gets the event with its delivery metadata and headers.
+    pub async fn handle<F, Fut>(&self, message: jetstream::Message, handler: F) -> Result<Handled>
+    where
+        F: FnOnce(ReceivedEvent) -> Fut,
+        Fut: Future<Output = Result<()>>,
+    {
+        let received = match ReceivedEvent::from_message(&message) {
+            Ok(received) => received,
+            Err(e) => {
+                let _ = message.ack_with(AckKind::Term).await;
+                return Err(e);
+            }
+        };
+        let event = &received.event;
+        if let Err(e) = check_envelope_version(
+            event,
+            self.min_envelope_version,
+            self.max_envelope_version,
+        ) {
+            let _ = message.ack_with(AckKind::Term).await;
+            return Err(e.into());
+        }
+        let Some(event_id) = event.event_id.clone() else {
+            let _ = message.ack_with(AckKind::Term).await;
+            return Err(anyhow!("event has no eventId"));
+        };
+        self.observe_delivery(event);
+
+        if event.is_expired(self.clock.now_millis()) {
+            warn!(
+                event_id = %event_id,
+                stream = %event.stream,
+                ttl_ms = event.ttl_ms,
+                "Skipping expired event"
+            );
+            if let Some(handler) = &self.expired_handler {
+                handler(event);
+            }
+            self.ack(&message).await?;
+            return Ok(Handled::Expired);
+        }
+
+        if self.is_processed(&event_id).await? {
+            self.ack(&message).await?;
+            return Ok(Handled::Duplicate);
+        }
+
+        let delivered = received.meta.delivered;
+        if let Err(e) = handler(received).await {
+            let delay = redelivery_delay(&e, &self.backoff, delivered);
+            let _ = message.ack_with(AckKind::Nak(delay)).await;
+            return Err(e);
+        }
+
+        self.mark_processed(&event_id).await?;
+        self.ack(&message).await?;
+        Ok(Handled::Processed)
+    }
+
+    fn observe_delivery(&self, event: &FluxEvent) {
+        let now_ms = self.clock.now_millis();
+        if let Some((metrics, consumer)) = &self.delivery_metrics {
+            metrics.observe_delivery(consumer, &event.stream, event.timestamp, now_ms);
+        }
+        if let Some((threshold, alert)) = &self.latency_alert {
+            let latency = Duration::from_millis((now_ms - event.timestamp).max(0) as u64);
+            if latency > *threshold {
+                alert(latency, event);
+            }
+        }
+    }
+
+    async fn ack(&self, message: &jetstream::Message) -> Result<()> {
+        let result = if self.double_ack {
+            message.double_ack().await
+        } else {
+            message.ack().await
+        };
+        result.map_err(|e| anyhow!("Failed to ack message: {}", e))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_recent_ids_evicts_oldest() {
+        let mut recent = RecentIds::new(2);
+        recent.insert("a");
+        recent.insert("b");
+        recent.insert("a"); // already present: no reorder
+        recent.insert("c");
+
+        assert!(!recent.contains("a"));
+        assert!(recent.contains("b"));
+        assert!(recent.contains("c"));
+    }
+
+    #[test]
+    fn test_zero_capacity_caches_nothing() {
+        let mut recent = RecentIds::new(0);
+        recent.insert("a");
+        assert!(!recent.contains("a"));
+    }
+}
@@ -0,0 +1,204 @@
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, stream};
+use futures::TryStreamExt;
+use serde::Deserialize;
+use std::time::Duration;
+use tracing::info;
+
+/// Default name of the firehose stream. JetStream stream names cannot contain
+/// dots, so this stands in for "flux.firehose".
+pub const FIREHOSE_STREAM: &str = "FLUX_FIREHOSE";
+
+/// Streams JetStream uses to back KV buckets and object stores; never sourced
+pub(crate) const INTERNAL_STREAM_PREFIXES: [&str; 2] = ["KV_", "OBJ_"];
+
+/// One stream that sources every other stream (`[nats.firehose]`), so a
+/// single consumer sees every event with its original subject.
+#[derive(Clone, Debug, Deserialize)]
+pub struct FirehoseConfig {
+    #[serde(default = "default_firehose_stream")]
+    pub stream_name: String,
+    /// Retention, independent of the sourced streams
+    #[serde(default = "default_firehose_max_age_days")]
+    pub max_age_days: i64,
+    #[serde(default = "default_firehose_max_bytes")]
+    pub max_bytes: i64,
+    /// How often to pick up streams created since the last sync (seconds)
+    #[serde(default = "default_firehose_sync_interval")]
+    pub sync_interval_seconds: u64,
+}
+
+fn default_firehose_stream() -> String {
+    FIREHOSE_STREAM.to_string()
+}
+
+fn default_firehose_max_age_days() -> i64 {
+    1
+}
+
+fn default_firehose_max_bytes() -> i64 {
+    -1 // unlimited
+}
+
+fn default_firehose_sync_interval() -> u64 {
+    60
+}
+
+impl Default for FirehoseConfig {
+    fn default() -> Self {
+        Self {
+            stream_name: default_firehose_stream(),
+            max_age_days: default_firehose_max_age_days(),
+            max_bytes: default_firehose_max_bytes(),
+            sync_interval_seconds: default_firehose_sync_interval(),
+        }
+    }
+}
+
+impl FirehoseConfig {
+    fn stream_config(&self, sources: &[String]) -> stream::Config {
+        stream::Config {
+            name: self.stream_name.clone(),
+            // Fed only by sources; sourced messages keep their original subjects
+            subjects: Vec::new(),
+            sources: Some(
+                sources
+                    .iter()
+                    .map(|name| stream::Source {
+                        name: name.clone(),
+                        ..Default::default()
+                    })
+                    .collect(),
+            ),
+            max_age: Duration::from_secs(self.max_age_days.max(0) as u64 * 86400),
+            max_bytes: self.max_bytes,
+            storage: stream::StorageType::File,
+            ..Default::default()
+        }
+    }
+}
+
+/// Streams the firehose should source: everything except itself and the
+/// streams behind KV buckets and object stores, sorted by name.
+pub fn firehose_sources(mut names: Vec<String>, firehose: &str) -> Vec<String> {
+    names.retain(|name| {
+        name != firehose
+            && !INTERNAL_STREAM_PREFIXES
+                .iter()
+                .any(|prefix| name.starts_with(prefix))
+    });
+    names.sort();
+    names.dedup();
+    names
+}
+
+/// Create the firehose stream, or bring its sources up to date with the
+/// streams that exist now. Idempotent; run it again (see
+/// `sync_interval_seconds`) to pick up streams created since. Returns the
+/// sourced stream names.
+pub async fn enable_firehose(
+    jetstream: &jetstream::Context,
+    config: &FirehoseConfig,
+) -> Result<Vec<String>> {
+    let names: Vec<String> = jetstream
+        .stream_names()
+        .try_collect()
+        .await
+        .context("Failed to list stream names")?;
+    let sources = firehose_sources(names, &config.stream_name);
+    let desired = config.stream_config(&sources);
+
+    match jetstream.get_stream(&config.stream_name).await {
+        Ok(stream) => {
+            let current = &stream.cached_info().config;
+            if source_names(current) == sources
+                && current.max_age == desired.max_age
+                && current.max_bytes == desired.max_bytes
+            {
+                return Ok(sources);
+            }
+            jetstream
+                .update_stream(&desired)
+                .await
+                .context("Failed to update firehose stream")?;
+        }
+        Err(_) => {
+            jetstream
+                .create_stream(desired)
+                .await
+                .context("Failed to create firehose stream")?;
+        }
+    }
+
+    info!(
+        stream = %config.stream_name,
+        sources = %sources.join(","),
+        "Firehose sources updated"
+    );
+    Ok(sources)
+}
+
+/// Stop the firehose by removing all its sources. Events already copied stay
+/// until the firehose's own limits age them out (delete the stream to drop
+/// them now). Returns false if there is no firehose stream.
+pub async fn disable_firehose(jetstream: &jetstream::Context, stream_name: &str) -> Result<bool> {
+    let mut config = match jetstream.get_stream(stream_name).await {
+        Ok(stream) => stream.cached_info().config.clone(),
+        Err(_) => return Ok(false),
+    };
+    config.sources = None;
+    jetstream
+        .update_stream(&config)
+        .await
+        .context("Failed to remove firehose sources")?;
+    info!(stream = %stream_name, "Firehose disabled");
+    Ok(true)
+}
+
+fn source_names(config: &stream::Config) -> Vec<String> {
+    let mut names: Vec<String> = config
+        .sources
+        .iter()
+        .flatten()
+        .map(|source| source.name.clone())
+        .collect();
+    names.sort();
+    names
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn names(list: &[&str]) -> Vec<String> {
+        list.iter().map(|name| name.to_string()).collect()
+    }
+
+    #[test]
+    fn test_firehose_sources_skip_internal_streams() {
+        let all = names(&[
+            "FLUX_EVENTS",
+            "FLUX_FIREHOSE",
+            "KV_FLUX_EVENT_INDEX",
+            "OBJ_snapshots",
+            "AUDIT",
+        ]);
+        assert_eq!(
+            firehose_sources(all, FIREHOSE_STREAM),
+            names(&["AUDIT", "FLUX_EVENTS"])
+        );
+    }
+
+    #[test]
+    fn test_firehose_stream_config() {
+        let config = FirehoseConfig {
+            max_age_days: 2,
+            ..Default::default()
+        }
+        .stream_config(&names(&["AUDIT", "FLUX_EVENTS"]));
+        assert_eq!(config.name, "FLUX_FIREHOSE");
+        assert!(config.subjects.is_empty());
+        assert_eq!(source_names(&config), names(&["AUDIT", "FLUX_EVENTS"]));
+        assert_eq!(config.max_age, Duration::from_secs(2 * 86400));
+    }
+}
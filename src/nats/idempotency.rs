@@ -0,0 +1,120 @@
+use std::collections::{BTreeMap, HashMap};
+use std::sync::Mutex;
+
+/// eventId → stream sequence for the most recently published events, so a
+/// producer retrying a publish whose ack was lost gets the original sequence
+/// back instead of storing the event twice.
+///
+/// Unlike JetStream's `Nats-Msg-Id` deduplication this has no time window;
+/// it is bounded by `capacity` instead, evicting the least recently used id.
+/// Entries are local to the process.
+#[derive(Debug)]
+pub struct IdempotencyCache {
+    inner: Mutex<Lru>,
+    capacity: usize,
+}
+
+#[derive(Debug, Default)]
+struct Lru {
+    /// eventId -> (sequence, last use)
+    entries: HashMap<String, (u64, u64)>,
+    /// last use -> eventId, oldest first
+    recency: BTreeMap<u64, String>,
+    clock: u64,
+}
+
+impl Lru {
+    fn touch(&mut self, event_id: &str) -> Option<u64> {
+        self.clock += 1;
+        let (sequence, used) = self.entries.get_mut(event_id)?;
+        self.recency.remove(used);
+        *used = self.clock;
+        self.recency.insert(self.clock, event_id.to_string());
+        Some(*sequence)
+    }
+}
+
+impl IdempotencyCache {
+    /// Cache for the last `capacity` event ids (0 disables it).
+    pub fn new(capacity: usize) -> Self {
+        Self {
+            inner: Mutex::new(Lru::default()),
+            capacity,
+        }
+    }
+
+    /// Sequence `event_id` was stored at, if it is still cached.
+    pub fn get(&self, event_id: &str) -> Option<u64> {
+        self.inner.lock().unwrap().touch(event_id)
+    }
+
+    /// Remember that `event_id` was stored at `sequence`.
+    pub fn insert(&self, event_id: &str, sequence: u64) {
+        if self.capacity == 0 {
+            return;
+        }
+        let mut lru = self.inner.lock().unwrap();
+        if lru.touch(event_id).is_some() {
+            lru.entries.get_mut(event_id).unwrap().0 = sequence;
+            return;
+        }
+        let used = lru.clock;
+        lru.entries.insert(event_id.to_string(), (sequence, used));
+        lru.recency.insert(used, event_id.to_string());
+        while lru.entries.len() > self.capacity {
+            let Some((_, oldest)) = lru.recency.pop_first() else {
+                break;
+            };
+            lru.entries.remove(&oldest);
+        }
+    }
+
+    pub fn len(&self) -> usize {
+        self.inner.lock().unwrap().entries.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+
+    pub fn capacity(&self) -> usize {
+        self.capacity
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_returns_cached_sequence() {
+        let cache = IdempotencyCache::new(10);
+        assert_eq!(cache.get("a"), None);
+        cache.insert("a", 7);
+        assert_eq!(cache.get("a"), Some(7));
+        assert_eq!(cache.len(), 1);
+    }
+
+    #[test]
+    fn test_evicts_least_recently_used() {
+        let cache = IdempotencyCache::new(2);
+        cache.insert("a", 1);
+        cache.insert("b", 2);
+        // Reading "a" makes "b" the eviction candidate
+        assert_eq!(cache.get("a"), Some(1));
+        cache.insert("c", 3);
+
+        assert_eq!(cache.get("b"), None);
+        assert_eq!(cache.get("a"), Some(1));
+        assert_eq!(cache.get("c"), Some(3));
+        assert_eq!(cache.len(), 2);
+    }
+
+    #[test]
+    fn test_zero_capacity_caches_nothing() {
+        let cache = IdempotencyCache::new(0);
+        cache.insert("a", 1);
+        assert!(cache.is_empty());
+        assert_eq!(cache.get("a"), None);
+    }
+}
@@ -1,7 +1,110 @@
 // NATS client integration (Task 4)
 
+mod account_monitor;
+mod admission;
+mod archive;
+mod backoff;
 mod client;
+mod codec;
+mod connection_monitor;
+mod consumer_group;
+mod dedup;
+mod definitions;
+mod enrichment;
+mod event_index;
+mod exactly_once;
+mod firehose;
+mod idempotency;
+mod ordered;
+mod proto;
 mod publisher;
+mod received;
+mod reconcile;
+mod resume;
+mod sampling;
+mod service;
+mod stream_cache;
+mod stream_diff;
+mod stream_export;
+mod stream_janitor;
+mod stream_list;
+mod stream_migration;
+mod stream_reader;
+mod stream_usage;
+mod subject;
+mod ttl_purge;
 
-pub use client::{NatsClient, NatsConfig};
-pub use publisher::EventPublisher;
+pub use account_monitor::{AccountMonitor, AccountUsage};
+pub use admission::{AdmissionConfig, AdmissionPermit, AdmissionRejectedError, PublishAdmission};
+pub use archive::{
+    archived_at, StreamArchivedError, StreamNotArchivedError, ARCHIVED_LABEL,
+    ARCHIVED_SUBJECT_PREFIX,
+};
+pub use backoff::{backoff_delay, nak_with_delay, redelivery_delay, RetryAfter};
+pub use client::{
+    default_connection_name, jetstream_context, BatchStreamError, DiscardPolicy,
+    DuplicateWindowError, JetStreamTarget, MessageNotFoundError, NatsClient, NatsConfig,
+    RepublishConfig, RepublishLoopError, StreamCreateError, StreamInitResult, StreamInitStatus,
+    StreamNotFoundError, StreamProtectedError,
+};
+pub use codec::{
+    decode_event, encode_event, event_from_message, event_to_message, EncodedEvent, EventEncoding,
+    SerializationError, CONTENT_ENCODING_HEADER, CONTENT_TYPE_HEADER, GZIP_ENCODING,
+    PROTOBUF_CONTENT_TYPE,
+};
+pub use connection_monitor::ConnectionMonitor;
+pub use consumer_group::{
+    group_durable_name, ConsumerGroup, DEFAULT_MAX_ACK_PENDING_PER_MEMBER,
+};
+pub use event_index::{
+    EventIndex, EventIndexEntry, FindEventError, StoredEvent, EVENT_INDEX_BUCKET,
+};
+pub use dedup::{DedupStore, DeduplicatingHandler, MemoryDedupStore};
+pub use definitions::{
+    export_definitions, import_definitions, DefinitionResult, DefinitionStatus, ImportMode,
+    ImportReport, StreamDefinition, StreamDefinitions, UnsupportedDefinitionsError,
+    DEFINITIONS_VERSION,
+};
+pub use enrichment::{IngestApi, INGEST_API_HEADER, INSTANCE_HEADER, RECEIVED_AT_HEADER};
+pub use exactly_once::{ExactlyOnce, ExpiredEventHandler, Handled, LatencyAlert};
+pub use firehose::{
+    disable_firehose, enable_firehose, firehose_sources, FirehoseConfig, FIREHOSE_STREAM,
+};
+pub use idempotency::IdempotencyCache;
+pub use ordered::OrderedPublisher;
+pub use publisher::{
+    AckMode, EventPublisher, PayloadTooLargeError, PendingAck, PublishAck, PublishError,
+    PublishReceipt, PublishTimeoutError, StreamFullError, SubjectMapping,
+    SubjectNotCapturedError, DEFAULT_PUBLISH_TIMEOUT, PRIORITY_HEADER,
+};
+pub use received::{DeliveryMeta, ReceivedEvent, TRACEPARENT_HEADER};
+pub use reconcile::{ReconcileReport, Reconciler};
+pub use resume::{
+    fetch_page, EventPage, InvalidTokenError, ResumeToken, SequencedEvent, MAX_PAGE_LIMIT,
+};
+pub use sampling::{Sampler, SamplingConfig};
+pub use service::{start_service, PublishResponse, StreamInfoResponse, SERVICE_NAME};
+pub use stream_cache::{stream_page_etag, StreamInfoCache};
+pub use stream_diff::{
+    diff_stream_config, safe_update_config, FieldChange, StreamConfigDiff, UnsafeUpdateError,
+};
+pub use stream_export::{export_stream, import_stream, TransferCancelledError, TransferOptions};
+pub use stream_janitor::{
+    JanitorCandidate, StreamActivity, StreamJanitor, StreamJanitorConfig, AUDIT_STREAM,
+    AUTO_CREATED_LABEL,
+};
+pub use stream_list::{
+    list_streams_page, parse_label_selector, InvalidContinuationError, StreamListOptions,
+    StreamPage, DEFAULT_PAGE_SIZE, MAX_PAGE_SIZE,
+};
+pub use stream_migration::{
+    shrinks_retention, MigrationMethod, StreamMigration, DEPRECATED_LABEL, DEPRECATED_STREAM_SUFFIX,
+};
+pub use stream_reader::StreamReader;
+pub use stream_usage::{StreamUsage, StreamUsageAlert, StreamUsageMonitor, ALERT_STREAM};
+pub use subject::{
+    high_priority_subject, stream_filter_subjects, stream_from_subject, stream_in_prefix,
+    stream_subject, subject_matches, subjects_overlap, wildcard_subjects, HIGH_PRIORITY_SUFFIX,
+    SUBJECT_PREFIX,
+};
+pub use ttl_purge::{TtlPurgeConfig, TtlPurger, TTL_HEADER, TTL_INDEX_BUCKET};
@@ -0,0 +1,62 @@
+use super::publisher::EventPublisher;
+use crate::event::FluxEvent;
+use anyhow::Result;
+use std::collections::HashMap;
+use std::future::Future;
+use std::sync::{Arc, Mutex};
+use tokio::sync::watch;
+
+/// (stream, key) an ordering applies to; events without a key are ordered
+/// per stream.
+type OrderingKey = (String, Option<String>);
+
+/// Publishes events with the same stream and key one at a time, each only
+/// once JetStream has acked the one before it, so they are stored in the
+/// order `publish` was called even when many callers publish concurrently.
+/// Events with different keys are not held up by each other.
+///
+/// The order is fixed when `publish` is called, not when its future is
+/// first polled. A publish that fails releases the next one, which is
+/// stored after whatever was stored before the failure. Clones share the
+/// ordering.
+///
+/// Pair it with a stream from `NatsConfig::ordered`.
+#[derive(Clone)]
+pub struct OrderedPublisher {
+    inner: EventPublisher,
+    /// Completion of the last publish queued for each key
+    tails: Arc<Mutex<HashMap<OrderingKey, watch::Receiver<bool>>>>,
+}
+
+impl OrderedPublisher {
+    pub fn new(inner: EventPublisher) -> Self {
+        Self {
+            inner,
+            tails: Arc::new(Mutex::new(HashMap::new())),
+        }
+    }
+
+    /// Queue `event` behind earlier publishes with its stream and key, and
+    /// publish it once they have been acked.
+    pub fn publish(&self, event: &FluxEvent) -> impl Future<Output = Result<()>> + Send + 'static {
+        let key = (event.stream.clone(), event.key.clone());
+        let (done, tail) = watch::channel(false);
+        let previous = self.tails.lock().unwrap().insert(key.clone(), tail.clone());
+
+        let (inner, tails, event) = (self.inner.clone(), Arc::clone(&self.tails), event.clone());
+        async move {
+            if let Some(mut previous) = previous {
+                // Err: the previous publish was dropped before finishing
+                let _ = previous.wait_for(|done| *done).await;
+            }
+            let result = inner.publish(&event).await;
+            let _ = done.send(true);
+
+            let mut tails = tails.lock().unwrap();
+            if tails.get(&key).is_some_and(|last| last.same_channel(&tail)) {
+                tails.remove(&key);
+            }
+            result
+        }
+    }
+}
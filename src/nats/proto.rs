@@ -0,0 +1,343 @@
+//! Protobuf wire format for the event envelope (see proto/flux_event.proto).
+//!
+//! The envelope is small and flat, so it is encoded by hand rather than via
+//! generated code. The payload travels as its JSON bytes (field 8): the
+//! producer's original bytes when the event still carries them (see
+//! `FluxEvent::raw_payload`), and decoding keeps them for the next hop.
+
+use crate::event::{FluxEvent, Priority};
+use anyhow::{anyhow, bail, Context, Result};
+use serde_json::value::RawValue;
+
+const WIRE_VARINT: u8 = 0;
+const WIRE_I64: u8 = 1;
+const WIRE_LEN: u8 = 2;
+const WIRE_I32: u8 = 5;
+
+const FIELD_EVENT_ID: u32 = 1;
+const FIELD_STREAM: u32 = 2;
+const FIELD_SOURCE: u32 = 3;
+const FIELD_TIMESTAMP: u32 = 4;
+const FIELD_KEY: u32 = 5;
+const FIELD_SCHEMA: u32 = 6;
+const FIELD_PRIORITY: u32 = 7;
+const FIELD_PAYLOAD: u32 = 8;
+const FIELD_ENVELOPE_VERSION: u32 = 9;
+const FIELD_RECEIVED_AT: u32 = 10;
+const FIELD_TTL_MS: u32 = 11;
+const FIELD_CORRELATION_ID: u32 = 12;
+const FIELD_PARENT_EVENT_ID: u32 = 13;
+
+/// Encode an event as a `flux.v1.Event` protobuf message.
+pub fn encode(event: &FluxEvent) -> Result<Vec<u8>> {
+    let payload = event
+        .payload_json()
+        .context("Failed to serialize payload")?;
+    let mut buf = Vec::with_capacity(payload.len() + 96);
+
+    if let Some(event_id) = &event.event_id {
+        put_bytes(&mut buf, FIELD_EVENT_ID, event_id.as_bytes());
+    }
+    put_bytes(&mut buf, FIELD_STREAM, event.stream.as_bytes());
+    put_bytes(&mut buf, FIELD_SOURCE, event.source.as_bytes());
+    put_tag(&mut buf, FIELD_TIMESTAMP, WIRE_VARINT);
+    put_varint(&mut buf, event.timestamp as u64);
+    if let Some(key) = &event.key {
+        put_bytes(&mut buf, FIELD_KEY, key.as_bytes());
+    }
+    if let Some(schema) = &event.schema {
+        put_bytes(&mut buf, FIELD_SCHEMA, schema.as_bytes());
+    }
+    if let Some(priority) = event.priority {
+        put_bytes(&mut buf, FIELD_PRIORITY, priority.as_str().as_bytes());
+    }
+    put_bytes(&mut buf, FIELD_PAYLOAD, &payload);
+    if let Some(version) = event.envelope_version {
+        put_tag(&mut buf, FIELD_ENVELOPE_VERSION, WIRE_VARINT);
+        put_varint(&mut buf, version as u64);
+    }
+    if let Some(received_at) = event.received_at {
+        put_tag(&mut buf, FIELD_RECEIVED_AT, WIRE_VARINT);
+        put_varint(&mut buf, received_at as u64);
+    }
+    if let Some(ttl_ms) = event.ttl_ms {
+        put_tag(&mut buf, FIELD_TTL_MS, WIRE_VARINT);
+        put_varint(&mut buf, ttl_ms);
+    }
+    if let Some(correlation_id) = &event.correlation_id {
+        put_bytes(&mut buf, FIELD_CORRELATION_ID, correlation_id.as_bytes());
+    }
+    if let Some(parent_event_id) = &event.parent_event_id {
+        put_bytes(&mut buf, FIELD_PARENT_EVENT_ID, parent_event_id.as_bytes());
+    }
+
+    Ok(buf)
+}
+
+/// Decode a `flux.v1.Event` protobuf message. Unknown fields are skipped.
+pub fn decode(mut buf: &[u8]) -> Result<FluxEvent> {
+    let mut event = FluxEvent {
+        event_id: None,
+        stream: String::new(),
+        source: String::new(),
+        timestamp: 0,
+        key: None,
+        schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
+        payload: serde_json::Value::Null,
+        raw_payload: None,
+    };
+
+    while !buf.is_empty() {
+        let tag = get_varint(&mut buf)?;
+        let field = (tag >> 3) as u32;
+        let wire_type = (tag & 0x7) as u8;
+
+        match (field, wire_type) {
+            (FIELD_TIMESTAMP, WIRE_VARINT) => event.timestamp = get_varint(&mut buf)? as i64,
+            (FIELD_ENVELOPE_VERSION, WIRE_VARINT) => {
+                event.envelope_version = Some(get_varint(&mut buf)? as u32);
+            }
+            (FIELD_RECEIVED_AT, WIRE_VARINT) => {
+                event.received_at = Some(get_varint(&mut buf)? as i64);
+            }
+            (FIELD_TTL_MS, WIRE_VARINT) => event.ttl_ms = Some(get_varint(&mut buf)?),
+            (FIELD_PAYLOAD, WIRE_LEN) => {
+                let raw: Box<RawValue> = serde_json::from_slice(get_bytes(&mut buf)?)
+                    .context("Invalid payload JSON in protobuf event")?;
+                event.payload = serde_json::from_str(raw.get())
+                    .context("Invalid payload JSON in protobuf event")?;
+                event.raw_payload = Some(raw);
+            }
+            (FIELD_PRIORITY, WIRE_LEN) => {
+                let value = get_string(&mut buf)?;
+                event.priority = Some(parse_priority(&value)?);
+            }
+            (FIELD_EVENT_ID, WIRE_LEN) => event.event_id = Some(get_string(&mut buf)?),
+            (FIELD_STREAM, WIRE_LEN) => event.stream = get_string(&mut buf)?,
+            (FIELD_SOURCE, WIRE_LEN) => event.source = get_string(&mut buf)?,
+            (FIELD_KEY, WIRE_LEN) => event.key = Some(get_string(&mut buf)?),
+            (FIELD_SCHEMA, WIRE_LEN) => event.schema = Some(get_string(&mut buf)?),
+            (FIELD_CORRELATION_ID, WIRE_LEN) => {
+                event.correlation_id = Some(get_string(&mut buf)?);
+            }
+            (FIELD_PARENT_EVENT_ID, WIRE_LEN) => {
+                event.parent_event_id = Some(get_string(&mut buf)?);
+            }
+            (_, wire_type) => skip_field(&mut buf, wire_type)?,
+        }
+    }
+
+    Ok(event)
+}
+
+fn parse_priority(value: &str) -> Result<Priority> {
+    serde_json::from_value(serde_json::Value::String(value.to_string()))
+        .map_err(|_| anyhow!("unknown priority '{}'", value))
+}
+
+fn put_tag(buf: &mut Vec<u8>, field: u32, wire_type: u8) {
+    put_varint(buf, ((field as u64) << 3) | wire_type as u64);
+}
+
+fn put_varint(buf: &mut Vec<u8>, mut value: u64) {
+    while value >= 0x80 {
+        buf.push((value as u8) | 0x80);
+        value >>= 7;
+    }
+    buf.push(value as u8);
+}
+
+fn put_bytes(buf: &mut Vec<u8>, field: u32, bytes: &[u8]) {
+    put_tag(buf, field, WIRE_LEN);
+    put_varint(buf, bytes.len() as u64);
+    buf.extend_from_slice(bytes);
+}
+
+fn get_varint(buf: &mut &[u8]) -> Result<u64> {
+    let mut value = 0u64;
+    for shift in (0..64).step_by(7) {
+        let (&byte, rest) = buf
+            .split_first()
+            .ok_or_else(|| anyhow!("truncated protobuf varint"))?;
+        *buf = rest;
+        value |= ((byte & 0x7f) as u64) << shift;
+        if byte & 0x80 == 0 {
+            return Ok(value);
+        }
+    }
+    bail!("protobuf varint too long")
+}
+
+fn get_bytes<'a>(buf: &mut &'a [u8]) -> Result<&'a [u8]> {
+    let len = get_varint(buf)? as usize;
+    if len > buf.len() {
+        bail!("truncated protobuf field");
+    }
+    let (bytes, rest) = buf.split_at(len);
+    *buf = rest;
+    Ok(bytes)
+}
+
+fn get_string(buf: &mut &[u8]) -> Result<String> {
+    String::from_utf8(get_bytes(buf)?.to_vec()).context("Invalid UTF-8 in protobuf string")
+}
+
+fn skip_field(buf: &mut &[u8], wire_type: u8) -> Result<()> {
+    let len = match wire_type {
+        WIRE_VARINT => return get_varint(buf).map(|_| ()),
+        WIRE_LEN => return get_bytes(buf).map(|_| ()),
+        WIRE_I64 => 8,
+        WIRE_I32 => 4,
+        other => bail!("unsupported protobuf wire type {}", other),
+    };
+    if len > buf.len() {
+        bail!("truncated protobuf field");
+    }
+    *buf = &buf[len..];
+    Ok(())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn reading() -> FluxEvent {
+        FluxEvent {
+            event_id: Some("019c9523-08d7-7210-b479-867e167e939d".to_string()),
+            stream: "sensors".to_string(),
+            source: "sensor-01".to_string(),
+            timestamp: 1772028627158,
+            key: Some("zone1".to_string()),
+            schema: Some("temp-v1".to_string()),
+            priority: Some(Priority::High),
+            envelope_version: Some(2),
+            received_at: Some(1772028627203),
+            ttl_ms: Some(60_000),
+            correlation_id: Some("019c9523-0000-7000-8000-000000000001".to_string()),
+            parent_event_id: Some("019c9523-0000-7000-8000-000000000002".to_string()),
+            payload: json!({"entity_id": "sensor-01", "properties": {"t": 22.5}}),
+            raw_payload: None,
+        }
+    }
+
+    #[test]
+    fn test_round_trip() {
+        let event = reading();
+        let decoded = decode(&encode(&event).unwrap()).unwrap();
+
+        assert_eq!(decoded.event_id, event.event_id);
+        assert_eq!(decoded.stream, event.stream);
+        assert_eq!(decoded.source, event.source);
+        assert_eq!(decoded.timestamp, event.timestamp);
+        assert_eq!(decoded.key, event.key);
+        assert_eq!(decoded.schema, event.schema);
+        assert_eq!(decoded.priority, event.priority);
+        assert_eq!(decoded.envelope_version, Some(2));
+        assert_eq!(decoded.received_at, event.received_at);
+        assert_eq!(decoded.ttl_ms, event.ttl_ms);
+        assert_eq!(decoded.correlation_id, event.correlation_id);
+        assert_eq!(decoded.parent_event_id, event.parent_event_id);
+        assert_eq!(decoded.payload, event.payload);
+    }
+
+    /// The bytes of field 8 in an encoded event.
+    fn payload_field(mut buf: &[u8]) -> Vec<u8> {
+        while !buf.is_empty() {
+            let tag = get_varint(&mut buf).unwrap();
+            if tag == ((FIELD_PAYLOAD as u64) << 3) | WIRE_LEN as u64 {
+                return get_bytes(&mut buf).unwrap().to_vec();
+            }
+            skip_field(&mut buf, (tag & 0x7) as u8).unwrap();
+        }
+        panic!("no payload field");
+    }
+
+    #[test]
+    fn test_payload_bytes_preserved() {
+        // Unsorted keys, spacing and number formats serde_json would rewrite
+        let payload = r#"{ "zone": "b",  "entity_id": "sensor-01",
+            "properties": {"t": 22.50, "limit": 1e3, "raw": [1 , 2]} }"#;
+        let input = format!(
+            r#"{{"stream": "sensors", "source": "sensor-01", "timestamp": 1772028627158, "payload": {}}}"#,
+            payload
+        );
+        let event = FluxEvent::from_json_slice(input.as_bytes()).unwrap();
+
+        let encoded = encode(&event).unwrap();
+        assert_eq!(payload_field(&encoded), payload.as_bytes());
+
+        // Decoding keeps them for the next encode
+        let decoded = decode(&encoded).unwrap();
+        assert_eq!(decoded.payload, event.payload);
+        assert_eq!(
+            payload_field(&encode(&decoded).unwrap()),
+            payload.as_bytes()
+        );
+    }
+
+    #[test]
+    fn test_changed_payload_reserialized() {
+        let input = r#"{"stream": "sensors", "source": "sensor-01", "timestamp": 1,
+            "payload": {"b": 1.50, "a": 2}}"#;
+        let mut event = FluxEvent::from_json_slice(input.as_bytes()).unwrap();
+        event.payload["c"] = json!(3);
+
+        let encoded = encode(&event).unwrap();
+        assert_eq!(payload_field(&encoded), br#"{"a":2,"b":1.5,"c":3}"#);
+        assert_eq!(decode(&encoded).unwrap().payload, event.payload);
+    }
+
+    #[test]
+    fn test_optional_fields_omitted() {
+        let mut event = reading();
+        event.key = None;
+        event.schema = None;
+        event.priority = None;
+        event.envelope_version = None;
+        event.received_at = None;
+        event.ttl_ms = None;
+        event.correlation_id = None;
+        event.parent_event_id = None;
+
+        let decoded = decode(&encode(&event).unwrap()).unwrap();
+        assert_eq!(decoded.key, None);
+        assert_eq!(decoded.schema, None);
+        assert_eq!(decoded.priority, None);
+        assert_eq!(decoded.envelope_version, None);
+        assert_eq!(decoded.received_at, None);
+        assert_eq!(decoded.ttl_ms, None);
+        assert_eq!(decoded.correlation_id, None);
+        assert_eq!(decoded.parent_event_id, None);
+    }
+
+    #[test]
+    fn test_unknown_fields_skipped() {
+        let mut buf = encode(&reading()).unwrap();
+        put_tag(&mut buf, 42, WIRE_VARINT);
+        put_varint(&mut buf, 7);
+        put_bytes(&mut buf, 43, b"future");
+
+        assert_eq!(decode(&buf).unwrap().stream, "sensors");
+    }
+
+    #[test]
+    fn test_truncated_input_rejected() {
+        let buf = encode(&reading()).unwrap();
+        assert!(decode(&buf[..buf.len() - 3]).is_err());
+    }
+
+    #[test]
+    fn test_smaller_than_json() {
+        let event = reading();
+        let json_len = serde_json::to_vec(&event).unwrap().len();
+        let proto_len = encode(&event).unwrap().len();
+        assert!(proto_len < json_len, "proto {} >= json {}", proto_len, json_len);
+    }
+}
@@ -1,55 +1,1512 @@
-use crate::event::FluxEvent;
+use super::admission::PublishAdmission;
+use super::archive::archived_stream_for;
+use super::client::route;
+use super::codec::{encode_event, EventEncoding};
+use super::enrichment::{self, IngestApi};
+use super::event_index::{EventIndex, EventIndexEntry};
+use super::idempotency::IdempotencyCache;
+use super::sampling::Sampler;
+use super::subject::{high_priority_subject, stream_subject, subject_matches};
+use super::ttl_purge::TtlPurger;
+use crate::clock::{self, SharedClock};
+use crate::event::{
+    FluxEvent, SharedValidationOptions, StreamNamingPolicy, ValidationError, ValidationOptions,
+};
+use crate::source::SourceRegistry;
+use crate::state::{LagMetrics, PublishMetrics, StorageMetrics};
 use anyhow::{Context, Result};
 use async_nats::jetstream;
-use tracing::debug;
+use async_nats::jetstream::context::{
+    GetStreamByNameErrorKind, PublishAckFuture, PublishErrorKind,
+};
+use serde::Deserialize;
+use std::collections::HashMap;
+use std::fmt;
+use std::future::Future;
+use std::sync::{Arc, Mutex, RwLock};
+use std::time::{Duration, Instant};
+use tracing::{debug, info, warn};
+
+/// NATS header carrying the event priority, for consumers that don't split subjects
+pub const PRIORITY_HEADER: &str = "Flux-Priority";
+
+/// How long a stream depth reading is trusted before re-querying JetStream
+const STREAM_DEPTH_CACHE_TTL: Duration = Duration::from_secs(5);
+
+/// Deadline for a publish and its ack unless `with_publish_timeout` is set
+/// (matches the JetStream context's own ack timeout)
+pub const DEFAULT_PUBLISH_TIMEOUT: Duration = Duration::from_secs(5);
+
+/// Computes the NATS subject an event is published on (see
+/// `EventPublisher::with_subject_mapping`).
+pub type SubjectMapping = Arc<dyn Fn(&FluxEvent) -> String + Send + Sync>;
+
+/// Where JetStream stored a published event.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct PublishAck {
+    /// Stream sequence of the stored message
+    pub sequence: u64,
+    /// True if the event was found in the idempotency cache and not sent again
+    pub cached: bool,
+}
+
+/// How a publish waits for JetStream to confirm the event.
+#[derive(Clone, Copy, Debug, Default, PartialEq, Eq, Hash, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum AckMode {
+    /// Wait for the JetStream ack (at least once)
+    #[default]
+    Explicit,
+    /// Return once sent; the ack is awaited in the background
+    /// (`PublishReceipt::Pending`)
+    Async,
+    /// Publish on the core NATS connection without an ack: at most once.
+    /// Events are lost if no stream captures the subject or the server
+    /// drops them, and nothing reports it.
+    None,
+}
+
+impl AckMode {
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            AckMode::Explicit => "explicit",
+            AckMode::Async => "async",
+            AckMode::None => "none",
+        }
+    }
+}
+
+/// Ack of an `AckMode::Async` publish that JetStream has not confirmed yet.
+///
+/// The ack is awaited in a background task, which also records the event
+/// (idempotency cache, index, metrics) once acked; dropping the handle does
+/// not cancel it, and a failure is then only logged.
+pub struct PendingAck {
+    subject: String,
+    handle: tokio::task::JoinHandle<Result<PublishAck>>,
+}
+
+impl PendingAck {
+    /// Subject the event was published on
+    pub fn subject(&self) -> &str {
+        &self.subject
+    }
+
+    /// Wait for the ack, failing as `publish` would (e.g.
+    /// `PublishTimeoutError`, `PublishError`).
+    pub async fn wait(self) -> Result<PublishAck> {
+        self.handle.await.context("Publish ack task failed")?
+    }
+}
+
+/// Outcome of `EventPublisher::publish_with_mode`, by ack mode.
+pub enum PublishReceipt {
+    /// `AckMode::Explicit`: stored (or found in the idempotency cache)
+    Acked(PublishAck),
+    /// `AckMode::Async`: sent, ack pending
+    Pending(PendingAck),
+    /// `AckMode::None`: sent, so there is no stream sequence
+    Sent,
+}
+
+impl PublishReceipt {
+    fn into_ack(self) -> Option<PublishAck> {
+        match self {
+            PublishReceipt::Acked(ack) => Some(ack),
+            PublishReceipt::Pending(_) | PublishReceipt::Sent => None,
+        }
+    }
+
+    /// Stream sequence of the stored event; only known for `Acked`
+    pub fn sequence(&self) -> Option<u64> {
+        match self {
+            PublishReceipt::Acked(ack) => Some(ack.sequence),
+            PublishReceipt::Pending(_) | PublishReceipt::Sent => None,
+        }
+    }
+}
+
+/// Sizes and start time of a sent event, for the metrics recorded once it
+/// is published.
+#[derive(Clone, Copy)]
+struct SentEvent {
+    raw_len: usize,
+    stored_len: usize,
+    compressed: bool,
+    started: Instant,
+}
+
+/// Returned when the stream already holds `max_messages` or more messages.
+#[derive(Debug, Clone, PartialEq)]
+pub struct StreamFullError {
+    pub stream: String,
+    pub messages: u64,
+    pub max_messages: u64,
+}
+
+impl fmt::Display for StreamFullError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "stream '{}' is full ({} messages, limit {})",
+            self.stream, self.messages, self.max_messages
+        )
+    }
+}
+
+impl std::error::Error for StreamFullError {}
+
+/// Returned when no JetStream stream subject captures an event's subject.
+#[derive(Debug, Clone, PartialEq)]
+pub struct SubjectNotCapturedError {
+    pub subject: String,
+    pub stream_subjects: Vec<String>,
+}
+
+impl fmt::Display for SubjectNotCapturedError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        // Found by asking the server (`with_stream_cache`), not a subject list
+        if self.stream_subjects.is_empty() {
+            return write!(
+                f,
+                "subject '{}' is not captured by any JetStream stream",
+                self.subject
+            );
+        }
+        write!(
+            f,
+            "subject '{}' is not captured by the stream subjects [{}]",
+            self.subject,
+            self.stream_subjects.join(", ")
+        )
+    }
+}
+
+impl std::error::Error for SubjectNotCapturedError {}
+
+/// Returned when JetStream did not acknowledge a publish within its deadline.
+/// The event may still have been stored.
+#[derive(Debug, Clone, PartialEq)]
+pub struct PublishTimeoutError {
+    pub subject: String,
+    pub timeout: Duration,
+}
+
+impl fmt::Display for PublishTimeoutError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "publish to '{}' not acknowledged within {:?}",
+            self.subject, self.timeout
+        )
+    }
+}
+
+impl std::error::Error for PublishTimeoutError {}
+
+/// Returned when an encoded event (payload plus NATS headers) is larger than
+/// the server accepts, either caught before sending (`with_max_payload`) or
+/// classified from the server's rejection.
+#[derive(Debug, Clone, PartialEq)]
+pub struct PayloadTooLargeError {
+    pub subject: String,
+    /// Payload plus serialized header bytes
+    pub size: usize,
+    /// The limit exceeded, if the publisher knows it
+    pub max: Option<usize>,
+}
+
+impl fmt::Display for PayloadTooLargeError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self.max {
+            Some(max) => write!(
+                f,
+                "event for '{}' is {} bytes, larger than the {} bytes NATS accepts",
+                self.subject, self.size, max
+            ),
+            None => write!(
+                f,
+                "event for '{}' is {} bytes, larger than NATS accepts",
+                self.subject, self.size
+            ),
+        }
+    }
+}
+
+impl std::error::Error for PayloadTooLargeError {}
+
+/// Returned when JetStream rejects a publish or it fails before an ack
+/// (no stream captures the subject, connection lost). Timeouts are
+/// `PublishTimeoutError` instead.
+#[derive(Debug)]
+pub struct PublishError {
+    pub subject: String,
+    pub source: anyhow::Error,
+}
+
+impl fmt::Display for PublishError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "failed to publish to '{}': {:#}", self.subject, self.source)
+    }
+}
+
+impl std::error::Error for PublishError {
+    fn source(&self) -> Option<&(dyn std::error::Error + 'static)> {
+        Some(self.source.as_ref())
+    }
+}
+
+/// Max depth guard with a short-lived cache of the stream's message count.
+struct DepthLimit {
+    stream_name: String,
+    max_messages: u64,
+    cached: Mutex<Option<(Instant, u64)>>,
+    /// Held while re-querying the stream, so one caller refreshes the cache
+    /// and the others wait for its reading
+    refresh: tokio::sync::Mutex<()>,
+}
+
+impl DepthLimit {
+    fn new(stream_name: String, max_messages: u64) -> Self {
+        Self {
+            stream_name,
+            max_messages,
+            cached: Mutex::new(None),
+            refresh: tokio::sync::Mutex::new(()),
+        }
+    }
+
+    fn fresh(&self) -> Option<u64> {
+        self.cached
+            .lock()
+            .unwrap()
+            .filter(|(at, _)| at.elapsed() < STREAM_DEPTH_CACHE_TTL)
+            .map(|(_, messages)| messages)
+    }
+
+    /// Cached message count, calling `query` when it is stale. Concurrent
+    /// callers share a single query instead of each hitting JetStream.
+    async fn messages<F, Fut>(&self, query: F) -> Result<u64>
+    where
+        F: FnOnce() -> Fut,
+        Fut: Future<Output = Result<u64>>,
+    {
+        if let Some(messages) = self.fresh() {
+            return Ok(messages);
+        }
+        let _refresh = self.refresh.lock().await;
+        // Refreshed by another caller while we waited
+        if let Some(messages) = self.fresh() {
+            return Ok(messages);
+        }
+        let messages = query().await?;
+        *self.cached.lock().unwrap() = Some((Instant::now(), messages));
+        Ok(messages)
+    }
+}
+
+/// Flux streams known to have a JetStream stream capturing their subject,
+/// and when that was last confirmed.
+struct StreamCache {
+    ttl: Duration,
+    confirmed: Mutex<HashMap<String, Instant>>,
+}
+
+impl StreamCache {
+    fn fresh(&self, stream: &str) -> bool {
+        self.confirmed
+            .lock()
+            .unwrap()
+            .get(stream)
+            .map_or(false, |at| at.elapsed() < self.ttl)
+    }
+
+    fn confirm(&self, stream: &str) {
+        self.confirmed
+            .lock()
+            .unwrap()
+            .insert(stream.to_string(), Instant::now());
+    }
+}
 
 /// Event publisher for NATS JetStream
+///
+/// One publisher (or its clones, which share all state) may be used from any
+/// number of tasks at once. Shared state is synchronized: the depth cache,
+/// samplers, idempotency cache and metrics are behind mutexes or atomics,
+/// and a stale depth reading is refreshed by one caller while concurrent
+/// callers wait for it. Publishes from different tasks are not ordered
+/// relative to each other. The idempotency cache only covers retries made
+/// after the first publish returned; two concurrent publishes of the same
+/// eventId may both be stored.
 #[derive(Clone)]
 pub struct EventPublisher {
     jetstream: jetstream::Context,
+    core_client: Option<async_nats::Client>,
+    targets: Vec<(String, jetstream::Context)>,
+    depth_limit: Option<Arc<DepthLimit>>,
+    stream_cache: Option<Arc<StreamCache>>,
+    source_registry: Option<Arc<SourceRegistry>>,
+    require_registered_source: bool,
+    validation: SharedValidationOptions,
+    /// Flux's own publisher: reserved stream prefixes are allowed
+    internal: bool,
+    stream_subjects: Option<Vec<String>>,
+    subject_mapping: Option<SubjectMapping>,
+    lag_metrics: Option<LagMetrics>,
+    encoding: EventEncoding,
+    compress_above: Option<usize>,
+    max_msg_size: Option<usize>,
+    max_payload: Option<usize>,
+    storage_metrics: Option<StorageMetrics>,
+    publish_metrics: Option<PublishMetrics>,
+    admission: Option<PublishAdmission>,
+    samplers: HashMap<String, Arc<Sampler>>,
+    event_index: Option<Arc<EventIndex>>,
+    ttl_purger: Option<Arc<TtlPurger>>,
+    idempotency: Option<Arc<IdempotencyCache>>,
+    deduplicate: bool,
+    instance_id: Option<String>,
+    ingest_api: IngestApi,
+    embed_received_at: bool,
+    clock: SharedClock,
+    publish_timeout: Duration,
+    ack_mode: AckMode,
+    dry_run: bool,
 }
 
 impl EventPublisher {
     /// Create a new event publisher
     pub fn new(jetstream: jetstream::Context) -> Self {
-        Self { jetstream }
+        Self {
+            jetstream,
+            core_client: None,
+            targets: Vec::new(),
+            depth_limit: None,
+            stream_cache: None,
+            source_registry: None,
+            require_registered_source: false,
+            validation: SharedValidationOptions::default(),
+            internal: false,
+            stream_subjects: None,
+            subject_mapping: None,
+            lag_metrics: None,
+            encoding: EventEncoding::Json,
+            compress_above: None,
+            max_msg_size: None,
+            max_payload: None,
+            storage_metrics: None,
+            publish_metrics: None,
+            admission: None,
+            samplers: HashMap::new(),
+            event_index: None,
+            ttl_purger: None,
+            idempotency: None,
+            deduplicate: false,
+            instance_id: None,
+            ingest_api: IngestApi::Internal,
+            embed_received_at: false,
+            clock: clock::system(),
+            publish_timeout: DEFAULT_PUBLISH_TIMEOUT,
+            ack_mode: AckMode::Explicit,
+            dry_run: false,
+        }
+    }
+
+    /// Ack mode of `publish`, `publish_with_timeout` and `publish_batch`
+    /// (default `Explicit`); `publish_with_mode` overrides it per event.
+    /// `AckMode::None` needs `with_core_client`.
+    pub fn with_ack_mode(mut self, mode: AckMode) -> Self {
+        self.ack_mode = mode;
+        self
+    }
+
+    /// Core NATS connection for `AckMode::None` publishes, normally the one
+    /// the JetStream context uses (`NatsClient::client`).
+    pub fn with_core_client(mut self, client: async_nats::Client) -> Self {
+        self.core_client = Some(client);
+        self
+    }
+
+    /// Deadline for `publish` (publish plus ack); `publish_with_timeout`
+    /// overrides it per event.
+    pub fn with_publish_timeout(mut self, timeout: Duration) -> Self {
+        self.publish_timeout = timeout;
+        self
+    }
+
+    /// Run every check and encode each event, but never send it to NATS
+    /// (e.g. to validate event construction in CI). `publish` succeeds
+    /// without touching the stream, and sampling is skipped so every event is
+    /// checked. The stream depth check is skipped too, as it queries NATS.
+    pub fn with_dry_run(mut self, enabled: bool) -> Self {
+        self.dry_run = enabled;
+        self
+    }
+
+    /// True if this publisher validates without publishing (`with_dry_run`).
+    pub fn is_dry_run(&self) -> bool {
+        self.dry_run
+    }
+
+    /// Read publish time (for ingest lag) from `clock` instead of the system clock.
+    pub fn with_clock(mut self, clock: SharedClock) -> Self {
+        self.clock = clock;
+        self
+    }
+
+    /// Record `flux_event_ingest_lag_seconds` (publish time minus event timestamp).
+    pub fn with_lag_metrics(mut self, lag_metrics: LagMetrics) -> Self {
+        self.lag_metrics = Some(lag_metrics);
+        self
+    }
+
+    /// Envelope encoding for published events (JSON by default).
+    ///
+    /// Protobuf messages carry `Content-Type: application/x-protobuf`;
+    /// consumers using `nats::decode_event` read both encodings.
+    pub fn with_encoding(mut self, encoding: EventEncoding) -> Self {
+        self.encoding = encoding;
+        self
+    }
+
+    /// Gzip events whose serialized envelope exceeds `threshold_bytes`.
+    ///
+    /// Compressed messages carry `Content-Encoding: gzip`; use
+    /// `nats::decode_event` to read them back.
+    pub fn with_compression(mut self, threshold_bytes: usize) -> Self {
+        self.compress_above = Some(threshold_bytes);
+        self
+    }
+
+    /// Reject events whose encoded (and possibly compressed) envelope exceeds
+    /// `bytes` with `ValidationError::PayloadTooLarge`, before calling NATS.
+    /// Set to the stream's `max_msg_size`; routed streams are not checked.
+    pub fn with_max_msg_size(mut self, bytes: usize) -> Self {
+        self.max_msg_size = Some(bytes);
+        self
+    }
+
+    /// Reject events whose payload plus headers exceed `bytes` with
+    /// `PayloadTooLargeError`, before calling NATS. Set to the server's
+    /// `max_payload` (`Client::server_info`); routed streams are not checked.
+    pub fn with_max_payload(mut self, bytes: usize) -> Self {
+        self.max_payload = Some(bytes);
+        self
+    }
+
+    /// Record raw vs stored bytes for each published event.
+    pub fn with_storage_metrics(mut self, storage_metrics: StorageMetrics) -> Self {
+        self.storage_metrics = Some(storage_metrics);
+        self
+    }
+
+    /// Count each acknowledged publish by stream, for publish rates.
+    pub fn with_publish_metrics(mut self, publish_metrics: PublishMetrics) -> Self {
+        self.publish_metrics = Some(publish_metrics);
+        self
+    }
+
+    /// Limit concurrent publishes from the HTTP API and NATS service to
+    /// `admission`'s slots. Publishes over the limit queue, then fail with
+    /// `AdmissionRejectedError` once the queue is full; clones (`for_api`)
+    /// share the slots. Flux's own publishes are never limited.
+    pub fn with_admission(mut self, admission: PublishAdmission) -> Self {
+        self.admission = Some(admission);
+        self
+    }
+
+    /// Record eventId → stream sequence in `index` after each publish.
+    ///
+    /// Index writes run in the background and never fail the publish; failures
+    /// are logged and counted in the storage metrics.
+    pub fn with_event_index(mut self, index: Arc<EventIndex>) -> Self {
+        self.event_index = Some(index);
+        self
+    }
+
+    /// Schedule events with a TTL on the purger's streams for purging once
+    /// they expire. Their TTL must be shorter than the stream's retention.
+    ///
+    /// Only events published to the default stream are scheduled. A failed
+    /// schedule is logged and never fails the publish.
+    pub fn with_ttl_purger(mut self, purger: Arc<TtlPurger>) -> Self {
+        self.ttl_purger = Some(purger);
+        self
+    }
+
+    /// Remember the stream sequence of the last `size` published eventIds
+    /// (least recently used evicted first). Publishing an id again while it
+    /// is cached returns the original `PublishAck` (with `cached` set)
+    /// without sending anything, so retries after a lost ack are safe
+    /// beyond the stream's duplicate window. Clones share the cache.
+    pub fn with_idempotency_cache(mut self, size: usize) -> Self {
+        self.idempotency = Some(Arc::new(IdempotencyCache::new(size)));
+        self
+    }
+
+    /// Send each event's eventId as `Nats-Msg-Id`, so JetStream stores an
+    /// event published again within the stream's duplicate window only once
+    /// and acks the repeat with the original sequence. Retries after the
+    /// window are stored again; see `NatsConfig::duplicate_window_seconds`.
+    pub fn with_deduplication(mut self, enabled: bool) -> Self {
+        self.deduplicate = enabled;
+        self
+    }
+
+    /// Publish only a sample of the events on `stream` (exact match).
+    ///
+    /// Dropped events still succeed from the caller's point of view (they
+    /// already have an event ID) and are counted in `Sampler::dropped_total`.
+    pub fn with_sampling(mut self, stream: impl Into<String>, sampler: Sampler) -> Self {
+        self.samplers.insert(stream.into(), Arc::new(sampler));
+        self
+    }
+
+    /// Sampler configured for `stream`, if any
+    pub fn sampler(&self, stream: &str) -> Option<&Sampler> {
+        self.samplers.get(stream).map(|s| s.as_ref())
+    }
+
+    /// Check event sources against `registry`.
+    ///
+    /// With `require_registered` set, events from unknown, deactivated or
+    /// out-of-scope sources fail with `SourceRejectedError`; otherwise they are
+    /// published and a warning is logged.
+    pub fn with_source_registry(
+        mut self,
+        registry: Arc<SourceRegistry>,
+        require_registered: bool,
+    ) -> Self {
+        self.source_registry = Some(registry);
+        self.require_registered_source = require_registered;
+        self
+    }
+
+    /// Apply `options` (source allow-list, source length and format) to
+    /// every publish.
+    ///
+    /// Rejected events fail with `ValidationError` before anything is sent.
+    /// In lenient source format mode, events are published with their
+    /// source normalized.
+    pub fn with_validation(mut self, options: ValidationOptions) -> Self {
+        self.validation = Arc::new(RwLock::new(options));
+        self
+    }
+
+    /// Like `with_validation`, but read from `options` on every publish, so
+    /// replacing its contents (`ConfigReloader`) applies to this publisher
+    /// and all its copies at once.
+    pub fn with_shared_validation(mut self, options: SharedValidationOptions) -> Self {
+        self.validation = options;
+        self
+    }
+
+    /// Normalize `event`'s source as publishing it would (lenient source
+    /// format mode only), returning true if it changed. Lets callers use the
+    /// normalized source before publishing (authorization, rate limits) and
+    /// tell the producer.
+    pub fn normalize_source(&self, event: &mut FluxEvent) -> bool {
+        self.with_validation_options(|options| options.normalize_source(event))
+    }
+
+    /// Run `f` with the current validation options (with reserved prefixes
+    /// allowed for an internal publisher).
+    fn with_validation_options<R>(&self, f: impl FnOnce(&ValidationOptions) -> R) -> R {
+        let options = self
+            .validation
+            .read()
+            .expect("ValidationOptions lock poisoned");
+        if self.internal {
+            f(&options.internal())
+        } else {
+            f(&options)
+        }
+    }
+
+    /// Change this publisher's validation options without touching options
+    /// shared with earlier copies.
+    fn update_validation(mut self, update: impl FnOnce(&mut ValidationOptions)) -> Self {
+        let mut options = self
+            .validation
+            .read()
+            .expect("ValidationOptions lock poisoned")
+            .clone();
+        update(&mut options);
+        self.validation = Arc::new(RwLock::new(options));
+        self
+    }
+
+    /// Accept only sources matching one of `patterns` (exact or glob, e.g.
+    /// `plant-*.scada`); others fail with `ValidationError::SourceNotAllowed`.
+    pub fn with_source_allow_list<I, S>(self, patterns: I) -> Self
+    where
+        I: IntoIterator<Item = S>,
+        S: Into<String>,
+    {
+        let patterns = patterns.into_iter().map(Into::into).collect();
+        self.update_validation(|options| options.allowed_sources = patterns)
+    }
+
+    /// Reject events whose timestamp is more than `max_skew` before or after
+    /// now with `ValidationError::TimestampSkewed`. Off by default.
+    pub fn with_timestamp_normalization(self, max_skew: Duration) -> Self {
+        self.update_validation(|options| {
+            options.max_timestamp_skew_backward = Some(max_skew);
+            options.max_timestamp_skew_forward = Some(max_skew);
+        })
+    }
+
+    /// Reject streams outside `policy` (reserved prefixes, pattern, segment
+    /// count) with `ValidationError::StreamReserved` / `StreamNamingPolicy`.
+    pub fn with_stream_naming(self, policy: StreamNamingPolicy) -> Self {
+        self.update_validation(|options| options.stream_naming = policy)
+    }
+
+    /// Copy of this publisher for Flux's own events (health, audit, alerts),
+    /// allowed to publish under reserved stream prefixes.
+    pub fn internal(&self) -> Self {
+        let mut publisher = self.clone();
+        publisher.internal = true;
+        publisher.ingest_api = IngestApi::Internal;
+        publisher
+    }
+
+    /// This publisher, stamping `api` in the `x-flux-api` header. New
+    /// publishers stamp `internal`; the HTTP API and NATS service use their
+    /// own copies.
+    pub fn for_api(&self, api: IngestApi) -> Self {
+        let mut publisher = self.clone();
+        publisher.ingest_api = api;
+        publisher
+    }
+
+    /// Stamp `instance_id` in the `x-flux-instance` header of every event.
+    pub fn with_instance_id(mut self, instance_id: impl Into<String>) -> Self {
+        self.instance_id = Some(instance_id.into());
+        self
+    }
+
+    /// Also write the `x-flux-received-at` time into the event's
+    /// `receivedAt` field (replacing any producer value), so it survives
+    /// exports that drop NATS headers.
+    pub fn with_embed_received_at(mut self, embed: bool) -> Self {
+        self.embed_received_at = embed;
+        self
+    }
+
+    /// Publish streams under `stream_prefix` through `jetstream` (another
+    /// JetStream domain or API prefix) instead of the default context.
+    ///
+    /// The stream subject and depth checks, and the event index, describe the
+    /// default stream and are skipped for routed events.
+    pub fn with_target(
+        mut self,
+        stream_prefix: impl Into<String>,
+        jetstream: jetstream::Context,
+    ) -> Self {
+        self.targets.push((stream_prefix.into(), jetstream));
+        self
+    }
+
+    /// Refuse events whose subject none of `subjects` (the JetStream stream's
+    /// subjects) captures, instead of failing with "no responders" from NATS.
+    pub fn with_stream_subjects(mut self, subjects: Vec<String>) -> Self {
+        self.stream_subjects = Some(subjects);
+        self
+    }
+
+    /// Publish each event on the subject `mapping` returns instead of
+    /// `flux.events.{stream}` (plus `.p.high` for high/critical events), e.g.
+    /// to split one stream into per-zone subjects by key.
+    ///
+    /// The subject must be captured by one of the target JetStream stream's
+    /// subjects; set `with_stream_subjects` to have uncaptured subjects fail
+    /// with `SubjectNotCapturedError` before publishing. The mapping replaces
+    /// the priority suffix too, so it should add one if consumers rely on it.
+    pub fn with_subject_mapping<F>(mut self, mapping: F) -> Self
+    where
+        F: Fn(&FluxEvent) -> String + Send + Sync + 'static,
+    {
+        self.subject_mapping = Some(Arc::new(mapping));
+        self
+    }
+
+    /// Subject `event` is published on.
+    pub fn subject_for(&self, event: &FluxEvent) -> String {
+        match &self.subject_mapping {
+            Some(mapping) => mapping(event),
+            None => event_subject(event),
+        }
+    }
+
+    fn check_subject(&self, subject: &str) -> Result<()> {
+        let Some(subjects) = &self.stream_subjects else {
+            return Ok(());
+        };
+        if subjects
+            .iter()
+            .any(|pattern| subject_matches(pattern, subject))
+        {
+            return Ok(());
+        }
+        Err(SubjectNotCapturedError {
+            subject: subject.to_string(),
+            stream_subjects: subjects.clone(),
+        }
+        .into())
+    }
+
+    fn check_source(&self, event: &FluxEvent) -> Result<()> {
+        self.with_validation_options(|options| options.check(event))?;
+        let Some(registry) = &self.source_registry else {
+            return Ok(());
+        };
+        match registry.check(event) {
+            Ok(()) => Ok(()),
+            Err(e) if self.require_registered_source => Err(e.into()),
+            Err(e) => {
+                warn!(source = %event.source, stream = %event.stream, "{}", e);
+                Ok(())
+            }
+        }
+    }
+
+    /// Refuse to publish once `stream_name` holds `max_messages` messages.
+    ///
+    /// The check is best-effort: the message count is cached for 5 seconds
+    /// and a failed lookup lets the publish through.
+    pub fn with_max_stream_depth(
+        mut self,
+        stream_name: impl Into<String>,
+        max_messages: u64,
+    ) -> Self {
+        self.depth_limit = Some(Arc::new(DepthLimit::new(stream_name.into(), max_messages)));
+        self
+    }
+
+    /// Before publishing, check with the server that a JetStream stream
+    /// captures the event's subject, failing with `SubjectNotCapturedError`
+    /// if none does. Flux streams confirmed within `ttl` skip the lookup
+    /// (`Duration::ZERO` looks up every publish); `warm_up` confirms them
+    /// ahead of the first publish.
+    ///
+    /// Without it publishes are not looked up, and JetStream rejects those
+    /// no stream captures.
+    pub fn with_stream_cache(mut self, ttl: Duration) -> Self {
+        self.stream_cache = Some(Arc::new(StreamCache {
+            ttl,
+            confirmed: Mutex::new(HashMap::new()),
+        }));
+        self
+    }
+
+    /// Do the one-off work of a first publish ahead of time, so it does not
+    /// add to a cold process's first publish latency: a JetStream request on
+    /// each context `streams` publish through (the client sets up its
+    /// response subscription on the first one), the stream lookup of
+    /// `with_stream_cache` and the depth query of `with_max_stream_depth`.
+    ///
+    /// Fails with `SubjectNotCapturedError` for a Flux stream whose subject
+    /// (`flux.events.{stream}`) no JetStream stream captures. Flux streams
+    /// need no creating; the JetStream streams holding them are created at
+    /// startup (`NatsClient::connect`).
+    pub async fn warm_up(&self, streams: &[&str]) -> Result<()> {
+        for stream in streams {
+            let jetstream = route(&self.targets, stream).unwrap_or(&self.jetstream);
+            self.lookup_stream(jetstream, stream, &stream_subject(stream))
+                .await?;
+        }
+        if let Some(limit) = &self.depth_limit {
+            limit
+                .messages(|| self.query_stream_depth(&limit.stream_name))
+                .await?;
+        }
+        debug!(streams = streams.len(), "Publisher warmed up");
+        Ok(())
+    }
+
+    /// Return `SubjectNotCapturedError` if `with_stream_cache` is set and no
+    /// JetStream stream captures `subject`.
+    async fn check_stream_exists(
+        &self,
+        jetstream: &jetstream::Context,
+        event: &FluxEvent,
+        subject: &str,
+    ) -> Result<()> {
+        match &self.stream_cache {
+            Some(cache) if !cache.fresh(&event.stream) => {
+                self.lookup_stream(jetstream, &event.stream, subject).await
+            }
+            _ => Ok(()),
+        }
+    }
+
+    /// Ask the server which stream captures `subject`, confirming the Flux
+    /// `stream` in the cache (when enabled) if one does.
+    async fn lookup_stream(
+        &self,
+        jetstream: &jetstream::Context,
+        stream: &str,
+        subject: &str,
+    ) -> Result<()> {
+        match jetstream.stream_by_subject(subject).await {
+            Ok(_) => {
+                if let Some(cache) = &self.stream_cache {
+                    cache.confirm(stream);
+                }
+                Ok(())
+            }
+            Err(e) if e.kind() == GetStreamByNameErrorKind::NotFound => {
+                Err(SubjectNotCapturedError {
+                    subject: subject.to_string(),
+                    stream_subjects: Vec::new(),
+                }
+                .into())
+            }
+            Err(e) => Err(anyhow::Error::new(e).context("Failed to look up JetStream stream")),
+        }
+    }
+
+    /// Return `StreamFullError` if the configured depth limit is reached.
+    async fn check_stream_depth(&self) -> Result<()> {
+        let Some(limit) = &self.depth_limit else {
+            return Ok(());
+        };
+
+        let messages = match limit
+            .messages(|| self.query_stream_depth(&limit.stream_name))
+            .await
+        {
+            Ok(messages) => messages,
+            Err(e) => {
+                warn!(error = %e, stream = %limit.stream_name, "Stream depth check failed, allowing publish");
+                return Ok(());
+            }
+        };
+
+        if messages >= limit.max_messages {
+            return Err(StreamFullError {
+                stream: limit.stream_name.clone(),
+                messages,
+                max_messages: limit.max_messages,
+            }
+            .into());
+        }
+        Ok(())
+    }
+
+    async fn query_stream_depth(&self, stream_name: &str) -> Result<u64> {
+        let mut stream = self.jetstream.get_stream(stream_name).await?;
+        Ok(stream.info().await?.state.messages)
+    }
+
+    /// Count a successful publish against the cached depth until the next refresh.
+    fn record_published(&self) {
+        if let Some(limit) = &self.depth_limit {
+            if let Some((_, messages)) = limit.cached.lock().unwrap().as_mut() {
+                *messages += 1;
+            }
+        }
     }
 
     /// Publish a single event to NATS
     ///
-    /// Subject format: flux.events.{stream}
-    /// Payload: JSON-serialized FluxEvent
+    /// Subject format: flux.events.{stream} (flux.events.{stream}.p.high for
+    /// high/critical events) unless a subject mapping is set
+    /// Headers: Flux-Priority, x-flux-received-at, x-flux-api, x-flux-instance
+    /// (when set), Content-Type (protobuf only), Content-Encoding (when
+    /// compressed)
+    /// Payload: JSON or protobuf FluxEvent, gzipped above the compression threshold
+    ///
+    /// Waits for the ack unless the publisher's ack mode says otherwise
+    /// (`with_ack_mode`).
     pub async fn publish(&self, event: &FluxEvent) -> Result<()> {
-        let subject = format!("flux.events.{}", event.stream);
-        let payload = serde_json::to_vec(event)
-            .context("Failed to serialize event to JSON")?;
+        self.publish_with_timeout(event, self.publish_timeout).await
+    }
+
+    /// Publish with a deadline for this event only, e.g. 100ms for an alarm
+    /// that is useless if late, or several seconds for a bulk backfill.
+    ///
+    /// Fails with `PublishTimeoutError` if JetStream has not acknowledged the
+    /// event within `timeout`; the event may still have been stored.
+    pub async fn publish_with_timeout(&self, event: &FluxEvent, timeout: Duration) -> Result<()> {
+        self.publish_message(event, timeout, &[], self.ack_mode)
+            .await
+            .map(|_| ())
+    }
+
+    /// `publish_with_timeout`, returning where the event was stored. None
+    /// if it was not stored: dropped by sampling, or in dry-run mode.
+    /// Always waits for the ack.
+    pub async fn publish_with_ack(
+        &self,
+        event: &FluxEvent,
+        timeout: Duration,
+    ) -> Result<Option<PublishAck>> {
+        let receipt = self
+            .publish_message(event, timeout, &[], AckMode::Explicit)
+            .await?;
+        Ok(receipt.and_then(PublishReceipt::into_ack))
+    }
+
+    /// Publish with `mode` instead of the publisher's ack mode, e.g.
+    /// `AckMode::None` for high-volume telemetry where an occasional loss
+    /// is cheaper than the ack round trip. None if the event was not
+    /// published: dropped by sampling, or in dry-run mode.
+    ///
+    /// Events routed to another JetStream target (`with_target`) always
+    /// wait for the ack.
+    pub async fn publish_with_mode(
+        &self,
+        event: &FluxEvent,
+        mode: AckMode,
+    ) -> Result<Option<PublishReceipt>> {
+        self.publish_message(event, self.publish_timeout, &[], mode)
+            .await
+    }
+
+    /// `publish_with_ack` with the default timeout, adding `headers` to the
+    /// message (e.g. lineage for derived events). The publisher's own
+    /// headers take precedence over these.
+    pub async fn publish_with_headers(
+        &self,
+        event: &FluxEvent,
+        headers: &[(&str, &str)],
+    ) -> Result<Option<PublishAck>> {
+        let receipt = self
+            .publish_message(event, self.publish_timeout, headers, AckMode::Explicit)
+            .await?;
+        Ok(receipt.and_then(PublishReceipt::into_ack))
+    }
 
+    async fn publish_message(
+        &self,
+        event: &FluxEvent,
+        timeout: Duration,
+        extra_headers: &[(&str, &str)],
+        mode: AckMode,
+    ) -> Result<Option<PublishReceipt>> {
+        let normalized;
+        let event = match self.with_validation_options(|options| options.normalized_source(event)) {
+            Some(source) => {
+                normalized = FluxEvent {
+                    source,
+                    ..event.clone()
+                };
+                &normalized
+            }
+            None => event,
+        };
+        self.check_source(event)?;
+        let cache = self
+            .idempotency
+            .as_ref()
+            .zip(event.event_id.as_deref())
+            .filter(|_| !self.dry_run);
+        if let Some((cache, event_id)) = cache {
+            if let Some(sequence) = cache.get(event_id) {
+                debug!(event_id = %event_id, sequence, "Event already published, skipping");
+                return Ok(Some(PublishReceipt::Acked(PublishAck {
+                    sequence,
+                    cached: true,
+                })));
+            }
+        }
+        let subject = self.subject_for(event);
+        let target = route(&self.targets, &event.stream);
+        let ttl_purger = self
+            .ttl_purger
+            .as_ref()
+            .filter(|purger| target.is_none() && purger.applies_to(event));
+        if target.is_none() {
+            self.check_subject(&subject)?;
+        }
+        if let Some(purger) = ttl_purger {
+            purger.check(event)?;
+        }
+        if let Some(sampler) = self.samplers.get(&event.stream).filter(|_| !self.dry_run) {
+            if !sampler.sample() {
+                debug!(
+                    event_id = %event.event_id.as_deref().unwrap_or_default(),
+                    stream = %event.stream,
+                    "Event dropped by sampling"
+                );
+                return Ok(None);
+            }
+        }
+        let admission = self
+            .admission
+            .as_ref()
+            .filter(|_| self.ingest_api != IngestApi::Internal && !self.dry_run);
+        let permit = match admission {
+            Some(admission) => Some(admission.acquire().await?),
+            None => None,
+        };
+        if target.is_none() && !self.dry_run {
+            self.check_stream_depth().await?;
+        }
+        if !self.dry_run {
+            let jetstream = target.unwrap_or(&self.jetstream);
+            self.check_stream_exists(jetstream, event, &subject).await?;
+        }
+
+        let received_at = self.clock.now_millis();
+        let embedded;
+        let event = if self.embed_received_at {
+            let mut with_received_at = FluxEvent {
+                received_at: Some(received_at),
+                ..event.clone()
+            };
+            // receivedAt needs a newer envelope than validation stamped
+            with_received_at.envelope_version = Some(
+                with_received_at
+                    .required_envelope_version()
+                    .max(event.envelope_version()),
+            );
+            embedded = with_received_at;
+            &embedded
+        } else {
+            event
+        };
+
+        let encoded = encode_event(event, self.encoding, self.compress_above)?;
+        if let Some(max) = self.max_msg_size.filter(|_| target.is_none()) {
+            if encoded.payload.len() > max {
+                return Err(ValidationError::PayloadTooLarge(encoded.payload.len()).into());
+            }
+        }
+        let mut headers = encoded.headers_for(event);
+        if let Some(event_id) = event.event_id.as_deref().filter(|_| self.deduplicate) {
+            headers.insert(async_nats::header::NATS_MESSAGE_ID, event_id);
+        }
+        for (name, value) in extra_headers {
+            if headers.get(*name).is_none() {
+                headers.insert(*name, *value);
+            }
+        }
+        enrichment::stamp(
+            &mut headers,
+            received_at,
+            self.instance_id.as_deref(),
+            self.ingest_api,
+        );
+        let stored_len = encoded.payload.len();
+        let message_len = stored_len + headers_len(&headers);
+        if let Some(max) = self.max_payload.filter(|_| target.is_none()) {
+            if message_len > max {
+                return Err(PayloadTooLargeError {
+                    subject,
+                    size: message_len,
+                    max: Some(max),
+                }
+                .into());
+            }
+        }
+
+        if self.dry_run {
+            info!(
+                event_id = %event.event_id.as_deref().unwrap_or_default(),
+                stream = %event.stream,
+                subject = %subject,
+                bytes = stored_len,
+                "[DRY-RUN] Publishing event to NATS"
+            );
+            return Ok(None);
+        }
         debug!(
-            event_id = %event.event_id.as_ref().unwrap(),
+            event_id = %event.event_id.as_deref().unwrap_or("-"),
             stream = %event.stream,
             subject = %subject,
             "Publishing event to NATS"
         );
 
-        self.jetstream
-            .publish(subject.clone(), payload.into())
-            .await
-            .context(format!("Failed to publish event to subject '{}'", subject))?
-            .await
-            .context("Failed to await publish ack")?;
+        let sent = SentEvent {
+            raw_len: encoded.raw_len,
+            stored_len,
+            compressed: encoded.compressed,
+            started: Instant::now(),
+        };
+        let deadline = tokio::time::Instant::now() + timeout;
+        let timed_out = || PublishTimeoutError {
+            subject: subject.clone(),
+            timeout,
+        };
+        let mode = if target.is_some() {
+            AckMode::Explicit
+        } else {
+            mode
+        };
 
-        Ok(())
+        if mode == AckMode::None {
+            let client = self
+                .core_client
+                .as_ref()
+                .context("AckMode::None needs a core NATS client (with_core_client)")?;
+            let publish =
+                client.publish_with_headers(subject.clone(), headers, encoded.payload.into());
+            tokio::time::timeout_at(deadline, publish)
+                .await
+                .map_err(|_| timed_out())?
+                .map_err(|e| PublishError {
+                    subject: subject.clone(),
+                    source: e.into(),
+                })?;
+            self.published(event, &subject, None, mode, sent).await;
+            return Ok(Some(PublishReceipt::Sent));
+        }
+
+        let jetstream = target.unwrap_or(&self.jetstream);
+        let send = jetstream.publish_with_headers(subject.clone(), headers, encoded.payload.into());
+        let ack = match tokio::time::timeout_at(deadline, send).await {
+            Err(_) => return Err(timed_out().into()),
+            Ok(Err(e)) => {
+                let source = anyhow::Error::from(e).context("Failed to send event");
+                return Err(self
+                    .publish_failed(jetstream, &subject, message_len, source)
+                    .await);
+            }
+            Ok(Ok(ack)) => ack,
+        };
+
+        if mode == AckMode::Async {
+            let publisher = self.clone();
+            let (event, jetstream) = (event.clone(), jetstream.clone());
+            let task_subject = subject.clone();
+            let handle = tokio::spawn(async move {
+                // Held until the ack arrives
+                let _permit = permit;
+                let subject = task_subject;
+                let sequence = publisher
+                    .await_ack(&jetstream, &subject, message_len, ack, deadline, timeout)
+                    .await
+                    .inspect_err(|e| {
+                        warn!(error = %e, subject = %subject, "Async publish failed");
+                    })?;
+                Ok(publisher
+                    .published(&event, &subject, Some(sequence), mode, sent)
+                    .await)
+            });
+            return Ok(Some(PublishReceipt::Pending(PendingAck {
+                subject,
+                handle,
+            })));
+        }
+
+        let sequence = self
+            .await_ack(jetstream, &subject, message_len, ack, deadline, timeout)
+            .await?;
+        let ack = self
+            .published(event, &subject, Some(sequence), mode, sent)
+            .await;
+        Ok(Some(PublishReceipt::Acked(ack)))
+    }
+
+    /// Stream sequence from JetStream's ack for a sent event, by `deadline`.
+    async fn await_ack(
+        &self,
+        jetstream: &jetstream::Context,
+        subject: &str,
+        message_len: usize,
+        ack: PublishAckFuture,
+        deadline: tokio::time::Instant,
+        timeout: Duration,
+    ) -> Result<u64> {
+        let ack = tokio::time::timeout_at(deadline, ack).await;
+        let ack = ack.map_err(|_| PublishTimeoutError {
+            subject: subject.to_string(),
+            timeout,
+        })?;
+        match ack.context("Failed to await publish ack") {
+            Ok(ack) => Ok(ack.sequence),
+            Err(source) => Err(self
+                .publish_failed(jetstream, subject, message_len, source)
+                .await),
+        }
+    }
+
+    /// Record a published event: idempotency cache, TTL schedule and index
+    /// (which need its `sequence`, so not for `AckMode::None`), depth count
+    /// and metrics.
+    async fn published(
+        &self,
+        event: &FluxEvent,
+        subject: &str,
+        sequence: Option<u64>,
+        mode: AckMode,
+        sent: SentEvent,
+    ) -> PublishAck {
+        let default_target = route(&self.targets, &event.stream).is_none();
+        if let Some(sequence) = sequence {
+            let cache = self.idempotency.as_ref().zip(event.event_id.as_deref());
+            if let Some((cache, event_id)) = cache {
+                cache.insert(event_id, sequence);
+            }
+            // Depth counts and index entries describe the default stream only
+            let ttl_purger = self
+                .ttl_purger
+                .as_ref()
+                .filter(|purger| default_target && purger.applies_to(event));
+            if let Some(purger) = ttl_purger {
+                if let Err(e) = purger.record(event, subject, sequence).await {
+                    warn!(error = %e, subject = %subject, "Failed to schedule TTL purge");
+                }
+            }
+            if default_target {
+                self.index_event(event, subject.to_string(), sequence);
+            }
+        }
+        if default_target {
+            self.record_published();
+        }
+        if let Some(storage) = &self.storage_metrics {
+            storage.record(sent.raw_len, sent.stored_len, sent.compressed);
+        }
+        if let Some(publishes) = &self.publish_metrics {
+            publishes.record(&event.stream, mode.as_str(), self.clock.now_millis());
+        }
+        if let Some(lag) = &self.lag_metrics {
+            if sequence.is_some() {
+                lag.observe_publish(&event.stream, sent.started.elapsed());
+            }
+            lag.observe_ingest(&event.stream, event.timestamp, self.clock.now_millis());
+        }
+        PublishAck {
+            sequence: sequence.unwrap_or_default(),
+            cached: false,
+        }
+    }
+
+    /// The error for a publish JetStream refused: `PayloadTooLargeError` for
+    /// oversized messages, `StreamArchivedError` when no stream captures the
+    /// subject because its stream was archived, otherwise `PublishError`.
+    async fn publish_failed(
+        &self,
+        jetstream: &jetstream::Context,
+        subject: &str,
+        size: usize,
+        source: anyhow::Error,
+    ) -> anyhow::Error {
+        if is_payload_too_large(&source) {
+            return PayloadTooLargeError {
+                subject: subject.to_string(),
+                size,
+                max: self.max_payload.into_iter().chain(self.max_msg_size).min(),
+            }
+            .into();
+        }
+        let no_stream = source
+            .downcast_ref::<jetstream::context::PublishError>()
+            .map_or(false, |e| e.kind() == PublishErrorKind::StreamNotFound);
+        if no_stream {
+            match archived_stream_for(jetstream, subject).await {
+                Ok(Some(archived)) => return archived.into(),
+                Ok(None) => {}
+                Err(e) => warn!(error = %e, subject = %subject, "Archived stream lookup failed"),
+            }
+        }
+        PublishError {
+            subject: subject.to_string(),
+            source,
+        }
+        .into()
+    }
+
+    /// Write the index entry for a published event in the background.
+    fn index_event(&self, event: &FluxEvent, subject: String, sequence: u64) {
+        let Some(index) = &self.event_index else {
+            return;
+        };
+        let index = Arc::clone(index);
+        let storage = self.storage_metrics.clone();
+        let event_id = event.event_id.clone().unwrap_or_default();
+        let entry = EventIndexEntry {
+            stream: event.stream.clone(),
+            subject,
+            sequence,
+        };
+
+        tokio::spawn(async move {
+            if let Err(e) = index.record(&event_id, &entry).await {
+                warn!(error = %e, event_id = %event_id, "Failed to index event");
+                if let Some(storage) = storage {
+                    storage.record_index_failure();
+                }
+            }
+        });
     }
 
-    /// Publish multiple events in batch
+    /// Publish multiple events in batch, with the publisher's ack mode
     pub async fn publish_batch(&self, events: &[FluxEvent]) -> Result<Vec<Result<()>>> {
-        let mut results = Vec::with_capacity(events.len());
+        self.publish_batch_with_mode(events, self.ack_mode).await
+    }
 
+    /// Publish multiple events in batch with `mode`. With `AckMode::Async`
+    /// every event is sent before any ack is awaited, so the batch pays one
+    /// round trip instead of one per event; results still report each ack.
+    pub async fn publish_batch_with_mode(
+        &self,
+        events: &[FluxEvent],
+        mode: AckMode,
+    ) -> Result<Vec<Result<()>>> {
+        let mut receipts = Vec::with_capacity(events.len());
         for event in events {
-            let result = self.publish(event).await;
+            receipts.push(self.publish_with_mode(event, mode).await);
+        }
+
+        let mut results = Vec::with_capacity(events.len());
+        for receipt in receipts {
+            let result = match receipt {
+                Ok(Some(PublishReceipt::Pending(pending))) => pending.wait().await.map(|_| ()),
+                Ok(_) => Ok(()),
+                Err(e) => Err(e),
+            };
             results.push(result);
         }
 
         Ok(results)
     }
 }
+
+/// NATS subject for an event, including the high-priority suffix.
+fn event_subject(event: &FluxEvent) -> String {
+    if event.priority().is_elevated() {
+        high_priority_subject(&event.stream)
+    } else {
+        stream_subject(&event.stream)
+    }
+}
+
+/// Bytes `headers` take on the wire: the `NATS/1.0` status line, one
+/// `Name: value` line per value and the closing blank line.
+fn headers_len(headers: &async_nats::HeaderMap) -> usize {
+    let lines: usize = headers
+        .iter()
+        .flat_map(|(name, values)| {
+            let name_len = name.to_string().len();
+            values
+                .iter()
+                .map(move |value| name_len + ": ".len() + value.as_str().len() + "\r\n".len())
+        })
+        .sum();
+    "NATS/1.0\r\n".len() + lines + "\r\n".len()
+}
+
+/// Messages NATS refuses for their size: over the connection's max_payload
+/// (checked by the client) or the stream's max message size (JetStream
+/// error 10054).
+const PAYLOAD_TOO_LARGE_ERRORS: [&str; 3] = [
+    "max payload",
+    "maximum payload",
+    "message size exceeds maximum",
+];
+
+fn is_payload_too_large(error: &anyhow::Error) -> bool {
+    let message = format!("{:#}", error).to_lowercase();
+    PAYLOAD_TOO_LARGE_ERRORS
+        .iter()
+        .any(|pattern| message.contains(pattern))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::event::Priority;
+    use serde_json::json;
+    use std::sync::atomic::{AtomicUsize, Ordering};
+
+    fn event(priority: Option<Priority>) -> FluxEvent {
+        FluxEvent {
+            event_id: None,
+            stream: "alarms".to_string(),
+            source: "plc-01".to_string(),
+            timestamp: 1707668400000,
+            key: None,
+            schema: None,
+            priority,
+            envelope_version: None,
+            received_at: None,
+            ttl_ms: None,
+            correlation_id: None,
+            parent_event_id: None,
+            payload: json!({}),
+            raw_payload: None,
+        }
+    }
+
+    #[tokio::test]
+    async fn test_concurrent_depth_checks_share_one_query() {
+        let limit = Arc::new(DepthLimit::new("FLUX_EVENTS".to_string(), 100));
+        let queries = Arc::new(AtomicUsize::new(0));
+
+        let checks: Vec<_> = (0..50)
+            .map(|_| {
+                let limit = Arc::clone(&limit);
+                let queries = Arc::clone(&queries);
+                tokio::spawn(async move {
+                    limit
+                        .messages(|| async {
+                            queries.fetch_add(1, Ordering::SeqCst);
+                            tokio::time::sleep(Duration::from_millis(20)).await;
+                            Ok(7)
+                        })
+                        .await
+                        .unwrap()
+                })
+            })
+            .collect();
+        for check in checks {
+            assert_eq!(check.await.unwrap(), 7);
+        }
+        assert_eq!(queries.load(Ordering::SeqCst), 1);
+    }
+
+    #[tokio::test]
+    async fn test_failed_depth_query_not_cached() {
+        let limit = DepthLimit::new("FLUX_EVENTS".to_string(), 100);
+        assert!(limit
+            .messages(|| async { Err(anyhow::anyhow!("stream info timed out")) })
+            .await
+            .is_err());
+        assert_eq!(limit.messages(|| async { Ok(3) }).await.unwrap(), 3);
+    }
+
+    #[test]
+    fn test_subject_routing_by_priority() {
+        assert_eq!(event_subject(&event(None)), "flux.events.alarms");
+        assert_eq!(event_subject(&event(Some(Priority::Low))), "flux.events.alarms");
+        assert_eq!(event_subject(&event(Some(Priority::Normal))), "flux.events.alarms");
+        assert_eq!(
+            event_subject(&event(Some(Priority::High))),
+            "flux.events.alarms.p.high"
+        );
+        assert_eq!(
+            event_subject(&event(Some(Priority::Critical))),
+            "flux.events.alarms.p.high"
+        );
+    }
+
+    #[test]
+    fn test_headers_len_matches_wire_format() {
+        let mut headers = async_nats::HeaderMap::new();
+        assert_eq!(headers_len(&headers), "NATS/1.0\r\n\r\n".len());
+
+        headers.insert("Flux-Priority", "high");
+        assert_eq!(
+            headers_len(&headers),
+            "NATS/1.0\r\nFlux-Priority: high\r\n\r\n".len()
+        );
+    }
+
+    #[test]
+    fn test_payload_too_large_classification() {
+        let client = anyhow::anyhow!("max payload size exceeded");
+        let jetstream = anyhow::anyhow!("nats: message size exceeds maximum allowed")
+            .context("Failed to await publish ack");
+        let other = anyhow::anyhow!("no responders").context("Failed to send event");
+
+        assert!(is_payload_too_large(&client));
+        assert!(is_payload_too_large(&jetstream));
+        assert!(!is_payload_too_large(&other));
+    }
+}
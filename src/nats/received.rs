@@ -0,0 +1,108 @@
+use super::codec::{decode_event, CONTENT_ENCODING_HEADER, CONTENT_TYPE_HEADER};
+use super::enrichment::{INGEST_API_HEADER, INSTANCE_HEADER, RECEIVED_AT_HEADER};
+use super::publisher::PRIORITY_HEADER;
+use crate::event::FluxEvent;
+use anyhow::{anyhow, Result};
+use async_nats::jetstream;
+use std::collections::BTreeMap;
+
+/// W3C trace context header, passed through from producers that set it
+pub const TRACEPARENT_HEADER: &str = "traceparent";
+
+/// Where and how often a message was delivered, from its JetStream metadata.
+#[derive(Debug, Clone, PartialEq)]
+pub struct DeliveryMeta {
+    pub subject: String,
+    pub stream_sequence: u64,
+    pub consumer_sequence: u64,
+    /// Times this message has been delivered, including this one
+    pub delivered: i64,
+    /// When JetStream stored the message (Unix milliseconds)
+    pub stored_at: i64,
+}
+
+/// A decoded event together with the NATS context it arrived in, which the
+/// event body alone does not carry.
+#[derive(Debug, Clone)]
+pub struct ReceivedEvent {
+    pub event: FluxEvent,
+    pub meta: DeliveryMeta,
+    /// NATS headers; the first value of each
+    pub headers: BTreeMap<String, String>,
+}
+
+impl ReceivedEvent {
+    /// Decode a JetStream message, keeping its delivery metadata and headers.
+    pub fn from_message(message: &jetstream::Message) -> Result<Self> {
+        let event = decode_event(message.headers.as_ref(), &message.payload)?;
+        let info = message
+            .info()
+            .map_err(|e| anyhow!("Invalid message metadata: {}", e))?;
+        let meta = DeliveryMeta {
+            subject: message.subject.to_string(),
+            stream_sequence: info.stream_sequence,
+            consumer_sequence: info.consumer_sequence,
+            delivered: info.delivered,
+            stored_at: (info.published.unix_timestamp_nanos() / 1_000_000) as i64,
+        };
+        let headers = message
+            .headers
+            .iter()
+            .flat_map(|headers| headers.iter())
+            .filter_map(|(name, values)| {
+                let value = values.first()?;
+                Some((name.to_string(), value.as_str().to_string()))
+            })
+            .collect();
+        Ok(Self {
+            event,
+            meta,
+            headers,
+        })
+    }
+
+    /// Value of header `name`, if present.
+    pub fn header(&self, name: &str) -> Option<&str> {
+        self.headers.get(name).map(String::as_str)
+    }
+
+    /// `Flux-Priority` as published ("low", "normal", "high", "critical")
+    pub fn priority(&self) -> Option<&str> {
+        self.header(PRIORITY_HEADER)
+    }
+
+    /// `Content-Encoding` of the stored body ("gzip" when compressed)
+    pub fn content_encoding(&self) -> Option<&str> {
+        self.header(CONTENT_ENCODING_HEADER)
+    }
+
+    /// `Content-Type` of the stored body (set for protobuf events only)
+    pub fn content_type(&self) -> Option<&str> {
+        self.header(CONTENT_TYPE_HEADER)
+    }
+
+    /// W3C `traceparent` set by the producer
+    pub fn trace_parent(&self) -> Option<&str> {
+        self.header(TRACEPARENT_HEADER)
+    }
+
+    /// `x-flux-received-at`: when Flux accepted the event (Unix milliseconds)
+    pub fn received_at(&self) -> Option<i64> {
+        self.header(RECEIVED_AT_HEADER)?.parse().ok()
+    }
+
+    /// `x-flux-instance`: the Flux instance that accepted the event
+    pub fn instance(&self) -> Option<&str> {
+        self.header(INSTANCE_HEADER)
+    }
+
+    /// `x-flux-api`: "http", "nats" or "internal"
+    pub fn ingest_api(&self) -> Option<&str> {
+        self.header(INGEST_API_HEADER)
+    }
+
+    /// True if this is a redelivery.
+    pub fn is_redelivery(&self) -> bool {
+        self.meta.delivered > 1
+    }
+}
@@ -0,0 +1,192 @@
+use super::client::{StreamCreateError, StreamInitResult, StreamInitStatus};
+use super::definitions::{
+    export_definitions, import_definitions, ImportMode, ImportReport, StreamDefinitions,
+};
+use super::firehose::INTERNAL_STREAM_PREFIXES;
+use super::stream_diff::{diff_stream_config, safe_update_config, StreamConfigDiff};
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, stream};
+use futures::TryStreamExt;
+use serde::Serialize;
+use tracing::{info, warn};
+
+/// The declared streams compared with the live cluster (see `Reconciler`).
+#[derive(Debug, Clone, Serialize)]
+pub struct ReconcileReport {
+    /// Declared but not in the cluster; created by `Reconciler::apply`
+    pub missing: Vec<String>,
+    /// Declared and present with a different config. Unsafe fields (storage,
+    /// retention, deny flags) are reported but never applied.
+    pub drifted: Vec<StreamConfigDiff>,
+    /// In the cluster but not declared; always left alone
+    pub unmanaged: Vec<String>,
+    /// What `apply` did, by stream (empty when only reporting)
+    #[serde(skip_serializing_if = "Vec::is_empty")]
+    pub applied: Vec<StreamInitResult>,
+}
+
+impl ReconcileReport {
+    /// True when every declared stream exists with its declared config.
+    pub fn in_sync(&self) -> bool {
+        self.missing.is_empty() && self.drifted.is_empty()
+    }
+}
+
+/// Compares the streams declared in the configuration with the streams the
+/// cluster has, and optionally brings the cluster in line.
+///
+/// Streams behind KV buckets and object stores are never reported as
+/// unmanaged, nor are the names passed to `with_managed`.
+pub struct Reconciler {
+    jetstream: jetstream::Context,
+    declared: Vec<stream::Config>,
+    managed: Vec<String>,
+}
+
+impl Reconciler {
+    pub fn new(jetstream: jetstream::Context, declared: Vec<stream::Config>) -> Self {
+        Self {
+            jetstream,
+            declared,
+            managed: Vec::new(),
+        }
+    }
+
+    /// A stream Flux maintains without declaring its config up front (e.g.
+    /// the firehose, whose sources change).
+    pub fn with_managed(mut self, stream_name: impl Into<String>) -> Self {
+        self.managed.push(stream_name.into());
+        self
+    }
+
+    /// Compare without changing anything.
+    pub async fn report(&self) -> Result<ReconcileReport> {
+        let mut names: Vec<String> = self
+            .jetstream
+            .stream_names()
+            .try_collect()
+            .await
+            .context("Failed to list stream names")?;
+        names.sort();
+
+        let mut missing = Vec::new();
+        let mut drifted = Vec::new();
+        for desired in &self.declared {
+            if !names.contains(&desired.name) {
+                missing.push(desired.name.clone());
+                continue;
+            }
+            let current = self.current_config(&desired.name).await?;
+            let diff = diff_stream_config(&current, desired);
+            if !diff.is_empty() {
+                drifted.push(diff);
+            }
+        }
+
+        let unmanaged = names
+            .into_iter()
+            .filter(|name| {
+                !self.declared.iter().any(|config| &config.name == name)
+                    && !self.managed.contains(name)
+                    && !INTERNAL_STREAM_PREFIXES
+                        .iter()
+                        .any(|prefix| name.starts_with(prefix))
+            })
+            .collect();
+
+        Ok(ReconcileReport {
+            missing,
+            drifted,
+            unmanaged,
+            applied: Vec::new(),
+        })
+    }
+
+    /// Create the missing streams and apply the safe part of any drift.
+    /// Returns the report from before the changes, with what was done in
+    /// `applied`. A stream that fails is recorded there and the others are
+    /// still reconciled.
+    pub async fn apply(&self) -> Result<ReconcileReport> {
+        let mut report = self.report().await?;
+
+        for name in &report.missing {
+            let Some(config) = self.declared.iter().find(|config| &config.name == name) else {
+                continue;
+            };
+            let result: Result<StreamInitStatus> = self
+                .jetstream
+                .create_stream(config.clone())
+                .await
+                .map(|_| StreamInitStatus::Created)
+                .map_err(|e| {
+                    StreamCreateError {
+                        stream: name.clone(),
+                        source: e.into(),
+                    }
+                    .into()
+                });
+            match &result {
+                Ok(_) => info!(stream = %name, "Created missing stream"),
+                Err(e) => warn!(stream = %name, error = %e, "Failed to create missing stream"),
+            }
+            report
+                .applied
+                .push(StreamInitResult::from_result(name, &result));
+        }
+
+        for diff in &report.drifted {
+            if diff.has_unsafe_changes() {
+                warn!(
+                    stream = %diff.stream,
+                    fields = ?diff.unsafe_fields(),
+                    "Stream drift cannot be applied in place; left as is"
+                );
+            }
+            if diff.changes.iter().all(|change| !change.safe) {
+                continue;
+            }
+            let result = self.apply_safe_changes(diff).await;
+            match &result {
+                Ok(_) => info!(stream = %diff.stream, "Applied stream config drift"),
+                Err(e) => warn!(stream = %diff.stream, error = %e, "Failed to apply stream drift"),
+            }
+            report
+                .applied
+                .push(StreamInitResult::from_result(&diff.stream, &result));
+        }
+
+        Ok(report)
+    }
+
+    /// Snapshot the cluster's stream definitions (see `export_definitions`).
+    pub async fn export_definitions(&self, include_consumers: bool) -> Result<StreamDefinitions> {
+        export_definitions(&self.jetstream, include_consumers).await
+    }
+
+    /// Recreate a snapshot on this cluster (see `import_definitions`).
+    pub async fn import_definitions(
+        &self,
+        definitions: &StreamDefinitions,
+        mode: ImportMode,
+    ) -> Result<ImportReport> {
+        import_definitions(&self.jetstream, definitions, mode).await
+    }
+
+    async fn apply_safe_changes(&self, diff: &StreamConfigDiff) -> Result<StreamInitStatus> {
+        let current = self.current_config(&diff.stream).await?;
+        self.jetstream
+            .update_stream(&safe_update_config(&current, &diff.desired))
+            .await
+            .context("Failed to update JetStream stream")?;
+        Ok(StreamInitStatus::Reconciled)
+    }
+
+    async fn current_config(&self, name: &str) -> Result<stream::Config> {
+        let mut stream = self
+            .jetstream
+            .get_stream(name)
+            .await
+            .with_context(|| format!("Failed to get stream '{}'", name))?;
+        Ok(stream.info().await?.config.clone())
+    }
+}
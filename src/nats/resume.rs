@@ -0,0 +1,243 @@
+use super::codec::decode_event;
+use crate::event::FluxEvent;
+use anyhow::{Context, Result};
+use async_nats::jetstream::{
+    self,
+    consumer::{pull, DeliverPolicy},
+};
+use base64::{engine::general_purpose::URL_SAFE_NO_PAD as TOKEN, Engine};
+use futures::StreamExt;
+use sha2::{Digest, Sha256};
+use std::fmt;
+use std::time::Duration;
+use tracing::warn;
+
+/// Version written into new resume tokens
+const TOKEN_VERSION: &str = "v1";
+
+/// Stop a page after this long without a new message
+const IDLE_TIMEOUT: Duration = Duration::from_millis(200);
+
+/// Largest page `fetch_page` returns
+pub const MAX_PAGE_LIMIT: usize = 1000;
+
+/// Returned for a resume token that is malformed, from another version or
+/// stream, or issued before the stream was recreated.
+#[derive(Debug, Clone, PartialEq)]
+pub struct InvalidTokenError {
+    pub reason: String,
+}
+
+impl fmt::Display for InvalidTokenError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "invalid resume token: {}", self.reason)
+    }
+}
+
+impl std::error::Error for InvalidTokenError {}
+
+/// Where a reader left off: the next stream sequence to read, pinned to one
+/// incarnation of the stream (its creation time).
+#[derive(Debug, Clone, PartialEq)]
+pub struct ResumeToken {
+    pub stream: String,
+    /// Stream creation time (Unix nanoseconds); changes when the stream is recreated
+    pub created: i128,
+    pub next_sequence: u64,
+}
+
+impl ResumeToken {
+    /// Opaque, URL-safe form (base64url, no padding).
+    pub fn encode(&self) -> String {
+        let body = format!(
+            "{}|{}|{}|{}",
+            TOKEN_VERSION, self.stream, self.created, self.next_sequence
+        );
+        let check = checksum(&body);
+        TOKEN.encode(format!("{}|{}", body, check))
+    }
+
+    /// Parse and verify a token from `encode`.
+    pub fn decode(token: &str) -> Result<Self, InvalidTokenError> {
+        let invalid = |reason: &str| InvalidTokenError {
+            reason: reason.to_string(),
+        };
+        let raw = TOKEN
+            .decode(token)
+            .ok()
+            .and_then(|bytes| String::from_utf8(bytes).ok())
+            .ok_or_else(|| invalid("not base64url"))?;
+
+        let (body, check) = raw.rsplit_once('|').ok_or_else(|| invalid("malformed"))?;
+        if checksum(body) != check {
+            return Err(invalid("checksum mismatch"));
+        }
+        let mut fields = body.rsplitn(3, '|');
+        let (Some(next_sequence), Some(created), Some(rest)) =
+            (fields.next(), fields.next(), fields.next())
+        else {
+            return Err(invalid("malformed"));
+        };
+        let (version, stream) = rest.split_once('|').ok_or_else(|| invalid("malformed"))?;
+        if version != TOKEN_VERSION {
+            return Err(InvalidTokenError {
+                reason: format!("unsupported version '{}'", version),
+            });
+        }
+
+        Ok(Self {
+            stream: stream.to_string(),
+            created: created.parse().map_err(|_| invalid("malformed"))?,
+            next_sequence: next_sequence.parse().map_err(|_| invalid("malformed"))?,
+        })
+    }
+}
+
+/// First 8 bytes of the SHA-256 of `body`, hex
+fn checksum(body: &str) -> String {
+    Sha256::digest(body.as_bytes())[..8]
+        .iter()
+        .map(|b| format!("{:02x}", b))
+        .collect()
+}
+
+/// A stored event and its stream sequence.
+#[derive(Debug, Clone)]
+pub struct SequencedEvent {
+    pub sequence: u64,
+    pub event: FluxEvent,
+}
+
+/// One page of events and the token to continue from.
+#[derive(Debug, Clone)]
+pub struct EventPage {
+    pub events: Vec<SequencedEvent>,
+    /// Pass to the next `fetch_page`; unchanged when no new events were stored
+    pub token: String,
+}
+
+/// Read up to `limit` events from `stream_name`, starting at `token` (or the
+/// first stored event), without a server-side durable consumer.
+///
+/// Lets batch jobs read a chunk, stop, and resume later (even from another
+/// process) with exact continuation. Messages that fail to decode are skipped
+/// but still advance the token. Tokens from another stream, or from before the
+/// stream was deleted and recreated, fail with `InvalidTokenError`.
+pub async fn fetch_page(
+    jetstream: &jetstream::Context,
+    stream_name: &str,
+    token: Option<&str>,
+    limit: usize,
+) -> Result<EventPage> {
+    let mut stream = jetstream
+        .get_stream(stream_name)
+        .await
+        .context("Failed to get JetStream stream")?;
+    let info = stream.info().await?;
+    let created = info.created.unix_timestamp_nanos();
+    let head = info.state.last_sequence;
+
+    let start = match token {
+        Some(token) => {
+            let token = ResumeToken::decode(token)?;
+            if token.stream != stream_name {
+                return Err(InvalidTokenError {
+                    reason: format!("issued for stream '{}'", token.stream),
+                }
+                .into());
+            }
+            if token.created != created {
+                return Err(InvalidTokenError {
+                    reason: "stream was recreated since the token was issued".to_string(),
+                }
+                .into());
+            }
+            token.next_sequence
+        }
+        None => 1,
+    };
+
+    let mut next_sequence = start;
+    let mut events = Vec::new();
+    let limit = limit.clamp(1, MAX_PAGE_LIMIT);
+    if start <= head {
+        let consumer = stream
+            .create_consumer(pull::OrderedConfig {
+                deliver_policy: DeliverPolicy::ByStartSequence {
+                    start_sequence: start,
+                },
+                ..Default::default()
+            })
+            .await
+            .context("Failed to create page consumer")?;
+        let mut messages = consumer.messages().await.context("Failed to read events")?;
+
+        while events.len() < limit && next_sequence <= head {
+            let message = match tokio::time::timeout(IDLE_TIMEOUT, messages.next()).await {
+                Ok(Some(Ok(message))) => message,
+                Ok(Some(Err(e))) => return Err(anyhow::anyhow!("Failed to read events: {}", e)),
+                Ok(None) | Err(_) => break,
+            };
+            let sequence = message
+                .info()
+                .map_err(|e| anyhow::anyhow!("Invalid message metadata: {}", e))?
+                .stream_sequence;
+            next_sequence = sequence + 1;
+            match decode_event(message.headers.as_ref(), &message.payload) {
+                Ok(event) => events.push(SequencedEvent { sequence, event }),
+                Err(e) => warn!(error = %e, sequence, "Skipping undecodable event"),
+            }
+        }
+    }
+
+    let token = ResumeToken {
+        stream: stream_name.to_string(),
+        created,
+        next_sequence,
+    };
+    Ok(EventPage {
+        events,
+        token: token.encode(),
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn token() -> ResumeToken {
+        ResumeToken {
+            stream: "FLUX_EVENTS".to_string(),
+            created: 1_707_668_400_123_456_789,
+            next_sequence: 42,
+        }
+    }
+
+    #[test]
+    fn test_token_round_trip_is_url_safe() {
+        let encoded = token().encode();
+        assert!(encoded
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_'));
+        assert_eq!(ResumeToken::decode(&encoded).unwrap(), token());
+    }
+
+    #[test]
+    fn test_tampered_token_fails() {
+        let raw = String::from_utf8(TOKEN.decode(token().encode()).unwrap()).unwrap();
+        let tampered = TOKEN.encode(raw.replace("|42|", "|43|"));
+        let err = ResumeToken::decode(&tampered).unwrap_err();
+        assert_eq!(err.reason, "checksum mismatch");
+
+        assert!(ResumeToken::decode("not a token").is_err());
+        assert!(ResumeToken::decode("").is_err());
+    }
+
+    #[test]
+    fn test_unknown_version_fails() {
+        let body = "v9|FLUX_EVENTS|1|1";
+        let token = TOKEN.encode(format!("{}|{}", body, checksum(body)));
+        let err = ResumeToken::decode(&token).unwrap_err();
+        assert_eq!(err.reason, "unsupported version 'v9'");
+    }
+}
@@ -0,0 +1,128 @@
+use serde::Deserialize;
+use std::sync::atomic::{AtomicU64, Ordering};
+
+/// Sampling rule for a high-frequency stream (`[[nats.sampling]]` in config.toml).
+///
+/// Set either `rate` (probabilistic) or `every_nth` (deterministic).
+#[derive(Clone, Debug, Deserialize)]
+pub struct SamplingConfig {
+    pub stream: String,
+    #[serde(default)]
+    pub rate: Option<f64>,
+    #[serde(default)]
+    pub every_nth: Option<u64>,
+}
+
+impl SamplingConfig {
+    pub fn sampler(&self) -> Result<Sampler, String> {
+        match (self.rate, self.every_nth) {
+            (Some(rate), None) if (0.0..=1.0).contains(&rate) => Ok(Sampler::rate(rate)),
+            (None, Some(n)) if n > 0 => Ok(Sampler::every_nth(n)),
+            _ => Err(format!(
+                "sampling for stream '{}' needs exactly one of rate (0.0-1.0) or every_nth (> 0)",
+                self.stream
+            )),
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy)]
+enum Mode {
+    Rate(f64),
+    EveryNth(u64),
+}
+
+/// Decides which events of a stream get published.
+///
+/// Dropped events are counted but never reach JetStream.
+#[derive(Debug)]
+pub struct Sampler {
+    mode: Mode,
+    seen: AtomicU64,
+    dropped: AtomicU64,
+}
+
+impl Sampler {
+    /// Publish a random `rate` fraction of events (0.1 = 10%).
+    pub fn rate(rate: f64) -> Self {
+        Self::new(Mode::Rate(rate.clamp(0.0, 1.0)))
+    }
+
+    /// Publish every `n`th event, starting with the first.
+    pub fn every_nth(n: u64) -> Self {
+        Self::new(Mode::EveryNth(n.max(1)))
+    }
+
+    fn new(mode: Mode) -> Self {
+        Self {
+            mode,
+            seen: AtomicU64::new(0),
+            dropped: AtomicU64::new(0),
+        }
+    }
+
+    /// True if the next event should be published; otherwise counts it as dropped.
+    pub fn sample(&self) -> bool {
+        let keep = match self.mode {
+            Mode::Rate(rate) => rand::random::<f64>() < rate,
+            Mode::EveryNth(n) => self.seen.fetch_add(1, Ordering::Relaxed) % n == 0,
+        };
+        if !keep {
+            self.dropped.fetch_add(1, Ordering::Relaxed);
+        }
+        keep
+    }
+
+    /// Events dropped so far
+    pub fn dropped_total(&self) -> u64 {
+        self.dropped.load(Ordering::Relaxed)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_every_nth_is_deterministic() {
+        let sampler = Sampler::every_nth(3);
+        let kept: Vec<bool> = (0..7).map(|_| sampler.sample()).collect();
+        assert_eq!(kept, vec![true, false, false, true, false, false, true]);
+        assert_eq!(sampler.dropped_total(), 4);
+    }
+
+    #[test]
+    fn test_rate_bounds() {
+        let all = Sampler::rate(1.0);
+        let none = Sampler::rate(0.0);
+        for _ in 0..100 {
+            assert!(all.sample());
+            assert!(!none.sample());
+        }
+        assert_eq!(all.dropped_total(), 0);
+        assert_eq!(none.dropped_total(), 100);
+    }
+
+    #[test]
+    fn test_rate_is_approximate() {
+        let sampler = Sampler::rate(0.1);
+        let kept = (0..10_000).filter(|_| sampler.sample()).count();
+        assert!((700..1300).contains(&kept), "kept {}", kept);
+        assert_eq!(sampler.dropped_total(), 10_000 - kept as u64);
+    }
+
+    #[test]
+    fn test_config_requires_one_mode() {
+        let config = |rate, every_nth| SamplingConfig {
+            stream: "sensors".to_string(),
+            rate,
+            every_nth,
+        };
+        assert!(config(Some(0.5), None).sampler().is_ok());
+        assert!(config(None, Some(10)).sampler().is_ok());
+        assert!(config(None, None).sampler().is_err());
+        assert!(config(Some(0.5), Some(10)).sampler().is_err());
+        assert!(config(Some(1.5), None).sampler().is_err());
+        assert!(config(None, Some(0)).sampler().is_err());
+    }
+}
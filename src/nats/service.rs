@@ -0,0 +1,215 @@
+use super::admission::AdmissionRejectedError;
+use super::archive::StreamArchivedError;
+use super::publisher::{
+    EventPublisher, PayloadTooLargeError, StreamFullError, SubjectNotCapturedError,
+};
+use super::subject::stream_subject;
+use crate::event::{is_valid_stream_name, FluxEvent, ValidationError};
+use crate::source::SourceRejectedError;
+use anyhow::{anyhow, Result};
+use async_nats::jetstream;
+use async_nats::service::{self, error::Error as ServiceError, Request, ServiceExt};
+use futures::StreamExt;
+use serde::{Deserialize, Serialize};
+use serde_json::Value;
+use tracing::{info, warn};
+
+/// Name advertised via NATS service discovery ($SRV.INFO.flux)
+pub const SERVICE_NAME: &str = "flux";
+
+/// Body for `stream.create` and `stream.info`
+#[derive(Debug, Deserialize)]
+pub struct StreamRequest {
+    pub stream: String,
+}
+
+/// Reply for `stream.create` and `stream.info`
+#[derive(Debug, Serialize, Deserialize)]
+pub struct StreamInfoResponse {
+    pub stream: String,
+    pub subject: String,
+    /// Messages stored for this stream (including sub-streams)
+    pub messages: u64,
+    /// Duplicate window of the JetStream stream holding it, in seconds
+    #[serde(default)]
+    pub duplicate_window_seconds: u64,
+}
+
+/// Reply for `publish`
+#[derive(Debug, Serialize, Deserialize)]
+pub struct PublishResponse {
+    #[serde(rename = "eventId")]
+    pub event_id: String,
+    pub stream: String,
+}
+
+/// Register Flux as a NATS micro service.
+///
+/// Endpoints (JSON request/reply):
+/// - `publish`: publish a FluxEvent
+/// - `stream.create`: validate a stream name (Flux streams are created on first publish)
+/// - `stream.info`: message count and duplicate window for a stream
+///
+/// Other NATS services can discover Flux via `$SRV.INFO` / `$SRV.PING` without HTTP.
+/// Handlers run on spawned tasks; call `stop()` on the returned service to deregister.
+pub async fn start_service(
+    client: &async_nats::Client,
+    jetstream: jetstream::Context,
+    publisher: EventPublisher,
+    stream_name: String,
+) -> Result<service::Service> {
+    let service = client
+        .service_builder()
+        .description("Flux event publishing and stream info")
+        .start(SERVICE_NAME, env!("CARGO_PKG_VERSION"))
+        .await
+        .map_err(|e| anyhow!("failed to start NATS service: {}", e))?;
+
+    let mut publish = service
+        .endpoint("publish")
+        .await
+        .map_err(|e| anyhow!("failed to add publish endpoint: {}", e))?;
+    let streams = service.group("stream");
+    let mut create = streams
+        .endpoint("create")
+        .await
+        .map_err(|e| anyhow!("failed to add stream.create endpoint: {}", e))?;
+    let mut info = streams
+        .endpoint("info")
+        .await
+        .map_err(|e| anyhow!("failed to add stream.info endpoint: {}", e))?;
+
+    tokio::spawn(async move {
+        while let Some(request) = publish.next().await {
+            let result = handle_publish(&publisher, &request.message.payload).await;
+            respond(request, result).await;
+        }
+    });
+
+    let create_js = jetstream.clone();
+    let create_stream_name = stream_name.clone();
+    tokio::spawn(async move {
+        while let Some(request) = create.next().await {
+            let result =
+                handle_stream_info(&create_js, &create_stream_name, &request.message.payload).await;
+            respond(request, result).await;
+        }
+    });
+
+    tokio::spawn(async move {
+        while let Some(request) = info.next().await {
+            let result =
+                handle_stream_info(&jetstream, &stream_name, &request.message.payload).await;
+            respond(request, result).await;
+        }
+    });
+
+    info!(service = SERVICE_NAME, "NATS micro service registered");
+    Ok(service)
+}
+
+async fn handle_publish(publisher: &EventPublisher, payload: &[u8]) -> Result<Value, ServiceError> {
+    let mut event = FluxEvent::from_json_slice(payload).map_err(|e| bad_request(e.to_string()))?;
+    event.validate_and_prepare().map_err(|e| ServiceError {
+        code: e.code().http_status() as usize,
+        status: e.to_string(),
+    })?;
+
+    publisher.publish(&event).await.map_err(|e| {
+        let code = if e.downcast_ref::<StreamFullError>().is_some()
+            || e.downcast_ref::<AdmissionRejectedError>().is_some()
+        {
+            503
+        } else if e.downcast_ref::<SourceRejectedError>().is_some() {
+            403
+        } else if let Some(validation) = e.downcast_ref::<ValidationError>() {
+            validation.code().http_status() as usize
+        } else if e.downcast_ref::<SubjectNotCapturedError>().is_some() {
+            400
+        } else if e.downcast_ref::<PayloadTooLargeError>().is_some() {
+            413
+        } else if e.downcast_ref::<StreamArchivedError>().is_some() {
+            410
+        } else {
+            500
+        };
+        ServiceError {
+            code,
+            status: e.to_string(),
+        }
+    })?;
+
+    to_json(&PublishResponse {
+        event_id: event.event_id.clone().unwrap(),
+        stream: event.stream.clone(),
+    })
+}
+
+async fn handle_stream_info(
+    jetstream: &jetstream::Context,
+    stream_name: &str,
+    payload: &[u8],
+) -> Result<Value, ServiceError> {
+    let request: StreamRequest =
+        serde_json::from_slice(payload).map_err(|e| bad_request(e.to_string()))?;
+    if !is_valid_stream_name(&request.stream) {
+        return Err(bad_request(format!(
+            "invalid stream name '{}'",
+            request.stream
+        )));
+    }
+
+    let subject = stream_subject(&request.stream);
+    let internal = |e: anyhow::Error| ServiceError {
+        code: 500,
+        status: e.to_string(),
+    };
+    let mut stream = jetstream
+        .get_stream(stream_name)
+        .await
+        .map_err(|e| internal(e.into()))?;
+    let duplicate_window = stream.cached_info().config.duplicate_window;
+    let messages = count_stream_messages(&mut stream, &subject)
+        .await
+        .map_err(internal)?;
+
+    to_json(&StreamInfoResponse {
+        stream: request.stream,
+        subject,
+        messages,
+        duplicate_window_seconds: duplicate_window.as_secs(),
+    })
+}
+
+/// Count messages stored on `subject` and its sub-subjects.
+async fn count_stream_messages(
+    stream: &mut jetstream::stream::Stream,
+    subject: &str,
+) -> Result<u64> {
+    let mut total = 0u64;
+    for filter in [subject.to_string(), format!("{}.>", subject)] {
+        let mut subjects = stream.info_with_subjects(filter).await?;
+        while let Some(entry) = subjects.next().await {
+            total += entry?.1 as u64;
+        }
+    }
+    Ok(total)
+}
+
+async fn respond(request: Request, result: Result<Value, ServiceError>) {
+    let result = result.map(|value| serde_json::to_vec(&value).unwrap_or_default().into());
+    if let Err(e) = request.respond(result).await {
+        warn!(error = %e, subject = %request.message.subject, "Failed to send service reply");
+    }
+}
+
+fn to_json<T: Serialize>(value: &T) -> Result<Value, ServiceError> {
+    serde_json::to_value(value).map_err(|e| ServiceError {
+        code: 500,
+        status: e.to_string(),
+    })
+}
+
+fn bad_request(status: String) -> ServiceError {
+    ServiceError { code: 400, status }
+}
@@ -0,0 +1,103 @@
+use super::stream_list::StreamPage;
+use sha2::{Digest, Sha256};
+use std::collections::HashMap;
+use std::sync::{Arc, Mutex};
+use std::time::{Duration, Instant};
+
+/// Short-lived cache of stream listings for the HTTP API, so dashboards
+/// polling every few seconds do not fan out to a stream info request per
+/// stream on each poll.
+///
+/// Clones share entries. `NatsClient` invalidates its cache whenever it
+/// creates, updates, purges or deletes a stream; changes made elsewhere (other
+/// processes, published events) show up once an entry is older than the TTL
+/// the reader asks for.
+#[derive(Clone, Debug, Default)]
+pub struct StreamInfoCache {
+    entries: Arc<Mutex<HashMap<String, (Instant, Arc<StreamPage>)>>>,
+}
+
+impl StreamInfoCache {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Page cached under `key`, if stored less than `ttl` ago.
+    pub fn get(&self, key: &str, ttl: Duration) -> Option<Arc<StreamPage>> {
+        let entries = self.entries.lock().unwrap();
+        let (stored_at, page) = entries.get(key)?;
+        (stored_at.elapsed() < ttl).then(|| Arc::clone(page))
+    }
+
+    /// Cache `page` under `key`, returning it shared.
+    pub fn insert(&self, key: impl Into<String>, page: StreamPage) -> Arc<StreamPage> {
+        let page = Arc::new(page);
+        self.entries
+            .lock()
+            .unwrap()
+            .insert(key.into(), (Instant::now(), Arc::clone(&page)));
+        page
+    }
+
+    /// Drop every entry (after a stream was created, changed or deleted).
+    pub fn invalidate(&self) {
+        self.entries.lock().unwrap().clear();
+    }
+}
+
+/// Strong ETag for a page of streams, from each stream's name, last sequence
+/// and message count (plus the continuation token), quoted as HTTP expects.
+pub fn stream_page_etag(page: &StreamPage) -> String {
+    let mut hasher = Sha256::new();
+    for info in &page.streams {
+        hasher.update(info.config.name.as_bytes());
+        hasher.update(info.state.last_sequence.to_be_bytes());
+        hasher.update(info.state.messages.to_be_bytes());
+    }
+    hasher.update(page.continuation.as_deref().unwrap_or_default().as_bytes());
+    let hex: String = hasher.finalize()[..8]
+        .iter()
+        .map(|b| format!("{:02x}", b))
+        .collect();
+    format!("\"{}\"", hex)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn page() -> StreamPage {
+        StreamPage {
+            streams: Vec::new(),
+            continuation: Some("token".to_string()),
+        }
+    }
+
+    #[test]
+    fn test_entries_expire_and_invalidate() {
+        let cache = StreamInfoCache::new();
+        cache.insert("list", page());
+
+        assert!(cache.get("list", Duration::from_secs(60)).is_some());
+        assert!(cache.get("list", Duration::ZERO).is_none());
+        assert!(cache.get("other", Duration::from_secs(60)).is_none());
+
+        // Clones share entries
+        cache.clone().invalidate();
+        assert!(cache.get("list", Duration::from_secs(60)).is_none());
+    }
+
+    #[test]
+    fn test_etag_is_quoted_and_stable() {
+        let etag = stream_page_etag(&page());
+        assert_eq!(etag, stream_page_etag(&page()));
+        assert!(etag.starts_with('"') && etag.ends_with('"'));
+        assert_eq!(etag.len(), 18);
+
+        let last_page = StreamPage {
+            continuation: None,
+            ..page()
+        };
+        assert_ne!(etag, stream_page_etag(&last_page));
+    }
+}
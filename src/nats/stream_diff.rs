@@ -0,0 +1,382 @@
+use async_nats::jetstream::stream;
+use serde::Serialize;
+use std::collections::BTreeMap;
+use std::fmt;
+
+/// A single field that differs between the live stream and the desired config.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct FieldChange {
+    pub field: &'static str,
+    pub current: String,
+    pub desired: String,
+    /// False when JetStream cannot change the field in place (e.g. storage type)
+    pub safe: bool,
+}
+
+/// Difference between a stream's live configuration and the configured one.
+#[derive(Debug, Clone, Serialize)]
+pub struct StreamConfigDiff {
+    pub stream: String,
+    pub changes: Vec<FieldChange>,
+    /// Full desired config, used by `apply_stream_diff`
+    #[serde(skip)]
+    pub(crate) desired: stream::Config,
+}
+
+impl StreamConfigDiff {
+    /// True when the live stream already matches the desired config.
+    pub fn is_empty(&self) -> bool {
+        self.changes.is_empty()
+    }
+
+    /// Names of changed fields that cannot be applied with UpdateStream.
+    pub fn unsafe_fields(&self) -> Vec<&'static str> {
+        self.changes
+            .iter()
+            .filter(|c| !c.safe)
+            .map(|c| c.field)
+            .collect()
+    }
+
+    pub fn has_unsafe_changes(&self) -> bool {
+        self.changes.iter().any(|c| !c.safe)
+    }
+}
+
+/// Returned when a diff contains changes JetStream cannot apply in place.
+#[derive(Debug, Clone, PartialEq)]
+pub struct UnsafeUpdateError {
+    pub stream: String,
+    pub fields: Vec<&'static str>,
+}
+
+impl fmt::Display for UnsafeUpdateError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "unsafe config change for stream '{}': {} cannot be updated in place",
+            self.stream,
+            self.fields.join(", ")
+        )
+    }
+}
+
+impl std::error::Error for UnsafeUpdateError {}
+
+/// Compare a live stream config against the desired one.
+///
+/// Only fields Flux manages are compared; server-populated fields (e.g.
+/// placement, or a duplicate window left at zero for the server default)
+/// are ignored.
+pub fn diff_stream_config(current: &stream::Config, desired: &stream::Config) -> StreamConfigDiff {
+    let mut changes = Vec::new();
+
+    let mut check = |field: &'static str, current: String, desired: String, safe: bool| {
+        if current != desired {
+            changes.push(FieldChange {
+                field,
+                current,
+                desired,
+                safe,
+            });
+        }
+    };
+
+    check(
+        "subjects",
+        format!("{:?}", current.subjects),
+        format!("{:?}", desired.subjects),
+        true,
+    );
+    check(
+        "max_age",
+        format!("{:?}", current.max_age),
+        format!("{:?}", desired.max_age),
+        true,
+    );
+    if !desired.duplicate_window.is_zero() {
+        check(
+            "duplicate_window",
+            format!("{:?}", current.duplicate_window),
+            format!("{:?}", desired.duplicate_window),
+            true,
+        );
+    }
+    check(
+        "max_bytes",
+        limit(current.max_bytes),
+        limit(desired.max_bytes),
+        true,
+    );
+    check(
+        "max_messages",
+        limit(current.max_messages),
+        limit(desired.max_messages),
+        true,
+    );
+    check(
+        "max_messages_per_subject",
+        limit(current.max_messages_per_subject),
+        limit(desired.max_messages_per_subject),
+        true,
+    );
+    check(
+        "max_message_size",
+        limit(current.max_message_size as i64),
+        limit(desired.max_message_size as i64),
+        true,
+    );
+    check(
+        "discard",
+        format!("{:?}", current.discard),
+        format!("{:?}", desired.discard),
+        true,
+    );
+    check(
+        "discard_new_per_subject",
+        current.discard_new_per_subject.to_string(),
+        desired.discard_new_per_subject.to_string(),
+        true,
+    );
+    check(
+        "republish",
+        format!("{:?}", current.republish),
+        format!("{:?}", desired.republish),
+        true,
+    );
+    check(
+        "metadata",
+        format!("{:?}", user_metadata(current)),
+        format!("{:?}", user_metadata(desired)),
+        true,
+    );
+    check(
+        "allow_direct",
+        current.allow_direct.to_string(),
+        desired.allow_direct.to_string(),
+        true,
+    );
+    check(
+        "mirror_direct",
+        current.mirror_direct.to_string(),
+        desired.mirror_direct.to_string(),
+        true,
+    );
+    // Sealing turns both deny flags on server-side; a sealed stream can't be
+    // updated anyway
+    if !current.sealed {
+        check(
+            "deny_delete",
+            current.deny_delete.to_string(),
+            desired.deny_delete.to_string(),
+            false,
+        );
+        check(
+            "deny_purge",
+            current.deny_purge.to_string(),
+            desired.deny_purge.to_string(),
+            false,
+        );
+    }
+    check(
+        "storage",
+        format!("{:?}", current.storage),
+        format!("{:?}", desired.storage),
+        false,
+    );
+    check(
+        "retention",
+        format!("{:?}", current.retention),
+        format!("{:?}", desired.retention),
+        false,
+    );
+
+    StreamConfigDiff {
+        stream: desired.name.clone(),
+        changes,
+        desired: desired.clone(),
+    }
+}
+
+/// `desired` with the fields JetStream cannot change in place kept as they
+/// are in `current`, so UpdateStream applies only the safe part of a diff.
+pub fn safe_update_config(current: &stream::Config, desired: &stream::Config) -> stream::Config {
+    stream::Config {
+        storage: current.storage,
+        retention: current.retention,
+        deny_delete: current.deny_delete,
+        deny_purge: current.deny_purge,
+        ..desired.clone()
+    }
+}
+
+/// Metadata keys set by the stream's owner, sorted. The server adds its own
+/// under `_nats.` (e.g. the API level a stream needs).
+fn user_metadata(config: &stream::Config) -> BTreeMap<&str, &str> {
+    config
+        .metadata
+        .iter()
+        .filter(|(key, _)| !key.starts_with("_nats."))
+        .map(|(key, value)| (key.as_str(), value.as_str()))
+        .collect()
+}
+
+/// Render a JetStream limit. The server stores unset limits (0) as -1, so both
+/// are treated as "unlimited" to avoid reporting drift on every startup.
+fn limit(value: i64) -> String {
+    if value <= 0 {
+        "unlimited".to_string()
+    } else {
+        value.to_string()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::time::Duration;
+
+    fn base_config() -> stream::Config {
+        stream::Config {
+            name: "FLUX_EVENTS".to_string(),
+            subjects: vec!["flux.events.>".to_string()],
+            max_age: Duration::from_secs(7 * 86400),
+            max_bytes: 1024,
+            storage: stream::StorageType::File,
+            retention: stream::RetentionPolicy::Limits,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_identical_configs_have_no_diff() {
+        let diff = diff_stream_config(&base_config(), &base_config());
+        assert!(diff.is_empty());
+        assert!(!diff.has_unsafe_changes());
+    }
+
+    #[test]
+    fn test_max_age_change_is_safe() {
+        let mut desired = base_config();
+        desired.max_age = Duration::from_secs(30 * 86400);
+
+        let diff = diff_stream_config(&base_config(), &desired);
+        assert_eq!(diff.changes.len(), 1);
+        assert_eq!(diff.changes[0].field, "max_age");
+        assert!(diff.changes[0].safe);
+        assert!(!diff.has_unsafe_changes());
+    }
+
+    #[test]
+    fn test_storage_change_is_unsafe() {
+        let mut desired = base_config();
+        desired.storage = stream::StorageType::Memory;
+        desired.max_bytes = 2048;
+
+        let diff = diff_stream_config(&base_config(), &desired);
+        assert_eq!(diff.changes.len(), 2);
+        assert!(diff.has_unsafe_changes());
+        assert_eq!(diff.unsafe_fields(), vec!["storage"]);
+    }
+
+    #[test]
+    fn test_server_normalized_limits_are_not_drift() {
+        let mut current = base_config();
+        current.max_messages = -1;
+        let mut desired = base_config();
+        desired.max_messages = 0;
+
+        assert!(diff_stream_config(&current, &desired).is_empty());
+    }
+
+    #[test]
+    fn test_duplicate_window_change_is_safe() {
+        let mut current = base_config();
+        current.duplicate_window = Duration::from_secs(120);
+        // Zero leaves the server's window alone
+        assert!(diff_stream_config(&current, &base_config()).is_empty());
+
+        let mut desired = base_config();
+        desired.duplicate_window = Duration::from_secs(3600);
+        let diff = diff_stream_config(&current, &desired);
+        assert_eq!(diff.changes.len(), 1);
+        assert_eq!(diff.changes[0].field, "duplicate_window");
+        assert!(!diff.has_unsafe_changes());
+    }
+
+    #[test]
+    fn test_discard_policy_change_is_safe() {
+        let mut desired = base_config();
+        desired.discard = stream::DiscardPolicy::New;
+
+        let diff = diff_stream_config(&base_config(), &desired);
+        assert_eq!(diff.changes.len(), 1);
+        assert_eq!(diff.changes[0].field, "discard");
+        assert!(!diff.has_unsafe_changes());
+    }
+
+    #[test]
+    fn test_deny_flags_are_unsafe() {
+        let mut desired = base_config();
+        desired.deny_purge = true;
+
+        let diff = diff_stream_config(&base_config(), &desired);
+        assert_eq!(diff.unsafe_fields(), vec!["deny_purge"]);
+    }
+
+    #[test]
+    fn test_sealed_stream_deny_flags_are_not_drift() {
+        let mut current = base_config();
+        current.sealed = true;
+        current.deny_delete = true;
+        current.deny_purge = true;
+
+        assert!(diff_stream_config(&current, &base_config()).is_empty());
+    }
+
+    #[test]
+    fn test_metadata_drift_ignores_server_keys() {
+        let mut current = base_config();
+        current
+            .metadata
+            .insert("_nats.req.level".to_string(), "0".to_string());
+        assert!(diff_stream_config(&current, &base_config()).is_empty());
+
+        let mut desired = base_config();
+        desired
+            .metadata
+            .insert("owner".to_string(), "plant-a".to_string());
+        let diff = diff_stream_config(&current, &desired);
+        assert_eq!(diff.changes.len(), 1);
+        assert_eq!(diff.changes[0].field, "metadata");
+        assert!(!diff.has_unsafe_changes());
+    }
+
+    #[test]
+    fn test_safe_update_keeps_unsafe_fields() {
+        let mut desired = base_config();
+        desired.storage = stream::StorageType::Memory;
+        desired.deny_delete = true;
+        desired.max_bytes = 2048;
+
+        let update = safe_update_config(&base_config(), &desired);
+        assert_eq!(update.max_bytes, 2048);
+        assert_eq!(update.storage, stream::StorageType::File);
+        assert!(!update.deny_delete);
+        assert!(diff_stream_config(&base_config(), &update)
+            .unsafe_fields()
+            .is_empty());
+    }
+
+    #[test]
+    fn test_unsafe_error_lists_fields() {
+        let err = UnsafeUpdateError {
+            stream: "FLUX_EVENTS".to_string(),
+            fields: vec!["storage", "retention"],
+        };
+        assert_eq!(
+            err.to_string(),
+            "unsafe config change for stream 'FLUX_EVENTS': storage, retention cannot be updated in place"
+        );
+    }
+}
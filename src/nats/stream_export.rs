@@ -0,0 +1,208 @@
+use super::codec::decode_event;
+use super::publisher::EventPublisher;
+use crate::event::FluxEvent;
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, consumer::pull};
+use futures::StreamExt;
+use std::fmt;
+use std::future::Future;
+use std::time::Duration;
+use tokio::io::{AsyncBufRead, AsyncBufReadExt, AsyncWrite, AsyncWriteExt};
+use tracing::{info, warn};
+
+/// Stop an export after this long without a new message (the tail was
+/// removed while reading)
+const IDLE_TIMEOUT: Duration = Duration::from_secs(2);
+
+/// Returned when `shutdown` resolves before an export or import finishes.
+#[derive(Debug, Clone, PartialEq)]
+pub struct TransferCancelledError {
+    /// Events written (export) or published (import) before stopping
+    pub events: u64,
+}
+
+impl fmt::Display for TransferCancelledError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "transfer cancelled after {} events", self.events)
+    }
+}
+
+impl std::error::Error for TransferCancelledError {}
+
+/// Options for `export_stream` and `import_stream`.
+#[derive(Default)]
+pub struct TransferOptions {
+    progress: Option<Box<dyn Fn(u64) + Send + Sync>>,
+    progress_every: u64,
+}
+
+impl TransferOptions {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Call `progress` with the running count every `every` events, and with
+    /// the total once done.
+    pub fn with_progress<F>(mut self, every: u64, progress: F) -> Self
+    where
+        F: Fn(u64) + Send + Sync + 'static,
+    {
+        self.progress = Some(Box::new(progress));
+        self.progress_every = every.max(1);
+        self
+    }
+
+    fn report(&self, count: u64, done: bool) {
+        if let Some(progress) = &self.progress {
+            if done || count % self.progress_every == 0 {
+                progress(count);
+            }
+        }
+    }
+}
+
+/// Write every event stored in `stream_name` to `writer` as NDJSON (one
+/// `FluxEvent` per line, in stream order), for backup or migration to
+/// another cluster with `import_stream`. Returns the number written.
+///
+/// Reads from sequence 1 up to the last sequence when the export starts.
+/// Messages that fail to decode are skipped with a warning. If `shutdown`
+/// resolves first, stops between lines with `TransferCancelledError`.
+pub async fn export_stream<W>(
+    jetstream: &jetstream::Context,
+    stream_name: &str,
+    writer: &mut W,
+    options: &TransferOptions,
+    shutdown: impl Future<Output = ()>,
+) -> Result<u64>
+where
+    W: AsyncWrite + Unpin,
+{
+    let mut stream = jetstream
+        .get_stream(stream_name)
+        .await
+        .context("Failed to get JetStream stream")?;
+    let head = stream.info().await?.state.last_sequence;
+    tokio::pin!(shutdown);
+
+    let mut written = 0;
+    if head > 0 {
+        let consumer = stream
+            .create_consumer(pull::OrderedConfig::default())
+            .await
+            .context("Failed to create export consumer")?;
+        let mut messages = consumer.messages().await.context("Failed to read events")?;
+
+        loop {
+            let next = tokio::select! {
+                _ = &mut shutdown => {
+                    return Err(TransferCancelledError { events: written }.into());
+                }
+                next = tokio::time::timeout(IDLE_TIMEOUT, messages.next()) => next,
+            };
+            let message = match next {
+                Ok(Some(Ok(message))) => message,
+                Ok(Some(Err(e))) => return Err(anyhow::anyhow!("Failed to read events: {}", e)),
+                Ok(None) | Err(_) => break,
+            };
+            let sequence = message
+                .info()
+                .map_err(|e| anyhow::anyhow!("Invalid message metadata: {}", e))?
+                .stream_sequence;
+            match decode_event(message.headers.as_ref(), &message.payload) {
+                Ok(event) => {
+                    let mut line =
+                        serde_json::to_vec(&event).context("Failed to serialize event")?;
+                    line.push(b'\n');
+                    writer
+                        .write_all(&line)
+                        .await
+                        .context("Failed to write export")?;
+                    written += 1;
+                    options.report(written, false);
+                }
+                Err(e) => warn!(error = %e, sequence, "Skipping undecodable event"),
+            }
+            if sequence >= head {
+                break;
+            }
+        }
+    }
+
+    writer.flush().await.context("Failed to write export")?;
+    options.report(written, true);
+    info!(stream = %stream_name, events = written, "Exported stream");
+    Ok(written)
+}
+
+/// Publish every event in `reader` (NDJSON from `export_stream`) through
+/// `publisher`, in order. Returns the number published.
+///
+/// Events keep their ids and timestamps. Blank lines are skipped; a line
+/// that is not an event, or fails to publish, stops the import, naming the
+/// line (the lines before it stay published). If `shutdown` resolves
+/// first, stops between events with `TransferCancelledError`.
+pub async fn import_stream<R>(
+    publisher: &EventPublisher,
+    reader: R,
+    options: &TransferOptions,
+    shutdown: impl Future<Output = ()>,
+) -> Result<u64>
+where
+    R: AsyncBufRead + Unpin,
+{
+    let mut lines = reader.lines();
+    tokio::pin!(shutdown);
+
+    let (mut line_number, mut published) = (0, 0);
+    loop {
+        let line = tokio::select! {
+            _ = &mut shutdown => {
+                return Err(TransferCancelledError { events: published }.into());
+            }
+            line = lines.next_line() => line.context("Failed to read import")?,
+        };
+        let Some(line) = line else {
+            break;
+        };
+        line_number += 1;
+        if line.trim().is_empty() {
+            continue;
+        }
+        let event: FluxEvent = serde_json::from_str(&line)
+            .with_context(|| format!("Invalid event on line {}", line_number))?;
+        publisher
+            .publish(&event)
+            .await
+            .with_context(|| format!("Failed to publish event on line {}", line_number))?;
+        published += 1;
+        options.report(published, false);
+    }
+
+    options.report(published, true);
+    info!(events = published, "Imported events");
+    Ok(published)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::sync::{Arc, Mutex};
+
+    #[test]
+    fn test_progress_every_n_and_at_end() {
+        let reports = Arc::new(Mutex::new(Vec::new()));
+        let seen = Arc::clone(&reports);
+        let options =
+            TransferOptions::new().with_progress(2, move |count| seen.lock().unwrap().push(count));
+
+        for count in 1..=5 {
+            options.report(count, false);
+        }
+        options.report(5, true);
+        assert_eq!(*reports.lock().unwrap(), [2, 4, 5]);
+
+        // No callback, nothing to do
+        TransferOptions::new().report(1, true);
+    }
+}
@@ -0,0 +1,290 @@
+use super::publisher::EventPublisher;
+use crate::event::{FluxEvent, ValidationError};
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, stream};
+use futures::StreamExt;
+use serde::Deserialize;
+use serde_json::json;
+use std::sync::Arc;
+use std::time::Duration;
+use time::OffsetDateTime;
+use tracing::{info, warn};
+
+/// Flux stream that receives an audit event per janitor deletion
+pub const AUDIT_STREAM: &str = "flux.system.audit";
+
+/// Stream metadata key marking a stream as auto-created (value "true"); only
+/// streams carrying it are ever cleaned up.
+pub const AUTO_CREATED_LABEL: &str = "flux.auto_created";
+
+/// Periodic cleanup of idle, empty auto-created streams (`[nats.janitor]`).
+#[derive(Clone, Debug, Deserialize)]
+pub struct StreamJanitorConfig {
+    /// Delete once empty and consumer-less for this long
+    #[serde(default = "default_janitor_idle_hours")]
+    pub idle_hours: u64,
+    #[serde(default = "default_janitor_interval")]
+    pub interval_seconds: u64,
+    /// Only log candidates; delete nothing
+    #[serde(default)]
+    pub dry_run: bool,
+    /// Never deleted, whatever their state
+    #[serde(default)]
+    pub protected_streams: Vec<String>,
+}
+
+fn default_janitor_idle_hours() -> u64 {
+    168 // one week
+}
+
+fn default_janitor_interval() -> u64 {
+    3600
+}
+
+impl StreamJanitorConfig {
+    /// How long `activity` has been idle, if it is due for deletion at `now`.
+    pub fn evaluate(&self, activity: &StreamActivity, now: OffsetDateTime) -> Option<Duration> {
+        if !activity.auto_created
+            || activity.deny_delete
+            || activity.messages > 0
+            || activity.consumers > 0
+            || self.protected_streams.contains(&activity.stream)
+        {
+            return None;
+        }
+        let idle_for = Duration::try_from(now - activity.last_active).unwrap_or_default();
+        (idle_for >= Duration::from_secs(self.idle_hours * 3600)).then_some(idle_for)
+    }
+}
+
+impl Default for StreamJanitorConfig {
+    fn default() -> Self {
+        Self {
+            idle_hours: default_janitor_idle_hours(),
+            interval_seconds: default_janitor_interval(),
+            dry_run: false,
+            protected_streams: Vec::new(),
+        }
+    }
+}
+
+/// The facts about one stream the janitor decides on.
+#[derive(Debug, Clone, PartialEq)]
+pub struct StreamActivity {
+    pub stream: String,
+    pub auto_created: bool,
+    pub deny_delete: bool,
+    pub messages: u64,
+    pub consumers: usize,
+    /// Stream creation or last message, whichever is later
+    pub last_active: OffsetDateTime,
+}
+
+impl StreamActivity {
+    fn from_info(info: &stream::Info) -> Self {
+        let config = &info.config;
+        Self {
+            stream: config.name.clone(),
+            auto_created: config.metadata.get(AUTO_CREATED_LABEL).map(String::as_str)
+                == Some("true"),
+            deny_delete: config.deny_delete || config.sealed,
+            messages: info.state.messages,
+            consumers: info.state.consumer_count,
+            last_active: info.created.max(info.state.last_timestamp),
+        }
+    }
+}
+
+/// A stream the janitor deleted (or, in dry-run mode, would delete).
+#[derive(Debug, Clone, PartialEq)]
+pub struct JanitorCandidate {
+    pub stream: String,
+    pub idle_for: Duration,
+}
+
+impl JanitorCandidate {
+    /// Audit record of the deletion on `AUDIT_STREAM`, keyed by stream.
+    pub fn to_event(&self) -> Result<FluxEvent, ValidationError> {
+        FluxEvent::builder(AUDIT_STREAM)
+            .source("flux")
+            .key(self.stream.clone())
+            .payload(json!({
+                "entity_id": format!("flux/stream-{}", self.stream.to_lowercase()),
+                "properties": {
+                    "action": "stream_deleted",
+                    "reason": "idle_auto_created",
+                    "stream": self.stream,
+                    "idle_seconds": self.idle_for.as_secs(),
+                }
+            }))
+            .build()
+    }
+}
+
+/// Deletes auto-created streams (metadata `flux.auto_created = "true"`) that
+/// have held no messages and no consumers for `idle_hours`, so streams made
+/// by typos stop holding their reservations.
+///
+/// Streams with `deny_delete`, sealed streams and `protected_streams` are
+/// never touched. Each deletion is logged and (with `with_audit`) published
+/// to `flux.system.audit`; in dry-run mode candidates are only logged.
+pub struct StreamJanitor {
+    jetstream: jetstream::Context,
+    config: StreamJanitorConfig,
+    publisher: Option<EventPublisher>,
+}
+
+impl StreamJanitor {
+    pub fn new(jetstream: jetstream::Context, config: StreamJanitorConfig) -> Self {
+        Self {
+            jetstream,
+            config,
+            publisher: None,
+        }
+    }
+
+    /// Publish an audit event per deletion via `publisher`.
+    pub fn with_audit(mut self, publisher: EventPublisher) -> Self {
+        self.publisher = Some(publisher);
+        self
+    }
+
+    /// List streams once and delete the idle ones (none in dry-run mode).
+    /// Returns the candidates found.
+    pub async fn sweep(&self) -> Result<Vec<JanitorCandidate>> {
+        let now = OffsetDateTime::now_utc();
+        let mut candidates = Vec::new();
+        let mut streams = self.jetstream.streams();
+        while let Some(info) = streams.next().await {
+            let activity = StreamActivity::from_info(&info.context("Failed to list streams")?);
+            if let Some(idle_for) = self.config.evaluate(&activity, now) {
+                candidates.push(JanitorCandidate {
+                    stream: activity.stream,
+                    idle_for,
+                });
+            }
+        }
+
+        for candidate in &candidates {
+            if self.config.dry_run {
+                info!(
+                    stream = %candidate.stream,
+                    idle_secs = candidate.idle_for.as_secs(),
+                    "Idle auto-created stream would be deleted (dry run)"
+                );
+                continue;
+            }
+            self.jetstream
+                .delete_stream(&candidate.stream)
+                .await
+                .context("Failed to delete idle stream")?;
+            info!(
+                stream = %candidate.stream,
+                idle_secs = candidate.idle_for.as_secs(),
+                "Deleted idle auto-created stream"
+            );
+            if let Some(publisher) = &self.publisher {
+                let result = match candidate.to_event() {
+                    Ok(event) => publisher.publish(&event).await,
+                    Err(e) => Err(e.into()),
+                };
+                if let Err(e) = result {
+                    warn!(error = %e, stream = %candidate.stream, "Failed to publish audit event");
+                }
+            }
+        }
+        Ok(candidates)
+    }
+
+    /// Sweep every `interval_seconds`, forever.
+    pub async fn run(self: Arc<Self>) {
+        info!(
+            idle_hours = self.config.idle_hours,
+            dry_run = self.config.dry_run,
+            "Starting stream janitor"
+        );
+        let mut interval =
+            tokio::time::interval(Duration::from_secs(self.config.interval_seconds.max(1)));
+        loop {
+            interval.tick().await;
+            if let Err(e) = self.sweep().await {
+                warn!(error = %e, "Stream janitor sweep failed");
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const NOW: i64 = 1_707_668_400;
+
+    fn at(unix_seconds: i64) -> OffsetDateTime {
+        OffsetDateTime::from_unix_timestamp(unix_seconds).unwrap()
+    }
+
+    fn idle(stream: &str, idle_hours: i64) -> StreamActivity {
+        StreamActivity {
+            stream: stream.to_string(),
+            auto_created: true,
+            deny_delete: false,
+            messages: 0,
+            consumers: 0,
+            last_active: at(NOW - idle_hours * 3600),
+        }
+    }
+
+    #[test]
+    fn test_only_idle_empty_auto_created_streams_qualify() {
+        let config = StreamJanitorConfig {
+            idle_hours: 24,
+            protected_streams: vec!["KEEP".to_string()],
+            ..Default::default()
+        };
+        let now = at(NOW);
+
+        assert_eq!(
+            config.evaluate(&idle("TYPO", 25), now),
+            Some(Duration::from_secs(25 * 3600))
+        );
+        assert_eq!(config.evaluate(&idle("RECENT", 23), now), None);
+        assert_eq!(config.evaluate(&idle("KEEP", 25), now), None);
+
+        let cases = [
+            StreamActivity {
+                auto_created: false,
+                ..idle("MANUAL", 25)
+            },
+            StreamActivity {
+                deny_delete: true,
+                ..idle("DENY", 25)
+            },
+            StreamActivity {
+                messages: 1,
+                ..idle("FULL", 25)
+            },
+            StreamActivity {
+                consumers: 1,
+                ..idle("READ", 25)
+            },
+        ];
+        for activity in &cases {
+            assert_eq!(config.evaluate(activity, now), None, "{}", activity.stream);
+        }
+    }
+
+    #[test]
+    fn test_audit_event() {
+        let event = JanitorCandidate {
+            stream: "SENSORS_TYPO".to_string(),
+            idle_for: Duration::from_secs(3600),
+        }
+        .to_event()
+        .unwrap();
+        assert_eq!(event.stream, AUDIT_STREAM);
+        assert_eq!(event.key.as_deref(), Some("SENSORS_TYPO"));
+        assert_eq!(event.payload["properties"]["action"], "stream_deleted");
+        assert_eq!(event.payload["properties"]["idle_seconds"], 3600);
+    }
+}
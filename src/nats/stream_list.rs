@@ -0,0 +1,196 @@
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, stream};
+use base64::{engine::general_purpose::URL_SAFE_NO_PAD as TOKEN, Engine};
+use futures::TryStreamExt;
+use std::fmt;
+
+/// Streams per page when no page size is given
+pub const DEFAULT_PAGE_SIZE: usize = 50;
+
+/// Largest page size accepted
+pub const MAX_PAGE_SIZE: usize = 500;
+
+/// Which JetStream streams to list, and where to resume.
+#[derive(Debug, Clone, Default)]
+pub struct StreamListOptions {
+    /// Only stream names starting with this
+    pub prefix: Option<String>,
+    /// Only streams whose config metadata has all of these key/value pairs
+    pub labels: Vec<(String, String)>,
+    /// Streams per page (0 = default, clamped to `MAX_PAGE_SIZE`)
+    pub page_size: usize,
+    /// Token from the previous page
+    pub continuation: Option<String>,
+}
+
+/// One page of streams, sorted by name.
+#[derive(Debug)]
+pub struct StreamPage {
+    pub streams: Vec<stream::Info>,
+    /// Pass back to get the next page; None on the last page
+    pub continuation: Option<String>,
+}
+
+/// Returned for a continuation token this server did not issue.
+#[derive(Debug, Clone, PartialEq)]
+pub struct InvalidContinuationError {
+    pub token: String,
+}
+
+impl fmt::Display for InvalidContinuationError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "invalid continuation token '{}'", self.token)
+    }
+}
+
+impl std::error::Error for InvalidContinuationError {}
+
+/// Parse a label selector such as `env=prod,tier=edge`.
+pub fn parse_label_selector(selector: &str) -> Option<Vec<(String, String)>> {
+    selector
+        .split(',')
+        .filter(|pair| !pair.trim().is_empty())
+        .map(|pair| {
+            let (key, value) = pair.split_once('=')?;
+            let key = key.trim();
+            (!key.is_empty()).then(|| (key.to_string(), value.trim().to_string()))
+        })
+        .collect()
+}
+
+/// List one page of JetStream streams.
+///
+/// Names come from the StreamNames pager (cheap); stream info is only fetched
+/// for candidates of the current page, in name order. The continuation token
+/// encodes the last name returned, so streams created or deleted between
+/// pages never cause duplicates.
+pub async fn list_streams_page(
+    jetstream: &jetstream::Context,
+    options: &StreamListOptions,
+) -> Result<StreamPage> {
+    let after = options
+        .continuation
+        .as_deref()
+        .map(decode_token)
+        .transpose()?;
+    let page_size = match options.page_size {
+        0 => DEFAULT_PAGE_SIZE,
+        n => n.min(MAX_PAGE_SIZE),
+    };
+
+    let names: Vec<String> = jetstream
+        .stream_names()
+        .try_collect()
+        .await
+        .context("Failed to list stream names")?;
+    let candidates = page_candidates(names, options.prefix.as_deref(), after.as_deref());
+
+    let mut streams = Vec::with_capacity(page_size);
+    let mut more = false;
+    for name in candidates {
+        let info = match jetstream.get_stream(&name).await {
+            Ok(mut stream) => stream.info().await?.clone(),
+            // Deleted since the names were listed
+            Err(_) => continue,
+        };
+        if !has_labels(&info.config, &options.labels) {
+            continue;
+        }
+        if streams.len() == page_size {
+            more = true;
+            break;
+        }
+        streams.push(info);
+    }
+
+    let continuation = more
+        .then(|| streams.last().map(|info| encode_token(&info.config.name)))
+        .flatten();
+    Ok(StreamPage {
+        streams,
+        continuation,
+    })
+}
+
+/// Names matching `prefix` that sort after `after`, in order.
+fn page_candidates(
+    mut names: Vec<String>,
+    prefix: Option<&str>,
+    after: Option<&str>,
+) -> Vec<String> {
+    names.retain(|name| {
+        prefix.map_or(true, |prefix| name.starts_with(prefix))
+            && after.map_or(true, |after| name.as_str() > after)
+    });
+    names.sort();
+    names.dedup();
+    names
+}
+
+fn has_labels(config: &stream::Config, labels: &[(String, String)]) -> bool {
+    labels
+        .iter()
+        .all(|(key, value)| config.metadata.get(key) == Some(value))
+}
+
+fn encode_token(name: &str) -> String {
+    TOKEN.encode(name)
+}
+
+fn decode_token(token: &str) -> Result<String> {
+    TOKEN
+        .decode(token)
+        .ok()
+        .and_then(|bytes| String::from_utf8(bytes).ok())
+        .ok_or_else(|| {
+            InvalidContinuationError {
+                token: token.to_string(),
+            }
+            .into()
+        })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn names(list: &[&str]) -> Vec<String> {
+        list.iter().map(|name| name.to_string()).collect()
+    }
+
+    #[test]
+    fn test_page_candidates_sorted_after_token() {
+        let all = names(&["SENSOR_B", "ALERTS", "SENSOR_A", "SENSOR_C"]);
+        assert_eq!(
+            page_candidates(all.clone(), Some("SENSOR_"), None),
+            names(&["SENSOR_A", "SENSOR_B", "SENSOR_C"])
+        );
+        assert_eq!(
+            page_candidates(all, None, Some("SENSOR_A")),
+            names(&["SENSOR_B", "SENSOR_C"])
+        );
+    }
+
+    #[test]
+    fn test_token_round_trip() {
+        let token = encode_token("FLUX_EVENTS");
+        assert_eq!(decode_token(&token).unwrap(), "FLUX_EVENTS");
+
+        let err = decode_token("not a token!").unwrap_err();
+        assert!(err.downcast_ref::<InvalidContinuationError>().is_some());
+    }
+
+    #[test]
+    fn test_parse_label_selector() {
+        assert_eq!(
+            parse_label_selector("env=prod, tier=edge").unwrap(),
+            vec![
+                ("env".to_string(), "prod".to_string()),
+                ("tier".to_string(), "edge".to_string())
+            ]
+        );
+        assert_eq!(parse_label_selector("").unwrap(), vec![]);
+        assert!(parse_label_selector("env").is_none());
+        assert!(parse_label_selector("=prod").is_none());
+    }
+}
@@ -0,0 +1,414 @@
+use super::stream_diff::diff_stream_config;
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, consumer, stream};
+use futures::{StreamExt, TryStreamExt};
+use serde::Serialize;
+use std::time::{Duration, Instant};
+use tracing::{info, warn};
+
+/// Suffix of the stream a migration keeps the old messages in. Stream names
+/// cannot contain dots, so `ORDERS` is kept as `ORDERS_DEPRECATED`.
+pub const DEPRECATED_STREAM_SUFFIX: &str = "_DEPRECATED";
+
+/// Stream metadata key marking a stream left behind by a migration; the
+/// value is when it was replaced (RFC 3339).
+pub const DEPRECATED_LABEL: &str = "flux.deprecated";
+
+/// A stream being migrated captures only this subject while its last
+/// messages are copied, so no new events land in it.
+const MIGRATING_SUBJECT_PREFIX: &str = "flux.migrating.";
+
+/// Header JetStream adds to messages copied from a source: `<stream> <seq> ...`
+const STREAM_SOURCE_HEADER: &str = "Nats-Stream-Source";
+
+const SYNC_POLL_INTERVAL: Duration = Duration::from_millis(100);
+
+/// Give up on a copy that has made no progress for this long
+const SYNC_STALL_TIMEOUT: Duration = Duration::from_secs(30);
+
+/// How `NatsClient::migrate_stream` applied a config change.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "snake_case")]
+pub enum MigrationMethod {
+    /// The stream already had the desired config
+    Unchanged,
+    /// Applied with UpdateStream
+    InPlace,
+    /// Recreated with the new config and the messages copied over
+    Copied,
+}
+
+/// Outcome of `NatsClient::migrate_stream`.
+#[derive(Debug, Clone, Serialize)]
+pub struct StreamMigration {
+    pub stream: String,
+    pub method: MigrationMethod,
+    /// Where the old messages are kept (`Copied` only)
+    pub deprecated_stream: Option<String>,
+    /// Messages copied into the new stream
+    pub messages: u64,
+    /// Durable consumers recreated on the new stream
+    pub consumers: Vec<String>,
+}
+
+/// True when `desired` lowers a retention limit of `current`. UpdateStream
+/// accepts this, but JetStream then drops the messages over the new limit.
+pub fn shrinks_retention(current: &stream::Config, desired: &stream::Config) -> bool {
+    let shrinks = |current: i64, desired: i64| desired > 0 && (current <= 0 || desired < current);
+    shrinks(current.max_messages, desired.max_messages)
+        || shrinks(current.max_bytes, desired.max_bytes)
+        || shrinks(
+            current.max_messages_per_subject,
+            desired.max_messages_per_subject,
+        )
+        || (!desired.max_age.is_zero()
+            && (current.max_age.is_zero() || desired.max_age < current.max_age))
+}
+
+/// Change a stream from `current` to `desired` without losing messages or
+/// consumer positions. See `NatsClient::migrate_stream`.
+pub(crate) async fn migrate_stream(
+    jetstream: &jetstream::Context,
+    current: &stream::Config,
+    desired: &stream::Config,
+) -> Result<StreamMigration> {
+    let name = current.name.as_str();
+    anyhow::ensure!(
+        desired.name == name,
+        "cannot migrate stream '{}' to a config named '{}'",
+        name,
+        desired.name
+    );
+    let mut migration = StreamMigration {
+        stream: name.to_string(),
+        method: MigrationMethod::Unchanged,
+        deprecated_stream: None,
+        messages: 0,
+        consumers: Vec::new(),
+    };
+
+    // Step 1: changes JetStream applies in place without dropping messages
+    let diff = diff_stream_config(current, desired);
+    if diff.is_empty() {
+        return Ok(migration);
+    }
+    if !diff.has_unsafe_changes() && !shrinks_retention(current, desired) {
+        jetstream
+            .update_stream(desired)
+            .await
+            .context("Failed to update JetStream stream")?;
+        info!(stream = %name, changes = diff.changes.len(), "Migrated stream in place");
+        migration.method = MigrationMethod::InPlace;
+        return Ok(migration);
+    }
+
+    let deprecated = format!("{}{}", name, DEPRECATED_STREAM_SUFFIX);
+    if jetstream.get_stream(&deprecated).await.is_ok() {
+        anyhow::bail!(
+            "stream '{}' already exists; delete it before migrating '{}' again",
+            deprecated,
+            name
+        );
+    }
+    warn!(
+        stream = %name,
+        deprecated = %deprecated,
+        fields = ?diff.changes.iter().map(|c| c.field).collect::<Vec<_>>(),
+        "Migrating stream by copy"
+    );
+
+    // Step 2: mirror the old stream (same sequences) while it still takes
+    // publishes, then release its subjects and let the mirror catch up
+    jetstream
+        .create_stream(deprecated_config(current, &deprecated))
+        .await
+        .context("Failed to create deprecated stream")?;
+    let mut old = jetstream
+        .get_stream(name)
+        .await
+        .context("Failed to get JetStream stream")?;
+    if let Some(last) = last_stored_sequence(&mut old).await? {
+        wait_for_copy(jetstream, &deprecated, last).await?;
+    }
+    jetstream
+        .update_stream(&stream::Config {
+            subjects: vec![format!("{}{}", MIGRATING_SUBJECT_PREFIX, name)],
+            ..current.clone()
+        })
+        .await
+        .context("Failed to release the stream's subjects")?;
+    let last = last_stored_sequence(&mut old).await?;
+    if let Some(last) = last {
+        wait_for_copy(jetstream, &deprecated, last).await?;
+    }
+
+    // Step 3: replace the old stream; consumers go with it, so note them first
+    let consumers: Vec<consumer::Info> = old
+        .consumers()
+        .try_collect()
+        .await
+        .context("Failed to list consumers")?;
+    jetstream
+        .delete_stream(name)
+        .await
+        .context("Failed to delete JetStream stream")?;
+    jetstream
+        .create_stream(stream::Config {
+            subjects: Vec::new(),
+            republish: None,
+            sources: Some(vec![stream::Source {
+                name: deprecated.clone(),
+                ..Default::default()
+            }]),
+            ..desired.clone()
+        })
+        .await
+        .context("Failed to create the migrated stream")?;
+
+    // Step 4: replay the messages from the deprecated stream, then hand the
+    // subjects to the new stream
+    if let Some(last) = last {
+        wait_for_copy(jetstream, name, last).await?;
+    }
+    jetstream
+        .update_stream(desired)
+        .await
+        .context("Failed to restore the stream's subjects")?;
+    let mut new = jetstream
+        .get_stream(name)
+        .await
+        .context("Failed to get JetStream stream")?;
+    migration.messages = new.info().await?.state.messages;
+
+    // Step 5: recreate durable consumers where they left off
+    let durable: Vec<_> = consumers
+        .into_iter()
+        .filter(|info| info.config.durable_name.is_some())
+        .collect();
+    let floors: Vec<u64> = durable
+        .iter()
+        .map(|info| info.ack_floor.stream_sequence)
+        .collect();
+    let starts = start_sequences(&mut new, &floors).await?;
+    for (info, start_sequence) in durable.into_iter().zip(starts) {
+        let config = consumer::Config {
+            deliver_policy: consumer::DeliverPolicy::ByStartSequence { start_sequence },
+            ..info.config
+        };
+        new.create_consumer(config)
+            .await
+            .with_context(|| format!("Failed to recreate consumer '{}'", info.name))?;
+        migration.consumers.push(info.name);
+    }
+
+    info!(
+        stream = %name,
+        deprecated = %deprecated,
+        messages = migration.messages,
+        consumers = migration.consumers.len(),
+        "Migrated stream by copy"
+    );
+    migration.method = MigrationMethod::Copied;
+    migration.deprecated_stream = Some(deprecated);
+    Ok(migration)
+}
+
+/// A read-only mirror of `current` named `deprecated`, keeping its limits.
+fn deprecated_config(current: &stream::Config, deprecated: &str) -> stream::Config {
+    let mut config = stream::Config {
+        name: deprecated.to_string(),
+        subjects: Vec::new(),
+        republish: None,
+        sources: None,
+        mirror: Some(stream::Source {
+            name: current.name.clone(),
+            ..Default::default()
+        }),
+        ..current.clone()
+    };
+    config.metadata.insert(
+        DEPRECATED_LABEL.to_string(),
+        chrono::Utc::now().to_rfc3339(),
+    );
+    config
+}
+
+/// Sequence of the last message stored in `stream`, or None when empty.
+async fn last_stored_sequence(stream: &mut stream::Stream) -> Result<Option<u64>> {
+    if stream.info().await?.state.messages == 0 {
+        return Ok(None);
+    }
+    let consumer = stream
+        .create_consumer(consumer::pull::OrderedConfig {
+            deliver_policy: consumer::DeliverPolicy::Last,
+            headers_only: true,
+            ..Default::default()
+        })
+        .await
+        .context("Failed to create consumer")?;
+    let message = consumer
+        .messages()
+        .await
+        .context("Failed to read stream")?
+        .next()
+        .await
+        .context("Stream has no messages")?
+        .map_err(|e| anyhow::anyhow!("Failed to read stream: {}", e))?;
+    let sequence = message
+        .info()
+        .map_err(|e| anyhow::anyhow!("Invalid message metadata: {}", e))?
+        .stream_sequence;
+    Ok(Some(sequence))
+}
+
+/// Wait until the mirror or sourced stream `name` has copied the message at
+/// `target` (a sequence in the stream it copies from).
+async fn wait_for_copy(jetstream: &jetstream::Context, name: &str, target: u64) -> Result<()> {
+    let mut stream = jetstream
+        .get_stream(name)
+        .await
+        .context("Failed to get JetStream stream")?;
+    let (mut progress, mut since) = (0, Instant::now());
+    loop {
+        let info = stream.info().await?.clone();
+        // A mirror keeps the sequences it copies; a sourced stream numbers
+        // its own messages, so compare the source's
+        let position = if info.mirror.is_some() || info.state.messages == 0 {
+            info.state.last_sequence
+        } else {
+            source_sequence(&stream, info.state.last_sequence).await?
+        };
+        if position >= target {
+            return Ok(());
+        }
+        if position > progress {
+            (progress, since) = (position, Instant::now());
+        } else if since.elapsed() > SYNC_STALL_TIMEOUT {
+            anyhow::bail!(
+                "copy into stream '{}' stalled at sequence {} of {}",
+                name,
+                position,
+                target
+            );
+        }
+        tokio::time::sleep(SYNC_POLL_INTERVAL).await;
+    }
+}
+
+/// Sequence in the source stream of the message copied to `sequence`.
+async fn source_sequence(stream: &stream::Stream, sequence: u64) -> Result<u64> {
+    let message = stream
+        .get_raw_message(sequence)
+        .await
+        .context("Failed to read copied message")?;
+    message
+        .headers
+        .get(STREAM_SOURCE_HEADER)
+        .and_then(|value| parse_source_sequence(value.as_str()))
+        .with_context(|| format!("Message {} has no source sequence", sequence))
+}
+
+fn parse_source_sequence(header: &str) -> Option<u64> {
+    header.split_whitespace().nth(1)?.parse().ok()
+}
+
+/// For each ack floor (a sequence in the old stream), the first sequence in
+/// the new stream holding a later message, in one pass over `stream`.
+async fn start_sequences(stream: &mut stream::Stream, floors: &[u64]) -> Result<Vec<u64>> {
+    let last = stream.info().await?.state.last_sequence;
+    let mut starts = vec![last + 1; floors.len()];
+    if floors.is_empty() || last == 0 {
+        return Ok(starts);
+    }
+
+    let consumer = stream
+        .create_consumer(consumer::pull::OrderedConfig {
+            headers_only: true,
+            ..Default::default()
+        })
+        .await
+        .context("Failed to create consumer")?;
+    let mut messages = consumer.messages().await.context("Failed to read stream")?;
+    let mut unresolved = floors.len();
+    while let Some(message) = messages.next().await {
+        let message = message.map_err(|e| anyhow::anyhow!("Failed to read stream: {}", e))?;
+        let sequence = message
+            .info()
+            .map_err(|e| anyhow::anyhow!("Invalid message metadata: {}", e))?
+            .stream_sequence;
+        let source = message
+            .headers
+            .as_ref()
+            .and_then(|headers| headers.get(STREAM_SOURCE_HEADER))
+            .and_then(|value| parse_source_sequence(value.as_str()));
+        if let Some(source) = source {
+            for (start, floor) in starts.iter_mut().zip(floors) {
+                if *start > last && source > *floor {
+                    *start = sequence;
+                    unresolved -= 1;
+                }
+            }
+        }
+        if unresolved == 0 || sequence >= last {
+            break;
+        }
+    }
+    Ok(starts)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn config() -> stream::Config {
+        stream::Config {
+            name: "ORDERS".to_string(),
+            subjects: vec!["orders.>".to_string()],
+            max_age: Duration::from_secs(7 * 86400),
+            max_messages: 1000,
+            ..Default::default()
+        }
+    }
+
+    #[test]
+    fn test_shrinks_retention() {
+        let longer = stream::Config {
+            max_age: Duration::from_secs(30 * 86400),
+            max_messages: 5000,
+            ..config()
+        };
+        assert!(!shrinks_retention(&config(), &longer));
+        assert!(shrinks_retention(&longer, &config()));
+
+        let fewer = stream::Config {
+            max_messages: 10,
+            ..config()
+        };
+        assert!(shrinks_retention(&config(), &fewer));
+        // Setting a limit where there was none
+        let bounded = stream::Config {
+            max_bytes: 1 << 20,
+            ..config()
+        };
+        assert!(shrinks_retention(&config(), &bounded));
+        // Lifting one
+        assert!(!shrinks_retention(&bounded, &config()));
+    }
+
+    #[test]
+    fn test_deprecated_config_mirrors_the_stream() {
+        let deprecated = deprecated_config(&config(), "ORDERS_DEPRECATED");
+        assert_eq!(deprecated.name, "ORDERS_DEPRECATED");
+        assert!(deprecated.subjects.is_empty());
+        assert_eq!(deprecated.mirror.unwrap().name, "ORDERS");
+        assert_eq!(deprecated.max_messages, 1000);
+        assert!(deprecated.metadata.contains_key(DEPRECATED_LABEL));
+    }
+
+    #[test]
+    fn test_parse_source_sequence() {
+        assert_eq!(parse_source_sequence("ORDERS_DEPRECATED 42 > >"), Some(42));
+        assert_eq!(parse_source_sequence("ORDERS_DEPRECATED:a1b2 7"), Some(7));
+        assert_eq!(parse_source_sequence("ORDERS_DEPRECATED"), None);
+    }
+}
@@ -0,0 +1,80 @@
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, message::StreamMessage, stream::Stream};
+use tracing::debug;
+
+/// Reads stored messages by sequence or last-per-subject.
+///
+/// When the stream has `allow_direct` set, reads use the direct get API,
+/// which any replica can answer without a round trip through the JetStream
+/// API leader. Otherwise (or if a direct get fails for a reason other than a
+/// missing message) the standard get is used.
+pub struct StreamReader {
+    stream: Stream,
+    direct: bool,
+}
+
+impl StreamReader {
+    /// Look up `stream_name` and read through it.
+    pub async fn open(jetstream: &jetstream::Context, stream_name: &str) -> Result<Self> {
+        let stream = jetstream
+            .get_stream(stream_name)
+            .await
+            .context("Failed to get JetStream stream")?;
+        Ok(Self::new(stream))
+    }
+
+    /// Read through an already fetched stream handle.
+    pub fn new(stream: Stream) -> Self {
+        let direct = stream.cached_info().config.allow_direct;
+        Self { stream, direct }
+    }
+
+    /// Always use the standard get API, even if the stream allows direct gets.
+    pub fn without_direct(mut self) -> Self {
+        self.direct = false;
+        self
+    }
+
+    /// True if reads go through the direct get API.
+    pub fn is_direct(&self) -> bool {
+        self.direct
+    }
+
+    /// Message stored at `sequence`.
+    pub async fn get(&self, sequence: u64) -> Result<StreamMessage> {
+        if self.direct {
+            match self.stream.direct_get(sequence).await {
+                Ok(message) => return Ok(message),
+                Err(e) if is_not_found(&e) => {
+                    return Err(e).context("Message not found");
+                }
+                Err(e) => debug!(error = %e, sequence, "Direct get failed, using standard get"),
+            }
+        }
+        self.stream
+            .get_raw_message(sequence)
+            .await
+            .context("Failed to get message")
+    }
+
+    /// Last message stored on `subject`.
+    pub async fn get_last(&self, subject: &str) -> Result<StreamMessage> {
+        if self.direct {
+            match self.stream.direct_get_last_for_subject(subject).await {
+                Ok(message) => return Ok(message),
+                Err(e) if is_not_found(&e) => {
+                    return Err(e).context("Message not found");
+                }
+                Err(e) => debug!(error = %e, subject, "Direct get failed, using standard get"),
+            }
+        }
+        self.stream
+            .get_last_raw_message_by_subject(subject)
+            .await
+            .context("Failed to get last message")
+    }
+}
+
+fn is_not_found(error: &jetstream::stream::DirectGetError) -> bool {
+    error.kind() == jetstream::stream::DirectGetErrorKind::NotFound
+}
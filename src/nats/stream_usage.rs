@@ -0,0 +1,342 @@
+use super::publisher::EventPublisher;
+use crate::event::{FluxEvent, Priority, ValidationError};
+use anyhow::Result;
+use async_nats::jetstream::{self, stream};
+use chrono::{DateTime, Utc};
+use futures::StreamExt;
+use serde::Serialize;
+use serde_json::json;
+use std::collections::{BTreeMap, HashSet};
+use std::sync::{Arc, Mutex, RwLock};
+use std::time::Duration;
+use tokio::sync::Notify;
+use tracing::{info, warn};
+
+/// Flux stream that receives usage alerts
+pub const ALERT_STREAM: &str = "flux.system.alerts";
+
+/// An alert re-arms only once usage drops this many points below the threshold,
+/// so a stream hovering around the threshold does not alert on every poll.
+const REARM_MARGIN_PCT: f64 = 5.0;
+
+/// Usage of one JetStream stream against its configured limits.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct StreamUsage {
+    pub stream: String,
+    pub bytes: u64,
+    /// Stream byte limit (-1 = unlimited)
+    pub max_bytes: i64,
+    pub messages: u64,
+    /// Stream message limit (-1 = unlimited)
+    pub max_messages: i64,
+    /// Percentage of `max_bytes` used (None if unlimited)
+    pub bytes_pct: Option<f64>,
+    /// Percentage of `max_messages` used (None if unlimited)
+    pub messages_pct: Option<f64>,
+    pub updated_at: DateTime<Utc>,
+}
+
+impl StreamUsage {
+    pub fn new(
+        stream: String,
+        bytes: u64,
+        max_bytes: i64,
+        messages: u64,
+        max_messages: i64,
+    ) -> Self {
+        Self {
+            bytes_pct: usage_pct(bytes, max_bytes),
+            messages_pct: usage_pct(messages, max_messages),
+            stream,
+            bytes,
+            max_bytes,
+            messages,
+            max_messages,
+            updated_at: Utc::now(),
+        }
+    }
+
+    fn from_info(info: &stream::Info) -> Self {
+        Self::new(
+            info.config.name.clone(),
+            info.state.bytes,
+            info.config.max_bytes,
+            info.state.messages,
+            info.config.max_messages,
+        )
+    }
+}
+
+fn usage_pct(used: u64, limit: i64) -> Option<f64> {
+    if limit <= 0 {
+        return None;
+    }
+    Some(used as f64 / limit as f64 * 100.0)
+}
+
+/// A threshold crossing for one stream limit.
+#[derive(Debug, Clone, PartialEq)]
+pub struct StreamUsageAlert {
+    pub stream: String,
+    /// "bytes" or "messages"
+    pub metric: &'static str,
+    pub usage_pct: f64,
+    pub threshold_pct: f64,
+    pub used: u64,
+    pub limit: i64,
+}
+
+impl StreamUsageAlert {
+    /// Alert as a FluxEvent on `ALERT_STREAM`, keyed by the JetStream stream.
+    pub fn to_event(&self) -> Result<FluxEvent, ValidationError> {
+        FluxEvent::builder(ALERT_STREAM)
+            .source("flux")
+            .key(self.stream.clone())
+            .priority(Priority::High)
+            .payload(json!({
+                "entity_id": format!("flux/stream-usage-{}", self.stream.to_lowercase()),
+                "properties": {
+                    "alert": "stream_usage",
+                    "stream": self.stream,
+                    "metric": self.metric,
+                    "usage_pct": self.usage_pct,
+                    "threshold_pct": self.threshold_pct,
+                    "used": self.used,
+                    "limit": self.limit,
+                }
+            }))
+            .build()
+    }
+}
+
+/// Threshold state per (stream, metric): fires once per crossing.
+struct UsageAlerts {
+    threshold_pct: f64,
+    /// (stream, metric) pairs currently above the threshold
+    triggered: HashSet<(String, &'static str)>,
+}
+
+impl UsageAlerts {
+    fn new(threshold_pct: f64) -> Self {
+        Self {
+            threshold_pct,
+            triggered: HashSet::new(),
+        }
+    }
+
+    fn evaluate(&mut self, usages: &[StreamUsage]) -> Vec<StreamUsageAlert> {
+        let mut alerts = Vec::new();
+        for usage in usages {
+            let metrics = [
+                ("bytes", usage.bytes_pct, usage.bytes, usage.max_bytes),
+                (
+                    "messages",
+                    usage.messages_pct,
+                    usage.messages,
+                    usage.max_messages,
+                ),
+            ];
+            for (metric, pct, used, limit) in metrics {
+                let key = (usage.stream.clone(), metric);
+                let Some(pct) = pct else {
+                    self.triggered.remove(&key);
+                    continue;
+                };
+                if pct >= self.threshold_pct {
+                    if self.triggered.insert(key) {
+                        alerts.push(StreamUsageAlert {
+                            stream: usage.stream.clone(),
+                            metric,
+                            usage_pct: pct,
+                            threshold_pct: self.threshold_pct,
+                            used,
+                            limit,
+                        });
+                    }
+                } else if pct < self.threshold_pct - REARM_MARGIN_PCT {
+                    self.triggered.remove(&key);
+                }
+            }
+        }
+        alerts
+    }
+}
+
+/// Polls every JetStream stream's usage against its `max_bytes` / `max_messages`.
+///
+/// Usage is cached for `GET /api/metrics/streams`. When a stream reaches the
+/// alert threshold, a warning is logged and (with `with_alerts`) an event is
+/// published to `flux.system.alerts`, once per crossing.
+pub struct StreamUsageMonitor {
+    jetstream: jetstream::Context,
+    poll_interval: Duration,
+    threshold_pct: f64,
+    publisher: Option<EventPublisher>,
+    cached: RwLock<BTreeMap<String, StreamUsage>>,
+    alerts: Mutex<UsageAlerts>,
+    shutdown: Notify,
+}
+
+impl StreamUsageMonitor {
+    pub fn new(jetstream: jetstream::Context, poll_interval: Duration, threshold_pct: f64) -> Self {
+        Self {
+            jetstream,
+            poll_interval,
+            threshold_pct,
+            publisher: None,
+            cached: RwLock::new(BTreeMap::new()),
+            alerts: Mutex::new(UsageAlerts::new(threshold_pct)),
+            shutdown: Notify::new(),
+        }
+    }
+
+    /// Publish alerts to `flux.system.alerts` via `publisher`.
+    pub fn with_alerts(mut self, publisher: EventPublisher) -> Self {
+        self.publisher = Some(publisher);
+        self
+    }
+
+    /// Cached usage for one JetStream stream
+    pub fn get(&self, stream: &str) -> Option<StreamUsage> {
+        self.cached.read().unwrap().get(stream).cloned()
+    }
+
+    /// Cached usage for all JetStream streams, sorted by name
+    pub fn list(&self) -> Vec<StreamUsage> {
+        self.cached.read().unwrap().values().cloned().collect()
+    }
+
+    /// Query current usage of one JetStream stream, bypassing the cache.
+    pub async fn fetch(&self, stream: &str) -> Result<StreamUsage> {
+        let mut stream = self.jetstream.get_stream(stream).await?;
+        Ok(StreamUsage::from_info(stream.info().await?))
+    }
+
+    /// Poll once, update the cache and emit alerts for new crossings.
+    pub async fn refresh(&self) -> Result<()> {
+        let mut usages = Vec::new();
+        let mut streams = self.jetstream.streams();
+        while let Some(info) = streams.next().await {
+            usages.push(StreamUsage::from_info(&info?));
+        }
+
+        for alert in self.record(usages) {
+            warn!(
+                stream = %alert.stream,
+                metric = alert.metric,
+                usage_pct = alert.usage_pct,
+                "JetStream stream usage above {}%",
+                alert.threshold_pct
+            );
+            if let Some(publisher) = &self.publisher {
+                let result = match alert.to_event() {
+                    Ok(event) => publisher.publish(&event).await,
+                    Err(e) => Err(e.into()),
+                };
+                if let Err(e) = result {
+                    warn!(error = %e, stream = %alert.stream, "Failed to publish stream usage alert");
+                }
+            }
+        }
+        Ok(())
+    }
+
+    /// Replace the cache with `usages` and return alerts for new threshold crossings.
+    pub fn record(&self, usages: Vec<StreamUsage>) -> Vec<StreamUsageAlert> {
+        let alerts = self.alerts.lock().unwrap().evaluate(&usages);
+        *self.cached.write().unwrap() = usages
+            .into_iter()
+            .map(|usage| (usage.stream.clone(), usage))
+            .collect();
+        alerts
+    }
+
+    /// Run the polling loop until `stop` is called.
+    pub async fn run(self: Arc<Self>) {
+        info!(
+            interval_secs = self.poll_interval.as_secs(),
+            threshold_pct = self.threshold_pct,
+            "Starting JetStream stream usage monitor"
+        );
+        let mut interval = tokio::time::interval(self.poll_interval);
+
+        loop {
+            tokio::select! {
+                _ = interval.tick() => {
+                    if let Err(e) = self.refresh().await {
+                        warn!(error = %e, "Failed to query JetStream stream usage");
+                    }
+                }
+                _ = self.shutdown.notified() => break,
+            }
+        }
+
+        info!("JetStream stream usage monitor stopped");
+    }
+
+    /// Stop the polling loop.
+    pub fn stop(&self) {
+        self.shutdown.notify_one();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn usage(bytes: u64, max_bytes: i64, messages: u64) -> StreamUsage {
+        StreamUsage::new("FLUX_EVENTS".to_string(), bytes, max_bytes, messages, -1)
+    }
+
+    #[test]
+    fn test_usage_pct() {
+        let u = usage(9_800, 10_000, 5);
+        assert_eq!(u.bytes_pct, Some(98.0));
+        assert_eq!(u.messages_pct, None);
+    }
+
+    #[test]
+    fn test_alert_once_per_crossing() {
+        let mut alerts = UsageAlerts::new(80.0);
+
+        assert!(alerts.evaluate(&[usage(5_000, 10_000, 0)]).is_empty());
+
+        let fired = alerts.evaluate(&[usage(8_500, 10_000, 0)]);
+        assert_eq!(fired.len(), 1);
+        assert_eq!(fired[0].metric, "bytes");
+        assert_eq!(fired[0].usage_pct, 85.0);
+
+        // Still above: no repeat
+        assert!(alerts.evaluate(&[usage(9_000, 10_000, 0)]).is_empty());
+        // Dipping just under the threshold does not re-arm
+        assert!(alerts.evaluate(&[usage(7_800, 10_000, 0)]).is_empty());
+        assert!(alerts.evaluate(&[usage(8_100, 10_000, 0)]).is_empty());
+
+        // Dropping below threshold - margin re-arms
+        assert!(alerts.evaluate(&[usage(7_000, 10_000, 0)]).is_empty());
+        assert_eq!(alerts.evaluate(&[usage(8_000, 10_000, 0)]).len(), 1);
+    }
+
+    #[test]
+    fn test_unlimited_never_alerts() {
+        let mut alerts = UsageAlerts::new(0.0);
+        assert!(alerts.evaluate(&[usage(10_000, -1, 10_000)]).is_empty());
+    }
+
+    #[test]
+    fn test_alert_event() {
+        let alert = StreamUsageAlert {
+            stream: "FLUX_EVENTS".to_string(),
+            metric: "bytes",
+            usage_pct: 98.0,
+            threshold_pct: 80.0,
+            used: 9_800,
+            limit: 10_000,
+        };
+        let event = alert.to_event().unwrap();
+        assert_eq!(event.stream, ALERT_STREAM);
+        assert_eq!(event.key.as_deref(), Some("FLUX_EVENTS"));
+        assert_eq!(event.payload["properties"]["metric"], "bytes");
+        assert_eq!(event.payload["entity_id"], "flux/stream-usage-flux_events");
+    }
+}
@@ -0,0 +1,219 @@
+//! Mapping between Flux stream names and NATS subjects.
+//!
+//! A Flux stream `sensors.temp` is published on `flux.events.sensors.temp`,
+//! and high/critical events on `flux.events.sensors.temp.p.high`.
+
+/// Prefix of every event subject
+pub const SUBJECT_PREFIX: &str = "flux.events";
+
+/// Subject suffix for high and critical events, so consumers can drain them first
+pub const HIGH_PRIORITY_SUFFIX: &str = "p.high";
+
+/// NATS subject carrying events for a Flux stream.
+pub fn stream_subject(stream: &str) -> String {
+    format!("{}.{}", SUBJECT_PREFIX, stream)
+}
+
+/// NATS subject carrying high/critical events for a Flux stream.
+pub fn high_priority_subject(stream: &str) -> String {
+    format!("{}.{}.{}", SUBJECT_PREFIX, stream, HIGH_PRIORITY_SUFFIX)
+}
+
+/// Filter subjects for a consumer of everything on a Flux stream: the stream
+/// subject plus its sub-subjects, which carry high/critical events and keyed
+/// subject mappings.
+pub fn stream_filter_subjects(stream: &str) -> Vec<String> {
+    let subject = stream_subject(stream);
+    vec![subject.clone(), format!("{}.>", subject)]
+}
+
+/// Flux stream name for an event subject (the inverse of `stream_subject` and
+/// `high_priority_subject`).
+///
+/// Returns None for subjects outside `flux.events.`. A stream whose own name
+/// ends in `.p.high` cannot be told apart from the high-priority subject of
+/// its parent and maps to the parent.
+pub fn stream_from_subject(subject: &str) -> Option<&str> {
+    let stream = subject
+        .strip_prefix(SUBJECT_PREFIX)?
+        .strip_prefix('.')
+        .filter(|rest| !rest.is_empty())?;
+    Some(
+        stream
+            .strip_suffix(HIGH_PRIORITY_SUFFIX)
+            .and_then(|rest| rest.strip_suffix('.'))
+            .filter(|rest| !rest.is_empty())
+            .unwrap_or(stream),
+    )
+}
+
+/// JetStream subjects capturing a Flux stream and every stream below it, e.g.
+/// `flux.events.sensor.readings` and `flux.events.sensor.readings.>` (which
+/// also covers `sensor.readings.zone1` and the high-priority subjects).
+pub fn wildcard_subjects(stream: &str) -> Vec<String> {
+    let subject = stream_subject(stream);
+    vec![format!("{}.>", subject), subject]
+}
+
+/// True if `stream` is `prefix` or a stream below it (`plant.a` is in
+/// `plant`; `plantation` is not). An empty prefix covers every stream.
+pub fn stream_in_prefix(stream: &str, prefix: &str) -> bool {
+    prefix.is_empty()
+        || stream
+            .strip_prefix(prefix)
+            .is_some_and(|rest| rest.is_empty() || rest.starts_with('.'))
+}
+
+/// True if the concrete `subject` matches `pattern` (`*` one token, `>` one or
+/// more trailing tokens).
+pub fn subject_matches(pattern: &str, subject: &str) -> bool {
+    let mut pattern = pattern.split('.');
+    let mut subject = subject.split('.');
+    loop {
+        match (pattern.next(), subject.next()) {
+            (None, None) => return true,
+            (Some(">"), Some(_)) => return true,
+            (Some(p), Some(s)) if p == "*" || p == s => {}
+            _ => return false,
+        }
+    }
+}
+
+/// True if some subject could match both patterns (`*` one token, `>` one or
+/// more trailing tokens). Subject-mapping tokens such as `{{wildcard(1)}}`
+/// count as `*`.
+pub fn subjects_overlap(a: &str, b: &str) -> bool {
+    let is_any = |token: &str| token == "*" || token.starts_with("{{");
+    let mut a = a.split('.');
+    let mut b = b.split('.');
+    loop {
+        match (a.next(), b.next()) {
+            (None, None) => return true,
+            (Some(">"), Some(_)) | (Some(_), Some(">")) => return true,
+            (Some(x), Some(y)) if x == y || is_any(x) || is_any(y) => {}
+            _ => return false,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::event::is_valid_stream_name;
+    use rand::Rng;
+
+    #[test]
+    fn test_stream_subject() {
+        assert_eq!(stream_subject("alarms.events"), "flux.events.alarms.events");
+        assert_eq!(high_priority_subject("alarms"), "flux.events.alarms.p.high");
+    }
+
+    #[test]
+    fn test_stream_from_subject() {
+        assert_eq!(stream_from_subject("flux.events.alarms"), Some("alarms"));
+        assert_eq!(
+            stream_from_subject("flux.events.alarms.events"),
+            Some("alarms.events")
+        );
+        assert_eq!(
+            stream_from_subject("flux.events.alarms.p.high"),
+            Some("alarms")
+        );
+        // A stream literally named "p.high"
+        assert_eq!(stream_from_subject("flux.events.p.high"), Some("p.high"));
+    }
+
+    #[test]
+    fn test_stream_from_subject_rejects_foreign_subjects() {
+        assert_eq!(stream_from_subject(""), None);
+        assert_eq!(stream_from_subject("flux.events"), None);
+        assert_eq!(stream_from_subject("flux.events."), None);
+        assert_eq!(stream_from_subject("flux.eventsx.alarms"), None);
+        assert_eq!(stream_from_subject("other.events.alarms"), None);
+    }
+
+    #[test]
+    fn test_stream_in_prefix() {
+        assert!(stream_in_prefix("plant", "plant"));
+        assert!(stream_in_prefix("plant.a.temp", "plant"));
+        assert!(stream_in_prefix("sensors", ""));
+        assert!(!stream_in_prefix("plantation", "plant"));
+        assert!(!stream_in_prefix("plan", "plant"));
+    }
+
+    #[test]
+    fn test_subject_matches() {
+        assert!(subject_matches("flux.events.>", "flux.events.sensors"));
+        assert!(subject_matches("flux.events.>", "flux.events.sensors.p.high"));
+        assert!(subject_matches("flux.*.sensors", "flux.events.sensors"));
+        assert!(subject_matches("flux.events.sensors", "flux.events.sensors"));
+        assert!(!subject_matches("flux.events.>", "flux.events"));
+        assert!(!subject_matches("flux.events.sensors", "flux.events.sensors.zone1"));
+        assert!(!subject_matches("flux.*", "flux.events.sensors"));
+    }
+
+    #[test]
+    fn test_wildcard_subjects_capture_sub_streams() {
+        let subjects = wildcard_subjects("sensor.readings");
+        for stream in ["sensor.readings", "sensor.readings.zone1", "sensor.readings.a.b"] {
+            assert!(subjects
+                .iter()
+                .any(|pattern| subject_matches(pattern, &stream_subject(stream))));
+            assert!(subjects
+                .iter()
+                .any(|pattern| subject_matches(pattern, &high_priority_subject(stream))));
+        }
+        assert!(!subjects
+            .iter()
+            .any(|pattern| subject_matches(pattern, &stream_subject("sensor.other"))));
+    }
+
+    #[test]
+    fn test_subjects_overlap() {
+        assert!(subjects_overlap("flux.events.>", "flux.events.sensors"));
+        assert!(subjects_overlap("flux.events.sensors", "flux.*.sensors"));
+        assert!(subjects_overlap("flux.>", "flux.events.>"));
+        assert!(subjects_overlap("live.{{wildcard(1)}}", "live.sensors"));
+        assert!(!subjects_overlap("live.>", "flux.events.>"));
+        assert!(!subjects_overlap("flux.events.>", "flux.events"));
+        assert!(!subjects_overlap("flux.events.a", "flux.events.a.b"));
+        assert!(!subjects_overlap("flux.*", "flux.events.sensors"));
+    }
+
+    /// Random valid stream name: 1-5 segments of [a-z0-9]
+    fn random_stream_name(rng: &mut impl Rng) -> String {
+        const CHARS: &[u8] = b"abcdefghijklmnopqrstuvwxyz0123456789";
+        let segments = rng.gen_range(1..=5);
+        (0..segments)
+            .map(|_| {
+                let len = rng.gen_range(1..=12);
+                (0..len)
+                    .map(|_| CHARS[rng.gen_range(0..CHARS.len())] as char)
+                    .collect::<String>()
+            })
+            .collect::<Vec<_>>()
+            .join(".")
+    }
+
+    #[test]
+    fn test_round_trip_property() {
+        let mut rng = rand::thread_rng();
+        for name in std::iter::once("alarms.events".to_string())
+            .chain(std::iter::repeat_with(|| random_stream_name(&mut rng)).take(2_000))
+        {
+            assert!(is_valid_stream_name(&name));
+            if name.ends_with(".p.high") {
+                // Ambiguous with the parent's high-priority subject
+                continue;
+            }
+            assert_eq!(
+                stream_from_subject(&stream_subject(&name)),
+                Some(name.as_str())
+            );
+            assert_eq!(
+                stream_from_subject(&high_priority_subject(&name)),
+                Some(name.as_str())
+            );
+        }
+    }
+}
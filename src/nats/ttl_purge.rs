@@ -0,0 +1,238 @@
+use super::subject::stream_in_prefix;
+use crate::clock::{self, SharedClock};
+use crate::event::{FluxEvent, ValidationError};
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, kv};
+use futures::TryStreamExt;
+use serde::Deserialize;
+use std::collections::HashMap;
+use std::sync::Arc;
+use std::time::Duration;
+use tracing::{debug, info, warn};
+
+/// JetStream KV bucket of pending per-event TTL purges
+pub const TTL_INDEX_BUCKET: &str = "FLUX_TTL_INDEX";
+
+/// NATS header carrying an event's `ttlMs`
+pub const TTL_HEADER: &str = "x-flux-ttl-ms";
+
+/// Purge events once their TTL passes (`[nats.ttl_purge]`), for streams
+/// whose events expire well before the stream's retention.
+#[derive(Clone, Debug, Deserialize)]
+pub struct TtlPurgeConfig {
+    /// Flux streams (and the streams below them) whose TTLs are enforced
+    pub streams: Vec<String>,
+    /// How often to purge what has expired (seconds)
+    #[serde(default = "default_ttl_purge_interval")]
+    pub interval_seconds: u64,
+}
+
+fn default_ttl_purge_interval() -> u64 {
+    10
+}
+
+/// Best-effort per-event TTL for the event stream.
+///
+/// The publisher records the subject and sequence of every event with a TTL
+/// on an opted-in stream in `TTL_INDEX_BUCKET`, keyed by expiry time.
+/// `purge_expired` then purges each expired subject up to the expired
+/// sequence. Purges work per subject, so earlier events without a TTL on the
+/// same subject go with it; give expiring events their own subjects (e.g. a
+/// subject mapping by key).
+pub struct TtlPurger {
+    jetstream: jetstream::Context,
+    kv: kv::Store,
+    stream_name: String,
+    max_age: Duration,
+    config: TtlPurgeConfig,
+    clock: SharedClock,
+}
+
+impl TtlPurger {
+    /// Open (or create) the index bucket for events stored in `stream_name`,
+    /// whose retention is `max_age` (TTLs must be shorter).
+    pub async fn open(
+        jetstream: &jetstream::Context,
+        stream_name: impl Into<String>,
+        max_age: Duration,
+        config: TtlPurgeConfig,
+    ) -> Result<Self> {
+        let kv = match jetstream.get_key_value(TTL_INDEX_BUCKET).await {
+            Ok(kv) => kv,
+            Err(_) => jetstream
+                .create_key_value(kv::Config {
+                    bucket: TTL_INDEX_BUCKET.to_string(),
+                    description: "Flux pending TTL purges".to_string(),
+                    history: 1,
+                    max_age,
+                    ..Default::default()
+                })
+                .await
+                .context("Failed to create TTL index bucket")?,
+        };
+
+        Ok(Self {
+            jetstream: jetstream.clone(),
+            kv,
+            stream_name: stream_name.into(),
+            max_age,
+            config,
+            clock: clock::system(),
+        })
+    }
+
+    /// Decide what has expired with `clock` instead of the system clock.
+    pub fn with_clock(mut self, clock: SharedClock) -> Self {
+        self.clock = clock;
+        self
+    }
+
+    /// True if `event` has a TTL and is on an opted-in stream.
+    pub fn applies_to(&self, event: &FluxEvent) -> bool {
+        event.ttl_ms.is_some()
+            && self
+                .config
+                .streams
+                .iter()
+                .any(|prefix| stream_in_prefix(&event.stream, prefix))
+    }
+
+    /// Reject TTLs that are not positive or not shorter than the stream's
+    /// retention (which would expire the event first anyway).
+    pub fn check(&self, event: &FluxEvent) -> Result<(), ValidationError> {
+        let Some(ttl_ms) = event.ttl_ms else {
+            return Ok(());
+        };
+        let retention_ms = self.max_age.as_millis();
+        if ttl_ms == 0 || (retention_ms > 0 && ttl_ms as u128 >= retention_ms) {
+            return Err(ValidationError::TtlOutOfRange(ttl_ms));
+        }
+        Ok(())
+    }
+
+    /// Schedule the purge of `subject` up to `sequence` for when `event`
+    /// expires.
+    pub async fn record(&self, event: &FluxEvent, subject: &str, sequence: u64) -> Result<()> {
+        let expires_at = event.timestamp + event.ttl_ms.unwrap_or_default() as i64;
+        self.kv
+            .put(
+                index_key(expires_at, sequence),
+                subject.to_string().into_bytes().into(),
+            )
+            .await
+            .context("Failed to write TTL index entry")?;
+        Ok(())
+    }
+
+    /// Purge every subject with an event expired at `now_ms`, then drop the
+    /// index entries. Returns the number of messages purged.
+    pub async fn purge_expired(&self, now_ms: i64) -> Result<u64> {
+        let keys: Vec<String> = self
+            .kv
+            .keys()
+            .await
+            .context("Failed to list TTL index")?
+            .try_collect()
+            .await
+            .context("Failed to list TTL index")?;
+        let due: Vec<(String, u64)> = keys
+            .into_iter()
+            .filter_map(|key| {
+                let (expires_at, sequence) = parse_index_key(&key)?;
+                (expires_at <= now_ms).then_some((key, sequence))
+            })
+            .collect();
+        if due.is_empty() {
+            return Ok(0);
+        }
+
+        // Highest expired sequence per subject: one purge covers the rest
+        let mut up_to: HashMap<String, u64> = HashMap::new();
+        for (key, sequence) in &due {
+            let Some(subject) = self.kv.get(key).await.context("Failed to read TTL index")? else {
+                continue;
+            };
+            let subject = String::from_utf8_lossy(&subject).into_owned();
+            let highest = up_to.entry(subject).or_default();
+            *highest = (*highest).max(*sequence);
+        }
+
+        let stream = self
+            .jetstream
+            .get_stream(&self.stream_name)
+            .await
+            .context("Failed to get JetStream stream")?;
+        let mut purged = 0;
+        for (subject, sequence) in &up_to {
+            let response = stream
+                .purge()
+                .filter(subject)
+                .sequence(sequence + 1)
+                .await
+                .context("Failed to purge expired events")?;
+            debug!(
+                subject = %subject,
+                up_to = sequence,
+                purged = response.purged,
+                "Purged expired subject"
+            );
+            purged += response.purged;
+        }
+        for (key, _) in &due {
+            self.kv
+                .purge(key)
+                .await
+                .context("Failed to remove TTL index entry")?;
+        }
+        if purged > 0 {
+            info!(
+                stream = %self.stream_name,
+                subjects = up_to.len(),
+                purged,
+                "Purged expired events"
+            );
+        }
+        Ok(purged)
+    }
+
+    /// Purge expired events every `interval_seconds`, forever.
+    pub async fn run(self: Arc<Self>) {
+        info!(
+            streams = ?self.config.streams,
+            interval_secs = self.config.interval_seconds,
+            "Starting TTL purger"
+        );
+        let mut interval =
+            tokio::time::interval(Duration::from_secs(self.config.interval_seconds.max(1)));
+        loop {
+            interval.tick().await;
+            if let Err(e) = self.purge_expired(self.clock.now_millis()).await {
+                warn!(error = %e, "TTL purge failed");
+            }
+        }
+    }
+}
+
+/// Index key: expiry time then sequence, both valid KV key tokens.
+fn index_key(expires_at: i64, sequence: u64) -> String {
+    format!("{}.{}", expires_at, sequence)
+}
+
+fn parse_index_key(key: &str) -> Option<(i64, u64)> {
+    let (expires_at, sequence) = key.split_once('.')?;
+    Some((expires_at.parse().ok()?, sequence.parse().ok()?))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_index_key_round_trip() {
+        let key = index_key(1707668460000, 42);
+        assert_eq!(key, "1707668460000.42");
+        assert_eq!(parse_index_key(&key), Some((1707668460000, 42)));
+        assert_eq!(parse_index_key("1707668460000"), None);
+        assert_eq!(parse_index_key("soon.42"), None);
+    }
+}
@@ -5,6 +5,7 @@
 // take effect immediately for new refill calculations.
 
 use dashmap::DashMap;
+use serde::Serialize;
 use std::time::Instant;
 
 /// Token bucket for a single namespace.
@@ -38,20 +39,43 @@ impl TokenBucket {
     }
 }
 
+/// Tokens left in one namespace's bucket, as of its last refill.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct BucketSnapshot {
+    pub namespace: String,
+    pub tokens: f64,
+    /// True for the separate critical-event budget
+    pub critical: bool,
+}
+
 /// Per-namespace token bucket rate limiter.
 ///
 /// Buckets are created lazily on first event. State is in-memory only (resets on restart).
 pub struct RateLimiter {
     buckets: DashMap<String, TokenBucket>,
+    /// Separate budget for critical events, so alarms are not starved by bulk traffic
+    critical_buckets: DashMap<String, TokenBucket>,
 }
 
 impl RateLimiter {
     pub fn new() -> Self {
         Self {
             buckets: DashMap::new(),
+            critical_buckets: DashMap::new(),
         }
     }
 
+    /// Check and consume one token from `namespace`'s critical-event budget.
+    ///
+    /// Critical events are exempt from the regular limit and never consume it.
+    pub fn check_and_consume_critical(&self, namespace: &str, limit_per_minute: u64) -> bool {
+        let mut bucket = self
+            .critical_buckets
+            .entry(namespace.to_string())
+            .or_insert_with(|| TokenBucket::new(limit_per_minute));
+        bucket.try_consume(limit_per_minute)
+    }
+
     /// Check and consume one token for `namespace` at `limit_per_minute`.
     ///
     /// Returns true if the request is allowed, false if rate limit exceeded.
@@ -62,6 +86,31 @@ impl RateLimiter {
             .or_insert_with(|| TokenBucket::new(limit_per_minute));
         bucket.try_consume(limit_per_minute)
     }
+
+    /// Number of buckets (regular plus critical).
+    pub fn len(&self) -> usize {
+        self.buckets.len() + self.critical_buckets.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+
+    /// Up to `limit` buckets, regular first, for diagnostics. Only takes
+    /// shard read locks, so it does not block ingestion for long.
+    pub fn snapshot(&self, limit: usize) -> Vec<BucketSnapshot> {
+        let regular = self.buckets.iter().map(|entry| (entry, false));
+        let critical = self.critical_buckets.iter().map(|entry| (entry, true));
+        regular
+            .chain(critical)
+            .take(limit)
+            .map(|(entry, critical)| BucketSnapshot {
+                namespace: entry.key().clone(),
+                tokens: entry.value().tokens,
+                critical,
+            })
+            .collect()
+    }
 }
 
 #[cfg(test)]
@@ -94,6 +143,17 @@ mod tests {
         assert!(limiter.check_and_consume("ns2", 1));
     }
 
+    #[test]
+    fn test_critical_budget_is_separate() {
+        let limiter = RateLimiter::new();
+        // Drain the regular bucket
+        assert!(limiter.check_and_consume("ns1", 1));
+        assert!(!limiter.check_and_consume("ns1", 1));
+        // Critical events still have their own budget
+        assert!(limiter.check_and_consume_critical("ns1", 1));
+        assert!(!limiter.check_and_consume_critical("ns1", 1));
+    }
+
     #[test]
     fn test_refill_over_time() {
         let limiter = RateLimiter::new();
@@ -117,4 +177,23 @@ mod tests {
         // 20ms at 60 tokens/sec = 1.2 tokens refilled → next should be allowed
         assert!(limiter2.check_and_consume("ns1", 3600));
     }
+
+    #[test]
+    fn test_snapshot_is_bounded() {
+        let limiter = RateLimiter::new();
+        assert!(limiter.is_empty());
+        for ns in ["ns1", "ns2", "ns3"] {
+            limiter.check_and_consume(ns, 10);
+        }
+        limiter.check_and_consume_critical("ns1", 10);
+
+        assert_eq!(limiter.len(), 4);
+        assert_eq!(limiter.snapshot(2).len(), 2);
+        let all = limiter.snapshot(100);
+        assert_eq!(all.len(), 4);
+        let critical: Vec<_> = all.iter().filter(|b| b.critical).collect();
+        assert_eq!(critical.len(), 1);
+        assert_eq!(critical[0].namespace, "ns1");
+        assert!((critical[0].tokens - 9.0).abs() < 0.01);
+    }
 }
@@ -0,0 +1,308 @@
+use crate::event::FluxEvent;
+use serde::{Deserialize, Serialize};
+use serde_json::{Map, Value};
+use std::cmp::Ordering;
+use std::collections::BTreeMap;
+
+/// Comparison a condition applies to the value at its path.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Op {
+    Eq,
+    Ne,
+    Gt,
+    Gte,
+    Lt,
+    Lte,
+    /// Equal to one of the values in an array
+    In,
+    /// The path is present (any value, including null)
+    Exists,
+}
+
+/// One predicate over an event, e.g.
+/// `{"path": "payload.properties.severity", "op": "eq", "value": "critical"}`.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Condition {
+    /// `payload.<field>[.<field>...]` (array elements by index),
+    /// `headers.<name>`, or an envelope field: `stream`, `source`, `key`,
+    /// `schema`, `priority`, `timestamp`
+    pub path: String,
+    pub op: Op,
+    /// Operand: an array for `in`, a number or string for ordering
+    /// comparisons, unused for `exists`
+    #[serde(default)]
+    pub value: Value,
+}
+
+const ENVELOPE_FIELDS: [&str; 6] = ["stream", "source", "key", "schema", "priority", "timestamp"];
+
+impl Condition {
+    pub fn validate(&self) -> Result<(), String> {
+        let valid_path = match self.path.split_once('.') {
+            Some(("payload", rest)) => rest.split('.').all(|segment| !segment.is_empty()),
+            Some(("headers", name)) => !name.is_empty(),
+            Some(_) => false,
+            None => ENVELOPE_FIELDS.contains(&self.path.as_str()),
+        };
+        if !valid_path {
+            return Err(format!(
+                "invalid path '{}': use payload.<field>, headers.<name> or one of {}",
+                self.path,
+                ENVELOPE_FIELDS.join(", ")
+            ));
+        }
+        match self.op {
+            Op::In if !self.value.is_array() => {
+                Err(format!("'in' on '{}' needs an array value", self.path))
+            }
+            Op::Gt | Op::Gte | Op::Lt | Op::Lte
+                if !self.value.is_number() && !self.value.is_string() =>
+            {
+                Err(format!(
+                    "ordering comparison on '{}' needs a number or string value",
+                    self.path
+                ))
+            }
+            _ => Ok(()),
+        }
+    }
+
+    /// True if the condition holds for `event` with NATS `headers`.
+    pub fn matches(&self, event: &FluxEvent, headers: &BTreeMap<String, String>) -> bool {
+        let actual = lookup(&self.path, event, headers);
+        match self.op {
+            Op::Exists => actual.is_some(),
+            Op::Eq => actual.map_or(false, |actual| equal(&actual, &self.value)),
+            Op::Ne => actual.map_or(true, |actual| !equal(&actual, &self.value)),
+            Op::In => actual.map_or(false, |actual| {
+                self.value
+                    .as_array()
+                    .map_or(false, |values| values.iter().any(|v| equal(&actual, v)))
+            }),
+            Op::Gt | Op::Gte | Op::Lt | Op::Lte => {
+                let Some(ordering) = actual.and_then(|actual| compare(&actual, &self.value)) else {
+                    return false;
+                };
+                match self.op {
+                    Op::Gt => ordering == Ordering::Greater,
+                    Op::Gte => ordering != Ordering::Less,
+                    Op::Lt => ordering == Ordering::Less,
+                    _ => ordering != Ordering::Greater,
+                }
+            }
+        }
+    }
+}
+
+/// True if every condition holds (an empty filter matches everything).
+pub fn matches_all(
+    conditions: &[Condition],
+    event: &FluxEvent,
+    headers: &BTreeMap<String, String>,
+) -> bool {
+    conditions
+        .iter()
+        .all(|condition| condition.matches(event, headers))
+}
+
+fn lookup(path: &str, event: &FluxEvent, headers: &BTreeMap<String, String>) -> Option<Value> {
+    match path.split_once('.') {
+        Some(("payload", rest)) => rest
+            .split('.')
+            .try_fold(&event.payload, |value, segment| match value {
+                Value::Object(map) => map.get(segment),
+                Value::Array(items) => items.get(segment.parse::<usize>().ok()?),
+                _ => None,
+            })
+            .cloned(),
+        Some(("headers", name)) => headers.get(name).cloned().map(Value::String),
+        _ => match path {
+            "stream" => Some(Value::String(event.stream.clone())),
+            "source" => Some(Value::String(event.source.clone())),
+            "key" => event.key.clone().map(Value::String),
+            "schema" => event.schema.clone().map(Value::String),
+            "priority" => Some(Value::String(event.priority().as_str().to_string())),
+            "timestamp" => Some(Value::from(event.timestamp)),
+            _ => None,
+        },
+    }
+}
+
+/// JSON equality, except that numbers compare by value (1 == 1.0).
+fn equal(a: &Value, b: &Value) -> bool {
+    match (a.as_f64(), b.as_f64()) {
+        (Some(a), Some(b)) => a == b,
+        _ => a == b,
+    }
+}
+
+/// Numbers compare numerically and strings lexicographically; anything else
+/// is unordered.
+fn compare(a: &Value, b: &Value) -> Option<Ordering> {
+    match (a, b) {
+        (Value::Number(a), Value::Number(b)) => a.as_f64()?.partial_cmp(&b.as_f64()?),
+        (Value::String(a), Value::String(b)) => Some(a.cmp(b)),
+        _ => None,
+    }
+}
+
+/// Copy of `payload` holding only `fields` (dotted paths into the payload),
+/// keeping their nesting. Fields the payload does not have are skipped.
+pub fn project(payload: &Value, fields: &[String]) -> Value {
+    let mut projected = Map::new();
+    'fields: for field in fields {
+        let segments: Vec<&str> = field.split('.').collect();
+        let Some(value) = segments
+            .iter()
+            .try_fold(payload, |value, segment| value.get(segment))
+        else {
+            continue;
+        };
+        let (last, parents) = segments.split_last().unwrap();
+        let mut target = &mut projected;
+        for parent in parents {
+            let entry = target
+                .entry(parent.to_string())
+                .or_insert_with(|| Value::Object(Map::new()));
+            let Value::Object(map) = entry else {
+                continue 'fields;
+            };
+            target = map;
+        }
+        target.insert(last.to_string(), value.clone());
+    }
+    Value::Object(projected)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn event() -> FluxEvent {
+        FluxEvent::builder("alarms.events")
+            .source("plc-01")
+            .key("line-2")
+            .payload(json!({
+                "entity_id": "alarm-7",
+                "properties": {"severity": "critical", "level": 4, "tags": ["hv", "pump"]}
+            }))
+            .must_build()
+    }
+
+    fn condition(path: &str, op: Op, value: Value) -> Condition {
+        Condition {
+            path: path.to_string(),
+            op,
+            value,
+        }
+    }
+
+    #[test]
+    fn test_payload_conditions() {
+        let event = event();
+        let headers = BTreeMap::new();
+        let holds = |path, op, value| condition(path, op, value).matches(&event, &headers);
+
+        assert!(holds(
+            "payload.properties.severity",
+            Op::Eq,
+            json!("critical")
+        ));
+        assert!(!holds(
+            "payload.properties.severity",
+            Op::Eq,
+            json!("warning")
+        ));
+        assert!(holds(
+            "payload.properties.severity",
+            Op::Ne,
+            json!("warning")
+        ));
+        assert!(holds("payload.properties.level", Op::Eq, json!(4.0)));
+        assert!(holds("payload.properties.level", Op::Gte, json!(4)));
+        assert!(!holds("payload.properties.level", Op::Gt, json!(4)));
+        assert!(holds("payload.properties.level", Op::Lt, json!(10)));
+        assert!(holds("payload.properties.tags.1", Op::Eq, json!("pump")));
+        assert!(holds(
+            "payload.properties.severity",
+            Op::In,
+            json!(["major", "critical"])
+        ));
+        assert!(holds("payload.entity_id", Op::Exists, Value::Null));
+        assert!(!holds(
+            "payload.properties.missing",
+            Op::Exists,
+            Value::Null
+        ));
+        // Missing fields are never equal, ordered or in a set
+        assert!(!holds("payload.properties.missing", Op::Eq, Value::Null));
+        assert!(holds("payload.properties.missing", Op::Ne, json!("x")));
+        assert!(!holds("payload.properties.severity", Op::Gt, json!(1)));
+    }
+
+    #[test]
+    fn test_envelope_and_header_conditions() {
+        let event = event();
+        let headers = BTreeMap::from([("Flux-Priority".to_string(), "high".to_string())]);
+        let holds = |path, op, value| condition(path, op, value).matches(&event, &headers);
+
+        assert!(holds("key", Op::Eq, json!("line-2")));
+        assert!(holds("source", Op::In, json!(["plc-01", "plc-02"])));
+        assert!(holds("priority", Op::Eq, json!("normal")));
+        assert!(!holds("schema", Op::Exists, Value::Null));
+        assert!(holds("headers.Flux-Priority", Op::Eq, json!("high")));
+        assert!(!holds("headers.traceparent", Op::Exists, Value::Null));
+    }
+
+    #[test]
+    fn test_all_conditions_must_hold() {
+        let event = event();
+        let headers = BTreeMap::new();
+        let severity = condition("payload.properties.severity", Op::Eq, json!("critical"));
+        let key = condition("key", Op::Eq, json!("line-9"));
+
+        assert!(matches_all(&[], &event, &headers));
+        assert!(matches_all(&[severity.clone()], &event, &headers));
+        assert!(!matches_all(&[severity, key], &event, &headers));
+    }
+
+    #[test]
+    fn test_validate() {
+        assert!(condition("payload.a.b", Op::Eq, json!(1))
+            .validate()
+            .is_ok());
+        assert!(condition("headers.x-flux-api", Op::Exists, Value::Null)
+            .validate()
+            .is_ok());
+        assert!(condition("key", Op::Eq, json!("a")).validate().is_ok());
+
+        assert!(condition("payload", Op::Eq, json!(1)).validate().is_err());
+        assert!(condition("payload..a", Op::Eq, json!(1))
+            .validate()
+            .is_err());
+        assert!(condition("body.a", Op::Eq, json!(1)).validate().is_err());
+        assert!(condition("eventId", Op::Eq, json!(1)).validate().is_err());
+        assert!(condition("key", Op::In, json!("a")).validate().is_err());
+        assert!(condition("payload.a", Op::Gt, json!(true))
+            .validate()
+            .is_err());
+    }
+
+    #[test]
+    fn test_project_keeps_nesting() {
+        let payload = json!({
+            "entity_id": "alarm-7",
+            "properties": {"severity": "critical", "level": 4},
+            "raw": "..."
+        });
+        let fields = ["entity_id", "properties.severity", "properties.missing"].map(str::to_string);
+
+        assert_eq!(
+            project(&payload, &fields),
+            json!({"entity_id": "alarm-7", "properties": {"severity": "critical"}})
+        );
+        assert_eq!(project(&payload, &[]), json!({}));
+    }
+}
@@ -0,0 +1,494 @@
+use crate::event::{is_valid_stream_name, FluxEvent, ValidationError};
+use crate::nats::{high_priority_subject, stream_subject, EventPublisher, ReceivedEvent};
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, consumer, kv, AckKind};
+use futures::StreamExt;
+use serde::{Deserialize, Serialize};
+use std::collections::{BTreeMap, HashMap};
+use std::fmt;
+use tokio::sync::Mutex;
+use tokio::task::JoinHandle;
+use tracing::{debug, info, warn};
+
+mod filter;
+
+pub use filter::{matches_all, project, Condition, Op};
+
+/// JetStream KV bucket holding derivation rules
+pub const RULE_BUCKET: &str = "FLUX_RULES";
+
+/// Header on derived events carrying the eventId they were derived from
+pub const CAUSATION_HEADER: &str = "Flux-Causation-Id";
+
+/// Header on derived events naming the rule that produced them
+pub const RULE_HEADER: &str = "Flux-Rule";
+
+/// Republishes matching events from one stream onto another, e.g. only the
+/// critical alarms of `alarms.events` onto `alarms.critical`.
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct Rule {
+    /// Unique name; the durable consumer is `flux-rule-{name}`
+    pub name: String,
+    pub source_stream: String,
+    /// Conditions that must all hold (empty = every event)
+    #[serde(default)]
+    pub filter: Vec<Condition>,
+    pub destination_stream: String,
+    /// Payload fields to keep (dotted paths); the whole payload when unset
+    #[serde(default, skip_serializing_if = "Option::is_none")]
+    pub project: Option<Vec<String>>,
+}
+
+/// Rule definition as sent to `PUT /api/rules/:name`
+#[derive(Debug, Clone, Deserialize)]
+pub struct NewRule {
+    pub source_stream: String,
+    #[serde(default)]
+    pub filter: Vec<Condition>,
+    pub destination_stream: String,
+    #[serde(default)]
+    pub project: Option<Vec<String>>,
+}
+
+impl NewRule {
+    pub fn named(self, name: impl Into<String>) -> Rule {
+        Rule {
+            name: name.into(),
+            source_stream: self.source_stream,
+            filter: self.filter,
+            destination_stream: self.destination_stream,
+            project: self.project,
+        }
+    }
+}
+
+impl Rule {
+    pub fn validate(&self) -> Result<(), RuleError> {
+        let invalid = |msg: String| Err(RuleError::InvalidRule(msg));
+        if self.name.is_empty()
+            || !self
+                .name
+                .chars()
+                .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+        {
+            return invalid(format!(
+                "rule name '{}' must be non-empty [A-Za-z0-9_-]",
+                self.name
+            ));
+        }
+        for stream in [&self.source_stream, &self.destination_stream] {
+            if !is_valid_stream_name(stream) {
+                return invalid(format!("rule '{}': invalid stream '{}'", self.name, stream));
+            }
+        }
+        if self.source_stream == self.destination_stream {
+            return invalid(format!(
+                "rule '{}': destination must differ from the source stream",
+                self.name
+            ));
+        }
+        for condition in &self.filter {
+            condition
+                .validate()
+                .map_err(|e| RuleError::InvalidRule(format!("rule '{}': {}", self.name, e)))?;
+        }
+        if let Some(fields) = &self.project {
+            if fields.iter().any(|f| f.split('.').any(str::is_empty)) {
+                return invalid(format!("rule '{}': empty projected field", self.name));
+            }
+        }
+        Ok(())
+    }
+
+    /// True if `event` (received with `headers`) should be derived.
+    pub fn matches(&self, event: &FluxEvent, headers: &BTreeMap<String, String>) -> bool {
+        event.stream == self.source_stream && matches_all(&self.filter, event, headers)
+    }
+
+    /// The event to publish on the destination stream for `event`: a new
+    /// eventId, the projected payload, and the rest of the envelope as is.
+    pub fn derive(&self, event: &FluxEvent) -> Result<FluxEvent, ValidationError> {
+        let payload = match &self.project {
+            Some(fields) => project(&event.payload, fields),
+            None => event.payload.clone(),
+        };
+        let mut derived = FluxEvent {
+            event_id: None,
+            stream: self.destination_stream.clone(),
+            envelope_version: None,
+            received_at: None,
+            ttl_ms: None,
+            correlation_id: None,
+            parent_event_id: None,
+            payload,
+            ..event.clone()
+        };
+        derived.validate_and_prepare()?;
+        Ok(derived)
+    }
+
+    fn durable_name(&self) -> String {
+        format!("flux-rule-{}", self.name)
+    }
+}
+
+/// Rule operation errors
+#[derive(Debug, Clone, PartialEq)]
+pub enum RuleError {
+    InvalidRule(String),
+    NotFound(String),
+    StoreFailed(String),
+}
+
+impl fmt::Display for RuleError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            RuleError::InvalidRule(msg) => write!(f, "{}", msg),
+            RuleError::NotFound(name) => write!(f, "rule '{}' not found", name),
+            RuleError::StoreFailed(msg) => write!(f, "rule store failed: {}", msg),
+        }
+    }
+}
+
+impl std::error::Error for RuleError {}
+
+struct Runner {
+    rule: Rule,
+    task: JoinHandle<()>,
+}
+
+/// Runs derivation rules, persisted in a JetStream KV bucket.
+///
+/// Each rule has a durable consumer (`flux-rule-{name}`) on its source
+/// stream, starting with events published after the rule was first created.
+/// Matching events are republished on the destination stream with
+/// `Flux-Causation-Id` set to the original eventId. Delivery is
+/// at-least-once: an event whose republish fails is redelivered.
+///
+/// `watch` applies rules added or removed by other Flux instances; instances
+/// share each rule's durable consumer, so every event is derived once.
+pub struct RuleEngine {
+    kv: kv::Store,
+    jetstream: jetstream::Context,
+    stream_name: String,
+    publisher: EventPublisher,
+    runners: Mutex<HashMap<String, Runner>>,
+}
+
+impl RuleEngine {
+    /// Open (or create) the rule bucket and start every stored rule.
+    /// `stream_name` is the JetStream stream holding the Flux streams.
+    pub async fn open(
+        jetstream: jetstream::Context,
+        stream_name: impl Into<String>,
+        publisher: EventPublisher,
+    ) -> Result<Self> {
+        let kv = match jetstream.get_key_value(RULE_BUCKET).await {
+            Ok(kv) => kv,
+            Err(_) => jetstream
+                .create_key_value(kv::Config {
+                    bucket: RULE_BUCKET.to_string(),
+                    description: "Flux stream derivation rules".to_string(),
+                    history: 1,
+                    ..Default::default()
+                })
+                .await
+                .context("Failed to create rule bucket")?,
+        };
+        let engine = Self {
+            kv,
+            jetstream,
+            stream_name: stream_name.into(),
+            publisher,
+            runners: Mutex::new(HashMap::new()),
+        };
+
+        let mut keys = engine.kv.keys().await.context("Failed to list rules")?;
+        while let Some(key) = keys.next().await {
+            let key = key.context("Failed to read rule key")?;
+            if let Some(value) = engine.kv.get(&key).await? {
+                engine.apply_stored(&key, &value).await;
+            }
+        }
+
+        info!(rules = engine.runners.lock().await.len(), "Rules loaded");
+        Ok(engine)
+    }
+
+    /// Create or replace a rule and start running it.
+    pub async fn put(&self, rule: Rule) -> Result<Rule, RuleError> {
+        rule.validate()?;
+        let value = serde_json::to_vec(&rule).map_err(|e| RuleError::StoreFailed(e.to_string()))?;
+        self.kv
+            .put(&rule.name, value.into())
+            .await
+            .map_err(|e| RuleError::StoreFailed(e.to_string()))?;
+        self.start(rule.clone())
+            .await
+            .map_err(|e| RuleError::StoreFailed(format!("{:#}", e)))?;
+        Ok(rule)
+    }
+
+    /// Stop and remove a rule.
+    pub async fn delete(&self, name: &str) -> Result<(), RuleError> {
+        if self.get(name).await.is_none() {
+            return Err(RuleError::NotFound(name.to_string()));
+        }
+        self.kv
+            .delete(name)
+            .await
+            .map_err(|e| RuleError::StoreFailed(e.to_string()))?;
+        self.stop(name).await;
+        Ok(())
+    }
+
+    pub async fn get(&self, name: &str) -> Option<Rule> {
+        self.runners
+            .lock()
+            .await
+            .get(name)
+            .map(|runner| runner.rule.clone())
+    }
+
+    /// All running rules, sorted by name.
+    pub async fn list(&self) -> Vec<Rule> {
+        let mut rules: Vec<Rule> = self
+            .runners
+            .lock()
+            .await
+            .values()
+            .map(|runner| runner.rule.clone())
+            .collect();
+        rules.sort_by(|a, b| a.name.cmp(&b.name));
+        rules
+    }
+
+    /// Keep the running rules in sync with the bucket until the watch ends.
+    pub async fn watch(self: std::sync::Arc<Self>) {
+        let mut watch = match self.kv.watch_all().await {
+            Ok(watch) => watch,
+            Err(e) => {
+                warn!(error = %e, "Failed to watch rules");
+                return;
+            }
+        };
+
+        while let Some(entry) = watch.next().await {
+            let entry = match entry {
+                Ok(entry) => entry,
+                Err(e) => {
+                    warn!(error = %e, "Rule watch error");
+                    continue;
+                }
+            };
+            match entry.operation {
+                kv::Operation::Put => self.apply_stored(&entry.key, &entry.value).await,
+                kv::Operation::Delete | kv::Operation::Purge => self.stop(&entry.key).await,
+            }
+        }
+    }
+
+    async fn apply_stored(&self, key: &str, value: &[u8]) {
+        let rule = match serde_json::from_slice::<Rule>(value) {
+            Ok(rule) => rule,
+            Err(e) => {
+                warn!(error = %e, key = %key, "Skipping malformed rule");
+                return;
+            }
+        };
+        if let Err(e) = rule.validate() {
+            warn!(error = %e, "Skipping invalid rule");
+            return;
+        }
+        if let Err(e) = self.start(rule).await {
+            warn!(error = %e, key = %key, "Failed to start rule");
+        }
+    }
+
+    /// Run `rule`, replacing a different rule of the same name. A no-op if
+    /// the same rule is already running.
+    async fn start(&self, rule: Rule) -> Result<()> {
+        let mut runners = self.runners.lock().await;
+        if runners.get(&rule.name).map_or(false, |r| r.rule == rule) {
+            return Ok(());
+        }
+
+        let durable = rule.durable_name();
+        let consumer = self
+            .jetstream
+            .get_stream(&self.stream_name)
+            .await
+            .context("Failed to get JetStream stream")?
+            .create_consumer(consumer::pull::Config {
+                durable_name: Some(durable.clone()),
+                filter_subjects: vec![
+                    stream_subject(&rule.source_stream),
+                    high_priority_subject(&rule.source_stream),
+                ],
+                deliver_policy: consumer::DeliverPolicy::New,
+                ack_policy: consumer::AckPolicy::Explicit,
+                ..Default::default()
+            })
+            .await
+            .context("Failed to create rule consumer")?;
+        let mut messages = consumer.messages().await?;
+
+        let publisher = self.publisher.clone();
+        let running = rule.clone();
+        let task = tokio::spawn(async move {
+            while let Some(message) = messages.next().await {
+                match message {
+                    Ok(message) => derive_message(&running, &publisher, message).await,
+                    Err(e) => {
+                        warn!(error = %e, rule = %running.name, "Error receiving rule message")
+                    }
+                }
+            }
+        });
+
+        if let Some(previous) = runners.insert(rule.name.clone(), Runner { rule, task }) {
+            previous.task.abort();
+        }
+        info!(rule = %durable, "Rule started");
+        Ok(())
+    }
+
+    /// Stop a running rule and remove its consumer.
+    async fn stop(&self, name: &str) {
+        let Some(runner) = self.runners.lock().await.remove(name) else {
+            return;
+        };
+        runner.task.abort();
+        let durable = runner.rule.durable_name();
+        let deleted = match self.jetstream.get_stream(&self.stream_name).await {
+            Ok(stream) => stream
+                .delete_consumer(&durable)
+                .await
+                .map(|_| ())
+                .map_err(|e| e.to_string()),
+            Err(e) => Err(e.to_string()),
+        };
+        if let Err(e) = deleted {
+            debug!(error = %e, consumer = %durable, "Failed to delete rule consumer");
+        }
+        info!(rule = %name, "Rule stopped");
+    }
+}
+
+/// Republish one consumed event if it matches `rule`, then ack it.
+async fn derive_message(rule: &Rule, publisher: &EventPublisher, message: jetstream::Message) {
+    let received = match ReceivedEvent::from_message(&message) {
+        Ok(received) => received,
+        Err(e) => {
+            warn!(error = %e, rule = %rule.name, "Failed to decode event, skipping");
+            let _ = message.ack().await;
+            return;
+        }
+    };
+    let event = &received.event;
+    if !rule.matches(event, &received.headers) {
+        let _ = message.ack().await;
+        return;
+    }
+
+    let derived = match rule.derive(event) {
+        Ok(derived) => derived,
+        Err(e) => {
+            // Retrying cannot fix the projected event
+            warn!(error = %e, rule = %rule.name, "Derived event is invalid, skipping");
+            let _ = message.ack_with(AckKind::Term).await;
+            return;
+        }
+    };
+    let causation_id = event.event_id.as_deref().unwrap_or_default();
+    let headers = [
+        (CAUSATION_HEADER, causation_id),
+        (RULE_HEADER, rule.name.as_str()),
+    ];
+    match publisher.publish_with_headers(&derived, &headers).await {
+        Ok(_) => {
+            let _ = message.ack().await;
+        }
+        Err(e) => {
+            warn!(error = %e, rule = %rule.name, "Failed to publish derived event");
+            let _ = message.ack_with(AckKind::Nak(None)).await;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use serde_json::json;
+
+    fn rule() -> Rule {
+        Rule {
+            name: "critical-alarms".to_string(),
+            source_stream: "alarms.events".to_string(),
+            filter: vec![Condition {
+                path: "payload.properties.severity".to_string(),
+                op: Op::Eq,
+                value: json!("critical"),
+            }],
+            destination_stream: "alarms.critical".to_string(),
+            project: Some(vec![
+                "entity_id".to_string(),
+                "properties.severity".to_string(),
+            ]),
+        }
+    }
+
+    #[test]
+    fn test_validate() {
+        assert!(rule().validate().is_ok());
+
+        let mut bad = rule();
+        bad.name = "has.dot".to_string();
+        assert!(bad.validate().is_err());
+
+        let mut bad = rule();
+        bad.destination_stream = "alarms.events".to_string();
+        assert!(bad.validate().is_err());
+
+        let mut bad = rule();
+        bad.destination_stream = "Alarms".to_string();
+        assert!(bad.validate().is_err());
+
+        let mut bad = rule();
+        bad.filter[0].path = "severity".to_string();
+        assert!(matches!(bad.validate(), Err(RuleError::InvalidRule(_))));
+    }
+
+    #[test]
+    fn test_derive_projects_and_keeps_envelope() {
+        let event = FluxEvent::builder("alarms.events")
+            .source("plc-01")
+            .key("line-2")
+            .payload(json!({
+                "entity_id": "alarm-7",
+                "properties": {"severity": "critical", "raw": "0x1f"}
+            }))
+            .must_build();
+        assert!(rule().matches(&event, &BTreeMap::new()));
+
+        let derived = rule().derive(&event).unwrap();
+        assert_eq!(derived.stream, "alarms.critical");
+        assert_ne!(derived.event_id, event.event_id);
+        assert_eq!(derived.source, "plc-01");
+        assert_eq!(derived.key.as_deref(), Some("line-2"));
+        assert_eq!(derived.timestamp, event.timestamp);
+        assert_eq!(
+            derived.payload,
+            json!({"entity_id": "alarm-7", "properties": {"severity": "critical"}})
+        );
+    }
+
+    #[test]
+    fn test_other_streams_never_match() {
+        let event = FluxEvent::builder("alarms.archive")
+            .source("plc-01")
+            .payload(json!({"properties": {"severity": "critical"}}))
+            .must_build();
+        assert!(!rule().matches(&event, &BTreeMap::new()));
+    }
+}
@@ -0,0 +1,206 @@
+use crate::clock::{self, SharedClock};
+use crate::event::FluxEvent;
+use crate::nats::EventPublisher;
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, kv};
+use chrono::{DateTime, Utc};
+use futures::StreamExt;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+use std::sync::Arc;
+use std::time::Duration;
+use tokio::sync::Notify;
+use tracing::{debug, info, warn};
+
+/// JetStream KV bucket holding pending schedules
+pub const SCHEDULE_BUCKET: &str = "FLUX_SCHEDULES";
+
+/// How often the bucket is scanned for due events
+const DEFAULT_POLL_INTERVAL: Duration = Duration::from_secs(1);
+
+/// An event waiting to be published, as stored in the schedule bucket.
+#[derive(Debug, Clone, Serialize, Deserialize)]
+pub struct ScheduledEvent {
+    pub event: FluxEvent,
+    /// Publish once this time has passed
+    pub at: DateTime<Utc>,
+}
+
+/// Returned by `cancel` when the schedule does not exist (or already fired).
+#[derive(Debug, Clone, PartialEq)]
+pub struct ScheduleNotFoundError {
+    pub schedule_id: String,
+}
+
+impl fmt::Display for ScheduleNotFoundError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "schedule '{}' not found", self.schedule_id)
+    }
+}
+
+impl std::error::Error for ScheduleNotFoundError {}
+
+/// Publishes events at a future time (maintenance windows, scheduled alerts).
+///
+/// Schedules are persisted in a JetStream KV bucket keyed by schedule id, so
+/// they survive restarts. `run` scans the bucket every second, publishes due
+/// events and deletes their entries. Delivery is at-least-once: a crash between
+/// publish and delete re-publishes the event on the next scan.
+pub struct ScheduledPublisher {
+    publisher: EventPublisher,
+    kv: kv::Store,
+    poll_interval: Duration,
+    clock: SharedClock,
+    shutdown: Notify,
+}
+
+impl ScheduledPublisher {
+    /// Open (or create) the schedule bucket.
+    pub async fn open(jetstream: &jetstream::Context, publisher: EventPublisher) -> Result<Self> {
+        Self::open_bucket(jetstream, SCHEDULE_BUCKET, publisher).await
+    }
+
+    /// Open (or create) a named schedule bucket.
+    pub async fn open_bucket(
+        jetstream: &jetstream::Context,
+        bucket: &str,
+        publisher: EventPublisher,
+    ) -> Result<Self> {
+        let kv = match jetstream.get_key_value(bucket).await {
+            Ok(kv) => kv,
+            Err(_) => jetstream
+                .create_key_value(kv::Config {
+                    bucket: bucket.to_string(),
+                    description: "Flux scheduled events".to_string(),
+                    history: 1,
+                    ..Default::default()
+                })
+                .await
+                .context("Failed to create schedule bucket")?,
+        };
+
+        Ok(Self {
+            publisher,
+            kv,
+            poll_interval: DEFAULT_POLL_INTERVAL,
+            clock: clock::system(),
+            shutdown: Notify::new(),
+        })
+    }
+
+    /// Scan for due events every `interval` instead of every second.
+    pub fn with_poll_interval(mut self, interval: Duration) -> Self {
+        self.poll_interval = interval;
+        self
+    }
+
+    /// Decide which events are due by `clock` instead of the system clock.
+    pub fn with_clock(mut self, clock: SharedClock) -> Self {
+        self.clock = clock;
+        self
+    }
+
+    /// Schedule `event` for publishing at `at`. Returns the schedule id.
+    ///
+    /// The event is validated now, so invalid events are rejected up front
+    /// rather than when they fall due. Times in the past publish on the next scan.
+    pub async fn schedule_at(&self, event: &FluxEvent, at: DateTime<Utc>) -> Result<String> {
+        let mut event = event.clone();
+        event.validate_and_prepare()?;
+
+        let schedule_id = uuid::Uuid::now_v7().to_string();
+        let value = serde_json::to_vec(&ScheduledEvent { event, at })?;
+        self.kv
+            .put(&schedule_id, value.into())
+            .await
+            .context("Failed to store schedule")?;
+
+        debug!(schedule_id = %schedule_id, at = %at, "Event scheduled");
+        Ok(schedule_id)
+    }
+
+    /// Cancel a pending schedule.
+    pub async fn cancel(&self, schedule_id: &str) -> Result<()> {
+        if self.get(schedule_id).await?.is_none() {
+            return Err(ScheduleNotFoundError {
+                schedule_id: schedule_id.to_string(),
+            }
+            .into());
+        }
+        self.kv
+            .purge(schedule_id)
+            .await
+            .context("Failed to delete schedule")?;
+        Ok(())
+    }
+
+    /// A pending schedule, if any.
+    pub async fn get(&self, schedule_id: &str) -> Result<Option<ScheduledEvent>> {
+        let Some(value) = self
+            .kv
+            .get(schedule_id)
+            .await
+            .context("Failed to read schedule")?
+        else {
+            return Ok(None);
+        };
+        Ok(Some(serde_json::from_slice(&value)?))
+    }
+
+    /// Publish every event whose time has passed. Returns how many were published.
+    pub async fn publish_due(&self) -> Result<usize> {
+        let now = self.clock.now();
+        let mut keys = self.kv.keys().await.context("Failed to list schedules")?;
+        let mut due = Vec::new();
+        while let Some(key) = keys.next().await {
+            let key = key.context("Failed to list schedules")?;
+            match self.get(&key).await {
+                Ok(Some(scheduled)) if scheduled.at <= now => due.push((key, scheduled)),
+                Ok(_) => {}
+                Err(e) => warn!(error = %e, schedule_id = %key, "Unreadable schedule"),
+            }
+        }
+        due.sort_by_key(|(_, scheduled)| scheduled.at);
+
+        let mut published = 0;
+        for (schedule_id, scheduled) in due {
+            if let Err(e) = self.publisher.publish(&scheduled.event).await {
+                // Left in the bucket; retried on the next scan
+                warn!(error = %e, schedule_id = %schedule_id, "Failed to publish scheduled event");
+                continue;
+            }
+            if let Err(e) = self.kv.purge(&schedule_id).await {
+                warn!(error = %e, schedule_id = %schedule_id, "Failed to delete fired schedule");
+            }
+            published += 1;
+        }
+        Ok(published)
+    }
+
+    /// Publish due events every poll interval until `stop` is called.
+    pub async fn run(self: Arc<Self>) {
+        info!(
+            interval_ms = self.poll_interval.as_millis() as u64,
+            "Starting scheduled publisher"
+        );
+        let mut interval = tokio::time::interval(self.poll_interval);
+
+        loop {
+            tokio::select! {
+                _ = interval.tick() => {
+                    if let Err(e) = self.publish_due().await {
+                        warn!(error = %e, "Failed to scan scheduled events");
+                    }
+                }
+                _ = self.shutdown.notified() => break,
+            }
+        }
+
+        info!("Scheduled publisher stopped");
+    }
+
+    /// Stop the polling loop.
+    pub fn stop(&self) {
+        self.shutdown.notify_one();
+    }
+}
@@ -0,0 +1,285 @@
+use crate::event::FluxEvent;
+use anyhow::{Context, Result};
+use async_nats::jetstream::{self, kv};
+use chrono::{DateTime, Utc};
+use dashmap::DashMap;
+use futures::StreamExt;
+use serde::{Deserialize, Serialize};
+use std::fmt;
+use std::sync::Arc;
+use tracing::{info, warn};
+
+#[cfg(test)]
+mod tests;
+
+/// JetStream KV bucket holding registered sources
+pub const SOURCE_BUCKET: &str = "FLUX_SOURCES";
+
+/// A registered event producer
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
+pub struct SourceRecord {
+    /// Source identity as it appears in `FluxEvent.source`
+    pub source: String,
+    #[serde(default)]
+    pub description: String,
+    #[serde(default)]
+    pub owner: String,
+    /// Streams this source may publish to (prefix match; empty = any stream)
+    #[serde(default)]
+    pub allowed_stream_prefixes: Vec<String>,
+    pub active: bool,
+    pub created_at: DateTime<Utc>,
+}
+
+impl SourceRecord {
+    /// True if `stream` matches one of the allowed prefixes (or none are set).
+    pub fn allows_stream(&self, stream: &str) -> bool {
+        self.allowed_stream_prefixes.is_empty()
+            || self.allowed_stream_prefixes.iter().any(|prefix| {
+                stream == prefix
+                    || stream
+                        .strip_prefix(prefix.as_str())
+                        .map_or(false, |rest| rest.starts_with('.'))
+            })
+    }
+}
+
+/// Registration request
+#[derive(Debug, Clone, Deserialize)]
+pub struct NewSource {
+    pub source: String,
+    #[serde(default)]
+    pub description: String,
+    #[serde(default)]
+    pub owner: String,
+    #[serde(default)]
+    pub allowed_stream_prefixes: Vec<String>,
+}
+
+/// Registry operation errors
+#[derive(Debug, Clone, PartialEq)]
+pub enum SourceError {
+    InvalidSource(String),
+    AlreadyExists(String),
+    NotFound(String),
+    StoreFailed(String),
+}
+
+impl fmt::Display for SourceError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        match self {
+            SourceError::InvalidSource(msg) => write!(f, "{}", msg),
+            SourceError::AlreadyExists(s) => write!(f, "source '{}' is already registered", s),
+            SourceError::NotFound(s) => write!(f, "source '{}' is not registered", s),
+            SourceError::StoreFailed(msg) => write!(f, "source store failed: {}", msg),
+        }
+    }
+}
+
+impl std::error::Error for SourceError {}
+
+/// Returned by the publisher when an event's source is not allowed to publish.
+#[derive(Debug, Clone, PartialEq)]
+pub struct SourceRejectedError {
+    pub source: String,
+    pub reason: &'static str,
+}
+
+impl fmt::Display for SourceRejectedError {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "source '{}' rejected: {}", self.source, self.reason)
+    }
+}
+
+impl std::error::Error for SourceRejectedError {}
+
+/// Registry of producer identities, persisted in a JetStream KV bucket.
+///
+/// Lookups are served from an in-memory cache. `watch` keeps the cache in sync
+/// with the bucket, so registrations and deactivations made by any Flux
+/// instance take effect without a restart.
+pub struct SourceRegistry {
+    kv: kv::Store,
+    cache: Arc<DashMap<String, SourceRecord>>,
+}
+
+impl SourceRegistry {
+    /// Open (or create) the source bucket and load existing registrations.
+    pub async fn open(jetstream: &jetstream::Context) -> Result<Self> {
+        let kv = match jetstream.get_key_value(SOURCE_BUCKET).await {
+            Ok(kv) => kv,
+            Err(_) => jetstream
+                .create_key_value(kv::Config {
+                    bucket: SOURCE_BUCKET.to_string(),
+                    description: "Registered Flux event sources".to_string(),
+                    history: 1,
+                    ..Default::default()
+                })
+                .await
+                .context("Failed to create source registry bucket")?,
+        };
+
+        let registry = Self {
+            kv,
+            cache: Arc::new(DashMap::new()),
+        };
+
+        let mut keys = registry
+            .kv
+            .keys()
+            .await
+            .context("Failed to list registered sources")?;
+        while let Some(key) = keys.next().await {
+            let key = key.context("Failed to read source key")?;
+            if let Some(value) = registry.kv.get(&key).await? {
+                match serde_json::from_slice::<SourceRecord>(&value) {
+                    Ok(record) => {
+                        registry.cache.insert(record.source.clone(), record);
+                    }
+                    Err(e) => warn!(error = %e, key = %key, "Skipping malformed source record"),
+                }
+            }
+        }
+
+        info!(sources = registry.cache.len(), "Source registry loaded");
+        Ok(registry)
+    }
+
+    /// Register a new source.
+    pub async fn register(&self, request: NewSource) -> Result<SourceRecord, SourceError> {
+        validate_source_id(&request.source)?;
+        if self.cache.contains_key(&request.source) {
+            return Err(SourceError::AlreadyExists(request.source));
+        }
+
+        let record = SourceRecord {
+            source: request.source,
+            description: request.description,
+            owner: request.owner,
+            allowed_stream_prefixes: request.allowed_stream_prefixes,
+            active: true,
+            created_at: Utc::now(),
+        };
+
+        // `create` fails if another instance registered the key first
+        let value =
+            serde_json::to_vec(&record).map_err(|e| SourceError::StoreFailed(e.to_string()))?;
+        self.kv
+            .create(&record.source, value.into())
+            .await
+            .map_err(|_| SourceError::AlreadyExists(record.source.clone()))?;
+
+        self.cache.insert(record.source.clone(), record.clone());
+        Ok(record)
+    }
+
+    /// Look up a source by identity.
+    pub fn get(&self, source: &str) -> Option<SourceRecord> {
+        self.cache.get(source).map(|r| r.clone())
+    }
+
+    /// All registered sources (active and inactive), sorted by identity.
+    pub fn list(&self) -> Vec<SourceRecord> {
+        let mut records: Vec<SourceRecord> = self.cache.iter().map(|r| r.value().clone()).collect();
+        records.sort_by(|a, b| a.source.cmp(&b.source));
+        records
+    }
+
+    /// Mark a source inactive. The record is kept for auditing.
+    pub async fn deactivate(&self, source: &str) -> Result<SourceRecord, SourceError> {
+        let mut record = self
+            .get(source)
+            .ok_or_else(|| SourceError::NotFound(source.to_string()))?;
+        record.active = false;
+
+        let value =
+            serde_json::to_vec(&record).map_err(|e| SourceError::StoreFailed(e.to_string()))?;
+        self.kv
+            .put(&record.source, value.into())
+            .await
+            .map_err(|e| SourceError::StoreFailed(e.to_string()))?;
+
+        self.cache.insert(record.source.clone(), record.clone());
+        Ok(record)
+    }
+
+    /// Check that the event's source is registered, active, and allowed on its stream.
+    pub fn check(&self, event: &FluxEvent) -> Result<(), SourceRejectedError> {
+        let reject = |reason| SourceRejectedError {
+            source: event.source.clone(),
+            reason,
+        };
+
+        let record = self
+            .get(&event.source)
+            .ok_or_else(|| reject("not registered"))?;
+        if !record.active {
+            return Err(reject("deactivated"));
+        }
+        if !record.allows_stream(&event.stream) {
+            return Err(reject("stream not allowed for this source"));
+        }
+        Ok(())
+    }
+
+    /// Keep the cache in sync with the bucket until the watch ends.
+    pub async fn watch(self: Arc<Self>) {
+        let mut watch = match self.kv.watch_all().await {
+            Ok(watch) => watch,
+            Err(e) => {
+                warn!(error = %e, "Failed to watch source registry");
+                return;
+            }
+        };
+
+        while let Some(entry) = watch.next().await {
+            let entry = match entry {
+                Ok(entry) => entry,
+                Err(e) => {
+                    warn!(error = %e, "Source registry watch error");
+                    continue;
+                }
+            };
+            match entry.operation {
+                kv::Operation::Put => match serde_json::from_slice::<SourceRecord>(&entry.value) {
+                    Ok(record) => {
+                        self.cache.insert(record.source.clone(), record);
+                    }
+                    Err(e) => {
+                        warn!(error = %e, key = %entry.key, "Skipping malformed source record")
+                    }
+                },
+                kv::Operation::Delete | kv::Operation::Purge => {
+                    self.cache.remove(&entry.key);
+                }
+            }
+        }
+    }
+}
+
+/// Validate a source identity.
+///
+/// Rules: 1-128 characters of [A-Za-z0-9-_.] (also valid as a KV key)
+pub fn validate_source_id(source: &str) -> Result<(), SourceError> {
+    if source.is_empty() || source.len() > 128 {
+        return Err(SourceError::InvalidSource(
+            "source must be 1-128 characters".to_string(),
+        ));
+    }
+    if source.starts_with('.') || source.ends_with('.') {
+        return Err(SourceError::InvalidSource(format!(
+            "invalid source '{}': must not start or end with '.'",
+            source
+        )));
+    }
+    if let Some(c) = source
+        .chars()
+        .find(|c| !c.is_ascii_alphanumeric() && *c != '-' && *c != '_' && *c != '.')
+    {
+        return Err(SourceError::InvalidSource(format!(
+            "invalid character '{}' in source (must be [A-Za-z0-9-_.])",
+            c
+        )));
+    }
+    Ok(())
+}
@@ -0,0 +1,38 @@
+use super::*;
+
+fn record(prefixes: &[&str]) -> SourceRecord {
+    SourceRecord {
+        source: "sensor-001".to_string(),
+        description: String::new(),
+        owner: "ops".to_string(),
+        allowed_stream_prefixes: prefixes.iter().map(|p| p.to_string()).collect(),
+        active: true,
+        created_at: Utc::now(),
+    }
+}
+
+#[test]
+fn test_validate_source_id() {
+    assert!(validate_source_id("sensor-001").is_ok());
+    assert!(validate_source_id("agent_42.prod").is_ok());
+    assert!(validate_source_id("").is_err());
+    assert!(validate_source_id("has space").is_err());
+    assert!(validate_source_id("a/b").is_err());
+    assert!(validate_source_id(".leading").is_err());
+    assert!(validate_source_id(&"x".repeat(129)).is_err());
+}
+
+#[test]
+fn test_empty_prefixes_allow_any_stream() {
+    assert!(record(&[]).allows_stream("sensors"));
+    assert!(record(&[]).allows_stream("anything.else"));
+}
+
+#[test]
+fn test_prefix_matches_whole_segments() {
+    let r = record(&["sensors"]);
+    assert!(r.allows_stream("sensors"));
+    assert!(r.allows_stream("sensors.zone1"));
+    assert!(!r.allows_stream("sensorsx"));
+    assert!(!r.allows_stream("metrics"));
+}
@@ -0,0 +1,58 @@
+use serde::Serialize;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Arc;
+
+/// Point-in-time view of publish admission.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct AdmissionSnapshot {
+    /// Publishes holding a slot
+    pub in_flight: u64,
+    /// Publishes waiting for a slot
+    pub queued: u64,
+    /// Publishes turned away with every slot taken and the queue full
+    pub rejected: u64,
+}
+
+/// Gauges for `PublishAdmission`: publishes in flight and queued, plus a
+/// count of rejections since start.
+#[derive(Clone, Default)]
+pub struct AdmissionMetrics {
+    in_flight: Arc<AtomicU64>,
+    queued: Arc<AtomicU64>,
+    rejected: Arc<AtomicU64>,
+}
+
+impl AdmissionMetrics {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    pub fn admitted(&self) {
+        self.in_flight.fetch_add(1, Ordering::Relaxed);
+    }
+
+    pub fn released(&self) {
+        self.in_flight.fetch_sub(1, Ordering::Relaxed);
+    }
+
+    pub fn enqueued(&self) {
+        self.queued.fetch_add(1, Ordering::Relaxed);
+    }
+
+    /// A queued publish left the queue (admitted or cancelled).
+    pub fn dequeued(&self) {
+        self.queued.fetch_sub(1, Ordering::Relaxed);
+    }
+
+    pub fn rejected(&self) {
+        self.rejected.fetch_add(1, Ordering::Relaxed);
+    }
+
+    pub fn snapshot(&self) -> AdmissionSnapshot {
+        AdmissionSnapshot {
+            in_flight: self.in_flight.load(Ordering::Relaxed),
+            queued: self.queued.load(Ordering::Relaxed),
+            rejected: self.rejected.load(Ordering::Relaxed),
+        }
+    }
+}
@@ -1,4 +1,5 @@
 use crate::event::FluxEvent;
+use crate::nats::decode_event;
 use crate::state::entity::{Entity, EntityDeleted, StateUpdate};
 use crate::state::metrics::MetricsTracker;
 use anyhow::{Context, Result};
@@ -108,6 +109,11 @@ impl StateEngine {
         self.entities.iter().map(|e| e.value().clone()).collect()
     }
 
+    /// Number of entities (without cloning them)
+    pub fn entity_count(&self) -> usize {
+        self.entities.len()
+    }
+
     /// Subscribe to state updates
     pub fn subscribe(&self) -> broadcast::Receiver<StateUpdate> {
         self.state_tx.subscribe()
@@ -149,6 +155,11 @@ impl StateEngine {
         self.last_processed_sequence.load(Ordering::SeqCst)
     }
 
+    /// True once the startup replay has drained and broadcasts are enabled
+    pub fn is_live(&self) -> bool {
+        !self.replaying.load(Ordering::SeqCst)
+    }
+
     /// Signal that NATS replay is complete; enable state broadcasting
     pub fn set_live(&self) {
         self.replaying.store(false, Ordering::SeqCst);
@@ -179,6 +190,21 @@ impl StateEngine {
         );
     }
 
+    /// Process the event stored at NATS `sequence`, unless an event at or
+    /// after that sequence was already applied.
+    ///
+    /// The subscriber and reconnect catch-up can both see the same message;
+    /// this keeps each sequence applied once. Returns false if skipped.
+    pub fn apply_at_sequence(&self, sequence: u64, event: &FluxEvent) -> bool {
+        if sequence <= self.get_last_processed_sequence() {
+            return false;
+        }
+        self.process_event(event);
+        self.last_processed_sequence
+            .fetch_max(sequence, Ordering::SeqCst);
+        true
+    }
+
     /// Process a single event and update state
     ///
     /// Expects payload format:
@@ -192,6 +218,14 @@ impl StateEngine {
     pub fn process_event(&self, event: &FluxEvent) {
         // Record metrics
         self.metrics.record_event(&event.source);
+        if !self.replaying.load(Ordering::Relaxed) {
+            // Replayed events are old by definition; only live lag is meaningful
+            self.metrics.lag().observe_consume(
+                &event.stream,
+                event.timestamp,
+                self.metrics.clock().now_millis(),
+            );
+        }
 
         // Extract entity_id from payload
         let entity_id = match event.payload.get("entity_id").and_then(|v| v.as_str()) {
@@ -358,11 +392,10 @@ impl StateEngine {
                     };
 
                     // Deserialize event
-                    match serde_json::from_slice::<FluxEvent>(&msg.payload) {
+                    match decode_event(msg.headers.as_ref(), &msg.payload) {
                         Ok(event) => {
-                            self.process_event(&event);
-                            // Store sequence after successful processing
-                            self.last_processed_sequence.store(sequence, Ordering::SeqCst);
+                            // Skipped if reconnect catch-up already applied it
+                            self.apply_at_sequence(sequence, &event);
                             // Acknowledge message
                             if let Err(e) = msg.ack().await {
                                 error!(error = %e, "Failed to acknowledge message");
@@ -405,10 +438,17 @@ mod tests {
             timestamp: 1_000_000,
             key: None,
             schema: None,
+            priority: None,
+            envelope_version: None,
+            received_at: None,
+            ttl_ms: None,
+            correlation_id: None,
+            parent_event_id: None,
             payload: json!({
                 "entity_id": entity_id,
                 "properties": { prop: val }
             }),
+            raw_payload: None,
         }
     }
 
@@ -0,0 +1,287 @@
+use serde::Serialize;
+use std::collections::HashMap;
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+
+/// Histogram bucket upper bounds (seconds)
+pub const LAG_BUCKETS_SECONDS: &[f64] = &[
+    0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 30.0, 60.0, 300.0, 3600.0,
+];
+
+/// Point-in-time view of a lag histogram.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct HistogramSnapshot {
+    /// Cumulative counts per upper bound (`le`), Prometheus style. The final
+    /// entry (`f64::INFINITY`) serializes as `null`.
+    pub buckets: Vec<(f64, u64)>,
+    pub count: u64,
+    pub sum: f64,
+    /// Observations with a negative lag (event timestamp in the future),
+    /// clamped to zero. A rising count indicates producer clock skew.
+    pub negative: u64,
+}
+
+#[derive(Debug, Clone)]
+struct Histogram {
+    /// Non-cumulative counts; the last slot is +Inf
+    counts: Vec<u64>,
+    count: u64,
+    sum: f64,
+    negative: u64,
+}
+
+impl Histogram {
+    fn new() -> Self {
+        Self {
+            counts: vec![0; LAG_BUCKETS_SECONDS.len() + 1],
+            count: 0,
+            sum: 0.0,
+            negative: 0,
+        }
+    }
+
+    fn observe(&mut self, seconds: f64) {
+        let seconds = if seconds < 0.0 {
+            self.negative += 1;
+            0.0
+        } else {
+            seconds
+        };
+
+        let idx = LAG_BUCKETS_SECONDS
+            .iter()
+            .position(|&le| seconds <= le)
+            .unwrap_or(LAG_BUCKETS_SECONDS.len());
+        self.counts[idx] += 1;
+        self.count += 1;
+        self.sum += seconds;
+    }
+
+    fn snapshot(&self) -> HistogramSnapshot {
+        let mut cumulative = 0;
+        let buckets = LAG_BUCKETS_SECONDS
+            .iter()
+            .copied()
+            .chain(std::iter::once(f64::INFINITY))
+            .zip(&self.counts)
+            .map(|(le, &n)| {
+                cumulative += n;
+                (le, cumulative)
+            })
+            .collect();
+
+        HistogramSnapshot {
+            buckets,
+            count: self.count,
+            sum: self.sum,
+            negative: self.negative,
+        }
+    }
+}
+
+/// Per-stream event lag histograms.
+///
+/// - `flux_event_ingest_lag_seconds`: publish time minus event timestamp
+/// - `flux_event_consume_lag_seconds`: state engine processing time minus event timestamp
+/// - `flux_publish_latency_seconds`: time from publish to JetStream ack
+/// - `flux_consumer_delivery_latency_seconds`: delivery time to a named
+///   consumer (webhook, ExactlyOnce handler) minus event timestamp
+#[derive(Clone, Default)]
+pub struct LagMetrics {
+    ingest: Arc<Mutex<HashMap<String, Histogram>>>,
+    consume: Arc<Mutex<HashMap<String, Histogram>>>,
+    publish: Arc<Mutex<HashMap<String, Histogram>>>,
+    /// By consumer, then stream
+    delivery: Arc<Mutex<HashMap<String, HashMap<String, Histogram>>>>,
+}
+
+impl LagMetrics {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Record ingest lag for an event published at `now_ms`.
+    pub fn observe_ingest(&self, stream: &str, event_timestamp_ms: i64, now_ms: i64) {
+        observe(&self.ingest, stream, event_timestamp_ms, now_ms);
+    }
+
+    /// Record consume lag for an event processed at `now_ms`.
+    pub fn observe_consume(&self, stream: &str, event_timestamp_ms: i64, now_ms: i64) {
+        observe(&self.consume, stream, event_timestamp_ms, now_ms);
+    }
+
+    /// Record how long a publish took to be acknowledged.
+    pub fn observe_publish(&self, stream: &str, elapsed: Duration) {
+        self.publish
+            .lock()
+            .unwrap()
+            .entry(stream.to_string())
+            .or_insert_with(Histogram::new)
+            .observe(elapsed.as_secs_f64());
+    }
+
+    /// Record delivery latency for an event handed to `consumer` at `now_ms`.
+    pub fn observe_delivery(
+        &self,
+        consumer: &str,
+        stream: &str,
+        event_timestamp_ms: i64,
+        now_ms: i64,
+    ) {
+        let mut delivery = self.delivery.lock().unwrap();
+        let histogram = delivery
+            .entry(consumer.to_string())
+            .or_default()
+            .entry(stream.to_string())
+            .or_insert_with(Histogram::new);
+        histogram.observe((now_ms - event_timestamp_ms) as f64 / 1000.0);
+    }
+
+    /// `flux_event_ingest_lag_seconds` by stream
+    pub fn ingest_snapshot(&self) -> HashMap<String, HistogramSnapshot> {
+        snapshot(&self.ingest)
+    }
+
+    /// `flux_event_consume_lag_seconds` by stream
+    pub fn consume_snapshot(&self) -> HashMap<String, HistogramSnapshot> {
+        snapshot(&self.consume)
+    }
+
+    /// `flux_publish_latency_seconds` by stream
+    pub fn publish_snapshot(&self) -> HashMap<String, HistogramSnapshot> {
+        snapshot(&self.publish)
+    }
+
+    /// `flux_consumer_delivery_latency_seconds` by consumer, then stream
+    pub fn delivery_snapshot(&self) -> HashMap<String, HashMap<String, HistogramSnapshot>> {
+        self.delivery
+            .lock()
+            .unwrap()
+            .iter()
+            .map(|(consumer, streams)| {
+                let streams = streams
+                    .iter()
+                    .map(|(stream, h)| (stream.clone(), h.snapshot()))
+                    .collect();
+                (consumer.clone(), streams)
+            })
+            .collect()
+    }
+}
+
+fn observe(
+    histograms: &Mutex<HashMap<String, Histogram>>,
+    stream: &str,
+    event_timestamp_ms: i64,
+    now_ms: i64,
+) {
+    let seconds = (now_ms - event_timestamp_ms) as f64 / 1000.0;
+    histograms
+        .lock()
+        .unwrap()
+        .entry(stream.to_string())
+        .or_insert_with(Histogram::new)
+        .observe(seconds);
+}
+
+fn snapshot(histograms: &Mutex<HashMap<String, Histogram>>) -> HashMap<String, HistogramSnapshot> {
+    histograms
+        .lock()
+        .unwrap()
+        .iter()
+        .map(|(stream, h)| (stream.clone(), h.snapshot()))
+        .collect()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Cumulative count for the bucket with upper bound `le`
+    fn bucket(snapshot: &HistogramSnapshot, le: f64) -> u64 {
+        snapshot.buckets.iter().find(|(b, _)| *b == le).unwrap().1
+    }
+
+    #[test]
+    fn test_backdated_events_land_in_expected_buckets() {
+        let lag = LagMetrics::new();
+        let now = 1_707_668_400_000;
+
+        lag.observe_ingest("sensors", now - 3, now); // 3ms
+        lag.observe_ingest("sensors", now - 2_000, now); // 2s
+        lag.observe_ingest("sensors", now - 120_000, now); // 2min
+
+        let snap = &lag.ingest_snapshot()["sensors"];
+        assert_eq!(snap.count, 3);
+        assert_eq!(bucket(snap, 0.005), 1);
+        assert_eq!(bucket(snap, 1.0), 1);
+        assert_eq!(bucket(snap, 2.5), 2);
+        assert_eq!(bucket(snap, 60.0), 2);
+        assert_eq!(bucket(snap, 300.0), 3);
+        assert_eq!(snap.negative, 0);
+        assert!((snap.sum - 122.003).abs() < 1e-9);
+    }
+
+    #[test]
+    fn test_overflow_goes_to_inf_bucket() {
+        let lag = LagMetrics::new();
+        lag.observe_consume("sensors", 0, 7_200_000); // 2h
+
+        let snap = &lag.consume_snapshot()["sensors"];
+        assert_eq!(bucket(snap, 3600.0), 0);
+        assert_eq!(snap.buckets.last().unwrap().1, 1);
+    }
+
+    #[test]
+    fn test_negative_lag_clamped_and_counted() {
+        let lag = LagMetrics::new();
+        let now = 1_707_668_400_000;
+        lag.observe_ingest("sensors", now + 5_000, now); // producer clock 5s ahead
+
+        let snap = &lag.ingest_snapshot()["sensors"];
+        assert_eq!(snap.negative, 1);
+        assert_eq!(snap.sum, 0.0);
+        assert_eq!(bucket(snap, 0.005), 1);
+    }
+
+    #[test]
+    fn test_labeled_by_stream() {
+        let lag = LagMetrics::new();
+        lag.observe_ingest("sensors", 0, 1_000);
+        lag.observe_ingest("metrics", 0, 1_000);
+        lag.observe_ingest("metrics", 0, 1_000);
+
+        let snaps = lag.ingest_snapshot();
+        assert_eq!(snaps["sensors"].count, 1);
+        assert_eq!(snaps["metrics"].count, 2);
+        assert!(lag.consume_snapshot().is_empty());
+    }
+
+    #[test]
+    fn test_publish_latency() {
+        let lag = LagMetrics::new();
+        lag.observe_publish("alarms", Duration::from_millis(3));
+        lag.observe_publish("alarms", Duration::from_millis(700));
+
+        let snap = &lag.publish_snapshot()["alarms"];
+        assert_eq!(snap.count, 2);
+        assert_eq!(bucket(snap, 0.005), 1);
+        assert_eq!(bucket(snap, 1.0), 2);
+    }
+
+    #[test]
+    fn test_delivery_latency_labeled_by_consumer_and_stream() {
+        let lag = LagMetrics::new();
+        lag.observe_delivery("flux-webhook-crm", "orders", 0, 2_000);
+        lag.observe_delivery("flux-webhook-crm", "alarms", 0, 10);
+        lag.observe_delivery("billing", "orders", 0, 10);
+
+        let snaps = lag.delivery_snapshot();
+        let crm = &snaps["flux-webhook-crm"];
+        assert_eq!(crm["orders"].count, 1);
+        assert_eq!(bucket(&crm["orders"], 2.5), 1);
+        assert_eq!(bucket(&crm["orders"], 1.0), 0);
+        assert_eq!(crm["alarms"].count, 1);
+        assert_eq!(snaps["billing"]["orders"].count, 1);
+    }
+}
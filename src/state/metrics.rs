@@ -1,8 +1,12 @@
 use std::collections::{HashMap, VecDeque};
 use std::sync::atomic::{AtomicU64, Ordering};
 use std::sync::{Arc, RwLock};
-use chrono::Utc;
 use serde::Serialize;
+use crate::clock::{self, SharedClock};
+use super::admission::AdmissionMetrics;
+use super::lag::LagMetrics;
+use super::publishes::PublishMetrics;
+use super::storage::StorageMetrics;
 
 /// Tracks metrics for the Flux state engine
 #[derive(Clone)]
@@ -18,25 +22,75 @@ pub struct MetricsTracker {
 
     /// WebSocket connection count
     websocket_connections: Arc<AtomicU64>,
+
+    /// Ingest/consume lag histograms by stream
+    lag: LagMetrics,
+
+    /// Raw vs stored bytes of published events
+    storage: StorageMetrics,
+
+    /// Publish counts and rates by stream
+    publishes: PublishMetrics,
+
+    /// Publishes in flight and queued for admission
+    admission: AdmissionMetrics,
+
+    /// Time source for the rate window, publisher activity and consume lag
+    clock: SharedClock,
 }
 
 impl MetricsTracker {
     /// Create new metrics tracker
     pub fn new() -> Self {
+        Self::with_clock(clock::system())
+    }
+
+    /// Create a metrics tracker that reads the time from `clock`
+    pub fn with_clock(clock: SharedClock) -> Self {
         Self {
             total_events: Arc::new(AtomicU64::new(0)),
             event_timestamps: Arc::new(RwLock::new(VecDeque::new())),
             active_publishers: Arc::new(RwLock::new(HashMap::new())),
             websocket_connections: Arc::new(AtomicU64::new(0)),
+            lag: LagMetrics::new(),
+            storage: StorageMetrics::new(),
+            publishes: PublishMetrics::new(),
+            admission: AdmissionMetrics::new(),
+            clock,
         }
     }
 
+    /// Time source for timestamp-dependent metrics
+    pub fn clock(&self) -> &SharedClock {
+        &self.clock
+    }
+
+    /// Lag histograms (shared with the event publisher for ingest lag)
+    pub fn lag(&self) -> &LagMetrics {
+        &self.lag
+    }
+
+    /// Publish size counters (shared with the event publisher)
+    pub fn storage(&self) -> &StorageMetrics {
+        &self.storage
+    }
+
+    /// Publish counts and rates by stream (shared with the event publisher)
+    pub fn publishes(&self) -> &PublishMetrics {
+        &self.publishes
+    }
+
+    /// Publish admission gauges (shared with the event publisher)
+    pub fn admission(&self) -> &AdmissionMetrics {
+        &self.admission
+    }
+
     /// Record an event (call from StateEngine.process_event)
     pub fn record_event(&self, source: &str) {
         // Increment total counter
         self.total_events.fetch_add(1, Ordering::Relaxed);
 
-        let now = Utc::now().timestamp_millis();
+        let now = self.clock.now_millis();
 
         // Update sliding window for rate calculation
         {
@@ -68,7 +122,7 @@ impl MetricsTracker {
 
     /// Get count of active publishers (published within window)
     pub fn get_active_publisher_count(&self, window_seconds: i64) -> usize {
-        let now = Utc::now().timestamp_millis();
+        let now = self.clock.now_millis();
         let threshold = now - (window_seconds * 1000);
 
         let publishers = self.active_publishers.read().unwrap();
@@ -127,8 +181,10 @@ pub struct MetricsSnapshot {
 #[cfg(test)]
 mod tests {
     use super::*;
+    use crate::clock::FakeClock;
     use std::thread;
-    use std::time::Duration;
+
+    const T0: i64 = 1_707_668_400_000;
 
     #[test]
     fn test_event_recording() {
@@ -159,19 +215,26 @@ mod tests {
 
     #[test]
     fn test_sliding_window_cleanup() {
-        let tracker = MetricsTracker::new();
+        let clock = FakeClock::at_millis(T0);
+        let tracker = MetricsTracker::with_clock(clock.clone());
 
         // Record an event
         tracker.record_event("source1");
         assert_eq!(tracker.get_event_rate(), 0.2); // 1 event / 5s
 
-        // Sleep 6 seconds (longer than window)
-        thread::sleep(Duration::from_secs(6));
-
-        // Record a new event to trigger cleanup
+        // Exactly at the window edge the first event is still counted
+        clock.set_millis(T0 + 5_000);
         tracker.record_event("source2");
+        assert_eq!(tracker.get_event_rate(), 0.4);
+
+        // One millisecond later it is pruned on the next record
+        clock.set_millis(T0 + 5_001);
+        tracker.record_event("source3");
+        assert_eq!(tracker.get_event_rate(), 0.4);
 
-        // Old event should be pruned, only new event remains
+        // Move past the window: only the new event remains
+        clock.set_millis(T0 + 11_000);
+        tracker.record_event("source4");
         assert_eq!(tracker.get_event_rate(), 0.2); // 1 event / 5s
     }
 
@@ -189,10 +252,11 @@ mod tests {
 
     #[test]
     fn test_active_publisher_window() {
-        let tracker = MetricsTracker::new();
+        let clock = FakeClock::at_millis(T0);
+        let tracker = MetricsTracker::with_clock(clock.clone());
 
         tracker.record_event("source1");
-        thread::sleep(Duration::from_secs(2));
+        clock.set_millis(T0 + 2_000);
         tracker.record_event("source2");
 
         // With 10s window, both should be active
@@ -200,6 +264,9 @@ mod tests {
 
         // With 1s window, only source2 should be active
         assert_eq!(tracker.get_active_publisher_count(1), 1);
+
+        // A publisher last seen exactly one window ago is no longer active
+        assert_eq!(tracker.get_active_publisher_count(2), 1);
     }
 
     #[test]
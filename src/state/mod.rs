@@ -1,14 +1,24 @@
 // State engine and entity management (Task 3)
 
+mod admission;
 mod engine;
 mod entity;
+mod lag;
 mod metrics;
 mod metrics_broadcaster;
+mod publishes;
+mod reconnect;
+mod storage;
 
+pub use admission::{AdmissionMetrics, AdmissionSnapshot};
 pub use engine::StateEngine;
 pub use entity::{Entity, EntityDeleted, StateUpdate};
+pub use lag::{HistogramSnapshot, LagMetrics, LAG_BUCKETS_SECONDS};
 pub use metrics::{MetricsTracker, MetricsSnapshot};
 pub use metrics_broadcaster::{run_metrics_broadcaster, MetricsUpdate};
+pub use publishes::{PublishMetrics, PublishSnapshot, MAX_RATE_WINDOW};
+pub use reconnect::{ReconnectRecovery, RecoveryOutcome};
+pub use storage::{StorageMetrics, StorageSnapshot};
 
 #[cfg(test)]
 mod tests;
@@ -0,0 +1,202 @@
+use serde::Serialize;
+use std::collections::{BTreeMap, HashMap};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+
+/// Longest window `PublishMetrics::rate` can cover; longer windows are clamped
+pub const MAX_RATE_WINDOW: Duration = Duration::from_secs(300);
+
+const RATE_SLOTS: usize = MAX_RATE_WINDOW.as_secs() as usize;
+
+/// Point-in-time view of one stream's publishes.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct PublishSnapshot {
+    /// Successful publishes since process start
+    pub count: u64,
+    /// Publishes per second over the requested window
+    pub rate: f64,
+    /// `count` by the ack mode of the publish (`explicit`, `async`, `none`)
+    pub by_ack_mode: BTreeMap<&'static str, u64>,
+}
+
+/// Publish counts for one stream, with a ring of per-second counts for the
+/// sliding rate window. Each slot remembers the second it counts, so slots
+/// left over from an earlier lap of the ring are ignored.
+struct StreamPublishes {
+    count: u64,
+    by_ack_mode: BTreeMap<&'static str, u64>,
+    seconds: [i64; RATE_SLOTS],
+    counts: [u64; RATE_SLOTS],
+}
+
+impl StreamPublishes {
+    fn new() -> Self {
+        Self {
+            count: 0,
+            by_ack_mode: BTreeMap::new(),
+            seconds: [i64::MIN; RATE_SLOTS],
+            counts: [0; RATE_SLOTS],
+        }
+    }
+
+    fn record(&mut self, ack_mode: &'static str, now_ms: i64) {
+        let second = now_ms.div_euclid(1000);
+        let slot = second.rem_euclid(RATE_SLOTS as i64) as usize;
+        if self.seconds[slot] != second {
+            self.seconds[slot] = second;
+            self.counts[slot] = 0;
+        }
+        self.counts[slot] += 1;
+        self.count += 1;
+        *self.by_ack_mode.entry(ack_mode).or_default() += 1;
+    }
+
+    fn rate(&self, window: Duration, now_ms: i64) -> f64 {
+        let window = window.as_secs().clamp(1, RATE_SLOTS as u64) as i64;
+        let now = now_ms.div_euclid(1000);
+        let publishes: u64 = self
+            .seconds
+            .iter()
+            .zip(&self.counts)
+            .filter(|&(&second, _)| second > now - window && second <= now)
+            .map(|(_, &count)| count)
+            .sum();
+        publishes as f64 / window as f64
+    }
+}
+
+/// Successful publishes by stream: a lifetime count and the rate over a
+/// sliding window of up to `MAX_RATE_WINDOW`, in whole seconds.
+#[derive(Clone, Default)]
+pub struct PublishMetrics {
+    streams: Arc<Mutex<HashMap<String, StreamPublishes>>>,
+}
+
+impl PublishMetrics {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Record one event published at `now_ms`: acknowledged by JetStream,
+    /// or only sent for ack mode `none`.
+    pub fn record(&self, stream: &str, ack_mode: &'static str, now_ms: i64) {
+        self.streams
+            .lock()
+            .unwrap()
+            .entry(stream.to_string())
+            .or_insert_with(StreamPublishes::new)
+            .record(ack_mode, now_ms);
+    }
+
+    /// Successful publishes to `stream` since process start.
+    pub fn count(&self, stream: &str) -> u64 {
+        self.streams
+            .lock()
+            .unwrap()
+            .get(stream)
+            .map_or(0, |publishes| publishes.count)
+    }
+
+    /// Publishes per second to `stream` over the `window` ending at `now_ms`.
+    pub fn rate(&self, stream: &str, window: Duration, now_ms: i64) -> f64 {
+        self.streams
+            .lock()
+            .unwrap()
+            .get(stream)
+            .map_or(0.0, |publishes| publishes.rate(window, now_ms))
+    }
+
+    /// Count and rate of every stream published to
+    pub fn snapshot(&self, window: Duration, now_ms: i64) -> HashMap<String, PublishSnapshot> {
+        self.streams
+            .lock()
+            .unwrap()
+            .iter()
+            .map(|(stream, publishes)| {
+                let snapshot = PublishSnapshot {
+                    count: publishes.count,
+                    rate: publishes.rate(window, now_ms),
+                    by_ack_mode: publishes.by_ack_mode.clone(),
+                };
+                (stream.clone(), snapshot)
+            })
+            .collect()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const T0: i64 = 1_707_668_400_000;
+
+    #[test]
+    fn test_counts_by_stream() {
+        let publishes = PublishMetrics::new();
+        publishes.record("sensors", "explicit", T0);
+        publishes.record("sensors", "none", T0 + 10);
+        publishes.record("alarms", "explicit", T0);
+
+        assert_eq!(publishes.count("sensors"), 2);
+        assert_eq!(publishes.count("alarms"), 1);
+        assert_eq!(publishes.count("orders"), 0);
+        let snapshot = publishes.snapshot(Duration::from_secs(10), T0);
+        assert_eq!(
+            snapshot["sensors"].by_ack_mode,
+            BTreeMap::from([("explicit", 1), ("none", 1)])
+        );
+        assert_eq!(publishes.rate("orders", Duration::from_secs(10), T0), 0.0);
+    }
+
+    #[test]
+    fn test_rate_over_sliding_window() {
+        let publishes = PublishMetrics::new();
+        // 10 events per second for 20 seconds
+        for second in 0..20 {
+            for i in 0..10 {
+                publishes.record("sensors", "explicit", T0 + second * 1000 + i * 100);
+            }
+        }
+        let now = T0 + 19_999;
+
+        assert_eq!(
+            publishes.rate("sensors", Duration::from_secs(10), now),
+            10.0
+        );
+        assert_eq!(publishes.rate("sensors", Duration::from_secs(40), now), 5.0);
+        // Older seconds leave the window
+        let later = now + 15_000;
+        assert_eq!(
+            publishes.rate("sensors", Duration::from_secs(10), later),
+            0.0
+        );
+        assert_eq!(
+            publishes.rate("sensors", Duration::from_secs(20), later),
+            2.5
+        );
+        assert_eq!(publishes.count("sensors"), 200);
+    }
+
+    #[test]
+    fn test_slots_reused_after_a_lap() {
+        let publishes = PublishMetrics::new();
+        publishes.record("sensors", "explicit", T0);
+        // Same slot, one lap of the ring later
+        let lap = MAX_RATE_WINDOW.as_millis() as i64;
+        publishes.record("sensors", "explicit", T0 + lap);
+
+        let rate = publishes.rate("sensors", MAX_RATE_WINDOW, T0 + lap);
+        assert_eq!(rate, 1.0 / 300.0);
+        assert_eq!(publishes.count("sensors"), 2);
+
+        let snapshot = publishes.snapshot(Duration::from_secs(1), T0 + lap);
+        assert_eq!(
+            snapshot["sensors"],
+            PublishSnapshot {
+                count: 2,
+                rate: 1.0,
+                by_ack_mode: BTreeMap::from([("explicit", 2)]),
+            }
+        );
+    }
+}
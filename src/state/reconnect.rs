@@ -0,0 +1,165 @@
+use crate::event::{FluxEvent, Priority};
+use crate::nats::{decode_event, EventPublisher, StreamReader, ALERT_STREAM};
+use crate::state::StateEngine;
+use anyhow::{Context, Result};
+use async_nats::jetstream;
+use serde_json::json;
+use std::sync::Arc;
+use tokio::sync::broadcast;
+use tracing::{info, warn};
+
+/// What a reconnect check did.
+#[derive(Debug, Clone, PartialEq)]
+pub enum RecoveryOutcome {
+    /// No events were stored past the last processed sequence
+    UpToDate,
+    /// Startup replay still running; the consumer is already catching up
+    Replaying,
+    /// Missed events applied directly from the stream
+    Replayed { from: u64, to: u64, applied: usize },
+    /// Gap larger than `max_gap`: left to the consumer and alerted
+    Skipped { gap: u64 },
+}
+
+/// Catches the state engine up after a NATS reconnect.
+///
+/// On each reconnect, compares the engine's last processed sequence with the
+/// stream head. Gaps up to `max_gap` are replayed straight from the stream
+/// (the subscriber skips sequences already applied); larger gaps are left to
+/// the durable consumer and reported on `flux.system.alerts`.
+pub struct ReconnectRecovery {
+    jetstream: jetstream::Context,
+    stream_name: String,
+    engine: Arc<StateEngine>,
+    max_gap: u64,
+    publisher: Option<EventPublisher>,
+}
+
+impl ReconnectRecovery {
+    pub fn new(
+        jetstream: jetstream::Context,
+        stream_name: impl Into<String>,
+        engine: Arc<StateEngine>,
+        max_gap: u64,
+    ) -> Self {
+        Self {
+            jetstream,
+            stream_name: stream_name.into(),
+            engine,
+            max_gap,
+            publisher: None,
+        }
+    }
+
+    /// Publish an alert to `flux.system.alerts` when a gap is too large to replay.
+    pub fn with_alerts(mut self, publisher: EventPublisher) -> Self {
+        self.publisher = Some(publisher);
+        self
+    }
+
+    /// Check the gap once and replay or alert.
+    pub async fn recover(&self) -> Result<RecoveryOutcome> {
+        if !self.engine.is_live() {
+            return Ok(RecoveryOutcome::Replaying);
+        }
+
+        let mut stream = self
+            .jetstream
+            .get_stream(&self.stream_name)
+            .await
+            .context("Failed to get JetStream stream")?;
+        let head = stream.info().await?.state.last_sequence;
+        let last = self.engine.get_last_processed_sequence();
+        let gap = head.saturating_sub(last);
+
+        if gap == 0 {
+            return Ok(RecoveryOutcome::UpToDate);
+        }
+        if gap > self.max_gap {
+            warn!(
+                stream = %self.stream_name,
+                last_processed = last,
+                head,
+                gap,
+                max_gap = self.max_gap,
+                "Reconnect gap too large, skipping catch-up replay"
+            );
+            self.alert(last, head, gap).await;
+            return Ok(RecoveryOutcome::Skipped { gap });
+        }
+
+        let reader = StreamReader::new(stream);
+        let from = last + 1;
+        let mut applied = 0;
+        for sequence in from..=head {
+            // Missing sequences were deleted or aged out; nothing to apply
+            let Ok(message) = reader.get(sequence).await else {
+                continue;
+            };
+            match decode_event(Some(&message.headers), &message.payload) {
+                Ok(event) => {
+                    if self.engine.apply_at_sequence(sequence, &event) {
+                        applied += 1;
+                    }
+                }
+                Err(e) => warn!(error = %e, sequence, "Failed to decode event during catch-up"),
+            }
+        }
+
+        info!(
+            stream = %self.stream_name,
+            from,
+            to = head,
+            applied,
+            "Reconnect catch-up replay complete"
+        );
+        Ok(RecoveryOutcome::Replayed {
+            from,
+            to: head,
+            applied,
+        })
+    }
+
+    async fn alert(&self, last_processed: u64, head: u64, gap: u64) {
+        let Some(publisher) = &self.publisher else {
+            return;
+        };
+        let result = FluxEvent::builder(ALERT_STREAM)
+            .source("flux")
+            .key(self.stream_name.clone())
+            .priority(Priority::High)
+            .payload(json!({
+                "entity_id": format!("flux/reconnect-gap-{}", self.stream_name.to_lowercase()),
+                "properties": {
+                    "alert": "reconnect_gap",
+                    "stream": self.stream_name,
+                    "last_processed": last_processed,
+                    "head": head,
+                    "gap": gap,
+                    "max_gap": self.max_gap,
+                }
+            }))
+            .build();
+        let result = match result {
+            Ok(event) => publisher.publish(&event).await,
+            Err(e) => Err(e.into()),
+        };
+        if let Err(e) = result {
+            warn!(error = %e, "Failed to publish reconnect gap alert");
+        }
+    }
+
+    /// Run `recover` on every reconnect signal until the sender is dropped.
+    pub async fn run(self: Arc<Self>, mut reconnects: broadcast::Receiver<()>) {
+        loop {
+            match reconnects.recv().await {
+                Ok(()) | Err(broadcast::error::RecvError::Lagged(_)) => {
+                    if let Err(e) = self.recover().await {
+                        warn!(error = %e, "Reconnect recovery failed");
+                    }
+                }
+                Err(broadcast::error::RecvError::Closed) => break,
+            }
+        }
+    }
+}
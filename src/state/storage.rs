@@ -0,0 +1,90 @@
+use serde::Serialize;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Arc;
+
+/// Point-in-time view of publisher storage counters.
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct StorageSnapshot {
+    /// Serialized JSON bytes of all published events
+    pub raw_bytes: u64,
+    /// Bytes actually written to JetStream (after compression)
+    pub stored_bytes: u64,
+    pub events: u64,
+    pub compressed_events: u64,
+    /// eventId index writes that failed (the events themselves were published)
+    pub index_write_failures: u64,
+    /// stored_bytes / raw_bytes (1.0 when nothing was published)
+    pub ratio: f64,
+}
+
+/// Raw vs stored payload bytes, to observe compression savings.
+#[derive(Clone, Default)]
+pub struct StorageMetrics {
+    raw_bytes: Arc<AtomicU64>,
+    stored_bytes: Arc<AtomicU64>,
+    events: Arc<AtomicU64>,
+    compressed_events: Arc<AtomicU64>,
+    index_write_failures: Arc<AtomicU64>,
+}
+
+impl StorageMetrics {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Record one published event.
+    pub fn record(&self, raw_bytes: usize, stored_bytes: usize, compressed: bool) {
+        self.raw_bytes
+            .fetch_add(raw_bytes as u64, Ordering::Relaxed);
+        self.stored_bytes
+            .fetch_add(stored_bytes as u64, Ordering::Relaxed);
+        self.events.fetch_add(1, Ordering::Relaxed);
+        if compressed {
+            self.compressed_events.fetch_add(1, Ordering::Relaxed);
+        }
+    }
+
+    /// Record a failed eventId index write.
+    pub fn record_index_failure(&self) {
+        self.index_write_failures.fetch_add(1, Ordering::Relaxed);
+    }
+
+    pub fn snapshot(&self) -> StorageSnapshot {
+        let raw_bytes = self.raw_bytes.load(Ordering::Relaxed);
+        let stored_bytes = self.stored_bytes.load(Ordering::Relaxed);
+        StorageSnapshot {
+            raw_bytes,
+            stored_bytes,
+            events: self.events.load(Ordering::Relaxed),
+            compressed_events: self.compressed_events.load(Ordering::Relaxed),
+            index_write_failures: self.index_write_failures.load(Ordering::Relaxed),
+            ratio: if raw_bytes == 0 {
+                1.0
+            } else {
+                stored_bytes as f64 / raw_bytes as f64
+            },
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_ratio() {
+        let storage = StorageMetrics::new();
+        assert_eq!(storage.snapshot().ratio, 1.0);
+
+        storage.record(1000, 100, true);
+        storage.record(200, 200, false);
+
+        let snap = storage.snapshot();
+        assert_eq!(snap.raw_bytes, 1200);
+        assert_eq!(snap.stored_bytes, 300);
+        assert_eq!(snap.events, 2);
+        assert_eq!(snap.compressed_events, 1);
+        assert_eq!(snap.index_write_failures, 0);
+        assert!((snap.ratio - 0.25).abs() < 1e-9);
+    }
+}
@@ -304,6 +304,12 @@ fn test_tombstone_event_deletes_entity() {
         timestamp: Utc::now().timestamp_millis(),
         key: Some("test_entity".to_string()),
         schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
         payload: json!({
             "entity_id": "test_entity",
             "properties": {
@@ -311,6 +317,7 @@ fn test_tombstone_event_deletes_entity() {
                 "__deleted_at__": Utc::now().timestamp_millis()
             }
         }),
+        raw_payload: None,
     };
 
     engine.process_event(&tombstone);
@@ -369,3 +376,24 @@ fn test_deletion_broadcast() {
     let deleted = deletion_rx.try_recv().unwrap();
     assert_eq!(deleted.entity_id, "test_entity");
 }
+
+#[test]
+fn test_apply_at_sequence_skips_already_applied() {
+    let engine = StateEngine::new();
+    let event = |value: i64| {
+        FluxEvent::builder("sensors")
+            .source("test")
+            .payload(json!({"entity_id": "sensor_1", "properties": {"v": value}}))
+            .must_build()
+    };
+
+    assert!(engine.apply_at_sequence(1, &event(1)));
+    assert!(engine.apply_at_sequence(3, &event(3)));
+    // Sequence 2 arrives late (or redelivered): already past it
+    assert!(!engine.apply_at_sequence(2, &event(2)));
+    assert!(!engine.apply_at_sequence(3, &event(3)));
+
+    assert_eq!(engine.get_last_processed_sequence(), 3);
+    let entity = engine.get_entity("sensor_1").unwrap();
+    assert_eq!(entity.properties.get("v").unwrap(), &json!(3));
+}
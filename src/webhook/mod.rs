@@ -0,0 +1,519 @@
+use crate::event::{canonicalize_event, is_valid_stream_name, FluxEvent, Priority};
+use crate::nats::{
+    high_priority_subject, stream_subject, EventPublisher, ReceivedEvent, TRACEPARENT_HEADER,
+};
+use crate::state::LagMetrics;
+use anyhow::{bail, Context, Result};
+use async_nats::jetstream::{self, consumer, AckKind};
+use futures::StreamExt;
+use serde::Deserialize;
+use serde_json::json;
+use sha2::{Digest, Sha256};
+use std::sync::Arc;
+use std::time::Duration;
+use tokio::sync::{Notify, Semaphore};
+use tracing::{debug, info, warn};
+
+/// Header carrying `sha256=<hex HMAC of the body>`, keyed with the webhook secret
+pub const SIGNATURE_HEADER: &str = "X-Flux-Signature";
+
+/// Header carrying the event id, for receiver-side deduplication
+pub const EVENT_ID_HEADER: &str = "X-Flux-Event-Id";
+
+/// Header carrying how many times JetStream has delivered the event to this
+/// webhook (above 1 after a redelivery)
+pub const DELIVERY_COUNT_HEADER: &str = "X-Flux-Delivery-Count";
+
+/// Flux stream that receives deliveries that failed permanently
+pub const DEAD_LETTER_STREAM: &str = "flux.system.deadletter";
+
+/// Longest wait between retries
+const MAX_BACKOFF: Duration = Duration::from_secs(30);
+
+/// Webhook egress settings (`[webhooks]`).
+#[derive(Debug, Clone, Deserialize)]
+pub struct WebhookSettings {
+    /// Requests in flight across all webhooks
+    #[serde(default = "default_max_in_flight")]
+    pub max_in_flight: usize,
+    #[serde(default)]
+    pub targets: Vec<WebhookConfig>,
+}
+
+fn default_max_in_flight() -> usize {
+    64
+}
+
+impl Default for WebhookSettings {
+    fn default() -> Self {
+        Self {
+            max_in_flight: default_max_in_flight(),
+            targets: Vec::new(),
+        }
+    }
+}
+
+/// One webhook target (`[[webhooks.targets]]`).
+#[derive(Debug, Clone, Deserialize)]
+pub struct WebhookConfig {
+    /// Unique name; the durable consumer is `flux-webhook-{name}`
+    pub name: String,
+    /// Flux stream to deliver
+    pub stream: String,
+    /// Only deliver events with this key
+    #[serde(default)]
+    pub key: Option<String>,
+    pub url: String,
+    /// HMAC-SHA256 key for the signature header
+    pub secret: String,
+    /// Retries after the first attempt on 5xx, 408, 429 and timeouts
+    #[serde(default = "default_max_retries")]
+    pub max_retries: u32,
+    /// Deliveries in flight for this webhook
+    #[serde(default = "default_concurrency")]
+    pub concurrency: usize,
+    #[serde(default = "default_timeout_ms")]
+    pub timeout_ms: u64,
+}
+
+fn default_max_retries() -> u32 {
+    5
+}
+
+fn default_concurrency() -> usize {
+    1
+}
+
+fn default_timeout_ms() -> u64 {
+    10_000
+}
+
+impl WebhookConfig {
+    pub fn validate(&self) -> Result<()> {
+        if self.name.is_empty()
+            || !self
+                .name
+                .chars()
+                .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+        {
+            bail!(
+                "webhook name '{}' must be non-empty [A-Za-z0-9_-]",
+                self.name
+            );
+        }
+        if !is_valid_stream_name(&self.stream) {
+            bail!("webhook '{}': invalid stream '{}'", self.name, self.stream);
+        }
+        if !self.url.starts_with("http://") && !self.url.starts_with("https://") {
+            bail!("webhook '{}': url must be http(s)", self.name);
+        }
+        if self.concurrency == 0 {
+            bail!("webhook '{}': concurrency must be at least 1", self.name);
+        }
+        Ok(())
+    }
+}
+
+/// Result of delivering one event.
+#[derive(Debug, Clone, PartialEq)]
+pub enum DeliveryOutcome {
+    Delivered {
+        attempts: u32,
+    },
+    /// Gave up: non-retryable status, or retries exhausted
+    Failed {
+        attempts: u32,
+        /// Last HTTP status (None if the last attempt got no response)
+        status: Option<u16>,
+        error: String,
+    },
+}
+
+/// `sha256=<hex>` HMAC-SHA256 signature of `body`.
+pub fn sign(secret: &str, body: &[u8]) -> String {
+    const BLOCK: usize = 64;
+    let mut key = [0u8; BLOCK];
+    if secret.len() > BLOCK {
+        key[..32].copy_from_slice(&Sha256::digest(secret.as_bytes()));
+    } else {
+        key[..secret.len()].copy_from_slice(secret.as_bytes());
+    }
+
+    let pad = |byte: u8| key.iter().map(|k| k ^ byte).collect::<Vec<_>>();
+    let inner = Sha256::new()
+        .chain_update(pad(0x36))
+        .chain_update(body)
+        .finalize();
+    let mac = Sha256::new()
+        .chain_update(pad(0x5c))
+        .chain_update(inner)
+        .finalize();
+
+    let hex: String = mac.iter().map(|b| format!("{:02x}", b)).collect();
+    format!("sha256={}", hex)
+}
+
+/// Pushes events from one Flux stream to an HTTP endpoint.
+///
+/// Runs a durable consumer (`flux-webhook-{name}`) and POSTs each event as
+/// JSON with an HMAC signature. 5xx, 408, 429 and timeouts are retried with
+/// exponential backoff; other failures, and retries exhausted, are parked on
+/// `flux.system.deadletter` with the last HTTP status. Delivery is
+/// at-least-once; receivers can deduplicate on `X-Flux-Event-Id`.
+pub struct WebhookDispatcher {
+    config: WebhookConfig,
+    http: reqwest::Client,
+    in_flight: Arc<Semaphore>,
+    dead_letter: Option<EventPublisher>,
+    backoff: Duration,
+    lag_metrics: Option<LagMetrics>,
+    shutdown: Notify,
+}
+
+impl WebhookDispatcher {
+    /// `in_flight` is shared by all dispatchers to cap concurrent requests.
+    pub fn new(config: WebhookConfig, in_flight: Arc<Semaphore>) -> Result<Self> {
+        config.validate()?;
+        let http = reqwest::Client::builder()
+            .timeout(Duration::from_millis(config.timeout_ms))
+            .build()
+            .context("Failed to build webhook HTTP client")?;
+
+        Ok(Self {
+            config,
+            http,
+            in_flight,
+            dead_letter: None,
+            backoff: Duration::from_millis(500),
+            lag_metrics: None,
+            shutdown: Notify::new(),
+        })
+    }
+
+    /// Park failed deliveries on `flux.system.deadletter` via `publisher`.
+    pub fn with_dead_letter(mut self, publisher: EventPublisher) -> Self {
+        self.dead_letter = Some(publisher);
+        self
+    }
+
+    /// Initial retry delay, doubled per attempt (default 500ms, max 30s).
+    pub fn with_backoff(mut self, backoff: Duration) -> Self {
+        self.backoff = backoff;
+        self
+    }
+
+    /// Record delivery latency under the consumer `flux-webhook-{name}`.
+    pub fn with_lag_metrics(mut self, lag_metrics: LagMetrics) -> Self {
+        self.lag_metrics = Some(lag_metrics);
+        self
+    }
+
+    pub fn name(&self) -> &str {
+        &self.config.name
+    }
+
+    /// True if the event matches this webhook's stream and key filter.
+    pub fn matches(&self, event: &FluxEvent) -> bool {
+        event.stream == self.config.stream
+            && self
+                .config
+                .key
+                .as_ref()
+                .map_or(true, |key| event.key.as_ref() == Some(key))
+    }
+
+    /// POST one event, retrying transient failures.
+    pub async fn deliver(&self, event: &FluxEvent) -> DeliveryOutcome {
+        self.deliver_with_headers(event, &[]).await
+    }
+
+    /// `deliver` for a consumed event, adding its delivery count and the
+    /// producer's `traceparent` (if any) as request headers.
+    pub async fn deliver_received(&self, received: &ReceivedEvent) -> DeliveryOutcome {
+        let mut headers = vec![(DELIVERY_COUNT_HEADER, received.meta.delivered.to_string())];
+        if let Some(trace_parent) = received.trace_parent() {
+            headers.push((TRACEPARENT_HEADER, trace_parent.to_string()));
+        }
+        self.deliver_with_headers(&received.event, &headers).await
+    }
+
+    async fn deliver_with_headers(
+        &self,
+        event: &FluxEvent,
+        headers: &[(&str, String)],
+    ) -> DeliveryOutcome {
+        // Canonical bytes, so a receiver can re-derive the signed body from
+        // the parsed event
+        let body = match canonicalize_event(event) {
+            Ok(body) => body,
+            Err(e) => {
+                return DeliveryOutcome::Failed {
+                    attempts: 0,
+                    status: None,
+                    error: e.to_string(),
+                }
+            }
+        };
+        let signature = sign(&self.config.secret, &body);
+        let event_id = event.event_id.clone().unwrap_or_default();
+
+        let mut attempts = 0;
+        loop {
+            attempts += 1;
+            let result = {
+                let _permit = self.in_flight.acquire().await;
+                let mut request = self
+                    .http
+                    .post(&self.config.url)
+                    .header(reqwest::header::CONTENT_TYPE, "application/json")
+                    .header(SIGNATURE_HEADER, &signature)
+                    .header(EVENT_ID_HEADER, &event_id);
+                for (name, value) in headers {
+                    request = request.header(*name, value);
+                }
+                request.body(body.clone()).send().await
+            };
+
+            let (status, error, retryable) = match result {
+                Ok(response) if response.status().is_success() => {
+                    return DeliveryOutcome::Delivered { attempts };
+                }
+                Ok(response) => {
+                    let status = response.status();
+                    let retryable = status.is_server_error()
+                        || status == reqwest::StatusCode::REQUEST_TIMEOUT
+                        || status == reqwest::StatusCode::TOO_MANY_REQUESTS;
+                    (Some(status.as_u16()), status.to_string(), retryable)
+                }
+                Err(e) => (None, e.to_string(), true),
+            };
+
+            if !retryable || attempts > self.config.max_retries {
+                return DeliveryOutcome::Failed {
+                    attempts,
+                    status,
+                    error,
+                };
+            }
+
+            let delay = self
+                .backoff
+                .saturating_mul(1 << (attempts - 1).min(16))
+                .min(MAX_BACKOFF);
+            debug!(
+                webhook = %self.config.name,
+                attempts,
+                error = %error,
+                "Webhook delivery failed, retrying in {:?}",
+                delay
+            );
+            tokio::time::sleep(delay).await;
+        }
+    }
+
+    /// Publish a failed delivery to `flux.system.deadletter`.
+    pub async fn park(&self, event: &FluxEvent, outcome: &DeliveryOutcome) -> Result<()> {
+        let DeliveryOutcome::Failed {
+            attempts,
+            status,
+            error,
+        } = outcome
+        else {
+            return Ok(());
+        };
+        let Some(publisher) = &self.dead_letter else {
+            return Ok(());
+        };
+
+        let parked = FluxEvent::builder(DEAD_LETTER_STREAM)
+            .source("flux")
+            .key(self.config.name.clone())
+            .priority(Priority::High)
+            .payload(json!({
+                "entity_id": format!("flux/webhook-{}", self.config.name),
+                "properties": {
+                    "webhook": self.config.name,
+                    "url": self.config.url,
+                    "attempts": attempts,
+                    "last_status": status,
+                    "error": error,
+                    "event": event,
+                }
+            }))
+            .build()?;
+        publisher.publish(&parked).await
+    }
+
+    /// Upper bound on one `deliver` call, used as the consumer's ack wait so
+    /// messages are not redelivered while retries back off.
+    fn retry_budget(&self) -> Duration {
+        let attempts = self.config.max_retries + 1;
+        (Duration::from_millis(self.config.timeout_ms) + MAX_BACKOFF) * attempts
+    }
+
+    /// Consume the stream and deliver events until `stop` is called.
+    pub async fn run(
+        self: Arc<Self>,
+        jetstream: jetstream::Context,
+        stream_name: String,
+    ) -> Result<()> {
+        let subject = stream_subject(&self.config.stream);
+        let high_priority = high_priority_subject(&self.config.stream);
+        let durable = self.durable_name();
+        let stream = jetstream
+            .get_stream(&stream_name)
+            .await
+            .context("Failed to get JetStream stream")?;
+        let consumer = stream
+            .get_or_create_consumer(
+                &durable,
+                consumer::pull::Config {
+                    durable_name: Some(durable.clone()),
+                    filter_subjects: vec![subject, high_priority],
+                    deliver_policy: consumer::DeliverPolicy::New,
+                    ack_policy: consumer::AckPolicy::Explicit,
+                    ack_wait: self.retry_budget(),
+                    ..Default::default()
+                },
+            )
+            .await
+            .context("Failed to create webhook consumer")?;
+        let messages = consumer.messages().await?;
+
+        info!(
+            webhook = %self.config.name,
+            stream = %self.config.stream,
+            url = %self.config.url,
+            "Starting webhook dispatcher"
+        );
+
+        messages
+            .take_until(self.shutdown.notified())
+            .for_each_concurrent(self.config.concurrency, |message| {
+                let dispatcher = Arc::clone(&self);
+                async move {
+                    match message {
+                        Ok(message) => dispatcher.handle(message).await,
+                        Err(e) => warn!(error = %e, "Error receiving webhook message"),
+                    }
+                }
+            })
+            .await;
+
+        info!(webhook = %self.config.name, "Webhook dispatcher stopped");
+        Ok(())
+    }
+
+    async fn handle(&self, message: jetstream::Message) {
+        let received = match ReceivedEvent::from_message(&message) {
+            Ok(received) => received,
+            Err(e) => {
+                warn!(error = %e, webhook = %self.config.name, "Failed to decode event, skipping");
+                let _ = message.ack().await;
+                return;
+            }
+        };
+        let event = &received.event;
+        if !self.matches(event) {
+            let _ = message.ack().await;
+            return;
+        }
+        if let Some(lag) = &self.lag_metrics {
+            lag.observe_delivery(
+                &self.durable_name(),
+                &event.stream,
+                event.timestamp,
+                chrono::Utc::now().timestamp_millis(),
+            );
+        }
+
+        let outcome = self.deliver_received(&received).await;
+        if let DeliveryOutcome::Failed { .. } = outcome {
+            warn!(
+                webhook = %self.config.name,
+                event_id = %event.event_id.as_deref().unwrap_or_default(),
+                outcome = ?outcome,
+                "Webhook delivery failed permanently"
+            );
+            if let Err(e) = self.park(event, &outcome).await {
+                // Not parked: let JetStream redeliver it later
+                warn!(error = %e, "Failed to dead-letter webhook delivery");
+                let _ = message.ack_with(AckKind::Nak(None)).await;
+                return;
+            }
+        }
+        let _ = message.ack().await;
+    }
+
+    fn durable_name(&self) -> String {
+        format!("flux-webhook-{}", self.config.name)
+    }
+
+    /// Stop consuming; in-flight deliveries finish first.
+    pub fn stop(&self) {
+        self.shutdown.notify_one();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn config() -> WebhookConfig {
+        WebhookConfig {
+            name: "crm".to_string(),
+            stream: "orders".to_string(),
+            key: None,
+            url: "https://example.com/hook".to_string(),
+            secret: "s3cret".to_string(),
+            max_retries: 5,
+            concurrency: 1,
+            timeout_ms: 1000,
+        }
+    }
+
+    #[test]
+    fn test_sign_matches_rfc4231() {
+        // RFC 4231 test case 2
+        assert_eq!(
+            sign("Jefe", b"what do ya want for nothing?"),
+            "sha256=5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+        );
+    }
+
+    #[test]
+    fn test_validate() {
+        assert!(config().validate().is_ok());
+
+        let mut bad = config();
+        bad.name = "has.dot".to_string();
+        assert!(bad.validate().is_err());
+
+        let mut bad = config();
+        bad.url = "ftp://example.com".to_string();
+        assert!(bad.validate().is_err());
+
+        let mut bad = config();
+        bad.concurrency = 0;
+        assert!(bad.validate().is_err());
+    }
+
+    #[test]
+    fn test_matches_stream_and_key() {
+        let mut config = config();
+        config.key = Some("eu".to_string());
+        let dispatcher = WebhookDispatcher::new(config, Arc::new(Semaphore::new(1))).unwrap();
+
+        let event = |stream: &str, key: Option<&str>| FluxEvent {
+            key: key.map(str::to_string),
+            ..FluxEvent::builder(stream)
+                .source("test")
+                .payload(json!({}))
+                .must_build()
+        };
+        assert!(dispatcher.matches(&event("orders", Some("eu"))));
+        assert!(!dispatcher.matches(&event("orders", Some("us"))));
+        assert!(!dispatcher.matches(&event("orders", None)));
+        assert!(!dispatcher.matches(&event("payments", Some("eu"))));
+    }
+}
@@ -0,0 +1,156 @@
+// Integration tests for publish ack modes against a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{AckMode, EventPublisher, NatsClient, NatsConfig, PublishReceipt};
+use flux::state::PublishMetrics;
+use serde_json::json;
+use std::collections::BTreeMap;
+use std::time::Duration;
+
+fn reading(entity_id: &str) -> FluxEvent {
+    FluxEvent::builder("telemetry")
+        .source("ack-mode-test")
+        .payload(json!({"entity_id": entity_id, "properties": {"rpm": 1450}}))
+        .must_build()
+}
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+fn publisher(client: &NatsClient) -> EventPublisher {
+    EventPublisher::new(client.jetstream().clone()).with_core_client(client.client().clone())
+}
+
+/// Messages in FLUX_EVENTS once it holds `expected` (unacked publishes land
+/// asynchronously), or after a few seconds of waiting.
+async fn message_count(client: &NatsClient, expected: u64) -> u64 {
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    for _ in 0..50 {
+        let messages = stream.info().await.unwrap().state.messages;
+        if messages >= expected {
+            return messages;
+        }
+        tokio::time::sleep(Duration::from_millis(100)).await;
+    }
+    stream.info().await.unwrap().state.messages
+}
+
+#[tokio::test]
+async fn test_receipt_shape_per_mode() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = publisher(&client);
+
+    let explicit = publisher
+        .publish_with_mode(&reading("pump-1"), AckMode::Explicit)
+        .await
+        .unwrap()
+        .unwrap();
+    assert!(matches!(explicit, PublishReceipt::Acked(_)));
+    assert_eq!(explicit.sequence(), Some(1));
+
+    let pending = publisher
+        .publish_with_mode(&reading("pump-2"), AckMode::Async)
+        .await
+        .unwrap()
+        .unwrap();
+    assert_eq!(pending.sequence(), None);
+    let PublishReceipt::Pending(pending) = pending else {
+        panic!("expected a pending ack");
+    };
+    assert_eq!(pending.subject(), "flux.events.telemetry");
+    assert_eq!(pending.wait().await.unwrap().sequence, 2);
+
+    let sent = publisher
+        .publish_with_mode(&reading("pump-3"), AckMode::None)
+        .await
+        .unwrap()
+        .unwrap();
+    assert!(matches!(sent, PublishReceipt::Sent));
+    assert_eq!(sent.sequence(), None);
+}
+
+#[tokio::test]
+async fn test_unacked_events_land_in_stream() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = publisher(&client).with_ack_mode(AckMode::None);
+
+    for i in 0..5 {
+        publisher
+            .publish(&reading(&format!("pump-{}", i)))
+            .await
+            .unwrap();
+    }
+    // The stream captures flux.events.>, so core publishes are stored too
+    assert_eq!(message_count(&client, 5).await, 5);
+}
+
+#[tokio::test]
+async fn test_none_mode_needs_core_client() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    let err = publisher
+        .publish_with_mode(&reading("pump-1"), AckMode::None)
+        .await
+        .unwrap_err();
+    assert!(err.to_string().contains("core NATS client"), "{}", err);
+}
+
+#[tokio::test]
+async fn test_async_batch_reports_each_ack() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = publisher(&client);
+
+    let events: Vec<_> = (0..10).map(|i| reading(&format!("pump-{}", i))).collect();
+    let results = publisher
+        .publish_batch_with_mode(&events, AckMode::Async)
+        .await
+        .unwrap();
+    assert_eq!(results.len(), 10);
+    assert!(results.iter().all(|result| result.is_ok()));
+    assert_eq!(message_count(&client, 10).await, 10);
+}
+
+#[tokio::test]
+async fn test_metrics_labelled_by_ack_mode() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publishes = PublishMetrics::new();
+    let publisher = publisher(&client).with_publish_metrics(publishes.clone());
+
+    publisher.publish(&reading("pump-1")).await.unwrap();
+    let receipt = publisher
+        .publish_with_mode(&reading("pump-2"), AckMode::Async)
+        .await
+        .unwrap();
+    if let Some(PublishReceipt::Pending(pending)) = receipt {
+        pending.wait().await.unwrap();
+    }
+    for i in 3..6 {
+        publisher
+            .publish_with_mode(&reading(&format!("pump-{}", i)), AckMode::None)
+            .await
+            .unwrap();
+    }
+
+    assert_eq!(publishes.count("telemetry"), 5);
+    let snapshot = publishes.snapshot(Duration::from_secs(60), 0);
+    assert_eq!(
+        snapshot["telemetry"].by_ack_mode,
+        BTreeMap::from([("async", 1), ("explicit", 1), ("none", 3)])
+    );
+}
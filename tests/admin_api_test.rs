@@ -1,4 +1,4 @@
-// Integration tests for GET/PUT /api/admin/config
+// Integration tests for GET/PUT /api/admin/config and POST /api/admin/reload
 
 use axum::{
     body::Body,
@@ -6,13 +6,15 @@ use axum::{
     Router,
 };
 use flux::api::{create_admin_router, AdminAppState};
-use flux::config::{new_runtime_config, RuntimeConfig};
+use flux::config::{new_runtime_config, ConfigReloader, RuntimeConfig};
+use std::sync::Arc;
 use tower::ServiceExt;
 
 fn create_test_app(admin_token: Option<&str>) -> Router {
     let state = AdminAppState {
         runtime_config: new_runtime_config(),
         admin_token: admin_token.map(|t| t.to_string()),
+        reloader: None,
     };
     create_admin_router(state)
 }
@@ -21,6 +23,7 @@ fn create_test_app_with_config(runtime_config: flux::config::SharedRuntimeConfig
     let state = AdminAppState {
         runtime_config,
         admin_token: admin_token.map(|t| t.to_string()),
+        reloader: None,
     };
     create_admin_router(state)
 }
@@ -199,3 +202,53 @@ async fn test_put_config_partial_update() {
         defaults.body_size_limit_batch_bytes
     );
 }
+
+fn reload_request(token: &str) -> Request<Body> {
+    Request::builder()
+        .method("POST")
+        .uri("/api/admin/reload")
+        .header("Authorization", bearer(token))
+        .body(Body::empty())
+        .unwrap()
+}
+
+/// POST /api/admin/reload applies limits from the config file; an invalid
+/// file is rejected and the previous config stays in effect.
+#[tokio::test]
+async fn test_reload_applies_file_limits() {
+    let dir = tempfile::tempdir().unwrap();
+    let path = dir.path().join("config.toml");
+    std::fs::write(&path, "[limits]\nrate_limit_per_namespace_per_minute = 7\n").unwrap();
+
+    let shared = new_runtime_config();
+    let state = AdminAppState {
+        runtime_config: shared.clone(),
+        admin_token: Some("secret".to_string()),
+        reloader: Some(Arc::new(ConfigReloader::new(
+            path.to_string_lossy(),
+            shared.clone(),
+        ))),
+    };
+    let app = create_admin_router(state);
+
+    let response = app.clone().oneshot(reload_request("wrong")).await.unwrap();
+    assert_eq!(response.status(), StatusCode::UNAUTHORIZED);
+
+    let response = app.clone().oneshot(reload_request("secret")).await.unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    assert_eq!(shared.read().unwrap().rate_limit_per_namespace_per_minute, 7);
+
+    // Invalid limits are rejected; the reloaded value stays
+    std::fs::write(&path, "[limits]\nbody_size_limit_single_bytes = 0\n").unwrap();
+    let response = app.oneshot(reload_request("secret")).await.unwrap();
+    assert_eq!(response.status(), StatusCode::UNPROCESSABLE_ENTITY);
+    assert_eq!(shared.read().unwrap().rate_limit_per_namespace_per_minute, 7);
+}
+
+/// Without a reloader the endpoint is unavailable.
+#[tokio::test]
+async fn test_reload_without_reloader_returns_503() {
+    let app = create_test_app(Some("secret"));
+    let response = app.oneshot(reload_request("secret")).await.unwrap();
+    assert_eq!(response.status(), StatusCode::SERVICE_UNAVAILABLE);
+}
@@ -0,0 +1,254 @@
+// Integration tests for publish admission control over HTTP and the NATS
+// service, against a real NATS server (see tests/common). Publishes to the
+// `slow` Flux stream are acked by a fake JetStream that holds every ack until
+// the test lets it go.
+
+mod common;
+
+use axum::body::Body;
+use axum::http::{Request, StatusCode};
+use axum::response::Response;
+use axum::Router;
+use common::TestNats;
+use flux::api::{create_query_router, create_router, AppState, QueryAppState};
+use flux::config::new_runtime_config;
+use flux::event::FluxEvent;
+use flux::namespace::NamespaceRegistry;
+use flux::nats::{
+    start_service, AdmissionConfig, EventPublisher, IngestApi, NatsClient, NatsConfig,
+    PublishAdmission,
+};
+use flux::rate_limit::RateLimiter;
+use flux::state::{AdmissionSnapshot, StateEngine};
+use futures::StreamExt;
+use serde_json::{json, Value};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+use tokio::sync::watch;
+use tower::ServiceExt;
+
+/// Acks publishes to `flux.events.slow` once `gate` is opened. FLUX_EVENTS
+/// doesn't capture the subject, so this is the only responder.
+async fn slow_jetstream(nats: &TestNats, gate: watch::Receiver<bool>) {
+    let client = nats.client().await;
+    let mut publishes = client.subscribe("flux.events.slow").await.unwrap();
+    client.flush().await.unwrap();
+    let mut seq = 0;
+    tokio::spawn(async move {
+        while let Some(message) = publishes.next().await {
+            seq += 1;
+            let client = client.clone();
+            let mut gate = gate.clone();
+            tokio::spawn(async move {
+                gate.wait_for(|open| *open).await.unwrap();
+                let ack = json!({"stream": "FAKE", "seq": seq});
+                client
+                    .publish(message.reply.unwrap(), ack.to_string().into())
+                    .await
+                    .unwrap();
+            });
+        }
+    });
+}
+
+struct Flux {
+    client: NatsClient,
+    router: Router,
+    publisher: EventPublisher,
+}
+
+async fn start_flux(nats: &TestNats) -> Flux {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        stream_subjects: vec!["flux.events.other".to_string()],
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let engine = Arc::new(StateEngine::new());
+    let admission = PublishAdmission::new(&AdmissionConfig {
+        max_in_flight: 2,
+        max_queued: 1,
+        retry_after_seconds: 3,
+    })
+    .with_metrics(engine.metrics.admission().clone());
+    let publisher = EventPublisher::new(client.jetstream().clone()).with_admission(admission);
+
+    let state = AppState {
+        event_publisher: publisher.for_api(IngestApi::Http),
+        namespace_registry: Arc::new(NamespaceRegistry::new()),
+        auth_enabled: false,
+        admin_token: None,
+        runtime_config: new_runtime_config(),
+        rate_limiter: Arc::new(RateLimiter::new()),
+    };
+    let router = create_router(state).merge(create_query_router(Arc::new(QueryAppState {
+        state_engine: engine,
+    })));
+    Flux {
+        client,
+        router,
+        publisher,
+    }
+}
+
+fn reading(n: u64) -> Value {
+    json!({
+        "stream": "slow",
+        "source": "admission-test",
+        "timestamp": chrono::Utc::now().timestamp_millis(),
+        "payload": {"entity_id": format!("sensor-{}", n), "properties": {"v": n}}
+    })
+}
+
+async fn post(router: &Router, uri: &str, body: Value) -> Response {
+    router
+        .clone()
+        .oneshot(
+            Request::builder()
+                .method("POST")
+                .uri(uri)
+                .header("content-type", "application/json")
+                .body(Body::from(body.to_string()))
+                .unwrap(),
+        )
+        .await
+        .unwrap()
+}
+
+async fn admission(router: &Router) -> AdmissionSnapshot {
+    let response = router
+        .clone()
+        .oneshot(
+            Request::builder()
+                .uri("/api/metrics/admission")
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let body: Value = serde_json::from_slice(&body).unwrap();
+    AdmissionSnapshot {
+        in_flight: body["in_flight"].as_u64().unwrap(),
+        queued: body["queued"].as_u64().unwrap(),
+        rejected: body["rejected"].as_u64().unwrap(),
+    }
+}
+
+async fn wait_for_admission(router: &Router, in_flight: u64, queued: u64) {
+    let started = Instant::now();
+    loop {
+        let snapshot = admission(router).await;
+        if (snapshot.in_flight, snapshot.queued) == (in_flight, queued) {
+            return;
+        }
+        assert!(
+            started.elapsed() < Duration::from_secs(5),
+            "admission stuck at {:?}",
+            snapshot
+        );
+        tokio::time::sleep(Duration::from_millis(10)).await;
+    }
+}
+
+#[tokio::test]
+async fn test_overload_sheds_http_and_service_publishes() {
+    let nats = TestNats::start();
+    let (gate, gate_rx) = watch::channel(false);
+    slow_jetstream(&nats, gate_rx).await;
+    let flux = start_flux(&nats).await;
+    let _service = start_service(
+        flux.client.client(),
+        flux.client.jetstream().clone(),
+        flux.publisher.for_api(IngestApi::Nats),
+        "FLUX_EVENTS".to_string(),
+    )
+    .await
+    .unwrap();
+
+    // Two publishes waiting on acks, one queued behind them
+    let pending: Vec<_> = (0..3)
+        .map(|n| {
+            let router = flux.router.clone();
+            tokio::spawn(async move { post(&router, "/api/events", reading(n)).await.status() })
+        })
+        .collect();
+    wait_for_admission(&flux.router, 2, 1).await;
+
+    let response = post(&flux.router, "/api/events", reading(3)).await;
+    assert_eq!(response.status(), StatusCode::SERVICE_UNAVAILABLE);
+    assert_eq!(response.headers()["retry-after"], "3");
+    assert_eq!(response.headers()["x-flux-queue-depth"], "1");
+
+    // The batch fails only the shed event, with the same headers
+    let batch = json!({"events": [reading(4)]});
+    let response = post(&flux.router, "/api/events/batch", batch).await;
+    assert_eq!(response.status(), StatusCode::OK);
+    assert_eq!(response.headers()["retry-after"], "3");
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let body: Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(body["failed"], 1);
+
+    // The NATS service shares the same slots
+    let probe = nats.client().await;
+    let reply = probe
+        .request("publish", reading(5).to_string().into())
+        .await
+        .unwrap();
+    let code = reply
+        .headers
+        .as_ref()
+        .and_then(|h| h.get("Nats-Service-Error-Code"))
+        .map(|v| v.as_str().to_string());
+    assert_eq!(code.as_deref(), Some("503"));
+    assert_eq!(admission(&flux.router).await.rejected, 3);
+
+    gate.send(true).unwrap();
+    for publish in pending {
+        assert_eq!(publish.await.unwrap(), StatusCode::OK);
+    }
+    wait_for_admission(&flux.router, 0, 0).await;
+    let response = post(&flux.router, "/api/events", reading(6)).await;
+    assert_eq!(response.status(), StatusCode::OK);
+}
+
+#[tokio::test]
+async fn test_internal_publishes_are_not_limited() {
+    let nats = TestNats::start();
+    let (gate, gate_rx) = watch::channel(false);
+    slow_jetstream(&nats, gate_rx).await;
+    let flux = start_flux(&nats).await;
+
+    let pending: Vec<_> = (0..3)
+        .map(|n| {
+            let router = flux.router.clone();
+            tokio::spawn(async move { post(&router, "/api/events", reading(n)).await.status() })
+        })
+        .collect();
+    wait_for_admission(&flux.router, 2, 1).await;
+
+    // Not counted against the limit; waits on its ack like the rest
+    let internal = tokio::spawn({
+        let publisher = flux.publisher.clone();
+        async move {
+            let event = FluxEvent::builder("slow")
+                .source("admission-test")
+                .payload(json!({"entity_id": "sensor-7", "properties": {}}))
+                .must_build();
+            publisher.publish(&event).await
+        }
+    });
+    tokio::time::sleep(Duration::from_millis(100)).await;
+    assert_eq!(admission(&flux.router).await.rejected, 0);
+
+    gate.send(true).unwrap();
+    internal.await.unwrap().unwrap();
+    for publish in pending {
+        assert_eq!(publish.await.unwrap(), StatusCode::OK);
+    }
+}
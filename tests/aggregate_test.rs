@@ -0,0 +1,77 @@
+// Integration test for AggregatingPublisher against a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::aggregate::{sum_reducer, AggregatingPublisher};
+use flux::event::FluxEvent;
+use flux::nats::{event_from_message, EventPublisher, NatsClient, NatsConfig};
+use futures::StreamExt;
+use serde_json::json;
+use std::time::Duration;
+
+async fn read_all_events(nats: &TestNats) -> Vec<FluxEvent> {
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let consumer = stream
+        .create_consumer(async_nats::jetstream::consumer::pull::OrderedConfig::default())
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut events = Vec::new();
+    while let Ok(Some(Ok(msg))) =
+        tokio::time::timeout(Duration::from_millis(200), messages.next()).await
+    {
+        events.push(event_from_message(&msg).unwrap());
+    }
+    events
+}
+
+fn reading(value: f64) -> FluxEvent {
+    FluxEvent::builder("sensors.raw")
+        .source("plant-a")
+        .payload(json!({"entity_id": "sensor-01", "properties": {"temperature": value}}))
+        .must_build()
+}
+
+#[tokio::test]
+async fn test_publishes_one_aggregate_per_window() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+
+    let aggregator = AggregatingPublisher::new(
+        EventPublisher::new(client.jetstream().clone()),
+        Duration::from_secs(60),
+        sum_reducer("temperature", "sensors.avg"),
+    )
+    .with_max_events(3);
+
+    // Third event closes the window
+    for value in [20.0, 21.0, 22.0] {
+        aggregator.publish(reading(value)).await.unwrap();
+    }
+    // Partial window, flushed explicitly
+    aggregator.publish(reading(30.0)).await.unwrap();
+    aggregator.flush().await.unwrap();
+    // Nothing buffered: no event
+    aggregator.flush().await.unwrap();
+
+    let events = read_all_events(&nats).await;
+    assert_eq!(events.len(), 2);
+    assert!(events.iter().all(|e| e.stream == "sensors.avg"));
+    assert_eq!(events[0].payload["count"], 3);
+    assert_eq!(events[0].payload["sum"], 63.0);
+    assert_eq!(events[0].payload["avg"], 21.0);
+    assert_eq!(events[1].payload["count"], 1);
+    assert!(
+        events[0].payload["window_start"].as_i64().unwrap()
+            <= events[0].payload["window_end"].as_i64().unwrap()
+    );
+}
@@ -0,0 +1,199 @@
+// Shared test harness for NATS-backed integration tests.
+//
+// Each call to `TestNats::start()` spawns a private `nats-server` process with
+// JetStream enabled, random client and monitoring ports (`-p -1 -m -1`) and
+// its own temp store directory, so parallel test binaries never collide. The
+// server is killed on drop.
+//
+// Set FLUX_TEST_NATS_URL to run against an external server instead (e.g. the
+// docker-compose NATS). If neither is available the harness panics rather than
+// silently skipping — a green run must mean JetStream was actually exercised.
+
+#![allow(dead_code)]
+
+use async_nats::jetstream;
+use std::path::{Path, PathBuf};
+use std::process::{Child, Command, Stdio};
+use std::time::{Duration, Instant};
+use tempfile::TempDir;
+
+/// A running NATS server for the duration of a test.
+pub struct TestNats {
+    pub url: String,
+    /// HTTP monitoring endpoint (`/connz`, `/varz`, ...) of spawned servers
+    pub monitoring_url: Option<String>,
+    child: Option<Child>,
+    _store_dir: Option<TempDir>,
+}
+
+impl TestNats {
+    /// Start an isolated JetStream-enabled server (or use FLUX_TEST_NATS_URL).
+    pub fn start() -> Self {
+        if let Ok(url) = std::env::var("FLUX_TEST_NATS_URL") {
+            return Self {
+                url,
+                monitoring_url: None,
+                child: None,
+                _store_dir: None,
+            };
+        }
+
+        Self::spawn(None, None)
+    }
+
+    /// Start an isolated server whose JetStream runs in `domain` (as on a
+    /// leaf node). Always spawns; FLUX_TEST_NATS_URL is ignored.
+    pub fn start_with_domain(domain: &str) -> Self {
+        Self::spawn(Some(domain), None)
+    }
+
+    /// Start an isolated server on a fixed port, e.g. one a client is
+    /// already retrying. Always spawns; FLUX_TEST_NATS_URL is ignored.
+    pub fn start_on_port(port: u16) -> Self {
+        Self::spawn(None, Some(port))
+    }
+
+    /// Kill the server and start it again on the same port and JetStream
+    /// store, as after a crash. Clients reconnect on their own; streams,
+    /// consumers and KV buckets survive. Panics for FLUX_TEST_NATS_URL
+    /// servers, which the harness does not own.
+    pub fn restart(&mut self) {
+        let store_dir = self
+            ._store_dir
+            .take()
+            .expect("cannot restart a server the harness did not start");
+        if let Some(mut child) = self.child.take() {
+            let _ = child.kill();
+            let _ = child.wait();
+        }
+        let port = self
+            .url
+            .rsplit(':')
+            .next()
+            .and_then(|port| port.parse().ok())
+            .expect("server URL has no port");
+        *self = Self::spawn_in(store_dir, None, Some(port));
+    }
+
+    fn spawn(domain: Option<&str>, port: Option<u16>) -> Self {
+        let store_dir = tempfile::tempdir().expect("failed to create JetStream store dir");
+        Self::spawn_in(store_dir, domain, port)
+    }
+
+    fn spawn_in(store_dir: TempDir, domain: Option<&str>, port: Option<u16>) -> Self {
+        let bin = std::env::var("NATS_SERVER_BIN").unwrap_or_else(|_| "nats-server".to_string());
+        let ports_dir = store_dir.path().join("ports");
+        // A killed server leaves its ports file behind
+        let _ = std::fs::remove_dir_all(&ports_dir);
+        std::fs::create_dir_all(&ports_dir).expect("failed to create ports dir");
+
+        let mut command = Command::new(&bin);
+        match domain {
+            // The domain is only settable from a config file
+            Some(domain) => {
+                let config = store_dir.path().join("server.conf");
+                std::fs::write(
+                    &config,
+                    format!(
+                        "jetstream {{\n  store_dir: {:?}\n  domain: {:?}\n}}\n",
+                        store_dir.path().join("jetstream"),
+                        domain
+                    ),
+                )
+                .expect("failed to write nats-server config");
+                command.arg("-c").arg(config);
+            }
+            None => {
+                command
+                    .arg("-js")
+                    .arg("-sd")
+                    .arg(store_dir.path().join("jetstream"));
+            }
+        }
+
+        let child = command
+            .args(["-a", "127.0.0.1"])
+            .arg("-p")
+            .arg(port.map_or("-1".to_string(), |p| p.to_string()))
+            .args(["-m", "-1"])
+            .arg("--ports_file_dir")
+            .arg(&ports_dir)
+            .stdout(Stdio::null())
+            .stderr(Stdio::null())
+            .spawn()
+            .unwrap_or_else(|e| {
+                panic!(
+                    "failed to start '{}' ({}): install nats-server, set NATS_SERVER_BIN, \
+                     or point FLUX_TEST_NATS_URL at a running server",
+                    bin, e
+                )
+            });
+
+        let (url, monitoring_url) = wait_for_ports_file(&ports_dir, Duration::from_secs(10));
+
+        Self {
+            url,
+            monitoring_url,
+            child: Some(child),
+            _store_dir: Some(store_dir),
+        }
+    }
+
+    /// Connect a fresh client to this server.
+    pub async fn client(&self) -> async_nats::Client {
+        async_nats::connect(&self.url)
+            .await
+            .expect("failed to connect to test NATS server")
+    }
+
+    /// Connect and return a JetStream context.
+    pub async fn jetstream(&self) -> jetstream::Context {
+        jetstream::new(self.client().await)
+    }
+}
+
+impl Drop for TestNats {
+    fn drop(&mut self) {
+        if let Some(child) = self.child.as_mut() {
+            let _ = child.kill();
+            let _ = child.wait();
+        }
+    }
+}
+
+/// Wait for nats-server to write its `<name>_<pid>.ports` file and return the
+/// client and monitoring URLs.
+fn wait_for_ports_file(dir: &Path, timeout: Duration) -> (String, Option<String>) {
+    let deadline = Instant::now() + timeout;
+
+    while Instant::now() < deadline {
+        if let Some(path) = find_ports_file(dir) {
+            if let Ok(contents) = std::fs::read_to_string(&path) {
+                if let Ok(json) = serde_json::from_str::<serde_json::Value>(&contents) {
+                    if let Some(url) = json["nats"][0].as_str() {
+                        let monitoring_url = json["monitoring"][0].as_str().map(str::to_string);
+                        return (url.to_string(), monitoring_url);
+                    }
+                }
+            }
+        }
+        std::thread::sleep(Duration::from_millis(25));
+    }
+
+    panic!("nats-server did not report a listening port within {:?}", timeout);
+}
+
+fn find_ports_file(dir: &Path) -> Option<PathBuf> {
+    std::fs::read_dir(dir)
+        .ok()?
+        .filter_map(|entry| entry.ok().map(|e| e.path()))
+        .find(|p| p.extension().map_or(false, |ext| ext == "ports"))
+}
+
+/// A port nothing is listening on (bound and released).
+pub fn free_port() -> u16 {
+    std::net::TcpListener::bind("127.0.0.1:0")
+        .and_then(|listener| listener.local_addr())
+        .map(|addr| addr.port())
+        .expect("failed to find a free port")
+}
@@ -0,0 +1,124 @@
+// Integration tests for config hot reload against the HTTP ingestion API and
+// a real JetStream server (see tests/common).
+
+mod common;
+
+use axum::body::{Body, Bytes};
+use axum::http::{Request, StatusCode};
+use axum::Router;
+use common::TestNats;
+use flux::api::{create_router, AppState};
+use flux::config::{new_runtime_config, ConfigReloader};
+use flux::event::SharedValidationOptions;
+use flux::namespace::NamespaceRegistry;
+use flux::nats::{EventPublisher, NatsClient, NatsConfig};
+use flux::rate_limit::RateLimiter;
+use futures::channel::mpsc;
+use serde_json::json;
+use std::sync::Arc;
+use std::time::Duration;
+use tower::ServiceExt;
+
+/// Ingestion router and a reloader sharing its limits and policies.
+async fn create_test_app(nats: &TestNats, config_path: &str) -> (Router, ConfigReloader) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let runtime_config = new_runtime_config();
+    let validation = SharedValidationOptions::default();
+    let reloader = ConfigReloader::new(config_path, Arc::clone(&runtime_config))
+        .with_validation(Arc::clone(&validation));
+    reloader.reload().unwrap();
+
+    let state = AppState {
+        event_publisher: EventPublisher::new(client.jetstream().clone())
+            .with_shared_validation(validation),
+        namespace_registry: Arc::new(NamespaceRegistry::new()),
+        auth_enabled: false,
+        admin_token: None,
+        runtime_config,
+        rate_limiter: Arc::new(RateLimiter::new()),
+    };
+    (create_router(state), reloader)
+}
+
+/// An event body of at least `size` bytes.
+fn event_body(source: &str, size: usize) -> String {
+    let body = |padding: &str| {
+        json!({
+            "stream": "sensors",
+            "source": source,
+            "timestamp": chrono::Utc::now().timestamp_millis(),
+            "payload": {"entity_id": "sensor-01", "properties": {"padding": padding}}
+        })
+        .to_string()
+    };
+    let padding = size.saturating_sub(body("").len());
+    body(&"x".repeat(padding))
+}
+
+fn post(body: Body) -> Request<Body> {
+    Request::builder()
+        .method("POST")
+        .uri("/api/events")
+        .header("content-type", "application/json")
+        .body(body)
+        .unwrap()
+}
+
+#[tokio::test]
+async fn test_reload_applies_to_next_publish_while_in_flight_completes() {
+    let nats = TestNats::start();
+    let dir = tempfile::tempdir().unwrap();
+    let path = dir.path().join("config.toml");
+    std::fs::write(&path, "[limits]\nbody_size_limit_single_bytes = 100000\n").unwrap();
+    let (app, reloader) = create_test_app(&nats, &path.to_string_lossy()).await;
+
+    // A request whose body is still arriving when the config is reloaded
+    let body = event_body("plant-a", 400);
+    let (head, tail) = body.split_at(body.len() / 2);
+    let (tx, rx) = mpsc::unbounded::<Result<Bytes, std::io::Error>>();
+    tx.unbounded_send(Ok(Bytes::from(head.to_string())))
+        .unwrap();
+    let in_flight = tokio::spawn(app.clone().oneshot(post(Body::from_stream(rx))));
+    tokio::time::sleep(Duration::from_millis(100)).await;
+
+    std::fs::write(
+        &path,
+        "[limits]\nbody_size_limit_single_bytes = 1000\n\n\
+         [api]\nallowed_sources = [\"plant-*\"]\n",
+    )
+    .unwrap();
+    let applied = reloader.reload().unwrap();
+    assert_eq!(applied.body_size_limit_single_bytes, 1000);
+
+    tx.unbounded_send(Ok(Bytes::from(tail.to_string())))
+        .unwrap();
+    drop(tx);
+    let response = in_flight.await.unwrap().unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+
+    // The next publishes see the new limit and source policy
+    let response = app
+        .clone()
+        .oneshot(post(Body::from(event_body("plant-a", 2000))))
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::PAYLOAD_TOO_LARGE);
+
+    let response = app
+        .clone()
+        .oneshot(post(Body::from(event_body("billing", 400))))
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::FORBIDDEN);
+
+    let response = app
+        .oneshot(post(Body::from(event_body("plant-b", 400))))
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+}
@@ -0,0 +1,79 @@
+// Integration tests for connection monitoring against a real server that is
+// stopped and restarted on the same port (see tests/common).
+
+mod common;
+
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+    Router,
+};
+use common::{free_port, TestNats};
+use flux::api::Readiness;
+use flux::nats::{NatsClient, NatsConfig};
+use serde_json::Value;
+use std::time::Duration;
+use tokio::sync::mpsc;
+use tower::ServiceExt;
+
+async fn healthz(router: &Router) -> (StatusCode, Value) {
+    let response = router
+        .clone()
+        .oneshot(Request::get("/healthz").body(Body::empty()).unwrap())
+        .await
+        .unwrap();
+    let status = response.status();
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    (status, serde_json::from_slice(&body).unwrap())
+}
+
+#[tokio::test]
+async fn test_callbacks_and_healthz_follow_connection() {
+    let port = free_port();
+    let nats = TestNats::start_on_port(port);
+    let client = NatsClient::connect(
+        NatsConfig {
+            url: nats.url.clone(),
+            ..Default::default()
+        }
+        .with_max_reconnects(100, Duration::from_millis(100)),
+    )
+    .await
+    .unwrap();
+    let monitor = client.connection_monitor();
+    let (events_tx, mut events) = mpsc::unbounded_channel();
+    let tx = events_tx.clone();
+    monitor.on_disconnect(move || {
+        let _ = tx.send("disconnected".to_string());
+    });
+    monitor.on_reconnect(move |url| {
+        let _ = events_tx.send(format!("reconnected {}", url));
+    });
+    let readiness = Readiness::new();
+    readiness.set_ready(Router::new(), &client);
+    let router = readiness.router();
+
+    assert!(monitor.is_connected());
+    assert_eq!(healthz(&router).await.0, StatusCode::OK);
+
+    let url = nats.url.clone();
+    drop(nats);
+    let event = tokio::time::timeout(Duration::from_secs(10), events.recv())
+        .await
+        .expect("disconnect was not reported");
+    assert_eq!(event.as_deref(), Some("disconnected"));
+    assert!(!monitor.is_connected());
+    let (status, body) = healthz(&router).await;
+    assert_eq!(status, StatusCode::SERVICE_UNAVAILABLE);
+    assert_eq!(body["status"], "unavailable");
+
+    let _nats = TestNats::start_on_port(port);
+    let event = tokio::time::timeout(Duration::from_secs(10), events.recv())
+        .await
+        .expect("reconnect was not reported");
+    assert_eq!(event, Some(format!("reconnected {}", url)));
+    assert!(monitor.is_connected());
+    assert_eq!(healthz(&router).await.0, StatusCode::OK);
+}
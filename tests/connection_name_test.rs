@@ -0,0 +1,84 @@
+// Integration tests for the NATS connection name, read back from the server's
+// monitoring endpoint (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::nats::{default_connection_name, NatsClient, NatsConfig};
+use serde_json::Value;
+use std::collections::BTreeMap;
+
+/// Names of the connections the server reports in /connz.
+async fn connection_names(nats: &TestNats) -> Vec<String> {
+    let monitoring_url = nats
+        .monitoring_url
+        .as_ref()
+        .expect("test server has no monitoring port");
+    let connz: Value = reqwest::get(format!("{}/connz", monitoring_url))
+        .await
+        .unwrap()
+        .json()
+        .await
+        .unwrap();
+    connz["connections"]
+        .as_array()
+        .unwrap()
+        .iter()
+        .filter_map(|connection| connection["name"].as_str().map(str::to_string))
+        .collect()
+}
+
+fn config(nats: &TestNats) -> NatsConfig {
+    NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    }
+}
+
+#[tokio::test]
+async fn test_default_name_identifies_the_process() {
+    let nats = TestNats::start();
+    let _client = NatsClient::connect(config(&nats)).await.unwrap();
+
+    let names = connection_names(&nats).await;
+    assert!(names.contains(&default_connection_name()), "{:?}", names);
+}
+
+#[tokio::test]
+async fn test_configured_name_and_tags() {
+    let nats = TestNats::start();
+    let tags = BTreeMap::from([
+        ("env".to_string(), "prod".to_string()),
+        ("region".to_string(), "us-east".to_string()),
+    ]);
+    let _client = NatsClient::connect(
+        config(&nats)
+            .with_connection_name("flux-service-pod-01")
+            .with_connection_tags(tags),
+    )
+    .await
+    .unwrap();
+
+    let names = connection_names(&nats).await;
+    assert!(
+        names.contains(&"flux-service-pod-01 [env=prod,region=us-east]".to_string()),
+        "{:?}",
+        names
+    );
+}
+
+#[tokio::test]
+async fn test_name_from_env() {
+    let nats = TestNats::start();
+    std::env::set_var("NATS_CLIENT_NAME", "flux-service-from-env");
+    let config = config(&nats).with_env_overrides();
+    std::env::remove_var("NATS_CLIENT_NAME");
+    let _client = NatsClient::connect(config).await.unwrap();
+
+    let names = connection_names(&nats).await;
+    assert!(
+        names.contains(&"flux-service-from-env".to_string()),
+        "{:?}",
+        names
+    );
+}
@@ -0,0 +1,221 @@
+// Integration tests for /api/streams/:stream/consumers against a real JetStream
+// server (see tests/common).
+
+mod common;
+
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+    Router,
+};
+use common::TestNats;
+use flux::api::{create_consumer_router, ConsumerAppState};
+use flux::event::{FluxEvent, Priority};
+use flux::nats::{EventPublisher, NatsClient, NatsConfig};
+use serde_json::{json, Value};
+use tower::ServiceExt;
+
+async fn create_test_app(nats: &TestNats) -> (Router, NatsClient) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+
+    let state = ConsumerAppState {
+        jetstream: client.jetstream().clone(),
+        stream_name: "FLUX_EVENTS".to_string(),
+        admin_token: None,
+    };
+    (create_consumer_router(state), client)
+}
+
+async fn send(app: &Router, method: &str, uri: &str, body: Option<Value>) -> (StatusCode, Value) {
+    let request = Request::builder()
+        .method(method)
+        .uri(uri)
+        .header("content-type", "application/json");
+    let request = match body {
+        Some(b) => request.body(Body::from(b.to_string())).unwrap(),
+        None => request.body(Body::empty()).unwrap(),
+    };
+
+    let response = app.clone().oneshot(request).await.unwrap();
+    let status = response.status();
+    let bytes = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let json = serde_json::from_slice(&bytes).unwrap_or(Value::Null);
+    (status, json)
+}
+
+async fn publish_one(client: &NatsClient, stream: &str) {
+    let mut event = FluxEvent {
+        event_id: None,
+        stream: stream.to_string(),
+        source: "consumer-test".to_string(),
+        timestamp: chrono::Utc::now().timestamp_millis(),
+        key: None,
+        schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
+        payload: json!({"entity_id": "sensor-01", "properties": {"value": 1}}),
+        raw_payload: None,
+    };
+    event.validate_and_prepare().unwrap();
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+}
+
+#[tokio::test]
+async fn test_consumer_lifecycle() {
+    let nats = TestNats::start();
+    let (app, _client) = create_test_app(&nats).await;
+
+    let (status, created) = send(
+        &app,
+        "POST",
+        "/api/streams/sensors/consumers",
+        Some(json!({"name": "dashboard", "max_deliver": 3, "deliver_policy": "new"})),
+    )
+    .await;
+    assert_eq!(status, StatusCode::CREATED);
+    assert_eq!(created["name"], "dashboard");
+    assert_eq!(created["filter_subject"], "flux.events.sensors");
+    assert_eq!(
+        created["filter_subjects"],
+        json!(["flux.events.sensors", "flux.events.sensors.>"])
+    );
+    assert_eq!(created["ack_policy"], "explicit");
+    assert_eq!(created["max_deliver"], 3);
+
+    let (status, info) = send(&app, "GET", "/api/streams/sensors/consumers/dashboard", None).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(info["num_pending"], 0);
+
+    let (status, list) = send(&app, "GET", "/api/streams/sensors/consumers", None).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(list["consumers"].as_array().unwrap().len(), 1);
+
+    // Consumers are scoped to their Flux stream
+    let (_, other) = send(&app, "GET", "/api/streams/metrics/consumers", None).await;
+    assert!(other["consumers"].as_array().unwrap().is_empty());
+    let (status, _) = send(&app, "GET", "/api/streams/metrics/consumers/dashboard", None).await;
+    assert_eq!(status, StatusCode::NOT_FOUND);
+
+    let (status, _) = send(&app, "DELETE", "/api/streams/sensors/consumers/dashboard", None).await;
+    assert_eq!(status, StatusCode::NO_CONTENT);
+
+    let (status, _) = send(&app, "GET", "/api/streams/sensors/consumers/dashboard", None).await;
+    assert_eq!(status, StatusCode::NOT_FOUND);
+}
+
+#[tokio::test]
+async fn test_delete_with_pending_requires_force() {
+    let nats = TestNats::start();
+    let (app, client) = create_test_app(&nats).await;
+
+    let (status, _) = send(
+        &app,
+        "POST",
+        "/api/streams/sensors/consumers",
+        Some(json!({"name": "backlog"})),
+    )
+    .await;
+    assert_eq!(status, StatusCode::CREATED);
+
+    publish_one(&client, "sensors").await;
+
+    let (status, body) = send(&app, "DELETE", "/api/streams/sensors/consumers/backlog", None).await;
+    assert_eq!(status, StatusCode::CONFLICT);
+    assert!(body["error"].as_str().unwrap().contains("force=true"));
+
+    let (status, _) = send(
+        &app,
+        "DELETE",
+        "/api/streams/sensors/consumers/backlog?force=true",
+        None,
+    )
+    .await;
+    assert_eq!(status, StatusCode::NO_CONTENT);
+}
+
+#[tokio::test]
+async fn test_create_rejects_invalid_policy() {
+    let nats = TestNats::start();
+    let (app, _client) = create_test_app(&nats).await;
+
+    let (status, _) = send(
+        &app,
+        "POST",
+        "/api/streams/sensors/consumers",
+        Some(json!({"name": "bad", "ack_policy": "sometimes"})),
+    )
+    .await;
+    assert_eq!(status, StatusCode::BAD_REQUEST);
+}
+
+#[tokio::test]
+async fn test_inactive_consumer_is_removed_by_server() {
+    let nats = TestNats::start();
+    let (app, _client) = create_test_app(&nats).await;
+
+    let (status, created) = send(
+        &app,
+        "POST",
+        "/api/streams/sensors/consumers",
+        Some(json!({"name": "abandoned", "inactive_threshold_seconds": 2})),
+    )
+    .await;
+    assert_eq!(status, StatusCode::CREATED);
+    assert_eq!(created["inactive_threshold_seconds"], 2);
+
+    // Nobody pulls; the server reaps it shortly after the threshold
+    let mut status = StatusCode::OK;
+    for _ in 0..20 {
+        tokio::time::sleep(std::time::Duration::from_millis(500)).await;
+        (status, _) = send(&app, "GET", "/api/streams/sensors/consumers/abandoned", None).await;
+        if status == StatusCode::NOT_FOUND {
+            break;
+        }
+    }
+    assert_eq!(status, StatusCode::NOT_FOUND);
+}
+
+#[tokio::test]
+async fn test_unfiltered_consumer_receives_critical_events() {
+    let nats = TestNats::start();
+    let (app, client) = create_test_app(&nats).await;
+
+    let (status, _) = send(
+        &app,
+        "POST",
+        "/api/streams/alarms/consumers",
+        Some(json!({"name": "sink"})),
+    )
+    .await;
+    assert_eq!(status, StatusCode::CREATED);
+
+    // Published on flux.events.alarms.p.high
+    let mut event = FluxEvent::builder("alarms")
+        .source("consumer-test")
+        .payload(json!({"entity_id": "plc-01", "properties": {"state": "fault"}}))
+        .must_build();
+    event.priority = Some(Priority::Critical);
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+    publish_one(&client, "alarms").await;
+
+    let (status, info) = send(&app, "GET", "/api/streams/alarms/consumers/sink", None).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(info["num_pending"], 2);
+}
@@ -0,0 +1,123 @@
+// Integration tests for nak-with-delay redelivery backoff against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use anyhow::anyhow;
+use async_nats::jetstream::consumer;
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{EventPublisher, ExactlyOnce, NatsClient, NatsConfig, RetryAfter};
+use futures::StreamExt;
+use serde_json::json;
+use std::time::{Duration, Instant};
+
+const TOLERANCE: Duration = Duration::from_millis(150);
+
+fn schedule() -> Vec<Duration> {
+    vec![
+        Duration::from_millis(200),
+        Duration::from_millis(400),
+        Duration::from_millis(800),
+    ]
+}
+
+async fn setup(nats: &TestNats) -> (NatsClient, consumer::PullConsumer, ExactlyOnce) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let consumer = client
+        .jetstream()
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .create_consumer(consumer::pull::Config {
+            durable_name: Some("billing-sink".to_string()),
+            ack_policy: consumer::AckPolicy::Explicit,
+            max_deliver: 10,
+            backoff: schedule(),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    let exactly_once = ExactlyOnce::open(
+        client.jetstream(),
+        "BILLING_SINK_PROCESSED",
+        "FLUX_EVENTS",
+        None,
+    )
+    .await
+    .unwrap()
+    .with_backoff(schedule());
+
+    let event = FluxEvent::builder("invoices")
+        .source("billing")
+        .payload(json!({"entity_id": "invoice-1", "properties": {"total": 42}}))
+        .must_build();
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+    (client, consumer, exactly_once)
+}
+
+fn assert_close(actual: Duration, expected: Duration) {
+    assert!(
+        actual + TOLERANCE >= expected && actual <= expected + TOLERANCE,
+        "redelivered after {:?}, expected {:?}",
+        actual,
+        expected
+    );
+}
+
+#[tokio::test]
+async fn test_failed_handler_redeliveries_follow_schedule() {
+    let nats = TestNats::start();
+    let (_client, consumer, exactly_once) = setup(&nats).await;
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut last = Instant::now();
+    let mut intervals = Vec::new();
+    for attempt in 1..=5 {
+        let message = messages.next().await.unwrap().unwrap();
+        assert_eq!(message.info().unwrap().delivered, attempt);
+        if attempt > 1 {
+            intervals.push(last.elapsed());
+        }
+        let result = exactly_once
+            .handle(message, |_| async { Err(anyhow!("billing API down")) })
+            .await;
+        assert!(result.is_err());
+        last = Instant::now();
+    }
+
+    // Delays of the 1st..4th failure; the schedule's last entry repeats
+    let expected = [200, 400, 800, 800].map(Duration::from_millis);
+    for (actual, expected) in intervals.into_iter().zip(expected) {
+        assert_close(actual, expected);
+    }
+}
+
+#[tokio::test]
+async fn test_retry_after_overrides_schedule() {
+    let nats = TestNats::start();
+    let (_client, consumer, exactly_once) = setup(&nats).await;
+    let mut messages = consumer.messages().await.unwrap();
+
+    let message = messages.next().await.unwrap().unwrap();
+    let result = exactly_once
+        .handle(message, |_| async {
+            Err(RetryAfter::new(Duration::from_millis(1200), "billing API rate limited").into())
+        })
+        .await;
+    let err = result.unwrap_err();
+    assert!(err.downcast_ref::<RetryAfter>().is_some());
+    let failed_at = Instant::now();
+
+    let message = messages.next().await.unwrap().unwrap();
+    assert_eq!(message.info().unwrap().delivered, 2);
+    assert_close(failed_at.elapsed(), Duration::from_millis(1200));
+}
@@ -0,0 +1,204 @@
+// Integration tests for long-poll fetch and ack over HTTP against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::consumer;
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+    Router,
+};
+use common::TestNats;
+use flux::api::{create_fetch_router, FetchAppState};
+use flux::event::{FluxEvent, Priority};
+use flux::nats::{stream_filter_subjects, EventPublisher, NatsClient, NatsConfig};
+use serde_json::{json, Value};
+use std::time::{Duration, Instant};
+use tower::ServiceExt;
+
+const FETCH: &str = "/api/streams/sensors/consumers/plc-reader/fetch";
+const ACK: &str = "/api/streams/sensors/consumers/plc-reader/ack";
+
+/// Fetch router plus a `plc-reader` consumer on `sensors` with a 1s ack wait.
+async fn create_test_app(nats: &TestNats) -> (Router, NatsClient) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    client
+        .jetstream()
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .create_consumer(consumer::pull::Config {
+            durable_name: Some("plc-reader".to_string()),
+            filter_subjects: stream_filter_subjects("sensors"),
+            ack_wait: Duration::from_secs(1),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+
+    let state = FetchAppState {
+        jetstream: client.jetstream().clone(),
+        client: client.client().clone(),
+        stream_name: "FLUX_EVENTS".to_string(),
+        admin_token: None,
+        token_secret: "test-secret".to_string(),
+    };
+    (create_fetch_router(state), client)
+}
+
+async fn send(app: &Router, method: &str, uri: &str, body: Option<Value>) -> (StatusCode, Value) {
+    let request = Request::builder()
+        .method(method)
+        .uri(uri)
+        .header("content-type", "application/json");
+    let request = match body {
+        Some(b) => request.body(Body::from(b.to_string())).unwrap(),
+        None => request.body(Body::empty()).unwrap(),
+    };
+
+    let response = app.clone().oneshot(request).await.unwrap();
+    let status = response.status();
+    let bytes = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let json = serde_json::from_slice(&bytes).unwrap_or(Value::Null);
+    (status, json)
+}
+
+async fn publish(client: &NatsClient, n: u64) {
+    let event = FluxEvent::builder("sensors")
+        .source("fetch-test")
+        .payload(json!({"entity_id": format!("sensor-{}", n), "properties": {"n": n}}))
+        .must_build();
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+}
+
+fn tokens(events: &[Value]) -> Vec<String> {
+    events
+        .iter()
+        .map(|e| e["ack_token"].as_str().unwrap().to_string())
+        .collect()
+}
+
+#[tokio::test]
+async fn test_unacked_half_redelivers() {
+    let nats = TestNats::start();
+    let (app, client) = create_test_app(&nats).await;
+    for n in 1..=4 {
+        publish(&client, n).await;
+    }
+
+    let (status, body) = send(&app, "GET", &format!("{}?batch=10&wait=2s", FETCH), None).await;
+    assert_eq!(status, StatusCode::OK, "{}", body);
+    let events = body["events"].as_array().unwrap().clone();
+    assert_eq!(events.len(), 4);
+    assert!(events.iter().all(|e| e["delivered"] == 1));
+    assert_eq!(events[0]["event"]["payload"]["properties"]["n"], 1);
+
+    let (status, body) = send(
+        &app,
+        "POST",
+        ACK,
+        Some(json!({"ack_tokens": tokens(&events[..2])})),
+    )
+    .await;
+    assert_eq!(status, StatusCode::OK, "{}", body);
+    assert_eq!(body["acked"], 2);
+
+    // The unacked two come back once the ack wait runs out
+    let started = Instant::now();
+    let (status, body) = send(&app, "GET", &format!("{}?batch=10&wait=5s", FETCH), None).await;
+    assert_eq!(status, StatusCode::OK, "{}", body);
+    assert!(started.elapsed() < Duration::from_secs(4));
+    let redelivered = body["events"].as_array().unwrap().clone();
+    let sequences: Vec<&Value> = redelivered.iter().map(|e| &e["sequence"]).collect();
+    assert_eq!(sequences, [&events[2]["sequence"], &events[3]["sequence"]]);
+    assert!(redelivered.iter().all(|e| e["delivered"] == 2));
+
+    let (status, _) = send(
+        &app,
+        "POST",
+        ACK,
+        Some(json!({"ack_tokens": tokens(&redelivered)})),
+    )
+    .await;
+    assert_eq!(status, StatusCode::OK);
+    let (status, body) = send(&app, "GET", &format!("{}?wait=1500ms", FETCH), None).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(body["events"], json!([]));
+}
+
+#[tokio::test]
+async fn test_invalid_tokens_ack_nothing() {
+    let nats = TestNats::start();
+    let (app, client) = create_test_app(&nats).await;
+    publish(&client, 1).await;
+    publish(&client, 2).await;
+
+    let (_, body) = send(&app, "GET", &format!("{}?batch=2&wait=2s", FETCH), None).await;
+    let events = body["events"].as_array().unwrap().clone();
+    assert_eq!(events.len(), 2);
+    let good = tokens(&events);
+
+    // A forged signature fails the request, valid tokens included
+    let (subject, _) = good[1].split_once('.').unwrap();
+    let forged = format!("{}.{}", subject, "0".repeat(64));
+    let (status, body) = send(
+        &app,
+        "POST",
+        ACK,
+        Some(json!({"ack_tokens": [good[0], forged]})),
+    )
+    .await;
+    assert_eq!(status, StatusCode::BAD_REQUEST);
+    assert!(body["error"].as_str().unwrap().contains("ack_tokens[1]"));
+
+    // So does a token for another consumer
+    let other = "/api/streams/sensors/consumers/other-reader/ack";
+    let (status, _) = send(&app, "POST", other, Some(json!({"ack_tokens": [good[0]]}))).await;
+    assert_eq!(status, StatusCode::BAD_REQUEST);
+
+    let (_, body) = send(&app, "GET", &format!("{}?batch=2&wait=5s", FETCH), None).await;
+    assert_eq!(body["events"].as_array().unwrap().len(), 2);
+
+    let (status, _) = send(&app, "GET", &format!("{}?batch=1000", FETCH), None).await;
+    assert_eq!(status, StatusCode::BAD_REQUEST);
+    let (status, _) = send(
+        &app,
+        "GET",
+        "/api/streams/sensors/consumers/missing/fetch",
+        None,
+    )
+    .await;
+    assert_eq!(status, StatusCode::NOT_FOUND);
+}
+
+#[tokio::test]
+async fn test_fetch_includes_critical_events() {
+    let nats = TestNats::start();
+    let (app, client) = create_test_app(&nats).await;
+    let mut event = FluxEvent::builder("sensors")
+        .source("fetch-test")
+        .payload(json!({"entity_id": "sensor-9", "properties": {"alarm": true}}))
+        .must_build();
+    event.priority = Some(Priority::Critical);
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+
+    let (status, body) = send(&app, "GET", &format!("{}?batch=10&wait=2s", FETCH), None).await;
+    assert_eq!(status, StatusCode::OK, "{}", body);
+    let events = body["events"].as_array().unwrap();
+    assert_eq!(events.len(), 1);
+    assert_eq!(events[0]["event"]["priority"], "critical");
+}
@@ -0,0 +1,123 @@
+// Integration tests for ConsumerGroup load balancing against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::{FluxEvent, Priority};
+use flux::nats::{event_from_message, ConsumerGroup, EventPublisher, NatsClient, NatsConfig};
+use futures::StreamExt;
+use serde_json::json;
+use std::collections::HashMap;
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+
+const EVENTS: usize = 100;
+
+#[tokio::test]
+async fn test_two_members_handle_each_event_once() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let group = ConsumerGroup::new("billing", "invoices")
+        .with_members(2)
+        .with_max_ack_pending_per_member(10);
+
+    // entity_id -> members that handled it
+    let handled: Arc<Mutex<HashMap<String, Vec<usize>>>> = Arc::default();
+    let mut members = Vec::new();
+    for member in 0..2 {
+        let consumer = group.join(client.jetstream(), "FLUX_EVENTS").await.unwrap();
+        let handled = handled.clone();
+        members.push(tokio::spawn(async move {
+            let mut messages = consumer.messages().await.unwrap();
+            while let Ok(Some(Ok(message))) =
+                tokio::time::timeout(Duration::from_secs(2), messages.next()).await
+            {
+                let event = event_from_message(&message).unwrap();
+                let id = event.payload["entity_id"].as_str().unwrap().to_string();
+                handled.lock().unwrap().entry(id).or_default().push(member);
+                message.ack().await.unwrap();
+            }
+        }));
+    }
+
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    for i in 0..EVENTS {
+        let event = FluxEvent::builder("invoices")
+            .source("billing")
+            .payload(json!({"entity_id": format!("invoice-{}", i), "properties": {}}))
+            .must_build();
+        publisher.publish(&event).await.unwrap();
+    }
+    for member in members {
+        member.await.unwrap();
+    }
+
+    let handled = handled.lock().unwrap();
+    assert_eq!(handled.len(), EVENTS);
+    assert!(handled.values().all(|members| members.len() == 1));
+}
+
+#[tokio::test]
+async fn test_members_share_one_durable() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let group = ConsumerGroup::new("billing", "invoices");
+
+    group.join(client.jetstream(), "FLUX_EVENTS").await.unwrap();
+    group.join(client.jetstream(), "FLUX_EVENTS").await.unwrap();
+
+    let stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let names: Vec<String> = stream
+        .consumer_names()
+        .map(|name| name.unwrap())
+        .collect()
+        .await;
+    assert_eq!(names, vec!["billing-invoices".to_string()]);
+}
+
+#[tokio::test]
+async fn test_member_receives_critical_events() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let group = ConsumerGroup::new("ops", "alarms");
+    let consumer = group.join(client.jetstream(), "FLUX_EVENTS").await.unwrap();
+
+    // Critical events are published on flux.events.alarms.p.high
+    let mut event = FluxEvent::builder("alarms")
+        .source("plc")
+        .payload(json!({"entity_id": "plc-01", "properties": {"state": "fault"}}))
+        .must_build();
+    event.priority = Some(Priority::Critical);
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+
+    let mut messages = consumer.messages().await.unwrap();
+    let message = tokio::time::timeout(Duration::from_secs(2), messages.next())
+        .await
+        .expect("group member did not receive the critical event")
+        .unwrap()
+        .unwrap();
+    assert_eq!(
+        event_from_message(&message).unwrap().event_id,
+        event.event_id
+    );
+    message.ack().await.unwrap();
+}
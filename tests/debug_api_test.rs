@@ -0,0 +1,98 @@
+// Integration tests for the /debug endpoints against a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+    Router,
+};
+use common::TestNats;
+use flux::api::{create_debug_router, DebugAppState};
+use flux::nats::StreamUsageMonitor;
+use flux::rate_limit::RateLimiter;
+use flux::state::StateEngine;
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+use tower::ServiceExt;
+
+async fn router(nats: &TestNats, enabled: bool, admin_token: Option<&str>) -> Router {
+    let rate_limiter = Arc::new(RateLimiter::new());
+    rate_limiter.check_and_consume("matt", 100);
+    let state = DebugAppState {
+        state_engine: Arc::new(StateEngine::new()),
+        rate_limiter,
+        stream_usage: Arc::new(StreamUsageMonitor::new(
+            nats.jetstream().await,
+            Duration::from_secs(60),
+            80.0,
+        )),
+        admin_token: admin_token.map(str::to_string),
+        started_at: Instant::now(),
+    };
+    create_debug_router(state, enabled)
+}
+
+async fn get(router: &Router, uri: &str, token: Option<&str>) -> (StatusCode, serde_json::Value) {
+    let mut request = Request::get(uri);
+    if let Some(token) = token {
+        request = request.header("Authorization", format!("Bearer {}", token));
+    }
+    let response = router
+        .clone()
+        .oneshot(request.body(Body::empty()).unwrap())
+        .await
+        .unwrap();
+    let status = response.status();
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    (
+        status,
+        serde_json::from_slice(&body).unwrap_or(serde_json::Value::Null),
+    )
+}
+
+#[tokio::test]
+async fn test_debug_endpoints_404_when_disabled() {
+    let nats = TestNats::start();
+    let router = router(&nats, false, None).await;
+
+    for uri in ["/debug/flux", "/debug/runtime"] {
+        assert_eq!(get(&router, uri, None).await.0, StatusCode::NOT_FOUND);
+    }
+}
+
+#[tokio::test]
+async fn test_debug_endpoints_return_json_when_enabled() {
+    let nats = TestNats::start();
+    let router = router(&nats, true, None).await;
+
+    let (status, body) = get(&router, "/debug/flux", None).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(body["state_engine"]["entities"], 0);
+    assert_eq!(body["rate_limiter"]["total"], 1);
+    assert_eq!(body["rate_limiter"]["items"][0]["namespace"], "matt");
+    assert!(body["stream_cache"]["items"].is_array());
+
+    let (status, body) = get(&router, "/debug/runtime", None).await;
+    assert_eq!(status, StatusCode::OK);
+    assert!(body["tokio_workers"].as_u64().unwrap() >= 1);
+    assert!(body["uptime_seconds"].is_u64());
+}
+
+#[tokio::test]
+async fn test_debug_endpoints_require_admin_token() {
+    let nats = TestNats::start();
+    let router = router(&nats, true, Some("secret")).await;
+
+    assert_eq!(
+        get(&router, "/debug/flux", None).await.0,
+        StatusCode::UNAUTHORIZED
+    );
+    assert_eq!(
+        get(&router, "/debug/flux", Some("secret")).await.0,
+        StatusCode::OK
+    );
+}
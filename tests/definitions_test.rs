@@ -0,0 +1,243 @@
+// Integration tests for stream definition snapshots against real JetStream
+// servers (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::{self, consumer, stream};
+use axum::body::Body;
+use axum::http::{Request, StatusCode};
+use common::TestNats;
+use flux::api::{create_reconcile_router, ReconcileAppState};
+use flux::nats::{
+    DefinitionStatus, ImportMode, NatsClient, NatsConfig, Reconciler, StreamDefinitions,
+    UnsupportedDefinitionsError,
+};
+use std::sync::Arc;
+use std::time::Duration;
+use tower::ServiceExt;
+
+/// FLUX_EVENTS (created on connect), ORDERS with metadata, retention and a
+/// durable consumer, and ORDERS_BACKUP mirroring it.
+async fn populate(nats: &TestNats) -> NatsClient {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let js = client.jetstream();
+
+    let mut orders = stream::Config {
+        name: "ORDERS".to_string(),
+        subjects: vec!["orders.>".to_string()],
+        max_age: Duration::from_secs(86400),
+        max_messages_per_subject: 10,
+        ..Default::default()
+    };
+    orders
+        .metadata
+        .insert("team".to_string(), "payments".to_string());
+    let orders = js.create_stream(orders).await.unwrap();
+    orders
+        .create_consumer(consumer::pull::Config {
+            durable_name: Some("orders-worker".to_string()),
+            filter_subject: "orders.created".to_string(),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    js.create_stream(stream::Config {
+        name: "ORDERS_BACKUP".to_string(),
+        mirror: Some(stream::Source {
+            name: "ORDERS".to_string(),
+            ..Default::default()
+        }),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    client
+}
+
+fn statuses(report: &flux::nats::ImportReport) -> Vec<(String, DefinitionStatus)> {
+    let mut statuses: Vec<_> = report
+        .results
+        .iter()
+        .map(|result| (result.stream.clone(), result.status))
+        .collect();
+    statuses.sort_by(|a, b| a.0.cmp(&b.0));
+    statuses
+}
+
+/// Stream and consumer configs as JSON, for comparing clusters.
+fn comparable(definitions: &StreamDefinitions) -> serde_json::Value {
+    serde_json::to_value(&definitions.streams).unwrap()
+}
+
+#[tokio::test]
+async fn test_export_import_into_fresh_server() {
+    let source = TestNats::start();
+    let client = populate(&source).await;
+    let exported = Reconciler::new(client.jetstream().clone(), Vec::new())
+        .export_definitions(true)
+        .await
+        .unwrap();
+    let names: Vec<_> = exported
+        .streams
+        .iter()
+        .map(|definition| definition.config.name.as_str())
+        .collect();
+    assert_eq!(names, ["FLUX_EVENTS", "ORDERS", "ORDERS_BACKUP"]);
+    // Through the document format, as an operator would move it
+    let document = serde_json::to_string(&exported).unwrap();
+    let definitions: StreamDefinitions = serde_json::from_str(&document).unwrap();
+
+    let target = TestNats::start();
+    let target_js: jetstream::Context = target.jetstream().await;
+    let reconciler = Reconciler::new(target_js.clone(), Vec::new());
+
+    let report = reconciler
+        .import_definitions(&definitions, ImportMode::DryRun)
+        .await
+        .unwrap();
+    assert!(statuses(&report)
+        .iter()
+        .all(|(_, status)| *status == DefinitionStatus::WouldCreate));
+    assert!(target_js.get_stream("ORDERS").await.is_err());
+
+    let report = reconciler
+        .import_definitions(&definitions, ImportMode::Reconcile)
+        .await
+        .unwrap();
+    assert!(report.succeeded());
+    assert!(statuses(&report)
+        .iter()
+        .all(|(_, status)| *status == DefinitionStatus::Created));
+    let orders = report
+        .results
+        .iter()
+        .find(|result| result.stream == "ORDERS")
+        .unwrap();
+    assert_eq!(orders.consumers_created, ["orders-worker"]);
+
+    let imported = reconciler.export_definitions(true).await.unwrap();
+    assert_eq!(comparable(&imported), comparable(&exported));
+
+    let report = reconciler
+        .import_definitions(&definitions, ImportMode::CreateOnly)
+        .await
+        .unwrap();
+    assert!(statuses(&report)
+        .iter()
+        .all(|(_, status)| *status == DefinitionStatus::Unchanged));
+}
+
+#[tokio::test]
+async fn test_drift_applied_only_when_reconciling() {
+    let nats = TestNats::start();
+    let client = populate(&nats).await;
+    let reconciler = Reconciler::new(client.jetstream().clone(), Vec::new());
+    let mut definitions = reconciler.export_definitions(false).await.unwrap();
+    definitions
+        .streams
+        .retain(|definition| definition.config.name == "ORDERS");
+    definitions.streams[0].config.max_age = Duration::from_secs(3600);
+
+    for mode in [ImportMode::CreateOnly, ImportMode::DryRun] {
+        let report = reconciler
+            .import_definitions(&definitions, mode)
+            .await
+            .unwrap();
+        let expected = match mode {
+            ImportMode::DryRun => DefinitionStatus::WouldUpdate,
+            _ => DefinitionStatus::Drifted,
+        };
+        assert_eq!(report.results[0].status, expected);
+        assert_eq!(report.results[0].changes[0].field, "max_age");
+    }
+
+    let report = reconciler
+        .import_definitions(&definitions, ImportMode::Reconcile)
+        .await
+        .unwrap();
+    assert_eq!(report.results[0].status, DefinitionStatus::Updated);
+    let mut orders = client.jetstream().get_stream("ORDERS").await.unwrap();
+    assert_eq!(
+        orders.info().await.unwrap().config.max_age,
+        Duration::from_secs(3600)
+    );
+
+    definitions.version = 99;
+    let err = reconciler
+        .import_definitions(&definitions, ImportMode::DryRun)
+        .await
+        .unwrap_err();
+    assert_eq!(
+        err.downcast_ref::<UnsupportedDefinitionsError>()
+            .unwrap()
+            .version,
+        99
+    );
+}
+
+#[tokio::test]
+async fn test_definitions_api() {
+    let source = TestNats::start();
+    let client = populate(&source).await;
+    let target = TestNats::start();
+    let router = |js: jetstream::Context, apply_enabled: bool| {
+        create_reconcile_router(ReconcileAppState {
+            reconciler: Arc::new(Reconciler::new(js, Vec::new())),
+            apply_enabled,
+            admin_token: None,
+        })
+    };
+
+    let response = router(client.jetstream().clone(), false)
+        .oneshot(
+            Request::builder()
+                .uri("/api/admin/definitions?consumers=true")
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    let document = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+
+    let import = |mode: &str| {
+        Request::builder()
+            .method("POST")
+            .uri(format!("/api/admin/definitions?mode={}", mode))
+            .header("content-type", "application/json")
+            .body(Body::from(document.clone()))
+            .unwrap()
+    };
+    let target_js = target.jetstream().await;
+    let response = router(target_js.clone(), false)
+        .oneshot(import("dry_run"))
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    let response = router(target_js.clone(), false)
+        .oneshot(import("create_only"))
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::FORBIDDEN);
+    assert!(target_js.get_stream("ORDERS").await.is_err());
+
+    let response = router(target_js.clone(), true)
+        .oneshot(import("create_only"))
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let report: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(report["mode"], "create_only");
+    assert_eq!(report["results"].as_array().unwrap().len(), 3);
+    assert!(target_js.get_stream("ORDERS").await.is_ok());
+}
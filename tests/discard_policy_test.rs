@@ -0,0 +1,132 @@
+// Integration tests for the stream discard policy against a real JetStream
+// server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::{sanitize_key, FluxEvent};
+use flux::nats::{wildcard_subjects, DiscardPolicy, EventPublisher, NatsClient, NatsConfig};
+use serde_json::json;
+
+fn test_event(stream: &str, n: u32) -> FluxEvent {
+    FluxEvent::builder(stream)
+        .source("discard-test")
+        .payload(json!({"entity_id": format!("buffer-{}", n), "properties": {"n": n}}))
+        .must_build()
+}
+
+async fn stream_state(client: &NatsClient) -> (u64, u64) {
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let state = stream.info().await.unwrap().state.clone();
+    (state.messages, state.first_sequence)
+}
+
+#[tokio::test]
+async fn test_discard_old_drops_oldest_at_max_msgs() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        max_msgs: Some(3),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    for n in 0..5 {
+        publisher.publish(&test_event("buffer", n)).await.unwrap();
+    }
+
+    assert_eq!(stream_state(&client).await, (3, 3));
+}
+
+#[tokio::test]
+async fn test_discard_new_rejects_at_max_msgs() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        max_msgs: Some(3),
+        ..NatsConfig::discard_new("FLUX_EVENTS")
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let config = stream.info().await.unwrap().config.clone();
+    assert_eq!(
+        config.discard,
+        async_nats::jetstream::stream::DiscardPolicy::New
+    );
+
+    for n in 0..3 {
+        publisher.publish(&test_event("buffer", n)).await.unwrap();
+    }
+    assert!(publisher.publish(&test_event("buffer", 3)).await.is_err());
+
+    // The first events are kept, not evicted
+    assert_eq!(stream_state(&client).await, (3, 1));
+}
+
+#[tokio::test]
+async fn test_discard_new_per_subject() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        max_msgs_per_subject: Some(2),
+        discard: DiscardPolicy::New,
+        discard_new_per_subject: true,
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    for n in 0..2 {
+        publisher.publish(&test_event("buffer.a", n)).await.unwrap();
+    }
+    assert!(publisher.publish(&test_event("buffer.a", 2)).await.is_err());
+
+    // Other subjects still have room
+    publisher.publish(&test_event("buffer.b", 0)).await.unwrap();
+    assert_eq!(stream_state(&client).await, (3, 1));
+}
+
+#[tokio::test]
+async fn test_last_n_per_key() {
+    let nats = TestNats::start();
+    let subjects = wildcard_subjects("sensor.readings");
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        stream_subjects: subjects.clone(),
+        ..NatsConfig::last_n_per_key("FLUX_EVENTS", 3)
+    })
+    .await
+    .unwrap();
+    // One subject per sensor
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_stream_subjects(subjects)
+        .with_subject_mapping(|event| {
+            let key = sanitize_key(event.key.as_deref().unwrap_or_default());
+            format!("flux.events.{}.{}", event.stream, key)
+        });
+
+    for n in 0..5 {
+        for sensor in ["sensor-01", "sensor-02"] {
+            let mut event = test_event("sensor.readings", n);
+            event.key = Some(sensor.to_string());
+            publisher.publish(&event).await.unwrap();
+        }
+    }
+
+    // The last 3 readings of each sensor remain (sequences 5..=10)
+    assert_eq!(stream_state(&client).await, (6, 5));
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let info = stream.info().await.unwrap();
+    assert_eq!(info.config.max_messages_per_subject, 3);
+    let last = stream
+        .get_last_raw_message_by_subject("flux.events.sensor.readings.sensor-01")
+        .await
+        .unwrap();
+    assert_eq!(last.sequence, 9);
+}
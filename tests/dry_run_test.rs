@@ -0,0 +1,70 @@
+// Tests for EventPublisher dry-run mode: events are checked and encoded but
+// never published. The first test needs no NATS server at all.
+
+mod common;
+
+use common::TestNats;
+use flux::event::{FluxEvent, ValidationError};
+use flux::nats::{EventPublisher, NatsClient, NatsConfig, SubjectNotCapturedError};
+use serde_json::json;
+
+fn event(stream: &str) -> FluxEvent {
+    FluxEvent::builder(stream)
+        .source("ci")
+        .payload(json!({"entity_id": "sensor-01", "properties": {"value": 1}}))
+        .must_build()
+}
+
+#[tokio::test]
+async fn test_dry_run_without_nats_server() {
+    // Nothing listens here; the client keeps retrying in the background
+    let client = async_nats::ConnectOptions::new()
+        .retry_on_initial_connect()
+        .connect("nats://127.0.0.1:1")
+        .await
+        .unwrap();
+    let publisher = EventPublisher::new(async_nats::jetstream::new(client))
+        .with_stream_subjects(vec!["flux.events.>".to_string()])
+        .with_max_msg_size(256)
+        .with_dry_run(true);
+    assert!(publisher.is_dry_run());
+
+    publisher.publish(&event("sensors")).await.unwrap();
+
+    let mut oversized = event("sensors");
+    oversized.payload["properties"]["blob"] = json!("x".repeat(512));
+    let err = publisher.publish(&oversized).await.unwrap_err();
+    assert!(matches!(
+        err.downcast_ref::<ValidationError>(),
+        Some(ValidationError::PayloadTooLarge(_))
+    ));
+
+    let publisher = publisher.with_stream_subjects(vec!["flux.events.sensors".to_string()]);
+    let err = publisher.publish(&event("alarms")).await.unwrap_err();
+    assert!(err.downcast_ref::<SubjectNotCapturedError>().is_some());
+}
+
+#[tokio::test]
+async fn test_dry_run_leaves_stream_untouched() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone()).with_dry_run(true);
+
+    for _ in 0..3 {
+        publisher.publish(&event("sensors")).await.unwrap();
+    }
+    assert_eq!(client.stream_message_count("FLUX_EVENTS").await.unwrap(), 0);
+
+    publisher
+        .clone()
+        .with_dry_run(false)
+        .publish(&event("sensors"))
+        .await
+        .unwrap();
+    assert_eq!(client.stream_message_count("FLUX_EVENTS").await.unwrap(), 1);
+}
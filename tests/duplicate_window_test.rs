@@ -0,0 +1,128 @@
+// Integration tests for per-stream duplicate windows against a real JetStream
+// server (see tests/common). Windows are a few seconds long, so the tests
+// republish just inside and just after them.
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{DuplicateWindowError, EventPublisher, NatsClient, NatsConfig};
+use serde_json::json;
+use std::time::{Duration, Instant};
+
+const TIMEOUT: Duration = Duration::from_secs(5);
+
+/// Stream `name` capturing the Flux stream `stream`, with a duplicate window.
+async fn connect(nats: &TestNats, name: &str, stream: &str, window: u64) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        stream_name: name.to_string(),
+        stream_subjects: vec![format!("flux.events.{}", stream)],
+        duplicate_window_seconds: window,
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+fn reading(stream: &str) -> FluxEvent {
+    FluxEvent::builder(stream)
+        .source("dedup-test")
+        .payload(json!({"entity_id": "sensor-01", "properties": {"v": 1}}))
+        .must_build()
+}
+
+async fn publish(publisher: &EventPublisher, event: &FluxEvent) -> u64 {
+    publisher
+        .publish_with_ack(event, TIMEOUT)
+        .await
+        .unwrap()
+        .unwrap()
+        .sequence
+}
+
+async fn stored(client: &NatsClient, name: &str) -> u64 {
+    let mut stream = client.jetstream().get_stream(name).await.unwrap();
+    stream.info().await.unwrap().state.messages
+}
+
+#[tokio::test]
+async fn test_repeats_dropped_only_within_window() {
+    let nats = TestNats::start();
+    let sensors = connect(&nats, "SENSORS", "sensors", 1).await;
+    let uploads = connect(&nats, "UPLOADS", "uploads", 4).await;
+    let sensors_publisher =
+        EventPublisher::new(sensors.jetstream().clone()).with_deduplication(true);
+    let uploads_publisher =
+        EventPublisher::new(uploads.jetstream().clone()).with_deduplication(true);
+
+    let mut stream = sensors.jetstream().get_stream("SENSORS").await.unwrap();
+    let config = &stream.info().await.unwrap().config;
+    assert_eq!(config.duplicate_window, Duration::from_secs(1));
+
+    let sensor = reading("sensors");
+    let upload = reading("uploads");
+    let started = Instant::now();
+    let sensor_seq = publish(&sensors_publisher, &sensor).await;
+    let upload_seq = publish(&uploads_publisher, &upload).await;
+
+    // Just inside both windows: acked with the original sequence
+    assert_eq!(publish(&sensors_publisher, &sensor).await, sensor_seq);
+    assert_eq!(publish(&uploads_publisher, &upload).await, upload_seq);
+    assert!(started.elapsed() < Duration::from_secs(1));
+
+    // Just outside the 1s window, still inside the 4s one
+    tokio::time::sleep_until((started + Duration::from_millis(1500)).into()).await;
+    assert_ne!(publish(&sensors_publisher, &sensor).await, sensor_seq);
+    assert_eq!(publish(&uploads_publisher, &upload).await, upload_seq);
+
+    // Just outside the 4s window
+    tokio::time::sleep_until((started + Duration::from_millis(4500)).into()).await;
+    assert_ne!(publish(&uploads_publisher, &upload).await, upload_seq);
+
+    assert_eq!(stored(&sensors, "SENSORS").await, 2);
+    assert_eq!(stored(&uploads, "UPLOADS").await, 2);
+}
+
+#[tokio::test]
+async fn test_without_deduplication_repeats_are_stored() {
+    let nats = TestNats::start();
+    let client = connect(&nats, "SENSORS", "sensors", 60).await;
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    let event = reading("sensors");
+    let first = publish(&publisher, &event).await;
+    assert_ne!(publish(&publisher, &event).await, first);
+    assert_eq!(stored(&client, "SENSORS").await, 2);
+}
+
+#[tokio::test]
+async fn test_window_outside_bounds_fails_startup() {
+    let nats = TestNats::start();
+    for window in [0, 2 * 86400] {
+        let err = NatsClient::connect(NatsConfig {
+            url: nats.url.clone(),
+            max_age_days: 1,
+            duplicate_window_seconds: window,
+            ..Default::default()
+        })
+        .await
+        .err()
+        .unwrap();
+        let err = err.downcast_ref::<DuplicateWindowError>().unwrap();
+        assert_eq!(err.window, Duration::from_secs(window));
+        assert_eq!(err.max_age, Duration::from_secs(86400));
+    }
+
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        duplicate_window_seconds: 3600,
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let config = &stream.info().await.unwrap().config;
+    assert_eq!(config.duplicate_window, Duration::from_secs(3600));
+}
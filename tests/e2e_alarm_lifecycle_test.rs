@@ -0,0 +1,340 @@
+// End-to-end alarm lifecycle against a real JetStream server (see
+// tests/common): an alarm.raise posted over HTTP is acked by an exactly-once
+// consumer publishing alarm.ack, the state engine projects both onto the
+// alarm's entity, and the query API serves state and metrics. The server is
+// restarted mid-scenario to check that durable consumers resume.
+//
+// This is the regression gate for changes spanning the publisher, consumers,
+// state engine and API. It spawns its own server (restarts need one) and is
+// behind the `e2e` feature:
+//
+//     cargo test --features e2e --test e2e_alarm_lifecycle_test
+
+mod common;
+
+use async_nats::jetstream::{self, consumer};
+use axum::body::Body;
+use axum::http::{Request, StatusCode};
+use axum::Router;
+use common::TestNats;
+use flux::api::{create_query_router, create_router, AppState, QueryAppState};
+use flux::config::new_runtime_config;
+use flux::event::FluxEvent;
+use flux::namespace::NamespaceRegistry;
+use flux::nats::{
+    decode_event, stream_subject, EventPublisher, ExactlyOnce, NatsClient, NatsConfig,
+    ReceivedEvent,
+};
+use flux::rate_limit::RateLimiter;
+use flux::rules::CAUSATION_HEADER;
+use flux::state::{LagMetrics, StateEngine};
+use futures::StreamExt;
+use serde_json::{json, Value};
+use std::sync::Arc;
+use std::time::{Duration, Instant};
+use tower::ServiceExt;
+
+const RAISE_STREAM: &str = "alarm.raise";
+const ACK_STREAM: &str = "alarm.ack";
+const ACKER: &str = "alarm-acker";
+/// Longest wait for any one step; the whole scenario takes a few seconds
+const STEP_TIMEOUT: Duration = Duration::from_secs(10);
+
+/// A Flux instance wired as in main.rs: ingestion and query routes, the
+/// state engine subscriber, and the alarm acker.
+struct Flux {
+    client: NatsClient,
+    router: Router,
+}
+
+async fn start_flux(nats: &TestNats) -> Flux {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        reconnect_wait_ms: Some(100),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let engine = Arc::new(StateEngine::new());
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_lag_metrics(engine.metrics.lag().clone())
+        .with_publish_metrics(engine.metrics.publishes().clone());
+
+    tokio::spawn(Arc::clone(&engine).run_subscriber(client.jetstream().clone(), None));
+    tokio::spawn(run_acker(
+        client.jetstream().clone(),
+        publisher.clone(),
+        engine.metrics.lag().clone(),
+    ));
+
+    let state = AppState {
+        event_publisher: publisher,
+        namespace_registry: Arc::new(NamespaceRegistry::new()),
+        auth_enabled: false,
+        admin_token: None,
+        runtime_config: new_runtime_config(),
+        rate_limiter: Arc::new(RateLimiter::new()),
+    };
+    let router = create_router(state).merge(create_query_router(Arc::new(QueryAppState {
+        state_engine: engine,
+    })));
+    Flux { client, router }
+}
+
+/// Acks every alarm.raise once, publishing an alarm.ack caused by it for the
+/// same key and entity. Delivery errors while the server is down are
+/// skipped; the durable consumer picks up where it left off.
+async fn run_acker(jetstream: jetstream::Context, publisher: EventPublisher, lag: LagMetrics) {
+    let exactly_once = ExactlyOnce::open(
+        &jetstream,
+        "E2E_ACKED_ALARMS",
+        "FLUX_EVENTS",
+        Some(Duration::from_secs(300)),
+    )
+    .await
+    .unwrap()
+    .with_delivery_metrics(lag, ACKER);
+    let consumer = jetstream
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .get_or_create_consumer(
+            ACKER,
+            consumer::pull::Config {
+                durable_name: Some(ACKER.to_string()),
+                filter_subject: stream_subject(RAISE_STREAM),
+                ack_wait: Duration::from_secs(2),
+                ..Default::default()
+            },
+        )
+        .await
+        .unwrap();
+
+    loop {
+        let Ok(mut messages) = consumer.messages().await else {
+            tokio::time::sleep(Duration::from_millis(100)).await;
+            continue;
+        };
+        while let Some(message) = messages.next().await {
+            let Ok(message) = message else {
+                continue;
+            };
+            let publisher = &publisher;
+            let _ = exactly_once
+                .handle(message, |received: ReceivedEvent| async move {
+                    let raise = received.event;
+                    let raise_id = raise.event_id.clone().unwrap_or_default();
+                    let ack = FluxEvent::builder(ACK_STREAM)
+                        .source(ACKER)
+                        .key(raise.key.clone().unwrap_or_default())
+                        .payload(json!({
+                            "entity_id": raise.payload["entity_id"],
+                            "properties": {"state": "acked", "raise_event_id": raise_id}
+                        }))
+                        .build()?;
+                    publisher
+                        .publish_with_headers(&ack, &[(CAUSATION_HEADER, raise_id.as_str())])
+                        .await?;
+                    Ok(())
+                })
+                .await;
+        }
+    }
+}
+
+async fn send(
+    router: &Router,
+    method: &str,
+    uri: &str,
+    body: Option<Value>,
+) -> (StatusCode, Value) {
+    let request = Request::builder().method(method).uri(uri);
+    let request = match body {
+        Some(body) => request
+            .header("content-type", "application/json")
+            .body(Body::from(body.to_string())),
+        None => request.body(Body::empty()),
+    };
+    let response = router.clone().oneshot(request.unwrap()).await.unwrap();
+    let status = response.status();
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    (status, serde_json::from_slice(&body).unwrap_or(Value::Null))
+}
+
+fn raise(event_id: &str, boiler: &str) -> Value {
+    json!({
+        "eventId": event_id,
+        "stream": RAISE_STREAM,
+        "source": "plant-a",
+        "timestamp": chrono::Utc::now().timestamp_millis(),
+        "key": boiler,
+        "payload": {
+            "entity_id": boiler,
+            "properties": {"state": "raised", "severity": "high", "tag": "TT-101"}
+        }
+    })
+}
+
+/// POST an alarm.raise, retrying while the publisher reconnects.
+async fn post_raise(router: &Router, event_id: &str, boiler: &str) {
+    let started = Instant::now();
+    loop {
+        let (status, body) =
+            send(router, "POST", "/api/events", Some(raise(event_id, boiler))).await;
+        if status == StatusCode::OK {
+            assert_eq!(body["eventId"], event_id);
+            return;
+        }
+        assert!(
+            started.elapsed() < STEP_TIMEOUT,
+            "raise for {} not accepted: {} {}",
+            boiler,
+            status,
+            body
+        );
+        tokio::time::sleep(Duration::from_millis(100)).await;
+    }
+}
+
+/// The entity's properties once the query API reports it acked.
+async fn wait_for_acked(router: &Router, boiler: &str) -> Value {
+    let started = Instant::now();
+    let uri = format!("/api/state/entities/{}", boiler);
+    loop {
+        let (status, body) = send(router, "GET", &uri, None).await;
+        if status == StatusCode::OK && body["properties"]["state"] == "acked" {
+            return body["properties"].clone();
+        }
+        assert!(
+            started.elapsed() < STEP_TIMEOUT,
+            "{} never acked (last state: {} {})",
+            boiler,
+            status,
+            body
+        );
+        tokio::time::sleep(Duration::from_millis(50)).await;
+    }
+}
+
+/// Wait until the acker has acked everything delivered to it, so no ack is
+/// in flight (and would be redelivered) across a restart.
+async fn wait_for_acker_idle(jetstream: &jetstream::Context) -> consumer::Info {
+    let started = Instant::now();
+    loop {
+        if let Ok(stream) = jetstream.get_stream("FLUX_EVENTS").await {
+            if let Ok(info) = stream.consumer_info(ACKER).await {
+                if info.num_pending == 0 && info.num_ack_pending == 0 {
+                    return info;
+                }
+            }
+        }
+        assert!(
+            started.elapsed() < STEP_TIMEOUT,
+            "'{}' still has messages in flight",
+            ACKER
+        );
+        tokio::time::sleep(Duration::from_millis(50)).await;
+    }
+}
+
+/// The last alarm.ack stored, and its causation header.
+async fn last_ack(jetstream: &jetstream::Context) -> (FluxEvent, Option<String>) {
+    let message = jetstream
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .get_last_raw_message_by_subject(&stream_subject(ACK_STREAM))
+        .await
+        .unwrap();
+    let causation = message
+        .headers
+        .get(CAUSATION_HEADER)
+        .map(|value| value.as_str().to_string());
+    let ack = decode_event(Some(&message.headers), &message.payload).unwrap();
+    (ack, causation)
+}
+
+/// Publish counts by stream, and alarm.raise deliveries to the acker.
+async fn counters(router: &Router) -> (Value, u64) {
+    let (status, publishes) = send(router, "GET", "/api/metrics/publishes", None).await;
+    assert_eq!(status, StatusCode::OK);
+    let (status, lag) = send(router, "GET", "/api/metrics/lag", None).await;
+    assert_eq!(status, StatusCode::OK);
+    let deliveries = lag["flux_consumer_delivery_latency_seconds"][ACKER][RAISE_STREAM]["count"]
+        .as_u64()
+        .unwrap_or(0);
+    (publishes["flux_stream_publishes"].clone(), deliveries)
+}
+
+/// Stored alarm.ack events
+async fn stored_acks(jetstream: &jetstream::Context) -> u64 {
+    let stream = jetstream.get_stream("FLUX_EVENTS").await.unwrap();
+    let mut counter = stream
+        .create_consumer(consumer::pull::Config {
+            filter_subject: stream_subject(ACK_STREAM),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    counter.info().await.unwrap().num_pending
+}
+
+#[tokio::test]
+async fn test_alarm_lifecycle_survives_restart() {
+    let started = Instant::now();
+    let mut nats = TestNats::start();
+    let flux = start_flux(&nats).await;
+    let jetstream = flux.client.jetstream().clone();
+
+    // Step 1: raise, consume, ack, project
+    let raise_id = "0190a1b2-0000-7000-8000-000000000001";
+    post_raise(&flux.router, raise_id, "boiler-1").await;
+
+    let state = wait_for_acked(&flux.router, "boiler-1").await;
+    assert_eq!(state["raise_event_id"], raise_id);
+    // Properties from the raise survive the ack
+    assert_eq!(state["severity"], "high");
+
+    let (ack, causation) = last_ack(&jetstream).await;
+    assert_eq!(causation.as_deref(), Some(raise_id));
+    assert_ne!(ack.event_id.as_deref(), Some(raise_id));
+    assert_eq!(ack.key.as_deref(), Some("boiler-1"));
+    assert_eq!(ack.source, ACKER);
+
+    let info = wait_for_acker_idle(&jetstream).await;
+    assert_eq!(info.delivered.stream_sequence, 1);
+    let (publishes, deliveries) = counters(&flux.router).await;
+    assert_eq!(publishes[RAISE_STREAM]["count"], 1);
+    assert_eq!(publishes[ACK_STREAM]["count"], 1);
+    assert_eq!(deliveries, 1);
+
+    // Step 2: restart the server; the durables resume where they were
+    nats.restart();
+
+    let second_id = "0190a1b2-0000-7000-8000-000000000002";
+    post_raise(&flux.router, second_id, "boiler-2").await;
+
+    let state = wait_for_acked(&flux.router, "boiler-2").await;
+    assert_eq!(state["raise_event_id"], second_id);
+    let (ack, causation) = last_ack(&jetstream).await;
+    assert_eq!(causation.as_deref(), Some(second_id));
+    assert_eq!(ack.key.as_deref(), Some("boiler-2"));
+
+    // boiler-1 was neither redelivered nor acked twice
+    wait_for_acker_idle(&jetstream).await;
+    assert_eq!(stored_acks(&jetstream).await, 2);
+    let (publishes, deliveries) = counters(&flux.router).await;
+    assert_eq!(publishes[RAISE_STREAM]["count"], 2);
+    assert_eq!(publishes[ACK_STREAM]["count"], 2);
+    assert_eq!(deliveries, 2);
+    let state = wait_for_acked(&flux.router, "boiler-1").await;
+    assert_eq!(state["raise_event_id"], raise_id);
+
+    assert!(
+        started.elapsed() < Duration::from_secs(60),
+        "scenario took {:?}",
+        started.elapsed()
+    );
+}
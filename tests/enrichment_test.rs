@@ -0,0 +1,116 @@
+// Integration tests for the server-assigned enrichment headers (and the
+// embedded receivedAt field) against a real JetStream server (see
+// tests/common).
+
+mod common;
+
+use async_nats::jetstream::consumer;
+use axum::body::Body;
+use axum::http::{Request, StatusCode};
+use common::TestNats;
+use flux::api::{create_router, AppState};
+use flux::clock::FakeClock;
+use flux::config::new_runtime_config;
+use flux::event::FluxEvent;
+use flux::namespace::NamespaceRegistry;
+use flux::nats::{EventPublisher, IngestApi, NatsClient, NatsConfig, ReceivedEvent};
+use flux::rate_limit::RateLimiter;
+use futures::StreamExt;
+use serde_json::json;
+use std::sync::Arc;
+use tower::ServiceExt;
+
+const RECEIVED_AT: i64 = 1_707_668_400_250;
+
+async fn publisher(nats: &TestNats) -> EventPublisher {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    EventPublisher::new(client.jetstream().clone())
+        .with_clock(FakeClock::at_millis(RECEIVED_AT))
+        .with_instance_id("flux-a")
+}
+
+/// Every message in FLUX_EVENTS, with headers.
+async fn received(nats: &TestNats, count: usize) -> Vec<ReceivedEvent> {
+    let js = nats.jetstream().await;
+    let consumer = js
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .create_consumer(consumer::pull::Config::default())
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+    let mut received = Vec::new();
+    for _ in 0..count {
+        let message = messages.next().await.unwrap().unwrap();
+        received.push(ReceivedEvent::from_message(&message).unwrap());
+    }
+    received
+}
+
+#[tokio::test]
+async fn test_http_publish_is_enriched() {
+    let nats = TestNats::start();
+    let state = AppState {
+        event_publisher: publisher(&nats)
+            .await
+            .with_embed_received_at(true)
+            .for_api(IngestApi::Http),
+        namespace_registry: Arc::new(NamespaceRegistry::new()),
+        auth_enabled: false,
+        admin_token: None,
+        runtime_config: new_runtime_config(),
+        rate_limiter: Arc::new(RateLimiter::new()),
+    };
+    let body = json!({
+        "stream": "sensors",
+        "source": "sensor-01",
+        "timestamp": chrono::Utc::now().timestamp_millis(),
+        // Producers cannot choose the receive time
+        "receivedAt": 1,
+        "payload": {"entity_id": "sensor-01", "properties": {"temp": 21.5}}
+    });
+
+    let response = create_router(state)
+        .oneshot(
+            Request::builder()
+                .method("POST")
+                .uri("/api/events")
+                .header("content-type", "application/json")
+                .body(Body::from(body.to_string()))
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+
+    let received = received(&nats, 1).await.remove(0);
+    assert_eq!(received.received_at(), Some(RECEIVED_AT));
+    assert_eq!(received.instance(), Some("flux-a"));
+    assert_eq!(received.ingest_api(), Some("http"));
+    // The embedded field matches the header
+    assert_eq!(received.event.received_at, received.received_at());
+    assert_eq!(received.event.envelope_version, Some(3));
+}
+
+#[tokio::test]
+async fn test_internal_publish_without_embedding() {
+    let nats = TestNats::start();
+    let event = FluxEvent::builder("flux.system.health")
+        .source("flux")
+        .payload(json!({"entity_id": "flux/instance", "properties": {}}))
+        .build()
+        .unwrap();
+
+    publisher(&nats).await.publish(&event).await.unwrap();
+
+    let received = received(&nats, 1).await.remove(0);
+    assert_eq!(received.ingest_api(), Some("internal"));
+    assert_eq!(received.received_at(), Some(RECEIVED_AT));
+    assert_eq!(received.event.received_at, None);
+}
@@ -0,0 +1,154 @@
+// Integration tests for the eventId index and GET /api/events/:id against a
+// real JetStream server (see tests/common).
+
+mod common;
+
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+};
+use common::TestNats;
+use flux::api::{create_history_router, HistoryAppState};
+use flux::event::FluxEvent;
+use flux::nats::{EventIndex, EventPublisher, FindEventError, NatsClient, NatsConfig};
+use serde_json::{json, Value};
+use std::sync::Arc;
+use std::time::Duration;
+use tower::ServiceExt;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+fn test_event(entity_id: &str) -> FluxEvent {
+    FluxEvent::builder("sensors")
+        .source("index-test")
+        .payload(json!({"entity_id": entity_id, "properties": {"value": 1}}))
+        .must_build()
+}
+
+/// Index writes are async: poll until the entry shows up.
+async fn wait_indexed(index: &EventIndex, event_id: &str) {
+    for _ in 0..50 {
+        if index.lookup(event_id).await.unwrap().is_some() {
+            return;
+        }
+        tokio::time::sleep(Duration::from_millis(20)).await;
+    }
+    panic!("event {} was never indexed", event_id);
+}
+
+#[tokio::test]
+async fn test_find_event_by_id() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let index = Arc::new(
+        EventIndex::open(client.jetstream(), "FLUX_EVENTS", Duration::from_secs(3600))
+            .await
+            .unwrap(),
+    );
+    let publisher =
+        EventPublisher::new(client.jetstream().clone()).with_event_index(Arc::clone(&index));
+
+    publisher.publish(&test_event("sensor-01")).await.unwrap();
+    let event = test_event("sensor-02");
+    publisher.publish(&event).await.unwrap();
+    let event_id = event.event_id.clone().unwrap();
+    wait_indexed(&index, &event_id).await;
+
+    let stored = index.find_event(&event_id).await.unwrap();
+    assert_eq!(stored.sequence, 2);
+    assert_eq!(stored.subject, "flux.events.sensors");
+    assert_eq!(stored.event.payload["entity_id"], "sensor-02");
+
+    let app = create_history_router(Arc::new(HistoryAppState {
+        jetstream: client.jetstream().clone(),
+        event_index: Some(index),
+    }));
+
+    let response = app
+        .clone()
+        .oneshot(
+            Request::builder()
+                .uri(format!("/api/events/{}", event_id))
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let json: Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(json["event"]["eventId"], event_id.as_str());
+    assert_eq!(json["sequence"], 2);
+
+    let response = app
+        .oneshot(
+            Request::builder()
+                .uri("/api/events/018f3c2a-0000-7000-8000-000000000000")
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::NOT_FOUND);
+}
+
+#[tokio::test]
+async fn test_index_entries_expire() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let index = Arc::new(
+        EventIndex::open_bucket(
+            client.jetstream(),
+            "FLUX_EVENT_INDEX_SHORT",
+            "FLUX_EVENTS",
+            Duration::from_secs(1),
+        )
+        .await
+        .unwrap(),
+    );
+    let publisher =
+        EventPublisher::new(client.jetstream().clone()).with_event_index(Arc::clone(&index));
+
+    let event = test_event("sensor-01");
+    publisher.publish(&event).await.unwrap();
+    let event_id = event.event_id.clone().unwrap();
+    wait_indexed(&index, &event_id).await;
+
+    tokio::time::sleep(Duration::from_millis(1500)).await;
+
+    // The event is still in the stream, but no longer indexed
+    assert!(matches!(
+        index.find_event(&event_id).await,
+        Err(FindEventError::NotIndexed(_))
+    ));
+}
+
+#[tokio::test]
+async fn test_lookup_disabled_without_index() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let app = create_history_router(Arc::new(HistoryAppState {
+        jetstream: client.jetstream().clone(),
+        event_index: None,
+    }));
+
+    let response = app
+        .oneshot(
+            Request::builder()
+                .uri("/api/events/018f3c2a-0000-7000-8000-000000000000")
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::NOT_IMPLEMENTED);
+}
@@ -0,0 +1,312 @@
+// Integration tests for the ExactlyOnce consumer helper against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::{consumer, AckKind};
+use common::TestNats;
+use flux::clock::FakeClock;
+use flux::event::{FluxEvent, Priority, ValidationError};
+use flux::nats::{
+    event_from_message, EventPublisher, ExactlyOnce, Handled, NatsClient, NatsConfig,
+};
+use flux::state::LagMetrics;
+use futures::StreamExt;
+use serde_json::json;
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+
+fn order(entity_id: &str) -> FluxEvent {
+    FluxEvent::builder("orders")
+        .source("shop")
+        .payload(json!({"entity_id": entity_id, "properties": {"total": 42}}))
+        .must_build()
+}
+
+async fn setup(nats: &TestNats) -> (NatsClient, consumer::PullConsumer) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let consumer = client
+        .jetstream()
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .create_consumer(consumer::pull::Config {
+            durable_name: Some("orders-sink".to_string()),
+            ack_policy: consumer::AckPolicy::Explicit,
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    (client, consumer)
+}
+
+#[tokio::test]
+async fn test_redelivered_message_handled_once() {
+    let nats = TestNats::start();
+    let (client, mut consumer) = setup(&nats).await;
+    let exactly_once = ExactlyOnce::open(
+        client.jetstream(),
+        "ORDERS_SINK_PROCESSED",
+        "FLUX_EVENTS",
+        Some(Duration::from_secs(3600)),
+    )
+    .await
+    .unwrap();
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&order("order-1"))
+        .await
+        .unwrap();
+
+    let runs = AtomicUsize::new(0);
+    let mut messages = consumer.messages().await.unwrap();
+
+    // First delivery: handler succeeds and the id is marked, but the ack is
+    // lost (simulated with a Nak), so JetStream redelivers
+    let first = messages.next().await.unwrap().unwrap();
+    let event = event_from_message(&first).unwrap();
+    runs.fetch_add(1, Ordering::SeqCst);
+    exactly_once
+        .mark_processed(event.event_id.as_deref().unwrap())
+        .await
+        .unwrap();
+    first.ack_with(AckKind::Nak(None)).await.unwrap();
+
+    // Redelivery: handler skipped, message acked
+    let second = messages.next().await.unwrap().unwrap();
+    assert_eq!(second.info().unwrap().delivered, 2);
+    let handled = exactly_once
+        .handle(second, |_| async {
+            runs.fetch_add(1, Ordering::SeqCst);
+            Ok(())
+        })
+        .await
+        .unwrap();
+    assert_eq!(handled, Handled::Duplicate);
+    assert_eq!(runs.load(Ordering::SeqCst), 1);
+
+    let info = consumer.info().await.unwrap();
+    assert_eq!(info.num_ack_pending, 0);
+    assert_eq!(info.num_pending, 0);
+}
+
+#[tokio::test]
+async fn test_failed_handler_naks_and_retries() {
+    let nats = TestNats::start();
+    let (client, mut consumer) = setup(&nats).await;
+    // Fresh instance with no local cache: the mark is read back from KV
+    let exactly_once = ExactlyOnce::open(
+        client.jetstream(),
+        "ORDERS_SINK_PROCESSED",
+        "FLUX_EVENTS",
+        None,
+    )
+    .await
+    .unwrap()
+    .with_double_ack()
+    .with_cache_size(0);
+
+    let event = order("order-1");
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    publisher.publish(&event).await.unwrap();
+    // Same event published again (e.g. a producer retry)
+    publisher.publish(&event).await.unwrap();
+
+    let runs = AtomicUsize::new(0);
+    let mut messages = consumer.messages().await.unwrap();
+
+    let failed = exactly_once
+        .handle(messages.next().await.unwrap().unwrap(), |_| async {
+            runs.fetch_add(1, Ordering::SeqCst);
+            Err::<(), _>(anyhow::anyhow!("downstream unavailable"))
+        })
+        .await;
+    assert!(failed.is_err());
+
+    let mut outcomes = Vec::new();
+    for _ in 0..2 {
+        let message = messages.next().await.unwrap().unwrap();
+        outcomes.push(
+            exactly_once
+                .handle(message, |_| async {
+                    runs.fetch_add(1, Ordering::SeqCst);
+                    Ok(())
+                })
+                .await
+                .unwrap(),
+        );
+    }
+    outcomes.sort_by_key(|h| *h == Handled::Duplicate);
+    assert_eq!(outcomes, vec![Handled::Processed, Handled::Duplicate]);
+    // One failed run, one successful run; the duplicate was skipped
+    assert_eq!(runs.load(Ordering::SeqCst), 2);
+
+    let info = consumer.info().await.unwrap();
+    assert_eq!(info.num_ack_pending, 0);
+    assert_eq!(info.num_pending, 0);
+}
+
+#[tokio::test]
+async fn test_v1_consumer_terminates_v2_events() {
+    let nats = TestNats::start();
+    let (client, mut consumer) = setup(&nats).await;
+    let exactly_once = ExactlyOnce::open(
+        client.jetstream(),
+        "ORDERS_SINK_PROCESSED",
+        "FLUX_EVENTS",
+        Some(Duration::from_secs(3600)),
+    )
+    .await
+    .unwrap()
+    .with_max_envelope_version(1);
+
+    let v1 = order("order-1");
+    assert_eq!(v1.envelope_version, None);
+    // Setting priority makes it a v2 envelope
+    let v2 = FluxEvent::builder("orders")
+        .source("shop")
+        .priority(Priority::High)
+        .payload(json!({"entity_id": "order-2", "properties": {"total": 7}}))
+        .must_build();
+    assert_eq!(v2.envelope_version, Some(2));
+
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    publisher.publish(&v1).await.unwrap();
+    publisher.publish(&v2).await.unwrap();
+
+    let runs = AtomicUsize::new(0);
+    let mut messages = consumer.messages().await.unwrap();
+    let mut rejected = Vec::new();
+    for _ in 0..2 {
+        let message = messages.next().await.unwrap().unwrap();
+        let result = exactly_once
+            .handle(message, |_| async {
+                runs.fetch_add(1, Ordering::SeqCst);
+                Ok(())
+            })
+            .await;
+        if let Err(e) = result {
+            rejected.push(e.downcast::<ValidationError>().unwrap());
+        }
+    }
+    assert_eq!(runs.load(Ordering::SeqCst), 1);
+    assert_eq!(rejected, vec![ValidationError::UnsupportedEnvelopeVersion(2)]);
+
+    // The v2 event was terminated, not left for redelivery
+    tokio::time::sleep(Duration::from_millis(200)).await;
+    let info = consumer.info().await.unwrap();
+    assert_eq!(info.num_ack_pending, 0);
+    assert_eq!(info.num_redelivered, 0);
+}
+
+#[tokio::test]
+async fn test_delivery_latency_recorded_and_alerted() {
+    let nats = TestNats::start();
+    let (client, mut consumer) = setup(&nats).await;
+    let event = order("order-1");
+    // Delivered 5s after the event was created
+    let clock = FakeClock::at_millis(event.timestamp + 5_000);
+    let lag = LagMetrics::new();
+    let alerts: Arc<Mutex<Vec<(Duration, String)>>> = Arc::default();
+    let alerted = alerts.clone();
+    let exactly_once = ExactlyOnce::open(
+        client.jetstream(),
+        "ORDERS_SINK_PROCESSED",
+        "FLUX_EVENTS",
+        Some(Duration::from_secs(3600)),
+    )
+    .await
+    .unwrap()
+    .with_clock(clock)
+    .with_delivery_metrics(lag.clone(), "orders-sink")
+    .with_latency_alert(Duration::from_secs(1), move |latency, event| {
+        alerted.lock().unwrap().push((latency, event.stream.clone()));
+    });
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+
+    let mut messages = consumer.messages().await.unwrap();
+    exactly_once
+        .handle(messages.next().await.unwrap().unwrap(), |_| async { Ok(()) })
+        .await
+        .unwrap();
+
+    assert_eq!(
+        *alerts.lock().unwrap(),
+        vec![(Duration::from_secs(5), "orders".to_string())]
+    );
+    let snapshot = &lag.delivery_snapshot()["orders-sink"]["orders"];
+    assert_eq!(snapshot.count, 1);
+    assert_eq!(snapshot.sum, 5.0);
+}
+
+#[tokio::test]
+async fn test_expired_event_skipped() {
+    let nats = TestNats::start();
+    let (client, mut consumer) = setup(&nats).await;
+    let now = order("order-0").timestamp;
+    let expiring = |entity_id: &str, age_ms: i64| {
+        FluxEvent::builder("orders")
+            .source("shop")
+            .timestamp_millis(now - age_ms)
+            .ttl(Duration::from_secs(1))
+            .payload(json!({"entity_id": entity_id, "properties": {}}))
+            .must_build()
+    };
+    let expired: Arc<Mutex<Vec<String>>> = Arc::default();
+    let recorded = expired.clone();
+    let exactly_once = ExactlyOnce::open(
+        client.jetstream(),
+        "ORDERS_SINK_PROCESSED",
+        "FLUX_EVENTS",
+        Some(Duration::from_secs(3600)),
+    )
+    .await
+    .unwrap()
+    .with_clock(FakeClock::at_millis(now))
+    .with_expired_event_handler(move |event| {
+        recorded
+            .lock()
+            .unwrap()
+            .push(event.payload["entity_id"].as_str().unwrap().to_string());
+    });
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    for event in [expiring("order-1", 5_000), expiring("order-2", 500)] {
+        publisher.publish(&event).await.unwrap();
+    }
+
+    let mut messages = consumer.messages().await.unwrap();
+    let processed: Arc<Mutex<Vec<String>>> = Arc::default();
+    let mut results = Vec::new();
+    for _ in 0..2 {
+        let message = messages.next().await.unwrap().unwrap();
+        let processed = processed.clone();
+        let result = exactly_once
+            .handle(message, |received| async move {
+                let entity_id = &received.event.payload["entity_id"];
+                processed
+                    .lock()
+                    .unwrap()
+                    .push(entity_id.as_str().unwrap().to_string());
+                Ok(())
+            })
+            .await
+            .unwrap();
+        results.push(result);
+    }
+
+    assert_eq!(results, vec![Handled::Expired, Handled::Processed]);
+    assert_eq!(*processed.lock().unwrap(), vec!["order-2"]);
+    assert_eq!(*expired.lock().unwrap(), vec!["order-1"]);
+    // The expired event was acked, not left for redelivery
+    tokio::time::sleep(Duration::from_millis(200)).await;
+    let info = consumer.info().await.unwrap();
+    assert_eq!(info.num_ack_pending, 0);
+}
@@ -0,0 +1,130 @@
+// Integration tests for the firehose stream against a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::{consumer, stream};
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{
+    disable_firehose, enable_firehose, EventPublisher, FirehoseConfig, NatsClient, NatsConfig,
+    FIREHOSE_STREAM,
+};
+use futures::StreamExt;
+use serde_json::json;
+use std::time::Duration;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+/// Subjects of the messages in the firehose, in stream order. Sourcing is
+/// asynchronous, so keep reading until `expected` messages arrived.
+async fn firehose_subjects(client: &NatsClient, expected: usize) -> Vec<String> {
+    let stream = client
+        .jetstream()
+        .get_stream(FIREHOSE_STREAM)
+        .await
+        .unwrap();
+    let consumer = stream
+        .create_consumer(consumer::pull::OrderedConfig::default())
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut subjects = Vec::new();
+    while subjects.len() < expected {
+        match tokio::time::timeout(Duration::from_secs(5), messages.next()).await {
+            Ok(Some(Ok(message))) => subjects.push(message.subject.to_string()),
+            _ => break,
+        }
+    }
+    subjects
+}
+
+#[tokio::test]
+async fn test_firehose_sources_every_stream_with_original_subjects() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let config = FirehoseConfig::default();
+
+    let sources = enable_firehose(client.jetstream(), &config).await.unwrap();
+    assert_eq!(sources, vec!["FLUX_EVENTS".to_string()]);
+
+    // A stream created after the firehose is picked up on the next sync
+    client
+        .jetstream()
+        .create_stream(stream::Config {
+            name: "AUDIT".to_string(),
+            subjects: vec!["audit.>".to_string()],
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    let sources = enable_firehose(client.jetstream(), &config).await.unwrap();
+    assert_eq!(
+        sources,
+        vec!["AUDIT".to_string(), "FLUX_EVENTS".to_string()]
+    );
+
+    let event = FluxEvent::builder("sensors")
+        .source("firehose-test")
+        .payload(json!({"entity_id": "sensor-01", "properties": {}}))
+        .must_build();
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+    client
+        .jetstream()
+        .publish("audit.login", "user-1".into())
+        .await
+        .unwrap()
+        .await
+        .unwrap();
+
+    let mut subjects = firehose_subjects(&client, 2).await;
+    subjects.sort();
+    assert_eq!(subjects, vec!["audit.login", "flux.events.sensors"]);
+}
+
+#[tokio::test]
+async fn test_disable_firehose_removes_sources() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+
+    assert!(!disable_firehose(client.jetstream(), FIREHOSE_STREAM)
+        .await
+        .unwrap());
+    enable_firehose(client.jetstream(), &FirehoseConfig::default())
+        .await
+        .unwrap();
+    assert!(disable_firehose(client.jetstream(), FIREHOSE_STREAM)
+        .await
+        .unwrap());
+
+    let mut firehose = client
+        .jetstream()
+        .get_stream(FIREHOSE_STREAM)
+        .await
+        .unwrap();
+    let info = firehose.info().await.unwrap();
+    assert!(info.config.sources.iter().flatten().next().is_none());
+
+    // Events published after disabling no longer reach the firehose
+    let event = FluxEvent::builder("sensors")
+        .source("firehose-test")
+        .payload(json!({"entity_id": "sensor-01", "properties": {}}))
+        .must_build();
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+    tokio::time::sleep(Duration::from_millis(500)).await;
+    assert_eq!(firehose.info().await.unwrap().state.messages, 0);
+}
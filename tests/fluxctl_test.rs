@@ -0,0 +1,270 @@
+// Tests for fluxctl against a local HTTP server replaying recorded Flux API
+// responses (no NATS needed).
+
+use axum::extract::{Path, State};
+use axum::http::{HeaderMap, StatusCode};
+use axum::response::IntoResponse;
+use axum::routing::{get, post};
+use axum::{Json, Router};
+use flux::ctl::{self, ApiError, CtlArgs};
+use serde_json::{json, Value};
+use std::sync::{Arc, Mutex};
+
+/// Requests seen by the fixture server: (authorization header, body)
+type Seen = Arc<Mutex<Vec<(Option<String>, Value)>>>;
+
+fn streams_fixture() -> Value {
+    json!({
+        "streams": [
+            {"name": "FLUX_EVENTS", "subjects": ["flux.events.>"], "messages": 1204,
+             "bytes": 512000, "last_sequence": 1310, "labels": {}},
+            {"name": "AUDIT", "subjects": ["flux.events.flux.system.audit"], "messages": 7,
+             "bytes": 2100, "last_sequence": 7, "labels": {"tier": "ops"}}
+        ],
+        "continuation": null
+    })
+}
+
+fn consumers_fixture() -> Value {
+    json!({
+        "consumers": [
+            {"name": "alarm-sink", "stream": "alarms", "filter_subject": "flux.events.alarms",
+             "ack_policy": "explicit", "deliver_policy": "all", "max_deliver": -1,
+             "max_ack_pending": 1000, "members": 2, "num_pending": 42,
+             "num_ack_pending": 3, "num_redelivered": 1}
+        ]
+    })
+}
+
+fn stored_event_fixture() -> Value {
+    json!({
+        "event": {
+            "eventId": "0190a1b2-0000-7000-8000-000000000001", "stream": "alarms",
+            "source": "plc-01", "timestamp": 1707668400000i64, "key": "line-2",
+            "payload": {"entity_id": "alarm-1", "properties": {"level": "high"}}
+        },
+        "subject": "flux.events.alarms",
+        "sequence": 17,
+        "stored_at": "2024-02-11T16:20:00.120Z"
+    })
+}
+
+async fn publish(
+    State(seen): State<Seen>,
+    headers: HeaderMap,
+    Json(body): Json<Value>,
+) -> impl IntoResponse {
+    let auth = headers
+        .get("authorization")
+        .map(|value| value.to_str().unwrap().to_string());
+    seen.lock().unwrap().push((auth, body.clone()));
+    if body["stream"] == "Bad.Stream" {
+        let error = json!({
+            "error": "invalid stream format 'Bad.Stream': must be lowercase with optional dots",
+            "code": "invalid_format",
+            "field": "stream"
+        });
+        return (StatusCode::BAD_REQUEST, Json(error));
+    }
+    let response =
+        json!({"eventId": "0190a1b2-0000-7000-8000-000000000002", "stream": body["stream"]});
+    (StatusCode::OK, Json(response))
+}
+
+async fn stream_info(Path(stream): Path<String>) -> impl IntoResponse {
+    match streams_fixture()["streams"]
+        .as_array()
+        .unwrap()
+        .iter()
+        .find(|info| info["name"] == stream.as_str())
+    {
+        Some(info) => (StatusCode::OK, Json(info.clone())),
+        None => (
+            StatusCode::NOT_FOUND,
+            Json(json!({"error": format!("stream '{}' not found", stream)})),
+        ),
+    }
+}
+
+async fn start_fixture_server() -> (String, Seen) {
+    let seen: Seen = Arc::default();
+    let app = Router::new()
+        .route("/api/streams", get(|| async { Json(streams_fixture()) }))
+        .route("/api/streams/:stream", get(stream_info))
+        .route(
+            "/api/streams/:stream/consumers",
+            get(|| async { Json(consumers_fixture()) }),
+        )
+        .route("/api/events", post(publish))
+        .route(
+            "/api/events/:id",
+            get(|| async { Json(stored_event_fixture()) }),
+        )
+        .with_state(seen.clone());
+    let listener = tokio::net::TcpListener::bind("127.0.0.1:0").await.unwrap();
+    let url = format!("http://{}", listener.local_addr().unwrap());
+    tokio::spawn(async move { axum::serve(listener, app).await.unwrap() });
+    (url, seen)
+}
+
+/// Run fluxctl with `args` (after `--server`), returning stdout.
+async fn fluxctl(server: &str, args: &[&str], stdin: &str) -> anyhow::Result<String> {
+    let args = CtlArgs::parse(["--server", server].iter().chain(args), |_| None)?;
+    let mut out = Vec::new();
+    ctl::run(&args, &mut stdin.as_bytes(), &mut out).await?;
+    Ok(String::from_utf8(out).unwrap())
+}
+
+#[tokio::test]
+async fn test_streams_list_and_info() {
+    let (server, _) = start_fixture_server().await;
+
+    let out = fluxctl(&server, &["streams", "list"], "").await.unwrap();
+    assert_eq!(
+        out,
+        "NAME         MESSAGES  BYTES   LAST_SEQUENCE\n\
+         FLUX_EVENTS  1204      512000  1310\n\
+         AUDIT        7         2100    7\n"
+    );
+
+    let out = fluxctl(&server, &["streams", "info", "AUDIT"], "")
+        .await
+        .unwrap();
+    assert!(
+        out.contains("subjects       flux.events.flux.system.audit\n"),
+        "{}",
+        out
+    );
+    assert!(out.contains("last_sequence  7\n"), "{}", out);
+
+    let out = fluxctl(&server, &["--output", "json", "streams", "list"], "")
+        .await
+        .unwrap();
+    assert_eq!(
+        serde_json::from_str::<Value>(&out).unwrap(),
+        streams_fixture()
+    );
+
+    let err = fluxctl(&server, &["streams", "info", "MISSING"], "")
+        .await
+        .unwrap_err();
+    assert_eq!(err.downcast_ref::<ApiError>().unwrap().status, 404);
+}
+
+#[tokio::test]
+async fn test_publish_from_stdin_and_file() {
+    let (server, seen) = start_fixture_server().await;
+    let payload = r#"{"entity_id": "sensor-01", "properties": {"temp": 21.5}}"#;
+
+    let out = fluxctl(
+        &server,
+        &[
+            "--api-key",
+            "k1",
+            "publish",
+            "--stream",
+            "sensors",
+            "--source",
+            "cli",
+        ],
+        payload,
+    )
+    .await
+    .unwrap();
+    assert_eq!(
+        out,
+        "published 0190a1b2-0000-7000-8000-000000000002 to sensors\n"
+    );
+
+    let file = tempfile::NamedTempFile::new().unwrap();
+    std::fs::write(file.path(), payload).unwrap();
+    let path = file.path().to_str().unwrap();
+    fluxctl(
+        &server,
+        &[
+            "publish", "--stream", "sensors", "--source", "cli", "--key", "s1", "--file", path,
+        ],
+        "",
+    )
+    .await
+    .unwrap();
+
+    let seen = seen.lock().unwrap();
+    assert_eq!(seen[0].0.as_deref(), Some("Bearer k1"));
+    assert_eq!(seen[0].1["payload"]["properties"]["temp"], 21.5);
+    assert_eq!(seen[0].1["source"], "cli");
+    assert!(seen[0].1["timestamp"].as_i64().unwrap() > 0);
+    assert_eq!(seen[1].0, None);
+    assert_eq!(seen[1].1["key"], "s1");
+}
+
+#[tokio::test]
+async fn test_publish_validation_failure_shows_details() {
+    let (server, _) = start_fixture_server().await;
+
+    let err = fluxctl(
+        &server,
+        &["publish", "--stream", "Bad.Stream", "--source", "cli"],
+        r#"{"entity_id": "sensor-01"}"#,
+    )
+    .await
+    .unwrap_err();
+
+    let api_error = err.downcast_ref::<ApiError>().unwrap();
+    assert_eq!(api_error.status, 400);
+    assert_eq!(api_error.code.as_deref(), Some("invalid_format"));
+    assert_eq!(api_error.field.as_deref(), Some("stream"));
+    assert!(err
+        .to_string()
+        .ends_with("(field 'stream', code invalid_format)"));
+
+    // Malformed payloads never reach the server
+    let err = fluxctl(
+        &server,
+        &["publish", "--stream", "s", "--source", "cli"],
+        "{",
+    )
+    .await
+    .unwrap_err();
+    assert!(err.to_string().contains("not valid JSON"));
+}
+
+#[tokio::test]
+async fn test_events_get() {
+    let (server, _) = start_fixture_server().await;
+
+    let out = fluxctl(
+        &server,
+        &["events", "get", "0190a1b2-0000-7000-8000-000000000001"],
+        "",
+    )
+    .await
+    .unwrap();
+    assert!(out.contains("stream     alarms\n"), "{}", out);
+    assert!(out.contains("key        line-2\n"), "{}", out);
+    assert!(out.contains("sequence   17\n"), "{}", out);
+    assert!(out.contains("\"level\": \"high\""), "{}", out);
+}
+
+#[tokio::test]
+async fn test_consumers_list_and_lag() {
+    let (server, _) = start_fixture_server().await;
+
+    let out = fluxctl(&server, &["consumers", "list", "alarms"], "")
+        .await
+        .unwrap();
+    assert_eq!(
+        out,
+        "NAME        FILTER_SUBJECT      ACK_POLICY  DELIVER_POLICY  MEMBERS\n\
+         alarm-sink  flux.events.alarms  explicit    all             2\n"
+    );
+
+    let out = fluxctl(&server, &["consumers", "lag", "alarms"], "")
+        .await
+        .unwrap();
+    assert_eq!(
+        out,
+        "NAME        NUM_PENDING  NUM_ACK_PENDING  NUM_REDELIVERED\n\
+         alarm-sink  42           3                1\n"
+    );
+}
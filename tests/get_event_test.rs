@@ -0,0 +1,88 @@
+// Integration tests for reading single events by sequence (NatsClient
+// get_event / get_first_event / get_last_event) against a real JetStream
+// server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{
+    EventPublisher, MessageNotFoundError, NatsClient, NatsConfig, StreamNotFoundError,
+};
+use serde_json::json;
+
+async fn connect(nats: &TestNats, allow_direct: bool) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        allow_direct,
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+async fn publish(client: &NatsClient, count: usize) -> Vec<FluxEvent> {
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    let mut events = Vec::new();
+    for i in 0..count {
+        let event = FluxEvent::builder("sensors")
+            .source("get-event-test")
+            .payload(json!({"entity_id": format!("sensor-{:02}", i), "properties": {}}))
+            .must_build();
+        publisher.publish(&event).await.unwrap();
+        events.push(event);
+    }
+    events
+}
+
+#[tokio::test]
+async fn test_get_event_by_sequence_first_and_last() {
+    for allow_direct in [true, false] {
+        let nats = TestNats::start();
+        let client = connect(&nats, allow_direct).await;
+        let events = publish(&client, 3).await;
+
+        let event = client.get_event("FLUX_EVENTS", 2).await.unwrap();
+        assert_eq!(event.event_id, events[1].event_id);
+        assert_eq!(event.payload["entity_id"], "sensor-01");
+
+        let first = client.get_first_event("FLUX_EVENTS").await.unwrap();
+        assert_eq!(first.event_id, events[0].event_id);
+        let last = client.get_last_event("FLUX_EVENTS").await.unwrap();
+        assert_eq!(last.event_id, events[2].event_id);
+
+        // First follows purges
+        client
+            .purge_stream_before_sequence("FLUX_EVENTS", 2)
+            .await
+            .unwrap();
+        let first = client.get_first_event("FLUX_EVENTS").await.unwrap();
+        assert_eq!(first.event_id, events[1].event_id);
+    }
+}
+
+#[tokio::test]
+async fn test_missing_messages_and_streams() {
+    let nats = TestNats::start();
+    let client = connect(&nats, true).await;
+
+    for err in [
+        client.get_first_event("FLUX_EVENTS").await.unwrap_err(),
+        client.get_last_event("FLUX_EVENTS").await.unwrap_err(),
+    ] {
+        assert!(err.downcast_ref::<MessageNotFoundError>().is_some());
+    }
+
+    publish(&client, 2).await;
+    let err = client.get_event("FLUX_EVENTS", 3).await.unwrap_err();
+    assert_eq!(
+        err.downcast_ref::<MessageNotFoundError>(),
+        Some(&MessageNotFoundError {
+            stream: "FLUX_EVENTS".to_string(),
+            sequence: 3,
+        })
+    );
+
+    let err = client.get_event("NOPE", 1).await.unwrap_err();
+    assert!(err.downcast_ref::<StreamNotFoundError>().is_some());
+}
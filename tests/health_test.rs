@@ -0,0 +1,108 @@
+// Integration tests for the detailed /healthz response against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::consumer::pull;
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+    Router,
+};
+use common::TestNats;
+use flux::api::Readiness;
+use flux::event::FluxEvent;
+use flux::nats::{EventPublisher, NatsClient, NatsConfig};
+use serde_json::{json, Value};
+use tower::ServiceExt;
+
+async fn healthz(router: &Router) -> Value {
+    let response = router
+        .clone()
+        .oneshot(Request::get("/healthz").body(Body::empty()).unwrap())
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    serde_json::from_slice(&body).unwrap()
+}
+
+/// FLUX_EVENTS with 3 events and a durable consumer that has read none of them
+async fn setup(nats: &TestNats) -> NatsClient {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    for n in 0..3 {
+        let event = FluxEvent::builder("sensors")
+            .source("health-test")
+            .payload(json!({"entity_id": "sensor-01", "properties": {"n": n}}))
+            .must_build();
+        publisher.publish(&event).await.unwrap();
+    }
+    client
+        .jetstream()
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .create_consumer(pull::Config {
+            durable_name: Some("slow-reader".to_string()),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    client
+}
+
+#[tokio::test]
+async fn test_healthz_before_ready_is_static() {
+    let router = Readiness::new().router();
+    let body = healthz(&router).await;
+    assert_eq!(body, json!({"status": "ok", "streams": []}));
+}
+
+#[tokio::test]
+async fn test_healthz_reports_stream_and_consumer_stats() {
+    let nats = TestNats::start();
+    let client = setup(&nats).await;
+    let readiness = Readiness::new();
+    readiness.set_ready(Router::new(), &client);
+
+    let body = healthz(&readiness.router()).await;
+    assert_eq!(body["status"], "ok");
+    assert!(body.get("reason").is_none());
+
+    let streams = body["streams"].as_array().unwrap();
+    let events = streams
+        .iter()
+        .find(|s| s["name"] == "FLUX_EVENTS")
+        .expect("FLUX_EVENTS missing");
+    assert_eq!(events["messages"], 3);
+    assert_eq!(events["consumer_count"], 1);
+    assert!(events["oldest_message"].is_string());
+    assert!(events["newest_message"].is_string());
+    assert_eq!(
+        events["consumers"],
+        json!([{"name": "slow-reader", "lag": 3, "ack_pending": 0}])
+    );
+}
+
+#[tokio::test]
+async fn test_healthz_degraded_when_consumer_lags() {
+    let nats = TestNats::start();
+    let client = setup(&nats).await;
+    let readiness = Readiness::new().with_lag_threshold(2);
+    readiness.set_ready(Router::new(), &client);
+
+    let body = healthz(&readiness.router()).await;
+    assert_eq!(body["status"], "degraded");
+    assert!(body["reason"]
+        .as_str()
+        .unwrap()
+        .contains("FLUX_EVENTS/slow-reader"));
+}
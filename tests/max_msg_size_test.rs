@@ -0,0 +1,96 @@
+// Integration test for the per-stream max message size against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::{FluxEvent, ValidationError, ValidationErrorCode};
+use flux::nats::{
+    encode_event, EventEncoding, EventPublisher, NatsClient, NatsConfig, PayloadTooLargeError,
+};
+use serde_json::json;
+
+fn large_event() -> FluxEvent {
+    FluxEvent::builder("sensors")
+        .source("size-test")
+        .payload(json!({"entity_id": "sensor-01", "properties": {"blob": "x".repeat(500)}}))
+        .must_build()
+}
+
+async fn message_count(client: &NatsClient) -> u64 {
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    stream.info().await.unwrap().state.messages
+}
+
+#[tokio::test]
+async fn test_events_over_max_msg_size_are_rejected() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(
+        NatsConfig {
+            url: nats.url.clone(),
+            ..Default::default()
+        }
+        .with_max_msg_size(100),
+    )
+    .await
+    .unwrap();
+
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    assert_eq!(stream.info().await.unwrap().config.max_message_size, 100);
+
+    // Checked before the NATS call
+    let publisher = EventPublisher::new(client.jetstream().clone()).with_max_msg_size(100);
+    let err = publisher.publish(&large_event()).await.unwrap_err();
+    let validation = err.downcast_ref::<ValidationError>().unwrap();
+    assert!(matches!(validation, ValidationError::PayloadTooLarge(size) if *size > 100));
+    assert_eq!(validation.field(), "payload");
+    assert_eq!(validation.code(), ValidationErrorCode::PayloadTooLarge);
+
+    // JetStream enforces the limit even without the publisher check, and
+    // its rejection is classified
+    let unchecked = EventPublisher::new(client.jetstream().clone());
+    let err = unchecked.publish(&large_event()).await.unwrap_err();
+    let too_large = err.downcast_ref::<PayloadTooLargeError>().unwrap();
+    assert!(too_large.size > 100);
+    assert_eq!(too_large.max, None);
+    assert_eq!(message_count(&client).await, 0);
+
+    // Messages under the limit are stored
+    client
+        .jetstream()
+        .publish("flux.events.sensors", "small".into())
+        .await
+        .unwrap()
+        .await
+        .unwrap();
+    assert_eq!(message_count(&client).await, 1);
+}
+
+#[tokio::test]
+async fn test_max_payload_includes_headers() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let event = large_event();
+    let payload_len = encode_event(&event, EventEncoding::Json, None)
+        .unwrap()
+        .payload
+        .len();
+
+    // The payload alone fits, but not with its headers
+    let publisher = EventPublisher::new(client.jetstream().clone()).with_max_payload(payload_len);
+    let err = publisher.publish(&event).await.unwrap_err();
+    let too_large = err.downcast_ref::<PayloadTooLargeError>().unwrap();
+    assert!(too_large.size > payload_len);
+    assert_eq!(too_large.max, Some(payload_len));
+    assert_eq!(message_count(&client).await, 0);
+
+    let publisher =
+        EventPublisher::new(client.jetstream().clone()).with_max_payload(payload_len + 512);
+    publisher.publish(&event).await.unwrap();
+    assert_eq!(message_count(&client).await, 1);
+}
@@ -0,0 +1,84 @@
+// Integration tests for bounded NATS reconnects against a real server that is
+// stopped and restarted on the same port (see tests/common). Only
+// test_limit_from_env sets NATS_MAX_RECONNECTS; the others configure the
+// limit directly.
+
+mod common;
+
+use common::{free_port, TestNats};
+use flux::nats::{NatsClient, NatsConfig};
+use std::time::Duration;
+
+async fn connect(nats: &TestNats, attempts: usize) -> NatsClient {
+    NatsClient::connect(
+        NatsConfig {
+            url: nats.url.clone(),
+            ..Default::default()
+        }
+        .with_max_reconnects(attempts, Duration::from_millis(100)),
+    )
+    .await
+    .unwrap()
+}
+
+#[tokio::test]
+async fn test_exhausted_when_server_stays_down() {
+    let nats = TestNats::start_on_port(free_port());
+    let client = connect(&nats, 3).await;
+    let mut exhausted = client.subscribe_reconnects_exhausted();
+    assert!(!*exhausted.borrow());
+
+    drop(nats);
+    tokio::time::timeout(Duration::from_secs(10), exhausted.wait_for(|e| *e))
+        .await
+        .expect("reconnects were not reported exhausted")
+        .unwrap();
+}
+
+#[tokio::test]
+async fn test_reconnects_when_server_returns_in_time() {
+    let port = free_port();
+    let nats = TestNats::start_on_port(port);
+    let client = connect(&nats, 100).await;
+    let mut reconnects = client.subscribe_reconnects();
+    let exhausted = client.subscribe_reconnects_exhausted();
+
+    drop(nats);
+    tokio::time::sleep(Duration::from_millis(500)).await;
+    let _nats = TestNats::start_on_port(port);
+
+    tokio::time::timeout(Duration::from_secs(10), reconnects.recv())
+        .await
+        .expect("client did not reconnect")
+        .unwrap();
+    assert!(!*exhausted.borrow());
+}
+
+#[tokio::test]
+async fn test_limit_from_env() {
+    let nats = TestNats::start_on_port(free_port());
+    std::env::set_var("NATS_MAX_RECONNECTS", "2");
+    let config = NatsConfig {
+        url: nats.url.clone(),
+        reconnect_wait_ms: Some(100),
+        ..Default::default()
+    }
+    .with_env_overrides();
+    assert_eq!(config.max_reconnects, Some(2));
+    let client = NatsClient::connect(config).await.unwrap();
+    let mut exhausted = client.subscribe_reconnects_exhausted();
+
+    drop(nats);
+    tokio::time::timeout(Duration::from_secs(10), exhausted.wait_for(|e| *e))
+        .await
+        .expect("reconnects were not reported exhausted")
+        .unwrap();
+
+    // -1 lifts the limit again
+    std::env::set_var("NATS_MAX_RECONNECTS", "-1");
+    let config = NatsConfig::default()
+        .with_max_reconnects(5, Duration::from_millis(100))
+        .with_env_overrides();
+    assert_eq!(config.max_reconnects, None);
+    std::env::remove_var("NATS_MAX_RECONNECTS");
+}
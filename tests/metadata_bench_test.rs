@@ -0,0 +1,49 @@
+// Benchmarks reading EventMetadata against parsing a full FluxEvent.
+//
+// The benchmarks are #[ignore]d; run them with
+// `cargo test --release --test metadata_bench_test -- --ignored --nocapture`.
+
+use flux::event::{EventMetadata, FluxEvent};
+use serde_json::json;
+use std::time::Instant;
+
+const ITERATIONS: u32 = 2_000;
+
+/// A JSON event whose payload serializes to roughly `payload_bytes`.
+fn encoded_event(payload_bytes: usize) -> Vec<u8> {
+    let readings: Vec<_> = (0..payload_bytes / 32)
+        .map(|i| json!({"id": format!("r{:05}", i), "value": i}))
+        .collect();
+    let event = FluxEvent::builder("sensors.temp")
+        .source("bench")
+        .key("sensor-1")
+        .payload(json!({"entity_id": "sensor-1", "properties": {"readings": readings}}))
+        .must_build();
+    serde_json::to_vec(&event).unwrap()
+}
+
+/// Mean microseconds per call of `parse`
+fn measure(parse: impl Fn() -> bool) -> f64 {
+    let start = Instant::now();
+    for _ in 0..ITERATIONS {
+        assert!(parse());
+    }
+    start.elapsed().as_secs_f64() * 1e6 / ITERATIONS as f64
+}
+
+#[test]
+#[ignore]
+fn bench_metadata_vs_full_decode() {
+    for payload_bytes in [1_024, 100 * 1_024] {
+        let data = encoded_event(payload_bytes);
+        let metadata = measure(|| EventMetadata::from_json(&data).is_ok());
+        let full = measure(|| serde_json::from_slice::<FluxEvent>(&data).is_ok());
+        println!(
+            "{:>7} bytes: metadata {:>8.2}µs  full {:>8.2}µs  ({:.1}x)",
+            data.len(),
+            metadata,
+            full,
+            full / metadata
+        );
+    }
+}
@@ -0,0 +1,923 @@
+// Integration tests against a real JetStream server (see tests/common).
+//
+// These cover the NATS-facing pieces the HTTP-level tests stub out:
+// stream bootstrap in NatsClient and the EventPublisher round trip.
+
+mod common;
+
+use common::TestNats;
+use flux::event::{sanitize_key, FluxEvent, Priority};
+use flux::nats::{
+    decode_event, event_from_message, high_priority_subject, wildcard_subjects, BatchStreamError,
+    EventEncoding, EventPublisher, NatsClient, NatsConfig, PublishAck, PublishError,
+    RepublishConfig, RepublishLoopError, Sampler, SerializationError, StreamCreateError,
+    StreamFullError, StreamInitStatus, StreamNotFoundError, SubjectNotCapturedError,
+    CONTENT_ENCODING_HEADER, CONTENT_TYPE_HEADER, DEFAULT_PUBLISH_TIMEOUT, GZIP_ENCODING,
+    PRIORITY_HEADER, PROTOBUF_CONTENT_TYPE,
+};
+use flux::clock::FakeClock;
+use flux::state::{LagMetrics, PublishMetrics, StorageMetrics};
+use futures::StreamExt;
+use serde_json::json;
+
+fn test_config(nats: &TestNats) -> NatsConfig {
+    NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    }
+}
+
+fn test_event(stream: &str, entity_id: &str) -> FluxEvent {
+    let mut event = FluxEvent {
+        event_id: None,
+        stream: stream.to_string(),
+        source: "integration-test".to_string(),
+        timestamp: chrono::Utc::now().timestamp_millis(),
+        key: None,
+        schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
+        payload: json!({
+            "entity_id": entity_id,
+            "properties": {"value": 1}
+        }),
+        raw_payload: None,
+    };
+    event.validate_and_prepare().unwrap();
+    event
+}
+
+/// Read every event currently in FLUX_EVENTS via an ordered consumer.
+async fn read_all_events(nats: &TestNats) -> Vec<FluxEvent> {
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let consumer = stream
+        .create_consumer(async_nats::jetstream::consumer::pull::OrderedConfig::default())
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut events = Vec::new();
+    while let Ok(Some(Ok(msg))) =
+        tokio::time::timeout(std::time::Duration::from_millis(200), messages.next()).await
+    {
+        events.push(event_from_message(&msg).unwrap());
+    }
+    events
+}
+
+#[tokio::test]
+async fn test_connect_creates_stream() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let info = stream.info().await.unwrap();
+    assert_eq!(info.config.subjects, vec!["flux.events.>".to_string()]);
+    assert_eq!(info.state.messages, 0);
+}
+
+#[tokio::test]
+async fn test_connect_is_idempotent() {
+    let nats = TestNats::start();
+    NatsClient::connect(test_config(&nats)).await.unwrap();
+    // Second connect must find the existing stream rather than fail
+    NatsClient::connect(test_config(&nats)).await.unwrap();
+}
+
+#[tokio::test]
+async fn test_publish_round_trip() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    let event = test_event("sensors", "sensor-01");
+    publisher.publish(&event).await.unwrap();
+
+    let events = read_all_events(&nats).await;
+    assert_eq!(events.len(), 1);
+    assert_eq!(events[0].event_id, event.event_id);
+    assert_eq!(events[0].stream, "sensors");
+    assert_eq!(events[0].payload["entity_id"], "sensor-01");
+}
+
+#[tokio::test]
+async fn test_publish_batch_preserves_order() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    let events: Vec<FluxEvent> = (0..5)
+        .map(|i| test_event("sensors.zone1", &format!("sensor-{}", i)))
+        .collect();
+    let results = publisher.publish_batch(&events).await.unwrap();
+    assert!(results.iter().all(|r| r.is_ok()));
+
+    let stored = read_all_events(&nats).await;
+    let ids: Vec<_> = stored.iter().map(|e| e.event_id.clone()).collect();
+    let expected: Vec<_> = events.iter().map(|e| e.event_id.clone()).collect();
+    assert_eq!(ids, expected);
+}
+
+#[tokio::test]
+async fn test_config_drift_logged_without_force() {
+    let nats = TestNats::start();
+    NatsClient::connect(test_config(&nats)).await.unwrap();
+
+    let changed = NatsConfig {
+        max_age_days: 30,
+        ..test_config(&nats)
+    };
+    let client = NatsClient::connect(changed).await.unwrap();
+
+    // Drift is reported but not applied
+    let diff = client.diff_stream_config().await.unwrap();
+    assert_eq!(diff.changes.len(), 1);
+    assert_eq!(diff.changes[0].field, "max_age");
+}
+
+#[tokio::test]
+async fn test_forced_safe_update_applied() {
+    let nats = TestNats::start();
+    NatsClient::connect(test_config(&nats)).await.unwrap();
+
+    let changed = NatsConfig {
+        max_age_days: 30,
+        force_stream_update: true,
+        ..test_config(&nats)
+    };
+    let client = NatsClient::connect(changed).await.unwrap();
+
+    assert!(client.diff_stream_config().await.unwrap().is_empty());
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let info = stream.info().await.unwrap();
+    assert_eq!(info.config.max_age, std::time::Duration::from_secs(30 * 86400));
+}
+
+#[tokio::test]
+async fn test_connect_reports_stream_init_outcome() {
+    let nats = TestNats::start();
+    let statuses = |client: &NatsClient| -> Vec<(String, StreamInitStatus)> {
+        client
+            .stream_init_report()
+            .iter()
+            .map(|result| (result.stream.clone(), result.status))
+            .collect()
+    };
+
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    assert_eq!(
+        statuses(&client),
+        vec![("FLUX_EVENTS".to_string(), StreamInitStatus::Created)]
+    );
+
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    assert_eq!(statuses(&client)[0].1, StreamInitStatus::AlreadyExisted);
+
+    let changed = NatsConfig {
+        max_age_days: 30,
+        force_stream_update: true,
+        ..test_config(&nats)
+    };
+    let client = NatsClient::connect(changed).await.unwrap();
+    assert_eq!(statuses(&client)[0].1, StreamInitStatus::Reconciled);
+}
+
+#[tokio::test]
+async fn test_initialize_streams_is_best_effort() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let stream = |name: &str, subject: &str| async_nats::jetstream::stream::Config {
+        name: name.to_string(),
+        subjects: vec![subject.to_string()],
+        ..Default::default()
+    };
+    let configs = vec![
+        stream("ORDERS", "orders.>"),
+        client
+            .jetstream()
+            .get_stream("FLUX_EVENTS")
+            .await
+            .unwrap()
+            .cached_info()
+            .config
+            .clone(),
+        stream("BAD.NAME", "bad.>"),
+        stream("INVOICES", "invoices.>"),
+    ];
+
+    let report = client.initialize_streams(&configs).await;
+    let statuses: Vec<_> = report
+        .iter()
+        .map(|r| (r.stream.as_str(), r.status))
+        .collect();
+    assert_eq!(
+        statuses,
+        vec![
+            ("ORDERS", StreamInitStatus::Created),
+            ("FLUX_EVENTS", StreamInitStatus::AlreadyExisted),
+            ("BAD.NAME", StreamInitStatus::Failed),
+            ("INVOICES", StreamInitStatus::Created),
+        ]
+    );
+    assert!(report[2].error.is_some());
+    assert!(report
+        .iter()
+        .filter(|r| r.status != StreamInitStatus::Failed)
+        .all(|r| r.error.is_none()));
+
+    // Idempotent
+    let report = client.initialize_streams(&configs[..1]).await;
+    assert_eq!(report[0].status, StreamInitStatus::AlreadyExisted);
+}
+
+#[tokio::test]
+async fn test_initialize_from_directory() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let fixtures = concat!(env!("CARGO_MANIFEST_DIR"), "/tests/fixtures/streams");
+
+    let report = client.initialize_from_directory(fixtures).await.unwrap();
+    let statuses: Vec<_> = report
+        .iter()
+        .map(|r| (r.stream.as_str(), r.status))
+        .collect();
+    assert_eq!(
+        statuses,
+        vec![
+            ("INVOICES", StreamInitStatus::Created),
+            ("ORDERS", StreamInitStatus::Created),
+            ("SHIPMENTS", StreamInitStatus::Created),
+        ]
+    );
+    let js = client.jetstream();
+    let mut orders = js.get_stream("ORDERS").await.unwrap();
+    assert_eq!(orders.info().await.unwrap().config.max_msgs, 100_000);
+    let mut invoices = js.get_stream("INVOICES").await.unwrap();
+    assert_eq!(invoices.info().await.unwrap().config.max_bytes, 1 << 30);
+    let mut shipments = js.get_stream("SHIPMENTS").await.unwrap();
+    assert_eq!(
+        shipments.info().await.unwrap().config.storage,
+        async_nats::jetstream::stream::StorageType::Memory
+    );
+
+    // Broken and unrelated files are skipped; the rest still go through
+    let dir = tempfile::tempdir().unwrap();
+    for file in ["orders.json", "invoices.yaml", "shipments.yml"] {
+        std::fs::copy(format!("{}/{}", fixtures, file), dir.path().join(file)).unwrap();
+    }
+    std::fs::write(dir.path().join("broken.json"), "{\"name\": ").unwrap();
+    std::fs::write(dir.path().join("unnamed.yaml"), "subjects: [\"x.>\"]\n").unwrap();
+    std::fs::write(dir.path().join("README.md"), "not a stream").unwrap();
+    std::fs::write(
+        dir.path().join("payments.json"),
+        r#"{"name": "PAYMENTS", "subjects": ["payments.>"]}"#,
+    )
+    .unwrap();
+
+    let report = client.initialize_from_directory(dir.path()).await.unwrap();
+    let statuses: Vec<_> = report
+        .iter()
+        .map(|r| (r.stream.as_str(), r.status))
+        .collect();
+    assert_eq!(
+        statuses,
+        vec![
+            ("INVOICES", StreamInitStatus::AlreadyExisted),
+            ("ORDERS", StreamInitStatus::AlreadyExisted),
+            ("PAYMENTS", StreamInitStatus::Created),
+            ("SHIPMENTS", StreamInitStatus::AlreadyExisted),
+        ]
+    );
+
+    assert!(client
+        .initialize_from_directory(dir.path().join("missing"))
+        .await
+        .is_err());
+}
+
+#[tokio::test]
+async fn test_stream_batch_rolls_back_on_failure() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let js = client.jetstream();
+    let stream = |name: &str, subject: &str| async_nats::jetstream::stream::Config {
+        name: name.to_string(),
+        subjects: vec![subject.to_string()],
+        ..Default::default()
+    };
+    let existing = js
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .cached_info()
+        .config
+        .clone();
+
+    // Fails at the third stream
+    let configs = vec![
+        stream("ORDERS", "orders.>"),
+        existing.clone(),
+        stream("BAD.NAME", "bad.>"),
+        stream("INVOICES", "invoices.>"),
+    ];
+    let err = client.create_streams_batch(&configs).await.unwrap_err();
+    let batch = err.downcast_ref::<BatchStreamError>().unwrap();
+    assert_eq!(batch.failed.name, "BAD.NAME");
+    assert_eq!(batch.created, vec!["ORDERS".to_string()]);
+    let create = batch.source.downcast_ref::<StreamCreateError>().unwrap();
+    assert_eq!(create.stream, "BAD.NAME");
+
+    // Created streams are rolled back; pre-existing ones are kept
+    assert!(js.get_stream("ORDERS").await.is_err());
+    assert!(js.get_stream("INVOICES").await.is_err());
+    assert!(js.get_stream("FLUX_EVENTS").await.is_ok());
+
+    let configs = vec![stream("ORDERS", "orders.>"), existing];
+    client.create_streams_batch(&configs).await.unwrap();
+    assert!(js.get_stream("ORDERS").await.is_ok());
+}
+
+#[tokio::test]
+async fn test_unsafe_update_rejected() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+
+    let mut diff = client.diff_stream_config().await.unwrap();
+    diff.changes.push(flux::nats::FieldChange {
+        field: "storage",
+        current: "File".to_string(),
+        desired: "Memory".to_string(),
+        safe: false,
+    });
+
+    let err = client.apply_stream_diff(&diff).await.unwrap_err();
+    let unsafe_err = err.downcast_ref::<flux::nats::UnsafeUpdateError>().unwrap();
+    assert_eq!(unsafe_err.fields, vec!["storage"]);
+}
+
+#[tokio::test]
+async fn test_publisher_refuses_when_stream_full() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+
+    // Pre-fill the stream up to the limit
+    let unlimited = EventPublisher::new(client.jetstream().clone());
+    for i in 0..3 {
+        unlimited
+            .publish(&test_event("sensors", &format!("sensor-{}", i)))
+            .await
+            .unwrap();
+    }
+
+    let limited =
+        EventPublisher::new(client.jetstream().clone()).with_max_stream_depth("FLUX_EVENTS", 3);
+    let err = limited
+        .publish(&test_event("sensors", "sensor-overflow"))
+        .await
+        .unwrap_err();
+    let full = err.downcast_ref::<StreamFullError>().unwrap();
+    assert_eq!(full.messages, 3);
+    assert_eq!(full.max_messages, 3);
+
+    assert_eq!(read_all_events(&nats).await.len(), 3);
+}
+
+#[tokio::test]
+async fn test_publisher_counts_own_publishes_against_limit() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let publisher =
+        EventPublisher::new(client.jetstream().clone()).with_max_stream_depth("FLUX_EVENTS", 2);
+
+    publisher.publish(&test_event("sensors", "a")).await.unwrap();
+    publisher.publish(&test_event("sensors", "b")).await.unwrap();
+    // Cached depth is still fresh, but includes our own publishes
+    assert!(publisher.publish(&test_event("sensors", "c")).await.is_err());
+}
+
+#[tokio::test]
+async fn test_priority_filtered_consumer_sees_only_flagged_events() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    let normal = test_event("alarms", "plc-01");
+    let mut high = test_event("alarms", "plc-02");
+    high.priority = Some(Priority::High);
+    let mut critical = test_event("alarms", "plc-03");
+    critical.priority = Some(Priority::Critical);
+    for event in [&normal, &high, &critical] {
+        publisher.publish(event).await.unwrap();
+    }
+
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let consumer = stream
+        .create_consumer(async_nats::jetstream::consumer::pull::OrderedConfig {
+            filter_subject: high_priority_subject("alarms"),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut seen = Vec::new();
+    while let Ok(Some(Ok(msg))) =
+        tokio::time::timeout(std::time::Duration::from_millis(200), messages.next()).await
+    {
+        let priority = msg.headers.as_ref().and_then(|h| h.get(PRIORITY_HEADER)).unwrap();
+        assert_ne!(priority.as_str(), "normal");
+        let event: FluxEvent = serde_json::from_slice(&msg.payload).unwrap();
+        seen.push(event.event_id);
+    }
+    assert_eq!(seen, vec![high.event_id, critical.event_id]);
+
+    // The full stream still contains every event
+    assert_eq!(read_all_events(&nats).await.len(), 3);
+}
+
+#[tokio::test]
+async fn test_publisher_records_ingest_lag() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let lag = LagMetrics::new();
+    let publisher = EventPublisher::new(client.jetstream().clone()).with_lag_metrics(lag.clone());
+
+    // Backdate by 2 minutes: lands above the 60s bucket, within 300s
+    let mut event = test_event("sensors", "sensor-01");
+    event.timestamp -= 120_000;
+    publisher.publish(&event).await.unwrap();
+
+    let snap = &lag.ingest_snapshot()["sensors"];
+    assert_eq!(snap.count, 1);
+    let le = |bound: f64| snap.buckets.iter().find(|(b, _)| *b == bound).unwrap().1;
+    assert_eq!(le(60.0), 0);
+    assert_eq!(le(300.0), 1);
+    assert_eq!(snap.negative, 0);
+}
+
+#[tokio::test]
+async fn test_publisher_counts_publishes_by_stream() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let now = 1_707_668_400_000;
+    let publishes = PublishMetrics::new();
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_clock(FakeClock::at_millis(now))
+        .with_publish_metrics(publishes.clone());
+
+    for i in 0..4 {
+        let event = test_event("sensors", &format!("sensor-{:02}", i));
+        publisher.publish(&event).await.unwrap();
+    }
+    publisher.publish(&test_event("alarms", "alarm-01")).await.unwrap();
+    // Dry runs are not publishes
+    let dry_run = publisher.clone().with_dry_run(true);
+    dry_run.publish(&test_event("alarms", "alarm-02")).await.unwrap();
+
+    assert_eq!(publishes.count("sensors"), 4);
+    assert_eq!(publishes.count("alarms"), 1);
+    let window = std::time::Duration::from_secs(2);
+    assert_eq!(publishes.rate("sensors", window, now), 2.0);
+    assert_eq!(publishes.rate("sensors", window, now + 10_000), 0.0);
+}
+
+#[tokio::test]
+async fn test_compressed_and_plain_events_decode_from_same_stream() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let storage = StorageMetrics::new();
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_compression(1024)
+        .with_storage_metrics(storage.clone());
+
+    // Verbose SCADA-style payload, well above the threshold
+    let mut large = test_event("scada", "plc-01");
+    large.payload["properties"] = serde_json::Value::Object(
+        (0..200)
+            .map(|i| (format!("line1.pump{}.pressure", i), json!("good")))
+            .collect(),
+    );
+    let small = test_event("scada", "plc-02");
+
+    publisher.publish(&large).await.unwrap();
+    publisher.publish(&small).await.unwrap();
+
+    // Only the large event carries Content-Encoding
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let first = stream.get_raw_message(1).await.unwrap();
+    assert_eq!(
+        first.headers.get(CONTENT_ENCODING_HEADER).unwrap().as_str(),
+        GZIP_ENCODING
+    );
+    let second = stream.get_raw_message(2).await.unwrap();
+    assert!(second.headers.get(CONTENT_ENCODING_HEADER).is_none());
+
+    let events = read_all_events(&nats).await;
+    assert_eq!(events.len(), 2);
+    assert_eq!(events[0].payload, large.payload);
+    assert_eq!(events[1].payload, small.payload);
+
+    let snap = storage.snapshot();
+    assert_eq!(snap.events, 2);
+    assert_eq!(snap.compressed_events, 1);
+    assert!(snap.stored_bytes < snap.raw_bytes);
+}
+
+#[tokio::test]
+async fn test_json_and_protobuf_events_decode_from_same_stream() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let json_publisher = EventPublisher::new(client.jetstream().clone());
+    let proto_publisher =
+        EventPublisher::new(client.jetstream().clone()).with_encoding(EventEncoding::Protobuf);
+
+    let mut first = test_event("sensors", "sensor-01");
+    first.priority = Some(Priority::High);
+    let second = test_event("sensors", "sensor-02");
+    json_publisher.publish(&first).await.unwrap();
+    proto_publisher.publish(&second).await.unwrap();
+
+    // Only the protobuf event carries Content-Type
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let raw = stream.get_raw_message(1).await.unwrap();
+    assert!(raw.headers.get(CONTENT_TYPE_HEADER).is_none());
+    let raw = stream.get_raw_message(2).await.unwrap();
+    assert_eq!(
+        raw.headers.get(CONTENT_TYPE_HEADER).unwrap().as_str(),
+        PROTOBUF_CONTENT_TYPE
+    );
+
+    let events = read_all_events(&nats).await;
+    assert_eq!(events.len(), 2);
+    assert_eq!(events[0].event_id, first.event_id);
+    assert_eq!(events[0].priority, Some(Priority::High));
+    assert_eq!(events[1].event_id, second.event_id);
+    assert_eq!(events[1].timestamp, second.timestamp);
+    assert_eq!(events[1].payload, second.payload);
+
+    // Protobuf stores the payload as it arrived, not re-serialized
+    let payload = r#"{"zone": "b", "entity_id": "sensor-03", "properties": {"t": 22.50}}"#;
+    let body = format!(
+        r#"{{"stream": "sensors", "source": "integration-test", "timestamp": 1, "payload": {}}}"#,
+        payload
+    );
+    let mut third = FluxEvent::from_json_slice(body.as_bytes()).unwrap();
+    third.validate_and_prepare().unwrap();
+    proto_publisher.publish(&third).await.unwrap();
+    let raw = stream.get_raw_message(3).await.unwrap();
+    let stored = decode_event(Some(&raw.headers), &raw.payload).unwrap();
+    assert_eq!(stored.raw_payload.unwrap().get(), payload);
+}
+
+#[tokio::test]
+async fn test_sampling_publishes_every_nth_event() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_sampling("vibration", Sampler::every_nth(10));
+
+    for i in 0..20 {
+        publisher
+            .publish(&test_event("vibration", &format!("motor-{}", i)))
+            .await
+            .unwrap();
+    }
+    // Other streams are not sampled
+    publisher.publish(&test_event("sensors", "sensor-01")).await.unwrap();
+
+    let events = read_all_events(&nats).await;
+    let ids: Vec<_> = events
+        .iter()
+        .map(|e| e.payload["entity_id"].as_str().unwrap())
+        .collect();
+    assert_eq!(ids, vec!["motor-0", "motor-10", "sensor-01"]);
+    assert_eq!(publisher.sampler("vibration").unwrap().dropped_total(), 18);
+}
+
+#[tokio::test]
+async fn test_republish_reaches_core_subscribers() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        republish: Some(RepublishConfig {
+            source: "flux.events.>".to_string(),
+            destination: "live.>".to_string(),
+            headers_only: false,
+        }),
+        ..test_config(&nats)
+    })
+    .await
+    .unwrap();
+    let mut live = client.client().subscribe("live.sensors").await.unwrap();
+    client.client().flush().await.unwrap();
+
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    let event = test_event("sensors", "sensor-01");
+    publisher.publish(&event).await.unwrap();
+
+    let message = tokio::time::timeout(std::time::Duration::from_secs(5), live.next())
+        .await
+        .expect("no republished message")
+        .unwrap();
+    let received = event_from_message(&message).unwrap();
+    assert_eq!(received.event_id, event.event_id);
+    assert_eq!(received.payload["entity_id"], "sensor-01");
+}
+
+#[tokio::test]
+async fn test_republish_into_stream_subjects_is_rejected() {
+    let nats = TestNats::start();
+    let result = NatsClient::connect(NatsConfig {
+        republish: Some(RepublishConfig {
+            source: "flux.events.sensors.>".to_string(),
+            destination: "flux.events.live.>".to_string(),
+            headers_only: false,
+        }),
+        ..test_config(&nats)
+    })
+    .await;
+
+    let err = result.err().expect("looping republish accepted");
+    let loop_err = err.downcast_ref::<RepublishLoopError>().unwrap();
+    assert_eq!(loop_err.stream_subject, "flux.events.>");
+}
+
+#[tokio::test]
+async fn test_wildcard_stream_captures_sub_streams() {
+    let nats = TestNats::start();
+    let subjects = wildcard_subjects("sensor.readings");
+    let client = NatsClient::connect(NatsConfig {
+        stream_subjects: subjects.clone(),
+        ..test_config(&nats)
+    })
+    .await
+    .unwrap();
+    let publisher =
+        EventPublisher::new(client.jetstream().clone()).with_stream_subjects(subjects);
+
+    publisher
+        .publish(&test_event("sensor.readings.zone1", "sensor-01"))
+        .await
+        .unwrap();
+    publisher
+        .publish(&test_event("sensor.readings", "sensor-02"))
+        .await
+        .unwrap();
+
+    let err = publisher
+        .publish(&test_event("alarms", "alarm-01"))
+        .await
+        .unwrap_err();
+    let not_captured = err.downcast_ref::<SubjectNotCapturedError>().unwrap();
+    assert_eq!(not_captured.subject, "flux.events.alarms");
+
+    let streams: Vec<_> = read_all_events(&nats)
+        .await
+        .into_iter()
+        .map(|e| e.stream)
+        .collect();
+    assert_eq!(streams, vec!["sensor.readings.zone1", "sensor.readings"]);
+}
+
+#[tokio::test]
+async fn test_idempotency_cache_returns_original_sequence() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone()).with_idempotency_cache(100);
+    let event = test_event("sensors", "sensor-01");
+    let other = test_event("sensors", "sensor-02");
+
+    let first = publisher
+        .publish_with_ack(&event, DEFAULT_PUBLISH_TIMEOUT)
+        .await
+        .unwrap()
+        .unwrap();
+    publisher.publish(&other).await.unwrap();
+    // A retry, e.g. after the first ack timed out on the producer side
+    let retry = publisher
+        .clone()
+        .publish_with_ack(&event, DEFAULT_PUBLISH_TIMEOUT)
+        .await
+        .unwrap()
+        .unwrap();
+
+    assert_eq!(
+        first,
+        PublishAck {
+            sequence: 1,
+            cached: false
+        }
+    );
+    assert_eq!(
+        retry,
+        PublishAck {
+            sequence: 1,
+            cached: true
+        }
+    );
+    assert_eq!(read_all_events(&nats).await.len(), 2);
+}
+
+#[tokio::test]
+async fn test_failures_are_typed_errors() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+
+    // No stream captures the subject, so JetStream has no responders
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_subject_mapping(|_| "uncaptured.sensors".to_string());
+    let err = publisher
+        .publish(&test_event("sensors", "sensor-01"))
+        .await
+        .unwrap_err();
+    let publish = err.downcast_ref::<PublishError>().unwrap();
+    assert_eq!(publish.subject, "uncaptured.sensors");
+
+    // A message not written by Flux does not decode
+    client
+        .jetstream()
+        .publish("flux.events.raw", "not json".into())
+        .await
+        .unwrap()
+        .await
+        .unwrap();
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let raw = stream.get_raw_message(1).await.unwrap();
+    let err = decode_event(Some(&raw.headers), &raw.payload).unwrap_err();
+    assert!(err.downcast_ref::<SerializationError>().is_some());
+
+    js.delete_stream("FLUX_EVENTS").await.unwrap();
+    let err = client.diff_stream_config().await.unwrap_err();
+    let not_found = err.downcast_ref::<StreamNotFoundError>().unwrap();
+    assert_eq!(not_found.stream, "FLUX_EVENTS");
+}
+
+#[tokio::test]
+async fn test_concurrent_publishes_from_shared_publisher() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(test_config(&nats)).await.unwrap();
+    let storage = StorageMetrics::new();
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_max_stream_depth("FLUX_EVENTS", 10_000)
+        .with_idempotency_cache(1000)
+        .with_storage_metrics(storage.clone());
+
+    // 50 tasks x 4 events over a handful of streams, all sharing one publisher
+    let tasks: Vec<_> = (0..50)
+        .map(|task| {
+            let publisher = publisher.clone();
+            tokio::spawn(async move {
+                let mut sequences = Vec::new();
+                for i in 0..4 {
+                    let event = test_event(&format!("stress.s{}", (task + i) % 5), "sensor-01");
+                    let ack = publisher
+                        .publish_with_ack(&event, DEFAULT_PUBLISH_TIMEOUT)
+                        .await
+                        .unwrap()
+                        .unwrap();
+                    assert!(!ack.cached);
+                    sequences.push(ack.sequence);
+                }
+                sequences
+            })
+        })
+        .collect();
+    let mut sequences = Vec::new();
+    for task in tasks {
+        sequences.extend(task.await.unwrap());
+    }
+
+    // Every publish got its own sequence and nothing was lost
+    sequences.sort_unstable();
+    assert_eq!(sequences, (1..=200).collect::<Vec<u64>>());
+    assert_eq!(storage.snapshot().events, 200);
+    assert_eq!(read_all_events(&nats).await.len(), 200);
+}
+
+#[tokio::test(flavor = "multi_thread", worker_threads = 4)]
+async fn test_concurrent_stream_initialization_creates_each_once() {
+    let nats = TestNats::start();
+    let client = std::sync::Arc::new(NatsClient::connect(test_config(&nats)).await.unwrap());
+    let stream = |n: usize| async_nats::jetstream::stream::Config {
+        name: format!("STRESS_{}", n),
+        subjects: vec![format!("stress.{}.>", n)],
+        ..Default::default()
+    };
+    let existing = client
+        .jetstream()
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .cached_info()
+        .config
+        .clone();
+
+    // Count creations as the server sees them
+    let nats_client = nats.client().await;
+    let mut advisories = nats_client
+        .subscribe("$JS.EVENT.ADVISORY.STREAM.CREATED.*")
+        .await
+        .unwrap();
+    nats_client.flush().await.unwrap();
+
+    // 50 tasks over 5 new streams, each task asking for two of them plus
+    // FLUX_EVENTS; every other task goes through the batch API
+    let tasks: Vec<_> = (0..50)
+        .map(|task| {
+            let client = std::sync::Arc::clone(&client);
+            let configs = vec![stream(task % 5), existing.clone(), stream((task + 1) % 5)];
+            tokio::spawn(async move {
+                if task % 2 == 0 {
+                    client.initialize_streams(&configs).await
+                } else {
+                    client.create_streams_batch(&configs).await.unwrap();
+                    Vec::new()
+                }
+            })
+        })
+        .collect();
+    let mut created = std::collections::HashMap::new();
+    for task in tasks {
+        for result in task.await.unwrap() {
+            assert_ne!(result.status, StreamInitStatus::Failed, "{:?}", result);
+            if result.status == StreamInitStatus::Created {
+                *created.entry(result.stream).or_insert(0) += 1;
+            }
+        }
+    }
+    assert!(created.values().all(|n| *n == 1), "{:?}", created);
+    assert!(!created.contains_key("FLUX_EVENTS"));
+
+    let mut advised = std::collections::HashMap::new();
+    while let Ok(Some(message)) =
+        tokio::time::timeout(std::time::Duration::from_millis(500), advisories.next()).await
+    {
+        let name = message.subject.rsplit('.').next().unwrap().to_string();
+        *advised.entry(name).or_insert(0) += 1;
+    }
+    let expected: std::collections::HashMap<_, _> =
+        (0..5).map(|n| (format!("STRESS_{}", n), 1)).collect();
+    assert_eq!(advised, expected);
+    for n in 0..5 {
+        assert!(client
+            .jetstream()
+            .get_stream(format!("STRESS_{}", n))
+            .await
+            .is_ok());
+    }
+}
+
+#[tokio::test]
+async fn test_subject_mapping_routes_by_zone() {
+    let nats = TestNats::start();
+    let subjects = wildcard_subjects("sensor.readings");
+    let client = NatsClient::connect(NatsConfig {
+        stream_subjects: subjects.clone(),
+        ..test_config(&nats)
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_stream_subjects(subjects)
+        .with_subject_mapping(|event| match &event.key {
+            Some(zone) => format!("flux.events.{}.{}", event.stream, sanitize_key(zone)),
+            None => format!("flux.events.{}", event.stream),
+        });
+
+    let mut zone1 = test_event("sensor.readings", "sensor-01");
+    zone1.key = Some("Zone1".to_string());
+    let mut zone2 = test_event("sensor.readings", "sensor-02");
+    zone2.key = Some("zone2".to_string());
+    for event in [&zone1, &zone2] {
+        publisher.publish(event).await.unwrap();
+    }
+
+    // A subject the stream does not capture is refused before publishing
+    let mut stray = test_event("alarms", "alarm-01");
+    stray.key = Some("zone1".to_string());
+    assert_eq!(publisher.subject_for(&stray), "flux.events.alarms.zone1");
+    let err = publisher.publish(&stray).await.unwrap_err();
+    assert!(err.downcast_ref::<SubjectNotCapturedError>().is_some());
+
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    for (subject, event) in [
+        ("flux.events.sensor.readings.zone1", &zone1),
+        ("flux.events.sensor.readings.zone2", &zone2),
+    ] {
+        let message = stream.get_last_raw_message_by_subject(subject).await.unwrap();
+        let stored = decode_event(Some(&message.headers), &message.payload).unwrap();
+        assert_eq!(stored.event_id, event.event_id);
+        // The envelope keeps the stream and key as published
+        assert_eq!(stored.stream, "sensor.readings");
+        assert_eq!(stored.key, event.key);
+    }
+}
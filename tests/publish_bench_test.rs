@@ -0,0 +1,255 @@
+// Publish throughput benchmarks and the loadgen runner, against a real
+// JetStream server (see tests/common).
+//
+// The benchmarks are #[ignore]d; run them with
+// `cargo test --release --test publish_bench_test -- --ignored --nocapture`.
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::loadgen::{self, LoadgenConfig};
+use flux::nats::{encode_event, EventEncoding, EventPublisher, NatsClient, NatsConfig};
+use futures::StreamExt;
+use std::alloc::{GlobalAlloc, Layout, System};
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::time::{Duration, Instant};
+
+/// Counts heap allocations so benchmarks can report allocations per event.
+struct CountingAlloc;
+
+static ALLOCATIONS: AtomicU64 = AtomicU64::new(0);
+
+unsafe impl GlobalAlloc for CountingAlloc {
+    unsafe fn alloc(&self, layout: Layout) -> *mut u8 {
+        ALLOCATIONS.fetch_add(1, Ordering::Relaxed);
+        System.alloc(layout)
+    }
+
+    unsafe fn dealloc(&self, ptr: *mut u8, layout: Layout) {
+        System.dealloc(ptr, layout)
+    }
+}
+
+#[global_allocator]
+static GLOBAL: CountingAlloc = CountingAlloc;
+
+const EVENTS: u64 = 5_000;
+const CONCURRENCY: usize = 64;
+
+async fn publisher(nats: &TestNats) -> EventPublisher {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    EventPublisher::new(client.jetstream().clone())
+}
+
+fn events() -> Vec<FluxEvent> {
+    let config = LoadgenConfig::default();
+    (0..EVENTS).map(|seq| config.event(seq).unwrap()).collect()
+}
+
+/// Events/sec and allocations/event for one run of `publish_all`
+async fn measure<F, Fut>(name: &str, publish_all: F) -> f64
+where
+    F: FnOnce() -> Fut,
+    Fut: std::future::Future<Output = ()>,
+{
+    let allocations = ALLOCATIONS.load(Ordering::Relaxed);
+    let start = Instant::now();
+    publish_all().await;
+    let elapsed = start.elapsed();
+    let allocations = ALLOCATIONS.load(Ordering::Relaxed) - allocations;
+
+    let rate = EVENTS as f64 / elapsed.as_secs_f64();
+    println!(
+        "{:>8}: {:>8.0} events/sec, {:>6.1} allocations/event ({} events in {:?})",
+        name,
+        rate,
+        allocations as f64 / EVENTS as f64,
+        EVENTS,
+        elapsed
+    );
+    rate
+}
+
+#[tokio::test]
+#[ignore]
+async fn bench_publish_sync_vs_async() {
+    let nats = TestNats::start();
+    let publisher = publisher(&nats).await;
+    let events = events();
+
+    let sync = measure("sync", || async {
+        for event in &events {
+            publisher.publish(event).await.unwrap();
+        }
+    })
+    .await;
+
+    // Many publishes awaiting their acks at once
+    let concurrent = measure("async", || async {
+        futures::stream::iter(&events)
+            .map(|event| publisher.publish(event))
+            .buffer_unordered(CONCURRENCY)
+            .for_each(|result| async move { result.unwrap() })
+            .await;
+    })
+    .await;
+
+    measure("batch", || async {
+        for result in publisher.publish_batch(&events).await.unwrap() {
+            result.unwrap();
+        }
+    })
+    .await;
+
+    assert!(
+        concurrent > sync,
+        "async publish ({:.0}/s) should outpace sync ({:.0}/s)",
+        concurrent,
+        sync
+    );
+}
+
+/// First publish latency of new publishers (each on a new connection), with
+/// and without `warm_up` before it; the warm-up itself is not timed.
+#[tokio::test]
+#[ignore]
+async fn bench_first_publish_cold_vs_warm() {
+    const RUNS: usize = 20;
+    let nats = TestNats::start();
+    let event = &events()[0];
+
+    let mut cold = Vec::with_capacity(RUNS);
+    let mut warm = Vec::with_capacity(RUNS);
+    for _ in 0..RUNS {
+        let cold_publisher = publisher(&nats)
+            .await
+            .with_stream_cache(Duration::from_secs(60));
+        let start = Instant::now();
+        cold_publisher.publish(event).await.unwrap();
+        cold.push(start.elapsed());
+
+        let warm_publisher = publisher(&nats)
+            .await
+            .with_stream_cache(Duration::from_secs(60));
+        warm_publisher
+            .warm_up(&[event.stream.as_str()])
+            .await
+            .unwrap();
+        let start = Instant::now();
+        warm_publisher.publish(event).await.unwrap();
+        warm.push(start.elapsed());
+    }
+
+    cold.sort();
+    warm.sort();
+    let (cold, warm) = (cold[RUNS / 2], warm[RUNS / 2]);
+    println!("    cold: {:?} median first publish", cold);
+    println!("    warm: {:?} median first publish", warm);
+    assert!(
+        warm < cold,
+        "warmed-up first publish ({:?}) should beat cold ({:?})",
+        warm,
+        cold
+    );
+}
+
+/// Envelope size and encode time of JSON vs protobuf, and the bytes
+/// JetStream stores for the same events in each encoding.
+#[tokio::test]
+#[ignore]
+async fn bench_json_vs_protobuf_size() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let events = events();
+
+    let mut stored = Vec::new();
+    for encoding in [EventEncoding::Json, EventEncoding::Protobuf] {
+        let start = Instant::now();
+        let envelope: usize = events
+            .iter()
+            .map(|event| encode_event(event, encoding, None).unwrap().raw_len)
+            .sum();
+        let elapsed = start.elapsed();
+
+        let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+        stream.purge().await.unwrap();
+        let publisher = EventPublisher::new(client.jetstream().clone()).with_encoding(encoding);
+        for result in publisher.publish_batch(&events).await.unwrap() {
+            result.unwrap();
+        }
+        let bytes = stream.info().await.unwrap().state.bytes;
+
+        println!(
+            "{:>8}: {:>6.1} envelope bytes/event, {:>6.1} stored bytes/event, {:?}/event to encode",
+            format!("{:?}", encoding),
+            envelope as f64 / EVENTS as f64,
+            bytes as f64 / EVENTS as f64,
+            elapsed / EVENTS as u32
+        );
+        stored.push(bytes);
+    }
+
+    assert!(
+        stored[1] < stored[0],
+        "protobuf stored {} bytes, json {}",
+        stored[1],
+        stored[0]
+    );
+}
+
+#[tokio::test]
+async fn test_loadgen_publishes_at_rate_and_drains() {
+    let nats = TestNats::start();
+    let config = LoadgenConfig {
+        stream: "loadgen".to_string(),
+        rate: 200,
+        payload_bytes: 64,
+        keys: 5,
+        duration: Some(Duration::from_secs(1)),
+        max_in_flight: 32,
+    };
+
+    let report = loadgen::run(publisher(&nats).await, &config, std::future::pending())
+        .await
+        .unwrap();
+
+    assert_eq!(report.failed, 0);
+    assert!(
+        (150..=220).contains(&report.published),
+        "published {} events",
+        report.published
+    );
+    let latency = report.latency.as_ref().unwrap();
+    assert_eq!(latency.count, report.published);
+    assert!(report.to_string().contains("events/sec"));
+}
+
+#[tokio::test]
+async fn test_loadgen_stops_on_shutdown() {
+    let nats = TestNats::start();
+    let config = LoadgenConfig {
+        duration: None,
+        ..Default::default()
+    };
+
+    let start = Instant::now();
+    let shutdown = tokio::time::sleep(Duration::from_millis(300));
+    let report = loadgen::run(publisher(&nats).await, &config, shutdown)
+        .await
+        .unwrap();
+
+    assert!(start.elapsed() < Duration::from_secs(5));
+    assert_eq!(report.failed, 0);
+    assert!(report.published > 0);
+}
@@ -0,0 +1,91 @@
+// Integration tests for per-publish deadlines, against a mock server that
+// accepts publishes but never acknowledges them, and a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{EventPublisher, NatsClient, NatsConfig, PublishTimeoutError};
+use serde_json::json;
+use std::time::{Duration, Instant};
+use tokio::io::{AsyncBufReadExt, AsyncWriteExt, BufReader};
+use tokio::net::TcpListener;
+
+/// Minimal NATS server that completes the handshake and answers PINGs but
+/// drops every publish, so JetStream acks never arrive.
+async fn silent_nats() -> String {
+    let listener = TcpListener::bind("127.0.0.1:0").await.unwrap();
+    let addr = listener.local_addr().unwrap();
+    tokio::spawn(async move {
+        while let Ok((socket, _)) = listener.accept().await {
+            tokio::spawn(async move {
+                let (reader, mut writer) = socket.into_split();
+                let info = b"INFO {\"server_id\":\"mock\",\"version\":\"2.10.0\",\"proto\":1,\"headers\":true,\"max_payload\":1048576}\r\n";
+                if writer.write_all(info).await.is_err() {
+                    return;
+                }
+                let mut lines = BufReader::new(reader).lines();
+                while let Ok(Some(line)) = lines.next_line().await {
+                    if line.starts_with("PING") && writer.write_all(b"PONG\r\n").await.is_err() {
+                        return;
+                    }
+                }
+            });
+        }
+    });
+    format!("nats://{}", addr)
+}
+
+fn alarm() -> FluxEvent {
+    FluxEvent::builder("alarms")
+        .source("plc-01")
+        .payload(json!({"entity_id": "boiler-1", "properties": {"raised": true}}))
+        .must_build()
+}
+
+#[tokio::test]
+async fn test_short_timeout_on_slow_server() {
+    let client = async_nats::connect(silent_nats().await).await.unwrap();
+    let publisher = EventPublisher::new(async_nats::jetstream::new(client));
+
+    let started = Instant::now();
+    let err = publisher
+        .publish_with_timeout(&alarm(), Duration::from_millis(1))
+        .await
+        .unwrap_err();
+    assert!(started.elapsed() < Duration::from_secs(1));
+
+    let timeout = err.downcast_ref::<PublishTimeoutError>().unwrap();
+    assert_eq!(timeout.subject, "flux.events.alarms");
+    assert_eq!(timeout.timeout, Duration::from_millis(1));
+}
+
+#[tokio::test]
+async fn test_publish_uses_configured_timeout() {
+    let client = async_nats::connect(silent_nats().await).await.unwrap();
+    let publisher = EventPublisher::new(async_nats::jetstream::new(client))
+        .with_publish_timeout(Duration::from_millis(50));
+
+    let err = publisher.publish(&alarm()).await.unwrap_err();
+    assert_eq!(
+        err.downcast_ref::<PublishTimeoutError>().unwrap().timeout,
+        Duration::from_millis(50)
+    );
+}
+
+#[tokio::test]
+async fn test_publish_within_timeout_succeeds() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+
+    EventPublisher::new(client.jetstream().clone())
+        .publish_with_timeout(&alarm(), Duration::from_secs(5))
+        .await
+        .unwrap();
+}
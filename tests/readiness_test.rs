@@ -0,0 +1,104 @@
+// Tests for lazy startup: the readiness router answers before NATS is up and
+// switches to the API once the (retrying) connection succeeds.
+
+mod common;
+
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+    routing::get,
+    Router,
+};
+use common::{free_port, TestNats};
+use flux::api::Readiness;
+use flux::nats::{NatsClient, NatsConfig};
+use serde_json::Value;
+use std::time::Duration;
+use tower::ServiceExt;
+
+async fn get_json(router: &Router, uri: &str) -> (StatusCode, Value) {
+    let response = router
+        .clone()
+        .oneshot(Request::get(uri).body(Body::empty()).unwrap())
+        .await
+        .unwrap();
+    let status = response.status();
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    (status, serde_json::from_slice(&body).unwrap_or(Value::Null))
+}
+
+fn api() -> Router {
+    Router::new().route("/api/ping", get(|| async { "pong" }))
+}
+
+#[tokio::test]
+async fn test_not_ready_before_nats() {
+    let readiness = Readiness::new();
+    let router = readiness.router();
+
+    let (status, body) = get_json(&router, "/healthz").await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(body["status"], "ok");
+
+    let (status, body) = get_json(&router, "/readyz").await;
+    assert_eq!(status, StatusCode::SERVICE_UNAVAILABLE);
+    assert_eq!(body["status"], "not_ready");
+
+    let response = router
+        .clone()
+        .oneshot(
+            Request::post("/api/events")
+                .header("content-type", "application/json")
+                .body(Body::from("{}"))
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::SERVICE_UNAVAILABLE);
+    assert_eq!(response.headers()["retry-after"], "5");
+    assert!(readiness.check().is_err());
+}
+
+#[tokio::test]
+async fn test_becomes_ready_when_nats_appears() {
+    let port = free_port();
+    let readiness = Readiness::new();
+    let router = readiness.router();
+
+    let connecting = {
+        let readiness = readiness.clone();
+        tokio::spawn(async move {
+            let client = NatsClient::connect_with_retry(NatsConfig {
+                url: format!("nats://127.0.0.1:{}", port),
+                ..Default::default()
+            })
+            .await;
+            readiness.set_ready(api(), &client);
+            client
+        })
+    };
+
+    // NATS is down: the service keeps retrying and stays not ready
+    tokio::time::sleep(Duration::from_millis(1500)).await;
+    assert!(!connecting.is_finished());
+    let (status, _) = get_json(&router, "/api/ping").await;
+    assert_eq!(status, StatusCode::SERVICE_UNAVAILABLE);
+
+    let _nats = TestNats::start_on_port(port);
+    let _client = tokio::time::timeout(Duration::from_secs(40), connecting)
+        .await
+        .expect("never connected")
+        .unwrap();
+
+    let (status, body) = get_json(&router, "/readyz").await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(body["status"], "ready");
+    let response = router
+        .clone()
+        .oneshot(Request::get("/api/ping").body(Body::empty()).unwrap())
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+}
@@ -0,0 +1,143 @@
+// Integration tests for ReceivedEvent (delivery metadata and headers handed
+// to consumers) against a real JetStream server (see tests/common).
+
+mod common;
+
+use anyhow::anyhow;
+use async_nats::jetstream::consumer;
+use common::TestNats;
+use flux::event::{FluxEvent, Priority};
+use flux::nats::{
+    EventPublisher, ExactlyOnce, Handled, NatsClient, NatsConfig, ReceivedEvent, TRACEPARENT_HEADER,
+};
+use futures::StreamExt;
+use serde_json::json;
+use std::sync::{Arc, Mutex};
+
+const TRACE_PARENT: &str = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01";
+
+fn alarm() -> FluxEvent {
+    FluxEvent::builder("alarms")
+        .source("plc-01")
+        .priority(Priority::High)
+        .payload(json!({"entity_id": "alarm-1", "properties": {"level": "high"}}))
+        .must_build()
+}
+
+async fn setup(nats: &TestNats) -> (NatsClient, consumer::PullConsumer, ExactlyOnce) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let consumer = client
+        .jetstream()
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .create_consumer(consumer::pull::Config {
+            durable_name: Some("alarm-sink".to_string()),
+            ack_policy: consumer::AckPolicy::Explicit,
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    let exactly_once = ExactlyOnce::open(
+        client.jetstream(),
+        "ALARM_SINK_PROCESSED",
+        "FLUX_EVENTS",
+        None,
+    )
+    .await
+    .unwrap();
+    (client, consumer, exactly_once)
+}
+
+#[tokio::test]
+async fn test_delivery_count_and_publisher_headers() {
+    let nats = TestNats::start();
+    let (client, consumer, exactly_once) = setup(&nats).await;
+    let event = alarm();
+    EventPublisher::new(client.jetstream().clone())
+        .with_compression(1)
+        .publish(&event)
+        .await
+        .unwrap();
+
+    let seen: Arc<Mutex<Vec<ReceivedEvent>>> = Arc::default();
+    let mut messages = consumer.messages().await.unwrap();
+    for fail in [true, false] {
+        let message = messages.next().await.unwrap().unwrap();
+        let seen = Arc::clone(&seen);
+        let result = exactly_once
+            .handle(message, |received| async move {
+                seen.lock().unwrap().push(received);
+                if fail {
+                    Err(anyhow!("sink unavailable"))
+                } else {
+                    Ok(())
+                }
+            })
+            .await;
+        assert_eq!(result.is_ok(), !fail);
+    }
+
+    let seen = seen.lock().unwrap();
+    assert_eq!(seen.len(), 2);
+    assert_eq!(seen[0].meta.delivered, 1);
+    assert_eq!(seen[1].meta.delivered, 2);
+    assert!(seen[1].is_redelivery());
+    for received in seen.iter() {
+        assert_eq!(received.event.event_id, event.event_id);
+        assert_eq!(received.meta.stream_sequence, 1);
+        assert_eq!(received.meta.subject, "flux.events.alarms.p.high");
+        assert!(received.meta.stored_at > 0);
+        assert_eq!(received.priority(), Some("high"));
+        assert_eq!(received.content_encoding(), Some("gzip"));
+        assert_eq!(received.content_type(), None);
+    }
+    assert_eq!(seen[1].meta.consumer_sequence, 2);
+}
+
+#[tokio::test]
+async fn test_producer_trace_header_passes_through() {
+    let nats = TestNats::start();
+    let (client, consumer, exactly_once) = setup(&nats).await;
+    let mut headers = async_nats::HeaderMap::new();
+    headers.insert(TRACEPARENT_HEADER, TRACE_PARENT);
+    client
+        .jetstream()
+        .publish_with_headers(
+            "flux.events.alarms",
+            headers,
+            serde_json::to_vec(&alarm()).unwrap().into(),
+        )
+        .await
+        .unwrap()
+        .await
+        .unwrap();
+
+    let trace = Arc::new(Mutex::new(None));
+    let message = consumer
+        .messages()
+        .await
+        .unwrap()
+        .next()
+        .await
+        .unwrap()
+        .unwrap();
+    let handled = exactly_once
+        .handle(message, |received| {
+            let trace = Arc::clone(&trace);
+            async move {
+                *trace.lock().unwrap() = received.trace_parent().map(str::to_string);
+                Ok(())
+            }
+        })
+        .await
+        .unwrap();
+
+    assert_eq!(handled, Handled::Processed);
+    assert_eq!(trace.lock().unwrap().as_deref(), Some(TRACE_PARENT));
+}
@@ -0,0 +1,162 @@
+// Integration tests for the stream reconciler against a real JetStream
+// server (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::{kv, stream};
+use axum::body::Body;
+use axum::http::{Request, StatusCode};
+use common::TestNats;
+use flux::api::{create_reconcile_router, ReconcileAppState};
+use flux::nats::{NatsClient, NatsConfig, Reconciler, StreamInitStatus};
+use std::sync::Arc;
+use tower::ServiceExt;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+/// FLUX_EVENTS with a message limit (safe to apply) and memory storage (not)
+/// that the live stream lacks, plus an ORDERS stream it does not have.
+fn declared(nats: &TestNats) -> Vec<stream::Config> {
+    let mut events = NatsConfig {
+        url: nats.url.clone(),
+        max_msgs: Some(1000),
+        ..Default::default()
+    }
+    .stream_config();
+    events.storage = stream::StorageType::Memory;
+    let orders = stream::Config {
+        name: "ORDERS".to_string(),
+        subjects: vec!["orders.>".to_string()],
+        ..Default::default()
+    };
+    vec![events, orders]
+}
+
+/// An undeclared stream and a KV bucket (whose stream is never reported)
+async fn create_unmanaged(client: &NatsClient) {
+    let js = client.jetstream();
+    js.create_stream(stream::Config {
+        name: "LEGACY".to_string(),
+        subjects: vec!["legacy.>".to_string()],
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    js.create_key_value(kv::Config {
+        bucket: "settings".to_string(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+}
+
+async fn stream_config(client: &NatsClient, name: &str) -> stream::Config {
+    let mut stream = client.jetstream().get_stream(name).await.unwrap();
+    stream.info().await.unwrap().config.clone()
+}
+
+#[tokio::test]
+async fn test_report_then_apply_safe_changes() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    create_unmanaged(&client).await;
+    let reconciler = Reconciler::new(client.jetstream().clone(), declared(&nats));
+
+    let report = reconciler.report().await.unwrap();
+    assert_eq!(report.missing, vec!["ORDERS"]);
+    assert_eq!(report.unmanaged, vec!["LEGACY"]);
+    assert_eq!(report.drifted.len(), 1);
+    let drift = &report.drifted[0];
+    assert_eq!(drift.stream, "FLUX_EVENTS");
+    let fields: Vec<_> = drift.changes.iter().map(|change| change.field).collect();
+    assert_eq!(fields, vec!["max_messages", "storage"]);
+    assert_eq!(drift.unsafe_fields(), vec!["storage"]);
+    assert!(report.applied.is_empty());
+    // Reporting changes nothing
+    assert!(client.jetstream().get_stream("ORDERS").await.is_err());
+
+    let report = reconciler.apply().await.unwrap();
+    let applied: Vec<_> = report
+        .applied
+        .iter()
+        .map(|result| (result.stream.as_str(), result.status))
+        .collect();
+    assert_eq!(
+        applied,
+        vec![
+            ("ORDERS", StreamInitStatus::Created),
+            ("FLUX_EVENTS", StreamInitStatus::Reconciled)
+        ]
+    );
+    assert_eq!(
+        stream_config(&client, "ORDERS").await.subjects,
+        vec!["orders.>"]
+    );
+    let events = stream_config(&client, "FLUX_EVENTS").await;
+    assert_eq!(events.max_messages, 1000);
+    // Storage is reported but never changed
+    assert_eq!(events.storage, stream::StorageType::File);
+    assert_eq!(
+        stream_config(&client, "LEGACY").await.subjects,
+        vec!["legacy.>"]
+    );
+
+    let report = reconciler.report().await.unwrap();
+    assert!(report.missing.is_empty());
+    assert_eq!(report.drifted.len(), 1);
+    assert_eq!(report.drifted[0].changes.len(), 1);
+    assert_eq!(report.drifted[0].changes[0].field, "storage");
+    assert!(!report.in_sync());
+}
+
+#[tokio::test]
+async fn test_reconcile_api_apply_requires_flag() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    create_unmanaged(&client).await;
+    let reconciler = Arc::new(
+        Reconciler::new(client.jetstream().clone(), declared(&nats)).with_managed("LEGACY"),
+    );
+    let request = |method: &str| {
+        Request::builder()
+            .method(method)
+            .uri("/api/admin/reconcile")
+            .body(Body::empty())
+            .unwrap()
+    };
+
+    let router = create_reconcile_router(ReconcileAppState {
+        reconciler: Arc::clone(&reconciler),
+        apply_enabled: false,
+        admin_token: None,
+    });
+    let response = router.clone().oneshot(request("GET")).await.unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let report: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(report["missing"], serde_json::json!(["ORDERS"]));
+    // Streams Flux manages itself are not unmanaged
+    assert_eq!(report["unmanaged"], serde_json::json!([]));
+
+    let response = router.oneshot(request("POST")).await.unwrap();
+    assert_eq!(response.status(), StatusCode::FORBIDDEN);
+    assert!(client.jetstream().get_stream("ORDERS").await.is_err());
+
+    let router = create_reconcile_router(ReconcileAppState {
+        reconciler,
+        apply_enabled: true,
+        admin_token: None,
+    });
+    let response = router.oneshot(request("POST")).await.unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    assert!(client.jetstream().get_stream("ORDERS").await.is_ok());
+}
@@ -0,0 +1,123 @@
+// Integration test for reconnect catch-up against a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{decode_event, EventPublisher, NatsClient, NatsConfig, ALERT_STREAM};
+use flux::state::{ReconnectRecovery, RecoveryOutcome, StateEngine};
+use serde_json::json;
+use std::sync::Arc;
+
+fn reading(entity_id: &str, value: i64) -> FluxEvent {
+    FluxEvent::builder("sensors")
+        .source("reconnect-test")
+        .payload(json!({"entity_id": entity_id, "properties": {"value": value}}))
+        .must_build()
+}
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+#[tokio::test]
+async fn test_small_gap_replayed_from_stream() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    let engine = Arc::new(StateEngine::new());
+    engine.set_live();
+
+    // Engine saw the first event before the disconnect
+    publisher.publish(&reading("sensor-01", 1)).await.unwrap();
+    engine.apply_at_sequence(1, &reading("sensor-01", 1));
+    // Stored while disconnected
+    publisher.publish(&reading("sensor-01", 2)).await.unwrap();
+    publisher.publish(&reading("sensor-02", 7)).await.unwrap();
+
+    let recovery = ReconnectRecovery::new(
+        client.jetstream().clone(),
+        "FLUX_EVENTS",
+        Arc::clone(&engine),
+        100,
+    );
+    assert_eq!(
+        recovery.recover().await.unwrap(),
+        RecoveryOutcome::Replayed {
+            from: 2,
+            to: 3,
+            applied: 2
+        }
+    );
+    assert_eq!(engine.get_last_processed_sequence(), 3);
+    let entity = engine.get_entity("sensor-01").unwrap();
+    assert_eq!(entity.properties.get("value").unwrap(), &json!(2));
+    assert!(engine.get_entity("sensor-02").is_some());
+
+    // Nothing left to do
+    assert_eq!(recovery.recover().await.unwrap(), RecoveryOutcome::UpToDate);
+}
+
+#[tokio::test]
+async fn test_large_gap_skipped_with_alert() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    let engine = Arc::new(StateEngine::new());
+    engine.set_live();
+
+    for i in 0..5 {
+        publisher.publish(&reading("sensor-01", i)).await.unwrap();
+    }
+
+    let recovery = ReconnectRecovery::new(
+        client.jetstream().clone(),
+        "FLUX_EVENTS",
+        Arc::clone(&engine),
+        3,
+    )
+    .with_alerts(publisher.clone());
+    assert_eq!(
+        recovery.recover().await.unwrap(),
+        RecoveryOutcome::Skipped { gap: 5 }
+    );
+    assert!(engine.get_entity("sensor-01").is_none());
+
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let alert = stream.get_raw_message(6).await.unwrap();
+    let event = decode_event(Some(&alert.headers), &alert.payload).unwrap();
+    assert_eq!(event.stream, ALERT_STREAM);
+    assert_eq!(event.payload["properties"]["alert"], "reconnect_gap");
+    assert_eq!(event.payload["properties"]["gap"], 5);
+}
+
+#[tokio::test]
+async fn test_no_catch_up_during_startup_replay() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&reading("sensor-01", 1))
+        .await
+        .unwrap();
+
+    // Engine has not finished its startup replay
+    let engine = Arc::new(StateEngine::new());
+    let recovery = ReconnectRecovery::new(
+        client.jetstream().clone(),
+        "FLUX_EVENTS",
+        Arc::clone(&engine),
+        100,
+    );
+    assert_eq!(
+        recovery.recover().await.unwrap(),
+        RecoveryOutcome::Replaying
+    );
+    assert_eq!(engine.get_last_processed_sequence(), 0);
+}
@@ -0,0 +1,105 @@
+// Integration tests for resume-token paging against a real JetStream server
+// (see tests/common). Each page uses a fresh connection, as a batch job
+// resuming in a new process would.
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{fetch_page, EventPublisher, InvalidTokenError, NatsClient, NatsConfig};
+use serde_json::json;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+async fn publish(nats: &TestNats, range: std::ops::Range<u32>) {
+    let client = connect(nats).await;
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    for n in range {
+        let event = FluxEvent::builder("batch.input")
+            .source("resume-test")
+            .payload(json!({"entity_id": "row", "properties": {"n": n}}))
+            .must_build();
+        publisher.publish(&event).await.unwrap();
+    }
+}
+
+/// Fetch one page over a new connection; returns the `n` values and the next token
+async fn page(nats: &TestNats, token: Option<&str>, limit: usize) -> (Vec<u64>, Vec<u64>, String) {
+    let client = connect(nats).await;
+    let page = fetch_page(client.jetstream(), "FLUX_EVENTS", token, limit)
+        .await
+        .unwrap();
+    let sequences = page.events.iter().map(|e| e.sequence).collect();
+    let values = page
+        .events
+        .iter()
+        .map(|e| e.event.payload["properties"]["n"].as_u64().unwrap())
+        .collect();
+    (sequences, values, page.token)
+}
+
+#[tokio::test]
+async fn test_pages_resume_exactly_across_connections() {
+    let nats = TestNats::start();
+    publish(&nats, 0..25).await;
+
+    let mut token: Option<String> = None;
+    let mut sequences = Vec::new();
+    let mut values = Vec::new();
+    let mut sizes = Vec::new();
+    loop {
+        let (page_sequences, page_values, next) = page(&nats, token.as_deref(), 10).await;
+        if page_values.is_empty() {
+            // Caught up: the token does not move
+            assert_eq!(token.as_deref(), Some(next.as_str()));
+            break;
+        }
+        sizes.push(page_values.len());
+        sequences.extend(page_sequences);
+        values.extend(page_values);
+        token = Some(next);
+    }
+
+    assert_eq!(sizes, vec![10, 10, 5]);
+    assert_eq!(sequences, (1..=25).collect::<Vec<u64>>());
+    assert_eq!(values, (0..25).collect::<Vec<u64>>());
+
+    // New events after catching up continue from the same token
+    publish(&nats, 25..28).await;
+    let (sequences, values, _) = page(&nats, token.as_deref(), 10).await;
+    assert_eq!(sequences, vec![26, 27, 28]);
+    assert_eq!(values, vec![25, 26, 27]);
+}
+
+#[tokio::test]
+async fn test_token_fails_after_stream_recreated() {
+    let nats = TestNats::start();
+    publish(&nats, 0..3).await;
+    let (_, _, token) = page(&nats, None, 2).await;
+
+    let client = connect(&nats).await;
+    client
+        .jetstream()
+        .delete_stream("FLUX_EVENTS")
+        .await
+        .unwrap();
+    publish(&nats, 0..3).await; // connect() recreates the stream
+
+    let err = fetch_page(client.jetstream(), "FLUX_EVENTS", Some(&token), 10)
+        .await
+        .unwrap_err();
+    let invalid = err.downcast_ref::<InvalidTokenError>().unwrap();
+    assert!(invalid.reason.contains("recreated"));
+
+    let err = fetch_page(client.jetstream(), "FLUX_EVENTS", Some("garbage!"), 10)
+        .await
+        .unwrap_err();
+    assert!(err.downcast_ref::<InvalidTokenError>().is_some());
+}
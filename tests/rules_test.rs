@@ -0,0 +1,162 @@
+// Integration tests for stream derivation rules against a real JetStream
+// server (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::consumer;
+use axum::body::Body;
+use axum::http::{Request, StatusCode};
+use common::TestNats;
+use flux::api::{create_rule_router, RuleAppState};
+use flux::event::FluxEvent;
+use flux::nats::{stream_subject, EventPublisher, NatsClient, NatsConfig, ReceivedEvent};
+use flux::rules::{RuleEngine, CAUSATION_HEADER, RULE_HEADER};
+use futures::StreamExt;
+use serde_json::{json, Value};
+use std::sync::Arc;
+use std::time::Duration;
+use tower::ServiceExt;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+async fn open_engine(client: &NatsClient) -> Arc<RuleEngine> {
+    Arc::new(
+        RuleEngine::open(
+            client.jetstream().clone(),
+            "FLUX_EVENTS",
+            EventPublisher::new(client.jetstream().clone()),
+        )
+        .await
+        .unwrap(),
+    )
+}
+
+async fn send(router: &axum::Router, method: &str, uri: &str, body: Option<Value>) -> StatusCode {
+    let request = Request::builder().method(method).uri(uri);
+    let request = match body {
+        Some(body) => request
+            .header("content-type", "application/json")
+            .body(Body::from(body.to_string())),
+        None => request.body(Body::empty()),
+    };
+    router
+        .clone()
+        .oneshot(request.unwrap())
+        .await
+        .unwrap()
+        .status()
+}
+
+fn alarm(severity: &str) -> FluxEvent {
+    FluxEvent::builder("alarms.events")
+        .source("plc-01")
+        .key("line-2")
+        .payload(json!({
+            "entity_id": format!("alarm-{}", severity),
+            "properties": {"severity": severity, "raw": "0x1f"}
+        }))
+        .build()
+        .unwrap()
+}
+
+/// Events on `stream` received within a short window.
+async fn derived_events(nats: &TestNats, stream: &str) -> Vec<ReceivedEvent> {
+    let js = nats.jetstream().await;
+    let consumer = js
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .create_consumer(consumer::pull::Config {
+            filter_subject: stream_subject(stream),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+    let mut received = Vec::new();
+    while let Ok(Some(Ok(message))) =
+        tokio::time::timeout(Duration::from_secs(1), messages.next()).await
+    {
+        received.push(ReceivedEvent::from_message(&message).unwrap());
+    }
+    received
+}
+
+#[tokio::test]
+async fn test_severity_rule_derives_only_matches() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let router = create_rule_router(RuleAppState {
+        engine: open_engine(&client).await,
+        admin_token: None,
+    });
+
+    let rule = json!({
+        "source_stream": "alarms.events",
+        "filter": [{"path": "payload.properties.severity", "op": "eq", "value": "critical"}],
+        "destination_stream": "alarms.critical",
+        "project": ["entity_id", "properties.severity"]
+    });
+    let status = send(&router, "PUT", "/api/rules/critical-alarms", Some(rule)).await;
+    assert_eq!(status, StatusCode::OK);
+
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    let events = [alarm("critical"), alarm("warning"), alarm("critical")];
+    for event in &events {
+        publisher.publish(event).await.unwrap();
+    }
+
+    let derived = derived_events(&nats, "alarms.critical").await;
+    assert_eq!(derived.len(), 2);
+    for (received, source) in derived.iter().zip([&events[0], &events[2]]) {
+        assert_eq!(
+            received.header(CAUSATION_HEADER),
+            source.event_id.as_deref()
+        );
+        assert_eq!(received.header(RULE_HEADER), Some("critical-alarms"));
+        assert_ne!(received.event.event_id, source.event_id);
+        assert_eq!(received.event.key.as_deref(), Some("line-2"));
+        assert_eq!(
+            received.event.payload,
+            json!({"entity_id": "alarm-critical", "properties": {"severity": "critical"}})
+        );
+    }
+}
+
+#[tokio::test]
+async fn test_rules_persist_and_delete() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let router = create_rule_router(RuleAppState {
+        engine: open_engine(&client).await,
+        admin_token: None,
+    });
+
+    let rule = json!({"source_stream": "orders", "destination_stream": "orders.copy"});
+    let status = send(&router, "PUT", "/api/rules/copy-orders", Some(rule)).await;
+    assert_eq!(status, StatusCode::OK);
+
+    // Invalid rules are refused
+    let loop_rule = json!({"source_stream": "orders", "destination_stream": "orders"});
+    let status = send(&router, "PUT", "/api/rules/loop", Some(loop_rule)).await;
+    assert_eq!(status, StatusCode::BAD_REQUEST);
+
+    // Rules are stored in KV and restarted on open
+    let reopened = open_engine(&client).await;
+    let rule = reopened.get("copy-orders").await.unwrap();
+    assert_eq!(rule.destination_stream, "orders.copy");
+    assert!(rule.filter.is_empty());
+
+    let status = send(&router, "DELETE", "/api/rules/copy-orders", None).await;
+    assert_eq!(status, StatusCode::NO_CONTENT);
+    let status = send(&router, "GET", "/api/rules/copy-orders", None).await;
+    assert_eq!(status, StatusCode::NOT_FOUND);
+    assert!(open_engine(&client).await.list().await.is_empty());
+}
@@ -0,0 +1,138 @@
+// Integration test for ScheduledPublisher against a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use chrono::{DateTime, Utc};
+use common::TestNats;
+use flux::clock::FakeClock;
+use flux::event::FluxEvent;
+use flux::nats::{event_from_message, EventPublisher, NatsClient, NatsConfig};
+use flux::scheduler::{ScheduleNotFoundError, ScheduledPublisher};
+use futures::StreamExt;
+use serde_json::json;
+use std::time::Duration;
+
+async fn read_all_events(nats: &TestNats) -> Vec<FluxEvent> {
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let consumer = stream
+        .create_consumer(async_nats::jetstream::consumer::pull::OrderedConfig::default())
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut events = Vec::new();
+    while let Ok(Some(Ok(msg))) =
+        tokio::time::timeout(Duration::from_millis(200), messages.next()).await
+    {
+        events.push(event_from_message(&msg).unwrap());
+    }
+    events
+}
+
+fn alert(entity_id: &str) -> FluxEvent {
+    FluxEvent::builder("maintenance.alerts")
+        .source("scheduler-test")
+        .payload(json!({"entity_id": entity_id, "properties": {"window": "open"}}))
+        .must_build()
+}
+
+/// 2024-02-11T16:20:00Z
+fn t0() -> DateTime<Utc> {
+    DateTime::from_timestamp_millis(1_707_668_400_000).unwrap()
+}
+
+async fn open(nats: &TestNats) -> ScheduledPublisher {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    ScheduledPublisher::open(
+        client.jetstream(),
+        EventPublisher::new(client.jetstream().clone()),
+    )
+    .await
+    .unwrap()
+}
+
+#[tokio::test]
+async fn test_publishes_only_due_events() {
+    let nats = TestNats::start();
+    let clock = FakeClock::at(t0());
+    let scheduler = open(&nats).await.with_clock(clock.clone());
+
+    let due = scheduler
+        .schedule_at(&alert("line-1"), t0() - chrono::Duration::seconds(1))
+        .await
+        .unwrap();
+    let later = scheduler
+        .schedule_at(&alert("line-2"), t0() + chrono::Duration::hours(1))
+        .await
+        .unwrap();
+
+    assert_eq!(scheduler.publish_due().await.unwrap(), 1);
+    assert!(scheduler.get(&due).await.unwrap().is_none());
+    assert!(scheduler.get(&later).await.unwrap().is_some());
+
+    let events = read_all_events(&nats).await;
+    assert_eq!(events.len(), 1);
+    assert_eq!(events[0].payload["entity_id"], "line-1");
+
+    // One millisecond early: not yet due
+    clock.advance(chrono::Duration::hours(1) - chrono::Duration::milliseconds(1));
+    assert_eq!(scheduler.publish_due().await.unwrap(), 0);
+
+    // Exactly on time: due
+    clock.advance(chrono::Duration::milliseconds(1));
+    assert_eq!(scheduler.publish_due().await.unwrap(), 1);
+    assert!(scheduler.get(&later).await.unwrap().is_none());
+}
+
+#[tokio::test]
+async fn test_cancelled_schedule_never_publishes() {
+    let nats = TestNats::start();
+    let scheduler = open(&nats).await;
+
+    let id = scheduler
+        .schedule_at(&alert("line-1"), Utc::now())
+        .await
+        .unwrap();
+    scheduler.cancel(&id).await.unwrap();
+
+    assert_eq!(scheduler.publish_due().await.unwrap(), 0);
+    assert!(read_all_events(&nats).await.is_empty());
+
+    // Second cancel: already gone
+    let err = scheduler.cancel(&id).await.unwrap_err();
+    assert!(err.downcast_ref::<ScheduleNotFoundError>().is_some());
+}
+
+#[tokio::test]
+async fn test_schedules_survive_restart() {
+    let nats = TestNats::start();
+    let id = open(&nats)
+        .await
+        .schedule_at(&alert("line-1"), t0() + chrono::Duration::minutes(5))
+        .await
+        .unwrap();
+
+    // New instance over the same bucket, after the event fell due
+    let scheduler = std::sync::Arc::new(
+        open(&nats)
+            .await
+            .with_clock(FakeClock::at(t0() + chrono::Duration::minutes(10)))
+            .with_poll_interval(Duration::from_millis(100)),
+    );
+    assert!(scheduler.get(&id).await.unwrap().is_some());
+    let handle = tokio::spawn(std::sync::Arc::clone(&scheduler).run());
+    tokio::time::sleep(Duration::from_millis(800)).await;
+    scheduler.stop();
+    handle.await.unwrap();
+
+    let events = read_all_events(&nats).await;
+    assert_eq!(events.len(), 1);
+    assert!(scheduler.get(&id).await.unwrap().is_none());
+}
@@ -0,0 +1,108 @@
+// Integration tests for the NATS micro service endpoints (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::nats::{
+    start_service, EventPublisher, NatsClient, NatsConfig, PublishResponse, StreamInfoResponse,
+};
+use serde_json::{json, Value};
+
+async fn start(nats: &TestNats) -> (NatsClient, async_nats::service::Service) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let service = start_service(
+        client.client(),
+        client.jetstream().clone(),
+        EventPublisher::new(client.jetstream().clone()),
+        "FLUX_EVENTS".to_string(),
+    )
+    .await
+    .unwrap();
+    (client, service)
+}
+
+/// Send a JSON request and return the reply payload plus the service error code (if any).
+async fn request(
+    client: &async_nats::Client,
+    subject: &str,
+    body: Value,
+) -> (Value, Option<String>) {
+    let msg = client
+        .request(subject.to_string(), body.to_string().into())
+        .await
+        .unwrap();
+    let code = msg
+        .headers
+        .as_ref()
+        .and_then(|h| h.get("Nats-Service-Error-Code"))
+        .map(|v| v.as_str().to_string());
+    let value = serde_json::from_slice(&msg.payload).unwrap_or(Value::Null);
+    (value, code)
+}
+
+#[tokio::test]
+async fn test_service_discoverable() {
+    let nats = TestNats::start();
+    let (_client, _service) = start(&nats).await;
+    let probe = nats.client().await;
+
+    let (info, _) = request(&probe, "$SRV.INFO.flux", json!({})).await;
+    assert_eq!(info["name"], "flux");
+    let endpoints: Vec<&str> = info["endpoints"]
+        .as_array()
+        .unwrap()
+        .iter()
+        .map(|e| e["subject"].as_str().unwrap())
+        .collect();
+    assert!(endpoints.contains(&"publish"));
+    assert!(endpoints.contains(&"stream.create"));
+    assert!(endpoints.contains(&"stream.info"));
+}
+
+#[tokio::test]
+async fn test_publish_and_stream_info() {
+    let nats = TestNats::start();
+    let (_client, _service) = start(&nats).await;
+    let probe = nats.client().await;
+
+    let event = json!({
+        "stream": "sensors",
+        "source": "service-test",
+        "timestamp": chrono::Utc::now().timestamp_millis(),
+        "payload": {"entity_id": "sensor-01", "properties": {"value": 1}}
+    });
+    for _ in 0..2 {
+        let (reply, code) = request(&probe, "publish", event.clone()).await;
+        assert_eq!(code, None);
+        let published: PublishResponse = serde_json::from_value(reply).unwrap();
+        assert_eq!(published.stream, "sensors");
+    }
+
+    let (reply, code) = request(&probe, "stream.info", json!({"stream": "sensors"})).await;
+    assert_eq!(code, None);
+    let info: StreamInfoResponse = serde_json::from_value(reply).unwrap();
+    assert_eq!(info.subject, "flux.events.sensors");
+    assert_eq!(info.messages, 2);
+
+    let (reply, _) = request(&probe, "stream.create", json!({"stream": "metrics"})).await;
+    let created: StreamInfoResponse = serde_json::from_value(reply).unwrap();
+    assert_eq!(created.messages, 0);
+}
+
+#[tokio::test]
+async fn test_invalid_requests_return_service_errors() {
+    let nats = TestNats::start();
+    let (_client, _service) = start(&nats).await;
+    let probe = nats.client().await;
+
+    let (_, code) = request(&probe, "publish", json!({"stream": "Bad Stream"})).await;
+    assert_eq!(code.as_deref(), Some("400"));
+
+    let (_, code) = request(&probe, "stream.info", json!({"stream": ".bad"})).await;
+    assert_eq!(code.as_deref(), Some("400"));
+}
@@ -0,0 +1,138 @@
+// Integration tests for the source format policy over HTTP and on the
+// publisher, against a real JetStream server (see tests/common).
+
+mod common;
+
+use axum::body::Body;
+use axum::http::{Request, StatusCode};
+use axum::response::Response;
+use common::TestNats;
+use flux::api::{create_router, AppState};
+use flux::config::new_runtime_config;
+use flux::event::{FluxEvent, SourceFormatMode, ValidationError, ValidationOptions};
+use flux::namespace::NamespaceRegistry;
+use flux::nats::{EventPublisher, NatsClient, NatsConfig};
+use flux::rate_limit::RateLimiter;
+use serde_json::json;
+use std::sync::Arc;
+use tower::ServiceExt;
+
+async fn publisher(nats: &TestNats, mode: SourceFormatMode) -> EventPublisher {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    EventPublisher::new(client.jetstream().clone()).with_validation(ValidationOptions {
+        source_format: mode,
+        ..Default::default()
+    })
+}
+
+async fn post_event(publisher: EventPublisher, source: &str) -> Response {
+    let state = AppState {
+        event_publisher: publisher,
+        namespace_registry: Arc::new(NamespaceRegistry::new()),
+        auth_enabled: false,
+        admin_token: None,
+        runtime_config: new_runtime_config(),
+        rate_limiter: Arc::new(RateLimiter::new()),
+    };
+    let body = json!({
+        "stream": "sensors",
+        "source": source,
+        "timestamp": chrono::Utc::now().timestamp_millis(),
+        "payload": {"entity_id": "gw-1", "properties": {"online": true}}
+    });
+    create_router(state)
+        .oneshot(
+            Request::builder()
+                .method("POST")
+                .uri("/api/events")
+                .header("content-type", "application/json")
+                .body(Body::from(body.to_string()))
+                .unwrap(),
+        )
+        .await
+        .unwrap()
+}
+
+#[tokio::test]
+async fn test_lenient_mode_flags_normalized_sources() {
+    let nats = TestNats::start();
+    let publisher = publisher(&nats, SourceFormatMode::Lenient).await;
+
+    let response = post_event(publisher.clone(), " IGNITION-GW1").await;
+    assert_eq!(response.status(), StatusCode::OK);
+    assert_eq!(response.headers()["deprecation"], "true");
+    assert!(response.headers().contains_key("warning"));
+
+    let response = post_event(publisher, "ignition-gw1").await;
+    assert_eq!(response.status(), StatusCode::OK);
+    assert!(!response.headers().contains_key("deprecation"));
+}
+
+#[tokio::test]
+async fn test_strict_mode_rejects_unnormalized_sources() {
+    let nats = TestNats::start();
+    let publisher = publisher(&nats, SourceFormatMode::Strict).await;
+
+    let response = post_event(publisher, "IGNITION-GW1").await;
+    assert_eq!(response.status(), StatusCode::BAD_REQUEST);
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let body: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(body["code"], "invalid_format");
+    assert_eq!(body["field"], "source");
+}
+
+#[tokio::test]
+async fn test_long_source_is_bad_request_not_payload_too_large() {
+    let nats = TestNats::start();
+    let publisher = publisher(&nats, SourceFormatMode::Strict).await;
+
+    let response = post_event(publisher, &"a".repeat(129)).await;
+    assert_eq!(response.status(), StatusCode::BAD_REQUEST);
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let body: serde_json::Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(body["code"], "too_long");
+    assert_eq!(body["field"], "source");
+}
+
+#[tokio::test]
+async fn test_publisher_normalizes_in_lenient_mode() {
+    let nats = TestNats::start();
+    let event = FluxEvent::builder("sensors")
+        .source("Ignition.Gateway.Prod")
+        .payload(json!({"entity_id": "gw-1", "properties": {}}))
+        .must_build();
+
+    let lenient = publisher(&nats, SourceFormatMode::Lenient).await;
+    let ack = lenient
+        .publish_with_ack(&event, std::time::Duration::from_secs(5))
+        .await
+        .unwrap()
+        .unwrap();
+    let stored = nats
+        .jetstream()
+        .await
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .get_raw_message(ack.sequence)
+        .await
+        .unwrap();
+    let stored: FluxEvent = serde_json::from_slice(&stored.payload).unwrap();
+    assert_eq!(stored.source, "ignition.gateway.prod");
+
+    let strict = publisher(&nats, SourceFormatMode::Strict).await;
+    let err = strict.publish(&event).await.unwrap_err();
+    assert!(matches!(
+        err.downcast_ref::<ValidationError>(),
+        Some(ValidationError::InvalidSourceFormat(_))
+    ));
+}
@@ -0,0 +1,165 @@
+// Integration tests for the JetStream-backed source registry (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{EventPublisher, NatsClient, NatsConfig};
+use flux::source::{NewSource, SourceError, SourceRegistry, SourceRejectedError};
+use serde_json::json;
+use std::sync::Arc;
+use std::time::Duration;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+fn new_source(source: &str, prefixes: &[&str]) -> NewSource {
+    NewSource {
+        source: source.to_string(),
+        description: "test producer".to_string(),
+        owner: "ops".to_string(),
+        allowed_stream_prefixes: prefixes.iter().map(|p| p.to_string()).collect(),
+    }
+}
+
+fn event_from(source: &str, stream: &str) -> FluxEvent {
+    let mut event = FluxEvent {
+        event_id: None,
+        stream: stream.to_string(),
+        source: source.to_string(),
+        timestamp: chrono::Utc::now().timestamp_millis(),
+        key: None,
+        schema: None,
+        priority: None,
+        envelope_version: None,
+        received_at: None,
+        ttl_ms: None,
+        correlation_id: None,
+        parent_event_id: None,
+        payload: json!({"entity_id": "sensor-01", "properties": {"value": 1}}),
+        raw_payload: None,
+    };
+    event.validate_and_prepare().unwrap();
+    event
+}
+
+fn rejection(err: anyhow::Error) -> SourceRejectedError {
+    err.downcast_ref::<SourceRejectedError>().unwrap().clone()
+}
+
+#[tokio::test]
+async fn test_register_get_list() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let registry = SourceRegistry::open(client.jetstream()).await.unwrap();
+
+    let record = registry
+        .register(new_source("sensor-001", &["sensors"]))
+        .await
+        .unwrap();
+    assert!(record.active);
+    assert_eq!(registry.get("sensor-001").unwrap(), record);
+    assert_eq!(registry.list().len(), 1);
+
+    let err = registry
+        .register(new_source("sensor-001", &[]))
+        .await
+        .unwrap_err();
+    assert_eq!(err, SourceError::AlreadyExists("sensor-001".to_string()));
+
+    // Registrations persist in KV and are loaded on reopen
+    let reopened = SourceRegistry::open(client.jetstream()).await.unwrap();
+    assert_eq!(reopened.get("sensor-001").unwrap(), record);
+}
+
+#[tokio::test]
+async fn test_unregistered_source_allowed_when_not_required() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let registry = Arc::new(SourceRegistry::open(client.jetstream()).await.unwrap());
+    let publisher =
+        EventPublisher::new(client.jetstream().clone()).with_source_registry(registry, false);
+
+    publisher
+        .publish(&event_from("unknown-producer", "sensors"))
+        .await
+        .unwrap();
+}
+
+#[tokio::test]
+async fn test_unregistered_source_rejected_when_required() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let registry = Arc::new(SourceRegistry::open(client.jetstream()).await.unwrap());
+    registry
+        .register(new_source("sensor-001", &["sensors"]))
+        .await
+        .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_source_registry(Arc::clone(&registry), true);
+
+    publisher
+        .publish(&event_from("sensor-001", "sensors.zone1"))
+        .await
+        .unwrap();
+
+    let err = publisher
+        .publish(&event_from("unknown-producer", "sensors"))
+        .await
+        .unwrap_err();
+    assert_eq!(rejection(err).reason, "not registered");
+
+    let err = publisher
+        .publish(&event_from("sensor-001", "metrics"))
+        .await
+        .unwrap_err();
+    assert_eq!(rejection(err).reason, "stream not allowed for this source");
+}
+
+#[tokio::test]
+async fn test_deactivation_takes_effect_without_restart() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+
+    // Two registry instances, as if two Flux processes shared the bucket
+    let admin = SourceRegistry::open(client.jetstream()).await.unwrap();
+    let watched = Arc::new(SourceRegistry::open(client.jetstream()).await.unwrap());
+    tokio::spawn(Arc::clone(&watched).watch());
+
+    admin.register(new_source("sensor-001", &[])).await.unwrap();
+
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_source_registry(Arc::clone(&watched), true);
+
+    // Wait for the watcher to pick up the registration
+    wait_until(|| watched.get("sensor-001").map_or(false, |r| r.active)).await;
+    publisher
+        .publish(&event_from("sensor-001", "sensors"))
+        .await
+        .unwrap();
+
+    admin.deactivate("sensor-001").await.unwrap();
+    wait_until(|| watched.get("sensor-001").map_or(false, |r| !r.active)).await;
+
+    let err = publisher
+        .publish(&event_from("sensor-001", "sensors"))
+        .await
+        .unwrap_err();
+    assert_eq!(rejection(err).reason, "deactivated");
+}
+
+async fn wait_until(condition: impl Fn() -> bool) {
+    for _ in 0..100 {
+        if condition() {
+            return;
+        }
+        tokio::time::sleep(Duration::from_millis(20)).await;
+    }
+    panic!("condition not reached within 2s");
+}
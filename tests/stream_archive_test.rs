@@ -0,0 +1,99 @@
+// Integration tests for archiving (soft-deleting) streams against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{
+    archived_at, EventPublisher, NatsClient, NatsConfig, StreamArchivedError,
+    StreamNotArchivedError, StreamNotFoundError,
+};
+use serde_json::json;
+use std::time::Duration;
+
+fn test_event(entity_id: &str) -> FluxEvent {
+    FluxEvent::builder("orders")
+        .source("archive-test")
+        .payload(json!({"entity_id": entity_id, "properties": {}}))
+        .must_build()
+}
+
+async fn stream_config(client: &NatsClient) -> async_nats::jetstream::stream::Config {
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    stream.info().await.unwrap().config.clone()
+}
+
+#[tokio::test]
+async fn test_archive_unarchive_then_delete() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    publisher.publish(&test_event("order-01")).await.unwrap();
+
+    let err = client.delete_stream("FLUX_EVENTS").await.unwrap_err();
+    assert_eq!(
+        err.downcast_ref::<StreamNotArchivedError>().unwrap().stream,
+        "FLUX_EVENTS"
+    );
+
+    assert!(client.archive_stream("FLUX_EVENTS", None).await.unwrap());
+    assert!(!client.archive_stream("FLUX_EVENTS", None).await.unwrap());
+    let config = stream_config(&client).await;
+    assert!(archived_at(&config).is_some());
+    assert_eq!(config.subjects, vec!["flux.archived.FLUX_EVENTS"]);
+
+    let err = publisher
+        .publish(&test_event("order-02"))
+        .await
+        .unwrap_err();
+    let archived = err.downcast_ref::<StreamArchivedError>().unwrap();
+    assert_eq!(archived.stream, "FLUX_EVENTS");
+    assert_eq!(archived.subject, "flux.events.orders");
+    // Still readable
+    assert_eq!(client.stream_message_count("FLUX_EVENTS").await.unwrap(), 1);
+    let event = client.get_event("FLUX_EVENTS", 1).await.unwrap();
+    assert_eq!(event.payload["entity_id"], "order-01");
+
+    assert!(client.unarchive_stream("FLUX_EVENTS").await.unwrap());
+    assert!(!client.unarchive_stream("FLUX_EVENTS").await.unwrap());
+    let config = stream_config(&client).await;
+    assert!(archived_at(&config).is_none());
+    assert_eq!(config.subjects, vec!["flux.events.>"]);
+    publisher.publish(&test_event("order-03")).await.unwrap();
+
+    // Unarchived again, so only a forced delete goes through
+    assert!(client.delete_stream("FLUX_EVENTS").await.is_err());
+    client.force_delete_stream("FLUX_EVENTS").await.unwrap();
+    let err = client
+        .stream_message_count("FLUX_EVENTS")
+        .await
+        .unwrap_err();
+    assert!(err.downcast_ref::<StreamNotFoundError>().is_some());
+}
+
+#[tokio::test]
+async fn test_archive_grace_period_then_delete() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+
+    let grace = Duration::from_secs(3600);
+    assert!(client
+        .archive_stream("FLUX_EVENTS", Some(grace))
+        .await
+        .unwrap());
+    assert_eq!(stream_config(&client).await.max_age, grace);
+
+    client.delete_stream("FLUX_EVENTS").await.unwrap();
+    assert!(client.jetstream().get_stream("FLUX_EVENTS").await.is_err());
+}
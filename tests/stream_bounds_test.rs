@@ -0,0 +1,71 @@
+// Integration tests for NatsClient stream bounds and counts against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{EventPublisher, NatsClient, NatsConfig, StreamNotFoundError};
+use serde_json::json;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+async fn publish(client: &NatsClient, count: usize) {
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    for i in 0..count {
+        let event = FluxEvent::builder("sensors")
+            .source("bounds-test")
+            .payload(json!({"entity_id": format!("sensor-{:02}", i), "properties": {}}))
+            .must_build();
+        publisher.publish(&event).await.unwrap();
+    }
+}
+
+#[tokio::test]
+async fn test_empty_stream_bounds() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+
+    assert_eq!(client.stream_bounds("FLUX_EVENTS").await.unwrap(), (0, 0));
+    assert_eq!(client.stream_message_count("FLUX_EVENTS").await.unwrap(), 0);
+    assert_eq!(client.stream_byte_count("FLUX_EVENTS").await.unwrap(), 0);
+}
+
+#[tokio::test]
+async fn test_bounds_follow_publishes_and_purges() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    publish(&client, 5).await;
+
+    assert_eq!(client.stream_bounds("FLUX_EVENTS").await.unwrap(), (1, 5));
+    assert_eq!(client.stream_message_count("FLUX_EVENTS").await.unwrap(), 5);
+    assert!(client.stream_byte_count("FLUX_EVENTS").await.unwrap() > 0);
+
+    client
+        .purge_stream_before_sequence("FLUX_EVENTS", 4)
+        .await
+        .unwrap();
+    assert_eq!(client.stream_bounds("FLUX_EVENTS").await.unwrap(), (4, 5));
+    assert_eq!(client.stream_message_count("FLUX_EVENTS").await.unwrap(), 2);
+}
+
+#[tokio::test]
+async fn test_unknown_stream() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+
+    for err in [
+        client.stream_bounds("NOPE").await.unwrap_err(),
+        client.stream_message_count("NOPE").await.unwrap_err(),
+        client.stream_byte_count("NOPE").await.unwrap_err(),
+    ] {
+        assert!(err.downcast_ref::<StreamNotFoundError>().is_some());
+    }
+}
@@ -0,0 +1,165 @@
+// Integration tests for NDJSON stream export/import against real JetStream
+// servers (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{
+    export_stream, import_stream, EventPublisher, NatsClient, NatsConfig, TransferCancelledError,
+    TransferOptions,
+};
+use serde_json::json;
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::sync::Arc;
+use tokio::io::BufReader;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+fn test_event(entity_id: &str) -> FluxEvent {
+    FluxEvent::builder("sensors")
+        .source("export-test")
+        .payload(json!({"entity_id": entity_id, "properties": {"t": 21}}))
+        .must_build()
+}
+
+#[tokio::test]
+async fn test_export_import_through_pipe() {
+    let source = TestNats::start();
+    let target = TestNats::start();
+    let source_client = connect(&source).await;
+    let target_client = connect(&target).await;
+
+    let publisher = EventPublisher::new(source_client.jetstream().clone());
+    let mut originals = Vec::new();
+    for i in 0..25 {
+        let event = test_event(&format!("sensor-{:02}", i));
+        publisher.publish(&event).await.unwrap();
+        originals.push(event);
+    }
+
+    let progress = Arc::new(AtomicU64::new(0));
+    let seen = Arc::clone(&progress);
+    let export_options =
+        TransferOptions::new().with_progress(10, move |count| seen.store(count, Ordering::SeqCst));
+    let import_options = TransferOptions::new();
+    let importer = EventPublisher::new(target_client.jetstream().clone());
+
+    // Small buffer, so export and import have to run in step
+    let (mut writer, reader) = tokio::io::duplex(256);
+    let export = async {
+        let written = export_stream(
+            source_client.jetstream(),
+            "FLUX_EVENTS",
+            &mut writer,
+            &export_options,
+            std::future::pending(),
+        )
+        .await;
+        drop(writer);
+        written
+    };
+    let import = import_stream(
+        &importer,
+        BufReader::new(reader),
+        &import_options,
+        std::future::pending(),
+    );
+    let (written, imported) = tokio::join!(export, import);
+    assert_eq!(written.unwrap(), 25);
+    assert_eq!(imported.unwrap(), 25);
+    assert_eq!(progress.load(Ordering::SeqCst), 25);
+
+    assert_eq!(
+        target_client
+            .stream_message_count("FLUX_EVENTS")
+            .await
+            .unwrap(),
+        25
+    );
+    for (i, original) in originals.iter().enumerate() {
+        let event = target_client
+            .get_event("FLUX_EVENTS", i as u64 + 1)
+            .await
+            .unwrap();
+        assert_eq!(event.event_id, original.event_id);
+        assert_eq!(event.timestamp, original.timestamp);
+        assert_eq!(event.payload, original.payload);
+    }
+}
+
+#[tokio::test]
+async fn test_export_empty_stream() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+
+    let mut out = Vec::new();
+    let written = export_stream(
+        client.jetstream(),
+        "FLUX_EVENTS",
+        &mut out,
+        &TransferOptions::new(),
+        std::future::pending(),
+    )
+    .await
+    .unwrap();
+    assert_eq!(written, 0);
+    assert!(out.is_empty());
+}
+
+#[tokio::test]
+async fn test_import_rejects_invalid_line() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    let mut input = serde_json::to_string(&test_event("sensor-01")).unwrap();
+    input.push_str("\n\n{\"stream\":\n");
+    let err = import_stream(
+        &publisher,
+        input.as_bytes(),
+        &TransferOptions::new(),
+        std::future::pending(),
+    )
+    .await
+    .unwrap_err();
+    assert!(err.to_string().contains("line 3"), "{}", err);
+    assert_eq!(client.stream_message_count("FLUX_EVENTS").await.unwrap(), 1);
+}
+
+#[tokio::test]
+async fn test_cancelled_import_stops() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = EventPublisher::new(client.jetstream().clone());
+
+    // The writer stays open, so only cancellation ends the import
+    let (mut writer, reader) = tokio::io::duplex(4096);
+    let line = format!(
+        "{}\n",
+        serde_json::to_string(&test_event("sensor-01")).unwrap()
+    );
+    tokio::io::AsyncWriteExt::write_all(&mut writer, line.as_bytes())
+        .await
+        .unwrap();
+
+    let err = import_stream(
+        &publisher,
+        BufReader::new(reader),
+        &TransferOptions::new(),
+        tokio::time::sleep(std::time::Duration::from_millis(500)),
+    )
+    .await
+    .unwrap_err();
+    assert_eq!(
+        err.downcast_ref::<TransferCancelledError>(),
+        Some(&TransferCancelledError { events: 1 })
+    );
+}
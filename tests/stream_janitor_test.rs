@@ -0,0 +1,130 @@
+// Integration tests for the stream janitor against a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::{self, consumer, stream};
+use common::TestNats;
+use flux::nats::{
+    EventPublisher, NatsClient, NatsConfig, StreamJanitor, StreamJanitorConfig, AUDIT_STREAM,
+    AUTO_CREATED_LABEL,
+};
+use std::collections::HashMap;
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+async fn create(js: &jetstream::Context, name: &str, auto_created: bool, deny_delete: bool) {
+    let metadata = if auto_created {
+        HashMap::from([(AUTO_CREATED_LABEL.to_string(), "true".to_string())])
+    } else {
+        HashMap::new()
+    };
+    js.create_stream(stream::Config {
+        name: name.to_string(),
+        subjects: vec![format!("janitor.{}", name.to_lowercase())],
+        metadata,
+        deny_delete,
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+}
+
+/// One stream per case; only IDLE qualifies for deletion.
+async fn fabricate_streams(js: &jetstream::Context) {
+    create(js, "IDLE", true, false).await;
+    create(js, "MANUAL", false, false).await;
+    create(js, "DENY", true, true).await;
+    create(js, "KEEP", true, false).await;
+
+    create(js, "BUSY", true, false).await;
+    js.publish("janitor.busy", "event".into())
+        .await
+        .unwrap()
+        .await
+        .unwrap();
+
+    create(js, "READ", true, false).await;
+    js.get_stream("READ")
+        .await
+        .unwrap()
+        .create_consumer(consumer::pull::Config {
+            durable_name: Some("reader".to_string()),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+}
+
+async fn stream_exists(js: &jetstream::Context, name: &str) -> bool {
+    js.get_stream(name).await.is_ok()
+}
+
+fn config(dry_run: bool) -> StreamJanitorConfig {
+    StreamJanitorConfig {
+        idle_hours: 0,
+        dry_run,
+        protected_streams: vec!["KEEP".to_string()],
+        ..Default::default()
+    }
+}
+
+#[tokio::test]
+async fn test_janitor_deletes_only_idle_auto_created_streams() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let js = client.jetstream();
+    fabricate_streams(js).await;
+
+    let janitor =
+        StreamJanitor::new(js.clone(), config(false)).with_audit(EventPublisher::new(js.clone()));
+    let deleted = janitor.sweep().await.unwrap();
+
+    let names: Vec<&str> = deleted.iter().map(|c| c.stream.as_str()).collect();
+    assert_eq!(names, vec!["IDLE"]);
+    assert!(!stream_exists(js, "IDLE").await);
+    for name in ["MANUAL", "DENY", "KEEP", "BUSY", "READ", "FLUX_EVENTS"] {
+        assert!(stream_exists(js, name).await, "{} was deleted", name);
+    }
+
+    // One audit event for the deletion
+    let audit = client.stream_message_count("FLUX_EVENTS").await.unwrap();
+    assert_eq!(audit, 1);
+    let message = js
+        .get_stream("FLUX_EVENTS")
+        .await
+        .unwrap()
+        .get_raw_message(1)
+        .await
+        .unwrap();
+    assert_eq!(
+        message.subject.as_str(),
+        format!("flux.events.{}", AUDIT_STREAM)
+    );
+}
+
+#[tokio::test]
+async fn test_janitor_dry_run_deletes_nothing() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let js = client.jetstream();
+    fabricate_streams(js).await;
+
+    let janitor =
+        StreamJanitor::new(js.clone(), config(true)).with_audit(EventPublisher::new(js.clone()));
+    let candidates = janitor.sweep().await.unwrap();
+
+    assert_eq!(candidates.len(), 1);
+    assert_eq!(candidates[0].stream, "IDLE");
+    for name in ["IDLE", "MANUAL", "DENY", "KEEP", "BUSY", "READ"] {
+        assert!(stream_exists(js, name).await, "{} was deleted", name);
+    }
+    assert_eq!(client.stream_message_count("FLUX_EVENTS").await.unwrap(), 0);
+}
@@ -0,0 +1,279 @@
+// Integration tests for paged JetStream stream listing against a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::{self, stream};
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+};
+use common::TestNats;
+use flux::api::{create_stream_list_router, StreamListAppState};
+use flux::nats::{list_streams_page, NatsClient, NatsConfig, StreamInfoCache, StreamListOptions};
+use std::collections::{HashMap, HashSet};
+use std::time::Duration;
+use tower::ServiceExt;
+
+/// SENSOR_00..SENSOR_24, even-numbered ones labelled parity=even, plus ALERTS
+async fn create_streams(js: &jetstream::Context) {
+    for n in 0..25 {
+        let metadata = if n % 2 == 0 {
+            HashMap::from([("parity".to_string(), "even".to_string())])
+        } else {
+            HashMap::new()
+        };
+        js.create_stream(stream::Config {
+            name: format!("SENSOR_{:02}", n),
+            subjects: vec![format!("list.sensor.{}", n)],
+            metadata,
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    }
+    js.create_stream(stream::Config {
+        name: "ALERTS".to_string(),
+        subjects: vec!["list.alerts".to_string()],
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+}
+
+async fn collect_pages(
+    js: &jetstream::Context,
+    mut options: StreamListOptions,
+) -> Vec<Vec<String>> {
+    let mut pages = Vec::new();
+    loop {
+        let page = list_streams_page(js, &options).await.unwrap();
+        pages.push(
+            page.streams
+                .iter()
+                .map(|info| info.config.name.clone())
+                .collect(),
+        );
+        match page.continuation {
+            Some(token) => options.continuation = Some(token),
+            None => return pages,
+        }
+    }
+}
+
+#[tokio::test]
+async fn test_pages_cover_every_stream_once() {
+    let nats = TestNats::start();
+    let js = nats.jetstream().await;
+    create_streams(&js).await;
+
+    let pages = collect_pages(
+        &js,
+        StreamListOptions {
+            prefix: Some("SENSOR_".to_string()),
+            page_size: 10,
+            ..Default::default()
+        },
+    )
+    .await;
+
+    assert_eq!(
+        pages.iter().map(Vec::len).collect::<Vec<_>>(),
+        vec![10, 10, 5]
+    );
+    let names: Vec<String> = pages.into_iter().flatten().collect();
+    let expected: Vec<String> = (0..25).map(|n| format!("SENSOR_{:02}", n)).collect();
+    assert_eq!(names, expected); // sorted, no duplicates or omissions
+    assert_eq!(names.iter().collect::<HashSet<_>>().len(), 25);
+}
+
+#[tokio::test]
+async fn test_label_selector_filters_pages() {
+    let nats = TestNats::start();
+    let js = nats.jetstream().await;
+    create_streams(&js).await;
+
+    let pages = collect_pages(
+        &js,
+        StreamListOptions {
+            labels: vec![("parity".to_string(), "even".to_string())],
+            page_size: 10,
+            ..Default::default()
+        },
+    )
+    .await;
+
+    let names: Vec<String> = pages.into_iter().flatten().collect();
+    let expected: Vec<String> = (0..25)
+        .step_by(2)
+        .map(|n| format!("SENSOR_{:02}", n))
+        .collect();
+    assert_eq!(names, expected);
+}
+
+#[tokio::test]
+async fn test_http_listing() {
+    let nats = TestNats::start();
+    let js = nats.jetstream().await;
+    create_streams(&js).await;
+    let router = create_stream_list_router(StreamListAppState {
+        jetstream: js,
+        cache: None,
+        cache_ttl: Duration::ZERO,
+    });
+
+    let get = |uri: String| {
+        let router = router.clone();
+        async move {
+            let response = router
+                .oneshot(Request::get(uri).body(Body::empty()).unwrap())
+                .await
+                .unwrap();
+            let status = response.status();
+            let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+                .await
+                .unwrap();
+            (
+                status,
+                serde_json::from_slice::<serde_json::Value>(&body).unwrap(),
+            )
+        }
+    };
+
+    let (status, body) = get("/api/streams?limit=3".to_string()).await;
+    assert_eq!(status, StatusCode::OK);
+    let names: Vec<&str> = body["streams"]
+        .as_array()
+        .unwrap()
+        .iter()
+        .map(|s| s["name"].as_str().unwrap())
+        .collect();
+    assert_eq!(names, vec!["ALERTS", "SENSOR_00", "SENSOR_01"]);
+
+    let token = body["continuation"].as_str().unwrap();
+    let (_, body) = get(format!("/api/streams?limit=3&continuation={}", token)).await;
+    assert_eq!(body["streams"][0]["name"], "SENSOR_02");
+
+    let (status, body) = get("/api/streams?labels=parity%3Deven&prefix=SENSOR_2".to_string()).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(body["streams"].as_array().unwrap().len(), 3); // 20, 22, 24
+    assert!(body["continuation"].is_null());
+
+    let (status, _) = get("/api/streams?continuation=%21%21".to_string()).await;
+    assert_eq!(status, StatusCode::BAD_REQUEST);
+}
+
+/// GET `uri` with an optional If-None-Match; returns status, ETag and body.
+async fn get_with_etag(
+    router: &axum::Router,
+    uri: &str,
+    if_none_match: Option<&str>,
+) -> (StatusCode, String, serde_json::Value) {
+    let mut request = Request::get(uri);
+    if let Some(etag) = if_none_match {
+        request = request.header("if-none-match", etag);
+    }
+    let response = router
+        .clone()
+        .oneshot(request.body(Body::empty()).unwrap())
+        .await
+        .unwrap();
+    let status = response.status();
+    let etag = response
+        .headers()
+        .get("etag")
+        .map(|etag| etag.to_str().unwrap().to_string())
+        .unwrap_or_default();
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let body = serde_json::from_slice(&body).unwrap_or(serde_json::Value::Null);
+    (status, etag, body)
+}
+
+#[tokio::test]
+async fn test_http_cache_and_etag() {
+    let nats = TestNats::start();
+    let js = nats.jetstream().await;
+    js.create_stream(stream::Config {
+        name: "CACHED".to_string(),
+        subjects: vec!["cache.test".to_string()],
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let router = create_stream_list_router(StreamListAppState {
+        jetstream: js.clone(),
+        cache: Some(StreamInfoCache::new()),
+        cache_ttl: Duration::from_millis(500),
+    });
+
+    let (status, etag, body) = get_with_etag(&router, "/api/streams/CACHED", None).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(body["messages"], 0);
+    let (_, list_etag, _) = get_with_etag(&router, "/api/streams", None).await;
+
+    js.publish("cache.test", "event".into())
+        .await
+        .unwrap()
+        .await
+        .unwrap();
+
+    // Within the TTL both endpoints answer from the cache, without JetStream
+    let (status, cached_etag, body) = get_with_etag(&router, "/api/streams/CACHED", None).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_eq!(cached_etag, etag);
+    assert_eq!(body["messages"], 0);
+    let (status, _, _) = get_with_etag(&router, "/api/streams/CACHED", Some(&etag)).await;
+    assert_eq!(status, StatusCode::NOT_MODIFIED);
+    let (status, _, _) = get_with_etag(&router, "/api/streams", Some(&list_etag)).await;
+    assert_eq!(status, StatusCode::NOT_MODIFIED);
+
+    // After it, the new last sequence changes the ETag
+    tokio::time::sleep(Duration::from_millis(600)).await;
+    let (status, new_etag, body) =
+        get_with_etag(&router, "/api/streams/CACHED", Some(&etag)).await;
+    assert_eq!(status, StatusCode::OK);
+    assert_ne!(new_etag, etag);
+    assert_eq!(body["messages"], 1);
+    assert_eq!(body["last_sequence"], 1);
+    let (status, _, _) = get_with_etag(&router, "/api/streams", Some(&list_etag)).await;
+    assert_eq!(status, StatusCode::OK);
+
+    let (status, _, _) = get_with_etag(&router, "/api/streams/NOPE", None).await;
+    assert_eq!(status, StatusCode::NOT_FOUND);
+}
+
+#[tokio::test]
+async fn test_stream_changes_invalidate_cache() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let router = create_stream_list_router(StreamListAppState {
+        jetstream: client.jetstream().clone(),
+        cache: Some(client.stream_cache().clone()),
+        cache_ttl: Duration::from_secs(60),
+    });
+    let (_, etag, _) = get_with_etag(&router, "/api/streams", None).await;
+
+    client
+        .create_streams_batch(&[stream::Config {
+            name: "ORDERS".to_string(),
+            subjects: vec!["orders.>".to_string()],
+            ..Default::default()
+        }])
+        .await
+        .unwrap();
+    let (_, created_etag, body) = get_with_etag(&router, "/api/streams", None).await;
+    assert_ne!(created_etag, etag);
+    assert_eq!(body["streams"][1]["name"], "ORDERS");
+
+    client.force_delete_stream("ORDERS").await.unwrap();
+    let (_, deleted_etag, body) = get_with_etag(&router, "/api/streams", None).await;
+    assert_eq!(deleted_etag, etag);
+    assert_eq!(body["streams"].as_array().unwrap().len(), 1);
+}
@@ -0,0 +1,200 @@
+// Integration tests for migrating stream configs against a real JetStream
+// server (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::{self, consumer, stream};
+use common::TestNats;
+use flux::nats::{MigrationMethod, NatsClient, NatsConfig, DEPRECATED_LABEL};
+use futures::StreamExt;
+use std::time::Duration;
+
+fn orders_config() -> stream::Config {
+    stream::Config {
+        name: "ORDERS".to_string(),
+        subjects: vec!["orders.>".to_string()],
+        max_age: Duration::from_secs(7 * 86400),
+        storage: stream::StorageType::File,
+        ..Default::default()
+    }
+}
+
+/// ORDERS holding `count` messages whose payloads are "1", "2", ...
+async fn orders(client: &NatsClient, count: u64) -> jetstream::Context {
+    let jetstream = client.jetstream().clone();
+    jetstream.create_stream(orders_config()).await.unwrap();
+    for n in 1..=count {
+        let subject = if n % 2 == 0 {
+            "orders.even"
+        } else {
+            "orders.odd"
+        };
+        jetstream
+            .publish(subject, n.to_string().into())
+            .await
+            .unwrap()
+            .await
+            .unwrap();
+    }
+    jetstream
+}
+
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+async fn info(jetstream: &jetstream::Context, name: &str) -> stream::Info {
+    let mut stream = jetstream.get_stream(name).await.unwrap();
+    stream.info().await.unwrap().clone()
+}
+
+async fn next_payload(consumer: &consumer::Consumer<consumer::pull::Config>) -> String {
+    let message = consumer
+        .fetch()
+        .max_messages(1)
+        .expires(Duration::from_secs(2))
+        .messages()
+        .await
+        .unwrap()
+        .next()
+        .await
+        .unwrap()
+        .unwrap();
+    message.double_ack().await.unwrap();
+    String::from_utf8(message.payload.to_vec()).unwrap()
+}
+
+#[tokio::test]
+async fn test_unsafe_change_migrates_by_copy() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let jetstream = orders(&client, 10).await;
+    let stream = jetstream.get_stream("ORDERS").await.unwrap();
+    let billing = stream
+        .create_consumer(consumer::pull::Config {
+            durable_name: Some("billing".to_string()),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    for n in 1..=4 {
+        assert_eq!(next_payload(&billing).await, n.to_string());
+    }
+    let shipping = stream
+        .create_consumer(consumer::pull::Config {
+            durable_name: Some("shipping".to_string()),
+            filter_subject: "orders.even".to_string(),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    assert_eq!(next_payload(&shipping).await, "2");
+
+    let desired = stream::Config {
+        storage: stream::StorageType::Memory,
+        ..orders_config()
+    };
+    let migration = client
+        .migrate_stream(&orders_config(), &desired)
+        .await
+        .unwrap();
+    assert_eq!(migration.method, MigrationMethod::Copied);
+    assert_eq!(
+        migration.deprecated_stream.as_deref(),
+        Some("ORDERS_DEPRECATED")
+    );
+    assert_eq!(migration.messages, 10);
+    let mut consumers = migration.consumers.clone();
+    consumers.sort();
+    assert_eq!(consumers, ["billing", "shipping"]);
+
+    let migrated = info(&jetstream, "ORDERS").await;
+    assert_eq!(migrated.config.storage, stream::StorageType::Memory);
+    assert_eq!(migrated.config.subjects, vec!["orders.>"]);
+    assert!(migrated.config.sources.unwrap_or_default().is_empty());
+    let deprecated = info(&jetstream, "ORDERS_DEPRECATED").await;
+    assert_eq!(deprecated.state.messages, 10);
+    assert_eq!(deprecated.config.storage, stream::StorageType::File);
+    assert!(deprecated.config.metadata.contains_key(DEPRECATED_LABEL));
+
+    // Consumers pick up after the last message they acked
+    let stream = jetstream.get_stream("ORDERS").await.unwrap();
+    let billing: consumer::PullConsumer = stream.get_consumer("billing").await.unwrap();
+    assert_eq!(next_payload(&billing).await, "5");
+    let shipping: consumer::PullConsumer = stream.get_consumer("shipping").await.unwrap();
+    assert_eq!(next_payload(&shipping).await, "4");
+
+    // The new stream takes publishes again
+    let ack = jetstream
+        .publish("orders.odd", "11".into())
+        .await
+        .unwrap()
+        .await
+        .unwrap();
+    assert_eq!(ack.stream, "ORDERS");
+    assert_eq!(
+        info(&jetstream, "ORDERS_DEPRECATED").await.state.messages,
+        10
+    );
+}
+
+#[tokio::test]
+async fn test_longer_retention_is_applied_in_place() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let jetstream = orders(&client, 3).await;
+
+    let desired = stream::Config {
+        max_age: Duration::from_secs(30 * 86400),
+        ..orders_config()
+    };
+    let migration = client
+        .migrate_stream(&orders_config(), &desired)
+        .await
+        .unwrap();
+    assert_eq!(migration.method, MigrationMethod::InPlace);
+    assert_eq!(migration.deprecated_stream, None);
+    let migrated = info(&jetstream, "ORDERS").await;
+    assert_eq!(migrated.config.max_age, desired.max_age);
+    assert_eq!(migrated.state.messages, 3);
+    assert!(jetstream.get_stream("ORDERS_DEPRECATED").await.is_err());
+
+    let migration = client.migrate_stream(&desired, &desired).await.unwrap();
+    assert_eq!(migration.method, MigrationMethod::Unchanged);
+}
+
+#[tokio::test]
+async fn test_lower_limit_keeps_old_messages() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let jetstream = orders(&client, 10).await;
+
+    let desired = stream::Config {
+        max_messages: 3,
+        ..orders_config()
+    };
+    let migration = client
+        .migrate_stream(&orders_config(), &desired)
+        .await
+        .unwrap();
+    assert_eq!(migration.method, MigrationMethod::Copied);
+    assert_eq!(info(&jetstream, "ORDERS").await.state.messages, 3);
+    assert_eq!(
+        info(&jetstream, "ORDERS_DEPRECATED").await.state.messages,
+        10
+    );
+
+    // The deprecated stream has to go before the next copy
+    let fewer = stream::Config {
+        max_messages: 2,
+        ..orders_config()
+    };
+    let err = client.migrate_stream(&desired, &fewer).await.unwrap_err();
+    assert!(err.to_string().contains("ORDERS_DEPRECATED"), "{}", err);
+    assert_eq!(info(&jetstream, "ORDERS").await.state.messages, 3);
+}
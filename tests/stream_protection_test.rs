@@ -0,0 +1,97 @@
+// Integration tests for delete/purge-protected and sealed streams against a
+// real JetStream server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{EventPublisher, NatsClient, NatsConfig, StreamProtectedError};
+use serde_json::json;
+
+fn test_event(entity_id: &str) -> FluxEvent {
+    FluxEvent::builder("audit")
+        .source("protection-test")
+        .payload(json!({"entity_id": entity_id, "properties": {"value": 1}}))
+        .must_build()
+}
+
+async fn message_count(client: &NatsClient) -> u64 {
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    stream.info().await.unwrap().state.messages
+}
+
+#[tokio::test]
+async fn test_default_stream_is_unprotected() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+
+    let mut stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let config = stream.info().await.unwrap().config.clone();
+    assert!(!config.deny_delete);
+    assert!(!config.deny_purge);
+    assert!(!config.sealed);
+
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&test_event("record-01"))
+        .await
+        .unwrap();
+    client.purge_stream("FLUX_EVENTS").await.unwrap();
+    assert_eq!(message_count(&client).await, 0);
+}
+
+#[tokio::test]
+async fn test_deny_purge_stream_refuses_purge() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        deny_purge: true,
+        deny_delete: true,
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&test_event("record-01"))
+        .await
+        .unwrap();
+
+    let err = client.purge_stream("FLUX_EVENTS").await.unwrap_err();
+    let protected = err.downcast_ref::<StreamProtectedError>().unwrap();
+    assert_eq!(protected.operation, "purge");
+    assert_eq!(protected.flag, "deny_purge");
+
+    let err = client.delete_stream("FLUX_EVENTS").await.unwrap_err();
+    let protected = err.downcast_ref::<StreamProtectedError>().unwrap();
+    assert_eq!(protected.flag, "deny_delete");
+
+    assert_eq!(message_count(&client).await, 1);
+}
+
+#[tokio::test]
+async fn test_sealed_stream_rejects_publishes() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    publisher.publish(&test_event("record-01")).await.unwrap();
+
+    assert!(client.seal_stream("FLUX_EVENTS").await.unwrap());
+    assert!(!client.seal_stream("FLUX_EVENTS").await.unwrap());
+
+    assert!(publisher.publish(&test_event("record-02")).await.is_err());
+    let err = client.purge_stream("FLUX_EVENTS").await.unwrap_err();
+    assert_eq!(
+        err.downcast_ref::<StreamProtectedError>().unwrap().flag,
+        "sealed"
+    );
+    assert_eq!(message_count(&client).await, 1);
+}
@@ -0,0 +1,116 @@
+// Integration tests for NatsClient purge variants against a real JetStream
+// server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{
+    event_from_message, stream_subject, EventPublisher, NatsClient, NatsConfig,
+    StreamNotFoundError,
+};
+use futures::StreamExt;
+use serde_json::json;
+
+async fn connect_with_events(nats: &TestNats) -> NatsClient {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    for (stream, entity_id) in [
+        ("sensors", "sensor-01"),
+        ("alarms", "alarm-01"),
+        ("sensors", "sensor-02"),
+        ("alarms", "alarm-02"),
+    ] {
+        let event = FluxEvent::builder(stream)
+            .source("purge-test")
+            .payload(json!({"entity_id": entity_id, "properties": {}}))
+            .must_build();
+        publisher.publish(&event).await.unwrap();
+    }
+    client
+}
+
+/// Entity ids of the events left in FLUX_EVENTS, in stream order.
+async fn remaining(client: &NatsClient) -> Vec<String> {
+    let stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let consumer = stream
+        .create_consumer(async_nats::jetstream::consumer::pull::OrderedConfig::default())
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut ids = Vec::new();
+    while let Ok(Some(Ok(msg))) =
+        tokio::time::timeout(std::time::Duration::from_millis(200), messages.next()).await
+    {
+        let event = event_from_message(&msg).unwrap();
+        ids.push(event.payload["entity_id"].as_str().unwrap().to_string());
+    }
+    ids
+}
+
+#[tokio::test]
+async fn test_purge_stream_removes_everything() {
+    let nats = TestNats::start();
+    let client = connect_with_events(&nats).await;
+
+    assert_eq!(client.purge_stream("FLUX_EVENTS").await.unwrap(), 4);
+    assert!(remaining(&client).await.is_empty());
+}
+
+#[tokio::test]
+async fn test_purge_stream_by_subject() {
+    let nats = TestNats::start();
+    let client = connect_with_events(&nats).await;
+
+    let purged = client
+        .purge_stream_by_subject("FLUX_EVENTS", &stream_subject("alarms"))
+        .await
+        .unwrap();
+    assert_eq!(purged, 2);
+    assert_eq!(remaining(&client).await, vec!["sensor-01", "sensor-02"]);
+}
+
+#[tokio::test]
+async fn test_purge_stream_before_sequence() {
+    let nats = TestNats::start();
+    let client = connect_with_events(&nats).await;
+
+    let purged = client
+        .purge_stream_before_sequence("FLUX_EVENTS", 3)
+        .await
+        .unwrap();
+    assert_eq!(purged, 2);
+    assert_eq!(remaining(&client).await, vec!["sensor-02", "alarm-02"]);
+}
+
+#[tokio::test]
+async fn test_purge_unknown_stream() {
+    let nats = TestNats::start();
+    let client = connect_with_events(&nats).await;
+
+    for result in [
+        client.purge_stream("MISSING").await,
+        client
+            .purge_stream_by_subject("MISSING", "flux.events.a")
+            .await,
+        client.purge_stream_before_sequence("MISSING", 2).await,
+    ] {
+        let err = result.unwrap_err();
+        assert_eq!(
+            err.downcast_ref::<StreamNotFoundError>().unwrap().stream,
+            "MISSING"
+        );
+    }
+    assert!(client
+        .delete_stream("MISSING")
+        .await
+        .unwrap_err()
+        .downcast_ref::<StreamNotFoundError>()
+        .is_some());
+}
@@ -0,0 +1,141 @@
+// Integration tests for direct-get reads (StreamReader) against a real
+// JetStream server (see tests/common).
+//
+// The latency comparison is #[ignore]d; run it with
+// `cargo test --test stream_reader_test -- --ignored --nocapture`.
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{
+    decode_event, stream_subject, EventPublisher, NatsClient, NatsConfig, StreamReader,
+};
+use serde_json::json;
+use std::time::{Duration, Instant};
+
+async fn connect(nats: &TestNats, allow_direct: bool) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        allow_direct,
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+fn test_event(stream: &str, entity_id: &str) -> FluxEvent {
+    FluxEvent::builder(stream)
+        .source("reader-test")
+        .payload(json!({"entity_id": entity_id, "properties": {"value": 1}}))
+        .must_build()
+}
+
+async fn publish_samples(client: &NatsClient) {
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    for (stream, entity_id) in [
+        ("sensors", "sensor-01"),
+        ("alarms", "alarm-01"),
+        ("sensors", "sensor-02"),
+    ] {
+        publisher
+            .publish(&test_event(stream, entity_id))
+            .await
+            .unwrap();
+    }
+}
+
+async fn assert_reads(reader: &StreamReader) {
+    let message = reader.get(2).await.unwrap();
+    assert_eq!(message.sequence, 2);
+    let event = decode_event(Some(&message.headers), &message.payload).unwrap();
+    assert_eq!(event.payload["entity_id"], "alarm-01");
+
+    let message = reader.get_last(&stream_subject("sensors")).await.unwrap();
+    assert_eq!(message.sequence, 3);
+    let event = decode_event(Some(&message.headers), &message.payload).unwrap();
+    assert_eq!(event.payload["entity_id"], "sensor-02");
+
+    assert!(reader.get(99).await.is_err());
+    assert!(reader.get_last(&stream_subject("unknown")).await.is_err());
+}
+
+#[tokio::test]
+async fn test_new_streams_use_direct_get() {
+    let nats = TestNats::start();
+    let client = connect(&nats, true).await;
+    publish_samples(&client).await;
+
+    let reader = StreamReader::open(client.jetstream(), "FLUX_EVENTS")
+        .await
+        .unwrap();
+    assert!(reader.is_direct());
+    assert_reads(&reader).await;
+}
+
+#[tokio::test]
+async fn test_falls_back_when_direct_disabled() {
+    let nats = TestNats::start();
+    let client = connect(&nats, false).await;
+    publish_samples(&client).await;
+
+    let reader = StreamReader::open(client.jetstream(), "FLUX_EVENTS")
+        .await
+        .unwrap();
+    assert!(!reader.is_direct());
+    assert_reads(&reader).await;
+}
+
+#[tokio::test]
+async fn test_enable_direct_get_on_existing_stream() {
+    let nats = TestNats::start();
+    let client = connect(&nats, false).await;
+
+    assert!(client.enable_direct_get().await.unwrap());
+    assert!(!client.enable_direct_get().await.unwrap());
+
+    let reader = StreamReader::open(client.jetstream(), "FLUX_EVENTS")
+        .await
+        .unwrap();
+    assert!(reader.is_direct());
+}
+
+#[tokio::test]
+#[ignore]
+async fn bench_direct_vs_standard_get() {
+    const MESSAGES: u64 = 1_000;
+    const READS: u64 = 5_000;
+
+    let nats = TestNats::start();
+    let client = connect(&nats, true).await;
+    let publisher = EventPublisher::new(client.jetstream().clone());
+    for i in 0..MESSAGES {
+        publisher
+            .publish(&test_event("sensors", &format!("sensor-{}", i)))
+            .await
+            .unwrap();
+    }
+
+    let direct = StreamReader::open(client.jetstream(), "FLUX_EVENTS")
+        .await
+        .unwrap();
+    let standard = StreamReader::open(client.jetstream(), "FLUX_EVENTS")
+        .await
+        .unwrap()
+        .without_direct();
+
+    for (name, reader) in [("direct", &direct), ("standard", &standard)] {
+        let start = Instant::now();
+        for i in 0..READS {
+            reader.get(i % MESSAGES + 1).await.unwrap();
+        }
+        let elapsed = start.elapsed();
+        println!(
+            "{:>8} get: {:?} per read ({} reads)",
+            name,
+            elapsed / READS as u32,
+            READS
+        );
+        assert!(elapsed < Duration::from_secs(60));
+    }
+}
@@ -0,0 +1,172 @@
+// Integration tests for StreamUsageMonitor and /api/metrics/streams against a
+// real JetStream server (see tests/common).
+
+mod common;
+
+use async_nats::jetstream::stream;
+use axum::{
+    body::Body,
+    http::{Request, StatusCode},
+};
+use common::TestNats;
+use flux::api::{create_stream_usage_router, StreamUsageAppState};
+use flux::event::FluxEvent;
+use flux::nats::{
+    event_from_message, stream_subject, EventPublisher, NatsClient, NatsConfig,
+    StreamUsageMonitor, ALERT_STREAM,
+};
+use futures::StreamExt;
+use serde_json::Value;
+use std::sync::Arc;
+use std::time::Duration;
+use tower::ServiceExt;
+
+async fn setup(nats: &TestNats) -> (NatsClient, Arc<StreamUsageMonitor>) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+
+    // Small capped stream to push over the threshold
+    client
+        .jetstream()
+        .create_stream(stream::Config {
+            name: "CAPPED".to_string(),
+            subjects: vec!["capped.>".to_string()],
+            max_messages: 10,
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+
+    let monitor = Arc::new(
+        StreamUsageMonitor::new(client.jetstream().clone(), Duration::from_secs(60), 80.0)
+            .with_alerts(EventPublisher::new(client.jetstream().clone())),
+    );
+    (client, monitor)
+}
+
+async fn fill(client: &NatsClient, count: usize) {
+    for i in 0..count {
+        client
+            .jetstream()
+            .publish(format!("capped.{}", i), "x".into())
+            .await
+            .unwrap()
+            .await
+            .unwrap();
+    }
+}
+
+/// Events published to flux.system.alerts so far
+async fn read_alerts(nats: &TestNats) -> Vec<FluxEvent> {
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let consumer = stream
+        .create_consumer(async_nats::jetstream::consumer::pull::OrderedConfig {
+            filter_subject: format!("{}.>", stream_subject(ALERT_STREAM)),
+            ..Default::default()
+        })
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut events = Vec::new();
+    while let Ok(Some(Ok(msg))) =
+        tokio::time::timeout(Duration::from_millis(200), messages.next()).await
+    {
+        events.push(event_from_message(&msg).unwrap());
+    }
+    events
+}
+
+#[tokio::test]
+async fn test_alert_emitted_once_per_crossing() {
+    let nats = TestNats::start();
+    let (client, monitor) = setup(&nats).await;
+
+    fill(&client, 5).await;
+    monitor.refresh().await.unwrap();
+    assert!(read_alerts(&nats).await.is_empty());
+
+    fill(&client, 4).await; // 9/10 = 90%
+    monitor.refresh().await.unwrap();
+    monitor.refresh().await.unwrap();
+
+    let alerts = read_alerts(&nats).await;
+    assert_eq!(alerts.len(), 1);
+    let props = &alerts[0].payload["properties"];
+    assert_eq!(props["stream"], "CAPPED");
+    assert_eq!(props["metric"], "messages");
+    assert_eq!(props["used"], 9);
+    assert_eq!(props["limit"], 10);
+
+    let usage = monitor.get("CAPPED").unwrap();
+    assert_eq!(usage.messages, 9);
+    assert_eq!(usage.messages_pct, Some(90.0));
+}
+
+#[tokio::test]
+async fn test_usage_endpoint() {
+    let nats = TestNats::start();
+    let (client, monitor) = setup(&nats).await;
+    fill(&client, 3).await;
+    monitor.refresh().await.unwrap();
+
+    let app = create_stream_usage_router(StreamUsageAppState { monitor });
+
+    let response = app
+        .clone()
+        .oneshot(
+            Request::builder()
+                .uri("/api/metrics/streams/CAPPED")
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::OK);
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let usage: Value = serde_json::from_slice(&body).unwrap();
+    assert_eq!(usage["messages"], 3);
+    assert_eq!(usage["max_messages"], 10);
+    assert_eq!(usage["messages_pct"], 30.0);
+
+    let response = app
+        .clone()
+        .oneshot(
+            Request::builder()
+                .uri("/api/metrics/streams")
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    let body = axum::body::to_bytes(response.into_body(), usize::MAX)
+        .await
+        .unwrap();
+    let list: Value = serde_json::from_slice(&body).unwrap();
+    let names: Vec<_> = list["streams"]
+        .as_array()
+        .unwrap()
+        .iter()
+        .map(|s| s["stream"].as_str().unwrap())
+        .collect();
+    assert!(names.contains(&"CAPPED"));
+    assert!(names.contains(&"FLUX_EVENTS"));
+
+    let response = app
+        .oneshot(
+            Request::builder()
+                .uri("/api/metrics/streams/MISSING")
+                .body(Body::empty())
+                .unwrap(),
+        )
+        .await
+        .unwrap();
+    assert_eq!(response.status(), StatusCode::NOT_FOUND);
+}
@@ -0,0 +1,128 @@
+// Integration tests for per-event TTL purges against a real JetStream server
+// (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::{FluxEvent, ValidationError};
+use flux::nats::{
+    event_from_message, EventPublisher, NatsClient, NatsConfig, TtlPurgeConfig, TtlPurger,
+    TTL_HEADER,
+};
+use futures::StreamExt;
+use serde_json::json;
+use std::sync::Arc;
+use std::time::Duration;
+
+fn presence_event(key: &str, entity_id: &str, ttl: Option<Duration>) -> FluxEvent {
+    let builder = FluxEvent::builder("presence")
+        .source("ttl-test")
+        .key(key)
+        .payload(json!({"entity_id": entity_id, "properties": {}}));
+    match ttl {
+        Some(ttl) => builder.ttl(ttl).must_build(),
+        None => builder.must_build(),
+    }
+}
+
+async fn setup(nats: &TestNats) -> (NatsClient, Arc<TtlPurger>, EventPublisher) {
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let purger = Arc::new(
+        TtlPurger::open(
+            client.jetstream(),
+            "FLUX_EVENTS",
+            Duration::from_secs(7 * 86400),
+            TtlPurgeConfig {
+                streams: vec!["presence".to_string()],
+                interval_seconds: 10,
+            },
+        )
+        .await
+        .unwrap(),
+    );
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_subject_mapping(|event| {
+            format!(
+                "flux.events.{}.{}",
+                event.stream,
+                event.key.as_deref().unwrap_or("none")
+            )
+        })
+        .with_ttl_purger(Arc::clone(&purger));
+    (client, purger, publisher)
+}
+
+/// Entity ids of the events left in FLUX_EVENTS, in stream order.
+async fn remaining(client: &NatsClient) -> Vec<String> {
+    let stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let consumer = stream
+        .create_consumer(async_nats::jetstream::consumer::pull::OrderedConfig::default())
+        .await
+        .unwrap();
+    let mut messages = consumer.messages().await.unwrap();
+
+    let mut ids = Vec::new();
+    while let Ok(Some(Ok(msg))) =
+        tokio::time::timeout(Duration::from_millis(200), messages.next()).await
+    {
+        let event = event_from_message(&msg).unwrap();
+        ids.push(event.payload["entity_id"].as_str().unwrap().to_string());
+    }
+    ids
+}
+
+#[tokio::test]
+async fn test_expired_subjects_purged() {
+    let nats = TestNats::start();
+    let (client, purger, publisher) = setup(&nats).await;
+
+    let ttl = Some(Duration::from_secs(60));
+    publisher
+        .publish(&presence_event("user-1", "user-1a", ttl))
+        .await
+        .unwrap();
+    publisher
+        .publish(&presence_event("user-2", "user-2a", None))
+        .await
+        .unwrap();
+    publisher
+        .publish(&presence_event("user-1", "user-1b", ttl))
+        .await
+        .unwrap();
+
+    let stream = client.jetstream().get_stream("FLUX_EVENTS").await.unwrap();
+    let message = stream.get_raw_message(1).await.unwrap();
+    assert_eq!(message.headers.get(TTL_HEADER).unwrap().as_str(), "60000");
+
+    let now = chrono::Utc::now().timestamp_millis();
+    assert_eq!(purger.purge_expired(now).await.unwrap(), 0);
+    assert_eq!(remaining(&client).await, ["user-1a", "user-2a", "user-1b"]);
+
+    assert_eq!(purger.purge_expired(now + 120_000).await.unwrap(), 2);
+    assert_eq!(remaining(&client).await, ["user-2a"]);
+    // Index entries are gone with them
+    assert_eq!(purger.purge_expired(now + 120_000).await.unwrap(), 0);
+}
+
+#[tokio::test]
+async fn test_out_of_range_ttl_rejected() {
+    let nats = TestNats::start();
+    let (client, _purger, publisher) = setup(&nats).await;
+
+    for ttl in [Duration::ZERO, Duration::from_secs(7 * 86400)] {
+        let err = publisher
+            .publish(&presence_event("user-1", "user-1a", Some(ttl)))
+            .await
+            .unwrap_err();
+        assert!(matches!(
+            err.downcast_ref::<ValidationError>(),
+            Some(ValidationError::TtlOutOfRange(_))
+        ));
+    }
+    assert!(remaining(&client).await.is_empty());
+}
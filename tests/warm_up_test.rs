@@ -0,0 +1,96 @@
+// Integration tests for publisher warm-up and the stream existence cache
+// against a real JetStream server (see tests/common).
+
+mod common;
+
+use common::TestNats;
+use flux::event::FluxEvent;
+use flux::nats::{EventPublisher, NatsClient, NatsConfig, SubjectNotCapturedError};
+use serde_json::json;
+use std::time::Duration;
+
+fn reading(stream: &str) -> FluxEvent {
+    FluxEvent::builder(stream)
+        .source("warm-up-test")
+        .payload(json!({"entity_id": "sensor-01", "properties": {"t": 21.5}}))
+        .must_build()
+}
+
+/// FLUX_EVENTS capturing only the `sensors` Flux stream
+async fn connect(nats: &TestNats) -> NatsClient {
+    NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        stream_subjects: vec![
+            "flux.events.sensors".to_string(),
+            "flux.events.sensors.>".to_string(),
+        ],
+        ..Default::default()
+    })
+    .await
+    .unwrap()
+}
+
+#[tokio::test]
+async fn test_warm_up_checks_streams() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher = EventPublisher::new(client.jetstream().clone())
+        .with_stream_cache(Duration::from_secs(60))
+        .with_max_stream_depth("FLUX_EVENTS", 1000);
+
+    publisher.warm_up(&["sensors"]).await.unwrap();
+    publisher.publish(&reading("sensors")).await.unwrap();
+
+    let err = publisher.warm_up(&["sensors", "alarms"]).await.unwrap_err();
+    let uncaptured = err.downcast_ref::<SubjectNotCapturedError>().unwrap();
+    assert_eq!(uncaptured.subject, "flux.events.alarms");
+    assert_eq!(
+        uncaptured.to_string(),
+        "subject 'flux.events.alarms' is not captured by any JetStream stream"
+    );
+}
+
+#[tokio::test]
+async fn test_stream_cache_rejects_uncaptured_subjects() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let publisher =
+        EventPublisher::new(client.jetstream().clone()).with_stream_cache(Duration::ZERO);
+
+    publisher.publish(&reading("sensors")).await.unwrap();
+    let err = publisher.publish(&reading("alarms")).await.unwrap_err();
+    assert!(
+        err.downcast_ref::<SubjectNotCapturedError>().is_some(),
+        "{}",
+        err
+    );
+}
+
+#[tokio::test]
+async fn test_confirmed_streams_skip_the_lookup() {
+    let nats = TestNats::start();
+    let client = connect(&nats).await;
+    let cached =
+        EventPublisher::new(client.jetstream().clone()).with_stream_cache(Duration::from_secs(60));
+    let uncached =
+        EventPublisher::new(client.jetstream().clone()).with_stream_cache(Duration::ZERO);
+    cached.warm_up(&["sensors"]).await.unwrap();
+    uncached.warm_up(&["sensors"]).await.unwrap();
+
+    client
+        .jetstream()
+        .delete_stream("FLUX_EVENTS")
+        .await
+        .unwrap();
+
+    // Still confirmed: the publish goes out and JetStream rejects it
+    let err = cached.publish(&reading("sensors")).await.unwrap_err();
+    assert!(err.downcast_ref::<SubjectNotCapturedError>().is_none());
+    // Looked up again, and found missing
+    let err = uncached.publish(&reading("sensors")).await.unwrap_err();
+    assert!(
+        err.downcast_ref::<SubjectNotCapturedError>().is_some(),
+        "{}",
+        err
+    );
+}
@@ -0,0 +1,198 @@
+// Integration tests for webhook egress: local HTTP receivers plus a real
+// JetStream server (see tests/common).
+
+mod common;
+
+use axum::extract::State;
+use axum::http::{HeaderMap, StatusCode};
+use axum::routing::post;
+use axum::Router;
+use common::TestNats;
+use flux::event::{canonicalize_event, FluxEvent};
+use flux::nats::{
+    decode_event, DeliveryMeta, EventPublisher, NatsClient, NatsConfig, ReceivedEvent,
+    TRACEPARENT_HEADER,
+};
+use flux::webhook::{
+    sign, DeliveryOutcome, WebhookConfig, WebhookDispatcher, DEAD_LETTER_STREAM,
+    DELIVERY_COUNT_HEADER, SIGNATURE_HEADER,
+};
+use serde_json::json;
+use std::collections::BTreeMap;
+use std::sync::atomic::{AtomicUsize, Ordering};
+use std::sync::{Arc, Mutex};
+use std::time::Duration;
+use tokio::sync::Semaphore;
+
+/// Local receiver answering with `statuses` in turn (the last one repeats).
+#[derive(Clone)]
+struct Receiver {
+    statuses: Arc<Vec<StatusCode>>,
+    hits: Arc<AtomicUsize>,
+    bodies: Arc<Mutex<Vec<(HeaderMap, String)>>>,
+}
+
+async fn receive(State(receiver): State<Receiver>, headers: HeaderMap, body: String) -> StatusCode {
+    let hit = receiver.hits.fetch_add(1, Ordering::SeqCst);
+    receiver.bodies.lock().unwrap().push((headers, body));
+    receiver.statuses[hit.min(receiver.statuses.len() - 1)]
+}
+
+async fn start_receiver(statuses: Vec<StatusCode>) -> (String, Receiver) {
+    let receiver = Receiver {
+        statuses: Arc::new(statuses),
+        hits: Arc::new(AtomicUsize::new(0)),
+        bodies: Arc::new(Mutex::new(Vec::new())),
+    };
+    let app = Router::new()
+        .route("/hook", post(receive))
+        .with_state(receiver.clone());
+    let listener = tokio::net::TcpListener::bind("127.0.0.1:0").await.unwrap();
+    let url = format!("http://{}/hook", listener.local_addr().unwrap());
+    tokio::spawn(async move { axum::serve(listener, app).await.unwrap() });
+    (url, receiver)
+}
+
+fn config(url: &str, max_retries: u32) -> WebhookConfig {
+    WebhookConfig {
+        name: "crm".to_string(),
+        stream: "orders".to_string(),
+        key: None,
+        url: url.to_string(),
+        secret: "s3cret".to_string(),
+        max_retries,
+        concurrency: 2,
+        timeout_ms: 2_000,
+    }
+}
+
+fn dispatcher(url: &str, max_retries: u32) -> WebhookDispatcher {
+    WebhookDispatcher::new(config(url, max_retries), Arc::new(Semaphore::new(4)))
+        .unwrap()
+        .with_backoff(Duration::from_millis(10))
+}
+
+fn order(entity_id: &str) -> FluxEvent {
+    FluxEvent::builder("orders")
+        .source("shop")
+        .payload(json!({"entity_id": entity_id, "properties": {"total": 42}}))
+        .must_build()
+}
+
+#[tokio::test]
+async fn test_success_is_signed() {
+    let (url, receiver) = start_receiver(vec![StatusCode::OK]).await;
+    let event = order("order-1");
+
+    let outcome = dispatcher(&url, 3).deliver(&event).await;
+    assert_eq!(outcome, DeliveryOutcome::Delivered { attempts: 1 });
+
+    let bodies = receiver.bodies.lock().unwrap();
+    let (headers, body) = &bodies[0];
+    assert_eq!(
+        headers.get(SIGNATURE_HEADER).unwrap().to_str().unwrap(),
+        sign("s3cret", body.as_bytes())
+    );
+    let delivered: FluxEvent = serde_json::from_str(body).unwrap();
+    assert_eq!(delivered.event_id, event.event_id);
+    // The signed body is the canonical form of the event
+    assert_eq!(body.as_bytes(), canonicalize_event(&delivered).unwrap());
+}
+
+#[tokio::test]
+async fn test_received_event_forwards_delivery_count_and_trace() {
+    let (url, receiver) = start_receiver(vec![StatusCode::OK]).await;
+    let trace_parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01";
+    let received = ReceivedEvent {
+        event: order("order-1"),
+        meta: DeliveryMeta {
+            subject: "flux.events.orders".to_string(),
+            stream_sequence: 7,
+            consumer_sequence: 9,
+            delivered: 3,
+            stored_at: 1707668400000,
+        },
+        headers: BTreeMap::from([(TRACEPARENT_HEADER.to_string(), trace_parent.to_string())]),
+    };
+
+    let outcome = dispatcher(&url, 3).deliver_received(&received).await;
+    assert_eq!(outcome, DeliveryOutcome::Delivered { attempts: 1 });
+
+    let bodies = receiver.bodies.lock().unwrap();
+    let (headers, _) = &bodies[0];
+    assert_eq!(headers.get(DELIVERY_COUNT_HEADER).unwrap(), "3");
+    assert_eq!(headers.get(TRACEPARENT_HEADER).unwrap(), trace_parent);
+}
+
+#[tokio::test]
+async fn test_flaky_endpoint_retried() {
+    let (url, receiver) = start_receiver(vec![
+        StatusCode::INTERNAL_SERVER_ERROR,
+        StatusCode::BAD_GATEWAY,
+        StatusCode::OK,
+    ])
+    .await;
+
+    let outcome = dispatcher(&url, 3).deliver(&order("order-1")).await;
+    assert_eq!(outcome, DeliveryOutcome::Delivered { attempts: 3 });
+    assert_eq!(receiver.hits.load(Ordering::SeqCst), 3);
+}
+
+#[tokio::test]
+async fn test_retries_exhausted() {
+    let (url, receiver) = start_receiver(vec![StatusCode::SERVICE_UNAVAILABLE]).await;
+
+    let outcome = dispatcher(&url, 2).deliver(&order("order-1")).await;
+    assert!(matches!(
+        outcome,
+        DeliveryOutcome::Failed {
+            attempts: 3,
+            status: Some(503),
+            ..
+        }
+    ));
+    assert_eq!(receiver.hits.load(Ordering::SeqCst), 3);
+}
+
+#[tokio::test]
+async fn test_permanent_failure_parked_in_dead_letter() {
+    let nats = TestNats::start();
+    let client = NatsClient::connect(NatsConfig {
+        url: nats.url.clone(),
+        ..Default::default()
+    })
+    .await
+    .unwrap();
+    let (url, receiver) = start_receiver(vec![StatusCode::BAD_REQUEST]).await;
+    let dispatcher = Arc::new(
+        dispatcher(&url, 5).with_dead_letter(EventPublisher::new(client.jetstream().clone())),
+    );
+    let handle = tokio::spawn(
+        Arc::clone(&dispatcher).run(client.jetstream().clone(), "FLUX_EVENTS".to_string()),
+    );
+    // Let the durable consumer start before publishing (it delivers new events only)
+    tokio::time::sleep(Duration::from_millis(200)).await;
+
+    let event = order("order-1");
+    EventPublisher::new(client.jetstream().clone())
+        .publish(&event)
+        .await
+        .unwrap();
+    tokio::time::sleep(Duration::from_millis(500)).await;
+    dispatcher.stop();
+    handle.await.unwrap().unwrap();
+
+    // 400 is not retried
+    assert_eq!(receiver.hits.load(Ordering::SeqCst), 1);
+
+    let js = nats.jetstream().await;
+    let stream = js.get_stream("FLUX_EVENTS").await.unwrap();
+    let raw = stream.get_raw_message(2).await.unwrap();
+    let parked = decode_event(Some(&raw.headers), &raw.payload).unwrap();
+    assert_eq!(parked.stream, DEAD_LETTER_STREAM);
+    let properties = &parked.payload["properties"];
+    assert_eq!(properties["webhook"], "crm");
+    assert_eq!(properties["attempts"], 1);
+    assert_eq!(properties["last_status"], 400);
+    assert_eq!(properties["event"]["eventId"], json!(event.event_id));
+}